@@ -0,0 +1,65 @@
+/**
+ * Unit tests for per-run API lookup caching
+ */
+
+import { clearApiCache, memoize, peek } from './api-cache';
+
+describe('api-cache', () => {
+  beforeEach(() => {
+    clearApiCache();
+  });
+
+  describe('memoize', () => {
+    it('should share one lookup between concurrent callers', async () => {
+      const fetch = jest.fn().mockResolvedValue('value');
+
+      const results = await Promise.all([memoize('key', fetch), memoize('key', fetch)]);
+
+      expect(results).toEqual(['value', 'value']);
+      expect(fetch).toHaveBeenCalledTimes(1);
+    });
+
+    it('should cache lookups separately by key', async () => {
+      const fetch = jest.fn().mockImplementation(async () => fetch.mock.calls.length);
+
+      expect(await memoize('a', fetch)).toBe(1);
+      expect(await memoize('b', fetch)).toBe(2);
+      expect(await memoize('a', fetch)).toBe(1);
+    });
+
+    it('should evict failed lookups so they can be retried', async () => {
+      const fetch = jest
+        .fn()
+        .mockRejectedValueOnce(new Error('API error'))
+        .mockResolvedValue('value');
+
+      await expect(memoize('key', fetch)).rejects.toThrow('API error');
+      await expect(memoize('key', fetch)).resolves.toBe('value');
+      expect(fetch).toHaveBeenCalledTimes(2);
+    });
+  });
+
+  describe('peek', () => {
+    it('should only return values of completed lookups', async () => {
+      let resolve: (value: string) => void = () => {};
+      const pending = memoize('key', () => new Promise<string>((r) => (resolve = r)));
+
+      expect(peek('key')).toBeUndefined();
+      resolve('value');
+      await pending;
+      expect(peek('key')).toBe('value');
+    });
+  });
+
+  describe('clearApiCache', () => {
+    it('should force the next lookup to fetch again', async () => {
+      const fetch = jest.fn().mockResolvedValue('value');
+
+      await memoize('key', fetch);
+      clearApiCache();
+      await memoize('key', fetch);
+
+      expect(fetch).toHaveBeenCalledTimes(2);
+    });
+  });
+});
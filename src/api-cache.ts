@@ -0,0 +1,64 @@
+/**
+ * Per-run memoization of GitHub API lookups
+ */
+
+/**
+ * Cached lookups by key (promises, so concurrent callers share one request)
+ */
+const cache = new Map<string, Promise<unknown>>();
+
+/**
+ * Settled values by key, for callers that can reuse a result without waiting
+ */
+const settled = new Map<string, unknown>();
+
+/**
+ * Returns the cached result for a key, or starts the lookup and caches it
+ *
+ * @param key - Cache key identifying the lookup (e.g., `pulls/owner/repo/1`)
+ * @param fetch - Performs the lookup
+ * @returns Result of the first lookup for the key during this run
+ *
+ * @remarks
+ * The promise is cached before it resolves, so callers running concurrently
+ * (e.g., parallel projects) never issue duplicate requests. Failed lookups are
+ * evicted so that a later call can retry.
+ */
+export function memoize<T>(key: string, fetch: () => Promise<T>): Promise<T> {
+  const cached = cache.get(key);
+  if (cached) {
+    return cached as Promise<T>;
+  }
+
+  const promise = fetch().then(
+    (value) => {
+      settled.set(key, value);
+      return value;
+    },
+    (error: unknown) => {
+      cache.delete(key);
+      throw error;
+    }
+  );
+  cache.set(key, promise);
+
+  return promise;
+}
+
+/**
+ * Returns the value of a completed lookup without starting one
+ *
+ * @param key - Cache key
+ * @returns The cached value, or undefined if the lookup has not completed
+ */
+export function peek<T>(key: string): T | undefined {
+  return settled.get(key) as T | undefined;
+}
+
+/**
+ * Clears every cached lookup
+ */
+export function clearApiCache(): void {
+  cache.clear();
+  settled.clear();
+}
@@ -3,8 +3,20 @@
  */
 
 import * as core from '@actions/core';
-import { uploadPlanFile, downloadPlanFile } from './artifact-manager';
+import {
+  uploadPlanFile,
+  deleteSavedPlans,
+  downloadPlanFile,
+  getPlanArtifactName,
+  hasSavedPlan,
+  readPlanMetadata,
+  verifyPlanMetadata,
+  type PlanArtifactScope,
+} from './artifact-manager';
 import { DefaultArtifactClient } from '@actions/artifact';
+import { clearApiCache } from './api-cache';
+import { latestToken } from './github-app';
+import { getClient } from './github-client';
 
 // Mock fs module
 jest.mock('node:fs', () => {
@@ -12,12 +24,17 @@ jest.mock('node:fs', () => {
   return {
     ...actualFs,
     existsSync: jest.fn(),
+    readFileSync: jest.fn(),
+    writeFileSync: jest.fn(),
   };
 });
 
 // Mock the modules
 jest.mock('@actions/core');
 jest.mock('@actions/artifact');
+jest.mock('./github-app', () => ({ latestToken: jest.fn((token: string) => token) }));
+jest.mock('./github-client');
+jest.mock('@actions/github', () => ({ context: { sha: 'fedcba9876543210fedc', runId: 100 } }));
 
 // Import the mocked fs module
 import * as fs from 'node:fs';
@@ -25,6 +42,8 @@ import * as fs from 'node:fs';
 describe('artifact-manager', () => {
   const mockCore = core as jest.Mocked<typeof core>;
   const mockExistsSync = fs.existsSync as jest.MockedFunction<typeof fs.existsSync>;
+  const mockReadFileSync = fs.readFileSync as jest.MockedFunction<typeof fs.readFileSync>;
+  const mockWriteFileSync = fs.writeFileSync as jest.MockedFunction<typeof fs.writeFileSync>;
 
   // Create a mock artifact client
   const mockArtifactClient = {
@@ -33,12 +52,46 @@ describe('artifact-manager', () => {
     getArtifact: jest.fn(),
   };
 
+  const mockOctokit = {
+    rest: {
+      actions: {
+        listArtifactsForRepo: jest.fn(),
+        deleteArtifact: jest.fn(),
+        getWorkflowRun: jest.fn(),
+      },
+    },
+  };
+
+  const scope: PlanArtifactScope = {
+    token: 'ghs_token',
+    owner: 'acme',
+    repo: 'infra',
+    prNumber: 42,
+    sha: '0123456789abcdef0123',
+  };
+
   beforeEach(() => {
     jest.clearAllMocks();
+    clearApiCache();
     // Mock the DefaultArtifactClient constructor
     (DefaultArtifactClient as jest.MockedClass<typeof DefaultArtifactClient>).mockImplementation(
       () => mockArtifactClient as any
     );
+    (getClient as jest.Mock).mockReturnValue(mockOctokit);
+    // Every run is a run of this workflow in this repository unless a test says otherwise
+    mockOctokit.rest.actions.getWorkflowRun.mockResolvedValue({
+      data: { workflow_id: 7, repository: { id: 1 } },
+    });
+  });
+
+  describe('getPlanArtifactName', () => {
+    it('should name the plan after the project', () => {
+      expect(getPlanArtifactName('production')).toBe('tfplan-production');
+    });
+
+    it('should add the pull request and head commit with a scope', () => {
+      expect(getPlanArtifactName('production', scope)).toBe('tfplan-production-pr42-0123456789ab');
+    });
   });
 
   describe('uploadPlanFile', () => {
@@ -57,8 +110,8 @@ describe('artifact-manager', () => {
       expect(mockExistsSync).toHaveBeenCalledWith(planFilePath);
       expect(mockArtifactClient.uploadArtifact).toHaveBeenCalledWith(
         'tfplan-production',
-        [planFilePath],
-        process.cwd(),
+        [planFilePath, '/path/to/tfplan-production.metadata.json'],
+        '/path/to',
         {
           retentionDays: 90,
         }
@@ -66,6 +119,51 @@ describe('artifact-manager', () => {
       expect(result).toBe('tfplan-production');
     });
 
+    it('should name the artifact after the pull request commit with a scope', async () => {
+      mockExistsSync.mockReturnValue(true);
+      mockArtifactClient.uploadArtifact.mockResolvedValue({ id: 123, size: 1024 } as any);
+
+      const result = await uploadPlanFile(planFilePath, projectName, scope);
+
+      expect(mockArtifactClient.uploadArtifact).toHaveBeenCalledWith(
+        'tfplan-production-pr42-0123456789ab',
+        [planFilePath, '/path/to/tfplan-production.metadata.json'],
+        '/path/to',
+        { retentionDays: 90 }
+      );
+      expect(result).toBe('tfplan-production-pr42-0123456789ab');
+    });
+
+    it('should store the commit the plan was made from next to the plan', async () => {
+      mockExistsSync.mockReturnValue(true);
+      mockArtifactClient.uploadArtifact.mockResolvedValue({ id: 123, size: 1024 } as any);
+
+      await uploadPlanFile(planFilePath, projectName, scope);
+
+      const [metadataPath, content] = mockWriteFileSync.mock.calls[0];
+      expect(metadataPath).toBe('/path/to/tfplan-production.metadata.json');
+      expect(JSON.parse(content as string)).toEqual({
+        project: 'production',
+        sha: '0123456789abcdef0123',
+        prNumber: 42,
+        plannedAt: expect.any(String),
+      });
+    });
+
+    it('should store the commit of the workflow run without a scope', async () => {
+      mockExistsSync.mockReturnValue(true);
+      mockArtifactClient.uploadArtifact.mockResolvedValue({ id: 123, size: 1024 } as any);
+
+      await uploadPlanFile(planFilePath, projectName);
+
+      const content = mockWriteFileSync.mock.calls[0][1] as string;
+      expect(JSON.parse(content)).toEqual({
+        project: 'production',
+        sha: 'fedcba9876543210fedc',
+        plannedAt: expect.any(String),
+      });
+    });
+
     it('should throw error when plan file does not exist', async () => {
       mockExistsSync.mockReturnValue(false);
 
@@ -113,8 +211,8 @@ describe('artifact-manager', () => {
 
       expect(mockArtifactClient.uploadArtifact).toHaveBeenCalledWith(
         'tfplan-staging',
-        ['/path/to/tfplan-staging'],
-        process.cwd(),
+        ['/path/to/tfplan-staging', '/path/to/tfplan-staging.metadata.json'],
+        '/path/to',
         {
           retentionDays: 90,
         }
@@ -135,6 +233,175 @@ describe('artifact-manager', () => {
     });
   });
 
+  describe('readPlanMetadata', () => {
+    it('should read the metadata next to the plan file', () => {
+      mockExistsSync.mockReturnValue(true);
+      mockReadFileSync.mockReturnValue(
+        '{"project":"production","sha":"0123","plannedAt":"2024-05-01T12:00:00.000Z"}'
+      );
+
+      expect(readPlanMetadata('/tmp/tfplan-production')).toEqual({
+        project: 'production',
+        sha: '0123',
+        plannedAt: '2024-05-01T12:00:00.000Z',
+      });
+      expect(mockReadFileSync).toHaveBeenCalledWith('/tmp/tfplan-production.metadata.json', 'utf8');
+    });
+
+    it('should be undefined for a plan saved without metadata', () => {
+      mockExistsSync.mockReturnValue(false);
+
+      expect(readPlanMetadata('/tmp/tfplan-production')).toBeUndefined();
+    });
+
+    it('should reject metadata without a commit', () => {
+      mockExistsSync.mockReturnValue(true);
+      mockReadFileSync.mockReturnValue('{"project":"production"}');
+
+      expect(() => readPlanMetadata('/tmp/tfplan-production')).toThrow(
+        'Invalid plan metadata: /tmp/tfplan-production.metadata.json'
+      );
+    });
+  });
+
+  describe('verifyPlanMetadata', () => {
+    const metadata = {
+      project: 'production',
+      sha: '0123456789abcdef0123',
+      prNumber: 42,
+      plannedAt: '2024-05-01T12:00:00.000Z',
+    };
+
+    beforeEach(() => {
+      mockExistsSync.mockReturnValue(true);
+      mockReadFileSync.mockReturnValue(JSON.stringify(metadata));
+    });
+
+    it('should accept a plan of the project and commit', () => {
+      expect(
+        verifyPlanMetadata('/tmp/tfplan-production', 'production', '0123456789abcdef0123')
+      ).toEqual(metadata);
+    });
+
+    it('should reject a plan of another commit sharing the artifact name', () => {
+      expect(() =>
+        verifyPlanMetadata('/tmp/tfplan-production', 'production', '0123456789abffff0000')
+      ).toThrow('The saved plan was made from commit 0123456789abcdef0123');
+    });
+
+    it('should reject a plan of another project', () => {
+      expect(() =>
+        verifyPlanMetadata('/tmp/tfplan-production', 'staging', '0123456789abcdef0123')
+      ).toThrow('The saved plan was made for project production');
+    });
+
+    it('should reject a plan saved without metadata', () => {
+      mockExistsSync.mockReturnValue(false);
+
+      expect(() =>
+        verifyPlanMetadata('/tmp/tfplan-production', 'production', '0123456789abcdef0123')
+      ).toThrow('The saved plan has no metadata recording the commit it was made from');
+    });
+  });
+
+  describe('hasSavedPlan', () => {
+    it('should look for an unexpired artifact of the pull request commit', async () => {
+      mockOctokit.rest.actions.listArtifactsForRepo.mockResolvedValue({
+        data: {
+          artifacts: [{ id: 7, expired: false, workflow_run: { id: 99, head_repository_id: 1 } }],
+        },
+      });
+
+      await expect(hasSavedPlan('production', scope)).resolves.toBe(true);
+      expect(mockOctokit.rest.actions.listArtifactsForRepo).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        name: 'tfplan-production-pr42-0123456789ab',
+        per_page: 100,
+      });
+    });
+
+    it('should be false when the only artifact has expired', async () => {
+      mockOctokit.rest.actions.listArtifactsForRepo.mockResolvedValue({
+        data: {
+          artifacts: [{ id: 7, expired: true, workflow_run: { id: 99, head_repository_id: 1 } }],
+        },
+      });
+
+      await expect(hasSavedPlan('production', scope)).resolves.toBe(false);
+    });
+
+    it('should ignore an artifact of a run on code from a fork', async () => {
+      mockOctokit.rest.actions.listArtifactsForRepo.mockResolvedValue({
+        data: {
+          artifacts: [{ id: 7, expired: false, workflow_run: { id: 99, head_repository_id: 2 } }],
+        },
+      });
+
+      await expect(hasSavedPlan('production', scope)).resolves.toBe(false);
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'Ignoring artifact tfplan-production-pr42-0123456789ab of workflow run 99, ' +
+          'which ran code from another repository'
+      );
+    });
+
+    it('should ignore an artifact of a run of another workflow', async () => {
+      mockOctokit.rest.actions.listArtifactsForRepo.mockResolvedValue({
+        data: {
+          artifacts: [{ id: 7, expired: false, workflow_run: { id: 99, head_repository_id: 1 } }],
+        },
+      });
+      mockOctokit.rest.actions.getWorkflowRun.mockImplementation(({ run_id }) =>
+        Promise.resolve({ data: { workflow_id: run_id === 99 ? 8 : 7, repository: { id: 1 } } })
+      );
+
+      await expect(hasSavedPlan('production', scope)).resolves.toBe(false);
+      expect(mockOctokit.rest.actions.getWorkflowRun).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        run_id: 100,
+      });
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'Ignoring artifact tfplan-production-pr42-0123456789ab of workflow run 99, ' +
+          'which is not a run of this workflow'
+      );
+    });
+  });
+
+  describe('deleteSavedPlans', () => {
+    it('should delete the unexpired plans of the pull request commit', async () => {
+      mockOctokit.rest.actions.listArtifactsForRepo.mockResolvedValue({
+        data: {
+          artifacts: [
+            { id: 11, expired: false },
+            { id: 12, expired: true },
+            { id: 13, expired: false },
+          ],
+        },
+      });
+
+      await expect(deleteSavedPlans('production', scope)).resolves.toBe(2);
+
+      expect(mockOctokit.rest.actions.listArtifactsForRepo).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        name: 'tfplan-production-pr42-0123456789ab',
+        per_page: 100,
+      });
+      expect(mockOctokit.rest.actions.deleteArtifact).toHaveBeenCalledTimes(2);
+      expect(mockOctokit.rest.actions.deleteArtifact).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        artifact_id: 11,
+      });
+      expect(mockOctokit.rest.actions.deleteArtifact).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        artifact_id: 13,
+      });
+    });
+  });
+
   describe('downloadPlanFile', () => {
     const projectName = 'production';
     const downloadPath = '/tmp/downloads';
@@ -263,5 +530,106 @@ describe('artifact-manager', () => {
         'Failed to download plan file artifact: API error'
       );
     });
+
+    it('should prefer the plan of the current workflow run with a scope', async () => {
+      mockArtifactClient.getArtifact.mockResolvedValue({ artifact: { id: 123 } } as any);
+      mockArtifactClient.downloadArtifact.mockResolvedValue({ downloadPath } as any);
+      mockExistsSync.mockReturnValue(true);
+
+      await downloadPlanFile(projectName, downloadPath, scope);
+
+      expect(mockArtifactClient.getArtifact).toHaveBeenCalledWith(
+        'tfplan-production-pr42-0123456789ab'
+      );
+      expect(mockOctokit.rest.actions.listArtifactsForRepo).not.toHaveBeenCalled();
+    });
+
+    it('should download the latest plan of the commit from an earlier workflow run', async () => {
+      mockArtifactClient.getArtifact.mockRejectedValue(new Error('Artifact not found'));
+      mockOctokit.rest.actions.listArtifactsForRepo.mockResolvedValue({
+        data: {
+          artifacts: [
+            {
+              id: 1,
+              expired: false,
+              created_at: '2024-05-01T10:00:00Z',
+              workflow_run: { id: 11, head_repository_id: 1 },
+            },
+            {
+              id: 3,
+              expired: true,
+              created_at: '2024-05-03T10:00:00Z',
+              workflow_run: { id: 33, head_repository_id: 1 },
+            },
+            {
+              id: 2,
+              expired: false,
+              created_at: '2024-05-02T10:00:00Z',
+              workflow_run: { id: 22, head_repository_id: 1 },
+            },
+          ],
+        },
+      });
+      mockArtifactClient.downloadArtifact.mockResolvedValue({ downloadPath } as any);
+      mockExistsSync.mockReturnValue(true);
+
+      const result = await downloadPlanFile(projectName, downloadPath, scope);
+
+      expect(mockOctokit.rest.actions.listArtifactsForRepo).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        name: 'tfplan-production-pr42-0123456789ab',
+        per_page: 100,
+      });
+      expect(mockArtifactClient.downloadArtifact).toHaveBeenCalledWith(2, {
+        path: downloadPath,
+        findBy: {
+          token: 'ghs_token',
+          workflowRunId: 22,
+          repositoryOwner: 'acme',
+          repositoryName: 'infra',
+        },
+      });
+      expect(result).toBe('/tmp/downloads/tfplan-production');
+    });
+
+    it('should download an earlier plan with the refreshed installation token', async () => {
+      (latestToken as jest.Mock).mockReturnValueOnce('ghs_refreshed');
+      mockArtifactClient.getArtifact.mockRejectedValue(new Error('Artifact not found'));
+      mockOctokit.rest.actions.listArtifactsForRepo.mockResolvedValue({
+        data: {
+          artifacts: [
+            {
+              id: 2,
+              expired: false,
+              created_at: '2024-05-02T10:00:00Z',
+              workflow_run: { id: 22, head_repository_id: 1 },
+            },
+          ],
+        },
+      });
+      mockArtifactClient.downloadArtifact.mockResolvedValue({ downloadPath } as any);
+      mockExistsSync.mockReturnValue(true);
+
+      await downloadPlanFile(projectName, downloadPath, scope);
+
+      expect(latestToken).toHaveBeenCalledWith('ghs_token');
+      expect(mockArtifactClient.downloadArtifact).toHaveBeenCalledWith(2, {
+        path: downloadPath,
+        findBy: expect.objectContaining({ token: 'ghs_refreshed' }),
+      });
+    });
+
+    it('should fail when no run saved a plan of the commit', async () => {
+      mockArtifactClient.getArtifact.mockRejectedValue(new Error('Artifact not found'));
+      mockOctokit.rest.actions.listArtifactsForRepo.mockResolvedValue({
+        data: { artifacts: [] },
+      });
+
+      await expect(downloadPlanFile(projectName, downloadPath, scope)).rejects.toThrow(
+        'Artifact not found: tfplan-production-pr42-0123456789ab'
+      );
+      expect(mockArtifactClient.downloadArtifact).not.toHaveBeenCalled();
+    });
   });
 });
@@ -3,22 +3,83 @@
  */
 
 import * as fs from 'node:fs';
+import * as path from 'node:path';
 import { DefaultArtifactClient } from '@actions/artifact';
 import * as core from '@actions/core';
+import * as github from '@actions/github';
+import { memoize } from './api-cache';
+import { latestToken } from './github-app';
+import { getClient } from './github-client';
+
+/**
+ * Pull request commit a plan belongs to, and how to find plans of earlier workflow runs
+ */
+export interface PlanArtifactScope {
+  /** GitHub token for API access (needs the actions: read permission) */
+  token: string;
+  /** Repository owner */
+  owner: string;
+  /** Repository name */
+  repo: string;
+  /** Pull request number */
+  prNumber: number;
+  /** Head commit SHA the plan was made from */
+  sha: string;
+}
+
+/**
+ * What a saved plan was made from, stored next to the plan file in its artifact
+ */
+export interface PlanMetadata {
+  /** Project the plan was made for */
+  project: string;
+  /** Commit SHA the plan was made from */
+  sha: string;
+  /** Pull request the plan was made on, if any */
+  prNumber?: number;
+  /** When the plan was saved (ISO 8601) */
+  plannedAt: string;
+}
+
+/**
+ * Builds the name of the artifact holding a project's plan
+ *
+ * @param projectName - Name of the project
+ * @param scope - Pull request commit the plan belongs to
+ * @returns Artifact name
+ *
+ * @example
+ * getPlanArtifactName('production')
+ * // => 'tfplan-production'
+ *
+ * @example
+ * getPlanArtifactName('production', { prNumber: 42, sha: '0123456789abcdef', ... })
+ * // => 'tfplan-production-pr42-0123456789ab'
+ */
+export function getPlanArtifactName(projectName: string, scope?: PlanArtifactScope): string {
+  const base = `tfplan-${projectName}`;
+  return scope ? `${base}-pr${scope.prNumber}-${scope.sha.slice(0, 12)}` : base;
+}
 
 /**
  * Uploads a Terraform plan file as a GitHub Actions artifact
  *
  * @param planFilePath - Absolute path to the plan file
  * @param projectName - Name of the project (used for artifact naming)
+ * @param scope - Pull request commit the plan belongs to
  * @returns Artifact name
  *
  * @remarks
- * Artifact will be named: tfplan-<projectName>
- * Artifacts are available within the same workflow run for download
+ * Artifact will be named: tfplan-<projectName>, followed by -pr<number>-<sha> with a scope.
+ * The plan file is stored at the root of the artifact, along with its metadata, which
+ * records the commit planned (the scope's, or else the one the workflow run is for).
  */
-export async function uploadPlanFile(planFilePath: string, projectName: string): Promise<string> {
-  const artifactName = `tfplan-${projectName}`;
+export async function uploadPlanFile(
+  planFilePath: string,
+  projectName: string,
+  scope?: PlanArtifactScope
+): Promise<string> {
+  const artifactName = getPlanArtifactName(projectName, scope);
 
   // Verify file exists
   if (!fs.existsSync(planFilePath)) {
@@ -28,11 +89,20 @@ export async function uploadPlanFile(planFilePath: string, projectName: string):
   core.info(`Uploading plan file as artifact: ${artifactName}`);
 
   try {
+    const metadata: PlanMetadata = {
+      project: projectName,
+      sha: scope?.sha ?? github.context.sha,
+      ...(scope && { prNumber: scope.prNumber }),
+      plannedAt: new Date().toISOString(),
+    };
+    const metadataPath = getPlanMetadataPath(planFilePath);
+    fs.writeFileSync(metadataPath, `${JSON.stringify(metadata, null, 2)}\n`);
+
     const artifactClient = new DefaultArtifactClient();
     const uploadResult = await artifactClient.uploadArtifact(
       artifactName,
-      [planFilePath],
-      process.cwd(),
+      [planFilePath, metadataPath],
+      path.dirname(planFilePath),
       {
         retentionDays: 90, // Keep plan files for 90 days
       }
@@ -54,31 +124,54 @@ export async function uploadPlanFile(planFilePath: string, projectName: string):
  *
  * @param projectName - Name of the project
  * @param downloadPath - Directory to download the plan file to
+ * @param scope - Pull request commit the plan must belong to
  * @returns Path to the downloaded plan file
  *
  * @remarks
- * Downloads artifact named: tfplan-<projectName>
+ * The artifact is looked up in the current workflow run first. With a scope, the latest
+ * unexpired artifact of the same pull request commit from an earlier run is used next,
+ * so an apply comment applies the plan made for exactly the commit under review.
  * Returns the full path to the downloaded plan file
  */
-export async function downloadPlanFile(projectName: string, downloadPath: string): Promise<string> {
-  const artifactName = `tfplan-${projectName}`;
+export async function downloadPlanFile(
+  projectName: string,
+  downloadPath: string,
+  scope?: PlanArtifactScope
+): Promise<string> {
+  const artifactName = getPlanArtifactName(projectName, scope);
 
   core.info(`Downloading plan file artifact: ${artifactName}`);
 
   try {
     const artifactClient = new DefaultArtifactClient();
 
-    // First, get the artifact to find its ID
-    const artifact = await artifactClient.getArtifact(artifactName);
-    if (!artifact) {
+    let downloadResult: { downloadPath?: string };
+    const artifact = await findArtifactInCurrentRun(artifactClient, artifactName, !!scope);
+    if (artifact) {
+      // Download the artifact by ID
+      downloadResult = await artifactClient.downloadArtifact(artifact.artifact.id, {
+        path: downloadPath,
+      });
+    } else if (scope) {
+      const earlier = await findLatestArtifact(scope, artifactName);
+      if (!earlier) {
+        throw new Error(`Artifact not found: ${artifactName}`);
+      }
+      core.info(`Using plan file from workflow run ${earlier.workflowRunId}`);
+      downloadResult = await artifactClient.downloadArtifact(earlier.id, {
+        path: downloadPath,
+        findBy: {
+          // An installation token minted for the app may have been refreshed since
+          token: latestToken(scope.token),
+          workflowRunId: earlier.workflowRunId,
+          repositoryOwner: scope.owner,
+          repositoryName: scope.repo,
+        },
+      });
+    } else {
       throw new Error(`Artifact not found: ${artifactName}`);
     }
 
-    // Download the artifact by ID
-    const downloadResult = await artifactClient.downloadArtifact(artifact.artifact.id, {
-      path: downloadPath,
-    });
-
     core.info(`Plan file downloaded to: ${downloadResult.downloadPath}`);
 
     // Return the path to the actual plan file
@@ -97,3 +190,227 @@ export async function downloadPlanFile(projectName: string, downloadPath: string
     );
   }
 }
+
+/**
+ * Path of the metadata stored next to a plan file
+ *
+ * @param planFilePath - Path to the plan file
+ * @returns Path to the metadata file
+ *
+ * @example
+ * getPlanMetadataPath('/repo/prod/tfplan-prod')
+ * // => '/repo/prod/tfplan-prod.metadata.json'
+ */
+export function getPlanMetadataPath(planFilePath: string): string {
+  return `${planFilePath}.metadata.json`;
+}
+
+/**
+ * Reads the metadata stored next to a downloaded plan file
+ *
+ * @param planFilePath - Path to the downloaded plan file
+ * @returns Metadata, or undefined if the plan was saved without any
+ * @throws Error if the metadata cannot be parsed
+ */
+export function readPlanMetadata(planFilePath: string): PlanMetadata | undefined {
+  const metadataPath = getPlanMetadataPath(planFilePath);
+  if (!fs.existsSync(metadataPath)) {
+    return undefined;
+  }
+  const metadata: unknown = JSON.parse(fs.readFileSync(metadataPath, 'utf8'));
+  if (
+    typeof metadata !== 'object' ||
+    metadata === null ||
+    typeof (metadata as PlanMetadata).project !== 'string' ||
+    typeof (metadata as PlanMetadata).sha !== 'string' ||
+    typeof (metadata as PlanMetadata).plannedAt !== 'string'
+  ) {
+    throw new Error(`Invalid plan metadata: ${metadataPath}`);
+  }
+  return metadata as PlanMetadata;
+}
+
+/**
+ * Checks that a downloaded plan was made for a project from a commit
+ *
+ * @param planFilePath - Path to the downloaded plan file
+ * @param projectName - Project the plan must be of
+ * @param sha - Commit the plan must have been made from
+ * @returns Metadata of the plan
+ * @throws Error if the plan has no metadata, or was made for another project or commit
+ *
+ * @remarks
+ * Artifact names only hold a prefix of the commit SHA, so the full SHA is compared here.
+ */
+export function verifyPlanMetadata(
+  planFilePath: string,
+  projectName: string,
+  sha: string
+): PlanMetadata {
+  const metadata = readPlanMetadata(planFilePath);
+  if (!metadata) {
+    throw new Error('The saved plan has no metadata recording the commit it was made from');
+  }
+  if (metadata.project !== projectName) {
+    throw new Error(`The saved plan was made for project ${metadata.project}`);
+  }
+  if (metadata.sha !== sha) {
+    throw new Error(`The saved plan was made from commit ${metadata.sha}`);
+  }
+  return metadata;
+}
+
+/**
+ * Whether an earlier workflow run saved a plan of a project for a pull request commit
+ *
+ * @param projectName - Name of the project
+ * @param scope - Pull request commit the plan must belong to
+ * @returns True if an unexpired plan artifact exists
+ */
+export async function hasSavedPlan(
+  projectName: string,
+  scope: PlanArtifactScope
+): Promise<boolean> {
+  return (await findLatestArtifact(scope, getPlanArtifactName(projectName, scope))) !== null;
+}
+
+/**
+ * Deletes the plans of a project saved for a pull request commit, so they cannot be applied
+ *
+ * @param projectName - Name of the project
+ * @param scope - Pull request commit the plans belong to
+ * @returns Number of artifacts deleted
+ *
+ * @remarks
+ * Deleting artifacts needs the actions: write permission.
+ */
+export async function deleteSavedPlans(
+  projectName: string,
+  scope: PlanArtifactScope
+): Promise<number> {
+  const octokit = getClient(scope.token);
+  const artifactName = getPlanArtifactName(projectName, scope);
+  const { data } = await octokit.rest.actions.listArtifactsForRepo({
+    owner: scope.owner,
+    repo: scope.repo,
+    name: artifactName,
+    per_page: 100,
+  });
+
+  const saved = data.artifacts.filter((artifact) => !artifact.expired);
+  for (const artifact of saved) {
+    await octokit.rest.actions.deleteArtifact({
+      owner: scope.owner,
+      repo: scope.repo,
+      artifact_id: artifact.id,
+    });
+  }
+  if (saved.length > 0) {
+    core.info(`Deleted ${saved.length} outdated plan artifact(s): ${artifactName}`);
+  }
+  return saved.length;
+}
+
+/**
+ * Looks up an artifact uploaded by the current workflow run
+ *
+ * @param artifactClient - Artifact client
+ * @param artifactName - Artifact name
+ * @param tolerateErrors - Treat a failed lookup as not found (earlier runs are searched next)
+ * @returns Artifact, or null if the current run has none with that name
+ */
+async function findArtifactInCurrentRun(
+  artifactClient: DefaultArtifactClient,
+  artifactName: string,
+  tolerateErrors: boolean
+): Promise<{ artifact: { id: number } } | null> {
+  try {
+    return await artifactClient.getArtifact(artifactName);
+  } catch (error) {
+    if (!tolerateErrors) {
+      throw error;
+    }
+    core.info(
+      `No artifact ${artifactName} in this workflow run: ${error instanceof Error ? error.message : String(error)}`
+    );
+    return null;
+  }
+}
+
+/**
+ * Finds the latest unexpired artifact with a name uploaded by a trusted run of this workflow
+ *
+ * @param scope - Repository and token to search with
+ * @param artifactName - Artifact name
+ * @returns Artifact ID and the workflow run that uploaded it, or null if there is none
+ *
+ * @remarks
+ * Any workflow run of the repository can upload an artifact with any name, including
+ * `pull_request` runs of forks, which run a workflow file the fork controls. Only
+ * artifacts of runs of this workflow on code from this repository are trusted; others
+ * are ignored with a warning, as if the plan was missing. The plan metadata cannot
+ * tell them apart, as it travels in the same artifact.
+ */
+async function findLatestArtifact(
+  scope: PlanArtifactScope,
+  artifactName: string
+): Promise<{ id: number; workflowRunId: number } | null> {
+  const octokit = getClient(scope.token);
+  const { data } = await octokit.rest.actions.listArtifactsForRepo({
+    owner: scope.owner,
+    repo: scope.repo,
+    name: artifactName,
+    per_page: 100,
+  });
+
+  const candidates = data.artifacts
+    .filter((artifact) => !artifact.expired && artifact.workflow_run?.id)
+    .sort((a, b) => (b.created_at ?? '').localeCompare(a.created_at ?? ''));
+  if (candidates.length === 0) {
+    return null;
+  }
+
+  const current = await getWorkflowRunOrigin(scope, github.context.runId);
+  for (const artifact of candidates) {
+    const runId = artifact.workflow_run?.id as number;
+    if (artifact.workflow_run?.head_repository_id !== current.repositoryId) {
+      core.warning(
+        `Ignoring artifact ${artifactName} of workflow run ${runId}, ` +
+          'which ran code from another repository'
+      );
+      continue;
+    }
+    const origin = await getWorkflowRunOrigin(scope, runId);
+    if (origin.workflowId !== current.workflowId) {
+      core.warning(
+        `Ignoring artifact ${artifactName} of workflow run ${runId}, ` +
+          'which is not a run of this workflow'
+      );
+      continue;
+    }
+    return { id: artifact.id, workflowRunId: runId };
+  }
+  return null;
+}
+
+/**
+ * Looks up the workflow and repository of a workflow run (cached for the run)
+ *
+ * @param scope - Repository and token to look up with
+ * @param runId - ID of the workflow run
+ * @returns ID of the workflow the run belongs to, and of the repository it ran in
+ */
+function getWorkflowRunOrigin(
+  scope: PlanArtifactScope,
+  runId: number
+): Promise<{ workflowId: number; repositoryId: number }> {
+  return memoize(`actions/runs/${scope.owner}/${scope.repo}/${runId}`, async () => {
+    const octokit = getClient(scope.token);
+    const { data } = await octokit.rest.actions.getWorkflowRun({
+      owner: scope.owner,
+      repo: scope.repo,
+      run_id: runId,
+    });
+    return { workflowId: data.workflow_id, repositoryId: data.repository.id };
+  });
+}
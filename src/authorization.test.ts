@@ -0,0 +1,131 @@
+/**
+ * Unit tests for command authorization
+ */
+
+import * as github from '@actions/github';
+import { clearApiCache } from './api-cache';
+import { checkCommandAuthorization, getRepositoryPermission, hasPermission } from './authorization';
+
+// Mock the @actions modules
+jest.mock('@actions/core');
+jest.mock('@actions/github');
+
+describe('authorization', () => {
+  const mockGithub = github as jest.Mocked<typeof github>;
+  const mockOctokit = {
+    rest: {
+      repos: { getCollaboratorPermissionLevel: jest.fn() },
+      teams: { getMembershipForUserInOrg: jest.fn() },
+    },
+  };
+
+  /**
+   * Makes the API report the given permissions of every user
+   */
+  function usePermissions(permissions: Record<string, boolean>, permission = 'write'): void {
+    mockOctokit.rest.repos.getCollaboratorPermissionLevel.mockResolvedValue({
+      data: { permission, user: { permissions } },
+    });
+  }
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    clearApiCache();
+    mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+  });
+
+  describe('getRepositoryPermission', () => {
+    it('should resolve the highest permission of the user', async () => {
+      usePermissions({ admin: false, maintain: true, push: true, triage: true, pull: true });
+
+      await expect(getRepositoryPermission('token', 'acme', 'infra', 'alice')).resolves.toBe(
+        'maintain'
+      );
+      expect(mockOctokit.rest.repos.getCollaboratorPermissionLevel).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        username: 'alice',
+      });
+    });
+
+    it('should fall back to the legacy permission field', async () => {
+      mockOctokit.rest.repos.getCollaboratorPermissionLevel.mockResolvedValue({
+        data: { permission: 'read', user: null },
+      });
+
+      await expect(getRepositoryPermission('token', 'acme', 'infra', 'alice')).resolves.toBe(
+        'read'
+      );
+    });
+
+    it('should report no permission for a user without access', async () => {
+      mockOctokit.rest.repos.getCollaboratorPermissionLevel.mockResolvedValue({
+        data: { permission: 'none', user: null },
+      });
+
+      await expect(
+        getRepositoryPermission('token', 'acme', 'infra', 'mallory')
+      ).resolves.toBeUndefined();
+    });
+  });
+
+  describe('hasPermission', () => {
+    it('should compare permissions by level', () => {
+      expect(hasPermission('admin', 'write')).toBe(true);
+      expect(hasPermission('write', 'write')).toBe(true);
+      expect(hasPermission('triage', 'write')).toBe(false);
+      expect(hasPermission(undefined, 'read')).toBe(false);
+    });
+  });
+
+  describe('checkCommandAuthorization', () => {
+    it('should require write permission by default', async () => {
+      usePermissions({ triage: true, pull: true });
+
+      await expect(
+        checkCommandAuthorization('token', 'acme', 'infra', 'alice', {})
+      ).resolves.toBe('requires write permission on the repository (has triage)');
+    });
+
+    it('should allow listed users regardless of case', async () => {
+      usePermissions({ push: true, pull: true });
+
+      await expect(
+        checkCommandAuthorization('token', 'acme', 'infra', 'Alice', { users: ['alice'] })
+      ).resolves.toBeUndefined();
+    });
+
+    it('should allow active members of a listed team', async () => {
+      usePermissions({ push: true, pull: true });
+      mockOctokit.rest.teams.getMembershipForUserInOrg.mockResolvedValue({
+        data: { state: 'active' },
+      });
+
+      await expect(
+        checkCommandAuthorization('token', 'acme', 'infra', 'bob', {
+          users: ['alice'],
+          teams: ['acme/platform'],
+        })
+      ).resolves.toBeUndefined();
+      expect(mockOctokit.rest.teams.getMembershipForUserInOrg).toHaveBeenCalledWith({
+        org: 'acme',
+        team_slug: 'platform',
+        username: 'bob',
+      });
+    });
+
+    it('should deny users outside the listed users and teams', async () => {
+      usePermissions({ admin: true, push: true, pull: true });
+      mockOctokit.rest.teams.getMembershipForUserInOrg.mockRejectedValue(
+        Object.assign(new Error('Not Found'), { status: 404 })
+      );
+
+      await expect(
+        checkCommandAuthorization('token', 'acme', 'infra', 'carol', {
+          teams: ['acme/platform'],
+          permission: 'read',
+        })
+      ).resolves.toBe('not one of the allowed users or teams');
+    });
+  });
+});
@@ -0,0 +1,124 @@
+/**
+ * Authorization of PR comment authors to run commands
+ */
+
+import { memoize } from './api-cache';
+import { isTeamMember } from './codeowners';
+import { REPOSITORY_PERMISSIONS } from './config';
+import { getClient } from './github-client';
+import type { CommandAuthorization, RepositoryPermission } from './types';
+
+/**
+ * Repository permission a restricted command needs unless its rule sets one
+ */
+export const DEFAULT_REQUIRED_PERMISSION: RepositoryPermission = 'write';
+
+/**
+ * Rule `terraform apply --all` is checked against unless authorization.apply_all sets one
+ *
+ * @remarks
+ * Applying every project is restricted even without a rule, so that anyone allowed
+ * to apply one project cannot apply all of them.
+ */
+export const DEFAULT_APPLY_ALL_AUTHORIZATION: CommandAuthorization = { permission: 'maintain' };
+
+/**
+ * Looks up a user's permission on a repository (cached for the run)
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param username - Login of the user
+ * @returns Highest permission of the user, or undefined without access
+ */
+export function getRepositoryPermission(
+  token: string,
+  owner: string,
+  repo: string,
+  username: string
+): Promise<RepositoryPermission | undefined> {
+  return memoize(`permissions/${owner}/${repo}/${username}`, async () => {
+    const octokit = getClient(token);
+    const { data } = await octokit.rest.repos.getCollaboratorPermissionLevel({
+      owner,
+      repo,
+      username,
+    });
+
+    // The legacy permission field reports maintain as write and triage as read
+    const permissions = data.user?.permissions;
+    if (permissions) {
+      const granted: Record<RepositoryPermission, boolean | undefined> = {
+        read: permissions.pull,
+        triage: permissions.triage,
+        write: permissions.push,
+        maintain: permissions.maintain,
+        admin: permissions.admin,
+      };
+      return [...REPOSITORY_PERMISSIONS].reverse().find((permission) => granted[permission]);
+    }
+    return REPOSITORY_PERMISSIONS.find((permission) => permission === data.permission);
+  });
+}
+
+/**
+ * Whether a permission includes another one
+ *
+ * @example
+ * hasPermission('maintain', 'write')
+ * // => true
+ */
+export function hasPermission(
+  actual: RepositoryPermission | undefined,
+  required: RepositoryPermission
+): boolean {
+  return (
+    actual !== undefined &&
+    REPOSITORY_PERMISSIONS.indexOf(actual) >= REPOSITORY_PERMISSIONS.indexOf(required)
+  );
+}
+
+/**
+ * Checks whether a commenter may run a command
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param login - Login of the commenter
+ * @param rule - Authorization rule of the command
+ * @returns Why the commenter is denied, or undefined if they are allowed
+ *
+ * @remarks
+ * The commenter needs the rule's repository permission and, when the rule lists
+ * users or teams, must be one of the users or an active member of one of the teams.
+ * Team membership can only be read with a token that has the members: read
+ * organization permission; without it, team members are denied.
+ */
+export async function checkCommandAuthorization(
+  token: string,
+  owner: string,
+  repo: string,
+  login: string,
+  rule: CommandAuthorization
+): Promise<string | undefined> {
+  const required = rule.permission ?? DEFAULT_REQUIRED_PERMISSION;
+  const permission = await getRepositoryPermission(token, owner, repo, login);
+  if (!hasPermission(permission, required)) {
+    return `requires ${required} permission on the repository (has ${permission ?? 'none'})`;
+  }
+
+  if (!rule.users && !rule.teams) {
+    return undefined;
+  }
+  // GitHub logins are case-insensitive
+  if ((rule.users ?? []).some((user) => user.toLowerCase() === login.toLowerCase())) {
+    return undefined;
+  }
+  for (const team of rule.teams ?? []) {
+    const [org, teamSlug] = team.split('/');
+    if (await isTeamMember(token, org, teamSlug, login)) {
+      return undefined;
+    }
+  }
+  return 'not one of the allowed users or teams';
+}
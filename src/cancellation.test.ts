@@ -0,0 +1,81 @@
+/**
+ * Unit tests for run cancellation
+ */
+
+import * as core from '@actions/core';
+import {
+  cancelRun,
+  getCancellationSignal,
+  isRunCancelled,
+  RunCancelledError,
+  throwIfCancelled,
+  trapCancellation,
+} from './cancellation';
+
+jest.mock('@actions/core');
+
+describe('cancellation', () => {
+  const mockCore = core as jest.Mocked<typeof core>;
+  let release: (() => void) | undefined;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+  });
+
+  afterEach(() => {
+    release?.();
+    release = undefined;
+  });
+
+  it('should do nothing until cancellation is trapped', () => {
+    cancelRun('SIGINT');
+
+    expect(getCancellationSignal()).toBeUndefined();
+    expect(isRunCancelled()).toBe(false);
+    expect(() => throwIfCancelled('terraform plan')).not.toThrow();
+  });
+
+  it('should cancel the run when the runner sends SIGINT or SIGTERM', () => {
+    release = trapCancellation();
+    const signal = getCancellationSignal();
+
+    process.emit('SIGTERM', 'SIGTERM');
+
+    expect(signal?.aborted).toBe(true);
+    expect(isRunCancelled()).toBe(true);
+    expect(mockCore.warning).toHaveBeenCalledWith(
+      'Received SIGTERM: the workflow run was cancelled, stopping terraform'
+    );
+    expect(() => throwIfCancelled('terraform plan')).toThrow(
+      new RunCancelledError('terraform plan was cancelled (SIGTERM)')
+    );
+  });
+
+  it('should only report the first signal', () => {
+    release = trapCancellation();
+
+    process.emit('SIGINT', 'SIGINT');
+    process.emit('SIGTERM', 'SIGTERM');
+
+    expect(mockCore.warning).toHaveBeenCalledTimes(1);
+    expect(() => throwIfCancelled('tfcmt')).toThrow('tfcmt was cancelled (SIGINT)');
+  });
+
+  it('should stop handling signals once released', () => {
+    const listeners = process.listenerCount('SIGINT');
+    trapCancellation()();
+
+    expect(process.listenerCount('SIGINT')).toBe(listeners);
+    expect(isRunCancelled()).toBe(false);
+  });
+
+  it('should start over when trapped again', () => {
+    const releaseFirst = trapCancellation();
+    cancelRun('SIGINT');
+    release = trapCancellation();
+    releaseFirst();
+
+    expect(isRunCancelled()).toBe(false);
+    expect(getCancellationSignal()).toBeDefined();
+  });
+});
@@ -0,0 +1,98 @@
+/**
+ * Cancellation of the run when its workflow is cancelled
+ */
+
+import * as core from '@actions/core';
+
+/**
+ * Signals the Actions runner sends a job that is cancelled (SIGINT first, then SIGTERM)
+ */
+export const CANCELLATION_SIGNALS: NodeJS.Signals[] = ['SIGINT', 'SIGTERM'];
+
+/**
+ * Error raised by commands stopped, or refused, because the run was cancelled
+ */
+export class RunCancelledError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = 'RunCancelledError';
+  }
+}
+
+/**
+ * Aborted once the run is cancelled (undefined until cancellation is trapped)
+ */
+let controller: AbortController | undefined;
+
+/**
+ * Signal name that cancelled the run
+ */
+let cancelledBy: string | undefined;
+
+/**
+ * Cancels the run when the runner signals the job, until the returned function is called
+ *
+ * @returns Function that removes the signal handlers
+ *
+ * @remarks
+ * Node exits on SIGINT and SIGTERM by default, leaving terraform running without
+ * anyone to report it. Handling them instead stops the commands still running, so
+ * terraform can release its state lock, and lets the run report the cancellation.
+ */
+export function trapCancellation(): () => void {
+  const trapped = new AbortController();
+  controller = trapped;
+  cancelledBy = undefined;
+  const handler = (signal: NodeJS.Signals) => cancelRun(signal);
+  for (const signal of CANCELLATION_SIGNALS) {
+    process.on(signal, handler);
+  }
+  return () => {
+    for (const signal of CANCELLATION_SIGNALS) {
+      process.off(signal, handler);
+    }
+    if (controller === trapped) {
+      controller = undefined;
+    }
+  };
+}
+
+/**
+ * Cancels the run: commands still running are stopped and no new ones start
+ *
+ * @param reason - What cancelled the run (e.g., SIGINT)
+ */
+export function cancelRun(reason: string): void {
+  if (!controller || controller.signal.aborted) {
+    return;
+  }
+  cancelledBy = reason;
+  core.warning(`Received ${reason}: the workflow run was cancelled, stopping terraform`);
+  controller.abort();
+}
+
+/**
+ * Signal aborted when the run is cancelled, or undefined when cancellation is not trapped
+ */
+export function getCancellationSignal(): AbortSignal | undefined {
+  return controller?.signal;
+}
+
+/**
+ * Whether the run has been cancelled
+ */
+export function isRunCancelled(): boolean {
+  return controller?.signal.aborted === true;
+}
+
+/**
+ * Throws when the run has been cancelled
+ *
+ * @param what - What was stopped or refused, e.g. "terraform plan"
+ * @throws RunCancelledError if the run has been cancelled
+ */
+export function throwIfCancelled(what: string): void {
+  if (isRunCancelled()) {
+    throw new RunCancelledError(`${what} was cancelled (${cancelledBy})`);
+  }
+}
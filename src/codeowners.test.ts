@@ -0,0 +1,185 @@
+/**
+ * Unit tests for CODEOWNERS parsing and code owner approval checks
+ */
+
+import * as github from '@actions/github';
+import { clearApiCache } from './api-cache';
+import {
+  codeownersPatternToRegExp,
+  fetchCodeowners,
+  findOwners,
+  findPathsWithoutCodeownerApproval,
+  parseCodeowners,
+} from './codeowners';
+import type { PullRequestInfo } from './types';
+
+// Mock the @actions modules
+jest.mock('@actions/core');
+jest.mock('@actions/github');
+
+describe('codeowners', () => {
+  const mockGithub = github as jest.Mocked<typeof github>;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    clearApiCache();
+  });
+
+  describe('parseCodeowners', () => {
+    it('should parse rules and skip comments and blank lines', () => {
+      const rules = parseCodeowners(
+        '# Infrastructure\n\n/terraform/ @org/infra @alice # platform\ndocs/*\n'
+      );
+
+      expect(rules).toEqual([
+        { pattern: '/terraform/', owners: ['@org/infra', '@alice'] },
+        { pattern: 'docs/*', owners: [] },
+      ]);
+    });
+  });
+
+  describe('codeownersPatternToRegExp', () => {
+    it.each([
+      ['*', 'any/file.txt', true],
+      ['*.tf', 'terraform/prod/main.tf', true],
+      ['*.tf', 'terraform/prod/main.tfvars', false],
+      ['/terraform/', 'terraform/prod/main.tf', true],
+      ['/terraform/', 'modules/terraform/main.tf', false],
+      ['terraform/', 'modules/terraform/main.tf', true],
+      ['docs/*', 'docs/readme.md', true],
+      ['docs/*', 'docs/guides/setup.md', false],
+      ['apps/**/main.tf', 'apps/a/b/main.tf', true],
+      ['apps/**/main.tf', 'apps/main.tf', true],
+      ['/prod', 'prod/main.tf', true],
+      ['/prod', 'production/main.tf', false],
+    ])('should match %s against %s: %s', (pattern, filePath, expected) => {
+      expect(codeownersPatternToRegExp(pattern).test(filePath)).toBe(expected);
+    });
+  });
+
+  describe('findOwners', () => {
+    it('should use the last matching rule', () => {
+      const rules = parseCodeowners('* @alice\n/terraform/prod/ @org/infra\n/terraform/prod/docs/');
+
+      expect(findOwners(rules, 'README.md')).toEqual(['@alice']);
+      expect(findOwners(rules, 'terraform/prod/main.tf')).toEqual(['@org/infra']);
+      expect(findOwners(rules, 'terraform/prod/docs/x.md')).toEqual([]);
+    });
+  });
+
+  describe('fetchCodeowners', () => {
+    const mockOctokit = {
+      rest: { repos: { getContent: jest.fn() } },
+    };
+
+    beforeEach(() => {
+      mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+    });
+
+    it('should read the first CODEOWNERS file found on the branch', async () => {
+      mockOctokit.rest.repos.getContent
+        .mockRejectedValueOnce(Object.assign(new Error('Not Found'), { status: 404 }))
+        .mockResolvedValueOnce({
+          data: { type: 'file', content: Buffer.from('* @alice').toString('base64') },
+        });
+
+      const content = await fetchCodeowners('token', 'owner', 'repo', 'main');
+
+      expect(content).toBe('* @alice');
+      expect(mockOctokit.rest.repos.getContent).toHaveBeenLastCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        path: 'CODEOWNERS',
+        ref: 'main',
+      });
+    });
+
+    it('should return null when no CODEOWNERS file exists', async () => {
+      mockOctokit.rest.repos.getContent.mockRejectedValue(
+        Object.assign(new Error('Not Found'), { status: 404 })
+      );
+
+      expect(await fetchCodeowners('token', 'owner', 'repo', 'main')).toBeNull();
+    });
+  });
+
+  describe('findPathsWithoutCodeownerApproval', () => {
+    const mockOctokit = {
+      paginate: jest.fn(),
+      rest: {
+        repos: { getContent: jest.fn() },
+        pulls: { listFiles: jest.fn() },
+        teams: { getMembershipForUserInOrg: jest.fn() },
+      },
+    };
+
+    const pr: PullRequestInfo = {
+      number: 123,
+      owner: 'owner',
+      repo: 'repo',
+      isFork: false,
+      mergeable: true,
+      mergeability: 'mergeable',
+      approved: true,
+      sha: 'abc123',
+      diverged: false,
+      labels: [],
+      headBranch: 'feature',
+      baseBranch: 'main',
+      approvers: ['bob'],
+    };
+
+    beforeEach(() => {
+      mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+      mockOctokit.rest.repos.getContent.mockResolvedValue({
+        data: {
+          type: 'file',
+          content: Buffer.from(
+            '/terraform/prod/ @org/infra\n/terraform/dev/ @bob\n/docs/ @carol'
+          ).toString('base64'),
+        },
+      });
+      mockOctokit.paginate.mockResolvedValue([
+        { filename: 'terraform/prod/main.tf' },
+        { filename: 'terraform/dev/main.tf' },
+        { filename: 'docs/readme.md' },
+        { filename: 'README.md' },
+      ]);
+    });
+
+    it('should report owned paths without an approving owner', async () => {
+      mockOctokit.rest.teams.getMembershipForUserInOrg.mockResolvedValue({
+        data: { state: 'active' },
+      });
+
+      const missing = await findPathsWithoutCodeownerApproval('token', pr);
+
+      expect(missing).toEqual(['docs/readme.md']);
+      expect(mockOctokit.rest.teams.getMembershipForUserInOrg).toHaveBeenCalledWith({
+        org: 'org',
+        team_slug: 'infra',
+        username: 'bob',
+      });
+    });
+
+    it('should not count teams the approver does not belong to', async () => {
+      mockOctokit.rest.teams.getMembershipForUserInOrg.mockRejectedValue(
+        Object.assign(new Error('Not Found'), { status: 404 })
+      );
+
+      const missing = await findPathsWithoutCodeownerApproval('token', pr);
+
+      expect(missing).toEqual(['terraform/prod/main.tf', 'docs/readme.md']);
+    });
+
+    it('should throw when the base branch has no CODEOWNERS file', async () => {
+      mockOctokit.rest.repos.getContent.mockRejectedValue(
+        Object.assign(new Error('Not Found'), { status: 404 })
+      );
+
+      await expect(findPathsWithoutCodeownerApproval('token', pr)).rejects.toThrow(
+        'codeowner_approved requires a CODEOWNERS file on main'
+      );
+    });
+  });
+});
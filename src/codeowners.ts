@@ -0,0 +1,232 @@
+/**
+ * CODEOWNERS parsing and code owner approval checks
+ */
+
+import * as core from '@actions/core';
+import { memoize } from './api-cache';
+import { fetchRepositoryFile, getClient } from './github-client';
+import { getChangedFiles } from './pr-validation';
+import type { PullRequestInfo } from './types';
+
+/**
+ * Locations GitHub looks for a CODEOWNERS file, in order
+ */
+export const CODEOWNERS_PATHS = ['.github/CODEOWNERS', 'CODEOWNERS', 'docs/CODEOWNERS'];
+
+/**
+ * A CODEOWNERS line: a path pattern and its owners
+ */
+export interface CodeownersRule {
+  /** Path pattern (gitignore-like syntax) */
+  pattern: string;
+  /** Owners: @user, @org/team or email (empty means the path has no owners) */
+  owners: string[];
+}
+
+/**
+ * Parses the contents of a CODEOWNERS file
+ *
+ * @param content - File contents
+ * @returns Rules in file order
+ *
+ * @example
+ * parseCodeowners('# Infra\n/terraform/ @org/infra @alice')
+ * // => [{ pattern: '/terraform/', owners: ['@org/infra', '@alice'] }]
+ */
+export function parseCodeowners(content: string): CodeownersRule[] {
+  const rules: CodeownersRule[] = [];
+
+  for (const rawLine of content.split('\n')) {
+    // Comments start at a # at the beginning of a line or after whitespace
+    const line = rawLine.replace(/(^|\s)#.*$/, '').trim();
+    if (line === '') {
+      continue;
+    }
+
+    const [pattern, ...owners] = line.split(/\s+/);
+    rules.push({ pattern, owners });
+  }
+
+  return rules;
+}
+
+/**
+ * Converts a CODEOWNERS pattern to a regular expression matching repository paths
+ *
+ * @param pattern - Pattern such as `*.tf`, `/terraform/` or `docs/**`
+ * @returns Regular expression tested against paths relative to the repository root
+ *
+ * @remarks
+ * - A pattern with a leading or inner `/` is anchored at the repository root,
+ *   otherwise it matches at any depth
+ * - `*` does not cross directories, `**` does
+ * - A pattern matches a file or everything below a directory of that name,
+ *   except `dir/*`, which only matches files directly in `dir`
+ */
+export function codeownersPatternToRegExp(pattern: string): RegExp {
+  const anchored = pattern.startsWith('/') || pattern.slice(0, -1).includes('/');
+  const body = pattern.replace(/^\//, '').replace(/\/$/, '');
+
+  let source = '';
+  for (let i = 0; i < body.length; i++) {
+    const char = body[i];
+    if (char === '*' && body[i + 1] === '*') {
+      if (body[i + 2] === '/') {
+        source += '(?:.*/)?';
+        i += 2;
+      } else {
+        source += '.*';
+        i += 1;
+      }
+    } else if (char === '*') {
+      source += '[^/]*';
+    } else if (char === '?') {
+      source += '[^/]';
+    } else {
+      source += char.replace(/[.+^${}()|[\]\\]/g, '\\$&');
+    }
+  }
+
+  const prefix = anchored ? '^' : '^(?:.*/)?';
+  const suffix = body.endsWith('/*') ? '$' : '(?:/|$)';
+  return new RegExp(`${prefix}${source}${suffix}`);
+}
+
+/**
+ * Finds the owners of a path
+ *
+ * @param rules - Parsed CODEOWNERS rules
+ * @param filePath - Path relative to the repository root
+ * @returns Owners from the last matching rule (empty if no rule matches)
+ */
+export function findOwners(rules: CodeownersRule[], filePath: string): string[] {
+  for (let i = rules.length - 1; i >= 0; i--) {
+    if (codeownersPatternToRegExp(rules[i].pattern).test(filePath)) {
+      return rules[i].owners;
+    }
+  }
+  return [];
+}
+
+/**
+ * Fetches the CODEOWNERS file of a branch
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param ref - Branch to read the file from
+ * @returns File contents, or null if the branch has no CODEOWNERS file
+ */
+export async function fetchCodeowners(
+  token: string,
+  owner: string,
+  repo: string,
+  ref: string
+): Promise<string | null> {
+  for (const path of CODEOWNERS_PATHS) {
+    const content = await fetchRepositoryFile(token, owner, repo, path, ref);
+    if (content !== null) {
+      return content;
+    }
+  }
+
+  return null;
+}
+
+/**
+ * Finds the changed paths of a PR that have code owners but no approval from one
+ *
+ * @param token - GitHub token for API access
+ * @param pr - Pull request information (with approvers)
+ * @returns Paths lacking code owner approval (empty when every owned path is approved)
+ * @throws Error if the base branch has no CODEOWNERS file
+ *
+ * @remarks
+ * CODEOWNERS is read from the base branch, so a PR cannot change its own
+ * owners. Paths without owners need no approval. Team owners are checked
+ * through team membership, which requires a token that can read the
+ * organization's teams; if membership cannot be read, the team does not count.
+ * Email owners are not supported.
+ */
+export async function findPathsWithoutCodeownerApproval(
+  token: string,
+  pr: PullRequestInfo
+): Promise<string[]> {
+  const content = await fetchCodeowners(token, pr.owner, pr.repo, pr.baseBranch);
+  if (content === null) {
+    throw new Error(
+      `codeowner_approved requires a CODEOWNERS file on ${pr.baseBranch} (${CODEOWNERS_PATHS.join(', ')})`
+    );
+  }
+
+  const rules = parseCodeowners(content);
+  const files = await getChangedFiles(token, pr.owner, pr.repo, pr.number);
+  const missing: string[] = [];
+
+  for (const file of files) {
+    const owners = findOwners(rules, file);
+    if (owners.length > 0 && !(await isApprovedByAnyOwner(token, owners, pr.approvers))) {
+      missing.push(file);
+    }
+  }
+
+  return missing;
+}
+
+/**
+ * Whether any approver is one of the owners (directly or through a team)
+ */
+async function isApprovedByAnyOwner(
+  token: string,
+  owners: string[],
+  approvers: string[]
+): Promise<boolean> {
+  const logins = approvers.map((login) => `@${login.toLowerCase()}`);
+
+  for (const ownerName of owners) {
+    if (logins.includes(ownerName.toLowerCase())) {
+      return true;
+    }
+
+    const team = ownerName.match(/^@([^/]+)\/(.+)$/);
+    if (!team) {
+      continue;
+    }
+    for (const approver of approvers) {
+      if (await isTeamMember(token, team[1], team[2], approver)) {
+        return true;
+      }
+    }
+  }
+
+  return false;
+}
+
+/**
+ * Whether a user is an active member of a team (cached for the run)
+ */
+export function isTeamMember(
+  token: string,
+  org: string,
+  teamSlug: string,
+  username: string
+): Promise<boolean> {
+  return memoize(`teams/${org}/${teamSlug}/${username}`, async () => {
+    const octokit = getClient(token);
+    try {
+      const { data } = await octokit.rest.teams.getMembershipForUserInOrg({
+        org,
+        team_slug: teamSlug,
+        username,
+      });
+      return data.state === 'active';
+    } catch (error) {
+      if ((error as { status?: number }).status !== 404) {
+        core.warning(
+          `Could not check membership of @${org}/${teamSlug}: ${error instanceof Error ? error.message : String(error)}`
+        );
+      }
+      return false;
+    }
+  });
+}
@@ -2,7 +2,16 @@
  * Unit tests for PR comment parsing logic
  */
 
-import { parseComment, validateProjectNames, getTargetProjects } from './comment-parser';
+import {
+  DEFAULT_COMMENT_SYNTAX,
+  getCommentSyntax,
+  parseComment,
+  parseComments,
+  parseDispatchInputs,
+  UnknownCommandError,
+  validateProjectNames,
+  getTargetProjects,
+} from './comment-parser';
 
 describe('comment-parser', () => {
   describe('parseComment', () => {
@@ -16,6 +25,30 @@ describe('comment-parser', () => {
       });
     });
 
+    it('should mark plan -destroy as a destroy preview', () => {
+      const result = parseComment('terraform plan -destroy -project=staging');
+
+      expect(result).toEqual({
+        command: 'plan',
+        projects: ['staging'],
+        args: ['-destroy'],
+        destroy: true,
+      });
+      expect(parseComment('terraform apply -destroy')?.destroy).toBeUndefined();
+    });
+
+    it('should parse --force as a plan that does not reuse the saved plan', () => {
+      expect(parseComment('terraform plan -project=staging --force')).toEqual({
+        command: 'plan',
+        projects: ['staging'],
+        args: [],
+        force: true,
+      });
+      expect(() => parseComment('terraform apply --force')).toThrow(
+        '--force is only supported for terraform plan'
+      );
+    });
+
     it('should parse basic apply command', () => {
       const result = parseComment('terraform apply');
 
@@ -132,6 +165,26 @@ describe('comment-parser', () => {
       });
     });
 
+    it('should join -var and -var-file with their separate values', () => {
+      const result = parseComment("terraform plan -var 'foo=bar baz' -var-file prod.tfvars");
+
+      expect(result).toEqual({
+        command: 'plan',
+        projects: [],
+        args: ['-var=foo=bar baz', '-var-file=prod.tfvars'],
+      });
+    });
+
+    it('should reject -var without a value', () => {
+      expect(() => parseComment('terraform plan -var')).toThrow('-var requires a value');
+    });
+
+    it('should reject an unterminated quote', () => {
+      expect(() => parseComment('terraform plan -var="foo=bar')).toThrow(
+        'Unterminated " quote in arguments'
+      );
+    });
+
     it('should trim whitespace from comment', () => {
       const result = parseComment('  terraform plan  ');
 
@@ -146,6 +199,48 @@ describe('comment-parser', () => {
       expect(parseComment('')).toBeNull();
     });
 
+    it('should return null for a whitespace-only comment', () => {
+      expect(parseComment('  \n\t ')).toBeNull();
+    });
+
+    it('should reject a mistyped command with a suggestion', () => {
+      expect(() => parseComment('terraform paln -project=staging')).toThrow(
+        new UnknownCommandError('terraform', 'paln', 'plan')
+      );
+      expect(() => parseComment('terraform aplly')).toThrow(
+        'Unknown command: terraform aplly (did you mean terraform apply?)'
+      );
+      expect(() => parseComment('terraform planx')).toThrow('did you mean terraform plan?');
+    });
+
+    it('should reject an unknown command followed only by flags', () => {
+      let error: unknown;
+      try {
+        parseComment('terraform console -project=staging');
+      } catch (e) {
+        error = e;
+      }
+
+      expect(error).toBeInstanceOf(UnknownCommandError);
+      expect(error).toMatchObject({ prefix: 'terraform', subcommand: 'console' });
+      expect((error as UnknownCommandError).suggestion).toBeUndefined();
+    });
+
+    it('should reject the bare prefix as a missing command', () => {
+      expect(() => parseComment('terraform')).toThrow(
+        'terraform is missing a command (plan, apply, destroy, init, drift, state, import, show, approve_policies)'
+      );
+      expect(() => parseComment('terraform -project=staging')).toThrow(
+        'terraform is missing a command'
+      );
+    });
+
+    it('should not mistake prose for a command', () => {
+      expect(parseComment('terraform is great')).toBeNull();
+      expect(parseComment('terraform 1.9 fixed this')).toBeNull();
+      expect(parseComment('Run terraform plan later')).toBeNull();
+    });
+
     it('should handle complex real-world examples', () => {
       const result = parseComment(
         'terraform plan -project=prod-us-east,prod-us-west -target=module.vpc -var-file=production.tfvars'
@@ -177,6 +272,417 @@ describe('comment-parser', () => {
         args: [],
       });
     });
+
+    it('should parse --all selector', () => {
+      const result = parseComment('terraform plan --all');
+
+      expect(result).toEqual({
+        command: 'plan',
+        projects: [],
+        args: [],
+        all: true,
+      });
+    });
+
+    it('should parse --all selector alongside terraform arguments', () => {
+      const result = parseComment('terraform apply --all -var-file=prod.tfvars');
+
+      expect(result).toEqual({
+        command: 'apply',
+        projects: [],
+        args: ['-var-file=prod.tfvars'],
+        all: true,
+      });
+    });
+
+    it('should parse -refresh and -lock-timeout as first-class options', () => {
+      const result = parseComment(
+        'terraform plan -refresh=false -lock-timeout=5m -target=aws_instance.web'
+      );
+
+      expect(result).toEqual({
+        command: 'plan',
+        projects: [],
+        args: ['-target=aws_instance.web'],
+        refresh: false,
+        lockTimeout: '5m',
+      });
+    });
+
+    it('should throw for an invalid -refresh value', () => {
+      expect(() => {
+        parseComment('terraform plan -refresh=no');
+      }).toThrow('Invalid -refresh value: no. Must be true or false');
+    });
+
+    it('should throw for an invalid -lock-timeout value', () => {
+      expect(() => {
+        parseComment('terraform apply -lock-timeout=forever');
+      }).toThrow('Invalid -lock-timeout value: forever');
+    });
+
+    it('should throw when --all is combined with -project', () => {
+      expect(() => {
+        parseComment('terraform plan --all -project=production');
+      }).toThrow('--all cannot be combined with -project');
+    });
+
+    it('should parse -tag selectors alongside -project', () => {
+      const result = parseComment(
+        'terraform plan -tag=networking,dns -project=production -tag=edge -target=aws_vpc.main'
+      );
+
+      expect(result).toEqual({
+        command: 'plan',
+        projects: ['production'],
+        tags: ['networking', 'dns', 'edge'],
+        args: ['-target=aws_vpc.main'],
+      });
+    });
+
+    it('should parse -w and -workspace selectors', () => {
+      const result = parseComment('terraform plan -w=prod -project=network -workspace=dev,qa');
+
+      expect(result).toEqual({
+        command: 'plan',
+        projects: ['network'],
+        workspaces: ['prod', 'dev', 'qa'],
+        args: [],
+      });
+    });
+
+    it('should throw for an invalid workspace name', () => {
+      expect(() => {
+        parseComment('terraform plan -w=../prod');
+      }).toThrow('Invalid workspace name: ../prod');
+    });
+
+    it('should throw when --all is combined with -tag', () => {
+      expect(() => {
+        parseComment('terraform plan --all -tag=networking');
+      }).toThrow('--all cannot be combined with -tag');
+    });
+
+    it('should parse -dir and -d selectors and keep wildcards in -project', () => {
+      const result = parseComment('terraform plan -project=app-*,network -d=envs/* -dir=.');
+
+      expect(result).toEqual({
+        command: 'plan',
+        projects: ['app-*', 'network'],
+        dirs: ['envs/*', '.'],
+        args: [],
+      });
+    });
+
+    it('should throw when --all is combined with -dir', () => {
+      expect(() => {
+        parseComment('terraform plan --all -dir=envs');
+      }).toThrow('--all cannot be combined with -dir');
+    });
+
+    it('should parse init with allowlisted flags', () => {
+      const result = parseComment('terraform init -upgrade -reconfigure -project=staging');
+
+      expect(result).toEqual({
+        command: 'init',
+        projects: ['staging'],
+        args: ['-upgrade', '-reconfigure'],
+      });
+    });
+
+    it('should reject init flags outside the allowlist', () => {
+      expect(() => {
+        parseComment('terraform init -backend-config=evil.hcl');
+      }).toThrow('Unsupported flag for terraform init: -backend-config=evil.hcl');
+    });
+
+    it('should reject -reconfigure combined with -migrate-state', () => {
+      expect(() => {
+        parseComment('terraform init -reconfigure -migrate-state');
+      }).toThrow('-reconfigure cannot be combined with -migrate-state');
+    });
+
+    it('should reject plan options for init', () => {
+      expect(() => {
+        parseComment('terraform init -lock-timeout=5m');
+      }).toThrow('-refresh and -lock-timeout are not supported for terraform init');
+    });
+
+    it('should parse drift with project selection', () => {
+      const result = parseComment('terraform drift -project=production');
+
+      expect(result).toEqual({ command: 'drift', projects: ['production'], args: [] });
+    });
+
+    it('should reject terraform arguments for drift', () => {
+      expect(() => {
+        parseComment('terraform drift -target=aws_instance.example');
+      }).toThrow('Unsupported arguments for terraform drift: -target=aws_instance.example');
+    });
+
+    it('should parse state subcommands and forward their arguments', () => {
+      const result = parseComment('terraform state show aws_instance.web -project=staging');
+
+      expect(result).toEqual({
+        command: 'state',
+        projects: ['staging'],
+        args: ['aws_instance.web'],
+        stateSubcommand: 'show',
+      });
+    });
+
+    it('should reject unknown state subcommands', () => {
+      expect(() => {
+        parseComment('terraform state push -project=staging');
+      }).toThrow('Unknown state subcommand: push. Must be one of: list, show, rm, mv');
+    });
+
+    it('should require a state subcommand', () => {
+      expect(() => {
+        parseComment('terraform state');
+      }).toThrow('terraform state requires a subcommand: list, show, rm, mv');
+    });
+
+    it('should require exactly one project for state mutations', () => {
+      expect(() => {
+        parseComment('terraform state rm aws_instance.old');
+      }).toThrow('terraform state rm requires exactly one -project');
+      expect(() => {
+        parseComment('terraform state mv a b -project=staging,production');
+      }).toThrow('terraform state mv requires exactly one -project');
+      expect(() => {
+        parseComment('terraform state rm aws_instance.old -project=app-*');
+      }).toThrow('terraform state rm requires exactly one -project');
+      expect(() => {
+        parseComment('terraform state rm aws_instance.old -project=staging -dir=envs');
+      }).toThrow('terraform state rm requires exactly one -project');
+    });
+
+    it('should parse the import address and ID in terraform order', () => {
+      const result = parseComment(
+        'terraform import -project=staging -var-file=staging.tfvars aws_s3_bucket.b my-bucket'
+      );
+
+      expect(result).toEqual({
+        command: 'import',
+        projects: ['staging'],
+        args: ['-var-file=staging.tfvars'],
+        importAddress: 'aws_s3_bucket.b',
+        importId: 'my-bucket',
+      });
+    });
+
+    it('should keep quoted import IDs together', () => {
+      const result = parseComment(
+        'terraform import module.db.aws_db_instance.this "db instance" -project=staging'
+      );
+
+      expect(result?.importAddress).toBe('module.db.aws_db_instance.this');
+      expect(result?.importId).toBe('db instance');
+    });
+
+    it('should keep the quoted keys of import addresses', () => {
+      expect(
+        parseComment('terraform import aws_instance.web["a b"] i-0123 -project=staging')
+      ).toEqual(
+        expect.objectContaining({ importAddress: 'aws_instance.web["a b"]', importId: 'i-0123' })
+      );
+      expect(
+        parseComment(`terraform import 'module.app["eu"].aws_instance.web[0]' i-0123 -project=app`)
+      ).toEqual(expect.objectContaining({ importAddress: 'module.app["eu"].aws_instance.web[0]' }));
+    });
+
+    it('should reject import addresses that are not managed resources', () => {
+      expect(() => {
+        parseComment('terraform import aws_instance i-0123 -project=staging');
+      }).toThrow('Invalid import address: aws_instance. Usage: terraform import ADDRESS ID');
+      expect(() => {
+        parseComment('terraform import data.aws_ami.ubuntu ami-0123 -project=staging');
+      }).toThrow('Invalid import address: data.aws_ami.ubuntu.');
+      expect(() => {
+        parseComment('terraform import aws_instance.web[a] i-0123 -project=staging');
+      }).toThrow(
+        'Invalid import address: aws_instance.web[a] (string keys need double quotes, e.g. ["a"]).'
+      );
+    });
+
+    it('should keep quotes inside arguments other than import addresses', () => {
+      const result = parseComment('terraform plan -target=aws_instance.web["a"] -var="x=1 2"');
+
+      expect(result?.args).toEqual(['-target=aws_instance.web["a"]', '-var=x=1 2']);
+    });
+
+    it('should explain usage when the import address or ID is missing', () => {
+      expect(() => {
+        parseComment('terraform import -project=staging');
+      }).toThrow(
+        'terraform import is missing the resource address and ID. Usage: terraform import ADDRESS ID -project=<name>'
+      );
+      expect(() => {
+        parseComment('terraform import aws_s3_bucket.b -project=staging');
+      }).toThrow('terraform import is missing the resource ID.');
+    });
+
+    it('should reject extra import arguments and multiple projects', () => {
+      expect(() => {
+        parseComment('terraform import a b c -project=staging');
+      }).toThrow('terraform import takes exactly two arguments, got: a b c.');
+      expect(() => {
+        parseComment('terraform import aws_s3_bucket.b my-bucket');
+      }).toThrow('terraform import requires exactly one -project');
+    });
+  });
+
+  describe('parseComments', () => {
+    it('should parse a single command like parseComment', () => {
+      expect(parseComments('terraform plan -project=production')).toEqual([
+        parseComment('terraform plan -project=production'),
+      ]);
+    });
+
+    it('should parse every command line in order, ignoring prose and blank lines', () => {
+      const body = [
+        'Planning both projects:',
+        '',
+        'terraform plan -project=network',
+        '  terraform plan -project=app -target=module.web  ',
+        'thanks!',
+        '',
+      ].join('\r\n');
+
+      expect(parseComments(body)).toEqual([
+        { command: 'plan', projects: ['network'], args: [] },
+        { command: 'plan', projects: ['app'], args: ['-target=module.web'] },
+      ]);
+    });
+
+    it('should return nothing for a comment without commands', () => {
+      expect(parseComments('LGTM\nPlease run terraform later')).toEqual([]);
+    });
+
+    it('should reject the comment if any command line is invalid', () => {
+      expect(() =>
+        parseComments('terraform plan -project=a\nterraform init -backend=false')
+      ).toThrow('Unsupported flag for terraform init: -backend=false');
+    });
+  });
+
+  describe('parseComment destroy', () => {
+    it('should parse destroy with named projects and drop -confirm', () => {
+      expect(
+        parseComment('terraform destroy -project=staging,qa -confirm -target=aws_s3_bucket.b')
+      ).toEqual({
+        command: 'destroy',
+        projects: ['staging', 'qa'],
+        args: ['-target=aws_s3_bucket.b'],
+      });
+    });
+
+    it('should require -confirm', () => {
+      expect(() => {
+        parseComment('terraform destroy -project=staging');
+      }).toThrow(
+        'terraform destroy requires -confirm to show it is meant. Usage: terraform destroy -project=<names> -confirm'
+      );
+    });
+
+    it('should require every project to be named', () => {
+      for (const comment of [
+        'terraform destroy -confirm',
+        'terraform destroy --all -confirm',
+        'terraform destroy -project=app-* -confirm',
+        'terraform destroy -dir=envs -confirm',
+        'terraform destroy -tag=networking -confirm',
+        'terraform destroy -project=staging -w=prod -confirm',
+      ]) {
+        expect(() => parseComment(comment)).toThrow(
+          'terraform destroy requires every project to be named with -project'
+        );
+      }
+    });
+  });
+
+  describe('parseComment show', () => {
+    it('should parse show with -json', () => {
+      expect(parseComment('terraform show -json -project=production')).toEqual({
+        command: 'show',
+        projects: ['production'],
+        args: ['-json'],
+      });
+    });
+
+    it('should reject plan files and other flags', () => {
+      expect(() => parseComment('terraform show tfplan-production')).toThrow(
+        'Unsupported arguments for terraform show: tfplan-production. Only -json is allowed'
+      );
+      expect(() => parseComment('terraform show -refresh=false')).toThrow(
+        '-refresh and -lock-timeout are not supported for terraform show'
+      );
+    });
+  });
+
+  describe('parseComment approve_policies', () => {
+    it('should parse approve_policies with projects', () => {
+      expect(parseComment('terraform approve_policies -project=production')).toEqual({
+        command: 'approve_policies',
+        projects: ['production'],
+        args: [],
+      });
+    });
+
+    it('should reject terraform arguments', () => {
+      expect(() => parseComment('terraform approve_policies -refresh=false -target=a')).toThrow(
+        'Unsupported arguments for terraform approve_policies: -refresh=false -target=a'
+      );
+    });
+  });
+
+  describe('parseDispatchInputs', () => {
+    it('should return null without a command input', () => {
+      expect(parseDispatchInputs(undefined)).toBeNull();
+      expect(parseDispatchInputs({ command: ' ', project: 'production' })).toBeNull();
+    });
+
+    it('should parse command, project and args inputs', () => {
+      const result = parseDispatchInputs({
+        command: 'apply',
+        project: 'production,staging',
+        args: '-target=aws_instance.web -lock-timeout=5m',
+      });
+
+      expect(result).toEqual({
+        command: 'apply',
+        projects: ['production', 'staging'],
+        args: ['-target=aws_instance.web'],
+        lockTimeout: '5m',
+      });
+    });
+
+    it('should parse state subcommands', () => {
+      const result = parseDispatchInputs({ command: 'state list', project: 'production' });
+
+      expect(result).toEqual({
+        command: 'state',
+        projects: ['production'],
+        args: [],
+        stateSubcommand: 'list',
+      });
+    });
+
+    it('should validate inputs like a comment', () => {
+      expect(() => parseDispatchInputs({ command: 'init', args: '-backend=false' })).toThrow(
+        'Unsupported flag for terraform init: -backend=false'
+      );
+    });
+
+    it('should reject unknown commands and multi-line inputs', () => {
+      expect(() => parseDispatchInputs({ command: 'console' })).toThrow(
+        'Invalid command input: console. Must be one of: plan, apply, destroy, init, drift, state, import, show, approve_policies'
+      );
+      expect(() =>
+        parseDispatchInputs({ command: 'plan', args: '-target=a\nterraform apply' })
+      ).toThrow('Input args must be a single line');
+    });
   });
 
   describe('validateProjectNames', () => {
@@ -295,4 +801,48 @@ describe('comment-parser', () => {
       expect(result).toEqual(['staging', 'production']);
     });
   });
+
+  describe('custom comment syntax', () => {
+    const syntax = { prefixes: ['tf', 'tg'], projectFlags: ['-p', '-d'] };
+
+    it('should accept a custom prefix and project flag', () => {
+      expect(parseComment('tf plan -p=staging,production', syntax)).toEqual({
+        command: 'plan',
+        projects: ['staging', 'production'],
+        args: [],
+      });
+      expect(parseComment('tg apply -d=staging -lock-timeout=5m', syntax)).toEqual({
+        command: 'apply',
+        projects: ['staging'],
+        args: [],
+        lockTimeout: '5m',
+      });
+    });
+
+    it('should only accept the configured prefixes and flags', () => {
+      expect(parseComment('terraform plan', syntax)).toBeNull();
+      expect(parseComment('tf plan -project=staging', syntax)?.args).toEqual([
+        '-project=staging',
+      ]);
+    });
+
+    it('should not treat prefixes as patterns', () => {
+      expect(parseComment('tXf plan', { prefixes: ['t.f'], projectFlags: ['-p'] })).toBeNull();
+    });
+
+    it('should find every command of a multi-line comment', () => {
+      expect(parseComments('tf plan -p=a\nterraform plan\ntg plan -p=b', syntax)).toEqual([
+        { command: 'plan', projects: ['a'], args: [] },
+        { command: 'plan', projects: ['b'], args: [] },
+      ]);
+    });
+
+    it('should fall back to the default syntax', () => {
+      expect(getCommentSyntax({ projects: [] })).toEqual(DEFAULT_COMMENT_SYNTAX);
+      expect(getCommentSyntax({ projects: [], command_prefixes: ['tf'] })).toEqual({
+        prefixes: ['tf'],
+        projectFlags: ['-project'],
+      });
+    });
+  });
 });
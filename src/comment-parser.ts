@@ -2,19 +2,162 @@
  * PR comment parsing logic
  */
 
-import type { ParsedComment, TerraformCommand } from './types';
+import { isProjectPattern, isValidDuration, WORKSPACE_PATTERN } from './config';
+import { suggestClosest } from './suggestions';
+import type { CommentCommand, Config, ParsedComment, StateSubcommand } from './types';
 
 /**
- * Regular expression to match terraform commands in comments
- * Matches: terraform plan|apply [optional arguments]
+ * Commands accepted after the prefix
  */
-const TERRAFORM_COMMAND_REGEX = /^terraform\s+(plan|apply)(?:\s+(.+))?$/;
+export const COMMENT_COMMANDS: CommentCommand[] = [
+  'plan',
+  'apply',
+  'destroy',
+  'init',
+  'drift',
+  'state',
+  'import',
+  'show',
+  'approve_policies',
+];
+
+/**
+ * Commands accepted after the prefix, as a regular expression alternation
+ */
+const COMMANDS_PATTERN = COMMENT_COMMANDS.join('|');
+
+/**
+ * Error for a comment line that addresses the action but has no known command
+ *
+ * @remarks
+ * Thrown for a bare prefix (`terraform`) and for a likely typo (`terraform paln`),
+ * so the author can be told how to write the command instead of getting no reply.
+ */
+export class UnknownCommandError extends Error {
+  /**
+   * @param prefix - Prefix the line starts with (e.g., terraform)
+   * @param subcommand - Word given as the command, or undefined when it is missing
+   * @param suggestion - Known command the word most likely meant
+   */
+  constructor(
+    readonly prefix: string,
+    readonly subcommand?: string,
+    readonly suggestion?: CommentCommand
+  ) {
+    super(
+      subcommand === undefined
+        ? `${prefix} is missing a command (${COMMENT_COMMANDS.join(', ')})`
+        : `Unknown command: ${prefix} ${subcommand}` +
+            (suggestion ? ` (did you mean ${prefix} ${suggestion}?)` : '')
+    );
+    this.name = 'UnknownCommandError';
+  }
+}
+
+/**
+ * How commands are written in comments
+ */
+export interface CommentSyntax {
+  /** Words that start a command (e.g., terraform, tf) */
+  prefixes: string[];
+  /** Flags that select projects, written as <flag>=<names> (e.g., -project, -p) */
+  projectFlags: string[];
+}
+
+/**
+ * Flags that select projects by directory, written as <flag>=<dirs>
+ *
+ * @remarks
+ * A configured project flag takes precedence, so `project_flags: [-d]` keeps -d for names.
+ */
+export const DIR_FLAGS = ['-dir', '-d'];
+
+/**
+ * Comment syntax used unless the configuration overrides it
+ */
+export const DEFAULT_COMMENT_SYNTAX: CommentSyntax = {
+  prefixes: ['terraform'],
+  projectFlags: ['-project'],
+};
+
+/**
+ * Resolves the comment syntax from the configuration
+ *
+ * @param config - Loaded configuration
+ * @returns Configured prefixes and project flags, each falling back to the default
+ */
+export function getCommentSyntax(config: Config): CommentSyntax {
+  return {
+    prefixes: config.command_prefixes ?? DEFAULT_COMMENT_SYNTAX.prefixes,
+    projectFlags: config.project_flags ?? DEFAULT_COMMENT_SYNTAX.projectFlags,
+  };
+}
+
+/**
+ * Builds the regular expression matching a command line
+ * Matches: <prefix> plan|apply|destroy|init|drift|state|import|show|approve_policies [arguments]
+ */
+function buildCommandRegex(prefixes: string[]): RegExp {
+  const alternation = prefixes.map((p) => p.replace(/[.*+?^${}()|[\]\\]/g, '\\$&')).join('|');
+  return new RegExp(`^(?:${alternation})\\s+(${COMMANDS_PATTERN})(?:\\s+(.+))?$`);
+}
+
+/**
+ * Flags accepted by `terraform init` from a comment
+ *
+ * @remarks
+ * init is run against backends and provider registries, so anything outside
+ * this list is rejected rather than passed through.
+ */
+export const ALLOWED_INIT_FLAGS = ['-upgrade', '-reconfigure', '-migrate-state', '-force-copy'];
+
+/**
+ * Subcommands accepted by `terraform state` from a comment
+ */
+export const STATE_SUBCOMMANDS: StateSubcommand[] = ['list', 'show', 'rm', 'mv'];
+
+/**
+ * Usage shown when the import command is missing its positional arguments
+ */
+export const IMPORT_USAGE = 'terraform import ADDRESS ID -project=<name>';
+
+/**
+ * Matches the address of a managed resource, with optional module path and instance keys,
+ * e.g. aws_instance.web, aws_instance.web[0] or module.app["eu"].aws_instance.web["a"]
+ */
+const RESOURCE_ADDRESS_PATTERN =
+  /^(?:module\.[A-Za-z_][\w-]*(?:\[(?:\d+|"[^"]*")\])?\.)*[A-Za-z_][\w-]*\.[A-Za-z_][\w-]*(?:\[(?:\d+|"[^"]*")\])?$/;
+
+/**
+ * Flag a destroy command must carry to show it is meant
+ */
+export const DESTROY_CONFIRM_FLAG = '-confirm';
+
+/**
+ * Flag that makes a plan run again instead of reusing the plan saved for the head commit
+ */
+export const FORCE_PLAN_FLAG = '--force';
+
+/**
+ * Usage shown when the destroy command is missing its projects or confirmation
+ */
+export const DESTROY_USAGE = `terraform destroy -project=<names> ${DESTROY_CONFIRM_FLAG}`;
+
+/**
+ * Whether a state subcommand modifies state
+ */
+export function isStateMutation(subcommand: StateSubcommand): boolean {
+  return subcommand === 'rm' || subcommand === 'mv';
+}
 
 /**
  * Parses a PR comment to extract terraform command, target projects, and additional arguments
  *
  * @param commentBody - The body of the comment to parse
+ * @param syntax - Accepted prefixes and project flags (default: terraform and -project)
  * @returns Parsed comment or null if comment doesn't contain a terraform command
+ * @throws UnknownCommandError if the comment starts with a prefix but has no known command
+ * @throws Error if the arguments are invalid
  *
  * @example
  * parseComment('terraform plan')
@@ -33,73 +176,582 @@ const TERRAFORM_COMMAND_REGEX = /^terraform\s+(plan|apply)(?:\s+(.+))?$/;
  * // => { command: 'plan', projects: [], args: ['-target=aws_instance.example', '-var-file=prod.tfvars'] }
  *
  * @example
+ * parseComment('terraform plan --all')
+ * // => { command: 'plan', projects: [], args: [], all: true }
+ *
+ * @example
+ * parseComment('terraform plan -project=app-*,network')
+ * // => { command: 'plan', projects: ['app-*', 'network'], args: [] }
+ *
+ * @example
+ * parseComment('terraform plan -d=envs/*')
+ * // => { command: 'plan', projects: [], args: [], dirs: ['envs/*'] }
+ *
+ * @example
+ * parseComment('terraform plan -tag=networking')
+ * // => { command: 'plan', projects: [], args: [], tags: ['networking'] }
+ *
+ * @example
+ * parseComment('terraform plan -w=prod')
+ * // => { command: 'plan', projects: [], args: [], workspaces: ['prod'] }
+ *
+ * @example
+ * parseComment('terraform plan -project=staging --force')
+ * // => { command: 'plan', projects: ['staging'], args: [], force: true }
+ *
+ * @example
+ * parseComment('terraform destroy -project=staging -confirm')
+ * // => { command: 'destroy', projects: ['staging'], args: [] }
+ *
+ * @example
+ * parseComment('terraform init -upgrade -project=staging')
+ * // => { command: 'init', projects: ['staging'], args: ['-upgrade'] }
+ *
+ * @example
+ * parseComment('terraform drift')
+ * // => { command: 'drift', projects: [], args: [] }
+ *
+ * @example
+ * parseComment('terraform state rm aws_instance.old -project=staging')
+ * // => { command: 'state', projects: ['staging'], args: ['aws_instance.old'], stateSubcommand: 'rm' }
+ *
+ * @example
+ * parseComment('terraform import aws_s3_bucket.b my-bucket -project=staging')
+ * // => { command: 'import', projects: ['staging'], args: [], importAddress: 'aws_s3_bucket.b', importId: 'my-bucket' }
+ *
+ * @example
+ * parseComment('terraform show -json -project=staging')
+ * // => { command: 'show', projects: ['staging'], args: ['-json'] }
+ *
+ * @example
+ * parseComment('terraform approve_policies -project=staging')
+ * // => { command: 'approve_policies', projects: ['staging'], args: [] }
+ *
+ * @example
+ * parseComment('tf plan -p=staging', { prefixes: ['tf'], projectFlags: ['-p'] })
+ * // => { command: 'plan', projects: ['staging'], args: [] }
+ *
+ * @example
  * parseComment('Just a regular comment')
  * // => null
+ *
+ * @example
+ * parseComment('terraform paln -project=staging')
+ * // => throws UnknownCommandError (did you mean terraform plan?)
  */
-export function parseComment(commentBody: string): ParsedComment | null {
+export function parseComment(
+  commentBody: string,
+  syntax: CommentSyntax = DEFAULT_COMMENT_SYNTAX
+): ParsedComment | null {
   // Trim whitespace
   const trimmed = commentBody.trim();
 
   // Match against regex
-  const match = trimmed.match(TERRAFORM_COMMAND_REGEX);
+  const match = trimmed.match(buildCommandRegex(syntax.prefixes));
 
   if (!match) {
+    const unknown = findUnknownCommand(trimmed, syntax.prefixes);
+    if (unknown) {
+      throw unknown;
+    }
     return null;
   }
 
-  const command = match[1] as TerraformCommand;
+  const command = match[1] as CommentCommand;
   const argsString = match[2];
 
   // Parse arguments
-  const { projects, args } = parseArguments(argsString || '');
+  const parsedArgs = parseArguments(argsString || '', syntax.projectFlags);
+  const { projects, dirs, tags, workspaces, all, refresh, lockTimeout } = parsedArgs;
+  let { args } = parsedArgs;
+  let stateSubcommand: StateSubcommand | undefined;
+  let importTarget: { address: string; id: string; args: string[] } | undefined;
 
-  return {
+  if (all && projects.length > 0) {
+    throw new Error('--all cannot be combined with -project');
+  }
+  if (all && tags.length > 0) {
+    throw new Error('--all cannot be combined with -tag');
+  }
+  if (all && dirs.length > 0) {
+    throw new Error('--all cannot be combined with -dir');
+  }
+
+  const force = args.includes(FORCE_PLAN_FLAG);
+  if (force) {
+    if (command !== 'plan') {
+      throw new Error(`${FORCE_PLAN_FLAG} is only supported for terraform plan`);
+    }
+    args = args.filter((arg) => arg !== FORCE_PLAN_FLAG);
+  }
+
+  if (command === 'init') {
+    validateInitArguments(args, refresh, lockTimeout);
+  } else if (command === 'drift') {
+    validateDriftArguments(args, refresh);
+  } else if (command === 'state') {
+    const state = parseStateArguments(args, projects, dirs, refresh, lockTimeout);
+    stateSubcommand = state.subcommand;
+    args = state.args;
+  } else if (command === 'import') {
+    importTarget = parseImportArguments(args, projects, dirs, refresh);
+    args = importTarget.args;
+  } else if (command === 'destroy') {
+    args = validateDestroyArguments(args, projects, dirs, tags, workspaces);
+  } else if (command === 'show') {
+    validateShowArguments(args, refresh, lockTimeout);
+  } else if (command === 'approve_policies') {
+    validateApprovePoliciesArguments(args, refresh, lockTimeout);
+  }
+
+  const parsed: ParsedComment = {
     command,
     projects,
     args,
   };
+
+  if (all) {
+    parsed.all = true;
+  }
+  if (dirs.length > 0) {
+    parsed.dirs = dirs;
+  }
+  if (tags.length > 0) {
+    parsed.tags = tags;
+  }
+  if (workspaces.length > 0) {
+    parsed.workspaces = workspaces;
+  }
+  if (refresh !== undefined) {
+    parsed.refresh = refresh;
+  }
+  if (lockTimeout !== undefined) {
+    parsed.lockTimeout = lockTimeout;
+  }
+  if (stateSubcommand !== undefined) {
+    parsed.stateSubcommand = stateSubcommand;
+  }
+  if (importTarget !== undefined) {
+    parsed.importAddress = importTarget.address;
+    parsed.importId = importTarget.id;
+  }
+  if (command === 'plan' && args.includes('-destroy')) {
+    parsed.destroy = true;
+  }
+  if (force) {
+    parsed.force = true;
+  }
+
+  return parsed;
+}
+
+/**
+ * Detects a line that is meant as a command but has a missing or unknown command
+ *
+ * @param line - Trimmed comment line
+ * @param prefixes - Words that start a command
+ * @returns Error describing the line, or null when the line is not addressed to the action
+ *
+ * @remarks
+ * A line counts as addressed to the action when it is the prefix alone, starts with the
+ * prefix and a flag, or has a command word that is close to a known command or is only
+ * followed by flags. Prose such as "terraform is great" is left alone.
+ *
+ * @example
+ * findUnknownCommand('terraform paln', ['terraform'])
+ * // => UnknownCommandError { prefix: 'terraform', subcommand: 'paln', suggestion: 'plan' }
+ *
+ * @example
+ * findUnknownCommand('terraform is great', ['terraform'])
+ * // => null
+ */
+function findUnknownCommand(line: string, prefixes: string[]): UnknownCommandError | null {
+  const [prefix, word, ...rest] = line.split(/\s+/);
+  if (!prefixes.includes(prefix)) {
+    return null;
+  }
+  if (word === undefined || word.startsWith('-')) {
+    return new UnknownCommandError(prefix);
+  }
+  if (!/^[a-z][a-z-]*$/i.test(word)) {
+    return null;
+  }
+
+  const suggestion = suggestClosest(word, COMMENT_COMMANDS);
+  if (suggestion || rest.every((token) => token.startsWith('-'))) {
+    return new UnknownCommandError(prefix, word, suggestion);
+  }
+  return null;
 }
 
 /**
  * Parses argument string to extract projects and other terraform arguments
  *
  * @param argsString - String containing space-separated arguments
- * @returns Object with projects array and args array
+ * @param projectFlags - Flags that select projects (e.g., -project)
+ * @returns Object with projects array, dirs array, tags array, args array and the --all selector
  *
  * @example
  * parseArguments('-project=production,staging -target=aws_instance.example')
- * // => { projects: ['production', 'staging'], args: ['-target=aws_instance.example'] }
+ * // => { projects: ['production', 'staging'], dirs: [], tags: [],
+ * //      args: ['-target=aws_instance.example'], all: false }
+ *
+ * @example
+ * parseArguments('-tag=networking -var-file=prod.tfvars')
+ * // => { projects: [], dirs: [], tags: ['networking'], workspaces: [],
+ * //      args: ['-var-file=prod.tfvars'], all: false }
  *
  * @example
- * parseArguments('-target=aws_instance.example -var-file=prod.tfvars')
- * // => { projects: [], args: ['-target=aws_instance.example', '-var-file=prod.tfvars'] }
+ * parseArguments('-project=app-prod,app-dev -w=prod')
+ * // => { projects: ['app-prod', 'app-dev'], dirs: [], tags: [], workspaces: ['prod'], args: [],
+ * //      all: false }
  */
-function parseArguments(argsString: string): { projects: string[]; args: string[] } {
+function parseArguments(
+  argsString: string,
+  projectFlags: string[]
+): {
+  projects: string[];
+  dirs: string[];
+  tags: string[];
+  workspaces: string[];
+  args: string[];
+  all: boolean;
+  refresh?: boolean;
+  lockTimeout?: string;
+} {
   if (!argsString) {
-    return { projects: [], args: [] };
+    return { projects: [], dirs: [], tags: [], workspaces: [], args: [], all: false };
   }
 
-  const tokens = tokenizeArguments(argsString);
+  const tokens = joinVariableFlags(tokenizeArguments(argsString));
   const projects: string[] = [];
+  const dirs: string[] = [];
+  const tags: string[] = [];
+  const workspaces: string[] = [];
   const args: string[] = [];
+  let all = false;
+  let refresh: boolean | undefined;
+  let lockTimeout: string | undefined;
 
   for (const token of tokens) {
-    // Check for -project=value format
-    if (token.startsWith('-project=')) {
-      const projectList = token.substring('-project='.length);
-      projects.push(
-        ...projectList
-          .split(',')
-          .map((p) => p.trim())
-          .filter((p) => p.length > 0)
-      );
+    if (token === '--all') {
+      // Explicitly select every configured project
+      all = true;
+    } else if (token.startsWith('-refresh=')) {
+      const value = token.substring('-refresh='.length);
+      if (value !== 'true' && value !== 'false') {
+        throw new Error(`Invalid -refresh value: ${value}. Must be true or false`);
+      }
+      refresh = value === 'true';
+    } else if (token.startsWith('-lock-timeout=')) {
+      const value = token.substring('-lock-timeout='.length);
+      if (!isValidDuration(value)) {
+        throw new Error(
+          `Invalid -lock-timeout value: ${value}. Must be a duration such as 30s or 5m`
+        );
+      }
+      lockTimeout = value;
+    } else if (projectFlags.some((flag) => token.startsWith(`${flag}=`))) {
+      // -project=value format
+      projects.push(...splitList(token.substring(token.indexOf('=') + 1)));
+    } else if (DIR_FLAGS.some((flag) => token.startsWith(`${flag}=`))) {
+      dirs.push(...splitList(token.substring(token.indexOf('=') + 1)));
+    } else if (token.startsWith('-tag=')) {
+      tags.push(...splitList(token.substring('-tag='.length)));
+    } else if (token.startsWith('-w=') || token.startsWith('-workspace=')) {
+      for (const workspace of splitList(token.substring(token.indexOf('=') + 1))) {
+        if (!WORKSPACE_PATTERN.test(workspace)) {
+          throw new Error(`Invalid workspace name: ${workspace}`);
+        }
+        workspaces.push(workspace);
+      }
     } else {
       // It's a regular terraform argument
       args.push(token);
     }
   }
 
-  return { projects, args };
+  return { projects, dirs, tags, workspaces, args, all, refresh, lockTimeout };
+}
+
+/**
+ * Flags that take a variable or variable file, and may be separated from their value
+ */
+const VARIABLE_FLAGS = ['-var', '-var-file'];
+
+/**
+ * Joins `-var NAME=VALUE` and `-var-file FILE` into single `-var=NAME=VALUE` tokens
+ *
+ * @remarks
+ * Terraform accepts both forms; joining them keeps the value from being taken for
+ * a positional argument (e.g. the import address).
+ */
+function joinVariableFlags(tokens: string[]): string[] {
+  const joined: string[] = [];
+  for (let i = 0; i < tokens.length; i++) {
+    if (VARIABLE_FLAGS.includes(tokens[i])) {
+      if (i + 1 >= tokens.length || tokens[i + 1].startsWith('-')) {
+        throw new Error(`${tokens[i]} requires a value`);
+      }
+      joined.push(`${tokens[i]}=${tokens[i + 1]}`);
+      i++;
+    } else {
+      joined.push(tokens[i]);
+    }
+  }
+  return joined;
+}
+
+/**
+ * Splits a comma-separated flag value, dropping empty entries
+ */
+function splitList(value: string): string[] {
+  return value
+    .split(',')
+    .map((v) => v.trim())
+    .filter((v) => v.length > 0);
+}
+
+/**
+ * Validates flags given to `terraform init` against the allowlist
+ *
+ * @param args - Remaining arguments after project selection
+ * @param refresh - Parsed -refresh value, if any
+ * @param lockTimeout - Parsed -lock-timeout value, if any
+ * @throws Error if a flag is not allowed or flags conflict
+ */
+function validateInitArguments(
+  args: string[],
+  refresh: boolean | undefined,
+  lockTimeout: string | undefined
+): void {
+  if (refresh !== undefined || lockTimeout !== undefined) {
+    throw new Error('-refresh and -lock-timeout are not supported for terraform init');
+  }
+
+  for (const arg of args) {
+    if (!ALLOWED_INIT_FLAGS.includes(arg)) {
+      throw new Error(
+        `Unsupported flag for terraform init: ${arg}. Allowed flags: ${ALLOWED_INIT_FLAGS.join(', ')}`
+      );
+    }
+  }
+
+  if (args.includes('-reconfigure') && args.includes('-migrate-state')) {
+    throw new Error('-reconfigure cannot be combined with -migrate-state');
+  }
+}
+
+/**
+ * Validates arguments given to the drift command
+ *
+ * @param args - Remaining arguments after project selection
+ * @param refresh - Parsed -refresh value, if any
+ * @throws Error if terraform arguments or -refresh are given
+ *
+ * @remarks
+ * Drift is checked against the full configuration with a refresh, so only
+ * project selection and -lock-timeout are accepted.
+ */
+function validateDriftArguments(args: string[], refresh: boolean | undefined): void {
+  if (refresh !== undefined) {
+    throw new Error('-refresh is not supported for terraform drift');
+  }
+  if (args.length > 0) {
+    throw new Error(`Unsupported arguments for terraform drift: ${args.join(' ')}`);
+  }
+}
+
+/**
+ * Validates the arguments of the destroy command
+ *
+ * @param args - Remaining arguments after project selection
+ * @param projects - Selected projects
+ * @param dirs - Selected directories
+ * @param tags - Selected tags
+ * @param workspaces - Selected workspaces
+ * @returns The arguments passed on to terraform destroy, without the confirmation
+ * @throws Error with usage without -confirm, or if the projects are not named one by one
+ *
+ * @remarks
+ * A destroy only runs against projects named outright, so a pattern, directory,
+ * tag or workspace can never pull in a project by accident.
+ */
+function validateDestroyArguments(
+  args: string[],
+  projects: string[],
+  dirs: string[],
+  tags: string[],
+  workspaces: string[]
+): string[] {
+  if (!args.includes(DESTROY_CONFIRM_FLAG)) {
+    throw new Error(
+      `terraform destroy requires ${DESTROY_CONFIRM_FLAG} to show it is meant. Usage: ${DESTROY_USAGE}`
+    );
+  }
+  if (
+    projects.length === 0 ||
+    projects.some(isProjectPattern) ||
+    dirs.length > 0 ||
+    tags.length > 0 ||
+    workspaces.length > 0
+  ) {
+    throw new Error(
+      `terraform destroy requires every project to be named with -project. Usage: ${DESTROY_USAGE}`
+    );
+  }
+  return args.filter((arg) => arg !== DESTROY_CONFIRM_FLAG);
+}
+
+/**
+ * Validates arguments given to the show command
+ *
+ * @param args - Remaining arguments after project selection
+ * @param refresh - Parsed -refresh value, if any
+ * @param lockTimeout - Parsed -lock-timeout value, if any
+ * @throws Error for anything other than -json
+ *
+ * @remarks
+ * show renders the saved plan of each project, so the plan file is never taken
+ * from the comment.
+ */
+function validateShowArguments(
+  args: string[],
+  refresh: boolean | undefined,
+  lockTimeout: string | undefined
+): void {
+  if (refresh !== undefined || lockTimeout !== undefined) {
+    throw new Error('-refresh and -lock-timeout are not supported for terraform show');
+  }
+
+  const unsupported = args.filter((arg) => arg !== '-json');
+  if (unsupported.length > 0) {
+    throw new Error(
+      `Unsupported arguments for terraform show: ${unsupported.join(' ')}. Only -json is allowed`
+    );
+  }
+}
+
+/**
+ * Validates arguments given to the approve_policies command
+ *
+ * @param args - Remaining arguments after project selection
+ * @param refresh - Parsed -refresh value, if any
+ * @param lockTimeout - Parsed -lock-timeout value, if any
+ * @throws Error for anything other than project selection
+ */
+function validateApprovePoliciesArguments(
+  args: string[],
+  refresh: boolean | undefined,
+  lockTimeout: string | undefined
+): void {
+  if (refresh !== undefined || lockTimeout !== undefined || args.length > 0) {
+    const given = [
+      ...(refresh !== undefined ? [`-refresh=${refresh}`] : []),
+      ...(lockTimeout !== undefined ? [`-lock-timeout=${lockTimeout}`] : []),
+      ...args,
+    ];
+    throw new Error(`Unsupported arguments for terraform approve_policies: ${given.join(' ')}`);
+  }
+}
+
+/**
+ * Validates the arguments of the state command
+ *
+ * @param args - Remaining arguments after project selection (subcommand first)
+ * @param projects - Selected projects
+ * @param dirs - Selected directories
+ * @param refresh - Parsed -refresh value, if any
+ * @param lockTimeout - Parsed -lock-timeout value, if any
+ * @returns The subcommand and its arguments
+ * @throws Error for unknown subcommands, or state mutations not targeting exactly one project
+ */
+function parseStateArguments(
+  args: string[],
+  projects: string[],
+  dirs: string[],
+  refresh: boolean | undefined,
+  lockTimeout: string | undefined
+): { subcommand: StateSubcommand; args: string[] } {
+  if (refresh !== undefined || lockTimeout !== undefined) {
+    throw new Error('-refresh and -lock-timeout are not supported for terraform state');
+  }
+
+  const [subcommand, ...rest] = args;
+  if (!subcommand) {
+    throw new Error(`terraform state requires a subcommand: ${STATE_SUBCOMMANDS.join(', ')}`);
+  }
+  if (!STATE_SUBCOMMANDS.includes(subcommand as StateSubcommand)) {
+    throw new Error(
+      `Unknown state subcommand: ${subcommand}. Must be one of: ${STATE_SUBCOMMANDS.join(', ')}`
+    );
+  }
+
+  const stateSubcommand = subcommand as StateSubcommand;
+  if (isStateMutation(stateSubcommand) && !isSingleProject(projects, dirs)) {
+    throw new Error(`terraform state ${stateSubcommand} requires exactly one -project`);
+  }
+
+  return { subcommand: stateSubcommand, args: rest };
+}
+
+/**
+ * Whether the selection names exactly one project, without wildcards or directories
+ */
+function isSingleProject(projects: string[], dirs: string[]): boolean {
+  return projects.length === 1 && !isProjectPattern(projects[0]) && dirs.length === 0;
+}
+
+/**
+ * Separates the address and ID of the import command from its flags
+ *
+ * @param args - Remaining arguments after project selection
+ * @param projects - Selected projects
+ * @param dirs - Selected directories
+ * @param refresh - Parsed -refresh value, if any
+ * @returns The resource address, the resource ID and the remaining flags
+ * @throws Error with usage if the address or ID is missing, or without exactly one project
+ * @throws Error if the address is not the address of a managed resource
+ *
+ * @remarks
+ * Positional arguments may appear anywhere in the comment; they are rendered
+ * after the flags, in the ADDRESS ID order terraform expects.
+ */
+function parseImportArguments(
+  args: string[],
+  projects: string[],
+  dirs: string[],
+  refresh: boolean | undefined
+): { address: string; id: string; args: string[] } {
+  if (refresh !== undefined) {
+    throw new Error('-refresh is not supported for terraform import');
+  }
+
+  const positional = args.filter((arg) => !arg.startsWith('-'));
+  const flags = args.filter((arg) => arg.startsWith('-'));
+
+  if (positional.length < 2) {
+    const missing = positional.length === 0 ? 'resource address and ID' : 'resource ID';
+    throw new Error(`terraform import is missing the ${missing}. Usage: ${IMPORT_USAGE}`);
+  }
+  if (positional.length > 2) {
+    throw new Error(
+      `terraform import takes exactly two arguments, got: ${positional.join(' ')}. Usage: ${IMPORT_USAGE}`
+    );
+  }
+  if (!isSingleProject(projects, dirs)) {
+    throw new Error('terraform import requires exactly one -project');
+  }
+
+  const [address, id] = positional;
+  if (!RESOURCE_ADDRESS_PATTERN.test(address)) {
+    // A string key written without its double quotes is the usual mistake
+    const hint = /\[[^\d"]/.test(address) ? ' (string keys need double quotes, e.g. ["a"])' : '';
+    throw new Error(
+      `Invalid import address: ${address}${hint}. Usage: ${IMPORT_USAGE}, with an ADDRESS such as aws_instance.web or module.app.aws_instance.web["a"]`
+    );
+  }
+  return { address, id, args: flags };
 }
 
 /**
@@ -107,10 +759,21 @@ function parseArguments(argsString: string): { projects: string[]; args: string[
  *
  * @param argsString - String containing space-separated arguments
  * @returns Array of individual tokens
+ * @throws Error if a quote is not closed
+ *
+ * @remarks
+ * Arguments are passed to terraform directly, never through a shell, so quotes
+ * only group words and nothing in them is expanded. A quote only opens at the start
+ * of an argument or after `=`; elsewhere it is kept, so that instance keys such as
+ * `aws_instance.web["a"]` need no further quoting.
  *
  * @example
  * tokenizeArguments('-target=aws_instance.example -var="foo=bar"')
  * // => ['-target=aws_instance.example', '-var=foo=bar']
+ *
+ * @example
+ * tokenizeArguments(`aws_instance.web["a b"] 'module.app["eu"].aws_instance.web'`)
+ * // => ['aws_instance.web["a b"]', 'module.app["eu"].aws_instance.web']
  */
 function tokenizeArguments(argsString: string): string[] {
   const tokens: string[] = [];
@@ -118,16 +781,24 @@ function tokenizeArguments(argsString: string): string[] {
   let inQuotes = false;
   let quoteChar = '';
 
+  // Quotes inside an argument, e.g. around an instance key, are part of it
+  let literalQuote = '';
+
   for (let i = 0; i < argsString.length; i++) {
     const char = argsString[i];
+    const opensQuote = current.length === 0 || current.endsWith('=');
 
-    if ((char === '"' || char === "'") && !inQuotes) {
+    if ((char === '"' || char === "'") && !inQuotes && !literalQuote && opensQuote) {
       inQuotes = true;
       quoteChar = char;
     } else if (char === quoteChar && inQuotes) {
       inQuotes = false;
       quoteChar = '';
-    } else if (char === ' ' && !inQuotes) {
+    } else if ((char === '"' || char === "'") && !inQuotes) {
+      // The quote is kept, and so is the text up to its closing quote, spaces included
+      literalQuote = literalQuote === char ? '' : literalQuote || char;
+      current += char;
+    } else if (char === ' ' && !inQuotes && !literalQuote) {
       if (current.length > 0) {
         tokens.push(current);
         current = '';
@@ -137,6 +808,9 @@ function tokenizeArguments(argsString: string): string[] {
     }
   }
 
+  if (inQuotes || literalQuote) {
+    throw new Error(`Unterminated ${quoteChar || literalQuote} quote in arguments`);
+  }
   if (current.length > 0) {
     tokens.push(current);
   }
@@ -144,6 +818,92 @@ function tokenizeArguments(argsString: string): string[] {
   return tokens;
 }
 
+/**
+ * Parses every terraform command in a PR comment, one per line
+ *
+ * @param commentBody - The body of the comment to parse
+ * @param syntax - Accepted prefixes and project flags (default: terraform and -project)
+ * @returns Parsed commands in comment order (empty if there are none)
+ * @throws UnknownCommandError if a line starts with a prefix but has no known command
+ * @throws Error if a command line is invalid
+ *
+ * @remarks
+ * Lines that are not terraform commands (prose, blank lines) are ignored, so
+ * a single-line comment parses exactly as with {@link parseComment}.
+ *
+ * @example
+ * parseComments('Planning both:\nterraform plan -project=a\n\nterraform plan -project=b')
+ * // => [{ command: 'plan', projects: ['a'], args: [] }, { command: 'plan', projects: ['b'], args: [] }]
+ */
+export function parseComments(
+  commentBody: string,
+  syntax: CommentSyntax = DEFAULT_COMMENT_SYNTAX
+): ParsedComment[] {
+  const commands: ParsedComment[] = [];
+
+  for (const line of commentBody.split(/\r?\n/)) {
+    const parsed = parseComment(line, syntax);
+    if (parsed) {
+      commands.push(parsed);
+    }
+  }
+
+  return commands;
+}
+
+/**
+ * Parses the inputs of a manual (workflow_dispatch) run into a command
+ *
+ * @param inputs - `inputs` from the workflow_dispatch event payload
+ * @returns Parsed command, or null if no `command` input was given
+ * @throws Error if the inputs do not form a valid command
+ *
+ * @remarks
+ * The inputs are `command` (e.g. plan, apply, state list), `project`
+ * (comma-separated names, empty for all projects) and `args` (extra flags).
+ * They are validated exactly like a comment `terraform <command> <args> -project=<project>`.
+ *
+ * @example
+ * parseDispatchInputs({ command: 'apply', project: 'production', args: '-lock-timeout=5m' })
+ * // => { command: 'apply', projects: ['production'], args: [], lockTimeout: '5m' }
+ */
+export function parseDispatchInputs(
+  inputs: Record<string, unknown> | undefined
+): ParsedComment | null {
+  const command = readDispatchInput(inputs, 'command');
+  if (command === '') {
+    return null;
+  }
+
+  const project = readDispatchInput(inputs, 'project');
+  const args = readDispatchInput(inputs, 'args');
+  const parts = ['terraform', command, args, project ? `-project=${project}` : ''];
+
+  const parsed = parseComment(parts.filter((part) => part !== '').join(' '));
+  if (!parsed) {
+    throw new Error(
+      `Invalid command input: ${command}. Must be one of: ${COMMENT_COMMANDS.join(', ')}`
+    );
+  }
+  return parsed;
+}
+
+/**
+ * Reads a single-line string input from a workflow_dispatch payload
+ *
+ * @throws Error if the input is not a string or spans several lines
+ */
+function readDispatchInput(inputs: Record<string, unknown> | undefined, name: string): string {
+  const value = inputs?.[name] ?? '';
+  if (typeof value !== 'string') {
+    throw new Error(`Input ${name} must be a string`);
+  }
+  if (/[\r\n]/.test(value)) {
+    throw new Error(`Input ${name} must be a single line`);
+  }
+  return value.trim();
+}
+
 /**
  * Validates that the specified projects exist in configuration
  *
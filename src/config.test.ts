@@ -5,7 +5,31 @@
 import * as fs from 'node:fs';
 import * as path from 'node:path';
 import * as yaml from 'js-yaml';
-import { loadConfig, getDefaultRequirements } from './config';
+import {
+  ConfigValidationError,
+  filterEnabledProjects,
+  filterProjectsByWorkspace,
+  findProjectsByDirs,
+  findProjectsByPatterns,
+  findProjectsByTags,
+  getCommandTimeout,
+  getDefaultConfig,
+  getDefaultRequirements,
+  getRetryPolicy,
+  isValidDuration,
+  loadConfig,
+  loadConfigFromRepository,
+  loadConfigWithCentral,
+  matchesBranchFilters,
+  parseConfigRepo,
+  parseDuration,
+  resolveEnvReferences,
+  resolveProjectDir,
+  shouldAutoplan,
+  toRepositoryPath,
+  validateConfigFile,
+  whenModifiedPatternToRegExp,
+} from './config';
 
 // Mock fs and yaml modules
 jest.mock('node:fs');
@@ -269,6 +293,24 @@ describe('config', () => {
       }).toThrow('Project production: autoplan.when_modified must contain only strings');
     });
 
+    it('should throw error for an empty when_modified pattern', () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            autoplan: { enabled: true, when_modified: ['**/*.tf', '!'] },
+          },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: autoplan.when_modified must not contain empty patterns');
+    });
+
     it('should throw error for invalid plan_requirements', () => {
       mockFs.existsSync.mockReturnValue(true);
       mockFs.readFileSync.mockReturnValue('yaml content');
@@ -287,6 +329,28 @@ describe('config', () => {
       }).toThrow('Invalid requirement in Project production: plan_requirements');
     });
 
+    it('should accept requirement expressions', () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            apply_requirements: ['mergeable', '!diverged', 'approved|label:fast-track'],
+          },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].apply_requirements).toEqual([
+        'mergeable',
+        '!diverged',
+        'approved|label:fast-track',
+      ]);
+    });
+
     it('should throw error when requirements is not an array', () => {
       mockFs.existsSync.mockReturnValue(true);
       mockFs.readFileSync.mockReturnValue('yaml content');
@@ -322,6 +386,2902 @@ describe('config', () => {
         loadConfig('/path/to/config.yaml');
       }).toThrow('Invalid requirement in Project production: apply_requirements');
     });
+
+    it('should load state_requirements', () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'staging', dir: 'terraform/staging', state_requirements: ['label:state'] },
+        ],
+      });
+
+      expect(loadConfig('/path/to/config.yaml').projects[0].state_requirements).toEqual([
+        'label:state',
+      ]);
+    });
+
+    it('should load import_requirements', () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'staging', dir: 'terraform/staging', import_requirements: ['approved'] },
+        ],
+      });
+
+      expect(loadConfig('/path/to/config.yaml').projects[0].import_requirements).toEqual([
+        'approved',
+      ]);
+    });
+
+    it('should load and validate destroy_requirements', () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'staging', dir: 'terraform/staging', destroy_requirements: ['approved'] },
+          { name: 'production', dir: 'terraform/prod', destroy_requirements: 'approved' },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: destroy_requirements must be an array');
+
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'staging', dir: 'terraform/staging', destroy_requirements: ['approved'] },
+        ],
+      });
+      expect(loadConfig('/path/to/config.yaml').projects[0].destroy_requirements).toEqual([
+        'approved',
+      ]);
+    });
+  });
+
+  describe('loadConfig error reporting', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should report every problem at once', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'production', dir: '', plan_requirements: ['typo'] },
+          { name: 'staging', dir: 'terraform/staging', terragrunt: 'yes' },
+          { dir: 'terraform/dev', apply_requirements: 'approved' },
+        ],
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect(error).toBeInstanceOf(ConfigValidationError);
+      expect((error as ConfigValidationError).errors).toEqual([
+        "Project production must have a non-empty 'dir' field",
+        "Invalid requirement in Project production: plan_requirements: typo. Unknown requirement 'typo'. Must be one of: mergeable, approved, codeowner_approved, no_destroys, planned, diverged, label:<name>",
+        'Project staging: terragrunt must be a boolean',
+        "Project at index 2 must have a non-empty 'name' field",
+        'Project at index 2: apply_requirements must be an array',
+      ]);
+      expect((error as Error).message).toContain('Invalid configuration:');
+    });
+
+    it('should report duplicate names alongside other problems', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'production', dir: 'a' },
+          { name: 'production', dir: 'b', autoplan: 'invalid' },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Invalid configuration:\n  - Project production: autoplan must be an object\n  - Duplicate project name: production'
+      );
+    });
+
+    it('should reject unknown fields with the field they most likely meant', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            aply_requirements: ['approved'],
+            autoplan: { enabled: true, when_modifed: ['*.tf'] },
+            color: 'blue',
+          },
+        ],
+        paralel_plan: true,
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'Unknown top-level field paralel_plan (did you mean parallel_plan?)',
+        'Project production: unknown field aply_requirements (did you mean apply_requirements?)',
+        'Project production: unknown field color',
+        'Project production: unknown field autoplan.when_modifed (did you mean autoplan.when_modified?)',
+        'Project production: autoplan.when_modified must be an array',
+      ]);
+    });
+
+    it('should explain a misspelled projects field', () => {
+      mockYaml.load.mockReturnValue({
+        project: [{ name: 'production', dir: 'terraform/prod' }],
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'Unknown top-level field project (did you mean projects?)',
+        'Configuration must have a "projects" array',
+      ]);
+    });
+  });
+
+  describe('validateConfigFile', () => {
+    const fetchFile = jest.fn();
+
+    beforeEach(() => {
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should find no problems in a valid configuration', async () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockYaml.load.mockReturnValue({ projects: [{ name: 'production', dir: 'terraform/prod' }] });
+
+      await expect(validateConfigFile('/path/to/config.yaml', fetchFile)).resolves.toEqual([]);
+    });
+
+    it('should list every validation problem', async () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'production', dir: '' },
+          { name: 'staging', dir: 'terraform/staging', refresh: 'no' },
+        ],
+      });
+
+      await expect(validateConfigFile('/path/to/config.yaml', fetchFile)).resolves.toEqual([
+        "Project production must have a non-empty 'dir' field",
+        'Project staging: refresh must be a boolean',
+      ]);
+    });
+
+    it('should report a missing file as a problem', async () => {
+      mockFs.existsSync.mockReturnValue(false);
+
+      await expect(validateConfigFile('/path/to/config.yaml', fetchFile)).resolves.toEqual([
+        'Configuration file not found: /path/to/config.yaml',
+      ]);
+    });
+
+    it('should check the configuration merged over the central one', async () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockYaml.load.mockImplementation((content: string) =>
+        content === 'central content'
+          ? { enforce: ['require_plan'], projects: [] }
+          : {
+              config_repo: 'acme/infra-config@main',
+              projects: [{ name: 'app', dir: 'terraform/app', require_plan: false }],
+            }
+      );
+      fetchFile.mockResolvedValue('central content');
+
+      await expect(validateConfigFile('/path/to/config.yaml', fetchFile)).resolves.toEqual([
+        'Project app: require_plan is enforced by the central configuration acme/infra-config@main and cannot be overridden',
+      ]);
+      expect(fetchFile).toHaveBeenCalledWith(
+        { owner: 'acme', repo: 'infra-config', path: '.terraform-action.yaml', ref: 'main' },
+        '.terraform-action.yaml'
+      );
+    });
+  });
+
+  describe('loadConfig plan_timeout and apply_timeout', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should give projects without their own timeouts the top-level ones', () => {
+      mockYaml.load.mockReturnValue({
+        plan_timeout: '30m',
+        apply_timeout: '2h',
+        projects: [
+          { name: 'production', dir: 'terraform/prod', apply_timeout: '4h' },
+          { name: 'staging', dir: 'terraform/staging' },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.plan_timeout).toBe('30m');
+      expect(config.projects[0]).toEqual(
+        expect.objectContaining({ plan_timeout: '30m', apply_timeout: '4h' })
+      );
+      expect(config.projects[1]).toEqual(
+        expect.objectContaining({ plan_timeout: '30m', apply_timeout: '2h' })
+      );
+    });
+
+    it('should leave projects without a limit by default', () => {
+      mockYaml.load.mockReturnValue({ projects: [{ name: 'production', dir: 'terraform/prod' }] });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].plan_timeout).toBeUndefined();
+      expect(config.projects[0].apply_timeout).toBeUndefined();
+    });
+
+    it('should reject timeouts that are not durations of at least 1s', () => {
+      mockYaml.load.mockReturnValue({
+        apply_timeout: 3600,
+        projects: [{ name: 'production', dir: 'terraform/prod', plan_timeout: '0s' }],
+      });
+
+      expect(() => loadConfig('/path/to/config.yaml')).toThrow(
+        'Project production: plan_timeout must be a duration of at least 1s such as 30m or 1h (got 0s)'
+      );
+      expect(() => loadConfig('/path/to/config.yaml')).toThrow(
+        'apply_timeout must be a duration of at least 1s such as 30m or 1h (got 3600)'
+      );
+    });
+  });
+
+  describe('loadConfig require_plan', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should give projects without their own require_plan the top-level one', () => {
+      mockYaml.load.mockReturnValue({
+        require_plan: true,
+        projects: [
+          { name: 'production', dir: 'terraform/prod' },
+          { name: 'sandbox', dir: 'terraform/sandbox', require_plan: false },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.require_plan).toBe(true);
+      expect(config.projects[0].require_plan).toBe(true);
+      expect(config.projects[1].require_plan).toBe(false);
+    });
+
+    it('should reject require_plan for terragrunt_run_all projects', () => {
+      mockYaml.load.mockReturnValue({
+        require_plan: true,
+        projects: [
+          { name: 'network', dir: 'live', terragrunt: true, terragrunt_run_all: true },
+          {
+            name: 'app',
+            dir: 'terraform/app',
+            terragrunt: true,
+            terragrunt_run_all: true,
+            require_plan: true,
+          },
+        ],
+      });
+
+      expect(() => loadConfig('/path/to/config.yaml')).toThrow(
+        'Project network: require_plan is not supported with terragrunt_run_all (set require_plan: false)'
+      );
+      expect(() => loadConfig('/path/to/config.yaml')).toThrow(
+        'Project app: require_plan is not supported with terragrunt_run_all'
+      );
+    });
+  });
+
+  describe('getCommandTimeout', () => {
+    it('should resolve a timeout to milliseconds', () => {
+      expect(getCommandTimeout('1h30m')).toEqual({ duration: '1h30m', ms: 5_400_000 });
+      expect(getCommandTimeout(undefined)).toBeUndefined();
+    });
+  });
+
+  describe('loadConfig refresh and lock_timeout', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load refresh and lock_timeout', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'production', dir: 'terraform/prod', refresh: false, lock_timeout: '1h30m' },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].refresh).toBe(false);
+      expect(config.projects[0].lock_timeout).toBe('1h30m');
+    });
+
+    it('should reject an invalid lock_timeout', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', lock_timeout: '5 minutes' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: lock_timeout must be a duration such as 30s, 5m or 1h');
+    });
+
+    it('should load auto_unlock_on_failure', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', auto_unlock_on_failure: true }],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].auto_unlock_on_failure).toBe(true);
+    });
+
+    it('should reject auto_unlock_on_failure with terragrunt_run_all', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            terragrunt: true,
+            terragrunt_run_all: true,
+            auto_unlock_on_failure: true,
+          },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Project production: auto_unlock_on_failure is not supported with terragrunt_run_all'
+      );
+    });
+
+    it('should reject apply_on_merge with terragrunt_run_all', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            terragrunt: true,
+            terragrunt_run_all: true,
+            apply_on_merge: true,
+          },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: apply_on_merge is not supported with terragrunt_run_all');
+    });
+  });
+
+  describe('loadConfig env', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should merge the top-level env into every project', () => {
+      mockYaml.load.mockReturnValue({
+        env: { AWS_REGION: 'us-east-1', TF_IN_AUTOMATION: true },
+        projects: [
+          { name: 'staging', dir: 'envs/staging' },
+          {
+            name: 'production',
+            dir: 'envs/production',
+            env: { AWS_REGION: 'eu-west-1', AWS_PROFILE: '${{ PROD_PROFILE }}' },
+          },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.env).toEqual({ AWS_REGION: 'us-east-1', TF_IN_AUTOMATION: 'true' });
+      expect(config.projects[0].env).toEqual({ AWS_REGION: 'us-east-1', TF_IN_AUTOMATION: 'true' });
+      expect(config.projects[1].env).toEqual({
+        AWS_REGION: 'eu-west-1',
+        TF_IN_AUTOMATION: 'true',
+        AWS_PROFILE: '${{ PROD_PROFILE }}',
+      });
+    });
+
+    it('should reject invalid names and references', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'staging', dir: 'envs/staging', env: { 'AWS-REGION': 'us-east-1' } },
+          { name: 'production', dir: 'envs/production', env: { TOKEN: '${{ secrets.TOKEN }}' } },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project staging: env has an invalid variable name: AWS-REGION');
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: env.TOKEN has an invalid reference: ${{ secrets.TOKEN }}');
+    });
+  });
+
+  describe('resolveEnvReferences', () => {
+    it('should replace references with runner environment values', () => {
+      expect(
+        resolveEnvReferences(
+          { AWS_PROFILE: '${{ PROD_PROFILE }}', ROLE: 'arn:aws:iam::${{PROD_ACCOUNT}}:role/ci' },
+          { PROD_PROFILE: 'prod', PROD_ACCOUNT: '123456789012' }
+        )
+      ).toEqual({ AWS_PROFILE: 'prod', ROLE: 'arn:aws:iam::123456789012:role/ci' });
+    });
+
+    it('should reject references to unset variables', () => {
+      expect(() => resolveEnvReferences({ TOKEN: '${{ MISSING_TOKEN }}' }, {})).toThrow(
+        'env references variables that are not set on the runner: MISSING_TOKEN'
+      );
+    });
+  });
+
+  describe('loadConfig backend config', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load backend settings and files', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'envs/production',
+            backend_config: { bucket: 'state-prod', 'assume_role.role_arn': 'arn', encrypt: true },
+            backend_config_files: ['backend.hcl'],
+          },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].backend_config).toEqual({
+        bucket: 'state-prod',
+        'assume_role.role_arn': 'arn',
+        encrypt: 'true',
+      });
+      expect(config.projects[0].backend_config_files).toEqual(['backend.hcl']);
+    });
+
+    it('should reject backend config when the backend is skipped', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'module',
+            dir: 'modules/vpc',
+            init_backend: false,
+            backend_config: { bucket: 'state' },
+          },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project module: backend_config cannot be used with init_backend: false');
+    });
+  });
+
+  describe('loadConfig variables', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load var files and vars, converting values to strings', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            terraform_var_files: ['prod.tfvars', '../common.tfvars'],
+            terraform_vars: { region: 'us-east-1', replicas: 3, enabled: true },
+          },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].terraform_var_files).toEqual(['prod.tfvars', '../common.tfvars']);
+      expect(config.projects[0].terraform_vars).toEqual({
+        region: 'us-east-1',
+        replicas: '3',
+        enabled: 'true',
+      });
+    });
+
+    it('should reject var files outside the repository', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'production', dir: 'prod', terraform_var_files: ['../../secrets.tfvars'] },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Project production: terraform_var_files must stay inside the repository (got ../../secrets.tfvars)'
+      );
+    });
+
+    it('should reject invalid variable names and values', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'prod',
+            terraform_vars: { 'bad name': 'x', tags: { team: 'platform' } },
+          },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: terraform_vars has an invalid variable name: bad name');
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: terraform_vars.tags must be a string, number or boolean');
+    });
+  });
+
+  describe('isValidDuration', () => {
+    it.each(['30s', '5m', '1h30m', '1.5h', '300ms'])('should accept %s', (value) => {
+      expect(isValidDuration(value)).toBe(true);
+    });
+
+    it.each(['', '5', 'five', '-5m', '5 m', '5d'])('should reject %s', (value) => {
+      expect(isValidDuration(value)).toBe(false);
+    });
+  });
+
+  describe('parseDuration', () => {
+    it.each([
+      ['30s', 30_000],
+      ['1m30s', 90_000],
+      ['1.5h', 5_400_000],
+      ['300ms', 300],
+    ])('should convert %s', (value, ms) => {
+      expect(parseDuration(value)).toBe(ms);
+    });
+  });
+
+  describe('loadConfig retry', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load retry and resolve its defaults', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        retry: { max_retries: 3, patterns: ['Throttling'] },
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.retry).toEqual({ max_retries: 3, patterns: ['Throttling'] });
+      expect(getRetryPolicy(config.retry ?? {})).toEqual({
+        maxRetries: 3,
+        backoffMs: 10_000,
+        patterns: [/Throttling/],
+      });
+    });
+
+    it('should retry common network errors by default', () => {
+      const policy = getRetryPolicy({});
+
+      expect(policy.maxRetries).toBe(2);
+      expect(policy.patterns.some((p) => p.test('dial tcp 10.0.0.1:443: i/o timeout'))).toBe(true);
+      expect(policy.patterns.some((p) => p.test('Error: Error acquiring the state lock'))).toBe(true);
+      expect(policy.patterns.some((p) => p.test('Error: Unsupported argument'))).toBe(false);
+    });
+
+    it('should report every invalid retry setting', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        retry: { max_retries: 0, backoff: 'soon', patterns: ['RequestError', '('] },
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'retry.max_retries must be an integer from 1 to 10 (got 0)',
+        'retry.backoff must be a duration such as 10s or 1m',
+        'retry.patterns entry is not a valid regular expression: (',
+      ]);
+    });
+  });
+
+  describe('loadConfig concurrency', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load concurrency and concurrency groups', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod', concurrency_group: 'shared-state' }],
+        concurrency: { commands: ['plan', 'apply'], timeout: '1h' },
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.concurrency).toEqual({ commands: ['plan', 'apply'], timeout: '1h' });
+      expect(config.projects[0].concurrency_group).toBe('shared-state');
+    });
+
+    it('should report every invalid concurrency setting', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod', concurrency_group: '' }],
+        concurrency: { commands: ['plan', 'show'], timeout: 'soon' },
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'Project production: concurrency_group must be a non-empty string',
+        'concurrency.commands must be a non-empty list of: plan, apply, destroy, import, state',
+        'concurrency.timeout must be a duration of at least 1s such as 30m or 1h (got soon)',
+      ]);
+    });
+
+    it('should reject concurrency groups without concurrency', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod', concurrency_group: 'shared-state' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Project production: concurrency_group has no effect without the top-level concurrency setting'
+      );
+    });
+  });
+
+  describe('loadConfig redaction', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load redaction', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        redaction: { patterns: ['internal\\.example\\.com'], sensitive_values: true },
+      });
+
+      expect(loadConfig('/path/to/config.yaml').redaction).toEqual({
+        patterns: ['internal\\.example\\.com'],
+        sensitive_values: true,
+      });
+    });
+
+    it('should report every invalid redaction setting', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        redaction: { patterns: ['('], sensitive_values: 'yes', mask_outputs: true },
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'Unknown field redaction.mask_outputs',
+        'redaction.patterns entry is not a valid regular expression: (',
+        'redaction.sensitive_values must be a boolean',
+      ]);
+    });
+  });
+
+  describe('loadConfig notifications', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load notifications settings', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        notifications: { webhook_url_env: 'SLACK_WEBHOOK_URL', format: 'slack' },
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.notifications).toEqual({
+        webhook_url_env: 'SLACK_WEBHOOK_URL',
+        format: 'slack',
+      });
+    });
+
+    it('should require a webhook URL source', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        notifications: { format: 'json' },
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('notifications must set webhook_url or webhook_url_env');
+    });
+
+    it('should reject unknown formats', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        notifications: { webhook_url: 'https://hooks.example.com', format: 'xml' },
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Invalid notifications.format: xml. Must be one of: slack, json');
+    });
+  });
+
+  describe('loadConfig output_mode', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it.each(['comment', 'status', 'both'])('should accept output_mode %s', (mode) => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        output_mode: mode,
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.output_mode).toBe(mode);
+    });
+
+    it('should leave output_mode unset by default', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.output_mode).toBeUndefined();
+    });
+
+    it('should reject unknown output modes', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        output_mode: 'silent',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Invalid output_mode: silent. Must be one of: comment, status, both');
+    });
+  });
+
+  describe('loadConfig status_api', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it.each(['statuses', 'checks'])('should accept status_api %s', (api) => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        status_api: api,
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.status_api).toBe(api);
+    });
+
+    it('should reject unknown status APIs', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        status_api: 'deployments',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Invalid status_api: deployments. Must be one of: statuses, checks');
+    });
+  });
+
+  describe('loadConfig comment_on_no_changes', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it.each(['full', 'concise', 'skip'])('should accept comment_on_no_changes %s', (mode) => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        comment_on_no_changes: mode,
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.comment_on_no_changes).toBe(mode);
+    });
+
+    it('should reject unknown values', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        comment_on_no_changes: false,
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Invalid comment_on_no_changes: false. Must be one of: full, concise, skip');
+    });
+  });
+
+  describe('loadConfig comment_mode', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it.each(['per_project', 'consolidated'])('should accept comment_mode %s', (mode) => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        comment_mode: mode,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').comment_mode).toBe(mode);
+    });
+
+    it('should reject unknown comment modes', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        comment_mode: 'single',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Invalid comment_mode: single. Must be one of: per_project, consolidated');
+    });
+  });
+
+  describe('loadConfig previous_plan_comments', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it.each(['keep', 'update', 'hide'])('should accept previous_plan_comments %s', (mode) => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        previous_plan_comments: mode,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').previous_plan_comments).toBe(mode);
+    });
+
+    it('should reject unknown values', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod' }],
+        previous_plan_comments: 'delete',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Invalid previous_plan_comments: delete. Must be one of: keep, update, hide');
+    });
+  });
+
+  describe('loadConfig base_dir', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should accept base_dir', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        base_dir: 'terraform',
+      });
+
+      expect(loadConfig('/path/to/config.yaml').base_dir).toBe('terraform');
+    });
+
+    it('should reject an empty base_dir', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        base_dir: '',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('base_dir must be a non-empty string');
+    });
+  });
+
+  describe('loadConfig max_projects_per_run', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should default to unlimited', () => {
+      mockYaml.load.mockReturnValue({ projects: [{ name: 'production', dir: 'prod' }] });
+
+      expect(loadConfig('/path/to/config.yaml').max_projects_per_run).toBeUndefined();
+    });
+
+    it('should accept a positive integer', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        max_projects_per_run: 10,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').max_projects_per_run).toBe(10);
+    });
+
+    it.each([0, -1, 1.5, 'ten'])('should reject %p', (value) => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        max_projects_per_run: value,
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(`max_projects_per_run must be a positive integer (got ${value})`);
+    });
+  });
+
+  describe('loadConfig parallel execution', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load the parallel settings and execution order groups', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod', execution_order_group: 2 }],
+        parallel_plan: true,
+        parallel_apply: false,
+        parallel_pool_size: 8,
+        abort_on_execution_order_fail: true,
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.parallel_plan).toBe(true);
+      expect(config.parallel_apply).toBe(false);
+      expect(config.parallel_pool_size).toBe(8);
+      expect(config.abort_on_execution_order_fail).toBe(true);
+      expect(config.projects[0].execution_order_group).toBe(2);
+    });
+
+    it('should reject invalid parallel settings', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod', execution_order_group: -1 }],
+        parallel_plan: 'yes',
+        parallel_pool_size: 0,
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('parallel_plan must be a boolean');
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('parallel_pool_size must be a positive integer (got 0)');
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Project production: execution_order_group must be a non-negative integer (got -1)'
+      );
+    });
+
+    it('should load the parallel settings of a project', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'network',
+            dir: 'network',
+            parallel_plan: true,
+            parallel_apply: false,
+            abort_on_execution_order_fail: true,
+          },
+        ],
+      });
+
+      expect(loadConfig('/path/to/config.yaml').projects[0]).toEqual({
+        name: 'network',
+        dir: 'network',
+        parallel_plan: true,
+        parallel_apply: false,
+        abort_on_execution_order_fail: true,
+      });
+    });
+
+    it('should reject invalid parallel settings of a project', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'network', dir: 'network', parallel_apply: 'no' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project network: parallel_apply must be a boolean');
+    });
+  });
+
+  describe('loadConfig depends_on', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load dependencies between projects', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'network', dir: 'network' },
+          { name: 'app', dir: 'app', depends_on: ['network'] },
+        ],
+      });
+
+      expect(loadConfig('/path/to/config.yaml').projects[1].depends_on).toEqual(['network']);
+    });
+
+    it('should reject unknown projects, the project itself and later groups', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'network', dir: 'network', execution_order_group: 1 },
+          { name: 'app', dir: 'app', depends_on: ['network', 'app', 'db'] },
+          { name: 'dns', dir: 'dns', depends_on: 'network' },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        "Project app: depends_on 'network', which runs in a later execution_order_group"
+      );
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project app: depends_on cannot name the project itself');
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow("Project app: depends_on 'db' is not a project");
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project dns: depends_on must be a non-empty list of project names');
+    });
+
+    it('should reject a dependency cycle', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'network', dir: 'network', depends_on: ['app'] },
+          { name: 'db', dir: 'db', depends_on: ['network'] },
+          { name: 'app', dir: 'app', depends_on: ['db'] },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Dependency cycle between projects: network -> app -> db -> network');
+    });
+  });
+
+  describe('loadConfig policies', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load policy sets and the projects checked against them', () => {
+      mockYaml.load.mockReturnValue({
+        policies: {
+          owners: ['alice'],
+          policy_sets: [{ name: 'security', path: 'policies/security' }],
+        },
+        projects: [{ name: 'production', dir: 'prod', policy_sets: ['security'] }],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.policies).toEqual({
+        owners: ['alice'],
+        policy_sets: [{ name: 'security', path: 'policies/security' }],
+      });
+      expect(config.projects[0].policy_sets).toEqual(['security']);
+    });
+
+    it('should report every problem of the policies', () => {
+      mockYaml.load.mockReturnValue({
+        policies: {
+          owners: ['not a login'],
+          policy_sets: [
+            { name: 'security', path: '../policies' },
+            { name: 'security', path: 'policies/cost' },
+            { path: 'policies/tags' },
+          ],
+        },
+        projects: [{ name: 'production', dir: 'prod' }],
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'policies.owners must be a non-empty list of GitHub logins',
+        'policies.policy_sets[0]: path must be a relative path inside the repository',
+        'policies.policy_sets[1]: duplicate policy set name security',
+        'policies.policy_sets[2]: name must be a non-empty string',
+      ]);
+    });
+
+    it('should reject a project referencing an unknown policy set', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'production', dir: 'prod', policy_sets: ['security'] },
+          { name: 'staging', dir: 'staging', policy_sets: [] },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow("Project production: policy set 'security' not found in policies.policy_sets");
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project staging: policy_sets must be a non-empty list of policy set names');
+    });
+  });
+
+  describe('loadConfig security_scan', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load the security scan of a project', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'prod',
+            security_scan: { tool: 'checkov', target: 'plan', block_on: 'HIGH' },
+          },
+        ],
+      });
+
+      expect(loadConfig('/path/to/config.yaml').projects[0].security_scan).toEqual({
+        tool: 'checkov',
+        target: 'plan',
+        block_on: 'HIGH',
+      });
+    });
+
+    it('should report every problem of a security scan', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'prod',
+            security_scan: { tool: 'snyk', target: 'repo', block_on: 'high', skip_checks: [] },
+          },
+          { name: 'staging', dir: 'staging', security_scan: { tool: 'tfsec', target: 'plan' } },
+        ],
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'Project production: unknown field security_scan.skip_checks',
+        'Project production: security_scan.tool must be one of: trivy, tfsec, checkov',
+        'Project production: security_scan.target must be dir or plan',
+        'Project production: security_scan.block_on must be one of: LOW, MEDIUM, HIGH, CRITICAL',
+        'Project staging: tfsec cannot scan plans, use security_scan.target dir',
+      ]);
+    });
+
+    it('should reject scanning the plan of a terragrunt_run_all project', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'prod',
+            terragrunt: true,
+            terragrunt_run_all: true,
+            security_scan: { tool: 'trivy', target: 'plan' },
+          },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Project production: security_scan.target plan is not supported with terragrunt_run_all'
+      );
+    });
+  });
+
+  describe('loadConfig plan_summary', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load plan_summary', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        plan_summary: true,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').plan_summary).toBe(true);
+    });
+
+    it('should reject a non-boolean plan_summary', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        plan_summary: 'yes',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('plan_summary must be a boolean');
+    });
+  });
+
+  describe('loadConfig authorization', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load the rules of restricted commands', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        authorization: {
+          apply: { teams: ['acme/platform'], users: ['alice'] },
+          apply_all: { permission: 'admin' },
+          plan: { permission: 'triage' },
+        },
+      });
+
+      expect(loadConfig('/path/to/config.yaml').authorization).toEqual({
+        apply: { teams: ['acme/platform'], users: ['alice'] },
+        apply_all: { permission: 'admin' },
+        plan: { permission: 'triage' },
+      });
+    });
+
+    it('should report every problem of the rules', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        authorization: {
+          console: {},
+          apply: { users: 'alice', teams: ['@acme/platform'], permission: 'owner' },
+          plan: 'everyone',
+        },
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'authorization: unknown command console (must be one of: plan, apply, destroy, init, drift, state, import, show, approve_policies, apply_all)',
+        'authorization.apply.users must be a list of GitHub logins',
+        'authorization.apply.teams must be a list of teams written as org/team-slug',
+        'Invalid authorization.apply.permission: owner. Must be one of: read, triage, write, maintain, admin',
+        'authorization.plan must be an object',
+      ]);
+    });
+  });
+
+  describe('loadConfig infracost', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load infracost with and without a limit', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        infracost: { max_monthly_increase: 250.5 },
+      });
+      expect(loadConfig('/path/to/config.yaml').infracost).toEqual({ max_monthly_increase: 250.5 });
+
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        infracost: {},
+      });
+      expect(loadConfig('/path/to/config.yaml').infracost).toEqual({});
+    });
+
+    it('should reject an invalid limit', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        infracost: { max_monthly_increase: '100' },
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('infracost.max_monthly_increase must be a non-negative number (got 100)');
+    });
+
+    it('should reject infracost that is not an object', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        infracost: true,
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('infracost must be an object');
+    });
+  });
+
+  describe('loadConfig allow_fork_apply', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load allow_fork_apply', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        allow_fork_apply: true,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').allow_fork_apply).toBe(true);
+    });
+
+    it('should reject a non-boolean allow_fork_apply', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        allow_fork_apply: 'yes',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('allow_fork_apply must be a boolean');
+    });
+  });
+
+  describe('loadConfig compare_plans', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load compare_plans', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        compare_plans: true,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').compare_plans).toBe(true);
+    });
+
+    it('should reject a non-boolean compare_plans', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        compare_plans: 'always',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('compare_plans must be a boolean');
+    });
+  });
+
+  describe('loadConfig invalidate_outdated_plans', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load invalidate_outdated_plans', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        invalidate_outdated_plans: true,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').invalidate_outdated_plans).toBe(true);
+    });
+
+    it('should reject a non-boolean invalidate_outdated_plans', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        invalidate_outdated_plans: 'on push',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('invalidate_outdated_plans must be a boolean');
+    });
+  });
+
+  describe('loadConfig debug', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load debug', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        debug: true,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').debug).toBe(true);
+    });
+
+    it('should reject a non-boolean debug', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        debug: 'yes',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('debug must be a boolean');
+    });
+  });
+
+  describe('loadConfig plan_cache', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load plan_cache', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        plan_cache: false,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').plan_cache).toBe(false);
+    });
+
+    it('should reject a non-boolean plan_cache', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        plan_cache: 'yes',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('plan_cache must be a boolean');
+    });
+  });
+
+  describe('loadConfig plugin_cache', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load plugin_cache', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        plugin_cache: false,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').plugin_cache).toBe(false);
+    });
+
+    it('should reject a non-boolean plugin_cache', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        plugin_cache: 'on',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('plugin_cache must be a boolean');
+    });
+  });
+
+  describe('loadConfig reactions', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load reactions', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        reactions: false,
+      });
+
+      expect(loadConfig('/path/to/config.yaml').reactions).toBe(false);
+    });
+
+    it('should reject non-boolean reactions', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        reactions: 'off',
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('reactions must be a boolean');
+    });
+  });
+
+  describe('loadConfig commit status settings', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load the status context and description', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        status_context_prefix: 'tf',
+        status_context: '{prefix}/{command} ({project})',
+        status_description: '{project}: {description}',
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.status_context_prefix).toBe('tf');
+      expect(config.status_context).toBe('{prefix}/{command} ({project})');
+      expect(config.status_description).toBe('{project}: {description}');
+    });
+
+    it('should reject unknown placeholders and contexts shared by commands', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        status_context: 'tf ({project}) {sha}',
+        status_description: '{summary}',
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'status_context has unknown placeholders: {sha}',
+        'status_context must contain {command} and {project}',
+        'status_description has unknown placeholders: {summary}',
+      ]);
+    });
+
+    it('should reject a context longer than GitHub allows', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        status_context_prefix: 'x'.repeat(250),
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: commit status context is 269 characters');
+    });
+  });
+
+  describe('loadConfig merge_after_apply', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load the merge settings', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        merge_after_apply: { method: 'squash', delete_branch: true },
+      });
+
+      expect(loadConfig('/path/to/config.yaml').merge_after_apply).toEqual({
+        method: 'squash',
+        delete_branch: true,
+      });
+    });
+
+    it('should reject an unknown merge method', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        merge_after_apply: { method: 'fast-forward' },
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Invalid merge_after_apply.method: fast-forward. Must be one of: merge, squash, rebase'
+      );
+    });
+
+    it('should reject merge_after_apply that is not an object', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        merge_after_apply: true,
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('merge_after_apply must be an object');
+    });
+  });
+
+  describe('loadConfig comment syntax', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should accept custom prefixes and project flags', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        command_prefixes: ['tf', 'tg'],
+        project_flags: ['-p', '--dir'],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.command_prefixes).toEqual(['tf', 'tg']);
+      expect(config.project_flags).toEqual(['-p', '--dir']);
+    });
+
+    it('should reject invalid prefixes and flags', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        command_prefixes: ['tf plan'],
+        project_flags: ['p', '-refresh'],
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect(error).toBeInstanceOf(ConfigValidationError);
+      expect((error as ConfigValidationError).errors).toEqual([
+        'Invalid command_prefixes entry: tf plan',
+        'Invalid project_flags entry: p',
+        'Invalid project_flags entry: -refresh is already a comment flag',
+      ]);
+    });
+
+    it('should reject an empty list', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'prod' }],
+        command_prefixes: [],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('command_prefixes must be a non-empty list');
+    });
+  });
+
+  describe('loadConfig with include', () => {
+    const files: Record<string, unknown> = {};
+
+    beforeEach(() => {
+      for (const key of Object.keys(files)) {
+        delete files[key];
+      }
+      mockFs.existsSync.mockImplementation((p) => String(p) in files);
+      mockFs.readFileSync.mockImplementation(((p: string) => p) as any);
+      mockYaml.load.mockImplementation((content: string) => files[content]);
+    });
+
+    it('should append projects from included files', () => {
+      files[path.resolve('/repo/config.yaml')] = {
+        include: ['teams/network.yaml'],
+        projects: [{ name: 'app', dir: 'terraform/app' }],
+      };
+      files[path.resolve('/repo/teams/network.yaml')] = {
+        projects: [{ name: 'network', dir: 'terraform/network' }],
+      };
+
+      const config = loadConfig('/repo/config.yaml');
+
+      expect(config.projects).toEqual([
+        { name: 'network', dir: 'terraform/network' },
+        { name: 'app', dir: 'terraform/app' },
+      ]);
+    });
+
+    it('should merge workflows from included files by name', () => {
+      files[path.resolve('/repo/config.yaml')] = {
+        include: ['workflows.yaml'],
+        workflows: { checked: { plan: { steps: ['plan'] } } },
+        projects: [{ name: 'app', dir: 'terraform/app', workflow: 'shared' }],
+      };
+      files[path.resolve('/repo/workflows.yaml')] = {
+        workflows: {
+          shared: { apply: { steps: ['init', 'apply'] } },
+          checked: { plan: { steps: ['init', 'plan'] } },
+        },
+      };
+
+      const config = loadConfig('/repo/config.yaml');
+
+      expect(config.workflows).toEqual({
+        shared: { apply: { steps: ['init', 'apply'] } },
+        checked: { plan: { steps: ['plan'] } },
+      });
+    });
+
+    it('should allow the root file to contain only includes', () => {
+      files[path.resolve('/repo/config.yaml')] = {
+        include: ['a.yaml', 'b.yaml'],
+      };
+      files[path.resolve('/repo/a.yaml')] = { projects: [{ name: 'a', dir: 'a' }] };
+      files[path.resolve('/repo/b.yaml')] = { projects: [{ name: 'b', dir: 'b' }] };
+
+      const config = loadConfig('/repo/config.yaml');
+
+      expect(config.projects.map((p) => p.name)).toEqual(['a', 'b']);
+    });
+
+    it('should reject duplicate project names across files', () => {
+      files[path.resolve('/repo/config.yaml')] = {
+        include: ['a.yaml'],
+        projects: [{ name: 'shared', dir: 'root' }],
+      };
+      files[path.resolve('/repo/a.yaml')] = { projects: [{ name: 'shared', dir: 'a' }] };
+
+      expect(() => {
+        loadConfig('/repo/config.yaml');
+      }).toThrow(
+        `Duplicate project name: shared (defined in ${path.resolve('/repo/config.yaml')} and ${path.resolve('/repo/a.yaml')})`
+      );
+    });
+
+    it('should merge a file included by two files once', () => {
+      files[path.resolve('/repo/config.yaml')] = { include: ['a.yaml', 'b.yaml'] };
+      files[path.resolve('/repo/a.yaml')] = {
+        include: ['common.yaml'],
+        projects: [{ name: 'a', dir: 'a' }],
+      };
+      files[path.resolve('/repo/b.yaml')] = {
+        include: ['common.yaml'],
+        projects: [{ name: 'b', dir: 'b' }],
+      };
+      files[path.resolve('/repo/common.yaml')] = {
+        projects: [{ name: 'common', dir: 'common' }],
+      };
+
+      const config = loadConfig('/repo/config.yaml');
+
+      expect(config.projects.map((p) => p.name)).toEqual(['common', 'a', 'b']);
+    });
+
+    it('should reject circular includes', () => {
+      files[path.resolve('/repo/config.yaml')] = { include: ['a.yaml'] };
+      files[path.resolve('/repo/a.yaml')] = { include: ['config.yaml'] };
+
+      expect(() => {
+        loadConfig('/repo/config.yaml');
+      }).toThrow('Circular include detected');
+    });
+
+    it('should throw error when an included file does not exist', () => {
+      files[path.resolve('/repo/config.yaml')] = {
+        include: ['missing.yaml'],
+        projects: [{ name: 'app', dir: 'app' }],
+      };
+
+      expect(() => {
+        loadConfig('/repo/config.yaml');
+      }).toThrow(`Configuration file not found: ${path.resolve('/repo/missing.yaml')}`);
+    });
+
+    it('should throw error when include is not an array of paths', () => {
+      files[path.resolve('/repo/config.yaml')] = {
+        include: 'a.yaml',
+        projects: [{ name: 'app', dir: 'app' }],
+      };
+
+      expect(() => {
+        loadConfig('/repo/config.yaml');
+      }).toThrow('include must be an array of file paths');
+    });
+  });
+
+  describe('loadConfigFromRepository', () => {
+    // Repository path to parsed content; the fetched content is the path itself
+    const files: Record<string, unknown> = {};
+    const fetchFile = jest.fn(async (repoPath: string) => (repoPath in files ? repoPath : null));
+
+    beforeEach(() => {
+      for (const key of Object.keys(files)) {
+        delete files[key];
+      }
+      mockYaml.load.mockImplementation((content: string) => files[content]);
+    });
+
+    it('should load the configuration and its includes through the fetcher', async () => {
+      files['.github/terraform.yaml'] = {
+        include: ['teams/network.yaml'],
+        projects: [{ name: 'app', dir: 'terraform/app' }],
+      };
+      files['.github/teams/network.yaml'] = {
+        projects: [{ name: 'network', dir: 'terraform/network' }],
+      };
+
+      const config = await loadConfigFromRepository(
+        '.github/terraform.yaml',
+        fetchFile,
+        'base branch main'
+      );
+
+      expect(config.projects.map((p) => p.name)).toEqual(['network', 'app']);
+      expect(fetchFile).toHaveBeenCalledWith('.github/teams/network.yaml');
+      expect(mockFs.readFileSync).not.toHaveBeenCalled();
+    });
+
+    it('should throw error when a file is missing from the fetched version', async () => {
+      files['config.yaml'] = { include: ['missing.yaml'], projects: [] };
+
+      await expect(
+        loadConfigFromRepository('config.yaml', fetchFile, 'base branch main')
+      ).rejects.toThrow('Configuration file not found on base branch main: missing.yaml');
+    });
+
+    it('should pass fetch errors through', async () => {
+      const failing = jest.fn().mockRejectedValueOnce(new Error('Bad credentials'));
+
+      await expect(
+        loadConfigFromRepository('config.yaml', failing, 'base branch main')
+      ).rejects.toThrow('Bad credentials');
+    });
+  });
+
+  describe('parseConfigRepo', () => {
+    it('should read the repository, file and ref', () => {
+      expect(parseConfigRepo('acme/infra-config@main')).toEqual({
+        owner: 'acme',
+        repo: 'infra-config',
+        path: '.terraform-action.yaml',
+        ref: 'main',
+      });
+      expect(parseConfigRepo('acme/infra-config/teams/data.yaml@v2')).toEqual({
+        owner: 'acme',
+        repo: 'infra-config',
+        path: 'teams/data.yaml',
+        ref: 'v2',
+      });
+      expect(parseConfigRepo('acme/infra-config')?.ref).toBeUndefined();
+    });
+
+    it('should reject values that are not repositories', () => {
+      expect(parseConfigRepo('infra-config')).toBeUndefined();
+      expect(parseConfigRepo('acme/infra-config/../secrets.yaml@main')).toBeUndefined();
+    });
+  });
+
+  describe('loadConfigWithCentral', () => {
+    // Central repository path to parsed content; the fetched content is the path itself
+    const files: Record<string, unknown> = {};
+    const fetchFile = jest.fn(async (_central: unknown, repoPath: string) =>
+      repoPath in files ? repoPath : null
+    );
+
+    beforeEach(() => {
+      for (const key of Object.keys(files)) {
+        delete files[key];
+      }
+      mockYaml.load.mockImplementation((content: string) => files[content]);
+    });
+
+    it('should merge the local configuration over the central one', async () => {
+      files['.terraform-action.yaml'] = {
+        include: ['workflows.yaml'],
+        output_mode: 'comment',
+        projects: [{ name: 'shared', dir: 'terraform/shared' }],
+      };
+      files['workflows.yaml'] = {
+        workflows: { checked: { plan: { steps: ['init', 'plan'] } } },
+      };
+
+      const config = await loadConfigWithCentral(
+        {
+          config_repo: 'acme/infra-config@main',
+          output_mode: 'both',
+          projects: [{ name: 'app', dir: 'terraform/app', workflow: 'checked' }],
+        },
+        undefined,
+        fetchFile
+      );
+
+      expect(fetchFile).toHaveBeenCalledWith(
+        { owner: 'acme', repo: 'infra-config', path: '.terraform-action.yaml', ref: 'main' },
+        '.terraform-action.yaml'
+      );
+      expect(fetchFile).toHaveBeenCalledWith(expect.anything(), 'workflows.yaml');
+      expect(config.projects.map((p) => p.name)).toEqual(['shared', 'app']);
+      expect(config.output_mode).toBe('both');
+      expect(config.workflows?.checked).toBeDefined();
+    });
+
+    it('should use the central configuration alone without a local one', async () => {
+      files['teams/data.yaml'] = { projects: [{ name: 'warehouse', dir: 'terraform' }] };
+
+      const config = await loadConfigWithCentral(
+        undefined,
+        'acme/infra-config/teams/data.yaml@v2',
+        fetchFile
+      );
+
+      expect(config.projects.map((p) => p.name)).toEqual(['warehouse']);
+    });
+
+    it('should validate the local configuration alone without a central one', async () => {
+      const config = await loadConfigWithCentral(
+        { projects: [{ name: 'app', dir: 'terraform/app' }] },
+        undefined,
+        fetchFile
+      );
+
+      expect(config.projects).toHaveLength(1);
+      expect(fetchFile).not.toHaveBeenCalled();
+    });
+
+    it('should reject overrides of enforced fields', async () => {
+      files['.terraform-action.yaml'] = {
+        enforce: ['authorization', 'allow_fork_apply'],
+        authorization: { apply: { teams: ['acme/platform'] } },
+      };
+
+      await expect(
+        loadConfigWithCentral(
+          {
+            authorization: { apply: { users: ['mallory'] } },
+            enforce: [],
+            projects: [{ name: 'app', dir: 'terraform/app' }],
+          },
+          'acme/infra-config@main',
+          fetchFile
+        )
+      ).rejects.toThrow(
+        new ConfigValidationError([
+          'enforce can only be set in a central configuration',
+          'authorization is enforced by the central configuration acme/infra-config@main and cannot be overridden',
+        ])
+      );
+    });
+
+    it('should reject project overrides of enforced fields', async () => {
+      files['.terraform-action.yaml'] = {
+        enforce: ['require_plan', 'parallel_apply'],
+        require_plan: true,
+        projects: [{ name: 'shared', dir: 'terraform/shared', require_plan: true }],
+      };
+
+      await expect(
+        loadConfigWithCentral(
+          {
+            projects: [
+              { name: 'app', dir: 'terraform/app', require_plan: false, parallel_apply: false },
+            ],
+          },
+          'acme/infra-config@main',
+          fetchFile
+        )
+      ).rejects.toThrow(
+        new ConfigValidationError([
+          'Project app: require_plan is enforced by the central configuration acme/infra-config@main and cannot be overridden',
+          'Project app: parallel_apply is enforced by the central configuration acme/infra-config@main and cannot be overridden',
+        ])
+      );
+    });
+
+    it('should reject an unknown field under enforce', async () => {
+      files['.terraform-action.yaml'] = { enforce: ['projects'] };
+
+      await expect(
+        loadConfigWithCentral(
+          { projects: [{ name: 'app', dir: 'terraform/app' }] },
+          'acme/infra-config@main',
+          fetchFile
+        )
+      ).rejects.toThrow('enforce must list top-level fields other than projects, config_repo');
+    });
+
+    it('should report a missing central file', async () => {
+      await expect(
+        loadConfigWithCentral(undefined, 'acme/infra-config@main', fetchFile)
+      ).rejects.toThrow(
+        'Configuration file not found on central configuration acme/infra-config@main: .terraform-action.yaml'
+      );
+    });
+
+    it('should reject an invalid config_repo', async () => {
+      await expect(
+        loadConfigWithCentral(
+          { config_repo: 'infra-config', projects: [{ name: 'app', dir: 'terraform/app' }] },
+          undefined,
+          fetchFile
+        )
+      ).rejects.toThrow('config_repo must be a repository such as acme/infra-config@main');
+    });
+  });
+
+  describe('toRepositoryPath', () => {
+    it('should make paths relative to the repository root', () => {
+      expect(toRepositoryPath('.terraform-action.yaml', '/repo')).toBe('.terraform-action.yaml');
+      expect(toRepositoryPath('/repo/config/terraform.yaml', '/repo')).toBe(
+        'config/terraform.yaml'
+      );
+    });
+
+    it('should reject paths outside the repository', () => {
+      expect(() => toRepositoryPath('../shared.yaml', '/repo')).toThrow(
+        'Configuration file must be inside the repository: ../shared.yaml'
+      );
+    });
+  });
+
+  describe('loadConfig terragrunt settings', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it('should load terragrunt settings', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            terragrunt: true,
+            terragrunt_run_all: true,
+          },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].terragrunt).toBe(true);
+      expect(config.projects[0].terragrunt_run_all).toBe(true);
+    });
+
+    it('should throw error when terragrunt is not a boolean', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', terragrunt: 'yes' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: terragrunt must be a boolean');
+    });
+
+    it('should load terragrunt_run_all without an explicit terragrunt setting', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', terragrunt_run_all: true }],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].terragrunt).toBeUndefined();
+      expect(config.projects[0].terragrunt_run_all).toBe(true);
+    });
+
+    it('should load terragrunt_run_all_apply', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            terragrunt_run_all: true,
+            terragrunt_run_all_apply: true,
+          },
+        ],
+      });
+
+      expect(loadConfig('/path/to/config.yaml').projects[0].terragrunt_run_all_apply).toBe(true);
+    });
+
+    it('should throw error when terragrunt_run_all_apply is set without terragrunt_run_all', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', terragrunt_run_all_apply: true }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Project production: terragrunt_run_all_apply has no effect without terragrunt_run_all'
+      );
+    });
+
+    it('should throw error when terragrunt_run_all is set with terragrunt disabled', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            terragrunt: false,
+            terragrunt_run_all: true,
+          },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: terragrunt_run_all cannot be used with terragrunt: false');
+    });
+
+    it('should load init_upgrade', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', init_upgrade: true }],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].init_upgrade).toBe(true);
+    });
+
+    it('should throw error when init_upgrade is not a boolean', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', init_upgrade: 'always' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: init_upgrade must be a boolean');
+    });
+
+    it('should load init_extra_args', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'production', dir: 'terraform/prod', init_extra_args: ['-lockfile=readonly'] },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].init_extra_args).toEqual(['-lockfile=readonly']);
+    });
+
+    it('should throw error when init_extra_args holds something other than flags', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', init_extra_args: ['upgrade'] }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Project production: init_extra_args must be an array of flags such as -lockfile=readonly'
+      );
+    });
+
+    it('should load terraform_version', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'envs/production', terraform_version: '1.7.0' }],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].terraform_version).toBe('1.7.0');
+    });
+
+    it('should throw error when terraform_version is not an exact version', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'envs/production', terraform_version: '~> 1.7' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        'Project production: terraform_version must be an exact version such as 1.7.0 (got ~> 1.7)'
+      );
+    });
+
+    it('should let projects inherit the top-level binary', () => {
+      mockYaml.load.mockReturnValue({
+        binary: 'tofu',
+        projects: [
+          { name: 'network', dir: 'envs/network' },
+          { name: 'legacy', dir: 'envs/legacy', binary: 'terraform' },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.binary).toBe('tofu');
+      expect(config.projects.map((p) => p.binary)).toEqual(['tofu', 'terraform']);
+    });
+
+    it('should throw error for an unknown binary', () => {
+      mockYaml.load.mockReturnValue({
+        binary: 'opentofu',
+        projects: [{ name: 'network', dir: 'envs/network', binary: 'terragrunt' }],
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'Project network: binary must be one of: terraform, tofu (got terragrunt)',
+        'Invalid binary: opentofu. Must be one of: terraform, tofu',
+      ]);
+    });
+
+    it('should load comment templates', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'network', dir: 'envs/network' }],
+        comment_templates: { header: '## {{.Vars.target}}', footer: 'Owned by #infra' },
+      });
+
+      expect(loadConfig('/path/to/config.yaml').comment_templates).toEqual({
+        header: '## {{.Vars.target}}',
+        footer: 'Owned by #infra',
+      });
+    });
+
+    it('should report invalid and unknown comment templates', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'network', dir: 'envs/network' }],
+        comment_templates: { headr: '## Infra', plan: '' },
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'Unknown field comment_templates.headr (did you mean comment_templates.header?)',
+        'comment_templates.plan must be a non-empty string',
+      ]);
+    });
+
+    it('should load an exact terragrunt_version and reject other versions', () => {
+      mockYaml.load.mockReturnValue({
+        terragrunt_version: '0.55.1',
+        projects: [{ name: 'network', dir: 'envs/network', terragrunt: true }],
+      });
+
+      expect(loadConfig('/path/to/config.yaml').terragrunt_version).toBe('0.55.1');
+
+      mockYaml.load.mockReturnValue({
+        terragrunt_version: 'latest',
+        projects: [{ name: 'network', dir: 'envs/network', terragrunt: true }],
+      });
+
+      expect(() => loadConfig('/path/to/config.yaml')).toThrow(
+        'terragrunt_version must be an exact version such as 0.55.1 (got latest)'
+      );
+    });
+
+    it('should load init_backend', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'modules', dir: 'terraform/modules', init_backend: false }],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].init_backend).toBe(false);
+    });
+
+    it('should throw error when init_backend is not a boolean', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'modules', dir: 'terraform/modules', init_backend: 'no' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project modules: init_backend must be a boolean');
+    });
+
+    it('should load workspace', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'network-prod', dir: 'envs/network', workspace: 'prod' }],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].workspace).toBe('prod');
+    });
+
+    it('should throw error for an invalid workspace', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'network', dir: 'envs/network', workspace: 'prod env' },
+          {
+            name: 'stack',
+            dir: 'envs/stack',
+            terragrunt: true,
+            terragrunt_run_all: true,
+            workspace: 'prod',
+          },
+        ],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        "Project network: workspace must be a name of letters, digits, '-', '_' and '.' (got prod env)"
+      );
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project stack: workspace is not supported with terragrunt_run_all');
+    });
+
+    it('should load workflows referenced by projects', () => {
+      mockYaml.load.mockReturnValue({
+        workflows: {
+          checked: {
+            plan: {
+              steps: ['init', 'plan', { run: 'conftest test', env: { POLICY: 'strict' } }],
+            },
+          },
+        },
+        projects: [{ name: 'production', dir: 'envs/production', workflow: 'checked' }],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.workflows).toEqual({
+        checked: {
+          plan: {
+            steps: ['init', 'plan', { run: 'conftest test', env: { POLICY: 'strict' } }],
+          },
+        },
+      });
+      expect(config.projects[0].workflow).toBe('checked');
+    });
+
+    it('should report every problem of a workflow', () => {
+      mockYaml.load.mockReturnValue({
+        workflows: {
+          broken: {
+            plan: { steps: ['init', 'apply', { run: '' }, { run: 'make', env: { LEVEL: 1 } }] },
+            apply: { steps: [] },
+            destroy: { steps: ['init'] },
+          },
+        },
+        projects: [{ name: 'production', dir: 'envs/production' }],
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect((error as ConfigValidationError).errors).toEqual([
+        'workflows.broken: unknown command destroy (must be plan or apply)',
+        'workflows.broken.plan.steps[1]: unknown step apply (must be init, plan or run)',
+        'workflows.broken.plan.steps[2]: run must be a non-empty string',
+        'workflows.broken.plan.steps[3]: env must map variable names to strings',
+        'workflows.broken.plan.steps must include the plan step exactly once',
+        'workflows.broken.apply.steps must be a non-empty list',
+      ]);
+    });
+
+    it('should reject a project referencing an unknown workflow', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'envs/production', workflow: 'checked' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow("Project production: workflow 'checked' not found in workflows");
+    });
+
+    it('should load required and forbidden labels', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          {
+            name: 'production',
+            dir: 'terraform/prod',
+            required_labels: ['terraform-approved'],
+            forbidden_labels: ['do-not-merge'],
+          },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].required_labels).toEqual(['terraform-approved']);
+      expect(config.projects[0].forbidden_labels).toEqual(['do-not-merge']);
+    });
+
+    it('should throw error when labels are not an array of names', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', forbidden_labels: 'do-not-merge' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: forbidden_labels must be an array of non-empty label names');
+    });
+
+    it('should load head and base branch filters', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'production', dir: 'terraform/prod', branch: 'release/.*', base_branch: 'main' },
+        ],
+      });
+
+      const config = loadConfig('/path/to/config.yaml');
+
+      expect(config.projects[0].branch).toBe('release/.*');
+      expect(config.projects[0].base_branch).toBe('main');
+    });
+
+    it('should throw error when a branch filter is not a valid regular expression', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: 'terraform/prod', base_branch: 'release/(' }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow('Project production: base_branch is not a valid regular expression: release/(');
+    });
+  });
+
+  describe('filterEnabledProjects', () => {
+    const projects = [
+      { name: 'network', dir: 'network', enabled: false },
+      { name: 'dns', dir: 'dns', enabled: false },
+      { name: 'app', dir: 'app' },
+      { name: 'db', dir: 'db', enabled: true },
+    ];
+
+    it('should skip disabled projects when all projects are targeted', () => {
+      expect(filterEnabledProjects(projects, ['network', 'dns', 'app', 'db'], false)).toEqual([
+        'app',
+        'db',
+      ]);
+    });
+
+    it('should reject an explicitly selected disabled project', () => {
+      expect(() => filterEnabledProjects(projects, ['app', 'network'], true)).toThrow(
+        "Project 'network' is disabled"
+      );
+      expect(() => filterEnabledProjects(projects, ['network', 'dns'], true)).toThrow(
+        "Projects 'network', 'dns' are disabled"
+      );
+    });
+
+    it('should keep explicitly selected enabled projects', () => {
+      expect(filterEnabledProjects(projects, ['db', 'app'], true)).toEqual(['db', 'app']);
+    });
+
+    it('should load and validate enabled', () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'network', dir: 'network', enabled: 'no' }],
+      });
+
+      expect(() => loadConfig('/path/to/config.yaml')).toThrow(
+        'Project network: enabled must be a boolean'
+      );
+    });
+  });
+
+  describe('filterProjectsByWorkspace', () => {
+    const projects = [
+      { name: 'network-dev', dir: 'network', workspace: 'dev' },
+      { name: 'network-prod', dir: 'network', workspace: 'prod' },
+      { name: 'dns', dir: 'dns' },
+    ];
+
+    it('should keep the target projects using one of the workspaces', () => {
+      expect(
+        filterProjectsByWorkspace(projects, ['dns', 'network-prod', 'network-dev'], ['prod', 'dev'])
+      ).toEqual(['network-prod', 'network-dev']);
+    });
+
+    it('should reject workspaces no target project uses', () => {
+      expect(() => filterProjectsByWorkspace(projects, ['dns', 'network-dev'], ['prod'])).toThrow(
+        "No target project uses workspace 'prod'"
+      );
+    });
+  });
+
+  describe('findProjectsByPatterns', () => {
+    const projects = [
+      { name: 'app-prod', dir: 'app/prod' },
+      { name: 'network', dir: 'network' },
+      { name: 'app-dev', dir: 'app/dev' },
+    ];
+
+    it('should return projects matching any of the patterns in configuration order', () => {
+      expect(findProjectsByPatterns(projects, ['app-*'])).toEqual(['app-prod', 'app-dev']);
+      expect(findProjectsByPatterns(projects, ['net*', 'app-de?'])).toEqual([
+        'network',
+        'app-dev',
+      ]);
+    });
+
+    it('should reject a pattern no project matches', () => {
+      expect(() => findProjectsByPatterns(projects, ['db-*'])).toThrow(
+        "No project matches 'db-*'. Available projects: app-prod, network, app-dev"
+      );
+    });
+  });
+
+  describe('findProjectsByDirs', () => {
+    const projects = [
+      { name: 'prod', dir: 'envs/prod' },
+      { name: 'staging', dir: './envs/staging/' },
+      { name: 'vpc', dir: 'modules/vpc' },
+      { name: 'root', dir: '.' },
+    ];
+
+    it('should return projects in or below the directories', () => {
+      expect(findProjectsByDirs(projects, ['envs'], '/repo')).toEqual(['prod', 'staging']);
+      expect(findProjectsByDirs(projects, ['envs/prod/', 'modules/vpc'], '/repo')).toEqual([
+        'prod',
+        'vpc',
+      ]);
+    });
+
+    it('should match wildcards and select every project with .', () => {
+      expect(findProjectsByDirs(projects, ['*/s*'], '/repo')).toEqual(['staging']);
+      expect(findProjectsByDirs(projects, ['.'], '/repo')).toEqual([
+        'prod',
+        'staging',
+        'vpc',
+        'root',
+      ]);
+    });
+
+    it('should resolve project directories against base_dir', () => {
+      expect(findProjectsByDirs(projects, ['terraform/envs'], '/repo', 'terraform')).toEqual([
+        'prod',
+        'staging',
+      ]);
+    });
+
+    it('should reject a directory without projects', () => {
+      expect(() => findProjectsByDirs(projects, ['envs/qa'], '/repo')).toThrow(
+        "No project in directory 'envs/qa'. Project directories: envs/prod, envs/staging, modules/vpc, ."
+      );
+    });
+  });
+
+  describe('findProjectsByTags', () => {
+    const projects = [
+      { name: 'vpc', dir: 'vpc', tags: ['networking'] },
+      { name: 'app', dir: 'app' },
+      { name: 'dns', dir: 'dns', tags: ['networking', 'edge'] },
+      { name: 'cdn', dir: 'cdn', tags: ['edge'] },
+    ];
+
+    it('should return projects carrying any of the tags in configuration order', () => {
+      expect(findProjectsByTags(projects, ['edge', 'networking'])).toEqual(['vpc', 'dns', 'cdn']);
+      expect(findProjectsByTags(projects, ['edge'])).toEqual(['dns', 'cdn']);
+    });
+
+    it('should reject a tag no project carries', () => {
+      expect(() => findProjectsByTags(projects, ['storage'])).toThrow(
+        "Tag 'storage' not found in configuration. Available tags: networking, edge"
+      );
+    });
+
+    it('should load and validate tags', () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+      mockYaml.load.mockReturnValue({
+        projects: [
+          { name: 'vpc', dir: 'vpc', tags: ['networking', 'tier-1'] },
+          { name: 'dns', dir: 'dns', tags: ['has space'] },
+          { name: 'cdn', dir: 'cdn', tags: [] },
+        ],
+      });
+
+      let error: unknown;
+      try {
+        loadConfig('/path/to/config.yaml');
+      } catch (e) {
+        error = e;
+      }
+
+      expect(error).toBeInstanceOf(ConfigValidationError);
+      expect((error as ConfigValidationError).errors).toEqual([
+        'Project dns: tags must be a non-empty list of words such as networking',
+        'Project cdn: tags must be a non-empty list of words such as networking',
+      ]);
+    });
+  });
+
+  describe('matchesBranchFilters', () => {
+    const project = { name: 'production', dir: 'terraform/prod' };
+
+    it('should match any branch without filters', () => {
+      expect(matchesBranchFilters(project, 'feature', 'develop')).toBe(true);
+    });
+
+    it('should filter on the base branch', () => {
+      const filtered = { ...project, base_branch: 'main' };
+
+      expect(matchesBranchFilters(filtered, 'feature', 'main')).toBe(true);
+      expect(matchesBranchFilters(filtered, 'feature', 'develop')).toBe(false);
+      expect(matchesBranchFilters(filtered, 'feature', 'main-old')).toBe(false);
+    });
+
+    it('should filter on the head branch', () => {
+      const filtered = { ...project, branch: 'release/.*' };
+
+      expect(matchesBranchFilters(filtered, 'release/1.2', 'develop')).toBe(true);
+      expect(matchesBranchFilters(filtered, 'feature', 'develop')).toBe(false);
+    });
+
+    it('should require both filters to match when both are set', () => {
+      const filtered = { ...project, branch: 'release/.*', base_branch: 'main|stable' };
+
+      expect(matchesBranchFilters(filtered, 'release/1.2', 'stable')).toBe(true);
+      expect(matchesBranchFilters(filtered, 'release/1.2', 'develop')).toBe(false);
+      expect(matchesBranchFilters(filtered, 'feature', 'main')).toBe(false);
+    });
+  });
+
+  describe('whenModifiedPatternToRegExp', () => {
+    it.each([
+      ['*.tf', 'main.tf', true],
+      ['*.tf', 'modules/vpc/main.tf', false],
+      ['*.tf', 'main.tfvars', false],
+      ['**/*.tf', 'main.tf', true],
+      ['**/*.tf', 'modules/vpc/main.tf', true],
+      ['./*.tfvars', 'prod.tfvars', true],
+      ['../modules/**', '../modules/vpc/main.tf', true],
+      ['../modules/**', '../other/main.tf', false],
+      ['.terraform.lock.hcl', '.terraform.lock.hcl', true],
+      ['.terraform.lock.hcl', 'xterraform.lock.hcl', false],
+    ])('should match %s against %s: %s', (pattern, file, expected) => {
+      expect(whenModifiedPatternToRegExp(pattern).test(file)).toBe(expected);
+    });
+  });
+
+  describe('shouldAutoplan', () => {
+    const project = { name: 'production', dir: 'terraform/prod' };
+
+    it('should always plan a project without autoplan settings', () => {
+      expect(shouldAutoplan(project, 'terraform/prod', [])).toBe(true);
+    });
+
+    it('should not plan a project with autoplan disabled', () => {
+      const disabled = { ...project, autoplan: { enabled: false, when_modified: ['*.tf'] } };
+
+      expect(shouldAutoplan(disabled, 'terraform/prod', ['terraform/prod/main.tf'])).toBe(false);
+    });
+
+    it('should match when_modified relative to the project directory', () => {
+      const enabled = {
+        ...project,
+        autoplan: { enabled: true, when_modified: ['*.tf', '../modules/**'] },
+      };
+
+      expect(shouldAutoplan(enabled, 'terraform/prod', ['terraform/prod/main.tf'])).toBe(true);
+      expect(shouldAutoplan(enabled, 'terraform/prod', ['terraform/modules/vpc/main.tf'])).toBe(
+        true
+      );
+      expect(shouldAutoplan(enabled, 'terraform/prod', ['terraform/staging/main.tf'])).toBe(false);
+      expect(shouldAutoplan(enabled, 'terraform/prod', ['README.md'])).toBe(false);
+    });
+
+    it('should let a later ! pattern exclude files an earlier pattern matched', () => {
+      const enabled = {
+        ...project,
+        autoplan: {
+          enabled: true,
+          when_modified: ['**/*.tf', '../modules/**', '!../modules/legacy/**', '!test/**'],
+        },
+      };
+
+      expect(shouldAutoplan(enabled, 'terraform/prod', ['terraform/modules/vpc/main.tf'])).toBe(
+        true
+      );
+      expect(
+        shouldAutoplan(enabled, 'terraform/prod', ['terraform/modules/legacy/main.tf'])
+      ).toBe(false);
+      expect(shouldAutoplan(enabled, 'terraform/prod', ['terraform/prod/test/main.tf'])).toBe(
+        false
+      );
+      expect(
+        shouldAutoplan(enabled, 'terraform/prod', [
+          'terraform/prod/test/main.tf',
+          'terraform/prod/main.tf',
+        ])
+      ).toBe(true);
+    });
+
+    it('should let a pattern after a ! pattern include files again', () => {
+      const enabled = {
+        ...project,
+        autoplan: { enabled: true, when_modified: ['*.tf', '!*.tf', 'main.tf'] },
+      };
+
+      expect(shouldAutoplan(enabled, 'terraform/prod', ['terraform/prod/main.tf'])).toBe(true);
+      expect(shouldAutoplan(enabled, 'terraform/prod', ['terraform/prod/vars.tf'])).toBe(false);
+    });
+
+    it('should plan for changes to the local modules of the project', () => {
+      const enabled = {
+        ...project,
+        autoplan: { enabled: true, when_modified: ['*.tf', '!../modules/legacy/**'] },
+      };
+      const moduleDirs = ['terraform/modules/vpc', 'terraform/modules/legacy'];
+
+      expect(
+        shouldAutoplan(enabled, 'terraform/prod', ['terraform/modules/vpc/main.tf'], moduleDirs)
+      ).toBe(true);
+      expect(
+        shouldAutoplan(enabled, 'terraform/prod', ['terraform/modules/legacy/main.tf'], moduleDirs)
+      ).toBe(false);
+      expect(
+        shouldAutoplan(enabled, 'terraform/prod', ['terraform/modules/vpc2/main.tf'], moduleDirs)
+      ).toBe(false);
+    });
+
+    it('should match files of a project at the repository root', () => {
+      const root = { name: 'root', dir: '.', autoplan: { enabled: true, when_modified: ['*.tf'] } };
+
+      expect(shouldAutoplan(root, '', ['main.tf'])).toBe(true);
+      expect(shouldAutoplan(root, '', ['modules/vpc/main.tf'])).toBe(false);
+    });
+  });
+
+  describe('project dir validation', () => {
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.readFileSync.mockReturnValue('yaml content');
+    });
+
+    it.each(['../../etc', '/etc', 'terraform/../../outside'])('should reject dir %s', (dir) => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir }],
+      });
+
+      expect(() => {
+        loadConfig('/path/to/config.yaml');
+      }).toThrow(
+        `Project production: dir must be a relative path inside the repository (got ${dir})`
+      );
+    });
+
+    it('should accept dirs that stay inside the repository', () => {
+      mockYaml.load.mockReturnValue({
+        projects: [{ name: 'production', dir: './terraform/../terraform/prod' }],
+      });
+
+      expect(() => loadConfig('/path/to/config.yaml')).not.toThrow();
+    });
+  });
+
+  describe('resolveProjectDir', () => {
+    const root = '/workspace';
+
+    beforeEach(() => {
+      mockFs.existsSync.mockReturnValue(false);
+    });
+
+    it('should resolve a dir inside the workspace', () => {
+      expect(resolveProjectDir('terraform/prod', root)).toBe(path.resolve(root, 'terraform/prod'));
+    });
+
+    it('should allow the workspace root itself', () => {
+      expect(resolveProjectDir('.', root)).toBe(path.resolve(root));
+    });
+
+    it('should reject .. traversal', () => {
+      expect(() => resolveProjectDir('../../etc', root)).toThrow(
+        'Project directory escapes the workspace: ../../etc'
+      );
+    });
+
+    it('should reject absolute paths outside the workspace', () => {
+      expect(() => resolveProjectDir('/etc', root)).toThrow(
+        'Project directory escapes the workspace: /etc'
+      );
+    });
+
+    it('should not treat a sibling with a common prefix as inside', () => {
+      expect(() => resolveProjectDir('../workspace-other', root)).toThrow(
+        'Project directory escapes the workspace'
+      );
+    });
+
+    it('should reject symlinks that point outside the workspace', () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.realpathSync.mockImplementation(((p: fs.PathLike) =>
+        p === path.resolve(root) ? path.resolve(root) : '/etc') as any);
+
+      expect(() => resolveProjectDir('terraform/link', root)).toThrow(
+        'Project directory escapes the workspace through a symlink: terraform/link'
+      );
+    });
+
+    it('should accept symlinks that stay inside the workspace', () => {
+      mockFs.existsSync.mockReturnValue(true);
+      mockFs.realpathSync.mockImplementation(((p: fs.PathLike) =>
+        p === path.resolve(root) ? path.resolve(root) : path.resolve(root, 'modules/prod')) as any);
+
+      expect(resolveProjectDir('terraform/link', root)).toBe(path.resolve(root, 'terraform/link'));
+    });
+
+    it('should resolve a relative base_dir against the workspace', () => {
+      expect(resolveProjectDir('prod', root, 'infra')).toBe(path.resolve(root, 'infra/prod'));
+    });
+
+    it('should use an absolute base_dir as is', () => {
+      expect(resolveProjectDir('prod', root, '/workspace/terraform')).toBe(
+        path.resolve('/workspace/terraform/prod')
+      );
+    });
+
+    it('should reject a base_dir outside the workspace', () => {
+      expect(() => resolveProjectDir('prod', root, '/opt/terraform')).toThrow(
+        'Project directory escapes the workspace: prod (base_dir: /opt/terraform)'
+      );
+    });
+  });
+
+  describe('getDefaultConfig', () => {
+    it('should build a single default project', () => {
+      expect(getDefaultConfig('terraform')).toEqual({
+        projects: [{ name: 'default', dir: 'terraform' }],
+      });
+    });
+
+    it('should reject a directory outside the repository', () => {
+      expect(() => getDefaultConfig('../elsewhere')).toThrow(
+        'Project default: dir must be a relative path inside the repository (got ../elsewhere)'
+      );
+    });
   });
 
   describe('getDefaultRequirements', () => {
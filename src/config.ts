@@ -5,132 +5,2694 @@
 import * as fs from 'node:fs';
 import * as path from 'node:path';
 import * as yaml from 'js-yaml';
-import type { Config, ProjectConfig, Requirement } from './types';
+import {
+  buildStatusContext,
+  findUnknownPlaceholders,
+  MAX_STATUS_CONTEXT_LENGTH,
+  POLICY_CHECK_STATUS_COMMAND,
+  SECURITY_SCAN_STATUS_COMMAND,
+  STATUS_CONTEXT_PLACEHOLDERS,
+  STATUS_DESCRIPTION_PLACEHOLDERS,
+} from './reporter';
+import { LOCKABLE_COMMANDS } from './project-lock';
+import { parseRequirement } from './requirements';
+import { SECURITY_SCANNERS, SECURITY_SEVERITIES } from './security-scan';
+import { suggestClosest } from './suggestions';
+import { EXACT_VERSION_PATTERN } from './terraform-installer';
+import type {
+  AuthorizedCommand,
+  CommandAuthorization,
+  CommandTimeout,
+  CommentMode,
+  CommentTemplatesConfig,
+  ConcurrencyConfig,
+  Config,
+  ConfigRepoRef,
+  InfracostConfig,
+  LockedCommand,
+  MergeAfterApplyConfig,
+  MergeMethod,
+  NoChangesComment,
+  NotificationConfig,
+  NotificationFormat,
+  OutputMode,
+  PoliciesConfig,
+  PolicySetConfig,
+  PreviousPlanComments,
+  ProjectConfig,
+  RedactionConfig,
+  RepositoryPermission,
+  Requirement,
+  RetryConfig,
+  RetryPolicy,
+  RunStep,
+  SecurityScanConfig,
+  SecurityScanner,
+  SecuritySeverity,
+  StatusApi,
+  TerraformBinary,
+  TerraformCommand,
+  WorkflowConfig,
+  WorkflowStep,
+} from './types';
+
+/**
+ * Error listing every problem found in a configuration
+ */
+export class ConfigValidationError extends Error {
+  /**
+   * @param errors - Individual validation problems
+   */
+  constructor(readonly errors: string[]) {
+    super(`Invalid configuration:\n${errors.map((e) => `  - ${e}`).join('\n')}`);
+    this.name = 'ConfigValidationError';
+  }
+}
+
+/**
+ * Matches Go duration strings accepted by terraform, e.g. 30s, 5m, 1h30m
+ */
+const DURATION_REGEX = /^(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+$/;
+
+/**
+ * Checks whether a value is a duration string terraform accepts
+ *
+ * @example
+ * isValidDuration('5m') // => true
+ * isValidDuration('five minutes') // => false
+ */
+export function isValidDuration(value: string): boolean {
+  return DURATION_REGEX.test(value);
+}
+
+/**
+ * Milliseconds per duration unit
+ */
+const DURATION_UNIT_MS: Record<string, number> = {
+  ns: 1e-6,
+  us: 1e-3,
+  µs: 1e-3,
+  ms: 1,
+  s: 1000,
+  m: 60_000,
+  h: 3_600_000,
+};
+
+/**
+ * Converts a valid duration string to milliseconds
+ *
+ * @example
+ * parseDuration('1m30s') // => 90000
+ */
+export function parseDuration(value: string): number {
+  let total = 0;
+  for (const [, amount, unit] of value.matchAll(/(\d+(?:\.\d+)?)(ns|us|µs|ms|s|m|h)/g)) {
+    total += Number(amount) * DURATION_UNIT_MS[unit];
+  }
+  return total;
+}
+
+/**
+ * Error output patterns retried by default: network failures, API throttling and state locks
+ * held by another run
+ */
+export const DEFAULT_TRANSIENT_ERROR_PATTERNS = [
+  'RequestError: send request failed',
+  'i/o timeout',
+  'TLS handshake timeout',
+  'connection reset by peer',
+  'ThrottlingException|Rate exceeded|TooManyRequests',
+  '50[234] (Bad Gateway|Service Unavailable|Gateway Timeout)',
+  'Error acquiring the state lock',
+];
+
+/**
+ * Resolves the retry configuration, filling in defaults
+ *
+ * @param retry - Validated retry configuration
+ * @returns Retry policy for the executor
+ */
+export function getRetryPolicy(retry: RetryConfig): RetryPolicy {
+  return {
+    maxRetries: retry.max_retries ?? 2,
+    backoffMs: parseDuration(retry.backoff ?? '10s'),
+    patterns: (retry.patterns ?? DEFAULT_TRANSIENT_ERROR_PATTERNS).map((p) => new RegExp(p)),
+  };
+}
+
+/**
+ * Resolves a timeout for the executor
+ *
+ * @param duration - Validated timeout (plan_timeout, apply_timeout)
+ * @returns Deadline of the command, or undefined when it has none
+ */
+export function getCommandTimeout(duration: string | undefined): CommandTimeout | undefined {
+  return duration === undefined ? undefined : { duration, ms: parseDuration(duration) };
+}
+
+/**
+ * Validates an optional boolean field
+ *
+ * @returns The value when valid, undefined when absent or invalid
+ */
+function validateBoolean(
+  value: unknown,
+  fieldName: string,
+  errors: string[]
+): boolean | undefined {
+  if (value === undefined) {
+    return undefined;
+  }
+  if (typeof value !== 'boolean') {
+    errors.push(`${fieldName} must be a boolean`);
+    return undefined;
+  }
+  return value;
+}
+
+/**
+ * Validates an optional timeout (plan_timeout, apply_timeout)
+ *
+ * @returns The duration when valid, undefined when absent or invalid
+ */
+function validateTimeout(value: unknown, fieldName: string, errors: string[]): string | undefined {
+  if (value === undefined) {
+    return undefined;
+  }
+  if (typeof value !== 'string' || !isValidDuration(value) || parseDuration(value) < 1000) {
+    errors.push(`${fieldName} must be a duration of at least 1s such as 30m or 1h (got ${value})`);
+    return undefined;
+  }
+  return value;
+}
 
 /**
  * Validates that requirements are valid
+ *
+ * @returns The requirements when valid, undefined otherwise
  */
-function validateRequirements(requirements: unknown, fieldName: string): Requirement[] {
+function validateRequirements(
+  requirements: unknown,
+  fieldName: string,
+  errors: string[]
+): Requirement[] | undefined {
   if (!Array.isArray(requirements)) {
-    throw new Error(`${fieldName} must be an array`);
+    errors.push(`${fieldName} must be an array`);
+    return undefined;
+  }
+
+  let valid = true;
+
+  for (const req of requirements) {
+    if (typeof req !== 'string') {
+      errors.push(`Invalid requirement in ${fieldName}: ${req}. Must be a string`);
+      valid = false;
+      continue;
+    }
+
+    try {
+      parseRequirement(req);
+    } catch (error) {
+      errors.push(
+        `Invalid requirement in ${fieldName}: ${req}. ${error instanceof Error ? error.message : String(error)}`
+      );
+      valid = false;
+    }
+  }
+
+  return valid ? (requirements as Requirement[]) : undefined;
+}
+
+/**
+ * Validates a list of PR label names
+ *
+ * @returns The labels when valid, undefined otherwise
+ */
+function validateLabels(
+  labels: unknown,
+  fieldName: string,
+  errors: string[]
+): string[] | undefined {
+  if (!Array.isArray(labels) || !labels.every((l) => typeof l === 'string' && l.trim() !== '')) {
+    errors.push(`${fieldName} must be an array of non-empty label names`);
+    return undefined;
+  }
+  return labels as string[];
+}
+
+/**
+ * Validates a list of project tags
+ *
+ * @returns The tags when valid, undefined otherwise
+ */
+function validateTags(tags: unknown, fieldName: string, errors: string[]): string[] | undefined {
+  if (
+    !Array.isArray(tags) ||
+    tags.length === 0 ||
+    !tags.every((t) => typeof t === 'string' && TAG_PATTERN.test(t))
+  ) {
+    errors.push(`${fieldName} must be a non-empty list of words such as networking`);
+    return undefined;
+  }
+  return tags as string[];
+}
+
+/**
+ * Matches a terraform input variable name
+ */
+const TERRAFORM_VAR_PATTERN = /^[A-Za-z_][A-Za-z0-9_-]*$/;
+
+/**
+ * Validates files a project reads relative to its directory (variable and backend config files)
+ *
+ * @returns The files when valid, undefined otherwise
+ */
+function validateProjectFiles(
+  files: unknown,
+  dir: string,
+  fieldName: string,
+  errors: string[]
+): string[] | undefined {
+  if (!Array.isArray(files) || !files.every((f) => typeof f === 'string' && f.trim() !== '')) {
+    errors.push(`${fieldName} must be a list of paths relative to the project directory`);
+    return undefined;
+  }
+  // Files are read from the runner, so they must not reach outside the checkout
+  const outside = files.filter((f) => path.isAbsolute(f) || !isRelativeInside(path.join(dir, f)));
+  if (outside.length > 0) {
+    errors.push(`${fieldName} must stay inside the repository (got ${outside.join(', ')})`);
+    return undefined;
+  }
+  return files as string[];
+}
+
+/**
+ * Matches a backend setting, which may be nested (e.g. assume_role.role_arn)
+ */
+const BACKEND_CONFIG_KEY_PATTERN = /^[A-Za-z_][A-Za-z0-9_.-]*$/;
+
+/**
+ * Matches an environment variable name
+ */
+const ENV_NAME_PATTERN = /^[A-Za-z_][A-Za-z0-9_]*$/;
+
+/**
+ * Matches a `${{ NAME }}` reference to a runner environment variable
+ */
+const ENV_REFERENCE_PATTERN = /\$\{\{\s*(.*?)\s*\}\}/g;
+
+/**
+ * Validates a map of variables, converting numbers and booleans to strings
+ *
+ * @param vars - Value to validate
+ * @param fieldName - Field name for error messages
+ * @param namePattern - Pattern every variable name must match
+ * @param errors - Array to push errors into
+ * @returns The variables when valid, undefined otherwise
+ */
+function validateVars(
+  vars: unknown,
+  fieldName: string,
+  namePattern: RegExp,
+  errors: string[]
+): Record<string, string> | undefined {
+  if (!isPlainObject(vars)) {
+    errors.push(`${fieldName} must be a map of variable names to values`);
+    return undefined;
+  }
+
+  const validated: Record<string, string> = {};
+  let valid = true;
+  for (const [name, value] of Object.entries(vars)) {
+    if (!namePattern.test(name)) {
+      errors.push(`${fieldName} has an invalid variable name: ${name}`);
+      valid = false;
+    } else if (
+      typeof value !== 'string' &&
+      typeof value !== 'number' &&
+      typeof value !== 'boolean'
+    ) {
+      errors.push(`${fieldName}.${name} must be a string, number or boolean`);
+      valid = false;
+    } else {
+      validated[name] = String(value);
+    }
+  }
+  return valid ? validated : undefined;
+}
+
+/**
+ * Validates environment variables, including the names their references point to
+ *
+ * @returns The variables when valid, undefined otherwise
+ */
+function validateEnv(
+  env: unknown,
+  fieldName: string,
+  errors: string[]
+): Record<string, string> | undefined {
+  const validated = validateVars(env, fieldName, ENV_NAME_PATTERN, errors);
+  for (const [name, value] of Object.entries(validated ?? {})) {
+    for (const [reference, referenced] of value.matchAll(ENV_REFERENCE_PATTERN)) {
+      if (!ENV_NAME_PATTERN.test(referenced)) {
+        errors.push(`${fieldName}.${name} has an invalid reference: ${reference}`);
+        return undefined;
+      }
+    }
+  }
+  return validated;
+}
+
+/**
+ * Replaces `${{ NAME }}` references in environment variables with runner environment values
+ *
+ * @param env - Environment variables of a project
+ * @param source - Environment the references are read from (default: the runner's)
+ * @returns Variables with every reference resolved
+ * @throws Error if a referenced variable is not set
+ *
+ * @example
+ * resolveEnvReferences({ AWS_PROFILE: '${{ PROD_PROFILE }}' }, { PROD_PROFILE: 'prod' })
+ * // => { AWS_PROFILE: 'prod' }
+ */
+export function resolveEnvReferences(
+  env: Record<string, string>,
+  source: NodeJS.ProcessEnv = process.env
+): Record<string, string> {
+  const missing = new Set<string>();
+  const resolved: Record<string, string> = {};
+  for (const [name, value] of Object.entries(env)) {
+    resolved[name] = value.replace(ENV_REFERENCE_PATTERN, (_, referenced: string) => {
+      const referencedValue = source[referenced];
+      if (referencedValue === undefined) {
+        missing.add(referenced);
+        return '';
+      }
+      return referencedValue;
+    });
+  }
+
+  if (missing.size > 0) {
+    throw new Error(
+      `env references variables that are not set on the runner: ${[...missing].join(', ')}`
+    );
+  }
+  return resolved;
+}
+
+/**
+ * Validates a regular expression (branch filters, retry patterns)
+ *
+ * @returns The pattern when valid, undefined otherwise
+ */
+function validatePattern(
+  value: unknown,
+  fieldName: string,
+  errors: string[]
+): string | undefined {
+  if (typeof value !== 'string' || value === '') {
+    errors.push(`${fieldName} must be a non-empty regular expression`);
+    return undefined;
+  }
+
+  try {
+    new RegExp(value);
+  } catch (_error) {
+    errors.push(`${fieldName} is not a valid regular expression: ${value}`);
+    return undefined;
+  }
+
+  return value;
+}
+
+/**
+ * Whether a path is relative and does not climb above its base with `..`
+ */
+function isRelativeInside(dir: string): boolean {
+  const normalized = path.normalize(dir);
+  return (
+    !path.isAbsolute(normalized) && normalized !== '..' && !normalized.startsWith(`..${path.sep}`)
+  );
+}
+
+/**
+ * Whether target is root itself or a path below it
+ */
+function isWithin(root: string, target: string): boolean {
+  return isRelativeInside(path.relative(root, target));
+}
+
+/**
+ * Whether a project's branch filters allow it to run for a pull request
+ *
+ * @param project - Project configuration
+ * @param headBranch - PR head branch
+ * @param baseBranch - Branch the PR targets
+ * @returns True when every configured filter fully matches its branch
+ *
+ * @remarks
+ * `branch` is matched against the head branch and `base_branch` against the
+ * base branch. When both are set, neither takes precedence: both must match.
+ *
+ * @example
+ * matchesBranchFilters({ name: 'prod', dir: 'prod', base_branch: 'main' }, 'feature', 'main')
+ * // => true
+ */
+export function matchesBranchFilters(
+  project: ProjectConfig,
+  headBranch: string,
+  baseBranch: string
+): boolean {
+  const matches = (pattern: string | undefined, branch: string): boolean =>
+    pattern === undefined || new RegExp(`^(?:${pattern})$`).test(branch);
+
+  return matches(project.branch, headBranch) && matches(project.base_branch, baseBranch);
+}
+
+/**
+ * Converts an autoplan when_modified pattern to a regular expression
+ *
+ * @param pattern - Pattern such as `*.tf`, `**\/*.tfvars` or `../modules/**`
+ * @returns Regular expression tested against a path relative to the project directory
+ *
+ * @remarks
+ * `*` and `?` do not cross directories, `**` does, and the whole path must match.
+ */
+export function whenModifiedPatternToRegExp(pattern: string): RegExp {
+  const body = pattern.replace(/^\.\//, '');
+
+  let source = '';
+  for (let i = 0; i < body.length; i++) {
+    const char = body[i];
+    if (char === '*' && body[i + 1] === '*') {
+      if (body[i + 2] === '/') {
+        source += '(?:.*/)?';
+        i += 2;
+      } else {
+        source += '.*';
+        i += 1;
+      }
+    } else if (char === '*') {
+      source += '[^/]*';
+    } else if (char === '?') {
+      source += '[^/]';
+    } else {
+      source += char.replace(/[.+^${}()|[\]\\]/g, '\\$&');
+    }
+  }
+
+  return new RegExp(`^${source}$`);
+}
+
+/**
+ * Whether a pull request event should plan a project automatically
+ *
+ * @param project - Project configuration
+ * @param projectDir - Project directory relative to the repository root
+ * @param changedFiles - Files changed by the pull request, relative to the repository root
+ * @param moduleDirs - Local modules the project uses, relative to the repository root
+ * @returns True when the project has no autoplan settings, or autoplan is enabled and a
+ *   changed file matches when_modified or belongs to one of the modules
+ *
+ * @remarks
+ * Patterns are relative to the project directory, so `*.tf` only matches the project's
+ * own files and `../modules/**` reaches a shared module. A pattern starting with `!`
+ * excludes the files it matches; the last pattern matching a file decides. Files of the
+ * modules count as matched before any pattern, so `!` can exclude them too.
+ *
+ * @example
+ * shouldAutoplan(
+ *   { name: 'prod', dir: 'prod', autoplan: { enabled: true, when_modified: ['*.tf'] } },
+ *   'prod',
+ *   ['prod/main.tf']
+ * )
+ * // => true
+ */
+export function shouldAutoplan(
+  project: ProjectConfig,
+  projectDir: string,
+  changedFiles: string[],
+  moduleDirs: string[] = []
+): boolean {
+  if (!project.autoplan) {
+    return true;
+  }
+  if (!project.autoplan.enabled) {
+    return false;
+  }
+
+  const patterns = project.autoplan.when_modified.map((pattern) => ({
+    negated: pattern.startsWith('!'),
+    regexp: whenModifiedPatternToRegExp(pattern.replace(/^!/, '')),
+  }));
+  return changedFiles.some((file) => {
+    const relative = path.posix.relative(projectDir || '.', file);
+    let matched = moduleDirs.some((dir) => file.startsWith(`${dir}/`));
+    for (const { negated, regexp } of patterns) {
+      if (regexp.test(relative)) {
+        matched = !negated;
+      }
+    }
+    return matched;
+  });
+}
+
+/**
+ * Drops disabled projects from the target projects
+ *
+ * @param projects - Configured projects
+ * @param projectNames - Target projects
+ * @param explicit - Whether the targets were named in the command (e.g., -project=)
+ * @returns Target projects that are enabled
+ * @throws Error if a project named in the command is disabled
+ *
+ * @remarks
+ * A disabled project is skipped quietly when it is only implied (all projects),
+ * but naming it is an error so the request does not silently run nothing.
+ */
+export function filterEnabledProjects(
+  projects: ProjectConfig[],
+  projectNames: string[],
+  explicit: boolean
+): string[] {
+  const disabled = projectNames.filter(
+    (name) => projects.find((p) => p.name === name)?.enabled === false
+  );
+
+  if (explicit && disabled.length > 0) {
+    const list = disabled.map((name) => `'${name}'`).join(', ');
+    throw new Error(
+      disabled.length === 1 ? `Project ${list} is disabled` : `Projects ${list} are disabled`
+    );
+  }
+
+  return projectNames.filter((name) => !disabled.includes(name));
+}
+
+/**
+ * Finds the projects carrying any of the given tags
+ *
+ * @param projects - Configured projects
+ * @param tags - Tags from the command (e.g., -tag=networking)
+ * @returns Names of the tagged projects, in configuration order
+ * @throws Error if a tag is not carried by any project
+ */
+export function findProjectsByTags(projects: ProjectConfig[], tags: string[]): string[] {
+  const configuredTags = new Set(projects.flatMap((p) => p.tags ?? []));
+  for (const tag of tags) {
+    if (!configuredTags.has(tag)) {
+      const available = [...configuredTags].join(', ') || '(none)';
+      throw new Error(`Tag '${tag}' not found in configuration. Available tags: ${available}`);
+    }
+  }
+
+  return projects.filter((p) => p.tags?.some((tag) => tags.includes(tag))).map((p) => p.name);
+}
+
+/**
+ * Whether a project selector from the command is a wildcard pattern (e.g., app-*)
+ */
+export function isProjectPattern(selector: string): boolean {
+  return /[*?]/.test(selector);
+}
+
+/**
+ * Finds the projects whose names match any of the given wildcard patterns
+ *
+ * @param projects - Configured projects
+ * @param patterns - Patterns from the command (e.g., -project=app-*)
+ * @returns Names of the matching projects, in configuration order
+ * @throws Error if a pattern matches no project
+ */
+export function findProjectsByPatterns(projects: ProjectConfig[], patterns: string[]): string[] {
+  const regexps = patterns.map((pattern) => {
+    const regexp = whenModifiedPatternToRegExp(pattern);
+    if (!projects.some((p) => regexp.test(p.name))) {
+      const available = projects.map((p) => p.name).join(', ');
+      throw new Error(`No project matches '${pattern}'. Available projects: ${available}`);
+    }
+    return regexp;
+  });
+
+  return projects.filter((p) => regexps.some((regexp) => regexp.test(p.name))).map((p) => p.name);
+}
+
+/**
+ * Finds the projects in or below any of the given directories
+ *
+ * @param projects - Configured projects
+ * @param dirs - Directories from the command, relative to the repository root (e.g., -dir=envs/*)
+ * @param workspaceRoot - Root of the checkout (default: current working directory)
+ * @param baseDir - Top-level base_dir the project directories are relative to
+ * @returns Names of the matching projects, in configuration order
+ * @throws Error if a directory has no project
+ *
+ * @remarks
+ * Directories may use wildcards, and `.` selects every project.
+ */
+export function findProjectsByDirs(
+  projects: ProjectConfig[],
+  dirs: string[],
+  workspaceRoot: string = process.cwd(),
+  baseDir = '.'
+): string[] {
+  const root = path.resolve(workspaceRoot);
+  const projectDirs = projects.map((p) =>
+    path.relative(root, path.resolve(root, baseDir, p.dir)).split(path.sep).join('/')
+  );
+
+  // A directory selects the projects in it and in any directory below it
+  const isInside = (regexp: RegExp, projectDir: string): boolean =>
+    projectDir.split('/').some((_, i, parts) => regexp.test(parts.slice(0, i + 1).join('/')));
+
+  const regexps = dirs.map((dir) => {
+    const normalized = path.posix.normalize(dir).replace(/^\/+|\/+$/g, '');
+    const regexp =
+      normalized === '.' || normalized === '' ? /^/ : whenModifiedPatternToRegExp(normalized);
+    if (!projectDirs.some((projectDir) => isInside(regexp, projectDir))) {
+      const available = [...new Set(projectDirs.map((d) => d || '.'))].join(', ');
+      throw new Error(`No project in directory '${dir}'. Project directories: ${available}`);
+    }
+    return regexp;
+  });
+
+  return projects
+    .filter((_, i) => regexps.some((regexp) => isInside(regexp, projectDirs[i])))
+    .map((p) => p.name);
+}
+
+/**
+ * Narrows target projects to those using one of the given terraform workspaces
+ *
+ * @param projects - Configured projects
+ * @param projectNames - Names of the target projects
+ * @param workspaces - Workspaces from the command (e.g., -w=prod)
+ * @returns Names of the target projects using one of the workspaces, in their original order
+ * @throws Error if no target project uses any of the workspaces
+ */
+export function filterProjectsByWorkspace(
+  projects: ProjectConfig[],
+  projectNames: string[],
+  workspaces: string[]
+): string[] {
+  const matched = projectNames.filter((name) => {
+    const workspace = projects.find((p) => p.name === name)?.workspace;
+    return workspace !== undefined && workspaces.includes(workspace);
+  });
+  if (matched.length === 0) {
+    const list = workspaces.map((w) => `'${w}'`).join(', ');
+    throw new Error(`No target project uses workspace ${list}`);
+  }
+
+  return matched;
+}
+
+/**
+ * Resolves a project directory and ensures it stays inside the workspace
+ *
+ * @param dir - Project directory from configuration
+ * @param workspaceRoot - Root of the checkout (default: current working directory)
+ * @param baseDir - Top-level base_dir the project directory is relative to
+ * @returns Absolute project directory
+ * @throws Error if the directory resolves outside the workspace, including through symlinks
+ *
+ * @remarks
+ * The configuration may come from the PR branch, so a project must never be able
+ * to run terraform in an arbitrary directory on the runner. A relative base_dir is
+ * resolved against the workspace and an absolute one is used as is, but either way
+ * the result must stay inside the workspace.
+ */
+export function resolveProjectDir(
+  dir: string,
+  workspaceRoot: string = process.cwd(),
+  baseDir = '.'
+): string {
+  const root = path.resolve(workspaceRoot);
+  const resolved = path.resolve(root, baseDir, dir);
+  const label = baseDir === '.' ? dir : `${dir} (base_dir: ${baseDir})`;
+
+  if (!isWithin(root, resolved)) {
+    throw new Error(`Project directory escapes the workspace: ${label}`);
+  }
+
+  // A symlink inside the checkout can still point anywhere
+  if (fs.existsSync(resolved)) {
+    const realRoot = fs.realpathSync(root);
+    const realDir = fs.realpathSync(resolved);
+    if (!isWithin(realRoot, realDir)) {
+      throw new Error(`Project directory escapes the workspace through a symlink: ${label}`);
+    }
+  }
+
+  return resolved;
+}
+
+/**
+ * CLIs a project can run with
+ */
+const TERRAFORM_BINARIES: TerraformBinary[] = ['terraform', 'tofu'];
+
+/**
+ * Fields a project may set
+ */
+const PROJECT_FIELDS = [
+  'name',
+  'dir',
+  'enabled',
+  'tags',
+  'autoplan',
+  'terraform_var_files',
+  'terraform_vars',
+  'env',
+  'plan_requirements',
+  'apply_requirements',
+  'apply_on_merge',
+  'require_plan',
+  'state_requirements',
+  'import_requirements',
+  'destroy_requirements',
+  'terragrunt',
+  'terragrunt_run_all',
+  'terragrunt_run_all_apply',
+  'terraform_version',
+  'binary',
+  'refresh',
+  'lock_timeout',
+  'plan_timeout',
+  'apply_timeout',
+  'auto_unlock_on_failure',
+  'init_upgrade',
+  'init_backend',
+  'backend_config',
+  'backend_config_files',
+  'init_extra_args',
+  'workspace',
+  'workflow',
+  'execution_order_group',
+  'concurrency_group',
+  'depends_on',
+  'parallel_plan',
+  'parallel_apply',
+  'abort_on_execution_order_fail',
+  'policy_sets',
+  'security_scan',
+  'required_labels',
+  'forbidden_labels',
+  'branch',
+  'base_branch',
+];
+
+/**
+ * Fields the autoplan setting of a project may set
+ */
+const AUTOPLAN_FIELDS = ['enabled', 'when_modified'];
+
+/**
+ * Top-level fields of the configuration (include is resolved before validation)
+ */
+const CONFIG_FIELDS = [
+  'projects',
+  'workflows',
+  'policies',
+  'authorization',
+  'binary',
+  'terragrunt_version',
+  'plan_timeout',
+  'apply_timeout',
+  'require_plan',
+  'env',
+  'notifications',
+  'output_mode',
+  'status_api',
+  'comment_on_no_changes',
+  'comment_mode',
+  'previous_plan_comments',
+  'invalidate_outdated_plans',
+  'comment_templates',
+  'base_dir',
+  'max_projects_per_run',
+  'parallel_plan',
+  'parallel_apply',
+  'parallel_pool_size',
+  'abort_on_execution_order_fail',
+  'command_prefixes',
+  'project_flags',
+  'allow_fork_apply',
+  'retry',
+  'concurrency',
+  'compare_plans',
+  'plan_cache',
+  'plan_summary',
+  'infracost',
+  'status_context_prefix',
+  'status_context',
+  'status_description',
+  'merge_after_apply',
+  'redaction',
+  'debug',
+  'plugin_cache',
+  'reactions',
+  'config_repo',
+  'enforce',
+];
+
+/**
+ * Top-level fields a central configuration cannot enforce
+ */
+const UNENFORCEABLE_FIELDS = ['projects', 'config_repo', 'enforce'];
+
+/**
+ * Lists the fields of an object that are not known, with the field each one most likely meant
+ *
+ * @param value - Raw object
+ * @param known - Fields the object may set
+ * @param prefix - Path of the object, prepended to the field names (e.g., autoplan.)
+ * @returns One description per unknown field
+ *
+ * @example
+ * findUnknownFields({ aply_requirements: [] }, PROJECT_FIELDS)
+ * // => ['aply_requirements (did you mean apply_requirements?)']
+ */
+function findUnknownFields(value: Record<string, unknown>, known: string[], prefix = ''): string[] {
+  return Object.keys(value)
+    .filter((field) => !known.includes(field))
+    .map((field) => {
+      const suggestion = suggestClosest(field, known);
+      return `${prefix}${field}` + (suggestion ? ` (did you mean ${prefix}${suggestion}?)` : '');
+    });
+}
+
+/**
+ * Matches a terraform workspace name
+ */
+export const WORKSPACE_PATTERN = /^[A-Za-z0-9][A-Za-z0-9_.-]*$/;
+
+/**
+ * Validates a single project configuration
+ *
+ * @returns The validated project, or undefined if it cannot be identified
+ */
+function validateProject(
+  project: unknown,
+  index: number,
+  errors: string[]
+): ProjectConfig | undefined {
+  if (!project || typeof project !== 'object') {
+    errors.push(`Project at index ${index} must be an object`);
+    return undefined;
+  }
+
+  const p = project as Record<string, unknown>;
+
+  // Validate name
+  const hasName = typeof p.name === 'string' && p.name.trim() !== '';
+  if (!hasName) {
+    errors.push(`Project at index ${index} must have a non-empty 'name' field`);
+  }
+  const label = hasName ? `Project ${p.name}` : `Project at index ${index}`;
+
+  // Validate dir
+  const hasDir = typeof p.dir === 'string' && p.dir.trim() !== '';
+  if (!hasDir) {
+    errors.push(`${label} must have a non-empty 'dir' field`);
+  } else if (!isRelativeInside(p.dir as string)) {
+    errors.push(`${label}: dir must be a relative path inside the repository (got ${p.dir})`);
+  }
+
+  const validated: ProjectConfig = {
+    name: hasName ? (p.name as string) : '',
+    dir: hasDir ? (p.dir as string) : '',
+  };
+
+  for (const field of findUnknownFields(p, PROJECT_FIELDS)) {
+    errors.push(`${label}: unknown field ${field}`);
+  }
+
+  // Validate autoplan if present
+  if (p.autoplan !== undefined) {
+    if (typeof p.autoplan !== 'object' || p.autoplan === null) {
+      errors.push(`${label}: autoplan must be an object`);
+    } else {
+      const autoplan = p.autoplan as Record<string, unknown>;
+      const autoplanErrors = errors.length;
+
+      for (const field of findUnknownFields(autoplan, AUTOPLAN_FIELDS, 'autoplan.')) {
+        errors.push(`${label}: unknown field ${field}`);
+      }
+
+      if (typeof autoplan.enabled !== 'boolean') {
+        errors.push(`${label}: autoplan.enabled must be a boolean`);
+      }
+
+      if (!Array.isArray(autoplan.when_modified)) {
+        errors.push(`${label}: autoplan.when_modified must be an array`);
+      } else if (!autoplan.when_modified.every((item) => typeof item === 'string')) {
+        errors.push(`${label}: autoplan.when_modified must contain only strings`);
+      } else if (autoplan.when_modified.some((item) => item.replace(/^!/, '').trim() === '')) {
+        errors.push(`${label}: autoplan.when_modified must not contain empty patterns`);
+      }
+
+      if (errors.length === autoplanErrors) {
+        validated.autoplan = {
+          enabled: autoplan.enabled as boolean,
+          when_modified: autoplan.when_modified as string[],
+        };
+      }
+    }
+  }
+
+  // Validate plan_requirements if present
+  if (p.plan_requirements !== undefined) {
+    validated.plan_requirements = validateRequirements(
+      p.plan_requirements,
+      `${label}: plan_requirements`,
+      errors
+    );
+  }
+
+  // Validate apply_requirements if present
+  if (p.apply_requirements !== undefined) {
+    validated.apply_requirements = validateRequirements(
+      p.apply_requirements,
+      `${label}: apply_requirements`,
+      errors
+    );
+  }
+
+  const applyOnMerge = validateBoolean(p.apply_on_merge, `${label}: apply_on_merge`, errors);
+  if (applyOnMerge !== undefined) {
+    validated.apply_on_merge = applyOnMerge;
+  }
+
+  const requirePlan = validateBoolean(p.require_plan, `${label}: require_plan`, errors);
+  if (requirePlan !== undefined) {
+    validated.require_plan = requirePlan;
+  }
+
+  // Validate state_requirements if present
+  if (p.state_requirements !== undefined) {
+    validated.state_requirements = validateRequirements(
+      p.state_requirements,
+      `${label}: state_requirements`,
+      errors
+    );
+  }
+
+  // Validate import_requirements if present
+  if (p.import_requirements !== undefined) {
+    validated.import_requirements = validateRequirements(
+      p.import_requirements,
+      `${label}: import_requirements`,
+      errors
+    );
+  }
+
+  // Validate destroy_requirements if present
+  if (p.destroy_requirements !== undefined) {
+    validated.destroy_requirements = validateRequirements(
+      p.destroy_requirements,
+      `${label}: destroy_requirements`,
+      errors
+    );
+  }
+
+  // Validate terragrunt settings if present
+  const terragrunt = validateBoolean(p.terragrunt, `${label}: terragrunt`, errors);
+  if (terragrunt !== undefined) {
+    validated.terragrunt = terragrunt;
+  }
+
+  const terragruntRunAll = validateBoolean(
+    p.terragrunt_run_all,
+    `${label}: terragrunt_run_all`,
+    errors
+  );
+  if (terragruntRunAll !== undefined) {
+    // run-all implies terragrunt, which may also be detected from a terragrunt.hcl
+    if (terragruntRunAll && validated.terragrunt === false) {
+      errors.push(`${label}: terragrunt_run_all cannot be used with terragrunt: false`);
+    }
+    // run-all saves no plan, and a merge only applies saved plans
+    if (terragruntRunAll && validated.apply_on_merge === true) {
+      errors.push(`${label}: apply_on_merge is not supported with terragrunt_run_all`);
+    }
+    if (terragruntRunAll && validated.require_plan === true) {
+      errors.push(`${label}: require_plan is not supported with terragrunt_run_all`);
+    }
+    validated.terragrunt_run_all = terragruntRunAll;
+  }
+
+  const runAllApply = validateBoolean(
+    p.terragrunt_run_all_apply,
+    `${label}: terragrunt_run_all_apply`,
+    errors
+  );
+  if (runAllApply !== undefined) {
+    if (runAllApply && validated.terragrunt_run_all !== true) {
+      errors.push(`${label}: terragrunt_run_all_apply has no effect without terragrunt_run_all`);
+    }
+    validated.terragrunt_run_all_apply = runAllApply;
+  }
+
+  if (p.binary !== undefined) {
+    if (!TERRAFORM_BINARIES.includes(p.binary as TerraformBinary)) {
+      errors.push(
+        `${label}: binary must be one of: ${TERRAFORM_BINARIES.join(', ')} (got ${p.binary})`
+      );
+    } else {
+      validated.binary = p.binary as TerraformBinary;
+    }
+  }
+
+  if (p.terraform_version !== undefined) {
+    const version = p.terraform_version;
+    if (typeof version !== 'string' || !EXACT_VERSION_PATTERN.test(version)) {
+      errors.push(
+        `${label}: terraform_version must be an exact version such as 1.7.0 (got ${version})`
+      );
+    } else {
+      validated.terraform_version = version;
+    }
+  }
+
+  const refresh = validateBoolean(p.refresh, `${label}: refresh`, errors);
+  if (refresh !== undefined) {
+    validated.refresh = refresh;
+  }
+
+  if (p.lock_timeout !== undefined) {
+    if (typeof p.lock_timeout !== 'string' || !isValidDuration(p.lock_timeout)) {
+      errors.push(
+        `${label}: lock_timeout must be a duration such as 30s, 5m or 1h (got ${p.lock_timeout})`
+      );
+    } else {
+      validated.lock_timeout = p.lock_timeout;
+    }
+  }
+
+  const planTimeout = validateTimeout(p.plan_timeout, `${label}: plan_timeout`, errors);
+  if (planTimeout !== undefined) {
+    validated.plan_timeout = planTimeout;
+  }
+  const applyTimeout = validateTimeout(p.apply_timeout, `${label}: apply_timeout`, errors);
+  if (applyTimeout !== undefined) {
+    validated.apply_timeout = applyTimeout;
+  }
+
+  const autoUnlock = validateBoolean(
+    p.auto_unlock_on_failure,
+    `${label}: auto_unlock_on_failure`,
+    errors
+  );
+  if (autoUnlock !== undefined) {
+    // run-all spans several states, so there is no single lock to release
+    if (autoUnlock && validated.terragrunt_run_all === true) {
+      errors.push(`${label}: auto_unlock_on_failure is not supported with terragrunt_run_all`);
+    }
+    validated.auto_unlock_on_failure = autoUnlock;
+  }
+
+  const initUpgrade = validateBoolean(p.init_upgrade, `${label}: init_upgrade`, errors);
+  if (initUpgrade !== undefined) {
+    validated.init_upgrade = initUpgrade;
+  }
+
+  const initBackend = validateBoolean(p.init_backend, `${label}: init_backend`, errors);
+  if (initBackend !== undefined) {
+    validated.init_backend = initBackend;
+  }
+  if (p.backend_config !== undefined) {
+    validated.backend_config = validateVars(
+      p.backend_config,
+      `${label}: backend_config`,
+      BACKEND_CONFIG_KEY_PATTERN,
+      errors
+    );
+  }
+  if (p.backend_config_files !== undefined) {
+    validated.backend_config_files = validateProjectFiles(
+      p.backend_config_files,
+      validated.dir,
+      `${label}: backend_config_files`,
+      errors
+    );
+  }
+  if (
+    initBackend === false &&
+    (p.backend_config !== undefined || p.backend_config_files !== undefined)
+  ) {
+    errors.push(`${label}: backend_config cannot be used with init_backend: false`);
+  }
+  if (p.init_extra_args !== undefined) {
+    if (
+      !Array.isArray(p.init_extra_args) ||
+      !p.init_extra_args.every((arg) => typeof arg === 'string' && /^-\S/.test(arg))
+    ) {
+      errors.push(`${label}: init_extra_args must be an array of flags such as -lockfile=readonly`);
+    } else {
+      validated.init_extra_args = p.init_extra_args as string[];
+    }
+  }
+
+  if (p.workspace !== undefined) {
+    if (typeof p.workspace !== 'string' || !WORKSPACE_PATTERN.test(p.workspace)) {
+      errors.push(
+        `${label}: workspace must be a name of letters, digits, '-', '_' and '.' (got ${p.workspace})`
+      );
+    } else if (validated.terragrunt_run_all === true) {
+      // Each module of a run-all tree has its own workspaces
+      errors.push(`${label}: workspace is not supported with terragrunt_run_all`);
+    } else {
+      validated.workspace = p.workspace;
+    }
+  }
+
+  // Whether the workflow exists is checked once all workflows are validated
+  if (p.workflow !== undefined) {
+    if (typeof p.workflow !== 'string' || p.workflow.trim() === '') {
+      errors.push(`${label}: workflow must be a non-empty string`);
+    } else {
+      validated.workflow = p.workflow;
+    }
+  }
+
+  if (p.execution_order_group !== undefined) {
+    const group = p.execution_order_group;
+    if (!Number.isInteger(group) || (group as number) < 0) {
+      errors.push(`${label}: execution_order_group must be a non-negative integer (got ${group})`);
+    } else {
+      validated.execution_order_group = group as number;
+    }
+  }
+
+  if (p.concurrency_group !== undefined) {
+    if (typeof p.concurrency_group !== 'string' || p.concurrency_group.trim() === '') {
+      errors.push(`${label}: concurrency_group must be a non-empty string`);
+    } else {
+      validated.concurrency_group = p.concurrency_group;
+    }
+  }
+
+  // Whether the projects exist is checked once all projects are validated
+  if (p.depends_on !== undefined) {
+    if (
+      !Array.isArray(p.depends_on) ||
+      p.depends_on.length === 0 ||
+      !p.depends_on.every((name) => typeof name === 'string' && name.trim() !== '')
+    ) {
+      errors.push(`${label}: depends_on must be a non-empty list of project names`);
+    } else {
+      validated.depends_on = p.depends_on as string[];
+    }
+  }
+
+  // Each overrides the top-level setting of the same name for this project
+  const projectParallelPlan = validateBoolean(p.parallel_plan, `${label}: parallel_plan`, errors);
+  if (projectParallelPlan !== undefined) {
+    validated.parallel_plan = projectParallelPlan;
+  }
+  const projectParallelApply = validateBoolean(
+    p.parallel_apply,
+    `${label}: parallel_apply`,
+    errors
+  );
+  if (projectParallelApply !== undefined) {
+    validated.parallel_apply = projectParallelApply;
+  }
+  const projectAbort = validateBoolean(
+    p.abort_on_execution_order_fail,
+    `${label}: abort_on_execution_order_fail`,
+    errors
+  );
+  if (projectAbort !== undefined) {
+    validated.abort_on_execution_order_fail = projectAbort;
+  }
+
+  // Whether the policy sets exist is checked once the policies are validated
+  if (p.policy_sets !== undefined) {
+    if (
+      !Array.isArray(p.policy_sets) ||
+      p.policy_sets.length === 0 ||
+      !p.policy_sets.every((name) => typeof name === 'string' && name.trim() !== '')
+    ) {
+      errors.push(`${label}: policy_sets must be a non-empty list of policy set names`);
+    } else {
+      validated.policy_sets = p.policy_sets as string[];
+    }
+  }
+
+  if (p.security_scan !== undefined) {
+    const scan = validateSecurityScan(p.security_scan, label, errors);
+    if (scan?.target === 'plan' && validated.terragrunt_run_all === true) {
+      errors.push(`${label}: security_scan.target plan is not supported with terragrunt_run_all`);
+    } else if (scan) {
+      validated.security_scan = scan;
+    }
+  }
+
+  const enabled = validateBoolean(p.enabled, `${label}: enabled`, errors);
+  if (enabled !== undefined) {
+    validated.enabled = enabled;
+  }
+
+  if (p.tags !== undefined) {
+    validated.tags = validateTags(p.tags, `${label}: tags`, errors);
+  }
+
+  if (p.terraform_var_files !== undefined) {
+    validated.terraform_var_files = validateProjectFiles(
+      p.terraform_var_files,
+      validated.dir,
+      `${label}: terraform_var_files`,
+      errors
+    );
+  }
+  if (p.terraform_vars !== undefined) {
+    validated.terraform_vars = validateVars(
+      p.terraform_vars,
+      `${label}: terraform_vars`,
+      TERRAFORM_VAR_PATTERN,
+      errors
+    );
+  }
+  if (p.env !== undefined) {
+    validated.env = validateEnv(p.env, `${label}: env`, errors);
+  }
+
+  // Validate label requirements if present
+  if (p.required_labels !== undefined) {
+    validated.required_labels = validateLabels(
+      p.required_labels,
+      `${label}: required_labels`,
+      errors
+    );
+  }
+  if (p.forbidden_labels !== undefined) {
+    validated.forbidden_labels = validateLabels(
+      p.forbidden_labels,
+      `${label}: forbidden_labels`,
+      errors
+    );
+  }
+
+  // Validate branch filters if present
+  if (p.branch !== undefined) {
+    validated.branch = validatePattern(p.branch, `${label}: branch`, errors);
+  }
+  if (p.base_branch !== undefined) {
+    validated.base_branch = validatePattern(p.base_branch, `${label}: base_branch`, errors);
+  }
+
+  return hasName ? validated : undefined;
+}
+
+/**
+ * Validates the depends_on references between projects
+ *
+ * @remarks
+ * A dependency must be another project that does not run in a later execution
+ * order group, and dependencies must not form a cycle.
+ */
+function validateDependencies(projects: ProjectConfig[], errors: string[]): void {
+  const byName = new Map(projects.map((p) => [p.name, p]));
+  const errorCount = errors.length;
+
+  for (const project of projects) {
+    const group = project.execution_order_group ?? 0;
+    for (const name of project.depends_on ?? []) {
+      const dependency = byName.get(name);
+      if (name === project.name) {
+        errors.push(`Project ${project.name}: depends_on cannot name the project itself`);
+      } else if (!dependency) {
+        errors.push(`Project ${project.name}: depends_on '${name}' is not a project`);
+      } else if ((dependency.execution_order_group ?? 0) > group) {
+        errors.push(
+          `Project ${project.name}: depends_on '${name}', which runs in a later execution_order_group`
+        );
+      }
+    }
+  }
+
+  // Cycles are only looked for between existing projects
+  if (errors.length > errorCount) {
+    return;
+  }
+
+  // Depth-first search; a project reached again while still on the path closes a cycle
+  const finished = new Set<string>();
+  const trail: string[] = [];
+  const visit = (name: string): string[] | undefined => {
+    if (finished.has(name)) {
+      return undefined;
+    }
+    const start = trail.indexOf(name);
+    if (start !== -1) {
+      return [...trail.slice(start), name];
+    }
+    trail.push(name);
+    for (const dependency of byName.get(name)?.depends_on ?? []) {
+      const cycle = visit(dependency);
+      if (cycle) {
+        return cycle;
+      }
+    }
+    trail.pop();
+    finished.add(name);
+    return undefined;
+  };
+
+  for (const project of projects) {
+    const cycle = visit(project.name);
+    if (cycle) {
+      errors.push(`Dependency cycle between projects: ${cycle.join(' -> ')}`);
+      return;
+    }
+  }
+}
+
+/**
+ * Fields of the comment_templates block
+ */
+const COMMENT_TEMPLATE_FIELDS = ['header', 'footer', 'plan', 'apply'] as const;
+
+/**
+ * Validates the comment templates
+ *
+ * @returns The validated templates, or undefined if invalid
+ *
+ * @remarks
+ * Templates are Go templates rendered by tfcmt, so their syntax is only checked when
+ * tfcmt renders a comment.
+ */
+function validateCommentTemplates(
+  templates: unknown,
+  errors: string[]
+): CommentTemplatesConfig | undefined {
+  if (!templates || typeof templates !== 'object' || Array.isArray(templates)) {
+    errors.push('comment_templates must be an object');
+    return undefined;
+  }
+
+  const t = templates as Record<string, unknown>;
+  const validated: CommentTemplatesConfig = {};
+  const errorCount = errors.length;
+
+  for (const field of findUnknownFields(t, [...COMMENT_TEMPLATE_FIELDS], 'comment_templates.')) {
+    errors.push(`Unknown field ${field}`);
+  }
+  for (const field of COMMENT_TEMPLATE_FIELDS) {
+    const value = t[field];
+    if (value === undefined) {
+      continue;
+    }
+    if (typeof value !== 'string' || value.trim() === '') {
+      errors.push(`comment_templates.${field} must be a non-empty string`);
+    } else {
+      validated[field] = value;
+    }
+  }
+
+  return errors.length === errorCount ? validated : undefined;
+}
+
+/**
+ * Fields the security scan of a project may set
+ */
+const SECURITY_SCAN_FIELDS = ['tool', 'target', 'block_on'];
+
+/**
+ * Validates the security scan of a project
+ *
+ * @returns The validated scan settings, or undefined if invalid
+ */
+function validateSecurityScan(
+  scan: unknown,
+  label: string,
+  errors: string[]
+): SecurityScanConfig | undefined {
+  if (!isPlainObject(scan)) {
+    errors.push(`${label}: security_scan must be an object`);
+    return undefined;
+  }
+
+  const errorCount = errors.length;
+  for (const field of findUnknownFields(scan, SECURITY_SCAN_FIELDS, 'security_scan.')) {
+    errors.push(`${label}: unknown field ${field}`);
+  }
+
+  const { tool, target, block_on: blockOn } = scan;
+  if (!SECURITY_SCANNERS.includes(tool as SecurityScanner)) {
+    errors.push(`${label}: security_scan.tool must be one of: ${SECURITY_SCANNERS.join(', ')}`);
+  }
+  if (target !== undefined && target !== 'dir' && target !== 'plan') {
+    errors.push(`${label}: security_scan.target must be dir or plan`);
+  } else if (target === 'plan' && tool === 'tfsec') {
+    errors.push(`${label}: tfsec cannot scan plans, use security_scan.target dir`);
+  }
+  const blockingSeverities = SECURITY_SEVERITIES.filter((severity) => severity !== 'UNKNOWN');
+  if (blockOn !== undefined && !blockingSeverities.includes(blockOn as SecuritySeverity)) {
+    errors.push(
+      `${label}: security_scan.block_on must be one of: ${blockingSeverities.join(', ')}`
+    );
+  }
+
+  if (errors.length > errorCount) {
+    return undefined;
+  }
+  const validated: SecurityScanConfig = { tool: tool as SecurityScanner };
+  if (target !== undefined) {
+    validated.target = target as 'dir' | 'plan';
+  }
+  if (blockOn !== undefined) {
+    validated.block_on = blockOn as SecuritySeverity;
+  }
+  return validated;
+}
+
+/**
+ * Validates the retry configuration
+ *
+ * @returns The validated retry configuration, or undefined if invalid
+ */
+function validateRetry(retry: unknown, errors: string[]): RetryConfig | undefined {
+  if (!retry || typeof retry !== 'object' || Array.isArray(retry)) {
+    errors.push('retry must be an object');
+    return undefined;
+  }
+
+  const r = retry as Record<string, unknown>;
+  const validated: RetryConfig = {};
+  const errorCount = errors.length;
+
+  if (r.max_retries !== undefined) {
+    const value = r.max_retries;
+    if (!Number.isInteger(value) || (value as number) < 1 || (value as number) > 10) {
+      errors.push(`retry.max_retries must be an integer from 1 to 10 (got ${value})`);
+    } else {
+      validated.max_retries = value as number;
+    }
+  }
+
+  if (r.backoff !== undefined) {
+    if (typeof r.backoff !== 'string' || !isValidDuration(r.backoff)) {
+      errors.push('retry.backoff must be a duration such as 10s or 1m');
+    } else {
+      validated.backoff = r.backoff;
+    }
+  }
+
+  if (r.patterns !== undefined) {
+    if (!Array.isArray(r.patterns) || r.patterns.length === 0) {
+      errors.push('retry.patterns must be a non-empty list of regular expressions');
+    } else {
+      for (const pattern of r.patterns) {
+        validatePattern(pattern, 'retry.patterns entry', errors);
+      }
+      validated.patterns = r.patterns as string[];
+    }
+  }
+
+  return errors.length === errorCount ? validated : undefined;
+}
+
+/**
+ * Fields the concurrency settings may set
+ */
+const CONCURRENCY_FIELDS = ['commands', 'timeout'];
+
+/**
+ * Validates the concurrency configuration
+ *
+ * @returns The validated concurrency configuration, or undefined if invalid
+ */
+function validateConcurrency(
+  concurrency: unknown,
+  errors: string[]
+): ConcurrencyConfig | undefined {
+  if (!isPlainObject(concurrency)) {
+    errors.push('concurrency must be an object');
+    return undefined;
+  }
+
+  const validated: ConcurrencyConfig = {};
+  const errorCount = errors.length;
+
+  for (const field of findUnknownFields(concurrency, CONCURRENCY_FIELDS, 'concurrency.')) {
+    errors.push(`Unknown field ${field}`);
+  }
+
+  if (concurrency.commands !== undefined) {
+    const commands = concurrency.commands;
+    if (
+      !Array.isArray(commands) ||
+      commands.length === 0 ||
+      !commands.every((command) => LOCKABLE_COMMANDS.includes(command))
+    ) {
+      errors.push(
+        `concurrency.commands must be a non-empty list of: ${LOCKABLE_COMMANDS.join(', ')}`
+      );
+    } else {
+      validated.commands = commands as LockedCommand[];
+    }
+  }
+
+  const timeout = validateTimeout(concurrency.timeout, 'concurrency.timeout', errors);
+  if (timeout !== undefined) {
+    validated.timeout = timeout;
+  }
+
+  return errors.length === errorCount ? validated : undefined;
+}
+
+/**
+ * Matches a GitHub login (e.g., octocat)
+ */
+const GITHUB_LOGIN_PATTERN = /^[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?$/;
+
+/**
+ * Validates the policy check configuration
+ *
+ * @returns The validated policies, or undefined if invalid
+ */
+function validatePolicies(policies: unknown, errors: string[]): PoliciesConfig | undefined {
+  if (!isPlainObject(policies)) {
+    errors.push('policies must be an object');
+    return undefined;
+  }
+
+  const errorCount = errors.length;
+  const { owners, policy_sets: policySets } = policies;
+
+  if (
+    !Array.isArray(owners) ||
+    owners.length === 0 ||
+    !owners.every((owner) => typeof owner === 'string' && GITHUB_LOGIN_PATTERN.test(owner))
+  ) {
+    errors.push('policies.owners must be a non-empty list of GitHub logins');
+  }
+
+  if (!Array.isArray(policySets) || policySets.length === 0) {
+    errors.push('policies.policy_sets must be a non-empty list');
+    return undefined;
+  }
+
+  const names = new Set<string>();
+  policySets.forEach((set, index) => {
+    const fieldName = `policies.policy_sets[${index}]`;
+    if (!isPlainObject(set)) {
+      errors.push(`${fieldName} must be an object`);
+      return;
+    }
+    if (typeof set.name !== 'string' || set.name.trim() === '') {
+      errors.push(`${fieldName}: name must be a non-empty string`);
+    } else if (names.has(set.name)) {
+      errors.push(`${fieldName}: duplicate policy set name ${set.name}`);
+    } else {
+      names.add(set.name);
+    }
+    if (typeof set.path !== 'string' || set.path.trim() === '' || !isRelativeInside(set.path)) {
+      errors.push(`${fieldName}: path must be a relative path inside the repository`);
+    }
+  });
+
+  if (errors.length > errorCount) {
+    return undefined;
+  }
+  const sets = policySets as PolicySetConfig[];
+  return {
+    owners: owners as string[],
+    policy_sets: sets.map((set) => ({ name: set.name, path: set.path })),
+  };
+}
+
+/**
+ * Commands that can be restricted under authorization
+ *
+ * @remarks
+ * Kept here rather than imported from comment-parser, which imports this module.
+ */
+const AUTHORIZED_COMMANDS: AuthorizedCommand[] = [
+  'plan',
+  'apply',
+  'destroy',
+  'init',
+  'drift',
+  'state',
+  'import',
+  'show',
+  'approve_policies',
+  'apply_all',
+];
+
+/**
+ * Repository permissions from lowest to highest
+ */
+export const REPOSITORY_PERMISSIONS: RepositoryPermission[] = [
+  'read',
+  'triage',
+  'write',
+  'maintain',
+  'admin',
+];
+
+/**
+ * Matches a team written as org/team-slug (e.g., acme/platform)
+ */
+const TEAM_PATTERN = /^[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?\/[A-Za-z0-9][A-Za-z0-9_.-]*$/;
+
+/**
+ * Validates who may run each command
+ *
+ * @returns The validated rules by command, or undefined if invalid
+ */
+function validateAuthorization(
+  authorization: unknown,
+  errors: string[]
+): Partial<Record<AuthorizedCommand, CommandAuthorization>> | undefined {
+  if (!isPlainObject(authorization)) {
+    errors.push('authorization must be an object');
+    return undefined;
+  }
+
+  const errorCount = errors.length;
+  const validated: Partial<Record<AuthorizedCommand, CommandAuthorization>> = {};
+
+  for (const [command, rule] of Object.entries(authorization)) {
+    const fieldName = `authorization.${command}`;
+    if (!AUTHORIZED_COMMANDS.includes(command as AuthorizedCommand)) {
+      errors.push(
+        `authorization: unknown command ${command} (must be one of: ${AUTHORIZED_COMMANDS.join(', ')})`
+      );
+      continue;
+    }
+    if (!isPlainObject(rule)) {
+      errors.push(`${fieldName} must be an object`);
+      continue;
+    }
+
+    const { users, teams, permission } = rule;
+    if (
+      users !== undefined &&
+      (!Array.isArray(users) ||
+        !users.every((user) => typeof user === 'string' && GITHUB_LOGIN_PATTERN.test(user)))
+    ) {
+      errors.push(`${fieldName}.users must be a list of GitHub logins`);
+    }
+    if (
+      teams !== undefined &&
+      (!Array.isArray(teams) ||
+        !teams.every((team) => typeof team === 'string' && TEAM_PATTERN.test(team)))
+    ) {
+      errors.push(`${fieldName}.teams must be a list of teams written as org/team-slug`);
+    }
+    if (
+      permission !== undefined &&
+      !REPOSITORY_PERMISSIONS.includes(permission as RepositoryPermission)
+    ) {
+      errors.push(
+        `Invalid ${fieldName}.permission: ${permission}. Must be one of: ${REPOSITORY_PERMISSIONS.join(', ')}`
+      );
+    }
+
+    const validatedRule: CommandAuthorization = {};
+    if (users !== undefined) {
+      validatedRule.users = users as string[];
+    }
+    if (teams !== undefined) {
+      validatedRule.teams = teams as string[];
+    }
+    if (permission !== undefined) {
+      validatedRule.permission = permission as RepositoryPermission;
+    }
+    validated[command as AuthorizedCommand] = validatedRule;
+  }
+
+  return errors.length === errorCount ? validated : undefined;
+}
+
+/**
+ * Validates the custom workflows
+ *
+ * @returns The validated workflows by name, or undefined if invalid
+ */
+function validateWorkflows(
+  workflows: unknown,
+  errors: string[]
+): Record<string, WorkflowConfig> | undefined {
+  if (!workflows || typeof workflows !== 'object' || Array.isArray(workflows)) {
+    errors.push('workflows must be an object');
+    return undefined;
+  }
+
+  const validated: Record<string, WorkflowConfig> = {};
+  const errorCount = errors.length;
+
+  for (const [name, workflow] of Object.entries(workflows)) {
+    const label = `workflows.${name}`;
+    if (!workflow || typeof workflow !== 'object' || Array.isArray(workflow)) {
+      errors.push(`${label} must be an object`);
+      continue;
+    }
+
+    const w = workflow as Record<string, unknown>;
+    for (const key of Object.keys(w)) {
+      if (key !== 'plan' && key !== 'apply') {
+        errors.push(`${label}: unknown command ${key} (must be plan or apply)`);
+      }
+    }
+
+    const stages: WorkflowConfig = {};
+    for (const command of ['plan', 'apply'] as const) {
+      if (w[command] !== undefined) {
+        const steps = validateWorkflowSteps(w[command], command, `${label}.${command}`, errors);
+        if (steps) {
+          stages[command] = { steps };
+        }
+      }
+    }
+    validated[name] = stages;
+  }
+
+  return errors.length === errorCount ? validated : undefined;
+}
+
+/**
+ * Validates the steps a workflow runs for one command
+ *
+ * @param stage - Raw stage, an object with a steps list
+ * @param command - Command the stage runs for
+ * @param label - Field name used in error messages (e.g., workflows.custom.plan)
+ * @param errors - Collected validation errors
+ * @returns The validated steps, or undefined if the stage is not an object with a steps list
+ */
+function validateWorkflowSteps(
+  stage: unknown,
+  command: TerraformCommand,
+  label: string,
+  errors: string[]
+): WorkflowStep[] | undefined {
+  const steps = isPlainObject(stage) ? stage.steps : undefined;
+  if (!Array.isArray(steps) || steps.length === 0) {
+    errors.push(`${label}.steps must be a non-empty list`);
+    return undefined;
+  }
+
+  const validated: WorkflowStep[] = [];
+  steps.forEach((step, index) => {
+    const stepLabel = `${label}.steps[${index}]`;
+    if (step === 'init' || step === command) {
+      validated.push(step);
+      return;
+    }
+    if (!step || typeof step !== 'object' || Array.isArray(step)) {
+      errors.push(`${stepLabel}: unknown step ${step} (must be init, ${command} or run)`);
+      return;
+    }
+
+    const s = step as Record<string, unknown>;
+    if (typeof s.run !== 'string' || s.run.trim() === '') {
+      errors.push(`${stepLabel}: run must be a non-empty string`);
+      return;
+    }
+    const runStep: RunStep = { run: s.run };
+    if (s.env !== undefined) {
+      if (
+        !s.env ||
+        typeof s.env !== 'object' ||
+        Array.isArray(s.env) ||
+        Object.values(s.env).some((value) => typeof value !== 'string')
+      ) {
+        errors.push(`${stepLabel}: env must map variable names to strings`);
+        return;
+      }
+      runStep.env = s.env as Record<string, string>;
+    }
+    validated.push(runStep);
+  });
+
+  // The step's result is what gets reported, saved and applied
+  if (validated.filter((step) => step === command).length !== 1) {
+    errors.push(`${label}.steps must include the ${command} step exactly once`);
+  }
+
+  return validated;
+}
+
+/**
+ * Validates the notifications configuration
+ *
+ * @returns The validated notifications, or undefined if invalid
+ */
+function validateNotifications(
+  notifications: unknown,
+  errors: string[]
+): NotificationConfig | undefined {
+  if (!notifications || typeof notifications !== 'object' || Array.isArray(notifications)) {
+    errors.push('notifications must be an object');
+    return undefined;
+  }
+
+  const n = notifications as Record<string, unknown>;
+  const validated: NotificationConfig = {};
+  const errorCount = errors.length;
+
+  for (const field of ['webhook_url', 'webhook_url_env'] as const) {
+    if (n[field] !== undefined) {
+      if (typeof n[field] !== 'string' || n[field] === '') {
+        errors.push(`notifications.${field} must be a non-empty string`);
+      } else {
+        validated[field] = n[field] as string;
+      }
+    }
+  }
+
+  if (validated.webhook_url === undefined && validated.webhook_url_env === undefined) {
+    errors.push('notifications must set webhook_url or webhook_url_env');
+  }
+
+  if (n.format !== undefined) {
+    const validFormats: NotificationFormat[] = ['slack', 'json'];
+    if (!validFormats.includes(n.format as NotificationFormat)) {
+      errors.push(
+        `Invalid notifications.format: ${n.format}. Must be one of: ${validFormats.join(', ')}`
+      );
+    } else {
+      validated.format = n.format as NotificationFormat;
+    }
+  }
+
+  return errors.length === errorCount ? validated : undefined;
+}
+
+/**
+ * Validates the merge_after_apply settings
+ *
+ * @param merge - Raw merge_after_apply value
+ * @param errors - Collected validation errors
+ * @returns Validated settings, or undefined if invalid
+ */
+function validateMergeAfterApply(
+  merge: unknown,
+  errors: string[]
+): MergeAfterApplyConfig | undefined {
+  if (!merge || typeof merge !== 'object' || Array.isArray(merge)) {
+    errors.push('merge_after_apply must be an object');
+    return undefined;
+  }
+
+  const m = merge as Record<string, unknown>;
+  const validated: MergeAfterApplyConfig = {};
+  const errorCount = errors.length;
+
+  if (m.method !== undefined) {
+    const validMethods: MergeMethod[] = ['merge', 'squash', 'rebase'];
+    if (!validMethods.includes(m.method as MergeMethod)) {
+      errors.push(
+        `Invalid merge_after_apply.method: ${m.method}. Must be one of: ${validMethods.join(', ')}`
+      );
+    } else {
+      validated.method = m.method as MergeMethod;
+    }
+  }
+
+  const deleteBranch = validateBoolean(m.delete_branch, 'merge_after_apply.delete_branch', errors);
+  if (deleteBranch !== undefined) {
+    validated.delete_branch = deleteBranch;
+  }
+
+  return errors.length === errorCount ? validated : undefined;
+}
+
+/**
+ * Validates the infracost settings
+ *
+ * @param infracost - Raw infracost value
+ * @param errors - Collected validation errors
+ * @returns Validated settings, or undefined if invalid
+ */
+function validateInfracost(infracost: unknown, errors: string[]): InfracostConfig | undefined {
+  if (!isPlainObject(infracost)) {
+    errors.push('infracost must be an object');
+    return undefined;
+  }
+
+  const limit = infracost.max_monthly_increase;
+  if (limit === undefined) {
+    return {};
+  }
+  if (typeof limit !== 'number' || !Number.isFinite(limit) || limit < 0) {
+    errors.push(`infracost.max_monthly_increase must be a non-negative number (got ${limit})`);
+    return undefined;
+  }
+  return { max_monthly_increase: limit };
+}
+
+/**
+ * Fields the redaction settings may set
+ */
+const REDACTION_FIELDS = ['patterns', 'sensitive_values'];
+
+/**
+ * Validates the redaction configuration
+ *
+ * @returns The validated redaction settings, or undefined if invalid
+ *
+ * @remarks
+ * tfcmt masks the same patterns with Go's regexp package, so patterns should avoid
+ * lookarounds and backreferences, which only JavaScript supports.
+ */
+function validateRedaction(redaction: unknown, errors: string[]): RedactionConfig | undefined {
+  if (!isPlainObject(redaction)) {
+    errors.push('redaction must be an object');
+    return undefined;
+  }
+
+  const validated: RedactionConfig = {};
+  const errorCount = errors.length;
+
+  for (const field of findUnknownFields(redaction, REDACTION_FIELDS, 'redaction.')) {
+    errors.push(`Unknown field ${field}`);
+  }
+  if (redaction.patterns !== undefined) {
+    if (!Array.isArray(redaction.patterns) || redaction.patterns.length === 0) {
+      errors.push('redaction.patterns must be a non-empty list of regular expressions');
+    } else {
+      for (const pattern of redaction.patterns) {
+        validatePattern(pattern, 'redaction.patterns entry', errors);
+      }
+      validated.patterns = redaction.patterns as string[];
+    }
+  }
+  const sensitiveValues = validateBoolean(
+    redaction.sensitive_values,
+    'redaction.sensitive_values',
+    errors
+  );
+  if (sensitiveValues !== undefined) {
+    validated.sensitive_values = sensitiveValues;
+  }
+
+  return errors.length === errorCount ? validated : undefined;
+}
+
+/**
+ * Validates the configuration object
+ *
+ * @param config - Parsed configuration
+ * @returns Validated configuration
+ * @throws ConfigValidationError listing every problem found
+ */
+export function validateConfig(config: unknown): Config {
+  if (!config || typeof config !== 'object') {
+    throw new ConfigValidationError(['Configuration must be an object']);
+  }
+
+  const c = config as Record<string, unknown>;
+  const errors: string[] = [];
+
+  // Reported first so that a misspelled projects field explains the error below
+  for (const field of findUnknownFields(c, CONFIG_FIELDS)) {
+    errors.push(`Unknown top-level field ${field}`);
+  }
+
+  // Validate projects array
+  if (!Array.isArray(c.projects)) {
+    throw new ConfigValidationError([...errors, 'Configuration must have a "projects" array']);
+  }
+
+  if (c.projects.length === 0) {
+    throw new ConfigValidationError([...errors, 'Configuration must have at least one project']);
+  }
+
+  const projects: ProjectConfig[] = [];
+  c.projects.forEach((project, index) => {
+    const validated = validateProject(project, index, errors);
+    if (validated) {
+      projects.push(validated);
+    }
+  });
+
+  // Check for duplicate project names
+  const names = new Set<string>();
+  for (const project of projects) {
+    if (names.has(project.name)) {
+      errors.push(`Duplicate project name: ${project.name}`);
+    }
+    names.add(project.name);
+  }
+
+  validateDependencies(projects, errors);
+
+  const workflows =
+    c.workflows !== undefined ? validateWorkflows(c.workflows, errors) : undefined;
+  // References into an invalid workflows section are not reported again
+  if (c.workflows === undefined || workflows) {
+    const workflowNames = Object.keys(workflows ?? {});
+    for (const project of projects) {
+      if (project.workflow !== undefined && !workflowNames.includes(project.workflow)) {
+        errors.push(
+          `Project ${project.name}: workflow '${project.workflow}' not found in workflows`
+        );
+      }
+    }
+  }
+
+  const policies = c.policies !== undefined ? validatePolicies(c.policies, errors) : undefined;
+  const authorization =
+    c.authorization !== undefined ? validateAuthorization(c.authorization, errors) : undefined;
+  // References into an invalid policies section are not reported again
+  if (c.policies === undefined || policies) {
+    const policySetNames = (policies?.policy_sets ?? []).map((set) => set.name);
+    for (const project of projects) {
+      for (const name of project.policy_sets ?? []) {
+        if (!policySetNames.includes(name)) {
+          errors.push(
+            `Project ${project.name}: policy set '${name}' not found in policies.policy_sets`
+          );
+        }
+      }
+    }
+  }
+
+  const notifications =
+    c.notifications !== undefined ? validateNotifications(c.notifications, errors) : undefined;
+
+  const validOutputModes: OutputMode[] = ['comment', 'status', 'both'];
+  if (c.output_mode !== undefined && !validOutputModes.includes(c.output_mode as OutputMode)) {
+    errors.push(
+      `Invalid output_mode: ${c.output_mode}. Must be one of: ${validOutputModes.join(', ')}`
+    );
+  }
+
+  const validStatusApis: StatusApi[] = ['statuses', 'checks'];
+  if (c.status_api !== undefined && !validStatusApis.includes(c.status_api as StatusApi)) {
+    errors.push(
+      `Invalid status_api: ${c.status_api}. Must be one of: ${validStatusApis.join(', ')}`
+    );
+  }
+
+  const validNoChangesComments: NoChangesComment[] = ['full', 'concise', 'skip'];
+  if (
+    c.comment_on_no_changes !== undefined &&
+    !validNoChangesComments.includes(c.comment_on_no_changes as NoChangesComment)
+  ) {
+    errors.push(
+      `Invalid comment_on_no_changes: ${c.comment_on_no_changes}. Must be one of: ${validNoChangesComments.join(', ')}`
+    );
+  }
+
+  const validCommentModes: CommentMode[] = ['per_project', 'consolidated'];
+  if (c.comment_mode !== undefined && !validCommentModes.includes(c.comment_mode as CommentMode)) {
+    errors.push(
+      `Invalid comment_mode: ${c.comment_mode}. Must be one of: ${validCommentModes.join(', ')}`
+    );
+  }
+
+  const validPreviousPlanComments: PreviousPlanComments[] = ['keep', 'update', 'hide'];
+  if (
+    c.previous_plan_comments !== undefined &&
+    !validPreviousPlanComments.includes(c.previous_plan_comments as PreviousPlanComments)
+  ) {
+    errors.push(
+      `Invalid previous_plan_comments: ${c.previous_plan_comments}. Must be one of: ${validPreviousPlanComments.join(', ')}`
+    );
+  }
+
+  if (c.binary !== undefined && !TERRAFORM_BINARIES.includes(c.binary as TerraformBinary)) {
+    errors.push(`Invalid binary: ${c.binary}. Must be one of: ${TERRAFORM_BINARIES.join(', ')}`);
+  }
+
+  if (
+    c.terragrunt_version !== undefined &&
+    (typeof c.terragrunt_version !== 'string' || !EXACT_VERSION_PATTERN.test(c.terragrunt_version))
+  ) {
+    errors.push(
+      `terragrunt_version must be an exact version such as 0.55.1 (got ${c.terragrunt_version})`
+    );
+  }
+
+  const planTimeout = validateTimeout(c.plan_timeout, 'plan_timeout', errors);
+  const applyTimeout = validateTimeout(c.apply_timeout, 'apply_timeout', errors);
+
+  const requirePlan = validateBoolean(c.require_plan, 'require_plan', errors);
+  if (requirePlan) {
+    // run-all saves no plan, so such projects must opt out of the top-level setting
+    for (const project of projects) {
+      if (project.terragrunt_run_all && project.require_plan === undefined) {
+        errors.push(
+          `Project ${project.name}: require_plan is not supported with terragrunt_run_all (set require_plan: false)`
+        );
+      }
+    }
+  }
+
+  if (c.base_dir !== undefined && (typeof c.base_dir !== 'string' || c.base_dir.trim() === '')) {
+    errors.push('base_dir must be a non-empty string');
+  }
+
+  if (
+    c.max_projects_per_run !== undefined &&
+    !(Number.isInteger(c.max_projects_per_run) && (c.max_projects_per_run as number) > 0)
+  ) {
+    errors.push(`max_projects_per_run must be a positive integer (got ${c.max_projects_per_run})`);
+  }
+
+  const parallelPlan = validateBoolean(c.parallel_plan, 'parallel_plan', errors);
+  const parallelApply = validateBoolean(c.parallel_apply, 'parallel_apply', errors);
+  if (
+    c.parallel_pool_size !== undefined &&
+    !(Number.isInteger(c.parallel_pool_size) && (c.parallel_pool_size as number) > 0)
+  ) {
+    errors.push(`parallel_pool_size must be a positive integer (got ${c.parallel_pool_size})`);
+  }
+  const abortOnExecutionOrderFail = validateBoolean(
+    c.abort_on_execution_order_fail,
+    'abort_on_execution_order_fail',
+    errors
+  );
+
+  const commandPrefixes =
+    c.command_prefixes !== undefined
+      ? validateWordList(c.command_prefixes, 'command_prefixes', COMMAND_PREFIX_PATTERN, errors)
+      : undefined;
+  const projectFlags =
+    c.project_flags !== undefined
+      ? validateWordList(c.project_flags, 'project_flags', PROJECT_FLAG_PATTERN, errors)
+      : undefined;
+  for (const flag of projectFlags ?? []) {
+    if (RESERVED_COMMENT_FLAGS.includes(flag)) {
+      errors.push(`Invalid project_flags entry: ${flag} is already a comment flag`);
+    }
+  }
+
+  const allowForkApply = validateBoolean(c.allow_fork_apply, 'allow_fork_apply', errors);
+  const retry = c.retry !== undefined ? validateRetry(c.retry, errors) : undefined;
+  const concurrency =
+    c.concurrency !== undefined ? validateConcurrency(c.concurrency, errors) : undefined;
+  if (c.concurrency === undefined) {
+    for (const project of projects) {
+      if (project.concurrency_group !== undefined) {
+        errors.push(
+          `Project ${project.name}: concurrency_group has no effect without the top-level concurrency setting`
+        );
+      }
+    }
+  }
+  const commentTemplates =
+    c.comment_templates !== undefined
+      ? validateCommentTemplates(c.comment_templates, errors)
+      : undefined;
+  const invalidateOutdatedPlans = validateBoolean(
+    c.invalidate_outdated_plans,
+    'invalidate_outdated_plans',
+    errors
+  );
+  const comparePlans = validateBoolean(c.compare_plans, 'compare_plans', errors);
+  const planCache = validateBoolean(c.plan_cache, 'plan_cache', errors);
+  const planSummary = validateBoolean(c.plan_summary, 'plan_summary', errors);
+  const infracost = c.infracost !== undefined ? validateInfracost(c.infracost, errors) : undefined;
+  validateStatusSettings(c, projects, errors);
+  const mergeAfterApply =
+    c.merge_after_apply !== undefined
+      ? validateMergeAfterApply(c.merge_after_apply, errors)
+      : undefined;
+  const env = c.env !== undefined ? validateEnv(c.env, 'env', errors) : undefined;
+  const redaction = c.redaction !== undefined ? validateRedaction(c.redaction, errors) : undefined;
+  const debug = validateBoolean(c.debug, 'debug', errors);
+  const pluginCache = validateBoolean(c.plugin_cache, 'plugin_cache', errors);
+  const reactions = validateBoolean(c.reactions, 'reactions', errors);
+
+  if (
+    c.config_repo !== undefined &&
+    (typeof c.config_repo !== 'string' || !parseConfigRepo(c.config_repo))
+  ) {
+    errors.push(
+      `config_repo must be a repository such as acme/infra-config@main (got ${c.config_repo})`
+    );
+  }
+  const enforceable = CONFIG_FIELDS.filter((field) => !UNENFORCEABLE_FIELDS.includes(field));
+  if (
+    c.enforce !== undefined &&
+    (!Array.isArray(c.enforce) ||
+      !c.enforce.every((field) => typeof field === 'string' && enforceable.includes(field)))
+  ) {
+    errors.push(`enforce must list top-level fields other than ${UNENFORCEABLE_FIELDS.join(', ')}`);
+  }
+
+  if (errors.length > 0) {
+    throw new ConfigValidationError(errors);
+  }
+
+  const validated: Config = { projects };
+
+  if (workflows) {
+    validated.workflows = workflows;
+  }
+  if (policies) {
+    validated.policies = policies;
+  }
+  if (authorization) {
+    validated.authorization = authorization;
   }
-
-  const validRequirements: Requirement[] = ['mergeable', 'approved'];
-
-  for (const req of requirements) {
-    if (!validRequirements.includes(req as Requirement)) {
-      throw new Error(
-        `Invalid requirement in ${fieldName}: ${req}. Must be one of: ${validRequirements.join(', ')}`
-      );
+  if (c.binary !== undefined) {
+    validated.binary = c.binary as TerraformBinary;
+    // Projects without their own binary inherit the top-level one
+    for (const project of projects) {
+      if (project.binary === undefined) {
+        project.binary = validated.binary;
+      }
+    }
+  }
+  if (c.terragrunt_version !== undefined) {
+    validated.terragrunt_version = c.terragrunt_version as string;
+  }
+  if (planTimeout !== undefined) {
+    validated.plan_timeout = planTimeout;
+  }
+  if (applyTimeout !== undefined) {
+    validated.apply_timeout = applyTimeout;
+  }
+  // Projects without their own timeouts inherit the top-level ones
+  for (const project of projects) {
+    if (project.plan_timeout === undefined && planTimeout !== undefined) {
+      project.plan_timeout = planTimeout;
+    }
+    if (project.apply_timeout === undefined && applyTimeout !== undefined) {
+      project.apply_timeout = applyTimeout;
+    }
+  }
+  if (requirePlan !== undefined) {
+    validated.require_plan = requirePlan;
+    // Projects without their own require_plan inherit the top-level one
+    for (const project of projects) {
+      if (project.require_plan === undefined) {
+        project.require_plan = requirePlan;
+      }
+    }
+  }
+  if (env) {
+    validated.env = env;
+    // Project variables override the top-level ones of the same name
+    for (const project of projects) {
+      project.env = { ...env, ...project.env };
     }
   }
+  if (notifications) {
+    validated.notifications = notifications;
+  }
+  if (c.output_mode !== undefined) {
+    validated.output_mode = c.output_mode as OutputMode;
+  }
+  if (c.status_api !== undefined) {
+    validated.status_api = c.status_api as StatusApi;
+  }
+  if (c.comment_on_no_changes !== undefined) {
+    validated.comment_on_no_changes = c.comment_on_no_changes as NoChangesComment;
+  }
+  if (c.comment_mode !== undefined) {
+    validated.comment_mode = c.comment_mode as CommentMode;
+  }
+  if (c.previous_plan_comments !== undefined) {
+    validated.previous_plan_comments = c.previous_plan_comments as PreviousPlanComments;
+  }
+  if (commentTemplates) {
+    validated.comment_templates = commentTemplates;
+  }
+  if (c.base_dir !== undefined) {
+    validated.base_dir = c.base_dir as string;
+  }
+  if (c.max_projects_per_run !== undefined) {
+    validated.max_projects_per_run = c.max_projects_per_run as number;
+  }
+  if (parallelPlan !== undefined) {
+    validated.parallel_plan = parallelPlan;
+  }
+  if (parallelApply !== undefined) {
+    validated.parallel_apply = parallelApply;
+  }
+  if (c.parallel_pool_size !== undefined) {
+    validated.parallel_pool_size = c.parallel_pool_size as number;
+  }
+  if (abortOnExecutionOrderFail !== undefined) {
+    validated.abort_on_execution_order_fail = abortOnExecutionOrderFail;
+  }
+  if (commandPrefixes) {
+    validated.command_prefixes = commandPrefixes;
+  }
+  if (projectFlags) {
+    validated.project_flags = projectFlags;
+  }
+  if (allowForkApply !== undefined) {
+    validated.allow_fork_apply = allowForkApply;
+  }
+  if (retry) {
+    validated.retry = retry;
+  }
+  if (concurrency) {
+    validated.concurrency = concurrency;
+  }
+  if (invalidateOutdatedPlans !== undefined) {
+    validated.invalidate_outdated_plans = invalidateOutdatedPlans;
+  }
+  if (comparePlans !== undefined) {
+    validated.compare_plans = comparePlans;
+  }
+  if (planCache !== undefined) {
+    validated.plan_cache = planCache;
+  }
+  if (planSummary !== undefined) {
+    validated.plan_summary = planSummary;
+  }
+  if (infracost) {
+    validated.infracost = infracost;
+  }
+  if (c.status_context_prefix !== undefined) {
+    validated.status_context_prefix = c.status_context_prefix as string;
+  }
+  if (c.status_context !== undefined) {
+    validated.status_context = c.status_context as string;
+  }
+  if (c.status_description !== undefined) {
+    validated.status_description = c.status_description as string;
+  }
+  if (mergeAfterApply) {
+    validated.merge_after_apply = mergeAfterApply;
+  }
+  if (redaction) {
+    validated.redaction = redaction;
+  }
+  if (debug !== undefined) {
+    validated.debug = debug;
+  }
+  if (pluginCache !== undefined) {
+    validated.plugin_cache = pluginCache;
+  }
+  if (reactions !== undefined) {
+    validated.reactions = reactions;
+  }
+  if (c.config_repo !== undefined) {
+    validated.config_repo = c.config_repo as string;
+  }
+  if (c.enforce !== undefined) {
+    validated.enforce = c.enforce as string[];
+  }
 
-  return requirements as Requirement[];
+  return validated;
 }
 
 /**
- * Validates a single project configuration
+ * Commands a commit status can be set for, including the policy check and security scan of a plan
  */
-function validateProject(project: unknown, index: number): ProjectConfig {
-  if (!project || typeof project !== 'object') {
-    throw new Error(`Project at index ${index} must be an object`);
+const STATUS_COMMANDS = [
+  'plan',
+  'apply',
+  'init',
+  'drift',
+  'state',
+  'import',
+  'show',
+  POLICY_CHECK_STATUS_COMMAND,
+  SECURITY_SCAN_STATUS_COMMAND,
+];
+
+/**
+ * Validates the commit status settings
+ *
+ * @param c - Raw configuration
+ * @param projects - Validated projects, whose contexts must fit GitHub's length limit
+ * @param errors - Collected validation errors
+ */
+function validateStatusSettings(
+  c: Record<string, unknown>,
+  projects: ProjectConfig[],
+  errors: string[]
+): void {
+  const errorCount = errors.length;
+
+  const prefix = c.status_context_prefix;
+  if (prefix !== undefined && (typeof prefix !== 'string' || prefix.trim() === '')) {
+    errors.push('status_context_prefix must be a non-empty string');
   }
 
-  const p = project as Record<string, unknown>;
+  const context = c.status_context;
+  if (context !== undefined) {
+    if (typeof context !== 'string' || context.trim() === '') {
+      errors.push('status_context must be a non-empty string');
+    } else {
+      const unknown = findUnknownPlaceholders(context, STATUS_CONTEXT_PLACEHOLDERS);
+      if (unknown.length > 0) {
+        errors.push(
+          `status_context has unknown placeholders: ${unknown.map((name) => `{${name}}`).join(', ')}`
+        );
+      }
+      // Without both, commands or projects would overwrite each other's status
+      if (!context.includes('{command}') || !context.includes('{project}')) {
+        errors.push('status_context must contain {command} and {project}');
+      }
+    }
+  }
 
-  // Validate name
-  if (typeof p.name !== 'string' || p.name.trim() === '') {
-    throw new Error(`Project at index ${index} must have a non-empty 'name' field`);
+  const description = c.status_description;
+  if (description !== undefined) {
+    if (typeof description !== 'string' || description.trim() === '') {
+      errors.push('status_description must be a non-empty string');
+    } else {
+      const unknown = findUnknownPlaceholders(description, STATUS_DESCRIPTION_PLACEHOLDERS);
+      if (unknown.length > 0) {
+        errors.push(
+          `status_description has unknown placeholders: ${unknown.map((name) => `{${name}}`).join(', ')}`
+        );
+      }
+    }
   }
 
-  // Validate dir
-  if (typeof p.dir !== 'string' || p.dir.trim() === '') {
-    throw new Error(`Project ${p.name} must have a non-empty 'dir' field`);
+  if (errors.length > errorCount) {
+    return;
   }
 
-  const validated: ProjectConfig = {
-    name: p.name,
-    dir: p.dir,
+  const settings = {
+    status_context_prefix: prefix as string | undefined,
+    status_context: context as string | undefined,
   };
-
-  // Validate autoplan if present
-  if (p.autoplan !== undefined) {
-    if (typeof p.autoplan !== 'object' || p.autoplan === null) {
-      throw new Error(`Project ${p.name}: autoplan must be an object`);
+  for (const project of projects) {
+    const longest = STATUS_COMMANDS.map((command) =>
+      buildStatusContext(command, project.name, settings)
+    ).reduce((a, b) => (b.length > a.length ? b : a));
+    if (longest.length > MAX_STATUS_CONTEXT_LENGTH) {
+      errors.push(
+        `Project ${project.name}: commit status context is ${longest.length} characters, more than GitHub allows (${MAX_STATUS_CONTEXT_LENGTH}): ${longest}`
+      );
     }
+  }
+}
 
-    const autoplan = p.autoplan as Record<string, unknown>;
+/**
+ * A command prefix: a single word such as terraform, tf or tg
+ */
+const COMMAND_PREFIX_PATTERN = /^[A-Za-z0-9][A-Za-z0-9_.-]*$/;
 
-    if (typeof autoplan.enabled !== 'boolean') {
-      throw new Error(`Project ${p.name}: autoplan.enabled must be a boolean`);
-    }
+/**
+ * A project flag: one or two dashes and a name, such as -p or --dir
+ */
+const PROJECT_FLAG_PATTERN = /^--?[A-Za-z][A-Za-z0-9-]*$/;
 
-    if (!Array.isArray(autoplan.when_modified)) {
-      throw new Error(`Project ${p.name}: autoplan.when_modified must be an array`);
-    }
+/**
+ * A project tag: a single word such as networking or tier-1
+ */
+const TAG_PATTERN = /^[A-Za-z0-9][A-Za-z0-9_.-]*$/;
 
-    if (!autoplan.when_modified.every((item) => typeof item === 'string')) {
-      throw new Error(`Project ${p.name}: autoplan.when_modified must contain only strings`);
+/**
+ * Comment flags that cannot be used to select projects
+ */
+const RESERVED_COMMENT_FLAGS = [
+  '--all',
+  '-dir',
+  '-tag',
+  '-w',
+  '-workspace',
+  '-refresh',
+  '-lock-timeout',
+];
+
+/**
+ * Validates a non-empty list of words matching a pattern
+ *
+ * @returns The list when valid, undefined otherwise
+ */
+function validateWordList(
+  value: unknown,
+  fieldName: string,
+  pattern: RegExp,
+  errors: string[]
+): string[] | undefined {
+  if (!Array.isArray(value) || value.length === 0) {
+    errors.push(`${fieldName} must be a non-empty list`);
+    return undefined;
+  }
+
+  const errorCount = errors.length;
+  for (const word of value) {
+    if (typeof word !== 'string' || !pattern.test(word)) {
+      errors.push(`Invalid ${fieldName} entry: ${word}`);
     }
+  }
+
+  return errors.length === errorCount ? (value as string[]) : undefined;
+}
 
-    validated.autoplan = {
-      enabled: autoplan.enabled,
-      when_modified: autoplan.when_modified as string[],
-    };
+/**
+ * Reads and parses a single YAML configuration file
+ *
+ * @param absolutePath - Absolute path to the YAML file
+ * @returns Parsed YAML content
+ * @throws Error if file doesn't exist or is invalid YAML
+ */
+function readConfigFile(absolutePath: string): unknown {
+  // Check file exists
+  if (!fs.existsSync(absolutePath)) {
+    throw new Error(`Configuration file not found: ${absolutePath}`);
   }
 
-  // Validate plan_requirements if present
-  if (p.plan_requirements !== undefined) {
-    validated.plan_requirements = validateRequirements(
-      p.plan_requirements,
-      `Project ${p.name}: plan_requirements`
+  // Read file
+  let content: string;
+  try {
+    content = fs.readFileSync(absolutePath, 'utf8');
+  } catch (error) {
+    throw new Error(
+      `Failed to read configuration file: ${error instanceof Error ? error.message : String(error)}`
     );
   }
 
-  // Validate apply_requirements if present
-  if (p.apply_requirements !== undefined) {
-    validated.apply_requirements = validateRequirements(
-      p.apply_requirements,
-      `Project ${p.name}: apply_requirements`
+  return parseConfigYaml(content);
+}
+
+/**
+ * Parses the YAML content of a configuration file
+ *
+ * @throws Error if the content is invalid YAML
+ */
+function parseConfigYaml(content: string): unknown {
+  try {
+    return yaml.load(content);
+  } catch (error) {
+    throw new Error(
+      `Failed to parse YAML: ${error instanceof Error ? error.message : String(error)}`
     );
   }
+}
 
-  return validated;
+/**
+ * Checks whether a parsed YAML value is a mapping
+ */
+function isPlainObject(value: unknown): value is Record<string, unknown> {
+  return typeof value === 'object' && value !== null && !Array.isArray(value);
 }
 
 /**
- * Validates the configuration object
+ * Merges an overlay configuration on top of a base configuration
+ *
+ * @remarks
+ * Top-level fields from the overlay replace those from the base,
+ * while project lists are concatenated (base first) and workflows are merged by name.
  */
-function validateConfig(config: unknown): Config {
-  if (!config || typeof config !== 'object') {
-    throw new Error('Configuration must be an object');
+function mergeConfigObjects(
+  base: Record<string, unknown>,
+  overlay: Record<string, unknown>
+): Record<string, unknown> {
+  const merged = { ...base, ...overlay };
+
+  if (Array.isArray(base.projects) && Array.isArray(overlay.projects)) {
+    merged.projects = [...base.projects, ...overlay.projects];
+  }
+  if (isPlainObject(base.workflows) && isPlainObject(overlay.workflows)) {
+    merged.workflows = { ...base.workflows, ...overlay.workflows };
   }
 
-  const c = config as Record<string, unknown>;
+  return merged;
+}
 
-  // Validate projects array
-  if (!Array.isArray(c.projects)) {
-    throw new Error('Configuration must have a "projects" array');
+/**
+ * Reads a configuration file and recursively merges the files it includes
+ *
+ * @param absolutePath - Absolute path to the YAML file
+ * @param chain - Files currently being loaded (used to detect include cycles)
+ * @param projectSources - Project name to defining file, shared across the include tree
+ * @param loaded - Files already merged, shared across the include tree
+ * @param read - Reads and parses one file (default: from the local filesystem)
+ * @returns Raw merged configuration, not yet validated
+ *
+ * @remarks
+ * Paths in `include` are resolved relative to the including file. Included files
+ * are merged in order, and the including file is merged last so its top-level
+ * fields win. Projects with the same name in different files are rejected. A file
+ * included more than once (e.g., by two sibling files) is merged only where it is
+ * first included.
+ */
+function loadConfigTree(
+  absolutePath: string,
+  chain: string[],
+  projectSources: Map<string, string>,
+  loaded: Set<string>,
+  read: (absolutePath: string) => unknown = readConfigFile
+): unknown {
+  if (chain.includes(absolutePath)) {
+    throw new Error(`Circular include detected: ${[...chain, absolutePath].join(' -> ')}`);
   }
+  if (loaded.has(absolutePath)) {
+    return {};
+  }
+  loaded.add(absolutePath);
 
-  if (c.projects.length === 0) {
-    throw new Error('Configuration must have at least one project');
+  const parsed = read(absolutePath);
+
+  if (!parsed || typeof parsed !== 'object' || Array.isArray(parsed)) {
+    if (chain.length > 0) {
+      throw new Error(`Included configuration must be an object: ${absolutePath}`);
+    }
+    // Let validateConfig report the error for the root file
+    return parsed;
   }
 
-  const projects = c.projects.map((project, index) => validateProject(project, index));
+  const { include, ...own } = parsed as Record<string, unknown>;
 
-  // Check for duplicate project names
-  const names = new Set<string>();
-  for (const project of projects) {
-    if (names.has(project.name)) {
-      throw new Error(`Duplicate project name: ${project.name}`);
+  // Record where each project is defined to report duplicates across files
+  if (Array.isArray(own.projects)) {
+    for (const project of own.projects) {
+      const name = (project as Record<string, unknown> | null)?.name;
+      if (typeof name !== 'string') {
+        continue;
+      }
+      const source = projectSources.get(name);
+      if (source !== undefined && source !== absolutePath) {
+        throw new Error(
+          `Duplicate project name: ${name} (defined in ${source} and ${absolutePath})`
+        );
+      }
+      projectSources.set(name, absolutePath);
     }
-    names.add(project.name);
   }
 
-  const validated: Config = { projects };
+  if (include === undefined) {
+    return own;
+  }
 
-  return validated;
+  if (!Array.isArray(include) || !include.every((item) => typeof item === 'string')) {
+    throw new Error(`include must be an array of file paths in ${absolutePath}`);
+  }
+
+  let merged: Record<string, unknown> = {};
+  for (const includePath of include as string[]) {
+    const included = loadConfigTree(
+      path.resolve(path.dirname(absolutePath), includePath),
+      [...chain, absolutePath],
+      projectSources,
+      loaded,
+      read
+    ) as Record<string, unknown>;
+    merged = mergeConfigObjects(merged, included);
+  }
+
+  return mergeConfigObjects(merged, own);
 }
 
 /**
@@ -139,38 +2701,288 @@ function validateConfig(config: unknown): Config {
  * @param configPath - Path to the YAML configuration file
  * @returns Validated configuration object
  * @throws Error if file doesn't exist, is invalid YAML, or fails validation
+ *
+ * @remarks
+ * The file may list other configuration files under `include`; their projects
+ * are appended and their top-level fields are overridden by later files.
  */
 export function loadConfig(configPath: string): Config {
-  // Resolve to absolute path
+  return validateConfig(readConfigTree(configPath));
+}
+
+/**
+ * Reads a configuration file and the files it includes, without validating them
+ *
+ * @param configPath - Path to the YAML configuration file
+ * @returns Raw merged configuration
+ * @throws Error if a file doesn't exist or is invalid YAML
+ */
+export function readConfigTree(configPath: string): unknown {
+  return loadConfigTree(path.resolve(configPath), [], new Map(), new Set());
+}
+
+/**
+ * Converts a configuration path to a path relative to the repository root
+ *
+ * @param configPath - Path to a configuration file (relative to the workspace or absolute)
+ * @param workspace - Repository root (default: the current directory)
+ * @returns Path with forward slashes, as used by the GitHub contents API
+ * @throws Error if the path is outside the repository
+ */
+export function toRepositoryPath(configPath: string, workspace = process.cwd()): string {
+  const relative = path.relative(workspace, path.resolve(workspace, configPath));
+  if (relative === '' || relative.startsWith('..') || path.isAbsolute(relative)) {
+    throw new Error(`Configuration file must be inside the repository: ${configPath}`);
+  }
+  return relative.split(path.sep).join('/');
+}
+
+/**
+ * Loads the configuration from another version of the repository (e.g., the PR base branch)
+ *
+ * @param configPath - Path to the YAML configuration file, as for loadConfig
+ * @param fetchFile - Reads a file by repository path, returning null if it does not exist
+ * @param source - Where the files come from, for error messages (e.g., base branch main)
+ * @returns Validated configuration object
+ * @throws Error if a file is missing, cannot be fetched, or the configuration is invalid
+ *
+ * @remarks
+ * Included files are fetched the same way, so the whole configuration comes from one version.
+ */
+export async function loadConfigFromRepository(
+  configPath: string,
+  fetchFile: (repoPath: string) => Promise<string | null>,
+  source: string
+): Promise<Config> {
+  return validateConfig(await fetchConfigTree(configPath, fetchFile, source));
+}
+
+/**
+ * Fetches a configuration file and the files it includes, without validating them
+ *
+ * @param configPath - Path to the YAML configuration file, relative to the repository root
+ * @param fetchFile - Reads a file by repository path, returning null if it does not exist
+ * @param source - Where the files come from, for error messages (e.g., base branch main)
+ * @returns Raw merged configuration
+ * @throws Error if a file is missing, cannot be fetched or is invalid YAML
+ */
+export async function fetchConfigTree(
+  configPath: string,
+  fetchFile: (repoPath: string) => Promise<string | null>,
+  source: string
+): Promise<unknown> {
+  const workspace = process.cwd();
   const absolutePath = path.resolve(configPath);
 
-  // Check file exists
-  if (!fs.existsSync(absolutePath)) {
-    throw new Error(`Configuration file not found: ${absolutePath}`);
+  // Fetch the include tree first, so the synchronous loader can read from memory
+  const files = new Map<string, string | null>();
+  const fetchTree = async (filePath: string): Promise<void> => {
+    if (files.has(filePath)) {
+      return;
+    }
+    const content = await fetchFile(toRepositoryPath(filePath, workspace));
+    files.set(filePath, content);
+
+    let parsed: unknown;
+    try {
+      parsed = content === null ? undefined : yaml.load(content);
+    } catch (_error) {
+      // loadConfigTree reports the YAML error
+      return;
+    }
+    const include = (parsed as Record<string, unknown> | undefined)?.include;
+    if (Array.isArray(include)) {
+      for (const includePath of include) {
+        if (typeof includePath === 'string') {
+          await fetchTree(path.resolve(path.dirname(filePath), includePath));
+        }
+      }
+    }
+  };
+  await fetchTree(absolutePath);
+
+  return loadConfigTree(absolutePath, [], new Map(), new Set(), (filePath) => {
+    const content = files.get(filePath);
+    if (content === null || content === undefined) {
+      throw new Error(
+        `Configuration file not found on ${source}: ${toRepositoryPath(filePath, workspace)}`
+      );
+    }
+    return parseConfigYaml(content);
+  });
+}
+
+/**
+ * Configuration file read from a central repository when config_repo names none
+ */
+export const DEFAULT_CENTRAL_CONFIG_PATH = '.terraform-action.yaml';
+
+/**
+ * Reads a central repository reference: owner/repo, an optional file path and an optional ref
+ *
+ * @returns The reference, or undefined if the value is not one
+ *
+ * @example
+ * parseConfigRepo('acme/infra-config@main')
+ * // => { owner: 'acme', repo: 'infra-config', path: '.terraform-action.yaml', ref: 'main' }
+ * parseConfigRepo('acme/infra-config/teams/data.yaml@v2')
+ * // => { owner: 'acme', repo: 'infra-config', path: 'teams/data.yaml', ref: 'v2' }
+ */
+export function parseConfigRepo(value: string): ConfigRepoRef | undefined {
+  const match = /^([\w.-]+)\/([\w.-]+)(?:\/([^@]+))?(?:@(.+))?$/.exec(value.trim());
+  if (!match) {
+    return undefined;
   }
+  const [, owner, repo, filePath, ref] = match;
+  if (filePath?.split('/').some((segment) => segment === '' || segment === '..')) {
+    return undefined;
+  }
+  return { owner, repo, path: filePath ?? DEFAULT_CENTRAL_CONFIG_PATH, ref };
+}
 
-  // Read file
-  let content: string;
-  try {
-    content = fs.readFileSync(absolutePath, 'utf8');
-  } catch (error) {
-    throw new Error(
-      `Failed to read configuration file: ${error instanceof Error ? error.message : String(error)}`
-    );
+/**
+ * Loads a configuration, on top of the central configuration it overrides if any
+ *
+ * @param local - Raw configuration of the repository, or undefined when it has no file
+ * @param configRepo - Central repository (default: the config_repo of the local configuration)
+ * @param fetchFile - Reads a file of the central repository, returning null if it does not exist
+ * @returns Validated configuration
+ * @throws ConfigValidationError if the configuration is invalid or overrides an enforced field
+ * @throws Error if a central file is missing or cannot be fetched
+ *
+ * @remarks
+ * The local configuration is merged over the central one like an included file
+ * over the including one: its projects are added and its top-level fields win,
+ * except those the central configuration lists under `enforce`.
+ */
+export async function loadConfigWithCentral(
+  local: unknown,
+  configRepo: string | undefined,
+  fetchFile: (central: ConfigRepoRef, repoPath: string) => Promise<string | null>
+): Promise<Config> {
+  const spec =
+    configRepo ??
+    (isPlainObject(local) && typeof local.config_repo === 'string' ? local.config_repo : undefined);
+  if (spec === undefined) {
+    return validateConfig(local);
+  }
+
+  const central = parseConfigRepo(spec);
+  if (!central) {
+    throw new ConfigValidationError([
+      `config_repo must be a repository such as acme/infra-config@main (got ${spec})`,
+    ]);
+  }
+  const source = `central configuration ${spec}`;
+  const shared = await fetchConfigTree(
+    central.path,
+    (repoPath) => fetchFile(central, repoPath),
+    source
+  );
+  return validateConfig(mergeCentralConfig(shared, local ?? {}, source));
+}
+
+/**
+ * Merges a local configuration over the central one, rejecting overrides of enforced fields,
+ * whether at the top level or in the local projects
+ *
+ * @throws ConfigValidationError if the local configuration sets a field it may not
+ */
+function mergeCentralConfig(
+  central: unknown,
+  local: unknown,
+  source: string
+): Record<string, unknown> {
+  if (!isPlainObject(central)) {
+    throw new ConfigValidationError([`The ${source} must be an object`]);
+  }
+  if (!isPlainObject(local)) {
+    throw new ConfigValidationError(['Configuration must be an object']);
+  }
+
+  const errors: string[] = [];
+  if (central.config_repo !== undefined) {
+    errors.push(`config_repo cannot be set in the ${source}`);
+  }
+  if (local.enforce !== undefined) {
+    errors.push('enforce can only be set in a central configuration');
+  }
+  const enforced = Array.isArray(central.enforce) ? central.enforce : [];
+  for (const field of Object.keys(local)) {
+    if (enforced.includes(field)) {
+      errors.push(`${field} is enforced by the ${source} and cannot be overridden`);
+    }
   }
+  // Project settings such as require_plan override the top-level ones of the same name
+  const projects = Array.isArray(local.projects) ? local.projects : [];
+  projects.forEach((project, index) => {
+    if (!isPlainObject(project)) {
+      return;
+    }
+    const label =
+      typeof project.name === 'string' ? `Project ${project.name}` : `Project at index ${index}`;
+    for (const field of Object.keys(project)) {
+      if (enforced.includes(field) && PROJECT_FIELDS.includes(field)) {
+        errors.push(`${label}: ${field} is enforced by the ${source} and cannot be overridden`);
+      }
+    }
+  });
+  if (errors.length > 0) {
+    throw new ConfigValidationError(errors);
+  }
+
+  return mergeConfigObjects(central, local);
+}
+
+/**
+ * Name of the project used when there is no configuration file
+ */
+export const DEFAULT_PROJECT_NAME = 'default';
+
+/**
+ * Builds the configuration used when there is no configuration file
+ *
+ * @param dir - Directory of the single project (e.g., from the default-project-dir input)
+ * @returns Validated configuration with one project named `default`
+ * @throws ConfigValidationError if the directory is not inside the repository
+ */
+export function getDefaultConfig(dir: string): Config {
+  return validateConfig(getDefaultConfigTree(dir));
+}
+
+/**
+ * Raw configuration used when there is no configuration file, before validation
+ *
+ * @param dir - Directory of the single project
+ */
+export function getDefaultConfigTree(dir: string): Record<string, unknown> {
+  return { projects: [{ name: DEFAULT_PROJECT_NAME, dir }] };
+}
 
-  // Parse YAML
-  let parsed: unknown;
+/**
+ * Checks a configuration file without running anything (the validate-config command)
+ *
+ * @param configPath - Path to the YAML configuration file
+ * @param fetchFile - Reads a file of the central repository the file's config_repo names
+ * @returns Every problem found; empty when the configuration is valid
+ *
+ * @remarks
+ * A file with config_repo is checked merged over the central configuration, as the
+ * action would load it, so enforced fields and central workflows are taken into account.
+ */
+export async function validateConfigFile(
+  configPath: string,
+  fetchFile: (central: ConfigRepoRef, repoPath: string) => Promise<string | null>
+): Promise<string[]> {
   try {
-    parsed = yaml.load(content);
+    await loadConfigWithCentral(readConfigTree(configPath), undefined, fetchFile);
+    return [];
   } catch (error) {
-    throw new Error(
-      `Failed to parse YAML: ${error instanceof Error ? error.message : String(error)}`
-    );
+    if (error instanceof ConfigValidationError) {
+      return error.errors;
+    }
+    return [error instanceof Error ? error.message : String(error)];
   }
-
-  // Validate and return
-  return validateConfig(parsed);
 }
 
 /**
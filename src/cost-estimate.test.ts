@@ -0,0 +1,94 @@
+/**
+ * Unit tests for cost estimation
+ */
+
+import {
+  estimatePlanCost,
+  exceedsCostLimit,
+  formatCost,
+  parseInfracostBreakdown,
+} from './cost-estimate';
+import { executeInfracost } from './terraform';
+
+// Mock the @actions modules and infracost
+jest.mock('@actions/core');
+jest.mock('./terraform', () => ({
+  ...jest.requireActual('./terraform'),
+  executeInfracost: jest.fn(),
+}));
+
+describe('cost-estimate', () => {
+  const mockExecuteInfracost = executeInfracost as jest.MockedFunction<typeof executeInfracost>;
+  const breakdown = JSON.stringify({
+    currency: 'EUR',
+    pastTotalMonthlyCost: '10.5',
+    totalMonthlyCost: '35.75',
+    diffTotalMonthlyCost: '25.25',
+    projects: [],
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+  });
+
+  describe('parseInfracostBreakdown', () => {
+    it('should read the monthly costs', () => {
+      expect(parseInfracostBreakdown(breakdown)).toEqual({
+        currency: 'EUR',
+        pastMonthlyCost: 10.5,
+        monthlyCost: 35.75,
+        diffMonthlyCost: 25.25,
+      });
+    });
+
+    it('should count missing costs as zero', () => {
+      expect(
+        parseInfracostBreakdown(
+          JSON.stringify({ pastTotalMonthlyCost: null, totalMonthlyCost: '12', projects: [] })
+        )
+      ).toEqual({ currency: 'USD', pastMonthlyCost: 0, monthlyCost: 12, diffMonthlyCost: 12 });
+    });
+
+    it('should reject output that is not a cost breakdown', () => {
+      expect(() => parseInfracostBreakdown('Error: no API key')).toThrow(
+        'infracost did not return JSON output'
+      );
+      expect(() => parseInfracostBreakdown(JSON.stringify({ totalMonthlyCost: 'n/a' }))).toThrow(
+        'infracost returned an invalid totalMonthlyCost: n/a'
+      );
+    });
+  });
+
+  describe('formatCost', () => {
+    it('should format amounts with two decimals', () => {
+      expect(formatCost(12.5, 'USD')).toBe('12.50 USD');
+      expect(formatCost(12.5, 'USD', true)).toBe('+12.50 USD');
+      expect(formatCost(-3, 'USD', true)).toBe('-3.00 USD');
+      expect(formatCost(0, 'USD', true)).toBe('0.00 USD');
+    });
+  });
+
+  describe('exceedsCostLimit', () => {
+    const estimate = { currency: 'USD', pastMonthlyCost: 0, monthlyCost: 50, diffMonthlyCost: 50 };
+
+    it('should compare the increase with max_monthly_increase', () => {
+      expect(exceedsCostLimit(estimate, { max_monthly_increase: 49.99 })).toBe(true);
+      expect(exceedsCostLimit(estimate, { max_monthly_increase: 50 })).toBe(false);
+    });
+
+    it('should never be exceeded without a limit', () => {
+      expect(exceedsCostLimit(estimate, {})).toBe(false);
+    });
+  });
+
+  describe('estimatePlanCost', () => {
+    it('should run infracost on the plan JSON', async () => {
+      mockExecuteInfracost.mockResolvedValue(breakdown);
+
+      const estimate = await estimatePlanCost('app', '/repo/app', '/tmp/tfplan-app.json');
+
+      expect(mockExecuteInfracost).toHaveBeenCalledWith('/tmp/tfplan-app.json', '/repo/app');
+      expect(estimate.diffMonthlyCost).toBe(25.25);
+    });
+  });
+});
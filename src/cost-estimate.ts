@@ -0,0 +1,106 @@
+/**
+ * Cost estimation of saved plans with Infracost
+ */
+
+import * as core from '@actions/core';
+import { executeInfracost } from './terraform';
+import type { CostEstimate, InfracostConfig } from './types';
+
+/**
+ * Reads the monthly costs from `infracost breakdown --format json` output
+ *
+ * @param output - Infracost JSON output
+ * @returns Monthly costs before and after the plan
+ * @throws Error if the output is not Infracost JSON
+ *
+ * @remarks
+ * Infracost reports amounts as decimal strings, or null when nothing is priced
+ * (counted as 0).
+ */
+export function parseInfracostBreakdown(output: string): CostEstimate {
+  let breakdown: unknown;
+  try {
+    breakdown = JSON.parse(output);
+  } catch {
+    throw new Error('infracost did not return JSON output');
+  }
+  if (typeof breakdown !== 'object' || breakdown === null || Array.isArray(breakdown)) {
+    throw new Error('infracost did not return a cost breakdown');
+  }
+
+  const b = breakdown as Record<string, unknown>;
+  const amount = (field: string): number => {
+    const value = Number(b[field] ?? 0);
+    if (!Number.isFinite(value)) {
+      throw new Error(`infracost returned an invalid ${field}: ${b[field]}`);
+    }
+    return value;
+  };
+
+  const pastMonthlyCost = amount('pastTotalMonthlyCost');
+  const monthlyCost = amount('totalMonthlyCost');
+  return {
+    currency: typeof b.currency === 'string' && b.currency !== '' ? b.currency : 'USD',
+    pastMonthlyCost,
+    monthlyCost,
+    // Infracost rounds the difference itself; subtracting could add float noise
+    diffMonthlyCost:
+      b.diffTotalMonthlyCost === undefined || b.diffTotalMonthlyCost === null
+        ? monthlyCost - pastMonthlyCost
+        : amount('diffTotalMonthlyCost'),
+  };
+}
+
+/**
+ * Formats an amount of money, e.g. 12.50 USD
+ *
+ * @param amount - Amount
+ * @param currency - Currency code
+ * @param signed - Prefix increases with + (for changes)
+ */
+export function formatCost(amount: number, currency: string, signed = false): string {
+  const sign = signed && amount > 0 ? '+' : '';
+  return `${sign}${amount.toFixed(2)} ${currency}`;
+}
+
+/**
+ * Whether a plan raises the monthly cost above the configured limit
+ *
+ * @param estimate - Cost estimate of the plan
+ * @param infracost - Infracost settings
+ */
+export function exceedsCostLimit(estimate: CostEstimate, infracost: InfracostConfig): boolean {
+  return (
+    infracost.max_monthly_increase !== undefined &&
+    estimate.diffMonthlyCost > infracost.max_monthly_increase
+  );
+}
+
+/**
+ * Estimates the monthly cost of a saved plan
+ *
+ * @param projectName - Name of the project
+ * @param workingDir - Resolved project directory
+ * @param planJsonPath - Path to the output of `terraform show -json` for the plan
+ * @returns Cost estimate
+ * @throws Error if infracost is not installed, fails or returns unexpected output
+ */
+export async function estimatePlanCost(
+  projectName: string,
+  workingDir: string,
+  planJsonPath: string
+): Promise<CostEstimate> {
+  core.startGroup(`Estimating cost for project: ${projectName}`);
+  try {
+    const estimate = parseInfracostBreakdown(await executeInfracost(planJsonPath, workingDir));
+    const { currency } = estimate;
+    core.info(
+      `Monthly cost: ${formatCost(estimate.pastMonthlyCost, currency)} -> ` +
+        `${formatCost(estimate.monthlyCost, currency)} ` +
+        `(${formatCost(estimate.diffMonthlyCost, currency, true)})`
+    );
+    return estimate;
+  } finally {
+    core.endGroup();
+  }
+}
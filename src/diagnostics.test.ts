@@ -0,0 +1,124 @@
+/**
+ * Unit tests for terraform JSON diagnostics parsing
+ */
+
+import { formatDiagnostic, parseDiagnostics } from './diagnostics';
+
+describe('diagnostics', () => {
+  describe('parseDiagnostics', () => {
+    it('should parse diagnostics from the streaming JSON UI output', () => {
+      const output = [
+        '{"@level":"info","@message":"Terraform 1.7.0","@module":"terraform.ui","type":"version"}',
+        JSON.stringify({
+          '@level': 'error',
+          '@message': 'Error: Unsupported argument',
+          '@module': 'terraform.ui',
+          type: 'diagnostic',
+          diagnostic: {
+            severity: 'error',
+            summary: 'Unsupported argument',
+            detail: 'An argument named "foo" is not expected here.',
+            range: {
+              filename: 'main.tf',
+              start: { line: 12, column: 3, byte: 200 },
+              end: { line: 12, column: 6, byte: 203 },
+            },
+          },
+        }),
+      ].join('\n');
+
+      expect(parseDiagnostics(output)).toEqual([
+        {
+          severity: 'error',
+          summary: 'Unsupported argument',
+          detail: 'An argument named "foo" is not expected here.',
+          module: 'terraform.ui',
+          filename: 'main.tf',
+          line: 12,
+        },
+      ]);
+    });
+
+    it('should use @level when the diagnostic has no severity', () => {
+      const output = JSON.stringify({
+        '@level': 'warn',
+        '@module': 'terraform.ui',
+        type: 'diagnostic',
+        diagnostic: { summary: 'Deprecated attribute' },
+      });
+
+      expect(parseDiagnostics(output)).toEqual([
+        {
+          severity: 'warning',
+          summary: 'Deprecated attribute',
+          detail: '',
+          module: 'terraform.ui',
+        },
+      ]);
+    });
+
+    it('should parse warnings without a source location', () => {
+      const output = JSON.stringify({
+        '@level': 'warn',
+        type: 'diagnostic',
+        diagnostic: { severity: 'warning', summary: 'Provider deprecated', detail: 'Upgrade' },
+      });
+
+      expect(parseDiagnostics(output)).toEqual([
+        { severity: 'warning', summary: 'Provider deprecated', detail: 'Upgrade' },
+      ]);
+    });
+
+    it('should parse terraform validate -json output', () => {
+      const output = JSON.stringify({
+        format_version: '1.0',
+        valid: false,
+        error_count: 1,
+        warning_count: 0,
+        diagnostics: [
+          {
+            severity: 'error',
+            summary: 'Missing required argument',
+            detail: 'The argument "bucket" is required.',
+            range: { filename: 'modules/s3/main.tf', start: { line: 4 } },
+          },
+        ],
+      });
+
+      expect(parseDiagnostics(output)).toEqual([
+        {
+          severity: 'error',
+          summary: 'Missing required argument',
+          detail: 'The argument "bucket" is required.',
+          filename: 'modules/s3/main.tf',
+          line: 4,
+        },
+      ]);
+    });
+
+    it('should ignore non-JSON lines and empty output', () => {
+      expect(parseDiagnostics('')).toEqual([]);
+      expect(parseDiagnostics('not json\n{"type":"version"}')).toEqual([]);
+    });
+  });
+
+  describe('formatDiagnostic', () => {
+    it('should include location and detail', () => {
+      expect(
+        formatDiagnostic({
+          severity: 'error',
+          summary: 'Unsupported argument',
+          detail: 'Remove it.',
+          filename: 'main.tf',
+          line: 3,
+        })
+      ).toBe('❌ **Unsupported argument** (`main.tf:3`)\n\nRemove it.');
+    });
+
+    it('should format warnings without location', () => {
+      expect(formatDiagnostic({ severity: 'warning', summary: 'Deprecated', detail: '' })).toBe(
+        '⚠️ **Deprecated**'
+      );
+    });
+  });
+});
@@ -0,0 +1,103 @@
+/**
+ * Parsing of terraform JSON diagnostics
+ */
+
+import type { TerraformDiagnostic } from './types';
+
+/**
+ * Converts a raw diagnostic object into a TerraformDiagnostic
+ */
+function toDiagnostic(raw: Record<string, unknown>, module?: string): TerraformDiagnostic | null {
+  if (typeof raw.summary !== 'string') {
+    return null;
+  }
+
+  const range = raw.range as
+    | { filename?: unknown; start?: { line?: unknown } }
+    | undefined;
+
+  const diagnostic: TerraformDiagnostic = {
+    // The JSON UI stream uses "warn" for @level, diagnostics use "warning"
+    severity: raw.severity === 'warning' || raw.severity === 'warn' ? 'warning' : 'error',
+    summary: raw.summary,
+    detail: typeof raw.detail === 'string' ? raw.detail : '',
+  };
+
+  if (module) {
+    diagnostic.module = module;
+  }
+  if (range && typeof range.filename === 'string' && typeof range.start?.line === 'number') {
+    diagnostic.filename = range.filename;
+    diagnostic.line = range.start.line;
+  }
+
+  return diagnostic;
+}
+
+/**
+ * Parses diagnostics from terraform JSON output
+ *
+ * @param output - Output of `terraform <command> -json` (one JSON object per line)
+ *   or `terraform validate -json` (a single object with a diagnostics array)
+ * @returns Parsed diagnostics; lines that are not diagnostics are ignored
+ *
+ * @example
+ * parseDiagnostics('{"@level":"error","@module":"terraform.ui","type":"diagnostic","diagnostic":{"severity":"error","summary":"Unsupported argument","range":{"filename":"main.tf","start":{"line":3}}}}')
+ * // => [{ severity: 'error', summary: 'Unsupported argument', detail: '', module: 'terraform.ui', filename: 'main.tf', line: 3 }]
+ */
+export function parseDiagnostics(output: string): TerraformDiagnostic[] {
+  const trimmed = output.trim();
+  if (!trimmed) {
+    return [];
+  }
+
+  // terraform validate -json prints a single document
+  try {
+    const document = JSON.parse(trimmed) as Record<string, unknown>;
+    if (Array.isArray(document.diagnostics)) {
+      return document.diagnostics
+        .map((d) => toDiagnostic(d as Record<string, unknown>))
+        .filter((d): d is TerraformDiagnostic => d !== null);
+    }
+  } catch (_error) {
+    // Not a single document, fall through to the streaming format
+  }
+
+  const diagnostics: TerraformDiagnostic[] = [];
+
+  for (const line of trimmed.split('\n')) {
+    let message: Record<string, unknown>;
+    try {
+      message = JSON.parse(line) as Record<string, unknown>;
+    } catch (_error) {
+      continue;
+    }
+
+    if (message.type !== 'diagnostic' || !message.diagnostic) {
+      continue;
+    }
+
+    const raw = message.diagnostic as Record<string, unknown>;
+    // Fall back to the message level when the diagnostic omits its severity
+    const severity = raw.severity ?? message['@level'];
+    const module = typeof message['@module'] === 'string' ? message['@module'] : undefined;
+    const diagnostic = toDiagnostic({ ...raw, severity }, module);
+    if (diagnostic) {
+      diagnostics.push(diagnostic);
+    }
+  }
+
+  return diagnostics;
+}
+
+/**
+ * Formats a diagnostic as a Markdown comment body
+ */
+export function formatDiagnostic(diagnostic: TerraformDiagnostic): string {
+  const icon = diagnostic.severity === 'error' ? '❌' : '⚠️';
+  const location =
+    diagnostic.filename !== undefined ? ` (\`${diagnostic.filename}:${diagnostic.line}\`)` : '';
+  const detail = diagnostic.detail ? `\n\n${diagnostic.detail}` : '';
+
+  return `${icon} **${diagnostic.summary}**${location}${detail}`;
+}
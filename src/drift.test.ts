@@ -0,0 +1,161 @@
+/**
+ * Unit tests for drift detection reporting
+ */
+
+import * as core from '@actions/core';
+import {
+  buildDriftIssueBody,
+  buildDriftIssueTitle,
+  buildDriftSummary,
+  reportDriftIssue,
+} from './drift';
+import { closeIssue, findIssueByTitle, findOrCreateIssue } from './issue-tracker';
+
+// Mock the @actions modules and the issues API
+jest.mock('@actions/core');
+jest.mock('./issue-tracker');
+
+describe('drift', () => {
+  const mockCore = core as jest.Mocked<typeof core>;
+  const mockFindIssueByTitle = findIssueByTitle as jest.MockedFunction<typeof findIssueByTitle>;
+  const mockFindOrCreateIssue = findOrCreateIssue as jest.MockedFunction<
+    typeof findOrCreateIssue
+  >;
+  const mockCloseIssue = closeIssue as jest.MockedFunction<typeof closeIssue>;
+
+  const drifted = {
+    project: 'production',
+    drifted: true,
+    summary: { add: 0, change: 1, destroy: 0 },
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+  });
+
+  describe('buildDriftIssueTitle', () => {
+    it('should include the project name', () => {
+      expect(buildDriftIssueTitle('production')).toBe('Terraform drift detected: production');
+    });
+  });
+
+  describe('buildDriftIssueBody', () => {
+    it('should include the change counts, run link and plan output', () => {
+      const body = buildDriftIssueBody(
+        drifted,
+        '~ aws_instance.web',
+        'https://github.com/owner/repo/actions/runs/1'
+      );
+
+      expect(body).toContain('Drift detected in project `production`');
+      expect(body).toContain('**Plan:** 0 to add, 1 to change, 0 to destroy');
+      expect(body).toContain('(https://github.com/owner/repo/actions/runs/1)');
+      expect(body).toContain('<details><summary>Plan output</summary>');
+      expect(body).toContain('~ aws_instance.web');
+    });
+  });
+
+  describe('buildDriftIssueBody resources', () => {
+    it('should list the resources the plan would change', () => {
+      const body = buildDriftIssueBody(
+        {
+          ...drifted,
+          changes: [
+            { address: 'aws_instance.web', actions: ['update'] },
+            { address: 'aws_s3_bucket.logs', actions: ['delete', 'create'] },
+          ],
+        },
+        ''
+      );
+
+      expect(body).toContain(
+        [
+          '| Resource | Action |',
+          '|----------|--------|',
+          '| `aws_instance.web` | update |',
+          '| `aws_s3_bucket.logs` | replace |',
+        ].join('\n')
+      );
+    });
+
+    it('should leave out the table when the resources are unknown', () => {
+      expect(buildDriftIssueBody(drifted, '')).not.toContain('| Resource | Action |');
+    });
+  });
+
+  describe('buildDriftSummary', () => {
+    it('should list every project with its status', () => {
+      const summary = buildDriftSummary([
+        drifted,
+        { project: 'staging', drifted: false, summary: null },
+        { project: 'dev', drifted: false, summary: null, error: 'init failed' },
+      ]);
+
+      expect(summary).toContain('| `production` | ⚠️ Drifted | 0 to add, 1 to change, 0 to destroy |');
+      expect(summary).toContain('| `staging` | ✅ No drift | - |');
+      expect(summary).toContain('| `dev` | ❌ Error | - |');
+    });
+  });
+
+  describe('reportDriftIssue', () => {
+    it('should open or update the tracking issue for a drifted project', async () => {
+      await reportDriftIssue('token', 'owner', 'repo', drifted, 'output');
+
+      expect(mockFindOrCreateIssue).toHaveBeenCalledWith(
+        'token',
+        'owner',
+        'repo',
+        'Terraform drift detected: production',
+        expect.stringContaining('Drift detected in project `production`')
+      );
+      expect(mockCloseIssue).not.toHaveBeenCalled();
+    });
+
+    it('should close the tracking issue once drift is gone', async () => {
+      mockFindIssueByTitle.mockResolvedValue(5);
+
+      await reportDriftIssue(
+        'token',
+        'owner',
+        'repo',
+        { project: 'production', drifted: false, summary: null },
+        ''
+      );
+
+      expect(mockCloseIssue).toHaveBeenCalledWith(
+        'token',
+        'owner',
+        'repo',
+        5,
+        expect.stringContaining('No drift detected')
+      );
+    });
+
+    it('should do nothing when there is no drift and no open issue', async () => {
+      mockFindIssueByTitle.mockResolvedValue(null);
+
+      await reportDriftIssue(
+        'token',
+        'owner',
+        'repo',
+        { project: 'production', drifted: false, summary: null },
+        ''
+      );
+
+      expect(mockCloseIssue).not.toHaveBeenCalled();
+      expect(mockFindOrCreateIssue).not.toHaveBeenCalled();
+    });
+
+    it('should warn instead of throwing when the issues API fails', async () => {
+      mockFindOrCreateIssue.mockRejectedValueOnce(new Error('Forbidden'));
+
+      await expect(
+        reportDriftIssue('token', 'owner', 'repo', drifted, 'output')
+      ).resolves.toBeUndefined();
+
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'Failed to update drift issue for production: Forbidden'
+      );
+    });
+  });
+});
@@ -0,0 +1,155 @@
+/**
+ * Drift detection reporting
+ */
+
+import * as core from '@actions/core';
+import { closeIssue, findIssueByTitle, findOrCreateIssue } from './issue-tracker';
+import { formatActions, formatChangeSummary } from './plan-summary';
+import { buildOutputComment, MAX_SUMMARY_RESOURCES } from './pr-comment';
+import type { ChangeSummary, PlannedChange } from './types';
+
+/**
+ * Drift detection outcome for one project
+ */
+export interface DriftResult {
+  /** Project name */
+  project: string;
+  /** Whether the project has drifted (plan exit code 2) */
+  drifted: boolean;
+  /** Change counts from the plan, if recognizable */
+  summary: ChangeSummary | null;
+  /** Resources the plan would change to reconcile the drift */
+  changes?: PlannedChange[];
+  /** Error message if the check failed */
+  error?: string;
+}
+
+/**
+ * Builds the title of the tracking issue for a project
+ *
+ * @remarks
+ * The title is the marker used to find the issue again, so it must stay stable.
+ *
+ * @example
+ * buildDriftIssueTitle('production')
+ * // => 'Terraform drift detected: production'
+ */
+export function buildDriftIssueTitle(projectName: string): string {
+  return `Terraform drift detected: ${projectName}`;
+}
+
+/**
+ * Builds the body of the tracking issue for a drifted project
+ *
+ * @param result - Drift result
+ * @param output - Plan output
+ * @param runUrl - URL of the workflow run that detected the drift
+ * @param secrets - Values that must never appear in the issue
+ * @returns Markdown issue body, listing the resources to reconcile when they are known
+ */
+export function buildDriftIssueBody(
+  result: DriftResult,
+  output: string,
+  runUrl?: string,
+  secrets: string[] = []
+): string {
+  const lines = [`## ⚠️ Drift detected in project \`${result.project}\``, ''];
+  if (result.summary) {
+    lines.push(`**Plan:** ${formatChangeSummary(result.summary)}`, '');
+  }
+  const changes = result.changes ?? [];
+  if (changes.length > 0) {
+    lines.push(
+      '| Resource | Action |',
+      '|----------|--------|',
+      ...changes
+        .slice(0, MAX_SUMMARY_RESOURCES)
+        .map((c) => `| \`${c.address}\` | ${formatActions(c.actions)} |`),
+      ''
+    );
+    if (changes.length > MAX_SUMMARY_RESOURCES) {
+      lines.push(`_…and ${changes.length - MAX_SUMMARY_RESOURCES} more resources._`, '');
+    }
+  }
+  if (runUrl) {
+    lines.push(`Detected by [this workflow run](${runUrl}).`, '');
+  }
+  lines.push('Run `terraform plan` and `terraform apply` from a pull request to reconcile.');
+
+  return buildOutputComment(lines.join('\n'), 'Plan output', output, secrets);
+}
+
+/**
+ * Builds a markdown table summarizing drift results across projects
+ *
+ * @param results - Drift results
+ * @returns Markdown summary
+ */
+export function buildDriftSummary(results: DriftResult[]): string {
+  const rows = results.map((r) => {
+    if (r.error) {
+      return `| \`${r.project}\` | ❌ Error | - |`;
+    }
+    if (r.drifted) {
+      const changes = r.summary ? formatChangeSummary(r.summary) : '-';
+      return `| \`${r.project}\` | ⚠️ Drifted | ${changes} |`;
+    }
+    return `| \`${r.project}\` | ✅ No drift | - |`;
+  });
+
+  return [
+    '## Terraform drift detection',
+    '',
+    '| Project | Status | Changes |',
+    '|---------|--------|---------|',
+    ...rows,
+  ].join('\n');
+}
+
+/**
+ * Opens or updates the tracking issue for a drifted project, or closes it once drift is gone
+ *
+ * @param token - GitHub token (also redacted from the issue)
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param result - Drift result
+ * @param output - Plan output
+ * @param runUrl - URL of the workflow run
+ *
+ * @remarks
+ * Errors while talking to the issues API are logged as warnings so that
+ * the remaining projects are still reported.
+ */
+export async function reportDriftIssue(
+  token: string,
+  owner: string,
+  repo: string,
+  result: DriftResult,
+  output: string,
+  runUrl?: string
+): Promise<void> {
+  const title = buildDriftIssueTitle(result.project);
+
+  try {
+    if (result.drifted) {
+      await findOrCreateIssue(
+        token,
+        owner,
+        repo,
+        title,
+        buildDriftIssueBody(result, output, runUrl, [token])
+      );
+      return;
+    }
+
+    const existing = await findIssueByTitle(token, owner, repo, title);
+    if (existing !== null) {
+      const by = runUrl ? ` by [this workflow run](${runUrl})` : '';
+      await closeIssue(token, owner, repo, existing, `✅ No drift detected${by}. Closing.`);
+    }
+  } catch (error) {
+    core.warning(
+      `Failed to update drift issue for ${result.project}: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
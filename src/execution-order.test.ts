@@ -0,0 +1,84 @@
+/**
+ * Unit tests for execution order groups and concurrent execution
+ */
+
+import {
+  buildDependencyLevels,
+  buildDirectoryLanes,
+  buildExecutionGroups,
+  runWithConcurrency,
+} from './execution-order';
+
+describe('execution-order', () => {
+  describe('buildExecutionGroups', () => {
+    it('should order groups from the lowest and keep the target order within a group', () => {
+      const network = { name: 'network', dir: 'network' };
+      const app = { name: 'app', dir: 'app', execution_order_group: 2 };
+      const dns = { name: 'dns', dir: 'dns', execution_order_group: 0 };
+      const db = { name: 'db', dir: 'db', execution_order_group: 1 };
+
+      expect(buildExecutionGroups([app, network, db, dns])).toEqual([[network, dns], [db], [app]]);
+    });
+  });
+
+  describe('buildDependencyLevels', () => {
+    it('should run every project after the projects it depends on', () => {
+      const app = { name: 'app', dir: 'app', depends_on: ['network', 'db'] };
+      const db = { name: 'db', dir: 'db', depends_on: ['network'] };
+      const network = { name: 'network', dir: 'network' };
+      const dns = { name: 'dns', dir: 'dns' };
+
+      expect(buildDependencyLevels([app, db, network, dns])).toEqual([
+        [network, dns],
+        [db],
+        [app],
+      ]);
+    });
+
+    it('should ignore dependencies that are not among the projects', () => {
+      const app = { name: 'app', dir: 'app', depends_on: ['network'] };
+
+      expect(buildDependencyLevels([app])).toEqual([[app]]);
+    });
+  });
+
+  describe('buildDirectoryLanes', () => {
+    it('should put projects sharing a directory in one lane', () => {
+      const dev = { name: 'network-dev', dir: 'envs/network', workspace: 'dev' };
+      const dns = { name: 'dns', dir: 'envs/dns' };
+      const prod = { name: 'network-prod', dir: 'envs/network/', workspace: 'prod' };
+
+      expect(buildDirectoryLanes([dev, dns, prod])).toEqual([[dev, prod], [dns]]);
+    });
+  });
+
+  describe('runWithConcurrency', () => {
+    it('should run at most limit tasks at a time and keep the order of the items', async () => {
+      let running = 0;
+      let mostRunning = 0;
+      const task = async (delay: number): Promise<number> => {
+        running++;
+        mostRunning = Math.max(mostRunning, running);
+        await new Promise((resolve) => setTimeout(resolve, delay));
+        running--;
+        return delay * 2;
+      };
+
+      await expect(runWithConcurrency([30, 10, 20, 5], 2, task)).resolves.toEqual([60, 20, 40, 10]);
+      expect(mostRunning).toBe(2);
+    });
+
+    it('should run one task at a time with a limit of 1', async () => {
+      const order: string[] = [];
+      const task = async (item: string): Promise<void> => {
+        order.push(`start ${item}`);
+        await Promise.resolve();
+        order.push(`end ${item}`);
+      };
+
+      await runWithConcurrency(['a', 'b'], 1, task);
+
+      expect(order).toEqual(['start a', 'end a', 'start b', 'end b']);
+    });
+  });
+});
@@ -0,0 +1,115 @@
+/**
+ * Execution order groups and concurrent execution of projects
+ */
+
+import * as path from 'node:path';
+import type { ProjectConfig } from './types';
+
+/**
+ * Projects run at the same time when parallel_pool_size is not set
+ */
+export const DEFAULT_PARALLEL_POOL_SIZE = 4;
+
+/**
+ * Splits projects into their execution order groups, lowest group first
+ *
+ * @param projects - Target projects, in target order
+ * @returns Groups of projects, each keeping the target order
+ *
+ * @example
+ * buildExecutionGroups([{ name: 'app', dir: 'app', execution_order_group: 1 }, { name: 'network', dir: 'network' }])
+ * // => [[network], [app]]
+ */
+export function buildExecutionGroups(projects: ProjectConfig[]): ProjectConfig[][] {
+  const groups = new Map<number, ProjectConfig[]>();
+  for (const project of projects) {
+    const order = project.execution_order_group ?? 0;
+    const group = groups.get(order) ?? [];
+    group.push(project);
+    groups.set(order, group);
+  }
+  return [...groups.entries()].sort(([a], [b]) => a - b).map(([, group]) => group);
+}
+
+/**
+ * Splits the projects of a group into levels that run one after another, each
+ * project in a level after every project it depends on
+ *
+ * @param projects - Projects of one execution order group, in target order
+ * @returns Levels of projects, each keeping the target order
+ * @throws Error if the dependencies form a cycle (rejected when the configuration is loaded)
+ *
+ * @remarks
+ * Dependencies that are not among the projects (not targeted, or in an earlier
+ * group) do not hold a project back.
+ *
+ * @example
+ * buildDependencyLevels([{ name: 'app', dir: 'app', depends_on: ['network'] }, { name: 'network', dir: 'network' }])
+ * // => [[network], [app]]
+ */
+export function buildDependencyLevels(projects: ProjectConfig[]): ProjectConfig[][] {
+  const levels: ProjectConfig[][] = [];
+  let pending = projects;
+
+  while (pending.length > 0) {
+    const waiting = new Set(pending.map((p) => p.name));
+    const level = pending.filter((p) => !(p.depends_on ?? []).some((name) => waiting.has(name)));
+    if (level.length === 0) {
+      throw new Error(`Dependency cycle between projects: ${[...waiting].join(', ')}`);
+    }
+    levels.push(level);
+    pending = pending.filter((p) => !level.includes(p));
+  }
+
+  return levels;
+}
+
+/**
+ * Splits a group into lanes of projects sharing a directory
+ *
+ * @param projects - Projects of one execution order group
+ * @returns Lanes in order of their first project, each keeping the target order
+ *
+ * @remarks
+ * Projects in one directory share its .terraform directory, including the
+ * selected workspace, so the projects of a lane run one after another while
+ * lanes may run concurrently.
+ */
+export function buildDirectoryLanes(projects: ProjectConfig[]): ProjectConfig[][] {
+  const lanes = new Map<string, ProjectConfig[]>();
+  for (const project of projects) {
+    const dir = path.normalize(project.dir);
+    const lane = lanes.get(dir) ?? [];
+    lane.push(project);
+    lanes.set(dir, lane);
+  }
+  return [...lanes.values()];
+}
+
+/**
+ * Runs a task for every item, with at most `limit` tasks running at a time
+ *
+ * @param items - Items to process
+ * @param limit - Most tasks running at the same time (1 runs the items one after another)
+ * @param task - Task run for each item; it should report failures in its result rather than throw
+ * @returns Results in the order of the items
+ */
+export async function runWithConcurrency<T, R>(
+  items: T[],
+  limit: number,
+  task: (item: T) => Promise<R>
+): Promise<R[]> {
+  const results: R[] = new Array(items.length);
+  let next = 0;
+
+  const worker = async (): Promise<void> => {
+    while (next < items.length) {
+      const index = next++;
+      results[index] = await task(items[index]);
+    }
+  };
+
+  const workers = Array.from({ length: Math.min(limit, items.length) }, worker);
+  await Promise.all(workers);
+  return results;
+}
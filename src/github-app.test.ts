@@ -0,0 +1,140 @@
+/**
+ * Unit tests for GitHub App authentication and installation token refresh
+ */
+
+import * as core from '@actions/core';
+import * as github from '@actions/github';
+import * as crypto from 'node:crypto';
+import {
+  authenticateAsApp,
+  clearAppAuthentication,
+  createAppJwt,
+  latestToken,
+  refreshAppToken,
+  TOKEN_REFRESH_MARGIN_MS,
+} from './github-app';
+
+// Mock the @actions modules
+jest.mock('@actions/core');
+jest.mock('@actions/github');
+
+describe('github-app', () => {
+  const mockCore = core as jest.Mocked<typeof core>;
+  const mockGithub = github as jest.Mocked<typeof github>;
+
+  const { privateKey, publicKey } = crypto.generateKeyPairSync('rsa', { modulusLength: 2048 });
+  const pem = privateKey.export({ type: 'pkcs1', format: 'pem' }).toString();
+
+  let getRepoInstallation: jest.Mock;
+  let createInstallationAccessToken: jest.Mock;
+
+  /**
+   * Replies to the installation token request with the given token, expiring an hour from now
+   */
+  function mintToken(token: string, expiresAt: Date = new Date(Date.now() + 3_600_000)): void {
+    createInstallationAccessToken.mockResolvedValueOnce({
+      data: { token, expires_at: expiresAt.toISOString() },
+    });
+  }
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    clearAppAuthentication();
+    delete process.env.GITHUB_TOKEN;
+    getRepoInstallation = jest.fn().mockResolvedValue({ data: { id: 99 } });
+    createInstallationAccessToken = jest.fn();
+    mockGithub.getOctokit.mockReturnValue({
+      rest: { apps: { getRepoInstallation, createInstallationAccessToken } },
+    } as unknown as ReturnType<typeof github.getOctokit>);
+  });
+
+  afterEach(() => {
+    clearAppAuthentication();
+    delete process.env.GITHUB_TOKEN;
+  });
+
+  describe('createAppJwt', () => {
+    it('should sign the app id with the private key', () => {
+      const now = Date.UTC(2024, 0, 1);
+
+      const [header, payload, signature] = createAppJwt('123', pem, now).split('.');
+
+      expect(JSON.parse(Buffer.from(header, 'base64url').toString())).toEqual({
+        alg: 'RS256',
+        typ: 'JWT',
+      });
+      expect(JSON.parse(Buffer.from(payload, 'base64url').toString())).toEqual({
+        iat: now / 1000 - 60,
+        exp: now / 1000 + 540,
+        iss: '123',
+      });
+      const verified = crypto
+        .createVerify('RSA-SHA256')
+        .update(`${header}.${payload}`)
+        .verify(publicKey, Buffer.from(signature, 'base64url'));
+      expect(verified).toBe(true);
+    });
+
+    it('should accept a private key with escaped newlines', () => {
+      const escaped = pem.replace(/\n/g, '\\n');
+
+      expect(createAppJwt('123', escaped, 0)).toBe(createAppJwt('123', pem, 0));
+    });
+  });
+
+  describe('authenticateAsApp', () => {
+    it('should mint an installation token for the repository', async () => {
+      mintToken('ghs_first');
+
+      const token = await authenticateAsApp('123', pem, 'acme', 'infra');
+
+      expect(token).toBe('ghs_first');
+      expect(getRepoInstallation).toHaveBeenCalledWith({ owner: 'acme', repo: 'infra' });
+      expect(createInstallationAccessToken).toHaveBeenCalledWith({ installation_id: 99 });
+      expect(mockCore.setSecret).toHaveBeenCalledWith('ghs_first');
+    });
+
+    it('should fail when the app is not installed on the repository', async () => {
+      getRepoInstallation.mockRejectedValueOnce(new Error('Not Found'));
+
+      await expect(authenticateAsApp('123', pem, 'acme', 'infra')).rejects.toThrow(
+        'GitHub App 123 is not installed on acme/infra or its private key is wrong: Not Found'
+      );
+      expect(createInstallationAccessToken).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('refreshAppToken', () => {
+    it('should do nothing without an app', async () => {
+      expect(await refreshAppToken()).toBeUndefined();
+      expect(createInstallationAccessToken).not.toHaveBeenCalled();
+    });
+
+    it('should keep a token that is not about to expire', async () => {
+      const expiresAt = new Date(Date.now() + 3_600_000);
+      mintToken('ghs_first', expiresAt);
+      await authenticateAsApp('123', pem, 'acme', 'infra');
+
+      const token = await refreshAppToken(expiresAt.getTime() - TOKEN_REFRESH_MARGIN_MS - 1);
+
+      expect(token).toBe('ghs_first');
+      expect(createInstallationAccessToken).toHaveBeenCalledTimes(1);
+    });
+
+    it('should mint a new token close to expiry and hand it to existing holders', async () => {
+      const expiresAt = new Date(Date.now() + 3_600_000);
+      mintToken('ghs_first', expiresAt);
+      mintToken('ghs_second');
+      await authenticateAsApp('123', pem, 'acme', 'infra');
+
+      const token = await refreshAppToken(expiresAt.getTime() - TOKEN_REFRESH_MARGIN_MS);
+
+      expect(token).toBe('ghs_second');
+      expect(createInstallationAccessToken).toHaveBeenLastCalledWith({ installation_id: 99 });
+      expect(mockCore.setSecret).toHaveBeenCalledWith('ghs_second');
+      expect(process.env.GITHUB_TOKEN).toBe('ghs_second');
+      expect(latestToken('ghs_first')).toBe('ghs_second');
+      expect(latestToken('ghp_personal')).toBe('ghp_personal');
+    });
+  });
+});
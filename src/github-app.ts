@@ -0,0 +1,212 @@
+/**
+ * Authentication as a GitHub App, with installation tokens refreshed during the run
+ */
+
+import * as crypto from 'node:crypto';
+import * as core from '@actions/core';
+import * as github from '@actions/github';
+
+/**
+ * Time before an installation token expires at which a new one is minted
+ *
+ * @remarks
+ * Installation tokens last an hour. tfcmt reads the token when it starts, so an apply
+ * started with a token this close to expiry can still comment when it finishes.
+ */
+export const TOKEN_REFRESH_MARGIN_MS = 45 * 60_000;
+
+/**
+ * Wait before trying again when minting a new installation token fails
+ */
+const REFRESH_RETRY_DELAY_MS = 60_000;
+
+/**
+ * Installation token minted for the app
+ */
+export interface InstallationToken {
+  /** Token for API calls */
+  token: string;
+  /** When GitHub stops accepting the token */
+  expiresAt: Date;
+}
+
+/**
+ * App the run authenticates as, and its current installation token
+ */
+interface AppAuthentication {
+  appId: string;
+  privateKey: string;
+  installationId: number;
+  current: InstallationToken;
+  timer?: ReturnType<typeof setTimeout>;
+}
+
+let app: AppAuthentication | null = null;
+
+/**
+ * Every token minted during the run, so that clients created with an older one use the latest
+ */
+const mintedTokens = new Set<string>();
+
+/**
+ * Creates the JSON Web Token an app authenticates with to mint installation tokens
+ *
+ * @param appId - App ID (or client ID)
+ * @param privateKey - PEM private key of the app (literal \n sequences are allowed)
+ * @param now - Current time in milliseconds (for tests)
+ * @returns JWT signed with RS256, valid for 9 minutes
+ *
+ * @remarks
+ * The token is issued a minute in the past to allow for clock drift, as GitHub
+ * recommends, and GitHub rejects tokens valid for more than 10 minutes.
+ */
+export function createAppJwt(appId: string, privateKey: string, now: number = Date.now()): string {
+  const issuedAt = Math.floor(now / 1000) - 60;
+  const encode = (value: object): string =>
+    Buffer.from(JSON.stringify(value)).toString('base64url');
+  const header = encode({ alg: 'RS256', typ: 'JWT' });
+  const unsigned = `${header}.${encode({ iat: issuedAt, exp: issuedAt + 600, iss: appId })}`;
+  const signature = crypto
+    .createSign('RSA-SHA256')
+    .update(unsigned)
+    .sign(privateKey.replace(/\\n/g, '\n'))
+    .toString('base64url');
+  return `${unsigned}.${signature}`;
+}
+
+/**
+ * Mints an installation token of the app
+ *
+ * @param appId - App ID
+ * @param privateKey - PEM private key of the app
+ * @param installationId - Installation to mint the token for
+ * @returns Installation token and its expiry
+ * @throws Error if GitHub refuses the app's credentials
+ */
+export async function createInstallationToken(
+  appId: string,
+  privateKey: string,
+  installationId: number
+): Promise<InstallationToken> {
+  const octokit = github.getOctokit(createAppJwt(appId, privateKey));
+  const { data } = await octokit.rest.apps.createInstallationAccessToken({
+    installation_id: installationId,
+  });
+  core.setSecret(data.token);
+  return { token: data.token, expiresAt: new Date(data.expires_at) };
+}
+
+/**
+ * Authenticates as a GitHub App installed on the repository
+ *
+ * @param appId - App ID
+ * @param privateKey - PEM private key of the app
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @returns Installation token used as the run's token
+ * @throws Error if the app is not installed on the repository or its credentials are wrong
+ *
+ * @remarks
+ * The token is refreshed in the background before it expires, so long runs keep a valid
+ * token: clients created afterwards and commands started afterwards use the new one.
+ */
+export async function authenticateAsApp(
+  appId: string,
+  privateKey: string,
+  owner: string,
+  repo: string
+): Promise<string> {
+  let installationId: number;
+  try {
+    const octokit = github.getOctokit(createAppJwt(appId, privateKey));
+    const { data } = await octokit.rest.apps.getRepoInstallation({ owner, repo });
+    installationId = data.id;
+  } catch (error) {
+    throw new Error(
+      `GitHub App ${appId} is not installed on ${owner}/${repo} or its private key is wrong: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+
+  clearAppAuthentication();
+  const current = await createInstallationToken(appId, privateKey, installationId);
+  app = { appId, privateKey, installationId, current };
+  mintedTokens.add(current.token);
+  scheduleRefresh();
+  core.info(`Authenticated as GitHub App ${appId} (installation ${installationId})`);
+
+  return current.token;
+}
+
+/**
+ * Mints a new installation token when the current one is about to expire
+ *
+ * @param now - Current time in milliseconds (for tests)
+ * @returns The current token, or undefined when the run does not authenticate as an app
+ */
+export async function refreshAppToken(now: number = Date.now()): Promise<string | undefined> {
+  if (!app) {
+    return undefined;
+  }
+  if (app.current.expiresAt.getTime() - now > TOKEN_REFRESH_MARGIN_MS) {
+    return app.current.token;
+  }
+
+  const { appId, privateKey, installationId } = app;
+  const refreshed = await createInstallationToken(appId, privateKey, installationId);
+  if (app) {
+    app.current = refreshed;
+    mintedTokens.add(refreshed.token);
+    // Commands started from now on (e.g., tfcmt) read the token from the environment
+    process.env.GITHUB_TOKEN = refreshed.token;
+    core.info(`Refreshed the installation token of GitHub App ${appId}`);
+  }
+  return refreshed.token;
+}
+
+/**
+ * Returns the latest token for a token of the run
+ *
+ * @param token - Token a caller was given
+ * @returns The current installation token if the given one was minted for the app,
+ *   otherwise the given token
+ */
+export function latestToken(token: string): string {
+  return app && mintedTokens.has(token) ? app.current.token : token;
+}
+
+/**
+ * Stops refreshing and forgets the app (for tests)
+ */
+export function clearAppAuthentication(): void {
+  if (app?.timer) {
+    clearTimeout(app.timer);
+  }
+  app = null;
+  mintedTokens.clear();
+}
+
+/**
+ * Refreshes the token once it is within the refresh margin of its expiry
+ *
+ * @param retryDelay - Wait before trying again after a failed refresh
+ */
+function scheduleRefresh(retryDelay?: number): void {
+  if (!app) {
+    return;
+  }
+  const delay =
+    retryDelay ?? app.current.expiresAt.getTime() - Date.now() - TOKEN_REFRESH_MARGIN_MS;
+  app.timer = setTimeout(async () => {
+    try {
+      await refreshAppToken();
+      scheduleRefresh();
+    } catch (error) {
+      core.warning(
+        `Failed to refresh the GitHub App token: ${error instanceof Error ? error.message : String(error)}`
+      );
+      scheduleRefresh(REFRESH_RETRY_DELAY_MS);
+    }
+  }, Math.max(0, delay));
+  // A pending refresh must not keep the action running
+  app.timer.unref?.();
+}
@@ -0,0 +1,308 @@
+/**
+ * Unit tests for the GitHub API client and rate limit throttling
+ */
+
+import * as core from '@actions/core';
+import * as github from '@actions/github';
+import {
+  clearRateLimitState,
+  fetchRepositoryFile,
+  formatRateLimitState,
+  getClient,
+  getRateLimitState,
+  MAX_RATE_LIMIT_RETRIES,
+  RATE_LIMIT_RETRY_BACKOFF_MS,
+  RATE_LIMIT_THRESHOLD,
+  rateLimitDelay,
+  rateLimitRetryDelay,
+  recordRateLimit,
+} from './github-client';
+
+// Mock the @actions modules
+jest.mock('@actions/core');
+jest.mock('@actions/github');
+
+describe('github-client', () => {
+  const mockCore = core as jest.Mocked<typeof core>;
+  const mockGithub = github as jest.Mocked<typeof github>;
+
+  // 2024-01-01T00:00:00Z in epoch seconds
+  const reset = 1704067200;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    clearRateLimitState();
+  });
+
+  describe('recordRateLimit', () => {
+    it('should record the rate limit by resource', () => {
+      recordRateLimit({
+        'x-ratelimit-limit': '5000',
+        'x-ratelimit-remaining': '4990',
+        'x-ratelimit-reset': String(reset),
+        'x-ratelimit-resource': 'core',
+      });
+
+      expect(getRateLimitState()).toEqual({
+        resource: 'core',
+        limit: 5000,
+        remaining: 4990,
+        resetAt: new Date(reset * 1000),
+      });
+      expect(getRateLimitState('search')).toBeUndefined();
+    });
+
+    it('should ignore responses without rate limit headers', () => {
+      recordRateLimit({ 'content-type': 'application/json' });
+      recordRateLimit(undefined);
+
+      expect(getRateLimitState()).toBeUndefined();
+    });
+  });
+
+  describe('formatRateLimitState', () => {
+    it('should describe the remaining requests and the reset time', () => {
+      expect(
+        formatRateLimitState({
+          resource: 'core',
+          limit: 5000,
+          remaining: 4990,
+          resetAt: new Date(reset * 1000),
+        })
+      ).toBe(
+        'GitHub API rate limit (core): 4990/5000 remaining, resets at 2024-01-01T00:00:00.000Z'
+      );
+    });
+  });
+
+  describe('rateLimitDelay', () => {
+    const now = reset * 1000 - 60_000;
+
+    it('should not wait while enough requests remain', () => {
+      recordRateLimit({
+        'x-ratelimit-limit': '5000',
+        'x-ratelimit-remaining': String(RATE_LIMIT_THRESHOLD),
+        'x-ratelimit-reset': String(reset),
+      });
+
+      expect(rateLimitDelay('core', now)).toBe(0);
+      expect(rateLimitDelay('search', now)).toBe(0);
+    });
+
+    it('should wait until the reset once requests run low', () => {
+      recordRateLimit({
+        'x-ratelimit-limit': '5000',
+        'x-ratelimit-remaining': String(RATE_LIMIT_THRESHOLD - 1),
+        'x-ratelimit-reset': String(reset),
+      });
+
+      expect(rateLimitDelay('core', now)).toBe(61_000);
+    });
+  });
+
+  describe('rateLimitRetryDelay', () => {
+    const now = reset * 1000 - 60_000;
+
+    /**
+     * Builds a request error with the given status, message and headers
+     */
+    function requestError(status: number, message: string, headers: Record<string, string> = {}) {
+      return Object.assign(new Error(message), { status, response: { headers } });
+    }
+
+    it('should wait as long as the retry-after header says', () => {
+      const error = requestError(429, 'Too Many Requests', { 'retry-after': '30' });
+
+      expect(rateLimitRetryDelay(error, 0, now)).toBe(30_000);
+    });
+
+    it('should wait for the reset of an exhausted rate limit', () => {
+      const error = requestError(403, 'API rate limit exceeded', {
+        'x-ratelimit-remaining': '0',
+        'x-ratelimit-reset': String(reset),
+      });
+
+      expect(rateLimitRetryDelay(error, 0, now)).toBe(61_000);
+    });
+
+    it('should back off exponentially after a secondary rate limit', () => {
+      const error = requestError(403, 'You have exceeded a secondary rate limit');
+
+      expect(rateLimitRetryDelay(error, 0, now)).toBe(RATE_LIMIT_RETRY_BACKOFF_MS);
+      expect(rateLimitRetryDelay(error, 1, now)).toBe(RATE_LIMIT_RETRY_BACKOFF_MS * 2);
+    });
+
+    it('should not retry other errors or once the retries are used up', () => {
+      const forbidden = requestError(403, 'Resource not accessible by integration');
+      const tooManyRequests = requestError(429, 'Too Many Requests');
+
+      expect(rateLimitRetryDelay(forbidden, 0)).toBeNull();
+      expect(rateLimitRetryDelay(requestError(500, 'Server Error'), 0)).toBeNull();
+      expect(rateLimitRetryDelay(tooManyRequests, MAX_RATE_LIMIT_RETRIES)).toBeNull();
+    });
+  });
+
+  describe('getClient', () => {
+    type Hook = (arg: any, options?: any) => unknown;
+
+    const hooks: Record<string, Hook> = {};
+    const octokit = {
+      hook: {
+        before: (_name: string, hook: Hook) => {
+          hooks.before = hook;
+        },
+        after: (_name: string, hook: Hook) => {
+          hooks.after = hook;
+        },
+        error: (_name: string, hook: Hook) => {
+          hooks.error = hook;
+        },
+        wrap: (_name: string, hook: Hook) => {
+          hooks.wrap = hook;
+        },
+      },
+    };
+
+    beforeEach(() => {
+      mockGithub.getOctokit.mockImplementation(((
+        _token: string,
+        _options: unknown,
+        plugin: (o: typeof octokit) => void
+      ) => {
+        plugin(octokit);
+        return octokit;
+      }) as any);
+    });
+
+    afterEach(() => {
+      jest.useRealTimers();
+    });
+
+    it('should record rate limits from responses and errors', () => {
+      getClient('token');
+
+      hooks.after({
+        headers: {
+          'x-ratelimit-limit': '5000',
+          'x-ratelimit-remaining': '4000',
+          'x-ratelimit-reset': String(reset),
+        },
+      });
+      expect(getRateLimitState()?.remaining).toBe(4000);
+
+      const error = Object.assign(new Error('Forbidden'), {
+        response: {
+          headers: {
+            'x-ratelimit-limit': '5000',
+            'x-ratelimit-remaining': '0',
+            'x-ratelimit-reset': String(reset),
+          },
+        },
+      });
+      expect(() => hooks.error(error)).toThrow('Forbidden');
+      expect(getRateLimitState()?.remaining).toBe(0);
+    });
+
+    it('should wait for the reset before a request when the limit is low', async () => {
+      jest.useFakeTimers({ now: reset * 1000 - 10_000 });
+      getClient('token');
+      recordRateLimit({
+        'x-ratelimit-limit': '5000',
+        'x-ratelimit-remaining': '3',
+        'x-ratelimit-reset': String(reset),
+      });
+
+      let done = false;
+      const waiting = Promise.resolve(hooks.before({ url: '/repos/{owner}/{repo}/pulls' })).then(
+        () => {
+          done = true;
+        }
+      );
+
+      await jest.advanceTimersByTimeAsync(10_000);
+      expect(done).toBe(false);
+      await jest.advanceTimersByTimeAsync(1_000);
+      await waiting;
+
+      expect(done).toBe(true);
+      expect(mockCore.warning).toHaveBeenCalledWith(expect.stringContaining('3/5000 remaining'));
+      expect(getRateLimitState()).toBeUndefined();
+    });
+
+    it('should retry a request rejected by a rate limit', async () => {
+      jest.useFakeTimers();
+      getClient('token');
+      const rateLimited = Object.assign(new Error('Too Many Requests'), {
+        status: 429,
+        response: { headers: { 'retry-after': '5' } },
+      });
+      const request = jest
+        .fn()
+        .mockRejectedValueOnce(rateLimited)
+        .mockResolvedValueOnce({ status: 200 });
+
+      const response = hooks.wrap(request, { method: 'POST', url: '/repos/{owner}/{repo}/issues' });
+      await jest.advanceTimersByTimeAsync(5_000);
+
+      await expect(response).resolves.toEqual({ status: 200 });
+      expect(request).toHaveBeenCalledTimes(2);
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'GitHub API POST /repos/{owner}/{repo}/issues was rate limited, retry 1 of 3 in 5s'
+      );
+    });
+
+    it('should not retry other errors', async () => {
+      getClient('token');
+      const notFound = Object.assign(new Error('Not Found'), { status: 404 });
+      const request = jest.fn().mockRejectedValue(notFound);
+
+      await expect(
+        hooks.wrap(request, { method: 'GET', url: '/repos/{owner}/{repo}' })
+      ).rejects.toThrow('Not Found');
+      expect(request).toHaveBeenCalledTimes(1);
+    });
+  });
+
+  describe('fetchRepositoryFile', () => {
+    const mockOctokit = { rest: { repos: { getContent: jest.fn() } } };
+
+    beforeEach(() => {
+      mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+    });
+
+    it('should decode the file at the ref', async () => {
+      mockOctokit.rest.repos.getContent.mockResolvedValueOnce({
+        data: { type: 'file', content: Buffer.from('projects: []\n').toString('base64') },
+      });
+
+      const content = await fetchRepositoryFile('token', 'owner', 'repo', 'config.yaml', 'main');
+
+      expect(content).toBe('projects: []\n');
+      expect(mockOctokit.rest.repos.getContent).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        path: 'config.yaml',
+        ref: 'main',
+      });
+    });
+
+    it('should return null for a missing file or a directory', async () => {
+      mockOctokit.rest.repos.getContent
+        .mockRejectedValueOnce(Object.assign(new Error('Not Found'), { status: 404 }))
+        .mockResolvedValueOnce({ data: [] });
+
+      await expect(fetchRepositoryFile('token', 'owner', 'repo', 'a', 'main')).resolves.toBeNull();
+      await expect(fetchRepositoryFile('token', 'owner', 'repo', 'b', 'main')).resolves.toBeNull();
+    });
+
+    it('should throw other API errors', async () => {
+      mockOctokit.rest.repos.getContent.mockRejectedValueOnce(
+        Object.assign(new Error('Bad credentials'), { status: 401 })
+      );
+
+      await expect(fetchRepositoryFile('token', 'owner', 'repo', 'a', 'main')).rejects.toThrow(
+        'Bad credentials'
+      );
+    });
+  });
+});
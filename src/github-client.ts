@@ -0,0 +1,261 @@
+/**
+ * GitHub API client with proactive rate limit throttling
+ */
+
+import * as core from '@actions/core';
+import * as github from '@actions/github';
+import { latestToken } from './github-app';
+
+/**
+ * Remaining requests below which calls wait for the rate limit to reset
+ */
+export const RATE_LIMIT_THRESHOLD = 50;
+
+/**
+ * Retries of a request rejected by a rate limit
+ */
+export const MAX_RATE_LIMIT_RETRIES = 3;
+
+/**
+ * Delay before the first retry when GitHub does not say how long to wait, doubled for every
+ * further retry (GitHub asks to wait at least a minute after a secondary rate limit)
+ */
+export const RATE_LIMIT_RETRY_BACKOFF_MS = 60_000;
+
+/**
+ * Rate limit of a GitHub API resource, as last reported by the API
+ */
+export interface RateLimitState {
+  /** Rate limit resource (e.g., core, search, graphql) */
+  resource: string;
+  /** Requests allowed per window */
+  limit: number;
+  /** Requests left in the current window */
+  remaining: number;
+  /** When the window resets */
+  resetAt: Date;
+}
+
+type OctokitPlugin = NonNullable<Parameters<typeof github.getOctokit>[2]>;
+
+/**
+ * Last reported rate limit by resource (shared by every client in the run)
+ */
+const rateLimits = new Map<string, RateLimitState>();
+
+/**
+ * Creates an authenticated GitHub API client
+ *
+ * @param token - GitHub token for API access
+ * @returns Octokit client that waits for the rate limit to reset when it runs low
+ *
+ * @remarks
+ * Rate limit headers are recorded after every response, including errors, and
+ * are shared across clients since they all count against the same token.
+ * Calls are delayed before they would fail, and a call rejected by a rate limit anyway
+ * (429, or a secondary rate limit) is retried after the wait GitHub asks for.
+ * A GitHub App installation token is swapped for the latest one minted in the run.
+ */
+export function getClient(token: string): ReturnType<typeof github.getOctokit> {
+  return github.getOctokit(latestToken(token), {}, rateLimitPlugin);
+}
+
+/**
+ * Fetches a file of the repository at a given ref
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param filePath - Path relative to the repository root
+ * @param ref - Branch, tag or commit to read the file from (default: the default branch)
+ * @returns File contents, or null if there is no file at that path
+ * @throws Error if the API call fails for another reason than a missing file
+ */
+export async function fetchRepositoryFile(
+  token: string,
+  owner: string,
+  repo: string,
+  filePath: string,
+  ref?: string
+): Promise<string | null> {
+  const octokit = getClient(token);
+
+  try {
+    const { data } = await octokit.rest.repos.getContent({ owner, repo, path: filePath, ref });
+    if (!Array.isArray(data) && data.type === 'file') {
+      return Buffer.from(data.content, 'base64').toString('utf8');
+    }
+    return null;
+  } catch (error) {
+    if ((error as { status?: number }).status === 404) {
+      return null;
+    }
+    throw error;
+  }
+}
+
+/**
+ * Returns the last reported rate limit of a resource
+ *
+ * @param resource - Rate limit resource (default: core)
+ * @returns Rate limit state, or undefined if no response has reported it yet
+ */
+export function getRateLimitState(resource = 'core'): RateLimitState | undefined {
+  return rateLimits.get(resource);
+}
+
+/**
+ * Formats the rate limit state for the log
+ *
+ * @example
+ * formatRateLimitState({ resource: 'core', limit: 5000, remaining: 4990, resetAt })
+ * // => 'GitHub API rate limit (core): 4990/5000 remaining, resets at 2024-01-01T00:00:00.000Z'
+ */
+export function formatRateLimitState(state: RateLimitState): string {
+  return `GitHub API rate limit (${state.resource}): ${state.remaining}/${state.limit} remaining, resets at ${state.resetAt.toISOString()}`;
+}
+
+/**
+ * Records the rate limit reported by a response
+ *
+ * @param headers - Response headers (x-ratelimit-*)
+ */
+export function recordRateLimit(headers: Record<string, unknown> | undefined): void {
+  const limit = Number(headers?.['x-ratelimit-limit']);
+  const remaining = Number(headers?.['x-ratelimit-remaining']);
+  const reset = Number(headers?.['x-ratelimit-reset']);
+  if (
+    !headers ||
+    !Number.isFinite(limit) ||
+    !Number.isFinite(remaining) ||
+    !Number.isFinite(reset)
+  ) {
+    return;
+  }
+
+  const resource =
+    typeof headers['x-ratelimit-resource'] === 'string' ? headers['x-ratelimit-resource'] : 'core';
+  rateLimits.set(resource, { resource, limit, remaining, resetAt: new Date(reset * 1000) });
+}
+
+/**
+ * Milliseconds to wait before calling a resource
+ *
+ * @param resource - Rate limit resource
+ * @param now - Current time in milliseconds (for tests)
+ * @returns 0 while enough requests remain, otherwise the time until the reset
+ */
+export function rateLimitDelay(resource: string, now: number = Date.now()): number {
+  const state = rateLimits.get(resource);
+  if (!state || state.remaining >= RATE_LIMIT_THRESHOLD) {
+    return 0;
+  }
+  // A second of slack, since the reset time is rounded to seconds
+  return Math.max(0, state.resetAt.getTime() - now + 1000);
+}
+
+/**
+ * Milliseconds to wait before retrying a request that failed
+ *
+ * @param error - Request error
+ * @param retries - Retries of the request so far
+ * @param now - Current time in milliseconds (for tests)
+ * @returns Delay before the retry, or null if the error is not a rate limit or the retries
+ *   are used up
+ *
+ * @remarks
+ * The retry-after header is used when present, then the reset of an exhausted primary
+ * rate limit, and otherwise a backoff that doubles with every retry.
+ */
+export function rateLimitRetryDelay(
+  error: unknown,
+  retries: number,
+  now: number = Date.now()
+): number | null {
+  const { status, message, response } = error as {
+    status?: number;
+    message?: string;
+    response?: { headers?: Record<string, unknown> };
+  };
+  const headers = response?.headers ?? {};
+  const exhausted = headers['x-ratelimit-remaining'] === '0';
+  const rateLimited =
+    status === 429 || (status === 403 && (exhausted || /rate limit/i.test(message ?? '')));
+  if (!rateLimited || retries >= MAX_RATE_LIMIT_RETRIES) {
+    return null;
+  }
+
+  const retryAfter = Number(headers['retry-after']);
+  if (headers['retry-after'] !== undefined && Number.isFinite(retryAfter)) {
+    return retryAfter * 1000;
+  }
+  const reset = Number(headers['x-ratelimit-reset']);
+  if (exhausted && Number.isFinite(reset)) {
+    // A second of slack, since the reset time is rounded to seconds
+    return Math.max(0, reset * 1000 - now + 1000);
+  }
+  return RATE_LIMIT_RETRY_BACKOFF_MS * 2 ** retries;
+}
+
+/**
+ * Forgets every recorded rate limit (for tests)
+ */
+export function clearRateLimitState(): void {
+  rateLimits.clear();
+}
+
+/**
+ * Rate limit resource a request counts against
+ */
+function resourceForUrl(url: string): string {
+  if (url.startsWith('/search/')) {
+    return 'search';
+  }
+  return url === '/graphql' ? 'graphql' : 'core';
+}
+
+/**
+ * Octokit plugin that waits before requests while the rate limit is low, and retries
+ * requests rejected by a rate limit
+ */
+const rateLimitPlugin: OctokitPlugin = (octokit) => {
+  octokit.hook.before('request', async (options) => {
+    const resource = resourceForUrl(options.url);
+    const delay = rateLimitDelay(resource);
+    const state = rateLimits.get(resource);
+    if (delay > 0 && state) {
+      core.warning(`${formatRateLimitState(state)}; waiting ${Math.ceil(delay / 1000)}s`);
+      await new Promise((resolve) => setTimeout(resolve, delay));
+      // The window has reset, so the old state no longer applies
+      rateLimits.delete(resource);
+    }
+  });
+
+  octokit.hook.after('request', (response) => {
+    recordRateLimit(response.headers);
+  });
+
+  octokit.hook.error('request', (error) => {
+    const { response } = error as { response?: { headers?: Record<string, unknown> } };
+    recordRateLimit(response?.headers);
+    throw error;
+  });
+
+  // Registered last so that every attempt passes through the hooks above
+  octokit.hook.wrap('request', async (request, options) => {
+    for (let retries = 0; ; retries++) {
+      try {
+        return await request(options);
+      } catch (error) {
+        const delay = rateLimitRetryDelay(error, retries);
+        if (delay === null) {
+          throw error;
+        }
+        core.warning(
+          `GitHub API ${options.method} ${options.url} was rate limited, retry ${retries + 1} of ${MAX_RATE_LIMIT_RETRIES} in ${Math.ceil(delay / 1000)}s`
+        );
+        await new Promise((resolve) => setTimeout(resolve, delay));
+      }
+    }
+  });
+};
@@ -0,0 +1,43 @@
+/**
+ * Main entry point for Terraform PR Comment Action
+ *
+ * Runs the action, or with `validate-config [path]` only checks the
+ * configuration file (for pre-commit hooks and CI jobs without a GitHub event).
+ */
+
+import { validateConfigFile } from './config';
+import { fetchRepositoryFile } from './github-client';
+import { run } from './main';
+
+const [subcommand, configPath = '.terraform-action.yaml'] = process.argv.slice(2);
+
+/**
+ * Checks the configuration file and reports every problem on stderr
+ */
+async function validateConfig(): Promise<void> {
+  // A central configuration (config_repo) is read with GITHUB_TOKEN
+  const token = process.env.GITHUB_TOKEN;
+  const problems = await validateConfigFile(configPath, (central, repoPath) => {
+    if (!token) {
+      throw new Error(
+        `Set GITHUB_TOKEN to read ${repoPath} from central repository ` +
+          `${central.owner}/${central.repo}`
+      );
+    }
+    return fetchRepositoryFile(token, central.owner, central.repo, repoPath, central.ref);
+  });
+  for (const problem of problems) {
+    console.error(`${configPath}: ${problem}`);
+  }
+  if (problems.length === 0) {
+    console.log(`${configPath}: configuration is valid`);
+  }
+  process.exitCode = problems.length > 0 ? 1 : 0;
+}
+
+if (subcommand === 'validate-config') {
+  validateConfig();
+} else {
+  // Execute main function
+  run();
+}
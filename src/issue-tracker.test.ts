@@ -0,0 +1,112 @@
+/**
+ * Unit tests for tracking issues
+ */
+
+import * as github from '@actions/github';
+import { closeIssue, findIssueByTitle, findOrCreateIssue } from './issue-tracker';
+
+// Mock the @actions modules
+jest.mock('@actions/core');
+jest.mock('@actions/github');
+
+describe('issue-tracker', () => {
+  const mockGithub = github as jest.Mocked<typeof github>;
+  const mockOctokit = {
+    paginate: jest.fn(),
+    rest: {
+      issues: {
+        listForRepo: jest.fn(),
+        create: jest.fn(),
+        update: jest.fn(),
+        createComment: jest.fn(),
+      },
+    },
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+  });
+
+  describe('findIssueByTitle', () => {
+    it('should return the open issue with a matching title', async () => {
+      mockOctokit.paginate.mockResolvedValue([
+        { number: 1, title: 'Terraform drift detected: production', pull_request: {} },
+        { number: 2, title: 'Something else' },
+        { number: 3, title: 'Terraform drift detected: production' },
+      ]);
+
+      const number = await findIssueByTitle(
+        'token',
+        'owner',
+        'repo',
+        'Terraform drift detected: production'
+      );
+
+      expect(mockOctokit.paginate).toHaveBeenCalledWith(mockOctokit.rest.issues.listForRepo, {
+        owner: 'owner',
+        repo: 'repo',
+        state: 'open',
+        per_page: 100,
+      });
+      expect(number).toBe(3);
+    });
+
+    it('should return null when no issue matches', async () => {
+      mockOctokit.paginate.mockResolvedValue([]);
+
+      expect(await findIssueByTitle('token', 'owner', 'repo', 'missing')).toBeNull();
+    });
+  });
+
+  describe('findOrCreateIssue', () => {
+    it('should update the body of an existing issue', async () => {
+      mockOctokit.paginate.mockResolvedValue([{ number: 7, title: 'title' }]);
+
+      const number = await findOrCreateIssue('token', 'owner', 'repo', 'title', 'new body');
+
+      expect(number).toBe(7);
+      expect(mockOctokit.rest.issues.update).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        issue_number: 7,
+        body: 'new body',
+      });
+      expect(mockOctokit.rest.issues.create).not.toHaveBeenCalled();
+    });
+
+    it('should create the issue when none exists', async () => {
+      mockOctokit.paginate.mockResolvedValue([]);
+      mockOctokit.rest.issues.create.mockResolvedValue({ data: { number: 8 } } as any);
+
+      const number = await findOrCreateIssue('token', 'owner', 'repo', 'title', 'body');
+
+      expect(number).toBe(8);
+      expect(mockOctokit.rest.issues.create).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        title: 'title',
+        body: 'body',
+      });
+    });
+  });
+
+  describe('closeIssue', () => {
+    it('should comment and close the issue', async () => {
+      await closeIssue('token', 'owner', 'repo', 7, 'resolved');
+
+      expect(mockOctokit.rest.issues.createComment).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        issue_number: 7,
+        body: 'resolved',
+      });
+      expect(mockOctokit.rest.issues.update).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        issue_number: 7,
+        state: 'closed',
+      });
+    });
+  });
+});
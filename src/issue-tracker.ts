@@ -0,0 +1,113 @@
+/**
+ * Tracking issues for results that have no pull request (e.g., scheduled drift detection)
+ */
+
+import * as core from '@actions/core';
+import { getClient } from './github-client';
+import { redact } from './redaction';
+
+/**
+ * Finds an open issue with exactly the given title
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param title - Issue title used as the marker
+ * @returns Issue number, or null if there is no open issue with that title
+ */
+export async function findIssueByTitle(
+  token: string,
+  owner: string,
+  repo: string,
+  title: string
+): Promise<number | null> {
+  const octokit = getClient(token);
+
+  const issues = await octokit.paginate(octokit.rest.issues.listForRepo, {
+    owner,
+    repo,
+    state: 'open',
+    per_page: 100,
+  });
+
+  // listForRepo also returns pull requests
+  const issue = issues.find((i) => !i.pull_request && i.title === title);
+
+  return issue ? issue.number : null;
+}
+
+/**
+ * Updates the open issue with the given title, or creates it
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param title - Issue title used as the marker
+ * @param body - Issue body (replaces the body of an existing issue; secrets are masked)
+ * @returns Number of the updated or created issue
+ */
+export async function findOrCreateIssue(
+  token: string,
+  owner: string,
+  repo: string,
+  title: string,
+  body: string
+): Promise<number> {
+  const octokit = getClient(token);
+
+  const existing = await findIssueByTitle(token, owner, repo, title);
+  if (existing !== null) {
+    await octokit.rest.issues.update({
+      owner,
+      repo,
+      issue_number: existing,
+      body: redact(body),
+    });
+    core.info(`Updated issue #${existing}: ${title}`);
+    return existing;
+  }
+
+  const { data: issue } = await octokit.rest.issues.create({
+    owner,
+    repo,
+    title,
+    body: redact(body),
+  });
+  core.info(`Created issue #${issue.number}: ${title}`);
+
+  return issue.number;
+}
+
+/**
+ * Comments on and closes an issue
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param issueNumber - Issue to close
+ * @param comment - Comment explaining why the issue is closed
+ */
+export async function closeIssue(
+  token: string,
+  owner: string,
+  repo: string,
+  issueNumber: number,
+  comment: string
+): Promise<void> {
+  const octokit = getClient(token);
+
+  await octokit.rest.issues.createComment({
+    owner,
+    repo,
+    issue_number: issueNumber,
+    body: redact(comment),
+  });
+  await octokit.rest.issues.update({
+    owner,
+    repo,
+    issue_number: issueNumber,
+    state: 'closed',
+  });
+
+  core.info(`Closed issue #${issueNumber}`);
+}
@@ -0,0 +1,3111 @@
+/**
+ * End-to-end tests for the action run: comment parsing, project filtering,
+ * requirement validation and command dispatch
+ */
+
+import * as core from '@actions/core';
+import * as github from '@actions/github';
+import * as fs from 'node:fs';
+import * as os from 'node:os';
+import * as path from 'node:path';
+import {
+  deleteSavedPlans,
+  downloadPlanFile,
+  hasSavedPlan,
+  uploadPlanFile,
+  verifyPlanMetadata,
+} from './artifact-manager';
+import { checkCommandAuthorization } from './authorization';
+import { reportDriftIssue } from './drift';
+import { authenticateAsApp } from './github-app';
+import { fetchRepositoryFile } from './github-client';
+import { run } from './main';
+import { sendNotification } from './notifier';
+import {
+  addReaction,
+  buildPlanChangesComment,
+  CONFIG_ERRORS_MARKER,
+  findCommentByMarker,
+  markPlanCommentsOutdated,
+  minimizeComments,
+  postComment,
+  upsertComment,
+} from './pr-comment';
+import { checkPlanPolicies } from './policy-check';
+import { deleteBranch, mergePullRequest } from './pr-merge';
+import { getChangedFiles, getPullRequestInfo } from './pr-validation';
+import { acquireProjectLock, releaseProjectLock } from './project-lock';
+import {
+  createCommitStatus,
+  getCommitStatus,
+  reportCheckRun,
+  reportCommitStatus,
+} from './reporter';
+import { type CommandRunner, setCommandRunner } from './terraform';
+import { setupTfcmt, writeTfcmtConfig } from './tfcmt';
+import type { PullRequestInfo } from './types';
+
+// Mock the @actions modules and everything that talks to GitHub
+jest.mock('@actions/core');
+jest.mock('@actions/github', () => ({ context: {}, getOctokit: jest.fn() }));
+jest.mock('./artifact-manager');
+jest.mock('./authorization', () => ({
+  ...jest.requireActual('./authorization'),
+  checkCommandAuthorization: jest.fn(),
+}));
+jest.mock('./github-app', () => ({
+  ...jest.requireActual('./github-app'),
+  authenticateAsApp: jest.fn(),
+}));
+jest.mock('./github-client', () => ({
+  ...jest.requireActual('./github-client'),
+  fetchRepositoryFile: jest.fn(),
+}));
+jest.mock('./tfcmt');
+jest.mock('./pr-comment', () => ({
+  ...jest.requireActual('./pr-comment'),
+  addReaction: jest.fn(),
+  findCommentByMarker: jest.fn(),
+  markPlanCommentsOutdated: jest.fn(),
+  minimizeComments: jest.fn(),
+  postComment: jest.fn(),
+  postReviewComment: jest.fn(),
+  upsertComment: jest.fn(),
+}));
+jest.mock('./policy-check', () => ({
+  ...jest.requireActual('./policy-check'),
+  checkPlanPolicies: jest.fn(),
+}));
+jest.mock('./drift', () => ({
+  ...jest.requireActual('./drift'),
+  reportDriftIssue: jest.fn(),
+}));
+jest.mock('./notifier');
+jest.mock('./pr-merge');
+jest.mock('./project-lock', () => ({
+  ...jest.requireActual('./project-lock'),
+  acquireProjectLock: jest.fn(),
+  releaseProjectLock: jest.fn(),
+}));
+jest.mock('./pr-validation', () => ({
+  ...jest.requireActual('./pr-validation'),
+  getChangedFiles: jest.fn(),
+  getPullRequestInfo: jest.fn(),
+}));
+jest.mock('./reporter', () => ({
+  ...jest.requireActual('./reporter'),
+  createCommitStatus: jest.fn(),
+  getCommitStatus: jest.fn(),
+  reportCheckRun: jest.fn(),
+  reportCommitStatus: jest.fn(),
+}));
+
+describe('run', () => {
+  const mockCore = core as jest.Mocked<typeof core>;
+  const mockPostComment = postComment as jest.MockedFunction<typeof postComment>;
+  const mockGetPullRequestInfo = getPullRequestInfo as jest.MockedFunction<
+    typeof getPullRequestInfo
+  >;
+
+  let tmpDir: string;
+  let calls: string[];
+
+  const pr: PullRequestInfo = {
+    number: 42,
+    owner: 'acme',
+    repo: 'infra',
+    isFork: false,
+    mergeable: true,
+    mergeability: 'mergeable',
+    approved: true,
+    sha: 'abc123',
+    diverged: false,
+    labels: [],
+    headBranch: 'feature',
+    baseBranch: 'main',
+    approvers: ['alice'],
+  };
+
+  /**
+   * Writes the action config and points the config-path input at it
+   */
+  function writeConfig(yaml: string): void {
+    const configPath = path.join(tmpDir, '.terraform-action.yaml');
+    fs.writeFileSync(configPath, yaml);
+    mockCore.getInput.mockImplementation((name: string) =>
+      name === 'github-token' ? 'ghs_token' : name === 'config-path' ? configPath : ''
+    );
+  }
+
+  /**
+   * Makes the run look like it was triggered by a PR comment
+   */
+  function commentOnPullRequest(body: string): void {
+    Object.assign(github.context, {
+      eventName: 'issue_comment',
+      payload: { issue: { number: 42, pull_request: {} }, comment: { id: 7, body } },
+      repo: { owner: 'acme', repo: 'infra' },
+      issue: { owner: 'acme', repo: 'infra', number: 42 },
+    });
+  }
+
+  /**
+   * Makes the run look like it was triggered by a push to the PR branch
+   */
+  function pushToPullRequest(): void {
+    Object.assign(github.context, {
+      eventName: 'pull_request',
+      payload: {
+        action: 'synchronize',
+        pull_request: { number: 42, head: { ref: 'feature' }, base: { ref: 'main' } },
+      },
+      repo: { owner: 'acme', repo: 'infra' },
+      issue: { owner: 'acme', repo: 'infra', number: 42 },
+    });
+  }
+
+  /**
+   * Fake runner that records command lines (tfcmt shown by name) and exits with 0,
+   * unless a prefix of the line is given another exit code or canned stdout
+   */
+  function useFakeRunner(
+    exitCodes: Record<string, number> = {},
+    stdout: Record<string, string> = {}
+  ): void {
+    const replies = { 'terraform output': '{}', ...stdout };
+    const runner: CommandRunner = async (commandLine, args = [], options) => {
+      const line = [path.basename(commandLine), ...args].join(' ');
+      calls.push(line);
+      const reply = Object.entries(replies).find(([prefix]) => line.startsWith(prefix))?.[1];
+      if (reply !== undefined) {
+        options?.listeners?.stdout?.(Buffer.from(reply));
+      }
+      return Object.entries(exitCodes).find(([prefix]) => line.startsWith(prefix))?.[1] ?? 0;
+    };
+    setCommandRunner(runner);
+  }
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    process.env.GITHUB_OUTPUT = path.join(os.tmpdir(), 'github-output');
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'terraform-action-'));
+    calls = [];
+    useFakeRunner();
+    (setupTfcmt as jest.Mock).mockResolvedValue('/opt/tfcmt');
+    mockGetPullRequestInfo.mockResolvedValue(pr);
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+  - name: production
+    dir: envs/production
+`);
+  });
+
+  afterEach(() => {
+    delete process.env.GITHUB_OUTPUT;
+    delete process.env.GITHUB_STEP_SUMMARY;
+    delete process.env.TERRAFORM_ACTION_MODE;
+    delete process.env.TF_PLUGIN_CACHE_DIR;
+    delete process.env.TFCMT_MASKS;
+    delete process.env.TFCMT_MASKS_SEPARATOR;
+    setCommandRunner();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('should plan every project for a bare plan comment', async () => {
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toEqual([
+      'terraform version',
+      'terraform init',
+      expect.stringMatching(/^tfcmt -var target:staging plan -- terraform plan -out=/),
+      'terraform init',
+      expect.stringMatching(/^tfcmt -var target:production plan -- terraform plan -out=/),
+    ]);
+    expect(uploadPlanFile).toHaveBeenCalledTimes(2);
+    expect(mockCore.setOutput).toHaveBeenCalledWith('planned-projects', 'staging,production');
+    expect(mockCore.setOutput).toHaveBeenCalledWith('has-changes', 'false');
+    // Both projects got a tfcmt comment, so only the run summary is posted
+    expect(mockPostComment).toHaveBeenCalledTimes(1);
+  });
+
+  it('should pass init_extra_args to the init of the project', async () => {
+    writeConfig(`
+projects:
+  - name: staging
+    dir: envs/staging
+    init_extra_args: [-lockfile=readonly]
+  - name: production
+    dir: envs/production
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toEqual([
+      'terraform version',
+      'terraform init -lockfile=readonly',
+      expect.stringMatching(/^tfcmt -var target:staging plan/),
+      'terraform init',
+      expect.stringMatching(/^tfcmt -var target:production plan/),
+    ]);
+  });
+
+  it('should share a provider plugin cache between inits unless plugin_cache is false', async () => {
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(process.env.TF_PLUGIN_CACHE_DIR).toBe(
+      path.join(process.env.RUNNER_TEMP || os.tmpdir(), 'terraform-plugin-cache')
+    );
+
+    writeConfig(`
+plugin_cache: false
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    await run();
+
+    expect(process.env.TF_PLUGIN_CACHE_DIR).toBeUndefined();
+  });
+
+  it('should check the terragrunt installation when a project runs with terragrunt', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    terragrunt: true
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls.slice(0, 3)).toEqual([
+      'terraform version',
+      'terragrunt --version',
+      expect.stringMatching(/^terragrunt init --terragrunt-non-interactive --terragrunt-working-dir /),
+    ]);
+  });
+
+  it('should apply a run-all project only with terragrunt_run_all_apply', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    terragrunt_run_all: true
+`);
+    commentOnPullRequest('terraform apply -project=staging');
+
+    await run();
+
+    expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('set terragrunt_run_all_apply: true to allow it')
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform apply failed for 1 of 1 project(s): staging'
+    );
+
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    terragrunt_run_all: true
+    terragrunt_run_all_apply: true
+`);
+    calls = [];
+    mockCore.setFailed.mockClear();
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toContainEqual(
+      expect.stringMatching(/^tfcmt -var target:staging apply -- terragrunt run-all apply /)
+    );
+  });
+
+  it('should render plan comments with the configured templates', async () => {
+    writeConfig(`
+output_mode: comment
+comment_templates:
+  footer: "Owned by #infra"
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    (writeTfcmtConfig as jest.Mock).mockReturnValue('/tmp/tfcmt-config.yaml');
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(writeTfcmtConfig).toHaveBeenCalledWith({ footer: 'Owned by #infra' });
+    expect(calls).toContainEqual(
+      expect.stringMatching(/^tfcmt -config \/tmp\/tfcmt-config.yaml -var target:staging plan -- /)
+    );
+  });
+
+  it('should write the results to the job summary', async () => {
+    process.env.GITHUB_STEP_SUMMARY = path.join(tmpDir, 'summary.md');
+    mockCore.summary.addRaw.mockReturnValue(mockCore.summary);
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(mockCore.summary.addRaw).toHaveBeenCalledWith(
+      expect.stringContaining('| `staging` | plan | ✅ Succeeded | - |'),
+      true
+    );
+    expect(mockCore.summary.write).toHaveBeenCalled();
+  });
+
+  it('should react to the comment when a command starts and succeeds', async () => {
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect((addReaction as jest.Mock).mock.calls).toEqual([
+      ['ghs_token', 'acme', 'infra', 7, 'eyes'],
+      ['ghs_token', 'acme', 'infra', 7, '+1'],
+    ]);
+  });
+
+  it('should react to the comment when a command fails', async () => {
+    useFakeRunner({ 'tfcmt -var target:staging plan': 1 });
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalled();
+    expect((addReaction as jest.Mock).mock.calls).toEqual([
+      ['ghs_token', 'acme', 'infra', 7, 'eyes'],
+      ['ghs_token', 'acme', 'infra', 7, '-1'],
+    ]);
+  });
+
+  it('should not react with reactions disabled or to comments without a command', async () => {
+    writeConfig(`
+reactions: false
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    commentOnPullRequest('terraform plan');
+    await run();
+
+    writeConfig(`
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    commentOnPullRequest('LGTM');
+    await run();
+
+    expect(addReaction).not.toHaveBeenCalled();
+  });
+
+  it('should plan every project on a pull request event without autoplan settings', async () => {
+    pushToPullRequest();
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(getChangedFiles).not.toHaveBeenCalled();
+    expect(mockCore.setOutput).toHaveBeenCalledWith('planned-projects', 'staging,production');
+  });
+
+  it('should autoplan only the projects whose files changed', async () => {
+    (getChangedFiles as jest.Mock).mockResolvedValue(['envs/staging/main.tf', 'README.md']);
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    autoplan:
+      enabled: true
+      when_modified: ["*.tf"]
+  - name: production
+    dir: envs/production
+    autoplan:
+      enabled: true
+      when_modified: ["*.tf"]
+  - name: sandbox
+    dir: envs/sandbox
+    autoplan:
+      enabled: false
+      when_modified: ["../**"]
+`);
+    pushToPullRequest();
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(getChangedFiles).toHaveBeenCalledWith('ghs_token', 'acme', 'infra', 42);
+    expect(calls).toEqual([
+      'terraform version',
+      'terraform init',
+      expect.stringMatching(/^tfcmt -var target:staging plan -- terraform plan -out=/),
+    ]);
+  });
+
+  it('should skip the run when no autoplan matches the changed files', async () => {
+    (getChangedFiles as jest.Mock).mockResolvedValue(['docs/index.md']);
+    writeConfig(`
+projects:
+  - name: staging
+    dir: envs/staging
+    autoplan:
+      enabled: true
+      when_modified: ["*.tf"]
+`);
+    pushToPullRequest();
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toEqual(['terraform version']);
+  });
+
+  it('should check every project for drift in drift mode, whatever the event', async () => {
+    process.env.TERRAFORM_ACTION_MODE = 'drift';
+    useFakeRunner(
+      { 'terraform plan': 2 },
+      {
+        'terraform plan':
+          '  # aws_instance.web will be updated in-place\n\nPlan: 0 to add, 1 to change, 0 to destroy.',
+      }
+    );
+    writeConfig(`
+notifications:
+  webhook_url: https://hooks.example.com/terraform
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    Object.assign(github.context, {
+      eventName: 'push',
+      payload: {},
+      repo: { owner: 'acme', repo: 'infra' },
+      issue: { owner: 'acme', repo: 'infra', number: undefined },
+    });
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toContainEqual(expect.stringMatching(/^terraform plan -detailed-exitcode/));
+    expect(reportDriftIssue).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      {
+        project: 'staging',
+        drifted: true,
+        summary: { add: 0, change: 1, destroy: 0 },
+        changes: [{ address: 'aws_instance.web', actions: ['update'] }],
+      },
+      expect.any(String),
+      expect.any(String)
+    );
+    expect(sendNotification).toHaveBeenCalledWith(
+      { webhook_url: 'https://hooks.example.com/terraform' },
+      expect.objectContaining({ project: 'staging', command: 'drift', status: 'drifted' })
+    );
+    expect(mockCore.setOutput).toHaveBeenCalledWith('drifted-projects', 'staging');
+  });
+
+  it('should reject an unknown mode', async () => {
+    process.env.TERRAFORM_ACTION_MODE = 'nightly';
+    pushToPullRequest();
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith('Invalid mode: nightly. Must be one of: drift');
+    expect(calls).toEqual([]);
+  });
+
+  it('should not save a destroy preview for apply', async () => {
+    commentOnPullRequest('terraform plan -destroy -project=staging');
+
+    await run();
+
+    expect(calls).toContainEqual(
+      expect.stringMatching(/^tfcmt -var target:staging plan -- terraform plan -out=\S+ -destroy/)
+    );
+    expect(uploadPlanFile).not.toHaveBeenCalled();
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('Destroy preview for project `staging`')
+    );
+  });
+
+  it('should only run the projects named in the comment', async () => {
+    commentOnPullRequest('terraform plan -project=production');
+
+    await run();
+
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+      expect.stringContaining('target:production'),
+    ]);
+    expect(mockPostComment).not.toHaveBeenCalled();
+  });
+
+  it('should run tagged projects together with the named ones', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: vpc
+    dir: envs/vpc
+    tags: [networking]
+  - name: staging
+    dir: envs/staging
+  - name: dns
+    dir: envs/dns
+    tags: [networking]
+    enabled: false
+  - name: production
+    dir: envs/production
+    tags: [networking]
+`);
+    commentOnPullRequest('terraform plan -project=production,staging -tag=networking');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    // production is named and tagged but runs once; the disabled dns is skipped
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+      expect.stringContaining('target:production'),
+      expect.stringContaining('target:staging'),
+      expect.stringContaining('target:vpc'),
+    ]);
+  });
+
+  it('should select each project workspace and narrow targets with -w', async () => {
+    useFakeRunner({ 'terraform workspace select prod': 1 });
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: network-dev
+    dir: envs/network
+    workspace: dev
+  - name: network-prod
+    dir: envs/network
+    workspace: prod
+  - name: dns
+    dir: envs/dns
+`);
+    commentOnPullRequest('terraform plan -w=prod');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    // prod does not exist yet, so it is created
+    expect(calls).toEqual([
+      'terraform version',
+      'terraform init',
+      'terraform workspace select prod',
+      'terraform workspace new prod',
+      expect.stringMatching(/^tfcmt -var target:network-prod plan -- terraform plan -out=/),
+    ]);
+  });
+
+  it('should run the custom workflow of a project instead of init and plan', async () => {
+    writeConfig(`
+output_mode: comment
+workflows:
+  checked:
+    plan:
+      steps:
+        - run: make lint
+        - init
+        - plan
+        - run: conftest test "$PLANFILE"
+projects:
+  - name: staging
+    dir: envs/staging
+    workflow: checked
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toEqual([
+      'terraform version',
+      'bash -c make lint',
+      'terraform init -no-color -input=false',
+      expect.stringMatching(/^tfcmt -var target:staging plan -- terraform plan -out=/),
+      'bash -c conftest test "$PLANFILE"',
+    ]);
+  });
+
+  it('should report a failed workflow step without running the rest', async () => {
+    useFakeRunner({ 'bash -c make lint': 2 });
+    writeConfig(`
+output_mode: comment
+workflows:
+  checked:
+    plan:
+      steps: [{ run: make lint }, init, plan]
+projects:
+  - name: staging
+    dir: envs/staging
+    workflow: checked
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform plan failed for 1 of 1 project(s): staging'
+    );
+    expect(mockCore.error).toHaveBeenCalledWith(
+      expect.stringContaining('terraform plan failed for project staging: '),
+      { title: 'terraform plan failed: staging' }
+    );
+    expect(calls).toEqual(['terraform version', 'bash -c make lint']);
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('terraform plan workflow step failed for project `staging`')
+    );
+  });
+
+  it('should run OpenTofu for projects choosing tofu', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    binary: tofu
+  - name: production
+    dir: envs/production
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toEqual([
+      'tofu version',
+      'terraform version',
+      'tofu init',
+      expect.stringMatching(/^tfcmt -var target:staging plan -- tofu plan -out=/),
+      'terraform init',
+      expect.stringMatching(/^tfcmt -var target:production plan -- terraform plan -out=/),
+    ]);
+  });
+
+  it('should reject -w when no target project uses the workspace', async () => {
+    commentOnPullRequest('terraform plan -w=prod');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith("No target project uses workspace 'prod'");
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      "⏸️ No target project uses workspace 'prod'"
+    );
+    expect(calls).toEqual(['terraform version']);
+  });
+
+  it('should run projects matched by name patterns and directories', async () => {
+    writeConfig(`
+output_mode: comment
+max_projects_per_run: 1
+projects:
+  - name: network
+    dir: network
+  - name: app-prod
+    dir: envs/prod/app
+  - name: app-dev
+    dir: envs/dev/app
+  - name: app-qa
+    dir: envs/qa/app
+    enabled: false
+  - name: dns
+    dir: dns
+`);
+    commentOnPullRequest('terraform plan -project=app-* -d=network');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    // A disabled project only matched by a pattern is skipped, and the selection is not limited
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+      expect.stringContaining('target:app-prod'),
+      expect.stringContaining('target:app-dev'),
+      expect.stringContaining('target:network'),
+    ]);
+  });
+
+  it('should fail for a directory without projects', async () => {
+    commentOnPullRequest('terraform plan -dir=modules');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      "No project in directory 'modules'. Project directories: envs/staging, envs/production"
+    );
+    expect(calls).toEqual(['terraform version']);
+  });
+
+  it('should fail for a tag no project carries', async () => {
+    commentOnPullRequest('terraform plan -tag=networking');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      "Tag 'networking' not found in configuration. Available tags: (none)"
+    );
+    expect(calls).toEqual(['terraform version']);
+  });
+
+  it('should destroy a project that meets its destroy_requirements', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    destroy_requirements: [approved, label:destroy]
+  - name: production
+    dir: envs/production
+`);
+    mockGetPullRequestInfo.mockResolvedValue({ ...pr, labels: ['destroy'] });
+    commentOnPullRequest('terraform destroy -project=staging -confirm -target=aws_s3_bucket.b');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls.filter((line) => line.includes(' destroy'))).toEqual([
+      'terraform destroy -auto-approve -target=aws_s3_bucket.b -no-color -input=false',
+    ]);
+  });
+
+  it('should refuse to destroy projects without destroy_requirements or unmet ones', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    destroy_requirements: [label:destroy]
+  - name: production
+    dir: envs/production
+`);
+    commentOnPullRequest('terraform destroy -project=production -confirm');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform destroy failed for 1 of 1 project(s): production'
+    );
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining(
+        'Project production does not allow terraform destroy (set destroy_requirements to allow it)'
+      )
+    );
+
+    mockCore.setFailed.mockClear();
+    commentOnPullRequest('terraform destroy -project=staging -confirm');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform destroy failed for 1 of 1 project(s): staging'
+    );
+    expect(calls.some((line) => line.includes(' destroy'))).toBe(false);
+  });
+
+  it('should gate state mv with state_requirements and echo the command', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    apply_requirements: [label:never]
+    state_requirements: [approved]
+`);
+    commentOnPullRequest('terraform state mv aws_instance.old aws_instance.new -project=staging');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toContain('terraform state mv aws_instance.old aws_instance.new');
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('```\nterraform state mv aws_instance.old aws_instance.new\n```')
+    );
+
+    mockGetPullRequestInfo.mockResolvedValue({ ...pr, approved: false });
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform state mv failed for 1 of 1 project(s): staging'
+    );
+  });
+
+  it('should gate import with import_requirements and post the plan of the resource', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    apply_requirements: [label:never]
+    import_requirements: [approved]
+`);
+    useFakeRunner(
+      { 'terraform plan': 2 },
+      { 'terraform plan': '  # aws_instance.web["a"] will be updated in-place' }
+    );
+    commentOnPullRequest('terraform import aws_instance.web["a"] i-0123 -project=staging');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toContain('terraform import -no-color -input=false aws_instance.web["a"] i-0123');
+    expect(calls).toContain(
+      'terraform plan -detailed-exitcode -lock=false -target=aws_instance.web["a"] -no-color -input=false'
+    );
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining(
+        '## 🔎 Plan of `aws_instance.web["a"]` after import for project `staging`\n\n⚠️ The next apply would change the imported resource'
+      )
+    );
+
+    mockGetPullRequestInfo.mockResolvedValue({ ...pr, approved: false });
+    calls = [];
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform import failed for 1 of 1 project(s): staging'
+    );
+    expect(calls.some((line) => line.startsWith('terraform import'))).toBe(false);
+  });
+
+  it('should keep an import whose plan fails', async () => {
+    useFakeRunner({ 'terraform plan': 1 });
+    commentOnPullRequest('terraform import aws_s3_bucket.b my-bucket -project=staging');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(mockCore.warning).toHaveBeenCalledWith(
+      expect.stringContaining('Could not plan aws_s3_bucket.b after importing it')
+    );
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('## ✅ terraform import succeeded for project `staging`')
+    );
+  });
+
+  it('should ignore comments without a terraform command', async () => {
+    commentOnPullRequest('LGTM');
+
+    await run();
+
+    expect(calls).toEqual(['terraform version']);
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+  });
+
+  it('should stay silent for a whitespace-only comment', async () => {
+    commentOnPullRequest('  \n\t\n');
+
+    await run();
+
+    expect(calls).toEqual(['terraform version']);
+    expect(mockPostComment).not.toHaveBeenCalled();
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+  });
+
+  it('should reply with usage to a mistyped command', async () => {
+    commentOnPullRequest('terraform paln -project=staging');
+
+    await run();
+
+    expect(calls).toEqual(['terraform version']);
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('Did you mean `terraform plan`?')
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'Unknown command: terraform paln (did you mean terraform plan?)'
+    );
+  });
+
+  it('should reply with usage to a bare terraform comment', async () => {
+    commentOnPullRequest('terraform');
+
+    await run();
+
+    expect(calls).toEqual(['terraform version']);
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('## ❓ `terraform` needs a command')
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      expect.stringContaining('terraform is missing a command')
+    );
+  });
+
+  it('should fail for an unknown project without running terraform', async () => {
+    commentOnPullRequest('terraform plan -project=qa');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(expect.stringContaining('qa'));
+    expect(calls).toEqual(['terraform version']);
+  });
+
+  it('should apply once the requirements are met', async () => {
+    commentOnPullRequest('terraform apply -project=staging');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(mockGetPullRequestInfo).toHaveBeenCalledWith('ghs_token', 'acme', 'infra', 42);
+    expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:staging apply/));
+    expect(calls).toContain('terraform output -json -no-color');
+    expect(mockCore.warning).not.toHaveBeenCalled();
+  });
+
+  it('should not apply an unapproved pull request', async () => {
+    mockGetPullRequestInfo.mockResolvedValue({ ...pr, approved: false, approvers: [] });
+    commentOnPullRequest('terraform apply -project=staging');
+
+    await run();
+
+    expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('terraform apply failed for project `staging`')
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform apply failed for 1 of 1 project(s): staging'
+    );
+  });
+
+  it('should refuse to apply a pull request from a fork', async () => {
+    mockGetPullRequestInfo.mockResolvedValue({ ...pr, isFork: true });
+    commentOnPullRequest('terraform apply -project=staging');
+
+    await run();
+
+    expect(calls).toEqual(['terraform version']);
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('terraform apply is not allowed on pull requests from forks')
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform apply is not allowed on pull requests from forks (set allow_fork_apply to allow it)'
+    );
+  });
+
+  it('should still plan a pull request from a fork', async () => {
+    mockGetPullRequestInfo.mockResolvedValue({ ...pr, isFork: true });
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:staging plan/));
+  });
+
+  it('should apply a pull request from a fork with allow_fork_apply', async () => {
+    writeConfig(`
+output_mode: comment
+allow_fork_apply: true
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    mockGetPullRequestInfo.mockResolvedValue({ ...pr, isFork: true });
+    commentOnPullRequest('terraform apply -project=staging');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:staging apply/));
+  });
+
+  it('should merge the pull request once every project was applied', async () => {
+    writeConfig(`
+output_mode: comment
+merge_after_apply:
+  method: squash
+  delete_branch: true
+projects:
+  - name: staging
+    dir: envs/staging
+  - name: production
+    dir: envs/production
+`);
+    (mergePullRequest as jest.Mock).mockResolvedValueOnce('def4567890');
+    commentOnPullRequest('terraform apply');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(mergePullRequest).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      'squash',
+      'abc123'
+    );
+    expect(deleteBranch).toHaveBeenCalledWith('ghs_token', 'acme', 'infra', 'feature');
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('was merged (squash) as def4567.\n\nDeleted the branch `feature`.')
+    );
+  });
+
+  it('should not merge after applying only some projects', async () => {
+    writeConfig(`
+output_mode: comment
+merge_after_apply: {}
+projects:
+  - name: staging
+    dir: envs/staging
+  - name: production
+    dir: envs/production
+`);
+    commentOnPullRequest('terraform apply -project=staging');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(mergePullRequest).not.toHaveBeenCalled();
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('Projects not applied yet: production')
+    );
+  });
+
+  it('should block an apply whose saved plan destroys resources under no_destroys', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    apply_requirements: [no_destroys]
+`);
+    (downloadPlanFile as jest.Mock).mockResolvedValueOnce('/tmp/tfplan-staging');
+    useFakeRunner(
+      {},
+      {
+        'terraform show -json': JSON.stringify({
+          resource_changes: [{ address: 'aws_db_instance.main', change: { actions: ['delete'] } }],
+        }),
+      }
+    );
+    commentOnPullRequest('terraform apply -project=staging');
+
+    await run();
+
+    expect(calls).toContain('terraform show -json -no-color /tmp/tfplan-staging');
+    expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('Plan destroys: aws_db_instance.main')
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform apply failed for 1 of 1 project(s): staging'
+    );
+  });
+
+  describe('apply on merge', () => {
+    /**
+     * Makes the run look like it was triggered by merging the PR
+     */
+    function mergePullRequest(): void {
+      Object.assign(github.context, {
+        eventName: 'pull_request',
+        payload: {
+          action: 'closed',
+          pull_request: {
+            number: 42,
+            merged: true,
+            head: { ref: 'feature', sha: 'abc123' },
+            base: { ref: 'main' },
+          },
+          repository: { default_branch: 'main' },
+        },
+        repo: { owner: 'acme', repo: 'infra' },
+        issue: { owner: 'acme', repo: 'infra', number: 42 },
+      });
+    }
+
+    beforeEach(() => {
+      writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    apply_on_merge: true
+  - name: production
+    dir: envs/production
+    apply_on_merge: true
+  - name: sandbox
+    dir: envs/sandbox
+`);
+    });
+
+    it('should apply the saved plans of the projects that apply on merge', async () => {
+      const scope = { token: 'ghs_token', owner: 'acme', repo: 'infra', prNumber: 42, sha: 'abc123' };
+      (hasSavedPlan as jest.Mock).mockResolvedValueOnce(true).mockResolvedValueOnce(false);
+      (downloadPlanFile as jest.Mock).mockResolvedValueOnce('/tmp/tfplan-staging');
+      mergePullRequest();
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(hasSavedPlan).toHaveBeenCalledWith('staging', scope);
+      expect(hasSavedPlan).toHaveBeenCalledWith('production', scope);
+      expect(hasSavedPlan).not.toHaveBeenCalledWith('sandbox', scope);
+      expect(downloadPlanFile).toHaveBeenCalledWith('staging', expect.any(String), scope);
+      expect(calls).toContainEqual(
+        expect.stringContaining('apply -- terraform apply /tmp/tfplan-staging')
+      );
+      expect(calls.some((line) => line.includes('target:production'))).toBe(false);
+    });
+
+    it('should do nothing for a pull request closed without merging', async () => {
+      mergePullRequest();
+      github.context.payload.pull_request!.merged = false;
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toEqual(['terraform version']);
+    });
+
+    it('should block the apply on merge of a plan that failed its policy check', async () => {
+      writeConfig(`
+output_mode: comment
+policies:
+  owners: [alice]
+  policy_sets:
+    - name: security
+      path: policies/security
+projects:
+  - name: staging
+    dir: envs/staging
+    apply_on_merge: true
+    policy_sets: [security]
+`);
+      (hasSavedPlan as jest.Mock).mockResolvedValueOnce(true);
+      (downloadPlanFile as jest.Mock).mockResolvedValueOnce('/tmp/tfplan-staging');
+      (getCommitStatus as jest.Mock).mockResolvedValue({ state: 'failure', description: '' });
+      mergePullRequest();
+
+      await run();
+
+      expect(getCommitStatus).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'abc123',
+        'terraform-action/policy_check: staging'
+      );
+      expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        'terraform apply failed for 1 of 1 project(s): staging'
+      );
+    });
+
+    it('should do nothing for a pull request merged into another branch', async () => {
+      mergePullRequest();
+      github.context.payload.pull_request!.base.ref = 'release';
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(hasSavedPlan).not.toHaveBeenCalled();
+      expect(mockCore.info).toHaveBeenCalledWith(
+        'Pull request #42 was merged into release, not the default branch, skipping'
+      );
+    });
+  });
+
+  it('should save and apply plans for the head commit of the pull request', async () => {
+    const scope = { token: 'ghs_token', owner: 'acme', repo: 'infra', prNumber: 42, sha: 'abc123' };
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(uploadPlanFile).toHaveBeenCalledWith(
+      expect.stringContaining('tfplan-staging'),
+      'staging',
+      scope
+    );
+
+    (downloadPlanFile as jest.Mock).mockResolvedValueOnce('/tmp/tfplan-staging');
+    commentOnPullRequest('terraform apply -project=staging');
+
+    await run();
+
+    expect(downloadPlanFile).toHaveBeenCalledWith('staging', expect.any(String), scope);
+    expect(calls).toContainEqual(
+      expect.stringContaining('apply -- terraform apply /tmp/tfplan-staging')
+    );
+  });
+
+  it('should block an apply without a saved plan under the planned requirement', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    apply_requirements: [planned]
+`);
+    (downloadPlanFile as jest.Mock).mockRejectedValueOnce(new Error('Artifact not found'));
+    commentOnPullRequest('terraform apply -project=staging');
+
+    await run();
+
+    expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('No saved plan of the head commit (run terraform plan first)')
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform apply failed for 1 of 1 project(s): staging'
+    );
+  });
+
+  describe('require_plan', () => {
+    beforeEach(() => {
+      writeConfig(`
+output_mode: comment
+require_plan: true
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    });
+
+    it('should apply a saved plan whose metadata matches the head commit', async () => {
+      (downloadPlanFile as jest.Mock).mockResolvedValueOnce('/tmp/tfplan-staging');
+      (verifyPlanMetadata as jest.Mock).mockReturnValueOnce({
+        project: 'staging',
+        sha: 'abc123',
+        prNumber: 42,
+        plannedAt: '2024-05-01T12:00:00.000Z',
+      });
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(verifyPlanMetadata).toHaveBeenCalledWith('/tmp/tfplan-staging', 'staging', 'abc123');
+      expect(calls).toContainEqual(
+        expect.stringContaining('apply -- terraform apply /tmp/tfplan-staging')
+      );
+    });
+
+    it('should refuse to apply without a plan of the head commit', async () => {
+      (downloadPlanFile as jest.Mock).mockRejectedValueOnce(new Error('Artifact not found'));
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        expect.stringContaining(
+          'Project staging requires a plan of commit abc123 before apply (run terraform plan first): Artifact not found'
+        )
+      );
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        'terraform apply failed for 1 of 1 project(s): staging'
+      );
+    });
+
+    it('should refuse to apply a plan whose metadata names another commit', async () => {
+      (downloadPlanFile as jest.Mock).mockResolvedValueOnce('/tmp/tfplan-staging');
+      (verifyPlanMetadata as jest.Mock).mockImplementationOnce(() => {
+        throw new Error('The saved plan was made from commit def456');
+      });
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        expect.stringContaining('The saved plan was made from commit def456')
+      );
+    });
+  });
+
+  it('should comment the changes since the previous plan with compare_plans', async () => {
+    writeConfig(`
+output_mode: comment
+compare_plans: true
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    (findCommentByMarker as jest.Mock).mockResolvedValueOnce({
+      id: 7,
+      body: buildPlanChangesComment(
+        'staging',
+        [{ address: 'aws_s3_bucket.logs', actions: ['create'] }],
+        undefined
+      ),
+    });
+    useFakeRunner(
+      {},
+      {
+        'terraform show -json': JSON.stringify({
+          resource_changes: [{ address: 'aws_instance.web', change: { actions: ['update'] } }],
+        }),
+      }
+    );
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toContainEqual(expect.stringMatching(/^terraform show -json -no-color \S+/));
+    expect(upsertComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      '<!-- terraform-action:plan-changes:staging -->',
+      expect.stringMatching(
+        /Newly planned\*\*\n\n- `aws_instance.web` \(update\)[\s\S]*No longer planned\*\*\n\n- `aws_s3_bucket.logs`/
+      )
+    );
+  });
+
+  describe('plan cache', () => {
+    it('should show the plan saved for the head commit instead of planning again', async () => {
+      (hasSavedPlan as jest.Mock).mockResolvedValueOnce(true).mockResolvedValueOnce(false);
+      (downloadPlanFile as jest.Mock).mockResolvedValueOnce('/tmp/tfplan-staging');
+      useFakeRunner({}, { 'terraform show': 'Plan: 1 to add, 0 to change, 0 to destroy.' });
+      commentOnPullRequest('terraform plan');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(hasSavedPlan).toHaveBeenCalledWith(
+        'staging',
+        expect.objectContaining({ prNumber: 42, sha: 'abc123' })
+      );
+      expect(calls).toEqual([
+        'terraform version',
+        'terraform init',
+        'terraform show -no-color /tmp/tfplan-staging',
+        'terraform init',
+        expect.stringMatching(/^tfcmt -var target:production plan/),
+      ]);
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        expect.stringContaining('## ♻️ Reused the plan of project `staging` for abc123')
+      );
+      expect(mockCore.setOutput).toHaveBeenCalledWith('planned-projects', 'staging,production');
+      expect(mockCore.setOutput).toHaveBeenCalledWith('has-changes', 'true');
+    });
+
+    it('should plan again with --force', async () => {
+      commentOnPullRequest('terraform plan -project=staging --force');
+
+      await run();
+
+      expect(hasSavedPlan).not.toHaveBeenCalled();
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:staging plan/));
+    });
+
+    it('should plan again when the comment passes its own flags', async () => {
+      commentOnPullRequest('terraform plan -project=staging -target=aws_instance.web');
+
+      await run();
+
+      expect(hasSavedPlan).not.toHaveBeenCalled();
+    });
+
+    it('should plan again when the saved plan cannot be read', async () => {
+      (hasSavedPlan as jest.Mock).mockResolvedValueOnce(true);
+      (downloadPlanFile as jest.Mock).mockRejectedValueOnce(new Error('artifact expired'));
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'Could not reuse the saved plan of project staging, planning again: artifact expired'
+      );
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:staging plan/));
+    });
+  });
+
+  describe('previous_plan_comments', () => {
+    const originalRunnerTemp = process.env.RUNNER_TEMP;
+    const marker = '<!-- terraform-action:plan:staging -->';
+
+    /**
+     * Configures how earlier plan comments are treated, with tfcmt writing its comment to a file
+     */
+    function usePreviousPlanComments(mode: string): void {
+      process.env.RUNNER_TEMP = tmpDir;
+      fs.writeFileSync(path.join(tmpDir, 'tfcmt-plan-staging.md'), '## Plan Result (staging)');
+      writeConfig(`
+output_mode: comment
+previous_plan_comments: ${mode}
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    }
+
+    afterEach(() => {
+      if (originalRunnerTemp === undefined) {
+        delete process.env.RUNNER_TEMP;
+      } else {
+        process.env.RUNNER_TEMP = originalRunnerTemp;
+      }
+    });
+
+    it('should replace the earlier plan comment with update', async () => {
+      usePreviousPlanComments('update');
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -output \S+tfcmt-plan-staging.md/));
+      expect(upsertComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        marker,
+        `${marker}\n## Plan Result (staging)`
+      );
+      expect(mockPostComment).not.toHaveBeenCalled();
+    });
+
+    it('should hide earlier plan comments before posting the new one with hide', async () => {
+      usePreviousPlanComments('hide');
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(minimizeComments).toHaveBeenCalledWith('ghs_token', 'acme', 'infra', 42, marker);
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        `${marker}\n## Plan Result (staging)`
+      );
+    });
+
+    it('should leave apply comments to tfcmt', async () => {
+      usePreviousPlanComments('update');
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:staging apply/));
+      expect(minimizeComments).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('invalidate_outdated_plans', () => {
+    const originalRunnerTemp = process.env.RUNNER_TEMP;
+
+    beforeEach(() => {
+      process.env.RUNNER_TEMP = tmpDir;
+      fs.writeFileSync(path.join(tmpDir, 'tfcmt-plan-staging.md'), '## Plan Result (staging)');
+      writeConfig(`
+output_mode: comment
+invalidate_outdated_plans: true
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    });
+
+    afterEach(() => {
+      if (originalRunnerTemp === undefined) {
+        delete process.env.RUNNER_TEMP;
+      } else {
+        process.env.RUNNER_TEMP = originalRunnerTemp;
+      }
+    });
+
+    it('should invalidate the plans of the commit a push replaced', async () => {
+      pushToPullRequest();
+      Object.assign(github.context.payload, { before: 'def456', after: 'abc123' });
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(markPlanCommentsOutdated).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        'abc123'
+      );
+      expect(deleteSavedPlans).toHaveBeenCalledWith('staging', {
+        token: 'ghs_token',
+        owner: 'acme',
+        repo: 'infra',
+        prNumber: 42,
+        sha: 'def456',
+      });
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -output \S+tfcmt-plan-staging.md/));
+    });
+
+    it('should still plan when the outdated plans cannot be deleted', async () => {
+      (deleteSavedPlans as jest.Mock).mockRejectedValueOnce(new Error('Resource not accessible'));
+      pushToPullRequest();
+      Object.assign(github.context.payload, { before: 'def456', after: 'abc123' });
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'Failed to delete the outdated plans of project staging (needs actions: write): Resource not accessible'
+      );
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -output/));
+    });
+
+    it('should post plan comments with the project marker', async () => {
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(markPlanCommentsOutdated).not.toHaveBeenCalled();
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        '<!-- terraform-action:plan:staging -->\n## Plan Result (staging)'
+      );
+    });
+  });
+
+  describe('redaction', () => {
+    const originalRunnerTemp = process.env.RUNNER_TEMP;
+    const planJson = JSON.stringify({
+      resource_changes: [
+        {
+          address: 'aws_db_instance.main',
+          change: {
+            actions: ['create'],
+            after: { password: 'hunter2-secret', engine: 'postgres' },
+            after_sensitive: { password: true },
+          },
+        },
+      ],
+    });
+
+    beforeEach(() => {
+      process.env.RUNNER_TEMP = tmpDir;
+      fs.writeFileSync(path.join(tmpDir, 'tfcmt-plan-staging.md'), '## Plan Result (staging)');
+      writeConfig(`
+output_mode: comment
+redaction:
+  patterns: ['internal\\.example\\.com']
+  sensitive_values: true
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    });
+
+    afterEach(() => {
+      if (originalRunnerTemp === undefined) {
+        delete process.env.RUNNER_TEMP;
+      } else {
+        process.env.RUNNER_TEMP = originalRunnerTemp;
+      }
+    });
+
+    it('should post the plan comment once its sensitive values are read', async () => {
+      useFakeRunner({}, { 'terraform show -json': planJson });
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -output \S+tfcmt-plan-staging.md/));
+      expect(calls).toContainEqual(expect.stringMatching(/^terraform show -json -no-color \S+/));
+      expect(mockCore.setSecret).toHaveBeenCalledWith('hunter2-secret');
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        '## Plan Result (staging)'
+      );
+      expect(process.env.TFCMT_MASKS?.split('\n')).toEqual(
+        expect.arrayContaining(['regexp:internal\\.example\\.com', 'regexp:hunter2-secret'])
+      );
+    });
+
+    it('should mask the sensitive values of the saved plan before tfcmt applies it', async () => {
+      (downloadPlanFile as jest.Mock).mockResolvedValueOnce('/tmp/tfplan-staging');
+      useFakeRunner({}, { 'terraform show -json': planJson });
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      const show = calls.indexOf('terraform show -json -no-color /tmp/tfplan-staging');
+      const apply = calls.findIndex((line) => line.startsWith('tfcmt -var target:staging apply'));
+      expect(show).toBeGreaterThan(-1);
+      expect(apply).toBeGreaterThan(show);
+      expect(mockCore.setSecret).toHaveBeenCalledWith('hunter2-secret');
+    });
+  });
+
+  it('should comment a summary of the plan JSON with plan_summary', async () => {
+    writeConfig(`
+output_mode: comment
+plan_summary: true
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    useFakeRunner(
+      {},
+      {
+        'terraform show -json': JSON.stringify({
+          resource_changes: [{ address: 'aws_instance.web', change: { actions: ['update'] } }],
+        }),
+      }
+    );
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(upsertComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      '<!-- terraform-action:plan-summary:staging -->',
+      expect.stringContaining('| `aws_instance.web` | update |')
+    );
+    // The plan is only compared with compare_plans
+    expect(findCommentByMarker).not.toHaveBeenCalled();
+  });
+
+  it('should not compare plans without compare_plans', async () => {
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(calls.some((line) => line.startsWith('terraform show'))).toBe(false);
+    expect(findCommentByMarker).not.toHaveBeenCalled();
+  });
+
+  describe('concurrency', () => {
+    const lock = { group: 'shared', ref: 'terraform-action/locks/shared', sha: 'lock1' };
+
+    beforeEach(() => {
+      writeConfig(`
+output_mode: comment
+concurrency:
+  timeout: 10m
+projects:
+  - name: staging
+    dir: envs/staging
+    concurrency_group: shared
+`);
+      Object.assign(github.context, { runId: 100, runAttempt: 2 });
+      (acquireProjectLock as jest.Mock).mockImplementation(async () => {
+        calls.push('lock');
+        return lock;
+      });
+      (releaseProjectLock as jest.Mock).mockImplementation(async () => {
+        calls.push('unlock');
+      });
+    });
+
+    it('should hold the lock of the concurrency group while terraform applies', async () => {
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(acquireProjectLock).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'shared',
+        {
+          runId: 100,
+          runAttempt: 2,
+          project: 'staging',
+          command: 'apply',
+          prNumber: 42,
+          lockedAt: expect.any(String),
+        },
+        600_000
+      );
+      expect(releaseProjectLock).toHaveBeenCalledWith('ghs_token', 'acme', 'infra', lock);
+      const tfcmt = calls.findIndex((line) => line.startsWith('tfcmt'));
+      expect(calls.indexOf('lock')).toBeLessThan(tfcmt);
+      expect(calls.indexOf('unlock')).toBeGreaterThan(tfcmt);
+    });
+
+    it('should release the lock when the command fails', async () => {
+      useFakeRunner({ tfcmt: 1 });
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        'terraform apply failed for 1 of 1 project(s): staging'
+      );
+      expect(releaseProjectLock).toHaveBeenCalledWith('ghs_token', 'acme', 'infra', lock);
+    });
+
+    it('should not run terraform when the lock stays held', async () => {
+      (acquireProjectLock as jest.Mock).mockRejectedValueOnce(
+        new Error('Timed out waiting for the lock of shared, held by run 7')
+      );
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+      expect(releaseProjectLock).not.toHaveBeenCalled();
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        expect.stringContaining('Timed out waiting for the lock of shared')
+      );
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        'terraform apply failed for 1 of 1 project(s): staging'
+      );
+    });
+
+    it('should only lock the listed commands', async () => {
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(acquireProjectLock).not.toHaveBeenCalled();
+    });
+
+    it('should lock state commands that change the state', async () => {
+      commentOnPullRequest('terraform state rm aws_instance.old -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(acquireProjectLock).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'shared',
+        expect.objectContaining({ command: 'state rm' }),
+        600_000
+      );
+    });
+
+    it('should not lock state commands that only read the state', async () => {
+      commentOnPullRequest('terraform state list -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toContain('terraform state list');
+      expect(acquireProjectLock).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('status_api: checks', () => {
+    const originalRunnerTemp = process.env.RUNNER_TEMP;
+
+    beforeEach(() => {
+      writeConfig(`
+status_api: checks
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+      (reportCheckRun as jest.Mock).mockResolvedValue(5);
+    });
+
+    afterEach(() => {
+      if (originalRunnerTemp === undefined) {
+        delete process.env.RUNNER_TEMP;
+      } else {
+        process.env.RUNNER_TEMP = originalRunnerTemp;
+      }
+    });
+
+    /**
+     * Makes the run look like it was triggered by the Re-run button of a check
+     */
+    function rerequestCheckRun(externalId: string, pullRequests = [{ number: 42 }]): void {
+      Object.assign(github.context, {
+        eventName: 'check_run',
+        payload: {
+          action: 'rerequested',
+          check_run: {
+            name: 'terraform-action/plan: staging',
+            external_id: externalId,
+            pull_requests: pullRequests,
+          },
+          sender: { login: 'alice' },
+        },
+        repo: { owner: 'acme', repo: 'infra' },
+        issue: { owner: 'acme', repo: 'infra', number: 42 },
+      });
+    }
+
+    it('should report a project as a check run with the plan summary in its details', async () => {
+      useFakeRunner(
+        {},
+        {
+          'terraform show -json': JSON.stringify({
+            resource_changes: [{ address: 'aws_instance.web', change: { actions: ['create'] } }],
+          }),
+        }
+      );
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(reportCommitStatus).not.toHaveBeenCalled();
+      expect(reportCheckRun).toHaveBeenCalledTimes(2);
+      expect(reportCheckRun).toHaveBeenNthCalledWith(
+        1,
+        'ghs_token',
+        'acme',
+        'infra',
+        'abc123',
+        'plan',
+        'staging',
+        'pending',
+        'terraform plan is running',
+        {
+          summary: undefined,
+          rerun: { command: 'plan', project: 'staging', args: [] },
+          checkRunId: undefined,
+        },
+        expect.anything()
+      );
+      expect(reportCheckRun).toHaveBeenNthCalledWith(
+        2,
+        'ghs_token',
+        'acme',
+        'infra',
+        'abc123',
+        'plan',
+        'staging',
+        'success',
+        'terraform plan succeeded',
+        expect.objectContaining({
+          summary: expect.stringContaining('| `aws_instance.web` | create |'),
+          checkRunId: 5,
+        }),
+        expect.anything()
+      );
+    });
+
+    it('should complete the check run with the failure', async () => {
+      useFakeRunner({ tfcmt: 1 });
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(reportCheckRun).toHaveBeenLastCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'abc123',
+        'apply',
+        'staging',
+        'failure',
+        expect.any(String),
+        expect.objectContaining({
+          summary: expect.stringContaining('## ❌ terraform apply failed for project `staging`'),
+          rerun: { command: 'apply', project: 'staging', args: [] },
+          checkRunId: 5,
+        }),
+        expect.anything()
+      );
+    });
+
+    it('should run the command of a re-requested check run again', async () => {
+      process.env.RUNNER_TEMP = tmpDir;
+      fs.writeFileSync(path.join(tmpDir, 'tfcmt-plan-staging.md'), '## Plan Result (staging)');
+      rerequestCheckRun(
+        'terraform-action:{"command":"plan","project":"staging","args":["-target=aws_instance.web"]}'
+      );
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(github.context.payload.issue).toEqual({ number: 42 });
+      // tfcmt cannot find the pull request of a check_run event, so the action comments
+      expect(calls).toContainEqual(
+        expect.stringMatching(/^tfcmt -output \S+tfcmt-plan-staging.md .*-target=aws_instance.web/)
+      );
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        expect.stringContaining('## Plan Result (staging)')
+      );
+    });
+
+    it('should ignore check runs it did not create', async () => {
+      rerequestCheckRun('ci:build');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toEqual(['terraform version']);
+      expect(mockCore.info).toHaveBeenCalledWith(
+        'The re-requested check run was not created by terraform-action, skipping'
+      );
+    });
+
+    it('should fail for a re-requested check run without a pull request', async () => {
+      rerequestCheckRun('terraform-action:{"command":"plan","project":"staging","args":[]}', []);
+
+      await run();
+
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        'Check run terraform-action/plan: staging does not belong to a pull request'
+      );
+    });
+  });
+
+  describe('GitHub App authentication', () => {
+    /**
+     * Sets the app inputs next to the config-path input
+     */
+    function setAppInputs(inputs: Record<string, string>): void {
+      const configPath = path.join(tmpDir, '.terraform-action.yaml');
+      mockCore.getInput.mockImplementation((name: string) =>
+        name === 'config-path' ? configPath : (inputs[name] ?? '')
+      );
+    }
+
+    it('should run with an installation token of the app', async () => {
+      (authenticateAsApp as jest.Mock).mockResolvedValueOnce('ghs_installation');
+      setAppInputs({ 'app-id': '123', 'app-private-key': 'pem' });
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(authenticateAsApp).toHaveBeenCalledWith('123', 'pem', 'acme', 'infra');
+      expect(mockCore.getInput).not.toHaveBeenCalledWith('github-token', expect.anything());
+      expect(mockGetPullRequestInfo).toHaveBeenCalledWith('ghs_installation', 'acme', 'infra', 42);
+    });
+
+    it('should fail when only the app id is set', async () => {
+      setAppInputs({ 'app-id': '123' });
+      commentOnPullRequest('terraform plan');
+
+      await run();
+
+      expect(authenticateAsApp).not.toHaveBeenCalled();
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        'app-id and app-private-key must be set together'
+      );
+      expect(calls).toEqual([]);
+    });
+  });
+
+  describe('authorization', () => {
+    beforeEach(() => {
+      writeConfig(`
+output_mode: comment
+authorization:
+  apply:
+    teams: [acme/platform]
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    });
+
+    it('should refuse every command of a comment when the author may not run one', async () => {
+      (checkCommandAuthorization as jest.Mock).mockResolvedValueOnce(
+        'not one of the allowed users or teams'
+      );
+      commentOnPullRequest('terraform plan\nterraform apply');
+      github.context.payload.comment = {
+        body: 'terraform plan\nterraform apply',
+        user: { login: 'mallory' },
+      };
+
+      await run();
+
+      expect(checkCommandAuthorization).toHaveBeenCalledTimes(1);
+      expect(checkCommandAuthorization).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'mallory',
+        { teams: ['acme/platform'] }
+      );
+      expect(calls).toEqual(['terraform version']);
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        '🚫 @mallory is not allowed to run terraform apply: not one of the allowed users or teams'
+      );
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        '@mallory is not allowed to run terraform apply: not one of the allowed users or teams'
+      );
+    });
+
+    it('should run a restricted command for an allowed author', async () => {
+      (checkCommandAuthorization as jest.Mock).mockResolvedValueOnce(undefined);
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:staging apply/));
+    });
+
+    it('should not restrict commands without a rule', async () => {
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(checkCommandAuthorization).not.toHaveBeenCalled();
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+    });
+
+    it('should refuse apply --all to an author only allowed to apply', async () => {
+      (checkCommandAuthorization as jest.Mock)
+        .mockResolvedValueOnce(undefined)
+        .mockResolvedValueOnce('requires maintain permission on the repository (has write)');
+      commentOnPullRequest('terraform apply --all');
+
+      await run();
+
+      expect(checkCommandAuthorization).toHaveBeenLastCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        expect.any(String),
+        { permission: 'maintain' }
+      );
+      expect(calls).toEqual(['terraform version']);
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        expect.stringMatching(
+          /is not allowed to run terraform apply --all: requires maintain permission/
+        )
+      );
+    });
+
+    it('should check apply --all against authorization.apply_all', async () => {
+      writeConfig(`
+output_mode: comment
+authorization:
+  apply_all:
+    users: [alice]
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+      (checkCommandAuthorization as jest.Mock).mockResolvedValueOnce(undefined);
+      commentOnPullRequest('terraform apply --all');
+
+      await run();
+
+      expect(checkCommandAuthorization).toHaveBeenCalledTimes(1);
+      expect(checkCommandAuthorization).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        expect.any(String),
+        { users: ['alice'] }
+      );
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:staging apply/));
+    });
+  });
+
+  describe('cost estimation', () => {
+    /**
+     * Replies to infracost with a breakdown raising the monthly cost by the given amount
+     */
+    function useBreakdown(diff: number): void {
+      useFakeRunner(
+        {},
+        {
+          'terraform show -json': '{}',
+          'infracost breakdown': JSON.stringify({
+            currency: 'USD',
+            pastTotalMonthlyCost: '10',
+            totalMonthlyCost: String(10 + diff),
+            diffTotalMonthlyCost: String(diff),
+          }),
+        }
+      );
+    }
+
+    beforeEach(() => {
+      writeConfig(`
+output_mode: comment
+infracost:
+  max_monthly_increase: 100
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    });
+
+    it('should comment the cost change of the plan', async () => {
+      useBreakdown(25);
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toContainEqual(
+        expect.stringMatching(
+          /^infracost breakdown --path \S+tfplan-staging\.json --format json --no-color$/
+        )
+      );
+      expect(upsertComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        '<!-- terraform-action:cost-estimate:staging -->',
+        expect.stringContaining('| Total | 10.00 USD | 35.00 USD | +25.00 USD |')
+      );
+      expect(uploadPlanFile).toHaveBeenCalledTimes(1);
+    });
+
+    it('should fail a plan raising the cost above the limit without saving it', async () => {
+      useBreakdown(150);
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(upsertComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        '<!-- terraform-action:cost-estimate:staging -->',
+        expect.stringContaining('above the limit of 100.00 USD')
+      );
+      expect(uploadPlanFile).not.toHaveBeenCalled();
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        expect.stringContaining(
+          'Plan of project staging raises the monthly cost by 150.00 USD, above the limit of 100.00 USD'
+        )
+      );
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        'terraform plan failed for 1 of 1 project(s): staging'
+      );
+    });
+
+    it('should refuse to apply without a saved plan, which was not priced', async () => {
+      (downloadPlanFile as jest.Mock).mockRejectedValueOnce(new Error('Artifact not found'));
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        expect.stringContaining(
+          'Project staging requires a plan of commit abc123 before apply (run terraform plan first): Artifact not found'
+        )
+      );
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        'terraform apply failed for 1 of 1 project(s): staging'
+      );
+    });
+  });
+
+  describe('policy checks', () => {
+    const policyConfig = `
+output_mode: comment
+policies:
+  owners: [alice]
+  policy_sets:
+    - name: security
+      path: policies/security
+projects:
+  - name: staging
+    dir: envs/staging
+    policy_sets: [security]
+`;
+
+    /**
+     * Makes the comment look like it was written by the given user
+     */
+    function commentAs(body: string, login: string): void {
+      commentOnPullRequest(body);
+      github.context.payload.comment = { body, user: { login } };
+    }
+
+    beforeEach(() => {
+      writeConfig(policyConfig);
+    });
+
+    it('should record a failed policy check without failing the plan', async () => {
+      (checkPlanPolicies as jest.Mock).mockResolvedValue({
+        passed: false,
+        policySets: ['security'],
+        output: 'FAIL - main - public buckets are not allowed',
+      });
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(checkPlanPolicies).toHaveBeenCalledWith(
+        'staging',
+        [{ name: 'security', path: 'policies/security' }],
+        expect.stringMatching(/envs\/staging$/),
+        expect.stringMatching(/tfplan-staging\.json$/)
+      );
+      // Recorded even though output_mode is comment, as apply reads it
+      expect(reportCommitStatus).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'abc123',
+        'policy_check',
+        'staging',
+        'failure',
+        'Policy check failed; approval required',
+        expect.anything()
+      );
+      expect(upsertComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        '<!-- terraform-action:policy-check:staging -->',
+        expect.stringContaining('(@alice) comments `terraform approve_policies -project=staging`')
+      );
+    });
+
+    it('should block the apply of a plan that failed its policy check', async () => {
+      (getCommitStatus as jest.Mock).mockResolvedValue({ state: 'failure', description: '' });
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(getCommitStatus).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'abc123',
+        'terraform-action/policy_check: staging'
+      );
+      expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        expect.stringContaining("a policy owner must comment 'terraform approve_policies'")
+      );
+      expect(mockCore.setFailed).toHaveBeenCalled();
+    });
+
+    it('should apply once the policy check passed', async () => {
+      (getCommitStatus as jest.Mock).mockResolvedValue({ state: 'success', description: '' });
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:staging apply/));
+    });
+
+    it('should let a policy owner approve failed policy checks', async () => {
+      (getCommitStatus as jest.Mock).mockResolvedValue({ state: 'failure', description: '' });
+      commentAs('terraform approve_policies -project=staging', 'Alice');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toEqual(['terraform version']);
+      expect(createCommitStatus).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'abc123',
+        'success',
+        'terraform-action/policy_check: staging',
+        'Policy check failed; approved by @Alice'
+      );
+      expect(mockPostComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        expect.stringContaining('@Alice approved the failed policy checks of `staging`')
+      );
+    });
+
+    it('should refuse policy approval from anyone but a policy owner', async () => {
+      commentAs('terraform approve_policies', 'mallory');
+
+      await run();
+
+      expect(createCommitStatus).not.toHaveBeenCalled();
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        '@mallory is not a policy owner and cannot approve policy checks'
+      );
+    });
+  });
+
+  describe('security scans', () => {
+    beforeEach(() => {
+      writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    security_scan:
+      tool: tfsec
+      block_on: HIGH
+`);
+    });
+
+    it('should scan the project after planning and record blocking findings', async () => {
+      useFakeRunner(
+        {},
+        {
+          tfsec: JSON.stringify({
+            results: [{ long_id: 'aws-s3-block-public-acls', severity: 'CRITICAL' }],
+          }),
+        }
+      );
+      commentOnPullRequest('terraform plan -project=staging');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(calls).toContainEqual(
+        expect.stringMatching(/^tfsec \S*envs\/staging --format json --no-color --soft-fail$/)
+      );
+      expect(reportCommitStatus).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'abc123',
+        'security_scan',
+        'staging',
+        'failure',
+        '1 finding(s) at or above HIGH',
+        expect.anything()
+      );
+      // A plan with blocking findings must not be applied, e.g. on merge
+      expect(uploadPlanFile).not.toHaveBeenCalled();
+      expect(upsertComment).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        42,
+        '<!-- terraform-action:security-scan:staging -->',
+        expect.stringContaining('**CRITICAL**: 1')
+      );
+    });
+
+    it('should block the apply of a plan with blocking findings', async () => {
+      (getCommitStatus as jest.Mock).mockResolvedValue({ state: 'failure', description: '' });
+      commentOnPullRequest('terraform apply -project=staging');
+
+      await run();
+
+      expect(getCommitStatus).toHaveBeenCalledWith(
+        'ghs_token',
+        'acme',
+        'infra',
+        'abc123',
+        'terraform-action/security_scan: staging'
+      );
+      expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+      expect(mockCore.setFailed).toHaveBeenCalled();
+    });
+  });
+
+  it('should reject a named project whose branch filters do not match', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    base_branch: release
+  - name: production
+    dir: envs/production
+`);
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      "⏸️ Project 'staging' does not run for this pull request (branch filters do not match)"
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      "Project 'staging' does not run for this pull request (branch filters do not match)"
+    );
+    expect(calls).toEqual(['terraform version']);
+  });
+
+  it('should quietly skip an implied project whose branch filters do not match', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    base_branch: release
+  - name: production
+    dir: envs/production
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+      expect.stringContaining('target:production'),
+    ]);
+  });
+
+  it('should read the configuration from the base branch', async () => {
+    mockCore.getInput.mockImplementation((name: string) =>
+      name === 'github-token'
+        ? 'ghs_token'
+        : name === 'config-from-base-branch'
+          ? 'true'
+          : name === 'config-path'
+            ? 'config/terraform.yaml'
+            : ''
+    );
+    (fetchRepositoryFile as jest.Mock).mockResolvedValueOnce(
+      'projects:\n  - name: production\n    dir: envs/production\n'
+    );
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(fetchRepositoryFile).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      'config/terraform.yaml',
+      'main'
+    );
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+      expect.stringContaining('target:production'),
+    ]);
+  });
+
+  it('should fail when the base branch has no configuration file', async () => {
+    mockCore.getInput.mockImplementation((name: string) =>
+      name === 'github-token' ? 'ghs_token' : name === 'config-from-base-branch' ? 'true' : ''
+    );
+    (fetchRepositoryFile as jest.Mock).mockResolvedValueOnce(null);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'Configuration file not found on base branch main: .terraform-action.yaml'
+    );
+    expect(calls).toEqual(['terraform version']);
+  });
+
+  it('should run the default project directory without a configuration file', async () => {
+    mockCore.getInput.mockImplementation((name: string) =>
+      name === 'github-token'
+        ? 'ghs_token'
+        : name === 'config-path'
+          ? path.join(tmpDir, 'missing.yaml')
+          : name === 'default-project-dir'
+            ? 'infra'
+            : ''
+    );
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(calls).toContainEqual(expect.stringMatching(/^tfcmt -var target:default plan/));
+  });
+
+  it('should fail without a configuration file or default project directory', async () => {
+    mockCore.getInput.mockImplementation((name: string) =>
+      name === 'github-token' ? 'ghs_token' : name === 'config-path' ? 'missing.yaml' : ''
+    );
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      expect.stringContaining('Configuration file not found')
+    );
+    expect(calls).toEqual(['terraform version']);
+  });
+
+  it('should merge the configuration file over the central one of config-repo', async () => {
+    const configPath = path.join(tmpDir, '.terraform-action.yaml');
+    fs.writeFileSync(configPath, 'projects:\n  - name: app\n    dir: envs/app\n');
+    mockCore.getInput.mockImplementation((name: string) =>
+      name === 'github-token'
+        ? 'ghs_token'
+        : name === 'config-path'
+          ? configPath
+          : name === 'config-repo'
+            ? 'acme/infra-config@v1'
+            : name === 'config-repo-token'
+              ? 'ghp_central'
+              : ''
+    );
+    (fetchRepositoryFile as jest.Mock).mockResolvedValueOnce(
+      'projects:\n  - name: shared\n    dir: envs/shared\n'
+    );
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(fetchRepositoryFile).toHaveBeenCalledWith(
+      'ghp_central',
+      'acme',
+      'infra-config',
+      '.terraform-action.yaml',
+      'v1'
+    );
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+      expect.stringContaining('target:shared'),
+      expect.stringContaining('target:app'),
+    ]);
+  });
+
+  it('should run the central configuration alone when the repository has no file', async () => {
+    mockCore.getInput.mockImplementation((name: string) =>
+      name === 'github-token'
+        ? 'ghs_token'
+        : name === 'config-path'
+          ? path.join(tmpDir, 'missing.yaml')
+          : name === 'config-repo'
+            ? 'acme/infra-config/teams/app.yaml'
+            : ''
+    );
+    (fetchRepositoryFile as jest.Mock).mockResolvedValueOnce(
+      'projects:\n  - name: app\n    dir: envs/app\n'
+    );
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(fetchRepositoryFile).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra-config',
+      'teams/app.yaml',
+      undefined
+    );
+  });
+
+  it('should list configuration errors in a PR comment', async () => {
+    writeConfig(`
+projects:
+  - name: staging
+    dir: envs/staging
+    aply_requirements: [approved]
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.error).toHaveBeenCalledWith(
+      'Project staging: unknown field aply_requirements (did you mean apply_requirements?)'
+    );
+    expect(upsertComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      CONFIG_ERRORS_MARKER,
+      expect.stringContaining(
+        '- Project staging: unknown field aply_requirements (did you mean apply_requirements?)'
+      )
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      expect.stringContaining('Invalid configuration:')
+    );
+    expect(calls).not.toContain('terraform init');
+  });
+
+  it('should reject a disabled project named in the comment', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: staging
+    dir: envs/staging
+    enabled: false
+`);
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      "⏸️ Project 'staging' is disabled"
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith("Project 'staging' is disabled");
+    expect(calls).toEqual(['terraform version']);
+  });
+
+  it('should init without the backend but refuse to apply with init_backend: false', async () => {
+    writeConfig(`
+output_mode: comment
+projects:
+  - name: modules
+    dir: modules
+    init_backend: false
+`);
+    commentOnPullRequest('terraform init -project=modules\nterraform plan -project=modules');
+
+    await run();
+
+    expect(calls).toEqual([
+      'terraform version',
+      'terraform init -backend=false -no-color -input=false',
+      'terraform init',
+      expect.stringMatching(/^tfcmt -var target:modules plan -- terraform plan -out=/),
+    ]);
+
+    calls = [];
+    commentOnPullRequest('terraform apply -project=modules');
+
+    await run();
+
+    expect(calls.some((line) => line.startsWith('tfcmt'))).toBe(false);
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform apply failed for 1 of 1 project(s): modules'
+    );
+  });
+
+  it('should stop at the first failing command of a comment', async () => {
+    useFakeRunner({ 'tfcmt -var target:staging': 1 });
+    commentOnPullRequest('terraform plan -project=staging\nterraform plan -project=production');
+
+    await run();
+
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+      expect.stringContaining('target:staging'),
+    ]);
+    expect(mockCore.warning).toHaveBeenCalledWith(
+      'Skipping 1 remaining command(s) after a failure'
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform plan failed for 1 of 1 project(s): staging'
+    );
+  });
+
+  it('should skip later execution order groups after a failure', async () => {
+    useFakeRunner({ 'tfcmt -var target:production': 1 });
+    writeConfig(`
+output_mode: comment
+abort_on_execution_order_fail: true
+projects:
+  - name: staging
+    dir: envs/staging
+    execution_order_group: 1
+  - name: production
+    dir: envs/production
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+      expect.stringContaining('target:production'),
+    ]);
+    expect(mockCore.warning).toHaveBeenCalledWith(
+      'Skipping 1 project(s) of later execution order groups after a failure'
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform plan failed for 1 of 2 project(s): production'
+    );
+  });
+
+  it('should plan projects concurrently with parallel_plan', async () => {
+    let running = 0;
+    let mostRunning = 0;
+    setCommandRunner(async (commandLine, args = []) => {
+      if (path.basename(commandLine) !== 'tfcmt') {
+        return 0;
+      }
+      running++;
+      mostRunning = Math.max(mostRunning, running);
+      await new Promise((resolve) => setTimeout(resolve, 10));
+      running--;
+      calls.push(args.slice(0, 2).join(' '));
+      return 0;
+    });
+    writeConfig(`
+output_mode: comment
+parallel_plan: true
+parallel_pool_size: 2
+projects:
+  - name: staging
+    dir: envs/staging
+  - name: production
+    dir: envs/production
+  - name: production-dr
+    dir: envs/production
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(mockCore.setFailed).not.toHaveBeenCalled();
+    expect(mostRunning).toBe(2);
+    // production-dr shares a directory with production, so it waits for it
+    expect(calls).toEqual([
+      '-var target:staging',
+      '-var target:production',
+      '-var target:production-dr',
+    ]);
+  });
+
+  describe('per-project parallel settings', () => {
+    /**
+     * Records when each project's tfcmt starts and ends, and how many run at once
+     */
+    function useTimedRunner(): { mostRunning: () => number } {
+      let running = 0;
+      let mostRunning = 0;
+      setCommandRunner(async (commandLine, args = []) => {
+        if (path.basename(commandLine) !== 'tfcmt') {
+          return 0;
+        }
+        const target = args[1].replace('target:', '');
+        running++;
+        mostRunning = Math.max(mostRunning, running);
+        calls.push(`start ${target}`);
+        await new Promise((resolve) => setTimeout(resolve, 10));
+        calls.push(`end ${target}`);
+        running--;
+        return 0;
+      });
+      return { mostRunning: () => mostRunning };
+    }
+
+    it('should run a project with parallel_plan: false on its own', async () => {
+      const timing = useTimedRunner();
+      writeConfig(`
+output_mode: comment
+parallel_plan: true
+projects:
+  - name: network
+    dir: envs/network
+    parallel_plan: false
+  - name: staging
+    dir: envs/staging
+  - name: production
+    dir: envs/production
+`);
+      commentOnPullRequest('terraform plan');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(timing.mostRunning()).toBe(2);
+      expect(calls.slice(-2)).toEqual(['start network', 'end network']);
+    });
+
+    it('should let a project setting win over the top-level one', async () => {
+      const timing = useTimedRunner();
+      writeConfig(`
+output_mode: comment
+projects:
+  - name: network
+    dir: envs/network
+  - name: staging
+    dir: envs/staging
+    parallel_apply: true
+  - name: production
+    dir: envs/production
+    parallel_apply: true
+`);
+      commentOnPullRequest('terraform apply');
+
+      await run();
+
+      expect(mockCore.setFailed).not.toHaveBeenCalled();
+      expect(timing.mostRunning()).toBe(2);
+      expect(calls).toEqual([
+        'start staging',
+        'start production',
+        'end staging',
+        'end production',
+        'start network',
+        'end network',
+      ]);
+    });
+
+    it('should only abort after a project that aborts on failure', async () => {
+      useFakeRunner({ 'tfcmt -var target:network': 1 });
+      writeConfig(`
+output_mode: comment
+abort_on_execution_order_fail: true
+projects:
+  - name: network
+    dir: envs/network
+    abort_on_execution_order_fail: false
+  - name: app
+    dir: envs/app
+    depends_on: [network]
+  - name: dns
+    dir: envs/dns
+    execution_order_group: 1
+`);
+      commentOnPullRequest('terraform plan');
+
+      await run();
+
+      expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+        expect.stringContaining('target:network'),
+        expect.stringContaining('target:app'),
+        expect.stringContaining('target:dns'),
+      ]);
+      expect(mockCore.setFailed).toHaveBeenCalledWith(
+        'terraform plan failed for 1 of 3 project(s): network'
+      );
+    });
+  });
+
+  it('should apply dependencies first and skip the dependents of a failed project', async () => {
+    useFakeRunner({ 'tfcmt -var target:network': 1 });
+    writeConfig(`
+output_mode: comment
+abort_on_execution_order_fail: true
+projects:
+  - name: app
+    dir: envs/app
+    depends_on: [network]
+  - name: network
+    dir: envs/network
+  - name: dns
+    dir: envs/dns
+`);
+    commentOnPullRequest('terraform plan');
+
+    await run();
+
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toEqual([
+      expect.stringContaining('target:network'),
+      expect.stringContaining('target:dns'),
+    ]);
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform plan failed for 1 of 3 project(s): network'
+    );
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('| `app` | plan | ⏭️ Skipped | Skipped because dependency network failed |')
+    );
+  });
+
+  it('should stop a plan that outlives plan_timeout and say so on the pull request', async () => {
+    writeConfig(`
+plan_timeout: 1s
+projects:
+  - name: staging
+    dir: envs/staging
+`);
+    setCommandRunner((commandLine, _args, options) =>
+      path.basename(commandLine) === 'tfcmt'
+        ? new Promise((resolve) => options?.signal?.addEventListener('abort', () => resolve(130)))
+        : Promise.resolve(0)
+    );
+    commentOnPullRequest('terraform plan -project=staging');
+
+    await run();
+
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('Terraform plan timed out after 1s')
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith(
+      'terraform plan failed for 1 of 1 project(s): staging'
+    );
+  });
+
+  it('should stop terraform, report the cancellation and skip the rest when the run is cancelled', async () => {
+    writeConfig(`
+projects:
+  - name: staging
+    dir: envs/staging
+  - name: production
+    dir: envs/production
+`);
+    const stopped: string[] = [];
+    setCommandRunner((commandLine, args = [], options) => {
+      const line = [path.basename(commandLine), ...args].join(' ');
+      calls.push(line);
+      if (!line.startsWith('tfcmt')) {
+        return Promise.resolve(0);
+      }
+      return new Promise((resolve) => {
+        options?.signal?.addEventListener('abort', () => {
+          stopped.push(line);
+          resolve(130);
+        });
+        process.emit('SIGINT', 'SIGINT');
+      });
+    });
+    commentOnPullRequest('terraform plan');
+    Object.assign(github.context, { serverUrl: 'https://github.com', runId: 99 });
+    const listeners = process.listenerCount('SIGINT');
+
+    await run();
+
+    expect(stopped).toHaveLength(1);
+    expect(calls.filter((line) => line.startsWith('tfcmt'))).toHaveLength(1);
+    expect(reportCommitStatus).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      'abc123',
+      'plan',
+      'staging',
+      'error',
+      'terraform plan was cancelled',
+      expect.anything()
+    );
+    expect(mockPostComment).toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining(
+        'The [workflow run](https://github.com/acme/infra/actions/runs/99) was cancelled'
+      )
+    );
+    expect(mockPostComment).not.toHaveBeenCalledWith(
+      'ghs_token',
+      'acme',
+      'infra',
+      42,
+      expect.stringContaining('failed for project')
+    );
+    expect(mockCore.setFailed).toHaveBeenCalledWith('terraform plan was cancelled');
+    // The signal handlers are removed once the run is over
+    expect(process.listenerCount('SIGINT')).toBe(listeners);
+  });
+});
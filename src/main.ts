@@ -1,109 +1,3686 @@
 /**
- * Main entry point for Terraform PR Comment Action
+ * Orchestration of the Terraform PR Comment Action (started from index.ts)
  */
 
+import * as fs from 'node:fs';
 import * as path from 'node:path';
 import * as core from '@actions/core';
 import * as github from '@actions/github';
-import { downloadPlanFile, uploadPlanFile } from './artifact-manager';
-import { parseComment, validateProjectNames } from './comment-parser';
-import { getDefaultRequirements, loadConfig } from './config';
 import {
+  deleteSavedPlans,
+  downloadPlanFile,
+  hasSavedPlan,
+  type PlanArtifactScope,
+  uploadPlanFile,
+  verifyPlanMetadata,
+} from './artifact-manager';
+import { checkCommandAuthorization, DEFAULT_APPLY_ALL_AUTHORIZATION } from './authorization';
+import { isRunCancelled, RunCancelledError, trapCancellation } from './cancellation';
+import { findPathsWithoutCodeownerApproval } from './codeowners';
+import { estimatePlanCost, exceedsCostLimit, formatCost } from './cost-estimate';
+import {
+  COMMENT_COMMANDS,
+  getCommentSyntax,
+  isStateMutation,
+  parseComments,
+  parseDispatchInputs,
+  UnknownCommandError,
+  validateProjectNames,
+} from './comment-parser';
+import {
+  ConfigValidationError,
+  fetchConfigTree,
+  filterEnabledProjects,
+  filterProjectsByWorkspace,
+  findProjectsByDirs,
+  findProjectsByPatterns,
+  findProjectsByTags,
+  getCommandTimeout,
+  getDefaultConfigTree,
+  getDefaultRequirements,
+  getRetryPolicy,
+  isProjectPattern,
+  loadConfigWithCentral,
+  matchesBranchFilters,
+  parseDuration,
+  readConfigTree,
+  resolveEnvReferences,
+  resolveProjectDir,
+  shouldAutoplan,
+  toRepositoryPath,
+} from './config';
+import { formatDiagnostic } from './diagnostics';
+import { buildDriftSummary, type DriftResult, reportDriftIssue } from './drift';
+import {
+  buildDependencyLevels,
+  buildDirectoryLanes,
+  buildExecutionGroups,
+  DEFAULT_PARALLEL_POOL_SIZE,
+  runWithConcurrency,
+} from './execution-order';
+import { authenticateAsApp } from './github-app';
+import { fetchRepositoryFile, formatRateLimitState, getRateLimitState } from './github-client';
+import { findLocalModuleDirs } from './module-graph';
+import { type NotificationEvent, sendNotification } from './notifier';
+import {
+  diffPlannedChanges,
+  formatChangeSummary,
+  formatDestroyPreview,
+  isNoOp,
+  parseChangeSummary,
+  parsePlannedChanges,
+  parsePlannedDestroys,
+  parsePlanOutputChanges,
+} from './plan-summary';
+import {
+  addReaction,
+  buildCancelledComment,
+  buildConfigErrorComment,
+  buildCostEstimateComment,
+  buildCostEstimateMarker,
+  buildDestroyPreviewComment,
+  buildFailureComment,
+  buildForkRejectionComment,
+  buildImportPlanComment,
+  buildMergeComment,
+  buildMergeFailureComment,
+  buildNoChangesComment,
+  buildOutputsComment,
+  buildOutputsTable,
+  buildPlanChangesComment,
+  buildPlanChangesMarker,
+  buildPlanCommentMarker,
+  buildPlanSummaryComment,
+  buildPlanSummaryMarker,
+  buildPolicyApprovalComment,
+  buildPolicyCheckComment,
+  buildPolicyCheckMarker,
+  buildProjectLimitComment,
+  buildReusedPlanComment,
+  buildSecurityScanComment,
+  buildSecurityScanMarker,
+  buildSuccessComment,
+  buildUnknownCommandComment,
+  CONFIG_ERRORS_MARKER,
+  findCommentByMarker,
+  markPlanCommentsOutdated,
+  minimizeComments,
+  parsePlanSnapshot,
+  postComment,
+  postReviewComment,
+  upsertComment,
+} from './pr-comment';
+import { deleteBranch, mergePullRequest } from './pr-merge';
+import {
+  getChangedFiles,
   getCommentBodyFromContext,
+  getMergedPullRequest,
   getPRNumberFromContext,
   getPullRequestInfo,
+  isCheckRunRerequest,
+  isDriftEvent,
+  isMergeEvent,
+  isPullRequestPush,
   validateEventType,
+  validateLabelRequirements,
   validateRequirements,
 } from './pr-validation';
-import { executeTerraformWithTfcmt, validateTerraformInstalled } from './terraform';
-import { setupTfcmt } from './tfcmt';
-import type { ProjectConfig, PullRequestInfo, TerraformCommand } from './types';
+import { checkPlanPolicies, getProjectPolicySets, isPolicyOwner } from './policy-check';
+import {
+  acquireProjectLock,
+  DEFAULT_LOCK_TIMEOUT,
+  DEFAULT_LOCKED_COMMANDS,
+  releaseProjectLock,
+} from './project-lock';
+import {
+  addSensitiveValues,
+  collectSensitiveValues,
+  masksSensitiveValues,
+  redact,
+  setRedaction,
+} from './redaction';
+import {
+  buildStatusContext,
+  buildStatusDescription,
+  type CheckRunCommand,
+  type CommitStatusState,
+  createCommitStatus,
+  getCommitStatus,
+  parseCheckRunExternalId,
+  POLICY_CHECK_STATUS_COMMAND,
+  reportCheckRun,
+  reportCommitStatus,
+  SECURITY_SCAN_STATUS_COMMAND,
+  shouldPostComments,
+  shouldSetStatuses,
+} from './reporter';
+import { usesKeyword } from './requirements';
+import {
+  buildConsolidatedComment,
+  buildConsolidatedMarker,
+  buildJobSummary,
+  buildRunOutputs,
+  buildRunSummary,
+  findFailedProjects,
+  type ProjectResult,
+} from './run-summary';
+import { scanProject } from './security-scan';
+import {
+  collectDiagnostics,
+  executeDriftCheck,
+  executeImportPlan,
+  executeTerraformDestroy,
+  executeTerraformForceUnlock,
+  executeTerraformImport,
+  executeTerraformInit,
+  executeTerraformOutput,
+  executeTerraformShow,
+  executeTerraformShowJson,
+  executeTerraformState,
+  executeTerraformWithTfcmt,
+  isLockHeldByThisRunner,
+  parseStateLock,
+  setDebugCommandLines,
+  setPluginCache,
+  TerraformCommandError,
+  usesTerragrunt,
+  validateTerraformInstalled,
+  validateTerragruntInstalled,
+  writePlanJson,
+} from './terraform';
+import { installTerragrunt } from './terraform-installer';
+import { setupTfcmt, writeTfcmtConfig } from './tfcmt';
+import type {
+  ChangeSummary,
+  CommentCommand,
+  Config,
+  CostEstimate,
+  InfracostConfig,
+  LockedCommand,
+  MergeAfterApplyConfig,
+  MergedPullRequest,
+  NoChangesComment,
+  ParsedComment,
+  PlannedChange,
+  PolicyCheckResult,
+  PolicySetConfig,
+  PreviousPlanComments,
+  ProjectConfig,
+  PullRequestInfo,
+  ReactionContent,
+  Requirement,
+  SecurityScanResult,
+  StateSubcommand,
+  TerraformCommand,
+  TerraformDiagnostic,
+  TerraformExecutionOptions,
+  TerraformResult,
+  WorkflowStep,
+} from './types';
+import { buildWorkflowEnv, getWorkflowSteps, runWorkflow } from './workflow';
+
+/**
+ * Main action execution
+ *
+ * @remarks
+ * Reads everything from the action inputs and the GitHub context, and reports
+ * failures through core.setFailed instead of throwing.
+ */
+export async function run(): Promise<void> {
+  // Results of every command, exposed as action outputs even when the run fails
+  const projectResults: ProjectResult[] = [];
+  // Reacts to the triggering comment once it is known to hold commands
+  let react: ((content: ReactionContent) => Promise<void>) | undefined;
+  // A cancelled workflow stops terraform and reports the projects it was running
+  const releaseCancellation = trapCancellation();
+
+  try {
+    // Drift mode checks every project whatever the event, e.g. on a push to the default branch
+    const driftMode = getRunMode() === 'drift';
+    if (!driftMode) {
+      validateEventType(github.context.eventName);
+    }
+
+    // Get inputs
+    const token = await getGitHubToken();
+    process.env.GITHUB_TOKEN = token;
+    const configPath = core.getInput('config-path') || '.terraform-action.yaml';
+    const defaultProjectDir =
+      core.getInput('default-project-dir') || process.env.DEFAULT_PROJECT_DIR || undefined;
+    const configFromBaseBranch = core.getInput('config-from-base-branch') === 'true';
+
+    core.info('Starting Terraform PR Comment Action');
+
+    let config: Config;
+    try {
+      config = await loadActionConfig(
+        token,
+        configPath,
+        defaultProjectDir,
+        configFromBaseBranch,
+        core.getInput('config-repo') || undefined,
+        core.getInput('config-repo-token') || token
+      );
+    } catch (error) {
+      // Tell the PR what to fix instead of leaving it to the Actions log
+      if (error instanceof ConfigValidationError) {
+        await reportConfigErrors(token, configPath, error.errors);
+      }
+      throw error;
+    }
+    core.info(`Loaded configuration with ${config.projects.length} project(s)`);
+
+    // Validate the installation of every CLI the projects run with
+    for (const binary of new Set(config.projects.map((p) => p.binary ?? 'terraform'))) {
+      await validateTerraformInstalled(binary);
+    }
+    if (config.projects.some((project) => projectUsesTerragrunt(config, project))) {
+      if (config.terragrunt_version) {
+        core.addPath(path.dirname(await installTerragrunt(config.terragrunt_version)));
+      }
+      await validateTerragruntInstalled();
+    }
+    setRedaction(config.redaction);
+    setDebugCommandLines(config.debug === true);
+    const pluginCacheDir = setPluginCache(config.plugin_cache !== false);
+    if (pluginCacheDir) {
+      core.info(`Sharing providers between inits in ${pluginCacheDir}`);
+    }
+
+    // A manual run with a command input is handled like a comment without a PR
+    const dispatched =
+      !driftMode && github.context.eventName === 'workflow_dispatch'
+        ? parseDispatchInputs(github.context.payload.inputs)
+        : null;
+    if (dispatched) {
+      core.warning(
+        'Running from workflow_dispatch without a pull request: PR requirements are skipped'
+      );
+    }
+
+    let commands: ParsedComment[];
+    let merged: MergedPullRequest | null = null;
+    if (dispatched) {
+      commands = [dispatched];
+    } else if (!driftMode && github.context.eventName === 'issue_comment') {
+      const commentBody = getCommentBodyFromContext(github.context);
+      core.info(`Processing comment: ${commentBody}`);
+
+      // Parse every command line of the comment before running any of them
+      const syntax = getCommentSyntax(config);
+      try {
+        commands = parseComments(commentBody, syntax);
+      } catch (error) {
+        // Reply to a bare prefix or a typo instead of leaving the author without feedback
+        if (error instanceof UnknownCommandError) {
+          await reportRejectedCommand(
+            token,
+            config,
+            buildUnknownCommandComment(
+              error.prefix,
+              syntax.projectFlags[0],
+              COMMENT_COMMANDS,
+              error.subcommand,
+              error.suggestion
+            )
+          );
+        }
+        throw error;
+      }
+      if (commands.length === 0) {
+        core.info('Comment does not contain a terraform command, skipping');
+        return;
+      }
+      if (config.reactions !== false) {
+        react = (content) => reactToComment(token, content);
+        await react('eyes');
+      }
+      // The author must be allowed to run every command before any of them runs
+      await authorizeCommenter(token, config, commands);
+    } else if (!driftMode && isMergeEvent(github.context)) {
+      merged = await getMergedPullRequest(token, github.context);
+      if (!merged) {
+        core.info('The push did not merge a pull request, skipping');
+        return;
+      }
+      if (merged.baseRef !== github.context.payload.repository?.default_branch) {
+        core.info(
+          `Pull request #${merged.number} was merged into ${merged.baseRef}, ` +
+            'not the default branch, skipping'
+        );
+        return;
+      }
+      core.info(`Applying the plans saved for merged pull request #${merged.number}`);
+      commands = [{ command: 'apply', projects: [], args: [] }];
+    } else if (!driftMode && github.context.eventName === 'check_run') {
+      if (!isCheckRunRerequest(github.context)) {
+        core.info(`Check run ${github.context.payload.action}, skipping`);
+        return;
+      }
+      const rerun = getRerequestedCommand();
+      if (!rerun) {
+        core.info('The re-requested check run was not created by terraform-action, skipping');
+        return;
+      }
+      commands = [rerun];
+      // Whoever re-runs the check must be allowed to run its command
+      await authorizeCommenter(token, config, commands);
+    } else if (
+      !driftMode &&
+      github.context.eventName === 'pull_request' &&
+      github.context.payload.action === 'closed'
+    ) {
+      core.info('Pull request closed without merging, skipping');
+      return;
+    } else {
+      // A push leaves the plans of the commits before it outdated, before the new one is planned
+      if (!driftMode && config.invalidate_outdated_plans && isPullRequestPush(github.context)) {
+        await invalidateOutdatedPlans(token, config);
+      }
+      // Scheduled runs and manual runs without a command check every project for drift
+      const command = isDriftRun() ? 'drift' : 'plan';
+      commands = [{ command, projects: [], args: [] }];
+    }
+
+    // tfcmt is only downloaded once, and only if a command needs it
+    let tfcmtPath: Promise<string> | undefined;
+    const getTfcmtPath = (): Promise<string> => {
+      tfcmtPath ??= setupTfcmt();
+      return tfcmtPath;
+    };
+
+    // Commands run in order; a failed command stops the ones queued after it
+    for (const [index, parsedComment] of commands.entries()) {
+      if (commands.length > 1) {
+        core.info(`Command ${index + 1} of ${commands.length}`);
+      }
+      try {
+        await runCommand(
+          token,
+          config,
+          parsedComment,
+          dispatched !== null,
+          getTfcmtPath,
+          projectResults,
+          merged
+        );
+      } catch (error) {
+        const skipped = commands.length - index - 1;
+        if (skipped > 0) {
+          core.warning(`Skipping ${skipped} remaining command(s) after a failure`);
+        }
+        throw error;
+      }
+    }
+
+    core.info('Terraform PR Comment Action completed successfully');
+    await react?.('+1');
+  } catch (error) {
+    await react?.('-1');
+
+    // Annotate each configuration problem so all of them show up in the Actions UI
+    if (error instanceof ConfigValidationError) {
+      for (const problem of error.errors) {
+        core.error(problem);
+      }
+    }
+
+    // Fail fast on any error
+    const message = error instanceof Error ? error.message : String(error);
+    core.setFailed(message);
+  } finally {
+    if (projectResults.length > 0) {
+      setRunOutputs(projectResults);
+      await writeJobSummary(projectResults);
+    }
+    const rateLimit = getRateLimitState();
+    if (rateLimit) {
+      core.info(formatRateLimitState(rateLimit));
+    }
+    releaseCancellation();
+  }
+}
+
+/**
+ * Reads the command a re-requested check run runs again
+ *
+ * @returns The command, or undefined if the check run was not created by this action
+ * @throws Error if the check run does not belong to a pull request
+ *
+ * @remarks
+ * The pull request is added to the payload as the issue a comment would be on, so
+ * the rest of the run finds it the same way. A plan runs again even if one was saved
+ * for the head commit.
+ */
+function getRerequestedCommand(): ParsedComment | undefined {
+  const checkRun = github.context.payload.check_run;
+  const rerun = parseCheckRunExternalId(checkRun?.external_id);
+  if (!rerun) {
+    return undefined;
+  }
+  const prNumber: number | undefined = checkRun.pull_requests?.[0]?.number;
+  if (!prNumber) {
+    throw new Error(`Check run ${checkRun.name} does not belong to a pull request`);
+  }
+  github.context.payload.issue = { number: prNumber };
+  core.info(`Re-running terraform ${rerun.command} of project ${rerun.project} for #${prNumber}`);
+
+  return {
+    command: rerun.command,
+    projects: [rerun.project],
+    args: rerun.args,
+    ...(rerun.destroy ? { destroy: true } : {}),
+    force: true,
+  };
+}
+
+/**
+ * Modes the run can be switched to with the mode input
+ */
+const RUN_MODES = ['drift'];
+
+/**
+ * Reads the run mode from the mode input, or the TERRAFORM_ACTION_MODE environment variable
+ *
+ * @returns The mode, or undefined when the event decides what to run
+ * @throws Error if the mode is not known
+ */
+function getRunMode(): string | undefined {
+  const mode = core.getInput('mode') || process.env.TERRAFORM_ACTION_MODE || '';
+  if (mode === '') {
+    return undefined;
+  }
+  if (!RUN_MODES.includes(mode)) {
+    throw new Error(`Invalid mode: ${mode}. Must be one of: ${RUN_MODES.join(', ')}`);
+  }
+  return mode;
+}
+
+/**
+ * Reads the token the run authenticates with
+ *
+ * @returns An installation token of the GitHub App when app-id and app-private-key are set,
+ *   otherwise the github-token input
+ * @throws Error if only one of app-id and app-private-key is set, or no token is available
+ */
+async function getGitHubToken(): Promise<string> {
+  const appId = core.getInput('app-id');
+  const privateKey = core.getInput('app-private-key');
+  if (appId || privateKey) {
+    if (!appId || !privateKey) {
+      throw new Error('app-id and app-private-key must be set together');
+    }
+    const { owner, repo } = github.context.repo;
+    return authenticateAsApp(appId, privateKey, owner, repo);
+  }
+  return core.getInput('github-token', { required: true });
+}
+
+/**
+ * Whether the run checks projects for drift rather than handling a pull request
+ * (drift mode, or a scheduled or manually dispatched run)
+ */
+function isDriftRun(): boolean {
+  return getRunMode() === 'drift' || isDriftEvent(github.context.eventName);
+}
+
+/**
+ * Loads the configuration from the workspace, or from the PR base branch (config-from-base-branch)
+ *
+ * @param token - GitHub token
+ * @param configPath - Path to the configuration file
+ * @param defaultProjectDir - Directory of the project used when there is no configuration file
+ * @param fromBaseBranch - Whether to read the configuration from the base branch of the PR
+ * @param configRepo - Central repository the configuration overrides (the config-repo input)
+ * @param configRepoToken - Token that can read the central repository
+ * @returns Validated configuration
+ * @throws Error if the configuration is missing, cannot be read, or is invalid
+ *
+ * @remarks
+ * The base branch version cannot be changed by the PR itself, so a PR cannot weaken its own
+ * requirements. If it cannot be fetched, the run fails rather than trusting the PR's copy.
+ * Runs without a pull request read the checked-out workspace. With a central repository,
+ * from the input or the file's config_repo, the file is merged over the central
+ * configuration, and may be left out.
+ */
+async function loadActionConfig(
+  token: string,
+  configPath: string,
+  defaultProjectDir: string | undefined,
+  fromBaseBranch: boolean,
+  configRepo: string | undefined,
+  configRepoToken: string
+): Promise<Config> {
+  const local = await readActionConfig(
+    token,
+    configPath,
+    defaultProjectDir,
+    fromBaseBranch,
+    configRepo !== undefined
+  );
+  return loadConfigWithCentral(local, configRepo, (central, repoPath) => {
+    core.info(
+      `Reading ${repoPath} from central repository ${central.owner}/${central.repo}` +
+        (central.ref ? ` at ${central.ref}` : '')
+    );
+    return fetchRepositoryFile(configRepoToken, central.owner, central.repo, repoPath, central.ref);
+  });
+}
+
+/**
+ * Reads the configuration file of the repository, without validating it
+ *
+ * @param token - GitHub token
+ * @param configPath - Path to the configuration file
+ * @param defaultProjectDir - Directory of the project used when there is no configuration file
+ * @param fromBaseBranch - Whether to read the configuration from the base branch of the PR
+ * @param optional - Whether the file may be missing (a central configuration stands in for it)
+ * @returns Raw configuration, or undefined when an optional file is missing
+ */
+async function readActionConfig(
+  token: string,
+  configPath: string,
+  defaultProjectDir: string | undefined,
+  fromBaseBranch: boolean,
+  optional: boolean
+): Promise<unknown> {
+  const base = fromBaseBranch ? (await resolveBranches(token))?.base : undefined;
+  if (fromBaseBranch && base === undefined) {
+    core.info('No pull request, reading the configuration from the workspace');
+  }
+
+  if (base !== undefined) {
+    const { owner, repo } = github.context.repo;
+    const fetchFile = (repoPath: string): Promise<string | null> =>
+      fetchRepositoryFile(token, owner, repo, repoPath, base);
+    if (
+      (defaultProjectDir || optional) &&
+      (await fetchFile(toRepositoryPath(configPath))) === null
+    ) {
+      if (defaultProjectDir) {
+        core.info(
+          `No configuration file at ${configPath} on base branch ${base}, using project directory ${defaultProjectDir}`
+        );
+        return getDefaultConfigTree(defaultProjectDir);
+      }
+      core.info(`No configuration file at ${configPath} on base branch ${base}`);
+      return undefined;
+    }
+    core.info(`Reading the configuration from base branch ${base}`);
+    return fetchConfigTree(configPath, fetchFile, `base branch ${base}`);
+  }
+
+  // Without a file, a default project directory stands in for it
+  if (defaultProjectDir && !fs.existsSync(configPath)) {
+    core.info(
+      `No configuration file at ${configPath}, using project directory ${defaultProjectDir}`
+    );
+    return getDefaultConfigTree(defaultProjectDir);
+  }
+  if (optional && !fs.existsSync(configPath)) {
+    core.info(`No configuration file at ${configPath}, using the central configuration only`);
+    return undefined;
+  }
+  return readConfigTree(configPath);
+}
+
+/**
+ * Posts or updates the PR comment listing the problems found in the configuration
+ *
+ * @param token - GitHub token
+ * @param configPath - Path to the configuration file
+ * @param errors - Every problem found
+ *
+ * @remarks
+ * The comment is updated in place so that repeated runs do not pile up comments.
+ * Errors while posting are only logged so that the configuration errors are still reported.
+ */
+async function reportConfigErrors(
+  token: string,
+  configPath: string,
+  errors: string[]
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
+  const { owner, repo } = github.context.repo;
+  try {
+    await upsertComment(
+      token,
+      owner,
+      repo,
+      prNumber,
+      CONFIG_ERRORS_MARKER,
+      buildConfigErrorComment(configPath, errors)
+    );
+  } catch (commentError) {
+    core.warning(
+      `Failed to post comment: ${commentError instanceof Error ? commentError.message : String(commentError)}`
+    );
+  }
+}
+
+/**
+ * Runs one parsed command across its target projects
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param parsedComment - Command to run
+ * @param dispatched - Whether the command came from workflow_dispatch inputs (no PR)
+ * @param getTfcmtPath - Sets up tfcmt on first use and returns its path
+ * @param collected - Receives the result of every project that ran
+ * @param merged - Pull request whose merge triggered the run (apply_on_merge)
+ * @throws Error if the command is rejected or fails for any project
+ */
+async function runCommand(
+  token: string,
+  config: Config,
+  parsedComment: ParsedComment,
+  dispatched: boolean,
+  getTfcmtPath: () => Promise<string>,
+  collected: ProjectResult[],
+  merged: MergedPullRequest | null = null
+): Promise<void> {
+  const { command, args, stateSubcommand } = parsedComment;
+  let targetProjectNames: string[] = config.projects.map((p) => p.name);
+  const explicitSelection =
+    !parsedComment.all &&
+    (parsedComment.projects.length > 0 || parsedComment.dirs !== undefined);
+  const tagSelection = !parsedComment.all && parsedComment.tags !== undefined;
+  // Projects named outright; those matched by a pattern, directory or tag are only implied
+  const namedProjects = parsedComment.projects.filter((name) => !isProjectPattern(name));
+  let importTarget: ImportTarget | undefined;
+  const overrides: TerraformExecutionOptions = {};
+
+  core.info(`Detected command: terraform ${command}`);
+
+  if (parsedComment.all) {
+    core.info('Targeting all configured projects (--all)');
+  } else if (explicitSelection || tagSelection) {
+    validateProjectNames(namedProjects, targetProjectNames);
+    // Named projects keep their order; projects matched by pattern, directory or tag follow
+    const patterns = parsedComment.projects.filter(isProjectPattern);
+    const dirs = parsedComment.dirs ?? [];
+    const matched = [
+      ...findProjectsByPatterns(config.projects, patterns),
+      ...findProjectsByDirs(config.projects, dirs, process.cwd(), config.base_dir),
+      ...findProjectsByTags(config.projects, parsedComment.tags ?? []),
+    ];
+    targetProjectNames = [...new Set([...namedProjects, ...matched])];
+
+    core.info(`Target projects: ${targetProjectNames.join(', ')}`);
+  }
+  if (parsedComment.workspaces) {
+    try {
+      targetProjectNames = filterProjectsByWorkspace(
+        config.projects,
+        targetProjectNames,
+        parsedComment.workspaces
+      );
+    } catch (error) {
+      await reportRejectedCommand(
+        token,
+        config,
+        `⏸️ ${error instanceof Error ? error.message : String(error)}`
+      );
+      throw error;
+    }
+    const workspaces = parsedComment.workspaces.join(', ');
+    core.info(`Projects in workspace ${workspaces}: ${targetProjectNames.join(', ')}`);
+  }
+  if (parsedComment.importAddress && parsedComment.importId) {
+    importTarget = { address: parsedComment.importAddress, id: parsedComment.importId };
+  }
+  if (parsedComment.refresh !== undefined) {
+    overrides.refresh = parsedComment.refresh;
+  }
+  if (parsedComment.lockTimeout !== undefined) {
+    overrides.lockTimeout = parsedComment.lockTimeout;
+  }
+  if (config.retry) {
+    overrides.retry = getRetryPolicy(config.retry);
+  }
+  // Comment templates, and the server tfcmt comments on when it is not github.com
+  const tfcmtConfigPath = writeTfcmtConfig(config.comment_templates);
+  if (tfcmtConfigPath) {
+    overrides.tfcmtConfigPath = tfcmtConfigPath;
+  }
+  if (dispatched) {
+    // tfcmt has no pull request to comment on
+    overrides.suppressComment = true;
+  }
+
+  try {
+    // Naming a disabled project is an error; one only selected by tag is skipped
+    filterEnabledProjects(config.projects, namedProjects, true);
+    targetProjectNames = filterEnabledProjects(config.projects, targetProjectNames, false);
+  } catch (error) {
+    await reportRejectedCommand(
+      token,
+      config,
+      `⏸️ ${error instanceof Error ? error.message : String(error)}`
+    );
+    throw error;
+  }
+  if (targetProjectNames.length === 0) {
+    core.info('All target projects are disabled, skipping');
+    return;
+  }
+
+  // Like a disabled project, a named project that does not run for this PR is an error,
+  // while projects only implied by the command are skipped quietly
+  const branchMatched = await filterProjectsByBranch(token, config, targetProjectNames);
+  const namedButFiltered = namedProjects.filter(
+    (name) => targetProjectNames.includes(name) && !branchMatched.includes(name)
+  );
+  if (namedButFiltered.length > 0) {
+    const list = namedButFiltered.map((name) => `'${name}'`).join(', ');
+    const message =
+      namedButFiltered.length === 1
+        ? `Project ${list} does not run for this pull request (branch filters do not match)`
+        : `Projects ${list} do not run for this pull request (branch filters do not match)`;
+    await reportRejectedCommand(token, config, `⏸️ ${message}`);
+    throw new Error(message);
+  }
+  targetProjectNames = branchMatched;
+  if (targetProjectNames.length === 0) {
+    core.info('No projects match the branch filters of this pull request, skipping');
+    return;
+  }
+
+  // A merge only applies the projects set to apply on merge that have a plan to apply
+  if (merged) {
+    targetProjectNames = await filterProjectsForMerge(token, config, targetProjectNames, merged);
+    if (targetProjectNames.length === 0) {
+      core.info(`No project has a plan to apply for pull request #${merged.number}, skipping`);
+      return;
+    }
+  }
+
+  // A pull request event only plans the projects its changes trigger
+  if (github.context.eventName === 'pull_request' && command === 'plan') {
+    targetProjectNames = await filterProjectsByAutoplan(token, config, targetProjectNames);
+    if (targetProjectNames.length === 0) {
+      core.info('No project is autoplanned for the files this pull request changes, skipping');
+      return;
+    }
+  }
+
+  if (command === 'approve_policies') {
+    await approvePolicies(token, config, targetProjectNames, dispatched);
+    return;
+  }
+
+  // Guard against accidental fan-out; named or tagged projects, a workspace selection, --all
+  // and scheduled runs are not limited
+  const limit = config.max_projects_per_run;
+  if (
+    limit !== undefined &&
+    targetProjectNames.length > limit &&
+    !explicitSelection &&
+    !tagSelection &&
+    parsedComment.workspaces === undefined &&
+    !parsedComment.all &&
+    !isDriftRun() &&
+    !merged
+  ) {
+    await reportRejectedCommand(
+      token,
+      config,
+      buildProjectLimitComment(command, targetProjectNames, limit)
+    );
+    throw new Error(
+      `terraform ${command} matched ${targetProjectNames.length} projects, more than max_projects_per_run (${limit}). Name the projects with -project=`
+    );
+  }
+
+  if (command === 'drift') {
+    await runDriftDetection(token, config, targetProjectNames, overrides);
+    return;
+  }
+
+  // Get PR information (import and state rm/mv are held to the same requirements as apply,
+  // destroy to its own)
+  let pr: PullRequestInfo | null = null;
+  if (
+    !dispatched &&
+    !merged &&
+    (command === 'apply' ||
+      command === 'destroy' ||
+      command === 'import' ||
+      (stateSubcommand && isStateMutation(stateSubcommand)))
+  ) {
+    const prNumber = getPRNumberFromContext(github.context);
+    pr = await getPullRequestInfo(
+      token,
+      github.context.repo.owner,
+      github.context.repo.repo,
+      prNumber
+    );
+    if (pr.isFork && !config.allow_fork_apply) {
+      const label = stateSubcommand ? `state ${stateSubcommand}` : command;
+      await reportRejectedCommand(token, config, buildForkRejectionComment(label));
+      throw new Error(
+        `terraform ${label} is not allowed on pull requests from forks (set allow_fork_apply to allow it)`
+      );
+    }
+    pr = await checkCodeownerApproval(token, config, targetProjectNames, pr);
+  }
+
+  // Setup tfcmt
+  const tfcmtPath = await getTfcmtPath();
+
+  const outputMode = config.output_mode ?? 'both';
+  const consolidate = shouldPostComments(outputMode) && config.comment_mode === 'consolidated';
+  // tfcmt comments are held back when no-op results are reported differently,
+  // when earlier plan comments are replaced or marked outdated later, when every project
+  // is reported in one comment, when the plan must be read before its comment can be masked
+  // or when tfcmt cannot find the pull request of a re-run check
+  const deferComments =
+    (config.comment_on_no_changes ?? 'full') !== 'full' ||
+    getPreviousPlanComments(config, command) !== 'keep' ||
+    marksPlanComments(config, command) ||
+    consolidate ||
+    masksPlanComments(command) ||
+    isCheckRunRerequest(github.context);
+  // Policy checks and blocking security scans are recorded as commit statuses whatever the
+  // output mode, as apply reads them
+  const checksPolicies =
+    command === 'plan' &&
+    targetProjectNames.some((name) => {
+      const project = config.projects.find((p) => p.name === name);
+      return project?.policy_sets !== undefined || project?.security_scan?.block_on !== undefined;
+    });
+  const headSha =
+    shouldSetStatuses(outputMode) || checksPolicies ? await resolveHeadSha(token, pr) : undefined;
+  const ctx: RunContext = {
+    token,
+    config,
+    command,
+    args,
+    stateSubcommand,
+    importTarget,
+    overrides:
+      shouldPostComments(outputMode) && !deferComments
+        ? overrides
+        : { ...overrides, suppressComment: true },
+    pr,
+    appliedSha: merged ? merged.headSha : pr?.sha,
+    headSha: shouldSetStatuses(outputMode) ? headSha : undefined,
+    policySha: checksPolicies ? headSha : undefined,
+    planScope: merged
+      ? getMergedPlanScope(token, merged)
+      : command === 'plan' || command === 'apply' || command === 'show'
+        ? await resolvePlanScope(token, pr)
+        : undefined,
+    tfcmtPath,
+    consolidate,
+    destroy: parsedComment.destroy === true,
+    // A plan with its own flags may differ from the saved one, so it always runs
+    reusePlans:
+      command === 'plan' &&
+      config.plan_cache !== false &&
+      parsedComment.force !== true &&
+      args.length === 0 &&
+      parsedComment.refresh === undefined &&
+      parsedComment.lockTimeout === undefined,
+  };
+
+  const targetProjects = targetProjectNames.map((projectName) => {
+    const project = config.projects.find((p) => p.name === projectName);
+    if (!project) {
+      throw new Error(`Project not found: ${projectName}`);
+    }
+    return project;
+  });
+  const results = await runProjects(ctx, targetProjects);
+
+  collected.push(...results);
+  await reportRunSummary(ctx, results);
+
+  if (isRunCancelled()) {
+    throw new RunCancelledError(`terraform ${commandLabel(ctx)} was cancelled`);
+  }
+  const failed = findFailedProjects(results);
+  if (failed.length > 0) {
+    throw new Error(
+      `terraform ${commandLabel(ctx)} failed for ${failed.length} of ${results.length} project(s): ${failed.join(', ')}`
+    );
+  }
+
+  if (command === 'apply' && pr && config.merge_after_apply) {
+    await mergeAfterApply(
+      token,
+      config,
+      config.merge_after_apply,
+      pr,
+      results.map((r) => r.project)
+    );
+  }
+}
+
+/**
+ * Runs the command for every target project, one execution order group at a time
+ *
+ * @param ctx - Run context
+ * @param projects - Target projects, in target order
+ * @returns Project results, group by group
+ *
+ * @remarks
+ * Within a group, a project runs after the target projects it depends on. With
+ * parallel_plan or parallel_apply, projects that are ready run concurrently, up to
+ * parallel_pool_size at a time; projects sharing a directory still run one after
+ * another. A project's own parallel_plan or parallel_apply wins over the top-level one,
+ * and a project that is not parallel runs on its own once the others of its level have
+ * finished. Every project of a group is attempted unless abort_on_execution_order_fail
+ * is set (by the project, or else at the top level) for a project that fails: then its
+ * dependents and the projects of later groups are skipped.
+ */
+async function runProjects(ctx: RunContext, projects: ProjectConfig[]): Promise<ProjectResult[]> {
+  const { config, command } = ctx;
+  const poolSize = config.parallel_pool_size ?? DEFAULT_PARALLEL_POOL_SIZE;
+  const parallel = (project: ProjectConfig): boolean =>
+    command === 'plan'
+      ? (project.parallel_plan ?? config.parallel_plan === true)
+      : command === 'apply' && (project.parallel_apply ?? config.parallel_apply === true);
+  const aborts = (project: ProjectConfig): boolean =>
+    (project.abort_on_execution_order_fail ?? config.abort_on_execution_order_fail) === true;
+
+  const runLane = async (lane: ProjectConfig[]): Promise<ProjectResult[]> => {
+    const laneResults: ProjectResult[] = [];
+    for (const project of lane) {
+      laneResults.push(
+        isRunCancelled()
+          ? skippedResult(ctx, project, 'Skipped because the workflow run was cancelled')
+          : await runProjectResult(ctx, project)
+      );
+    }
+    return laneResults;
+  };
+
+  const results: ProjectResult[] = [];
+  // Projects whose failure, or skip, makes their dependents skipped
+  const stopped = new Set<string>();
+  const groups = buildExecutionGroups(projects);
+  for (const [index, group] of groups.entries()) {
+    const groupResults: ProjectResult[] = [];
+    let abortGroups = false;
+    for (const level of buildDependencyLevels(group)) {
+      const runnable: ProjectConfig[] = [];
+      for (const project of level) {
+        const failedDependency = project.depends_on?.find((name) => stopped.has(name));
+        if (failedDependency) {
+          groupResults.push(
+            skippedResult(ctx, project, `Skipped because dependency ${failedDependency} failed`)
+          );
+          stopped.add(project.name);
+        } else {
+          runnable.push(project);
+        }
+      }
+
+      // A lane runs in the pool only if every project in it may run in parallel
+      const lanes = buildDirectoryLanes(runnable);
+      const pooled = lanes.filter((lane) => lane.every(parallel));
+      const serial = lanes.filter((lane) => !pooled.includes(lane));
+      const laneResults = new Map<ProjectConfig[], ProjectResult[]>();
+      const pooledResults = await runWithConcurrency(pooled, poolSize, runLane);
+      pooled.forEach((lane, i) => laneResults.set(lane, pooledResults[i]));
+      for (const lane of serial) {
+        laneResults.set(lane, await runLane(lane));
+      }
+
+      for (const lane of lanes) {
+        for (const result of laneResults.get(lane) ?? []) {
+          groupResults.push(result);
+          const project = lane.find((p) => p.name === result.project);
+          if (result.status === 'failure' && project && aborts(project)) {
+            stopped.add(result.project);
+            abortGroups = true;
+          }
+        }
+      }
+    }
+    results.push(...groupResults);
+
+    const remaining = groups.slice(index + 1).flat();
+    if (abortGroups && remaining.length > 0) {
+      core.warning(
+        `Skipping ${remaining.length} project(s) of later execution order groups after a failure`
+      );
+      for (const project of remaining) {
+        results.push(
+          skippedResult(
+            ctx,
+            project,
+            'Skipped because a project of an earlier execution order group failed'
+          )
+        );
+      }
+      break;
+    }
+  }
+
+  return results;
+}
+
+/**
+ * Result of a project that was not run
+ */
+function skippedResult(ctx: RunContext, project: ProjectConfig, reason: string): ProjectResult {
+  return {
+    project: project.name,
+    command: commandLabel(ctx),
+    status: 'skipped',
+    summary: null,
+    error: reason,
+  };
+}
+
+/**
+ * Runs the command for one project, capturing a failure in the result
+ *
+ * @param ctx - Run context
+ * @param project - Project configuration
+ * @returns Result of the project
+ */
+async function runProjectResult(ctx: RunContext, project: ProjectConfig): Promise<ProjectResult> {
+  const started = Date.now();
+  try {
+    const result = await runProject(ctx, project);
+    return {
+      project: project.name,
+      command: commandLabel(ctx),
+      status: 'success',
+      summary: parseChangeSummary(result.stdout),
+      details: ctx.consolidate ? buildProjectDetails(ctx, project, result) : undefined,
+      durationMs: Date.now() - started,
+      retries: result.retries,
+    };
+  } catch (error) {
+    const message = error instanceof Error ? error.message : String(error);
+    // Titled annotations list each failed project in the run summary
+    core.error(`terraform ${commandLabel(ctx)} failed for project ${project.name}: ${message}`, {
+      title: `terraform ${commandLabel(ctx)} failed: ${project.name}`,
+    });
+    return {
+      project: project.name,
+      command: commandLabel(ctx),
+      status: 'failure',
+      summary: null,
+      error: message,
+      details: !ctx.consolidate
+        ? undefined
+        : isRunCancelled()
+          ? buildCancelledComment(project.name, commandLabel(ctx), getRunUrl())
+          : buildProjectFailureComment(ctx.token, project, ctx.command, error, echoedCommand(ctx)),
+      durationMs: Date.now() - started,
+    };
+  }
+}
+
+/**
+ * Shared state for executing a command across projects in a single run
+ */
+interface RunContext {
+  /** GitHub token */
+  token: string;
+  /** Loaded configuration */
+  config: Config;
+  /** Command to execute */
+  command: Exclude<CommentCommand, 'drift' | 'approve_policies'>;
+  /** Additional terraform arguments */
+  args: string[];
+  /** Subcommand for the state command */
+  stateSubcommand?: StateSubcommand;
+  /** Resource address and ID for the import command */
+  importTarget?: ImportTarget;
+  /** Execution options taking precedence over project config */
+  overrides: TerraformExecutionOptions;
+  /** Pull request information (fetched for apply) */
+  pr: PullRequestInfo | null;
+  /**
+   * Pull request commit whose policy checks and security scans gate apply: the head of
+   * the pull request, or of the merged one (undefined without a pull request)
+   */
+  appliedSha: string | undefined;
+  /** Head commit SHA for commit statuses (undefined when statuses are disabled) */
+  headSha: string | undefined;
+  /**
+   * Head commit SHA policy checks and blocking security scans are recorded for
+   * (undefined without either)
+   */
+  policySha: string | undefined;
+  /** Pull request commit saved plans belong to (undefined without a pull request) */
+  planScope: PlanArtifactScope | undefined;
+  /** Path to tfcmt binary */
+  tfcmtPath: string;
+  /** Whether project results are posted as one consolidated comment */
+  consolidate: boolean;
+  /** Whether the plan is a read-only destroy preview (plan -destroy) */
+  destroy: boolean;
+  /** Whether a plan saved for the head commit is shown instead of planning again */
+  reusePlans: boolean;
+}
+
+/**
+ * Resource to import, from `terraform import ADDRESS ID`
+ */
+interface ImportTarget {
+  /** Resource address */
+  address: string;
+  /** Provider-specific resource ID */
+  id: string;
+}
+
+/**
+ * Label of the command run for each project (e.g., plan, state list)
+ */
+function commandLabel(ctx: RunContext): string {
+  if (ctx.destroy) {
+    return 'plan -destroy';
+  }
+  return ctx.command === 'state' ? `state ${ctx.stateSubcommand}` : ctx.command;
+}
+
+/**
+ * Full command echoed in the comments of a state command, so the surgery is on record
+ *
+ * @example
+ * echoedCommand(ctx)
+ * // => 'terraform state mv aws_instance.old aws_instance.new'
+ */
+function echoedCommand(ctx: RunContext): string | undefined {
+  if (ctx.command !== 'state') {
+    return undefined;
+  }
+  // Quote arguments that were quoted in the comment, such as addresses with spaces
+  const args = ctx.args.map((arg) => (/\s/.test(arg) ? `"${arg}"` : arg));
+  return ['terraform', 'state', ctx.stateSubcommand, ...args].join(' ');
+}
+
+/**
+ * Command the check run of a project runs again when it is re-requested
+ *
+ * @returns The command, or undefined if it cannot run again (see RERUNNABLE_COMMANDS)
+ */
+function checkRunCommand(ctx: RunContext, project: ProjectConfig): CheckRunCommand | undefined {
+  if (ctx.command !== 'plan' && ctx.command !== 'apply') {
+    return undefined;
+  }
+  return {
+    command: ctx.command,
+    project: project.name,
+    args: ctx.args,
+    ...(ctx.destroy ? { destroy: true } : {}),
+  };
+}
+
+/**
+ * Builds the Markdown shown in the details of a project's successful check run
+ *
+ * @remarks
+ * Plans with resource changes read from their JSON get the plan summary table;
+ * other results show their output.
+ */
+function buildCheckRunSummary(
+  ctx: RunContext,
+  project: ProjectConfig,
+  result: TerraformResult
+): string {
+  if (result.plannedChanges) {
+    return buildPlanSummaryComment(project.name, result.plannedChanges, result.stdout, [ctx.token]);
+  }
+  return buildSuccessComment(
+    project.name,
+    commandLabel(ctx),
+    result.stdout,
+    [ctx.token],
+    echoedCommand(ctx)
+  );
+}
+
+/**
+ * Exposes the results of a run as action outputs for later workflow steps
+ *
+ * @param results - Project results of every command in the run
+ *
+ * @remarks
+ * Skipped outside of GitHub Actions, where GITHUB_OUTPUT is not set.
+ */
+function setRunOutputs(results: ProjectResult[]): void {
+  if (!process.env.GITHUB_OUTPUT) {
+    return;
+  }
+  for (const [name, value] of Object.entries(buildRunOutputs(results))) {
+    core.setOutput(name, value);
+  }
+}
+
+/**
+ * Writes the results of the run to the job summary
+ *
+ * @param results - Project results of every command in the run
+ *
+ * @remarks
+ * Nothing is written outside of GitHub Actions, where GITHUB_STEP_SUMMARY is
+ * not set. Errors while writing are only logged.
+ */
+async function writeJobSummary(results: ProjectResult[]): Promise<void> {
+  if (!process.env.GITHUB_STEP_SUMMARY) {
+    return;
+  }
+  try {
+    await core.summary.addRaw(redact(buildJobSummary(results)), true).write();
+  } catch (error) {
+    core.warning(
+      `Failed to write job summary: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Logs the per-project results and posts them as a single PR comment
+ *
+ * @param ctx - Run context
+ * @param results - Project results
+ *
+ * @remarks
+ * With consolidated comments, the summary and every project's output are
+ * posted in one comment that is updated in place on reruns. Otherwise the
+ * summary is only posted when several projects ran, since each project
+ * already has its own comment. Errors while posting are only logged.
+ */
+async function reportRunSummary(ctx: RunContext, results: ProjectResult[]): Promise<void> {
+  core.info(buildRunSummary(results));
+
+  const prNumber = github.context.issue.number;
+  if (!prNumber || !shouldPostComments(ctx.config.output_mode)) {
+    return;
+  }
+
+  const { owner, repo } = github.context.repo;
+  try {
+    if (ctx.consolidate) {
+      const label = commandLabel(ctx);
+      await upsertComment(
+        ctx.token,
+        owner,
+        repo,
+        prNumber,
+        buildConsolidatedMarker(label),
+        buildConsolidatedComment(label, results)
+      );
+    } else if (results.length > 1) {
+      await postComment(ctx.token, owner, repo, prNumber, buildRunSummary(results));
+    }
+  } catch (error) {
+    core.warning(
+      `Failed to post run summary: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Posts a PR comment explaining why a command was not run
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param body - Markdown comment body
+ *
+ * @remarks
+ * Errors while posting are only logged so that the original error is still reported.
+ */
+async function reportRejectedCommand(token: string, config: Config, body: string): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber || !shouldPostComments(config.output_mode)) {
+    return;
+  }
+
+  try {
+    await postComment(token, github.context.repo.owner, github.context.repo.repo, prNumber, body);
+  } catch (commentError) {
+    core.warning(
+      `Failed to post comment: ${commentError instanceof Error ? commentError.message : String(commentError)}`
+    );
+  }
+}
+
+/**
+ * Ensures the author of the comment may run its commands (authorization)
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param commands - Commands parsed from the comment
+ * @throws Error if the author may not run one of the commands, after replying with the reason
+ *
+ * @remarks
+ * `terraform apply --all` is also checked against authorization.apply_all, or
+ * DEFAULT_APPLY_ALL_AUTHORIZATION without it.
+ */
+async function authorizeCommenter(
+  token: string,
+  config: Config,
+  commands: ParsedComment[]
+): Promise<void> {
+  const { owner, repo } = github.context.repo;
+  const login: string =
+    github.context.payload.comment?.user?.login ?? github.context.payload.sender?.login ?? '';
+
+  for (const command of new Set(commands.map((c) => c.command))) {
+    const rule = config.authorization?.[command];
+    if (!rule) {
+      continue;
+    }
+    const reason = await checkCommandAuthorization(token, owner, repo, login, rule);
+    if (reason) {
+      const message = `@${login} is not allowed to run terraform ${command}: ${reason}`;
+      await reportRejectedCommand(token, config, `🚫 ${message}`);
+      throw new Error(message);
+    }
+    core.info(`@${login} is allowed to run terraform ${command}`);
+  }
+
+  // Applying every project needs more than applying one
+  if (commands.some((c) => c.command === 'apply' && c.all)) {
+    const rule = config.authorization?.apply_all ?? DEFAULT_APPLY_ALL_AUTHORIZATION;
+    const reason = await checkCommandAuthorization(token, owner, repo, login, rule);
+    if (reason) {
+      const message = `@${login} is not allowed to run terraform apply --all: ${reason}`;
+      await reportRejectedCommand(token, config, `🚫 ${message}`);
+      throw new Error(message);
+    }
+    core.info(`@${login} is allowed to run terraform apply --all`);
+  }
+}
+
+/**
+ * Approves the failed policy checks of projects at the pull request's head commit
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param projectNames - Target projects; those without policy_sets are ignored
+ * @param dispatched - Whether the command came from workflow_dispatch inputs
+ * @throws Error if the command was not commented by a policy owner
+ *
+ * @remarks
+ * Approval turns the failed policy_check statuses into successful ones, so a new
+ * commit needs a new plan, policy check and approval.
+ */
+async function approvePolicies(
+  token: string,
+  config: Config,
+  projectNames: string[],
+  dispatched: boolean
+): Promise<void> {
+  if (dispatched) {
+    throw new Error('approve_policies must be commented on a pull request by a policy owner');
+  }
+
+  const login: string = github.context.payload.comment?.user?.login ?? '';
+  if (!isPolicyOwner(login, config.policies)) {
+    const message = `@${login} is not a policy owner and cannot approve policy checks`;
+    await reportRejectedCommand(token, config, `⏸️ ${message}`);
+    throw new Error(message);
+  }
+
+  const { owner, repo } = github.context.repo;
+  const prNumber = getPRNumberFromContext(github.context);
+  const { sha } = await getPullRequestInfo(token, owner, repo, prNumber, []);
+
+  const approved: string[] = [];
+  for (const name of projectNames) {
+    const project = config.projects.find((p) => p.name === name);
+    if (!project?.policy_sets) {
+      continue;
+    }
+    const context = buildStatusContext(POLICY_CHECK_STATUS_COMMAND, name, config);
+    const status = await getCommitStatus(token, owner, repo, sha, context);
+    if (status?.state !== 'failure') {
+      continue;
+    }
+    await createCommitStatus(
+      token,
+      owner,
+      repo,
+      sha,
+      'success',
+      context,
+      buildStatusDescription(
+        POLICY_CHECK_STATUS_COMMAND,
+        name,
+        'success',
+        `Policy check failed; approved by @${login}`,
+        config
+      )
+    );
+    approved.push(name);
+  }
+  core.info(
+    approved.length > 0
+      ? `Approved the policy checks of: ${approved.join(', ')}`
+      : 'No failed policy checks to approve'
+  );
+
+  if (shouldPostComments(config.output_mode)) {
+    await postComment(token, owner, repo, prNumber, buildPolicyApprovalComment(login, approved));
+  }
+}
+
+/**
+ * Reacts to the comment that triggered the run (reactions)
+ *
+ * @param token - GitHub token
+ * @param content - Reaction
+ *
+ * @remarks
+ * Reactions are only feedback, so errors are only logged.
+ */
+async function reactToComment(token: string, content: ReactionContent): Promise<void> {
+  const commentId: number | undefined = github.context.payload.comment?.id;
+  if (!commentId) {
+    return;
+  }
+
+  const { owner, repo } = github.context.repo;
+  try {
+    await addReaction(token, owner, repo, commentId, content);
+  } catch (error) {
+    core.warning(
+      `Failed to react to the comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Merges the pull request after a successful apply (merge_after_apply)
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param settings - Merge settings
+ * @param pr - Pull request information from before the apply
+ * @param appliedProjects - Projects the apply succeeded for
+ *
+ * @remarks
+ * The pull request is only merged when every project that runs for it was applied, it is
+ * approved and mergeable, and its head is still the applied commit. The apply already
+ * succeeded, so a pull request that is not merged is reported in a comment and a warning
+ * without failing the run.
+ */
+async function mergeAfterApply(
+  token: string,
+  config: Config,
+  settings: MergeAfterApplyConfig,
+  pr: PullRequestInfo,
+  appliedProjects: string[]
+): Promise<void> {
+  const { owner, repo } = github.context.repo;
+  const method = settings.method ?? 'merge';
+
+  let body: string;
+  try {
+    // Merging after a partial apply would leave the other projects unapplied on the base branch
+    const unapplied = config.projects
+      .filter(
+        (p) =>
+          p.enabled !== false &&
+          p.init_backend !== false &&
+          matchesBranchFilters(p, pr.headBranch, pr.baseBranch) &&
+          !appliedProjects.includes(p.name)
+      )
+      .map((p) => p.name);
+    if (unapplied.length > 0) {
+      throw new Error(`Projects not applied yet: ${unapplied.join(', ')}`);
+    }
+    validateRequirements(pr, ['approved', 'mergeable']);
+
+    // Passing the applied SHA makes GitHub refuse the merge if commits were pushed since
+    const mergeSha = await mergePullRequest(token, owner, repo, pr.number, method, pr.sha);
+    const branchNote = settings.delete_branch ? await deleteHeadBranch(token, pr) : undefined;
+    body = buildMergeComment(method, mergeSha, branchNote);
+  } catch (error) {
+    const reason = error instanceof Error ? error.message : String(error);
+    core.warning(`Pull request #${pr.number} was applied but not merged: ${reason}`);
+    body = buildMergeFailureComment(reason);
+  }
+
+  if (!shouldPostComments(config.output_mode)) {
+    return;
+  }
+  try {
+    await postComment(token, owner, repo, pr.number, body);
+  } catch (error) {
+    core.warning(
+      `Failed to post merge comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Deletes the head branch of a merged pull request (merge_after_apply.delete_branch)
+ *
+ * @param token - GitHub token
+ * @param pr - Pull request information
+ * @returns Note on the branch for the merge comment
+ */
+async function deleteHeadBranch(token: string, pr: PullRequestInfo): Promise<string> {
+  // The head branch of a fork lives in another repository
+  if (pr.isFork) {
+    return `The branch \`${pr.headBranch}\` is in a fork, so it was not deleted.`;
+  }
+
+  try {
+    await deleteBranch(token, pr.owner, pr.repo, pr.headBranch);
+    return `Deleted the branch \`${pr.headBranch}\`.`;
+  } catch (error) {
+    const message = error instanceof Error ? error.message : String(error);
+    core.warning(`Failed to delete branch ${pr.headBranch}: ${message}`);
+    return `Could not delete the branch \`${pr.headBranch}\`: ${message}`;
+  }
+}
+
+/**
+ * Checks projects for drift and reports each one on a tracking issue
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param projectNames - Projects to check
+ * @param overrides - Execution options from the comment
+ * @throws Error if the check failed for any project (after all projects were checked)
+ *
+ * @remarks
+ * Every project is checked even if an earlier one fails. The drifted project
+ * names are exposed as the `drifted-projects` output, and when triggered from
+ * a PR comment the summary is also posted on the PR. With notifications configured,
+ * each drifted project is also sent to the webhook.
+ */
+async function runDriftDetection(
+  token: string,
+  config: Config,
+  projectNames: string[],
+  overrides: TerraformExecutionOptions
+): Promise<void> {
+  const { owner, repo } = github.context.repo;
+  const runUrl = getRunUrl();
+  const results: DriftResult[] = [];
+
+  for (const projectName of projectNames) {
+    const project = config.projects.find((p) => p.name === projectName);
+    if (!project) {
+      throw new Error(`Project not found: ${projectName}`);
+    }
+
+    try {
+      const workingDir = resolveProjectDir(project.dir, process.cwd(), config.base_dir);
+      const result = await executeDriftCheck(workingDir, project.name, {
+        ...getProjectExecutionOptions(project),
+        ...overrides,
+      });
+      const drift: DriftResult = {
+        project: project.name,
+        drifted: result.hasChanges,
+        summary: result.hasChanges ? parseChangeSummary(result.stdout) : null,
+        changes: result.hasChanges ? parsePlanOutputChanges(result.stdout) : [],
+      };
+      results.push(drift);
+      await reportDriftIssue(token, owner, repo, drift, result.stdout, runUrl);
+      if (drift.drifted && config.notifications) {
+        await sendNotification(
+          config.notifications,
+          buildNotificationEvent(project, 'drift', 'drifted', { summary: drift.summary })
+        );
+      }
+    } catch (error) {
+      const message = error instanceof Error ? error.message : String(error);
+      core.error(`Drift check failed for project ${project.name}: ${message}`, {
+        title: `Drift check failed: ${project.name}`,
+      });
+      results.push({ project: project.name, drifted: false, summary: null, error: message });
+    }
+  }
+
+  const summary = buildDriftSummary(results);
+  core.info(summary);
+  core.setOutput(
+    'drifted-projects',
+    results
+      .filter((r) => r.drifted)
+      .map((r) => r.project)
+      .join(',')
+  );
+
+  const prNumber = github.context.issue.number;
+  if (prNumber && shouldPostComments(config.output_mode)) {
+    try {
+      await postComment(token, owner, repo, prNumber, summary);
+    } catch (error) {
+      core.warning(
+        `Failed to post drift summary: ${error instanceof Error ? error.message : String(error)}`
+      );
+    }
+  }
+
+  const failed = results.filter((r) => r.error).map((r) => r.project);
+  if (failed.length > 0) {
+    throw new Error(`Drift check failed for project(s): ${failed.join(', ')}`);
+  }
+}
+
+/**
+ * Drops projects whose branch filters do not match the pull request
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param projectNames - Target projects
+ * @returns Target projects allowed to run
+ *
+ * @remarks
+ * Runs without a pull request (e.g., scheduled drift detection) are not filtered.
+ * The PR is only fetched when a target project has a filter.
+ */
+async function filterProjectsByBranch(
+  token: string,
+  config: Config,
+  projectNames: string[]
+): Promise<string[]> {
+  const projects = config.projects.filter((p) => projectNames.includes(p.name));
+  if (!projects.some((p) => p.branch !== undefined || p.base_branch !== undefined)) {
+    return projectNames;
+  }
+
+  const branches = await resolveBranches(token);
+  if (!branches) {
+    return projectNames;
+  }
+
+  return projectNames.filter((name) => {
+    const project = projects.find((p) => p.name === name);
+    if (project && !matchesBranchFilters(project, branches.head, branches.base)) {
+      core.info(
+        `Skipping project ${name}: branch filters do not match ${branches.head} -> ${branches.base}`
+      );
+      return false;
+    }
+    return true;
+  });
+}
+
+/**
+ * Drops projects whose autoplan settings do not match the files the pull request changed
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param projectNames - Target projects
+ * @returns Target projects to plan
+ *
+ * @remarks
+ * Projects without autoplan settings are always planned. The changed files are only
+ * fetched when a target project has autoplan settings. Changes to the local modules a
+ * project uses count as changes to the project.
+ */
+async function filterProjectsByAutoplan(
+  token: string,
+  config: Config,
+  projectNames: string[]
+): Promise<string[]> {
+  const projects = config.projects.filter((p) => projectNames.includes(p.name));
+  if (!projects.some((p) => p.autoplan !== undefined)) {
+    return projectNames;
+  }
+
+  const changedFiles = await getChangedFiles(
+    token,
+    github.context.repo.owner,
+    github.context.repo.repo,
+    github.context.issue.number
+  );
+
+  const workspace = process.cwd();
+  return projectNames.filter((name) => {
+    const project = projects.find((p) => p.name === name);
+    if (!project) {
+      return true;
+    }
+    const absoluteDir = resolveProjectDir(project.dir, workspace, config.base_dir);
+    const projectDir = path.relative(workspace, absoluteDir).split(path.sep).join('/');
+    const moduleDirs = findLocalModuleDirs(absoluteDir, workspace);
+    if (!shouldAutoplan(project, projectDir, changedFiles, moduleDirs)) {
+      core.info(`Skipping project ${name}: autoplan does not match the changed files`);
+      return false;
+    }
+    return true;
+  });
+}
+
+/**
+ * Resolves the head and base branch of the pull request that triggered the run
+ *
+ * @param token - GitHub token
+ * @returns Branch names, or undefined when the run has no pull request
+ */
+async function resolveBranches(token: string): Promise<{ head: string; base: string } | undefined> {
+  const payloadPr = github.context.payload.pull_request;
+  if (typeof payloadPr?.head?.ref === 'string' && typeof payloadPr?.base?.ref === 'string') {
+    return { head: payloadPr.head.ref, base: payloadPr.base.ref };
+  }
+
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return undefined;
+  }
+
+  const { owner, repo } = github.context.repo;
+  // Branch names do not depend on mergeability, so don't wait for it
+  const pr = await getPullRequestInfo(token, owner, repo, prNumber, []);
+  return { head: pr.headBranch, base: pr.baseBranch };
+}
+
+/**
+ * Checks code owner approval when a target project's apply, state, import or destroy
+ * requirements need it
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param projectNames - Target projects
+ * @param pr - Pull request information
+ * @returns The PR information, with paths lacking code owner approval when checked
+ */
+async function checkCodeownerApproval(
+  token: string,
+  config: Config,
+  projectNames: string[],
+  pr: PullRequestInfo
+): Promise<PullRequestInfo> {
+  const requirements = config.projects
+    .filter((p) => projectNames.includes(p.name))
+    .flatMap((p) => [
+      ...(p.apply_requirements ?? getDefaultRequirements('apply')),
+      ...(p.state_requirements ?? []),
+      ...(p.import_requirements ?? []),
+      ...(p.destroy_requirements ?? []),
+    ]);
+  if (!usesKeyword(requirements, 'codeowner_approved')) {
+    return pr;
+  }
+
+  const missing = await findPathsWithoutCodeownerApproval(token, pr);
+  return { ...pr, pathsWithoutCodeownerApproval: missing };
+}
+
+/**
+ * Ensures a project's plan passed its policy check, or a policy owner approved it
+ *
+ * @param ctx - Run context
+ * @param project - Project configuration with policy_sets
+ * @throws Error if the policy check at the pull request's head commit did not pass
+ *
+ * @remarks
+ * An apply on merge checks the head commit of the merged pull request. Without a pull
+ * request (workflow_dispatch) there is no checked plan to look at, so the apply only warns.
+ */
+async function checkPolicyApproval(ctx: RunContext, project: ProjectConfig): Promise<void> {
+  if (!ctx.appliedSha) {
+    core.warning(`Policy check of project ${project.name} is not enforced without a pull request`);
+    return;
+  }
+
+  const { owner, repo } = github.context.repo;
+  const context = buildStatusContext(POLICY_CHECK_STATUS_COMMAND, project.name, ctx.config);
+  const status = await getCommitStatus(ctx.token, owner, repo, ctx.appliedSha, context);
+  if (status?.state === 'success') {
+    return;
+  }
+
+  if (status?.state === 'failure') {
+    const syntax = getCommentSyntax(ctx.config);
+    throw new Error(
+      `Policy check failed for project ${project.name}; a policy owner must comment ` +
+        `'${syntax.prefixes[0]} approve_policies' before apply`
+    );
+  }
+  throw new Error(
+    `Policy check has not passed for project ${project.name} at the head commit; run terraform plan first`
+  );
+}
+
+/**
+ * Blocks apply when the security scan of the planned commit found blocking issues
+ *
+ * @param ctx - Run context
+ * @param project - Project configuration with security_scan.block_on
+ * @throws Error if the scan at the pull request's head commit did not pass
+ *
+ * @remarks
+ * An apply on merge checks the head commit of the merged pull request. Without a pull
+ * request (workflow_dispatch) there is no scanned plan to look at, so the apply only warns.
+ */
+async function checkSecurityScan(ctx: RunContext, project: ProjectConfig): Promise<void> {
+  if (!ctx.appliedSha) {
+    core.warning(`Security scan of project ${project.name} is not enforced without a pull request`);
+    return;
+  }
+
+  const { owner, repo } = github.context.repo;
+  const context = buildStatusContext(SECURITY_SCAN_STATUS_COMMAND, project.name, ctx.config);
+  const status = await getCommitStatus(ctx.token, owner, repo, ctx.appliedSha, context);
+  if (status?.state === 'success') {
+    return;
+  }
+
+  if (status?.state === 'failure') {
+    throw new Error(
+      `Security scan of project ${project.name} found issues at or above ` +
+        `${project.security_scan?.block_on}; fix them and plan again before apply`
+    );
+  }
+  throw new Error(
+    `Security scan has not passed for project ${project.name} at the head commit; run terraform plan first`
+  );
+}
+
+/**
+ * Adds the resources a project's saved plan would destroy, for the no_destroys requirement
+ *
+ * @param project - Project configuration
+ * @param pr - Pull request information
+ * @param workingDir - Resolved project directory
+ * @param planFilePath - Downloaded saved plan, if any
+ * @param executionOptions - Execution options for the project
+ * @returns Pull request information with plannedDestroys set when the plan could be read
+ *
+ * @remarks
+ * Without a readable plan, plannedDestroys stays undefined and the requirement is not met.
+ */
+async function checkPlannedDestroys(
+  project: ProjectConfig,
+  pr: PullRequestInfo,
+  workingDir: string,
+  planFilePath: string | undefined,
+  executionOptions: TerraformExecutionOptions
+): Promise<PullRequestInfo> {
+  if (!planFilePath) {
+    return pr;
+  }
+
+  try {
+    const planJson = await executeTerraformShowJson(workingDir, planFilePath, executionOptions);
+    return { ...pr, plannedDestroys: parsePlannedDestroys(planJson) };
+  } catch (error) {
+    core.warning(
+      `Could not read the saved plan of project ${project.name}: ${error instanceof Error ? error.message : String(error)}`
+    );
+    return pr;
+  }
+}
+
+/**
+ * Reads the resource changes of a new plan (compare_plans, plan_summary, check runs)
+ *
+ * @param project - Project configuration
+ * @param workingDir - Resolved project directory
+ * @param planFilePath - Path to the saved plan
+ * @param executionOptions - Execution options for the project
+ * @returns Planned changes, or undefined if the plan could not be read
+ */
+async function readPlannedChanges(
+  project: ProjectConfig,
+  workingDir: string,
+  planFilePath: string,
+  executionOptions: TerraformExecutionOptions
+): Promise<PlannedChange[] | undefined> {
+  try {
+    const planJson = await executeTerraformShowJson(workingDir, planFilePath, executionOptions);
+    return parsePlannedChanges(planJson);
+  } catch (error) {
+    core.warning(
+      `Could not read the plan of project ${project.name}: ${error instanceof Error ? error.message : String(error)}`
+    );
+    return undefined;
+  }
+}
+
+/**
+ * Estimates the cost of a new plan (infracost)
+ *
+ * @param project - Project configuration
+ * @param workingDir - Resolved project directory
+ * @param planJsonPath - Path to the plan JSON
+ * @param infracost - Infracost settings
+ * @returns Cost estimate, or undefined if it failed without a limit to enforce
+ * @throws Error if the estimate failed and max_monthly_increase is set
+ */
+async function readCostEstimate(
+  project: ProjectConfig,
+  workingDir: string,
+  planJsonPath: string,
+  infracost: InfracostConfig
+): Promise<CostEstimate | undefined> {
+  try {
+    return await estimatePlanCost(project.name, workingDir, planJsonPath);
+  } catch (error) {
+    if (infracost.max_monthly_increase !== undefined) {
+      throw error;
+    }
+    core.warning(
+      `Could not estimate the cost of project ${project.name}: ${error instanceof Error ? error.message : String(error)}`
+    );
+    return undefined;
+  }
+}
+
+/**
+ * Force-unlocks the state lock a failed plan or apply left behind (auto_unlock_on_failure)
+ *
+ * @param project - Project configuration
+ * @param workingDir - Resolved project directory
+ * @param output - Error output of the failed command
+ * @param executionOptions - Execution options for the project
+ *
+ * @remarks
+ * Only a lock held by this runner is released; a lock held by another run is
+ * left alone. Never throws, so the original failure is what gets reported.
+ */
+async function releaseDanglingLock(
+  project: ProjectConfig,
+  workingDir: string,
+  output: string,
+  executionOptions: TerraformExecutionOptions
+): Promise<void> {
+  const lock = parseStateLock(output);
+  if (!lock) {
+    return;
+  }
+
+  if (!isLockHeldByThisRunner(lock)) {
+    core.warning(
+      `State of project ${project.name} is locked by ${lock.who ?? 'another run'} (lock ID ${lock.id}); not force-unlocking a lock this run does not hold`
+    );
+    return;
+  }
+
+  core.warning(
+    `auto_unlock_on_failure: force-unlocking state lock ${lock.id} of project ${project.name}${lock.operation ? ` (${lock.operation})` : ''}`
+  );
+  try {
+    await executeTerraformForceUnlock(workingDir, lock.id, executionOptions);
+    core.warning(`Released state lock ${lock.id} of project ${project.name}`);
+  } catch (error) {
+    core.error(
+      `Could not force-unlock state lock ${lock.id} of project ${project.name}; run \`terraform force-unlock ${lock.id}\` manually: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Resolves the PR head commit SHA for commit statuses
+ *
+ * @param token - GitHub token
+ * @param pr - Pull request information, if already fetched
+ * @returns Head SHA, or undefined when the run has no pull request
+ */
+async function resolveHeadSha(
+  token: string,
+  pr: PullRequestInfo | null
+): Promise<string | undefined> {
+  if (pr) {
+    return pr.sha;
+  }
+
+  const payloadSha = github.context.payload.pull_request?.head?.sha;
+  if (typeof payloadSha === 'string') {
+    return payloadSha;
+  }
+
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return undefined;
+  }
+
+  const { owner, repo } = github.context.repo;
+  // Only the SHA is needed, so don't wait for mergeability
+  return (await getPullRequestInfo(token, owner, repo, prNumber, [])).sha;
+}
+
+/**
+ * Builds the plan artifact scope of a merged pull request, whose plans were saved for its
+ * head commit
+ */
+function getMergedPlanScope(token: string, merged: MergedPullRequest): PlanArtifactScope {
+  const { owner, repo } = github.context.repo;
+  return { token, owner, repo, prNumber: merged.number, sha: merged.headSha };
+}
+
+/**
+ * Drops projects a merge does not apply
+ *
+ * @param token - GitHub token
+ * @param config - Loaded configuration
+ * @param projectNames - Target projects
+ * @param merged - Merged pull request
+ * @returns Projects with apply_on_merge that have a plan saved for the pull request
+ *
+ * @remarks
+ * Without a saved plan, apply would apply whatever the merged code plans to, so a project
+ * the pull request never planned is left alone.
+ */
+async function filterProjectsForMerge(
+  token: string,
+  config: Config,
+  projectNames: string[],
+  merged: MergedPullRequest
+): Promise<string[]> {
+  const scope = getMergedPlanScope(token, merged);
+  const applied: string[] = [];
+  for (const name of projectNames) {
+    if (!config.projects.find((p) => p.name === name)?.apply_on_merge) {
+      continue;
+    }
+    if (!(await hasSavedPlan(name, scope))) {
+      core.info(`Skipping project ${name}: no plan saved for pull request #${merged.number}`);
+      continue;
+    }
+    applied.push(name);
+  }
+  return applied;
+}
+
+/**
+ * Resolves the pull request commit that saved plans are stored and looked up for
+ *
+ * @param token - GitHub token
+ * @param pr - Pull request information, if already fetched
+ * @returns Plan artifact scope, or undefined when the run has no pull request
+ */
+async function resolvePlanScope(
+  token: string,
+  pr: PullRequestInfo | null
+): Promise<PlanArtifactScope | undefined> {
+  const prNumber = pr?.number ?? github.context.issue.number;
+  if (!prNumber) {
+    return undefined;
+  }
+
+  const sha = await resolveHeadSha(token, pr);
+  if (!sha) {
+    return undefined;
+  }
+
+  const { owner, repo } = github.context.repo;
+  return { token, owner, repo, prNumber, sha };
+}
+
+/**
+ * Runs the command for one project and reports the outcome
+ *
+ * @param ctx - Run context
+ * @param project - Project configuration
+ * @returns Terraform execution result
+ * @throws The execution error after it has been reported
+ *
+ * @remarks
+ * The output mode decides whether failures are commented on the PR and
+ * whether pending/success/failure commit statuses are set. With status_api
+ * set to checks, the statuses are a check run showing the result in its details.
+ */
+async function runProject(ctx: RunContext, project: ProjectConfig): Promise<TerraformResult> {
+  const { token, config, command } = ctx;
+  const { owner, repo } = github.context.repo;
+  const outputMode = config.output_mode ?? 'both';
+  // Consolidated results are posted once every project has run
+  const commentPerProject = shouldPostComments(outputMode) && !ctx.consolidate;
+
+  // The pending state starts the check run that the final state completes
+  let checkRunId: number | undefined;
+  const setStatus = async (
+    state: CommitStatusState,
+    description: string,
+    summary?: () => string
+  ): Promise<void> => {
+    if (!ctx.headSha) {
+      return;
+    }
+    if (config.status_api === 'checks') {
+      checkRunId = await reportCheckRun(
+        token,
+        owner,
+        repo,
+        ctx.headSha,
+        command,
+        project.name,
+        state,
+        description,
+        { summary: summary?.(), rerun: checkRunCommand(ctx, project), checkRunId },
+        config
+      );
+    } else {
+      await reportCommitStatus(
+        token,
+        owner,
+        repo,
+        ctx.headSha,
+        command,
+        project.name,
+        state,
+        description,
+        config
+      );
+    }
+  };
+
+  await setStatus('pending', `terraform ${command} is running`);
+
+  try {
+    const result = await withProjectLock(ctx, project, () => dispatchCommand(ctx, project));
+
+    // tfcmt only handles plan and apply, so other results are posted here
+    if (command !== 'plan' && command !== 'apply' && commentPerProject) {
+      await reportCommandSuccess(token, project, commandLabel(ctx), result, echoedCommand(ctx));
+    }
+    if (result.importPlan && ctx.importTarget && commentPerProject) {
+      await reportImportPlan(token, project, ctx.importTarget.address, result.importPlan);
+    }
+    if (result.reusedPlan && ctx.planScope && commentPerProject) {
+      await reportReusedPlan(token, project, ctx.planScope.sha, result);
+    }
+
+    // tfcmt wrote its comment to a file, so post it unless there were no changes
+    const noChanges = config.comment_on_no_changes ?? 'full';
+    const previous = getPreviousPlanComments(config, command);
+    const marked = marksPlanComments(config, command);
+    if (
+      result.commentFilePath &&
+      (noChanges !== 'full' ||
+        previous !== 'keep' ||
+        marked ||
+        masksPlanComments(command) ||
+        isCheckRunRerequest(github.context)) &&
+      commentPerProject
+    ) {
+      await reportTfcmtResult(token, project, command, result, noChanges, previous, marked);
+    } else if (command === 'apply' && commentPerProject) {
+      // tfcmt already posted the apply, so the outputs get their own comment
+      await reportOutputs(token, project, result);
+    }
+
+    const summary = parseChangeSummary(result.stdout);
+    if (ctx.destroy && commentPerProject) {
+      await reportDestroyPreview(token, project, summary);
+    }
+    if (result.plannedChanges && config.compare_plans && commentPerProject) {
+      await reportPlanChanges(token, project, result.plannedChanges);
+    }
+    if (result.plannedChanges && config.plan_summary && commentPerProject) {
+      await reportPlanSummary(token, project, result.plannedChanges, result.stdout);
+    }
+    // Violations do not fail the plan; they block its apply until approved
+    if (result.policyCheck) {
+      await reportPolicyCheck(ctx, project, result.policyCheck);
+    }
+    if (result.securityScan) {
+      await reportSecurityScan(ctx, project, result.securityScan);
+    }
+    if (result.costEstimate && config.infracost) {
+      if (commentPerProject) {
+        await reportCostEstimate(token, project, result.costEstimate, config.infracost);
+      }
+      if (exceedsCostLimit(result.costEstimate, config.infracost)) {
+        const { currency, diffMonthlyCost } = result.costEstimate;
+        throw new Error(
+          `Plan of project ${project.name} raises the monthly cost by ` +
+            `${formatCost(diffMonthlyCost, currency)}, above the limit of ` +
+            `${formatCost(config.infracost.max_monthly_increase ?? 0, currency)}`
+        );
+      }
+    }
+
+    const counts =
+      summary && (ctx.destroy ? formatDestroyPreview(summary) : formatChangeSummary(summary));
+    await setStatus(
+      'success',
+      counts
+        ? `terraform ${commandLabel(ctx)} succeeded: ${counts}`
+        : `terraform ${commandLabel(ctx)} succeeded`,
+      () => buildCheckRunSummary(ctx, project, result)
+    );
+
+    if (command === 'apply' && config.notifications) {
+      await sendNotification(
+        config.notifications,
+        buildNotificationEvent(project, command, 'success', { summary })
+      );
+    }
+
+    return result;
+  } catch (error) {
+    const message = error instanceof Error ? error.message : String(error);
+
+    // Whatever the command was doing when it was stopped, it did not fail on its own
+    if (isRunCancelled()) {
+      await setStatus('error', `terraform ${commandLabel(ctx)} was cancelled`, () =>
+        buildCancelledComment(project.name, commandLabel(ctx), getRunUrl())
+      );
+      if (commentPerProject) {
+        await reportCancellation(token, project, commandLabel(ctx));
+      }
+    } else {
+      await setStatus('failure', message, () =>
+        buildProjectFailureComment(token, project, command, error, echoedCommand(ctx))
+      );
+      if (shouldPostComments(outputMode)) {
+        if (commentPerProject) {
+          await reportProjectFailure(token, project, command, error, echoedCommand(ctx));
+        }
+        if (error instanceof TerraformCommandError && error.subcommand === 'plan') {
+          await reportDiagnostics(token, project, config.base_dir);
+        }
+      }
+    }
+
+    if (command === 'apply' && config.notifications) {
+      await sendNotification(
+        config.notifications,
+        buildNotificationEvent(project, command, 'failure', { error: message })
+      );
+    }
+    throw error;
+  }
+}
+
+/**
+ * Runs a project command while holding the lock of its concurrency group (concurrency)
+ *
+ * @param ctx - Run context
+ * @param project - Project configuration
+ * @param execute - Runs the command
+ * @returns What the command returned
+ * @throws Error if the lock is still held by another workflow run after concurrency.timeout
+ *
+ * @remarks
+ * Without the concurrency setting, or for commands it does not list, the command runs
+ * right away, as do state commands that only read the state (list, show). The lock is
+ * only held while terraform runs, not while results are reported.
+ */
+async function withProjectLock<T>(
+  ctx: RunContext,
+  project: ProjectConfig,
+  execute: () => Promise<T>
+): Promise<T> {
+  const concurrency = ctx.config.concurrency;
+  const commands = concurrency?.commands ?? DEFAULT_LOCKED_COMMANDS;
+  if (!concurrency || !commands.includes(ctx.command as LockedCommand)) {
+    return execute();
+  }
+  if (ctx.stateSubcommand && !isStateMutation(ctx.stateSubcommand)) {
+    return execute();
+  }
+
+  const { owner, repo } = github.context.repo;
+  const lock = await acquireProjectLock(
+    ctx.token,
+    owner,
+    repo,
+    project.concurrency_group ?? project.name,
+    {
+      runId: github.context.runId,
+      runAttempt: github.context.runAttempt,
+      project: project.name,
+      command: commandLabel(ctx),
+      prNumber: github.context.issue.number || undefined,
+      lockedAt: new Date().toISOString(),
+    },
+    parseDuration(concurrency.timeout ?? DEFAULT_LOCK_TIMEOUT)
+  );
+  try {
+    return await execute();
+  } finally {
+    await releaseProjectLock(ctx.token, owner, repo, lock);
+  }
+}
+
+/**
+ * Builds a notification event for a project command in the current repository
+ *
+ * @param project - Project configuration
+ * @param command - Terraform command that was executed
+ * @param status - Outcome of the command
+ * @param details - Change summary or error message
+ * @returns Notification event
+ */
+function buildNotificationEvent(
+  project: ProjectConfig,
+  command: TerraformCommand | 'drift',
+  status: NotificationEvent['status'],
+  details: Pick<NotificationEvent, 'summary' | 'error'>
+): NotificationEvent {
+  const { owner, repo } = github.context.repo;
+  const prNumber = github.context.issue.number;
+
+  return {
+    repository: `${owner}/${repo}`,
+    project: project.name,
+    command,
+    status,
+    prUrl: prNumber ? `${github.context.serverUrl}/${owner}/${repo}/pull/${prNumber}` : undefined,
+    ...details,
+  };
+}
+
+/**
+ * Executes the requested command for a single project
+ *
+ * @param ctx - Run context
+ * @param project - Project configuration
+ * @returns Terraform execution result
+ */
+async function dispatchCommand(ctx: RunContext, project: ProjectConfig): Promise<TerraformResult> {
+  switch (ctx.command) {
+    case 'init':
+      return executeProjectInit(project, ctx.config.base_dir, ctx.args, ctx.overrides);
+    case 'state':
+      if (!ctx.stateSubcommand) {
+        throw new Error('terraform state requires a subcommand');
+      }
+      return executeProjectState(
+        project,
+        ctx.config.base_dir,
+        ctx.stateSubcommand,
+        ctx.args,
+        ctx.pr,
+        ctx.overrides
+      );
+    case 'show':
+      return executeProjectShow(
+        project,
+        ctx.config.base_dir,
+        ctx.args,
+        ctx.overrides,
+        ctx.planScope
+      );
+    case 'destroy':
+      return executeProjectDestroy(
+        project,
+        ctx.config.base_dir,
+        ctx.args,
+        ctx.pr,
+        ctx.overrides
+      );
+    case 'import':
+      if (!ctx.importTarget) {
+        throw new Error('terraform import requires a resource address and ID');
+      }
+      return executeProjectImport(
+        project,
+        ctx.config.base_dir,
+        ctx.importTarget,
+        ctx.args,
+        ctx.pr,
+        ctx.overrides
+      );
+    default:
+      if (ctx.command === 'apply' && project.policy_sets) {
+        await checkPolicyApproval(ctx, project);
+      }
+      if (ctx.command === 'apply' && project.security_scan?.block_on) {
+        await checkSecurityScan(ctx, project);
+      }
+      if (ctx.reusePlans && ctx.planScope && !project.terragrunt_run_all) {
+        const { base_dir: baseDir } = ctx.config;
+        const reused = await reuseSavedPlan(project, baseDir, ctx.overrides, ctx.planScope);
+        if (reused) {
+          return reused;
+        }
+      }
+      return executeProjectCommand(
+        project,
+        ctx.config.base_dir,
+        ctx.command,
+        ctx.args,
+        ctx.pr,
+        ctx.tfcmtPath,
+        ctx.overrides,
+        ctx.destroy,
+        ctx.config.compare_plans === true ||
+          ctx.config.plan_summary === true ||
+          (ctx.headSha !== undefined && ctx.config.status_api === 'checks'),
+        ctx.planScope,
+        getWorkflowSteps(project, ctx.config.workflows ?? {}, ctx.command),
+        getProjectPolicySets(project, ctx.config.policies),
+        ctx.config.infracost
+      );
+  }
+}
+
+/**
+ * Posts a PR comment with the saved plan shown instead of planning again
+ *
+ * @param token - GitHub token (also redacted from the comment)
+ * @param project - Project configuration
+ * @param sha - Head commit the plan was saved for
+ * @param result - Result of terraform show for the saved plan
+ */
+async function reportReusedPlan(
+  token: string,
+  project: ProjectConfig,
+  sha: string,
+  result: TerraformResult
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
+  try {
+    await postComment(
+      token,
+      github.context.repo.owner,
+      github.context.repo.repo,
+      prNumber,
+      buildReusedPlanComment(project.name, sha, result.stdout, [token])
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to post reused plan comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Posts a PR comment with the output of a successful command that tfcmt does not report
+ *
+ * @param token - GitHub token (also redacted from the comment)
+ * @param project - Project configuration
+ * @param label - Command label (e.g., init, state list)
+ * @param result - Command result
+ * @param commandLine - Full command echoed above the output, if any
+ */
+async function reportCommandSuccess(
+  token: string,
+  project: ProjectConfig,
+  label: string,
+  result: TerraformResult,
+  commandLine?: string
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
+  try {
+    await postComment(
+      token,
+      github.context.repo.owner,
+      github.context.repo.repo,
+      prNumber,
+      buildSuccessComment(project.name, label, result.stdout, [token], commandLine)
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to post ${label} comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Posts the plan of the resource an import brought under management
+ *
+ * @param token - GitHub token
+ * @param project - Project configuration
+ * @param address - Address of the imported resource
+ * @param plan - Result of the targeted plan
+ *
+ * @remarks
+ * Errors while posting are only logged.
+ */
+async function reportImportPlan(
+  token: string,
+  project: ProjectConfig,
+  address: string,
+  plan: TerraformResult
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
+  try {
+    await postComment(
+      token,
+      github.context.repo.owner,
+      github.context.repo.repo,
+      prNumber,
+      buildImportPlanComment(project.name, address, plan.hasChanges, plan.stdout, [token])
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to post the plan of ${address}: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Posts the comment tfcmt wrote to a file, or the no-changes comment for a no-op
+ *
+ * @param token - GitHub token
+ * @param project - Project configuration
+ * @param command - Command that was executed (plan or apply)
+ * @param result - Command result with the tfcmt comment file
+ * @param noChanges - How a result without changes is commented
+ * @param previous - What happens to the project's earlier comments of the command
+ * @param marked - Whether a kept comment carries the project's marker
+ *
+ * @remarks
+ * A result is a no-op when terraform reports 0 to add, change and destroy.
+ * Unless earlier comments are kept, a skipped comment still hides them, as
+ * they no longer match the code. Errors while posting are only logged.
+ */
+async function reportTfcmtResult(
+  token: string,
+  project: ProjectConfig,
+  command: string,
+  result: TerraformResult,
+  noChanges: NoChangesComment,
+  previous: PreviousPlanComments = 'keep',
+  marked = false
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber || !result.commentFilePath) {
+    return;
+  }
+
+  const { owner, repo } = github.context.repo;
+  const marker = buildPlanCommentMarker(project.name);
+  const hideEarlierComments = async (): Promise<void> => {
+    try {
+      await minimizeComments(token, owner, repo, prNumber, marker);
+    } catch (error) {
+      core.warning(
+        `Failed to hide outdated ${command} comments: ${error instanceof Error ? error.message : String(error)}`
+      );
+    }
+  };
+
+  try {
+    const body = buildTfcmtResultComment(project, command, result, noChanges, [token]);
+    if (body === undefined) {
+      core.info(`No changes for project ${project.name}, skipping the ${command} comment`);
+      if (previous !== 'keep') {
+        await hideEarlierComments();
+      }
+      return;
+    }
+
+    if (previous === 'update') {
+      await upsertComment(token, owner, repo, prNumber, marker, `${marker}\n${body}`);
+    } else if (previous === 'hide') {
+      await hideEarlierComments();
+      await postComment(token, owner, repo, prNumber, `${marker}\n${body}`);
+    } else {
+      await postComment(token, owner, repo, prNumber, marked ? `${marker}\n${body}` : body);
+    }
+  } catch (error) {
+    core.warning(
+      `Failed to post ${command} comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Whether the plan comments tfcmt writes are posted by the action, masked with the
+ * sensitive values of the plan
+ *
+ * @remarks
+ * tfcmt posts a plan before the action can read its sensitive values, whereas an
+ * apply reads them from the saved plan first, so tfcmt can mask its comment.
+ */
+function masksPlanComments(command: string): boolean {
+  return command === 'plan' && masksSensitiveValues();
+}
+
+/**
+ * Whether plan comments carry the project's marker, so that a later push can mark them
+ * outdated
+ */
+function marksPlanComments(config: Config, command: string): boolean {
+  return command === 'plan' && config.invalidate_outdated_plans === true;
+}
+
+/**
+ * Marks the plan comments of a pull request outdated after a push, and deletes the plans
+ * saved for the commit the push replaced
+ *
+ * @param token - GitHub token for API access
+ * @param config - Action configuration
+ *
+ * @remarks
+ * Plans of earlier commits were deleted by the pushes that replaced them. Errors are
+ * only logged, so the new commit is still planned.
+ */
+async function invalidateOutdatedPlans(token: string, config: Config): Promise<void> {
+  const { owner, repo } = github.context.repo;
+  const prNumber = github.context.issue.number;
+  const { before, after } = github.context.payload as { before?: string; after?: string };
+
+  if (after) {
+    try {
+      await markPlanCommentsOutdated(token, owner, repo, prNumber, after);
+    } catch (error) {
+      core.warning(
+        `Failed to mark outdated plan comments: ${error instanceof Error ? error.message : String(error)}`
+      );
+    }
+  }
+
+  if (before) {
+    const scope: PlanArtifactScope = { token, owner, repo, prNumber, sha: before };
+    for (const project of config.projects) {
+      try {
+        await deleteSavedPlans(project.name, scope);
+      } catch (error) {
+        core.warning(
+          `Failed to delete the outdated plans of project ${project.name} (needs actions: write): ${error instanceof Error ? error.message : String(error)}`
+        );
+      }
+    }
+  }
+}
+
+/**
+ * What happens to earlier comments of a command (only plan comments are replaced)
+ */
+function getPreviousPlanComments(config: Config, command: string): PreviousPlanComments {
+  return command === 'plan' ? (config.previous_plan_comments ?? 'keep') : 'keep';
+}
+
+/**
+ * Posts a PR comment highlighting how many resources a destroy preview would remove
+ *
+ * @param token - GitHub token
+ * @param project - Project configuration
+ * @param summary - Change counts of the destroy plan, if recognizable
+ *
+ * @remarks
+ * tfcmt posts the plan itself; this comment only adds the destroy count up
+ * front. Errors while posting are only logged.
+ */
+async function reportDestroyPreview(
+  token: string,
+  project: ProjectConfig,
+  summary: ChangeSummary | null
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
+  try {
+    await postComment(
+      token,
+      github.context.repo.owner,
+      github.context.repo.repo,
+      prNumber,
+      buildDestroyPreviewComment(project.name, summary)
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to post destroy preview comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Updates the PR comment comparing a project's plan with its previous plan (compare_plans)
+ *
+ * @param token - GitHub token
+ * @param project - Project configuration
+ * @param current - Resource changes of the new plan
+ *
+ * @remarks
+ * The previous plan is read from the snapshot in the comment this replaces, so the
+ * comparison works across workflow runs. Errors are only logged.
+ */
+async function reportPlanChanges(
+  token: string,
+  project: ProjectConfig,
+  current: PlannedChange[]
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
+  const { owner, repo } = github.context.repo;
+  const marker = buildPlanChangesMarker(project.name);
+  try {
+    const existing = await findCommentByMarker(token, owner, repo, prNumber, marker);
+    const previous = existing && parsePlanSnapshot(existing.body);
+    const diff = previous && diffPlannedChanges(previous, current);
+    await upsertComment(
+      token,
+      owner,
+      repo,
+      prNumber,
+      marker,
+      buildPlanChangesComment(project.name, current, diff)
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to post plan changes comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Updates the PR comment summarizing a project's plan (plan_summary)
+ *
+ * @param token - GitHub token (also redacted from the comment)
+ * @param project - Project configuration
+ * @param changes - Resource changes of the plan
+ * @param output - Plain text plan output
+ *
+ * @remarks
+ * The comment is updated in place on every plan. Errors while posting are only logged.
+ */
+async function reportPlanSummary(
+  token: string,
+  project: ProjectConfig,
+  changes: PlannedChange[],
+  output: string
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
+  const { owner, repo } = github.context.repo;
+  try {
+    await upsertComment(
+      token,
+      owner,
+      repo,
+      prNumber,
+      buildPlanSummaryMarker(project.name),
+      buildPlanSummaryComment(project.name, changes, output, [token])
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to post plan summary comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Records a project's policy check as a commit status and reports it on the PR
+ *
+ * @param ctx - Run context
+ * @param project - Project configuration
+ * @param result - Policy check result
+ *
+ * @remarks
+ * The commit status is what apply checks, so it is set whatever the output mode.
+ * Errors while posting the comment are only logged.
+ */
+async function reportPolicyCheck(
+  ctx: RunContext,
+  project: ProjectConfig,
+  result: PolicyCheckResult
+): Promise<void> {
+  const { token, config } = ctx;
+  const { owner, repo } = github.context.repo;
+
+  if (ctx.policySha) {
+    await reportCommitStatus(
+      token,
+      owner,
+      repo,
+      ctx.policySha,
+      POLICY_CHECK_STATUS_COMMAND,
+      project.name,
+      result.passed ? 'success' : 'failure',
+      result.passed ? 'Policy check passed' : 'Policy check failed; approval required',
+      config
+    );
+  } else {
+    core.warning(
+      `Policy check of project ${project.name} is not recorded without a pull request; apply will not see it`
+    );
+  }
+
+  const prNumber = github.context.issue.number;
+  if (!prNumber || !shouldPostComments(config.output_mode)) {
+    return;
+  }
+
+  const syntax = getCommentSyntax(config);
+  const approveCommand =
+    `${syntax.prefixes[0]} approve_policies ${syntax.projectFlags[0]}=${project.name}`;
+  try {
+    await upsertComment(
+      token,
+      owner,
+      repo,
+      prNumber,
+      buildPolicyCheckMarker(project.name),
+      buildPolicyCheckComment(
+        project.name,
+        result,
+        config.policies?.owners ?? [],
+        approveCommand,
+        [token]
+      )
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to post policy check comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Records a project's security scan and posts its findings
+ *
+ * @param ctx - Run context
+ * @param project - Project configuration
+ * @param result - Security scan result
+ *
+ * @remarks
+ * With block_on, the commit status is what apply checks, so it is set whatever the
+ * output mode. Errors while posting the comment are only logged.
+ */
+async function reportSecurityScan(
+  ctx: RunContext,
+  project: ProjectConfig,
+  result: SecurityScanResult
+): Promise<void> {
+  const { token, config } = ctx;
+  const { owner, repo } = github.context.repo;
+
+  if (result.blockOn && ctx.policySha) {
+    await reportCommitStatus(
+      token,
+      owner,
+      repo,
+      ctx.policySha,
+      SECURITY_SCAN_STATUS_COMMAND,
+      project.name,
+      result.blocking > 0 ? 'failure' : 'success',
+      result.blocking > 0
+        ? `${result.blocking} finding(s) at or above ${result.blockOn}`
+        : `No findings at or above ${result.blockOn}`,
+      config
+    );
+  } else if (result.blockOn) {
+    core.warning(
+      `Security scan of project ${project.name} is not recorded without a pull request; apply will not see it`
+    );
+  }
+
+  const prNumber = github.context.issue.number;
+  if (!prNumber || !shouldPostComments(config.output_mode)) {
+    return;
+  }
+
+  try {
+    await upsertComment(
+      token,
+      owner,
+      repo,
+      prNumber,
+      buildSecurityScanMarker(project.name),
+      buildSecurityScanComment(project.name, result)
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to post security scan comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Updates the PR comment with a project's cost estimate (infracost)
+ *
+ * @param token - GitHub token
+ * @param project - Project configuration
+ * @param estimate - Cost estimate of the plan
+ * @param infracost - Infracost settings
+ *
+ * @remarks
+ * The comment is updated in place on every plan. Errors while posting are only logged.
+ */
+async function reportCostEstimate(
+  token: string,
+  project: ProjectConfig,
+  estimate: CostEstimate,
+  infracost: InfracostConfig
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
+  const { owner, repo } = github.context.repo;
+  try {
+    await upsertComment(
+      token,
+      owner,
+      repo,
+      prNumber,
+      buildCostEstimateMarker(project.name),
+      buildCostEstimateComment(project.name, estimate, infracost.max_monthly_increase)
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to post cost estimate comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Posts a PR comment listing a project's outputs after apply
+ *
+ * @param token - GitHub token (also redacted from the comment)
+ * @param project - Project configuration
+ * @param result - Apply result with the outputs
+ *
+ * @remarks
+ * Nothing is posted when the project has no outputs. Errors while posting are only logged.
+ */
+async function reportOutputs(
+  token: string,
+  project: ProjectConfig,
+  result: TerraformResult
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  const body = result.outputs && buildOutputsComment(project.name, result.outputs, [token]);
+  if (!prNumber || !body) {
+    return;
+  }
+
+  try {
+    await postComment(token, github.context.repo.owner, github.context.repo.repo, prNumber, body);
+  } catch (error) {
+    core.warning(
+      `Failed to post outputs comment: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Builds the comment for a plan or apply from the file tfcmt wrote
+ *
+ * @param project - Project configuration
+ * @param command - Command that was executed (plan or apply)
+ * @param result - Command result with the tfcmt comment file
+ * @param noChanges - How a result without changes is commented
+ * @param secrets - Values that must never appear in the comment
+ * @returns Markdown comment body, or undefined when the comment is skipped
+ * @throws Error if the tfcmt comment file cannot be read
+ *
+ * @remarks
+ * A result is a no-op when terraform reports 0 to add, change and destroy.
+ * Outputs collected after an apply are appended as a table.
+ */
+function buildTfcmtResultComment(
+  project: ProjectConfig,
+  command: string,
+  result: TerraformResult,
+  noChanges: NoChangesComment,
+  secrets: string[]
+): string | undefined {
+  const noOp = isNoOp(parseChangeSummary(result.stdout));
+  if (noOp && noChanges === 'skip') {
+    return undefined;
+  }
+
+  let body: string | undefined;
+  if (noOp && noChanges === 'concise') {
+    body = buildNoChangesComment(project.name, command);
+  } else if (result.commentFilePath) {
+    body = fs.readFileSync(result.commentFilePath, 'utf8');
+  }
+
+  const outputs = result.outputs ? buildOutputsTable(result.outputs, secrets) : '';
+  return body && outputs ? `${body}\n\n### 📤 Outputs\n\n${outputs}` : body;
+}
+
+/**
+ * Builds a project's section of the consolidated comment after a successful command
+ *
+ * @param ctx - Run context
+ * @param project - Project configuration
+ * @param result - Command result
+ * @returns Markdown details, or undefined when there is nothing to show
+ */
+function buildProjectDetails(
+  ctx: RunContext,
+  project: ProjectConfig,
+  result: TerraformResult
+): string | undefined {
+  if (result.reusedPlan && ctx.planScope) {
+    return buildReusedPlanComment(project.name, ctx.planScope.sha, result.stdout, [ctx.token]);
+  }
+  if (ctx.command !== 'plan' && ctx.command !== 'apply') {
+    return buildSuccessComment(
+      project.name,
+      commandLabel(ctx),
+      result.stdout,
+      [ctx.token],
+      echoedCommand(ctx)
+    );
+  }
+
+  try {
+    return buildTfcmtResultComment(
+      project,
+      ctx.command,
+      result,
+      ctx.config.comment_on_no_changes ?? 'full',
+      [ctx.token]
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to read ${ctx.command} output for project ${project.name}: ${error instanceof Error ? error.message : String(error)}`
+    );
+    return undefined;
+  }
+}
+
+/**
+ * Posts a PR comment describing why a project command failed
+ *
+ * @param token - GitHub token (also redacted from the comment)
+ * @param project - Project configuration
+ * @param command - Command that was requested
+ * @param error - Error raised while executing the project
+ * @param commandLine - Full command echoed above the output, if any
+ *
+ * @remarks
+ * Skipped when tfcmt already posted the failure. Errors while posting are only
+ * logged so that the original failure is still reported by the action.
+ */
+async function reportProjectFailure(
+  token: string,
+  project: ProjectConfig,
+  command: CommentCommand,
+  error: unknown,
+  commandLine?: string
+): Promise<void> {
+  if (error instanceof TerraformCommandError && error.reportedByTfcmt) {
+    return;
+  }
+
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
+  try {
+    await postComment(
+      token,
+      github.context.repo.owner,
+      github.context.repo.repo,
+      prNumber,
+      buildProjectFailureComment(token, project, command, error, commandLine)
+    );
+  } catch (commentError) {
+    core.warning(
+      `Failed to post failure comment: ${commentError instanceof Error ? commentError.message : String(commentError)}`
+    );
+  }
+}
 
 /**
- * Main action execution
+ * Posts that a project was stopped because the workflow run was cancelled
+ *
+ * @param token - GitHub token
+ * @param project - Project configuration
+ * @param command - Label of the command that was running
+ *
+ * @remarks
+ * Errors while posting are only logged, as the runner kills the job shortly after
+ * cancelling it.
  */
-async function run(): Promise<void> {
+async function reportCancellation(
+  token: string,
+  project: ProjectConfig,
+  command: string
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
+
   try {
-    // Validate event type
-    validateEventType(github.context.eventName);
+    await postComment(
+      token,
+      github.context.repo.owner,
+      github.context.repo.repo,
+      prNumber,
+      buildCancelledComment(project.name, command, getRunUrl())
+    );
+  } catch (commentError) {
+    core.warning(
+      `Failed to post cancellation comment: ${commentError instanceof Error ? commentError.message : String(commentError)}`
+    );
+  }
+}
 
-    // Get inputs
-    const token = core.getInput('github-token', { required: true });
-    process.env.GITHUB_TOKEN = token;
-    const configPath = core.getInput('config-path') || '.terraform-action.yaml';
+/**
+ * URL of the current workflow run
+ */
+function getRunUrl(): string {
+  const { owner, repo } = github.context.repo;
+  return `${github.context.serverUrl}/${owner}/${repo}/actions/runs/${github.context.runId}`;
+}
 
-    core.info('Starting Terraform PR Comment Action');
+/**
+ * Builds the failure comment for a project from the error it raised
+ *
+ * @param token - GitHub token (redacted from the comment)
+ * @param project - Project configuration
+ * @param command - Command that was requested
+ * @param error - Error raised while executing the project
+ * @param commandLine - Full command echoed above the output, if any
+ * @returns Markdown comment body
+ */
+function buildProjectFailureComment(
+  token: string,
+  project: ProjectConfig,
+  command: CommentCommand,
+  error: unknown,
+  commandLine?: string
+): string {
+  const subcommand = error instanceof TerraformCommandError ? error.subcommand : command;
+  const output =
+    error instanceof TerraformCommandError
+      ? error.output
+      : error instanceof Error
+        ? error.message
+        : String(error);
 
-    // Validate Terraform installation
-    await validateTerraformInstalled();
+  return buildFailureComment(project.name, subcommand, output, [token], commandLine);
+}
 
-    // Load configuration
-    const config = loadConfig(configPath);
-    core.info(`Loaded configuration with ${config.projects.length} project(s)`);
+/**
+ * Posts terraform diagnostics as review comments on the affected lines
+ *
+ * @param token - GitHub token
+ * @param project - Project configuration
+ * @param baseDir - Directory project dirs are relative to (default: workspace root)
+ *
+ * @remarks
+ * Diagnostics without a usable source location, or on lines outside the PR diff,
+ * are gathered into a single regular PR comment instead. Errors are only logged
+ * so that the original failure is still reported.
+ */
+async function reportDiagnostics(
+  token: string,
+  project: ProjectConfig,
+  baseDir: string | undefined
+): Promise<void> {
+  const prNumber = github.context.issue.number;
+  if (!prNumber) {
+    return;
+  }
 
-    let targetProjectNames: string[] = config.projects.map((p) => p.name);
-    let command: TerraformCommand = 'plan';
-    let args: string[] = [];
+  const { owner, repo } = github.context.repo;
+  const workingDir = resolveProjectDir(project.dir, process.cwd(), baseDir);
 
-    // Extract comment body
-    if (github.context.eventName === 'issue_comment') {
-      const commentBody = getCommentBodyFromContext(github.context);
-      core.info(`Processing comment: ${commentBody}`);
+  try {
+    const diagnostics = await collectDiagnostics(workingDir, getProjectExecutionOptions(project));
+    if (diagnostics.length === 0) {
+      return;
+    }
 
-      // Parse comment
-      const parsedComment = parseComment(commentBody);
-      if (!parsedComment) {
-        core.info('Comment does not contain a terraform command, skipping');
-        return;
-      }
+    const { sha } = await getPullRequestInfo(token, owner, repo, prNumber, []);
+    const unanchored: TerraformDiagnostic[] = [];
 
-      core.info(`Detected command: terraform ${parsedComment.command}`);
+    for (const diagnostic of diagnostics) {
+      if (diagnostic.filename === undefined || diagnostic.line === undefined) {
+        unanchored.push(diagnostic);
+        continue;
+      }
 
-      if (parsedComment.projects.length > 0) {
-        validateProjectNames(parsedComment.projects, targetProjectNames);
-        targetProjectNames = parsedComment.projects;
+      // Review comments need a path relative to the repository root
+      const filePath = path
+        .relative(process.cwd(), path.join(workingDir, diagnostic.filename))
+        .split(path.sep)
+        .join('/');
 
-        core.info(`Target projects: ${targetProjectNames.join(', ')}`);
+      try {
+        await postReviewComment(
+          token,
+          owner,
+          repo,
+          prNumber,
+          sha,
+          filePath,
+          diagnostic.line,
+          formatDiagnostic(diagnostic)
+        );
+      } catch (error) {
+        core.warning(
+          `Could not anchor diagnostic to ${filePath}:${diagnostic.line}: ${error instanceof Error ? error.message : String(error)}`
+        );
+        unanchored.push(diagnostic);
       }
-      command = parsedComment.command;
-      args = parsedComment.args;
     }
 
-    // Get PR information
-    let pr: PullRequestInfo | null = null;
-    if (command === 'apply') {
-      const prNumber = getPRNumberFromContext(github.context);
-      pr = await getPullRequestInfo(
+    if (unanchored.length > 0) {
+      await postComment(
         token,
-        github.context.repo.owner,
-        github.context.repo.repo,
-        prNumber
+        owner,
+        repo,
+        prNumber,
+        `## Terraform diagnostics for project \`${project.name}\`\n\n${unanchored.map(formatDiagnostic).join('\n\n---\n\n')}`
       );
     }
+  } catch (error) {
+    core.warning(
+      `Failed to report diagnostics: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Whether a project runs with terragrunt, set explicitly or detected from its terragrunt.hcl
+ */
+function projectUsesTerragrunt(config: Config, project: ProjectConfig): boolean {
+  try {
+    const workingDir = resolveProjectDir(project.dir, process.cwd(), config.base_dir);
+    return usesTerragrunt(workingDir, {
+      terragrunt: project.terragrunt,
+      terragruntRunAll: project.terragrunt_run_all,
+    });
+  } catch {
+    // A directory outside the workspace is reported when the project runs
+    return false;
+  }
+}
 
-    // Setup tfcmt
-    const tfcmtPath = await setupTfcmt();
+/**
+ * Builds execution options from project configuration
+ *
+ * @param project - Project configuration
+ * @returns Execution options for the executor
+ * @throws Error if the project's env references a variable the runner does not set
+ */
+function getProjectExecutionOptions(project: ProjectConfig): TerraformExecutionOptions {
+  return {
+    terragrunt: project.terragrunt,
+    terragruntRunAll: project.terragrunt_run_all,
+    binary: project.binary,
+    terraformVersion: project.terraform_version,
+    refresh: project.refresh,
+    lockTimeout: project.lock_timeout,
+    planTimeout: getCommandTimeout(project.plan_timeout),
+    applyTimeout: getCommandTimeout(project.apply_timeout),
+    varFiles: project.terraform_var_files,
+    vars: project.terraform_vars,
+    env: project.env && resolveEnvReferences(project.env),
+    initUpgrade: project.init_upgrade,
+    backendConfig: project.backend_config,
+    backendConfigFiles: project.backend_config_files,
+    initExtraArgs: project.init_extra_args,
+    workspace: project.workspace,
+  };
+}
 
-    // Execute terraform for each target project serially
-    for (const projectName of targetProjectNames) {
-      const project = config.projects.find((p) => p.name === projectName);
-      if (!project) {
-        throw new Error(`Project not found: ${projectName}`);
-      }
-      await executeProjectCommand(
-        project,
-        command,
-        args,
-        pr,
-        tfcmtPath
-      );
+/**
+ * Runs terraform init for a single project (the `terraform init` comment command)
+ *
+ * @param project - Project configuration
+ * @param baseDir - Directory project dirs are relative to (default: workspace root)
+ * @param initArgs - Allowlisted init flags from the comment
+ * @param overrides - Execution options from the comment
+ * @returns Terraform execution result
+ */
+async function executeProjectInit(
+  project: ProjectConfig,
+  baseDir: string | undefined,
+  initArgs: string[],
+  overrides: TerraformExecutionOptions
+): Promise<TerraformResult> {
+  core.info(`Project: ${project.name}`);
+  core.info(`Directory: ${project.dir}`);
+
+  const workingDir = resolveProjectDir(project.dir, process.cwd(), baseDir);
+  return executeTerraformInit(workingDir, project.name, {
+    ...getProjectExecutionOptions(project),
+    ...overrides,
+    // Only this command honors init_backend; every other command needs the backend
+    initBackend: project.init_backend,
+    initArgs,
+  });
+}
+
+/**
+ * Runs terraform state for a single project (the `terraform state` comment command)
+ *
+ * @param project - Project configuration
+ * @param baseDir - Directory project dirs are relative to (default: workspace root)
+ * @param subcommand - State subcommand
+ * @param args - Arguments for the subcommand
+ * @param pr - Pull request information (required for rm and mv)
+ * @param overrides - Execution options from the comment
+ * @returns Terraform execution result
+ *
+ * @remarks
+ * rm and mv modify state, so they must meet the project's state requirements, which
+ * default to its apply requirements.
+ */
+async function executeProjectState(
+  project: ProjectConfig,
+  baseDir: string | undefined,
+  subcommand: StateSubcommand,
+  args: string[],
+  pr: PullRequestInfo | null,
+  overrides: TerraformExecutionOptions
+): Promise<TerraformResult> {
+  core.info(`Project: ${project.name}`);
+  core.info(`Directory: ${project.dir}`);
+
+  if (isStateMutation(subcommand)) {
+    validateStateChange(
+      project,
+      pr,
+      `terraform state ${subcommand}`,
+      project.state_requirements ?? project.apply_requirements ?? getDefaultRequirements('apply')
+    );
+  }
+
+  const workingDir = resolveProjectDir(project.dir, process.cwd(), baseDir);
+  return executeTerraformState(workingDir, project.name, subcommand, args, {
+    ...getProjectExecutionOptions(project),
+    ...overrides,
+  });
+}
+
+/**
+ * Runs terraform import for a single project (the `terraform import` comment command)
+ *
+ * @param project - Project configuration
+ * @param baseDir - Directory project dirs are relative to (default: workspace root)
+ * @param target - Resource address and ID
+ * @param args - Additional flags from the comment
+ * @param pr - Pull request information
+ * @param overrides - Execution options from the comment
+ * @returns Terraform execution result, with the plan of the imported resource
+ *
+ * @remarks
+ * Import writes to state, so it must meet the project's import requirements (default:
+ * its apply requirements). The imported resource is then planned, to show whether the
+ * configuration matches it; a failure of that plan is only logged, as the import is done.
+ */
+async function executeProjectImport(
+  project: ProjectConfig,
+  baseDir: string | undefined,
+  target: ImportTarget,
+  args: string[],
+  pr: PullRequestInfo | null,
+  overrides: TerraformExecutionOptions
+): Promise<TerraformResult> {
+  core.info(`Project: ${project.name}`);
+  core.info(`Directory: ${project.dir}`);
+
+  validateStateChange(
+    project,
+    pr,
+    'terraform import',
+    project.import_requirements ?? project.apply_requirements ?? getDefaultRequirements('apply')
+  );
+
+  const workingDir = resolveProjectDir(project.dir, process.cwd(), baseDir);
+  const executionOptions = { ...getProjectExecutionOptions(project), ...overrides };
+  const result = await executeTerraformImport(
+    workingDir,
+    project.name,
+    target.address,
+    target.id,
+    args,
+    executionOptions
+  );
+
+  try {
+    result.importPlan = await executeImportPlan(
+      workingDir,
+      project.name,
+      target.address,
+      executionOptions
+    );
+  } catch (error) {
+    core.warning(
+      `Could not plan ${target.address} after importing it: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+  return result;
+}
+
+/**
+ * Destroys every resource of a single project (the `terraform destroy` comment command)
+ *
+ * @param project - Project configuration
+ * @param baseDir - Directory project dirs are relative to (default: workspace root)
+ * @param args - Additional flags from the comment
+ * @param pr - Pull request information
+ * @param overrides - Execution options from the comment
+ * @returns Terraform execution result
+ * @throws Error if the project does not allow destroy or a destroy requirement is not met
+ *
+ * @remarks
+ * Destroy is refused unless the project sets destroy_requirements, which the PR must
+ * meet. Manual runs have no pull request, so the requirements are skipped with a warning.
+ */
+async function executeProjectDestroy(
+  project: ProjectConfig,
+  baseDir: string | undefined,
+  args: string[],
+  pr: PullRequestInfo | null,
+  overrides: TerraformExecutionOptions
+): Promise<TerraformResult> {
+  core.info(`Project: ${project.name}`);
+  core.info(`Directory: ${project.dir}`);
+
+  const requirements = project.destroy_requirements;
+  if (requirements === undefined) {
+    throw new Error(
+      `Project ${project.name} does not allow terraform destroy (set destroy_requirements to allow it)`
+    );
+  }
+  if (project.init_backend === false) {
+    throw new Error(
+      `Project ${project.name} sets init_backend: false, so it cannot be destroyed (remove the setting to destroy it)`
+    );
+  }
+
+  if (pr) {
+    core.info(`Requirements: ${requirements.join(', ')}`);
+    validateRequirements(pr, requirements);
+    validateLabelRequirements(pr, project.required_labels ?? [], project.forbidden_labels ?? []);
+    core.info('All requirements met');
+  } else {
+    core.warning(
+      `Skipping requirements of terraform destroy for project ${project.name}: no pull request`
+    );
+  }
+
+  return executeTerraformDestroy(
+    resolveProjectDir(project.dir, process.cwd(), baseDir),
+    project.name,
+    args,
+    { ...getProjectExecutionOptions(project), ...overrides }
+  );
+}
+
+/**
+ * Renders the saved plan of a single project (the `terraform show` comment command)
+ *
+ * @param project - Project configuration
+ * @param baseDir - Directory project dirs are relative to (default: workspace root)
+ * @param args - Flags from the comment (-json)
+ * @param overrides - Execution options from the comment
+ * @param planScope - Pull request commit the saved plan belongs to
+ * @returns Terraform execution result
+ * @throws Error if the project has no saved plan
+ *
+ * @remarks
+ * The plan is the artifact uploaded by the latest `terraform plan` of the head commit,
+ * so nothing is planned again and providers are not queried.
+ */
+async function executeProjectShow(
+  project: ProjectConfig,
+  baseDir: string | undefined,
+  args: string[],
+  overrides: TerraformExecutionOptions,
+  planScope?: PlanArtifactScope
+): Promise<TerraformResult> {
+  core.info(`Project: ${project.name}`);
+  core.info(`Directory: ${project.dir}`);
+
+  const noPlan =
+    `No saved plan for project ${project.name}. Run \`terraform plan -project=${project.name}\` first`;
+  // terragrunt run-all plans every module separately and saves no plan file
+  if (project.terragrunt_run_all) {
+    throw new Error(`${noPlan} (terragrunt_run_all projects never save one)`);
+  }
+
+  const workingDir = resolveProjectDir(project.dir, process.cwd(), baseDir);
+  let planFilePath: string;
+  try {
+    planFilePath = await downloadPlanFile(project.name, workingDir, planScope);
+  } catch (error) {
+    core.info(
+      `Could not download plan file artifact: ${error instanceof Error ? error.message : String(error)}`
+    );
+    throw new Error(noPlan);
+  }
+
+  const executionOptions = { ...getProjectExecutionOptions(project), ...overrides };
+  await maskSensitivePlanValues(workingDir, planFilePath, executionOptions);
+  return executeTerraformShow(workingDir, project.name, planFilePath, args, executionOptions);
+}
+
+/**
+ * Masks the values a saved plan marks sensitive for the rest of the run
+ * (redaction.sensitive_values)
+ *
+ * @param workingDir - Resolved project directory
+ * @param planFilePath - Saved plan
+ * @param executionOptions - Execution options for the project
+ * @throws Error if the plan cannot be read, as its values could not be masked
+ */
+async function maskSensitivePlanValues(
+  workingDir: string,
+  planFilePath: string,
+  executionOptions: TerraformExecutionOptions
+): Promise<void> {
+  if (masksSensitiveValues()) {
+    const planJson = await executeTerraformShowJson(workingDir, planFilePath, executionOptions);
+    addSensitiveValues(collectSensitiveValues(planJson));
+  }
+}
+
+/**
+ * Shows the plan saved for the head commit instead of planning again (plan_cache)
+ *
+ * @param project - Project configuration
+ * @param baseDir - Directory project dirs are relative to (default: workspace root)
+ * @param overrides - Execution options from the comment
+ * @param planScope - Pull request commit the saved plan belongs to
+ * @returns Result of terraform show for the saved plan, or undefined when there is none
+ *
+ * @remarks
+ * A plan that cannot be looked up or read is made again rather than failing the project.
+ */
+async function reuseSavedPlan(
+  project: ProjectConfig,
+  baseDir: string | undefined,
+  overrides: TerraformExecutionOptions,
+  planScope: PlanArtifactScope
+): Promise<TerraformResult | undefined> {
+  try {
+    if (!(await hasSavedPlan(project.name, planScope))) {
+      return undefined;
     }
+    core.info(`Reusing the plan saved for ${planScope.sha} (comment with --force to plan again)`);
+    const workingDir = resolveProjectDir(project.dir, process.cwd(), baseDir);
+    const planFilePath = await downloadPlanFile(project.name, workingDir, planScope);
+    const executionOptions = { ...getProjectExecutionOptions(project), ...overrides };
+    await maskSensitivePlanValues(workingDir, planFilePath, executionOptions);
+    const result = await executeTerraformShow(
+      workingDir,
+      project.name,
+      planFilePath,
+      [],
+      executionOptions
+    );
+    const summary = parseChangeSummary(result.stdout);
+    return { ...result, hasChanges: summary !== null && !isNoOp(summary), reusedPlan: true };
+  } catch (error) {
+    core.warning(
+      `Could not reuse the saved plan of project ${project.name}, planning again: ${error instanceof Error ? error.message : String(error)}`
+    );
+    return undefined;
+  }
+}
 
-    core.info('Terraform PR Comment Action completed successfully');
+/**
+ * Validates a PR against a project's requirements before state is changed outside apply
+ *
+ * @param project - Project configuration
+ * @param pr - Pull request information
+ * @param label - Command label used in messages (e.g., terraform import)
+ * @param requirements - Requirements to meet (default: the project's apply requirements)
+ * @throws Error if a requirement is not met
+ *
+ * @remarks
+ * Manual runs have no pull request, so the requirements are skipped with a warning.
+ */
+function validateStateChange(
+  project: ProjectConfig,
+  pr: PullRequestInfo | null,
+  label: string,
+  requirements: Requirement[] = project.apply_requirements ?? getDefaultRequirements('apply')
+): void {
+  if (!pr) {
+    core.warning(`Skipping requirements of ${label} for project ${project.name}: no pull request`);
+    return;
+  }
+  core.info(`Requirements: ${requirements.join(', ')}`);
+  validateRequirements(pr, requirements);
+  validateLabelRequirements(pr, project.required_labels ?? [], project.forbidden_labels ?? []);
+  core.info('All requirements met');
+}
+
+/**
+ * Downloads the saved plan a project with require_plan or a cost limit must be applied from
+ *
+ * @param project - Project configuration
+ * @param workingDir - Directory to download the plan file to
+ * @param planScope - Pull request commit the plan must belong to
+ * @returns Path to the plan file
+ * @throws Error if there is no plan of the commit, or its metadata does not match
+ *
+ * @remarks
+ * Without a pull request, the plan must be of the commit the workflow run is for.
+ */
+async function downloadRequiredPlan(
+  project: ProjectConfig,
+  workingDir: string,
+  planScope: PlanArtifactScope | undefined
+): Promise<string> {
+  const sha = planScope?.sha ?? github.context.sha;
+  try {
+    const planFilePath = await downloadPlanFile(project.name, workingDir, planScope);
+    const metadata = verifyPlanMetadata(planFilePath, project.name, sha);
+    core.info(`Using plan file from artifact: ${planFilePath} (planned at ${metadata.plannedAt})`);
+    return planFilePath;
   } catch (error) {
-    // Fail fast on any error
-    const message = error instanceof Error ? error.message : String(error);
-    core.setFailed(message);
+    throw new Error(
+      `Project ${project.name} requires a plan of commit ${sha} before apply ` +
+        `(run terraform plan first): ${error instanceof Error ? error.message : String(error)}`
+    );
   }
 }
 
@@ -111,24 +3688,56 @@ async function run(): Promise<void> {
  * Executes a terraform command for a single project
  *
  * @param project - Project configuration
+ * @param baseDir - Directory project dirs are relative to (default: workspace root)
  * @param command - Terraform command to execute
  * @param args - Additional terraform arguments
  * @param pr - Pull request information
  * @param tfcmtPath - Path to tfcmt binary
- * @param tfcmtConfig - Optional tfcmt configuration
+ * @param overrides - Execution options from the comment, taking precedence over project config
+ * @param destroyPreview - Whether the plan is a destroy preview (never saved for apply)
+ * @param readPlan - Whether to read the planned changes (compare_plans, plan_summary, check runs)
+ * @param planScope - Pull request commit plans are saved for and applied from
+ * @param workflowSteps - Steps of the project's custom workflow for the command, if any
+ * @param policySets - Policy sets a plan is checked against (not for destroy previews)
+ * @param infracost - Infracost settings the cost of a plan is estimated with, if any
+ * @returns Terraform execution result
  */
 async function executeProjectCommand(
   project: ProjectConfig,
+  baseDir: string | undefined,
   command: 'plan' | 'apply',
   args: string[],
   pr: PullRequestInfo | null,
-  tfcmtPath: string
-): Promise<void> {
+  tfcmtPath: string,
+  overrides: TerraformExecutionOptions,
+  destroyPreview = false,
+  readPlan = false,
+  planScope?: PlanArtifactScope,
+  workflowSteps?: WorkflowStep[],
+  policySets: PolicySetConfig[] = [],
+  infracost?: InfracostConfig
+): Promise<TerraformResult> {
   core.info(`\n${'='.repeat(60)}`);
   core.info(`Project: ${project.name}`);
   core.info(`Directory: ${project.dir}`);
   core.info(`${'='.repeat(60)}\n`);
 
+  // A project initialized without its backend is meant for validation only
+  if (command === 'apply' && project.init_backend === false) {
+    throw new Error(
+      `Project ${project.name} sets init_backend: false, so it cannot be applied (remove the setting to apply it)`
+    );
+  }
+  if (project.init_backend === false) {
+    core.info('Ignoring init_backend: false, as plan needs the backend');
+  }
+  // run-all applies whatever the tree plans to at apply time, not a reviewed plan
+  if (command === 'apply' && project.terragrunt_run_all && !project.terragrunt_run_all_apply) {
+    throw new Error(
+      `Project ${project.name} uses terragrunt_run_all, which applies without a saved plan (set terragrunt_run_all_apply: true to allow it)`
+    );
+  }
+
   // Get requirements for this command
   const requirements =
     command === 'plan'
@@ -137,20 +3746,24 @@ async function executeProjectCommand(
 
   core.info(`Requirements: ${requirements.join(', ')}`);
 
-  // Validate requirements
-  if (command === 'apply' && pr != null) {
-    validateRequirements(pr, requirements);
-    core.info('All requirements met');
-  }
-
   // Resolve working directory
-  const workingDir = path.resolve(project.dir);
+  const workingDir = resolveProjectDir(project.dir, process.cwd(), baseDir);
+
+  const executionOptions: TerraformExecutionOptions = {
+    ...getProjectExecutionOptions(project),
+    ...overrides,
+  };
 
   // For apply command, try to download the plan file artifact
+  // (terragrunt run-all applies the whole tree without a saved plan). Plans over the cost
+  // limit are not saved, so planning again on apply would bypass the limit
+  const costLimited = infracost?.max_monthly_increase !== undefined && !project.terragrunt_run_all;
   let planFilePath: string | undefined;
-  if (command === 'apply') {
+  if (command === 'apply' && (project.require_plan || costLimited)) {
+    planFilePath = await downloadRequiredPlan(project, workingDir, planScope);
+  } else if (command === 'apply' && !project.terragrunt_run_all) {
     try {
-      planFilePath = await downloadPlanFile(project.name, workingDir);
+      planFilePath = await downloadPlanFile(project.name, workingDir, planScope);
       core.info(`Using plan file from artifact: ${planFilePath}`);
     } catch (error) {
       core.warning(
@@ -159,15 +3772,58 @@ async function executeProjectCommand(
     }
   }
 
-  // Execute terraform with tfcmt
-  const result = await executeTerraformWithTfcmt(
-    tfcmtPath,
-    command,
-    project.name,
-    workingDir,
-    args,
-    planFilePath
-  );
+  // Validate requirements (no_destroys and planned need the saved plan, so this follows
+  // the download)
+  if (command === 'apply' && pr != null) {
+    const withPlan = { ...pr, savedPlan: planFilePath !== undefined };
+    const checked = usesKeyword(requirements, 'no_destroys')
+      ? await checkPlannedDestroys(project, withPlan, workingDir, planFilePath, executionOptions)
+      : withPlan;
+    validateRequirements(checked, requirements);
+    validateLabelRequirements(pr, project.required_labels ?? [], project.forbidden_labels ?? []);
+    core.info('All requirements met');
+  } else if (command === 'apply') {
+    core.warning(`Skipping requirements for project ${project.name}: no open pull request`);
+  }
+
+  // tfcmt masks the sensitive values of the saved plan in the apply comment it posts
+  if (command === 'apply' && planFilePath) {
+    await maskSensitivePlanValues(workingDir, planFilePath, executionOptions);
+  }
+
+  // Execute terraform with tfcmt, on its own or as a step of the custom workflow
+  const runCommandStep = (options: TerraformExecutionOptions) =>
+    executeTerraformWithTfcmt(
+      tfcmtPath,
+      command,
+      project.name,
+      workingDir,
+      args,
+      planFilePath,
+      options
+    );
+  let result: TerraformResult;
+  try {
+    if (workflowSteps) {
+      core.info(`Workflow: ${project.workflow}`);
+      result = await runWorkflow(
+        workflowSteps,
+        command,
+        workingDir,
+        project.name,
+        buildWorkflowEnv(project, workingDir, command, planFilePath),
+        executionOptions,
+        runCommandStep
+      );
+    } else {
+      result = await runCommandStep(executionOptions);
+    }
+  } catch (error) {
+    if (project.auto_unlock_on_failure && error instanceof TerraformCommandError) {
+      await releaseDanglingLock(project, workingDir, error.output, executionOptions);
+    }
+    throw error;
+  }
 
   // Log results and upload plan file if this was a plan command
   if (command === 'plan') {
@@ -177,10 +3833,71 @@ async function executeProjectCommand(
       core.info('No changes detected in plan');
     }
 
-    // Upload plan file as artifact for later use during apply
-    if (result.planFilePath) {
+    // A destroy preview is neither compared, summarized, checked nor priced, as it is
+    // not the plan that would be applied
+    const scan = project.security_scan;
+    const checksPlan = policySets.length > 0 || infracost !== undefined || scan?.target === 'plan';
+    // Unlike a comparison or summary, checks and masking cannot be skipped when the plan
+    // is unreadable
+    const planJson =
+      result.planFilePath && ((checksPlan && !destroyPreview) || masksSensitiveValues())
+        ? await executeTerraformShowJson(workingDir, result.planFilePath, executionOptions)
+        : undefined;
+    if (planJson !== undefined && masksSensitiveValues()) {
+      addSensitiveValues(collectSensitiveValues(planJson));
+    }
+    let planJsonPath: string | undefined;
+    if (checksPlan && planJson !== undefined && !destroyPreview) {
+      if (readPlan) {
+        result.plannedChanges = parsePlannedChanges(planJson);
+      }
+      planJsonPath = writePlanJson(project.name, planJson);
+      if (policySets.length > 0) {
+        result.policyCheck = await checkPlanPolicies(
+          project.name,
+          policySets,
+          workingDir,
+          planJsonPath
+        );
+      }
+      if (infracost) {
+        result.costEstimate = await readCostEstimate(project, workingDir, planJsonPath, infracost);
+      }
+    } else if (readPlan && result.planFilePath && !destroyPreview) {
+      result.plannedChanges = await readPlannedChanges(
+        project,
+        workingDir,
+        result.planFilePath,
+        executionOptions
+      );
+    }
+    if (scan && !destroyPreview) {
+      result.securityScan = await scanProject(project.name, scan, workingDir, planJsonPath);
+    }
+
+    // Upload plan file as artifact for later use during apply. A destroy preview is
+    // read-only: uploading it would let the next apply destroy the project
+    if (result.planFilePath && destroyPreview) {
+      core.info('Destroy preview: the plan file is not saved for apply');
+    } else if (
+      result.planFilePath &&
+      result.costEstimate &&
+      infracost &&
+      exceedsCostLimit(result.costEstimate, infracost)
+    ) {
+      // The plan fails once its cost is reported, so it must not be applied either
+      core.info('Cost limit exceeded: the plan file is not saved for apply');
+    } else if (
+      result.planFilePath &&
+      result.securityScan?.blockOn &&
+      result.securityScan.blocking > 0
+    ) {
+      // Unlike a failed policy check, which a policy owner may approve for this very plan,
+      // blocking findings cannot be waived
+      core.info('Security scan found blocking issues: the plan file is not saved for apply');
+    } else if (result.planFilePath) {
       try {
-        await uploadPlanFile(result.planFilePath, project.name);
+        await uploadPlanFile(result.planFilePath, project.name, planScope);
         core.info(`Plan file uploaded as artifact for project: ${project.name}`);
       } catch (error) {
         core.warning(
@@ -190,8 +3907,18 @@ async function executeProjectCommand(
     }
   } else {
     core.info('Apply completed successfully');
+
+    // Outputs of a run-all apply span several modules, so they are not collected
+    if (!project.terragrunt_run_all) {
+      try {
+        result.outputs = await executeTerraformOutput(workingDir, executionOptions);
+      } catch (error) {
+        core.warning(
+          `Could not read outputs for project ${project.name}: ${error instanceof Error ? error.message : String(error)}`
+        );
+      }
+    }
   }
-}
 
-// Execute main function
-run();
+  return result;
+}
@@ -0,0 +1,94 @@
+/**
+ * Unit tests for local module dependency detection
+ */
+
+import * as fs from 'node:fs';
+import * as os from 'node:os';
+import * as path from 'node:path';
+import { findLocalModuleDirs, parseLocalModuleSources } from './module-graph';
+
+describe('module-graph', () => {
+  describe('parseLocalModuleSources', () => {
+    it('should list local sources and ignore remote ones', () => {
+      const content = `
+module "vpc" {
+  source = "../../modules/vpc"
+  cidr   = "10.0.0.0/16"
+}
+
+module "dns" {
+  source  = "terraform-aws-modules/route53/aws"
+  version = "~> 2.0"
+}
+
+module "tags" {
+  source = "./tags"
+}
+`;
+
+      expect(parseLocalModuleSources(content)).toEqual(['../../modules/vpc', './tags']);
+    });
+
+    it('should ignore comments and the source of nested blocks', () => {
+      const content = `
+# module "old" {
+#   source = "../modules/old"
+# }
+/*
+module "older" {
+  source = "../modules/older"
+}
+*/
+module "app" {
+  settings = {
+    source = "../not-a-module"
+  }
+  name   = "a # b // c { d"
+  source = "../modules/app" // the current version
+}
+`;
+
+      expect(parseLocalModuleSources(content)).toEqual(['../modules/app']);
+    });
+  });
+
+  describe('findLocalModuleDirs', () => {
+    let root: string;
+
+    /**
+     * Writes a file below the temporary repository root
+     */
+    function writeFile(relativePath: string, content: string): void {
+      const file = path.join(root, relativePath);
+      fs.mkdirSync(path.dirname(file), { recursive: true });
+      fs.writeFileSync(file, content);
+    }
+
+    beforeEach(() => {
+      root = fs.mkdtempSync(path.join(os.tmpdir(), 'terraform-action-'));
+    });
+
+    afterEach(() => {
+      fs.rmSync(root, { recursive: true, force: true });
+    });
+
+    it('should follow modules used by other modules', () => {
+      writeFile('envs/prod/main.tf', 'module "app" {\n  source = "../../modules/app"\n}\n');
+      writeFile('modules/app/main.tf', 'module "vpc" {\n  source = "../vpc"\n}\n');
+      writeFile('modules/vpc/main.tf', 'module "app" {\n  source = "../app"\n}\n');
+      writeFile('modules/unused/main.tf', '');
+
+      expect(findLocalModuleDirs(path.join(root, 'envs/prod'), root)).toEqual([
+        'modules/app',
+        'modules/vpc',
+      ]);
+    });
+
+    it('should ignore modules outside the repository and missing directories', () => {
+      writeFile('envs/prod/main.tf', 'module "x" {\n  source = "../../../outside"\n}\n');
+
+      expect(findLocalModuleDirs(path.join(root, 'envs/prod'), root)).toEqual([]);
+      expect(findLocalModuleDirs(path.join(root, 'envs/missing'), root)).toEqual([]);
+    });
+  });
+});
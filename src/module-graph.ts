@@ -0,0 +1,153 @@
+/**
+ * Local module dependencies of terraform projects
+ */
+
+import * as fs from 'node:fs';
+import * as path from 'node:path';
+
+/**
+ * Start of a module block, such as `module "vpc" {`
+ */
+const MODULE_BLOCK_REGEX = /^[ \t]*module[ \t]+"[^"]*"[ \t]*\{/gm;
+
+/**
+ * The source argument of a module block
+ */
+const SOURCE_REGEX = /^[ \t]*source[ \t]*=[ \t]*"([^"]*)"/m;
+
+/**
+ * A string literal (captured, kept as is) or a #, // or /* *\/ comment
+ */
+const COMMENT_OR_STRING_REGEX = /("(?:[^"\\\n]|\\.)*")|#[^\n]*|\/\/[^\n]*|\/\*[\s\S]*?\*\//g;
+
+/**
+ * Lists the local module sources referenced by terraform code
+ *
+ * @param content - Contents of a .tf file
+ * @returns Sources starting with ./ or ../, in file order
+ *
+ * @remarks
+ * Only arguments directly inside a module block are read, so a `source` of a nested
+ * block does not count. Registry and remote sources are ignored.
+ *
+ * @example
+ * parseLocalModuleSources('module "vpc" {\n  source = "../modules/vpc"\n}')
+ * // => ['../modules/vpc']
+ */
+export function parseLocalModuleSources(content: string): string[] {
+  const text = stripComments(content);
+  const sources: string[] = [];
+
+  for (const match of text.matchAll(MODULE_BLOCK_REGEX)) {
+    const start = (match.index ?? 0) + match[0].length;
+    const body = topLevelBody(text, start);
+    const source = body.match(SOURCE_REGEX)?.[1];
+    if (source !== undefined && (source.startsWith('./') || source.startsWith('../'))) {
+      sources.push(source);
+    }
+  }
+
+  return sources;
+}
+
+/**
+ * Finds the local modules a project uses, directly or through other local modules
+ *
+ * @param projectDir - Absolute project directory
+ * @param workspaceRoot - Repository root
+ * @returns Module directories relative to the repository root, with forward slashes
+ *
+ * @remarks
+ * Modules outside the repository are ignored, and a directory that cannot be read
+ * simply has no modules.
+ */
+export function findLocalModuleDirs(
+  projectDir: string,
+  workspaceRoot: string = process.cwd()
+): string[] {
+  const root = path.resolve(workspaceRoot);
+  const visited = new Set([path.resolve(projectDir)]);
+  const queue = [path.resolve(projectDir)];
+  const moduleDirs: string[] = [];
+
+  while (queue.length > 0) {
+    const dir = queue.shift() as string;
+    for (const source of readLocalModuleSources(dir)) {
+      const moduleDir = path.resolve(dir, source);
+      const relative = path.relative(root, moduleDir);
+      if (visited.has(moduleDir) || relative.startsWith('..') || path.isAbsolute(relative)) {
+        continue;
+      }
+      visited.add(moduleDir);
+      queue.push(moduleDir);
+      moduleDirs.push(relative.split(path.sep).join('/'));
+    }
+  }
+
+  return moduleDirs;
+}
+
+/**
+ * Reads the local module sources of every .tf file in a directory
+ */
+function readLocalModuleSources(dir: string): string[] {
+  let names: string[];
+  try {
+    names = fs.readdirSync(dir).filter((name) => name.endsWith('.tf'));
+  } catch {
+    return [];
+  }
+
+  return names
+    .sort()
+    .flatMap((name) => parseLocalModuleSources(fs.readFileSync(path.join(dir, name), 'utf8')));
+}
+
+/**
+ * Blanks out comments, leaving strings (which may contain # or //) untouched
+ */
+function stripComments(content: string): string {
+  return content.replace(COMMENT_OR_STRING_REGEX, (match, str) =>
+    str !== undefined ? str : match.replace(/[^\n]/g, ' ')
+  );
+}
+
+/**
+ * Returns the body of a block, with its nested blocks blanked out
+ *
+ * @param text - Terraform code without comments
+ * @param start - Index right after the opening brace of the block
+ */
+function topLevelBody(text: string, start: number): string {
+  let depth = 0;
+  let body = '';
+  let inString = false;
+
+  for (let i = start; i < text.length; i++) {
+    const char = text[i];
+    if (inString) {
+      if (char === '\\') {
+        body += depth === 0 ? text.slice(i, i + 2) : '  ';
+        i++;
+        continue;
+      }
+      if (char === '"') {
+        inString = false;
+      }
+    } else if (char === '"') {
+      inString = true;
+    } else if (char === '{') {
+      depth++;
+    } else if (char === '}') {
+      if (depth === 0) {
+        break;
+      }
+      depth--;
+      body += ' ';
+      continue;
+    }
+    body += depth === 0 || char === '\n' ? char : ' ';
+  }
+
+  return body;
+}
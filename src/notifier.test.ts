@@ -0,0 +1,159 @@
+/**
+ * Unit tests for webhook notifications
+ */
+
+import * as core from '@actions/core';
+import {
+  buildNotificationPayload,
+  type NotificationEvent,
+  resolveWebhookUrl,
+  sendNotification,
+} from './notifier';
+
+// Mock the @actions/core module
+jest.mock('@actions/core');
+
+describe('notifier', () => {
+  const mockCore = core as jest.Mocked<typeof core>;
+  const mockFetch = jest.fn();
+  const originalFetch = global.fetch;
+
+  const event: NotificationEvent = {
+    repository: 'owner/repo',
+    project: 'production',
+    command: 'apply',
+    status: 'success',
+    prUrl: 'https://github.com/owner/repo/pull/123',
+    summary: { add: 1, change: 2, destroy: 0 },
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    global.fetch = mockFetch as unknown as typeof fetch;
+  });
+
+  afterAll(() => {
+    global.fetch = originalFetch;
+  });
+
+  describe('buildNotificationPayload', () => {
+    it('should build a Slack payload by default', () => {
+      const payload = buildNotificationPayload(event);
+
+      expect(payload).toEqual({
+        text: [
+          '✅ terraform apply succeeded for *production* in owner/repo',
+          'Pull request: <https://github.com/owner/repo/pull/123>',
+          'Changes: 1 to add, 2 to change, 0 to destroy',
+        ].join('\n'),
+      });
+    });
+
+    it('should include the error in a Slack failure payload', () => {
+      const payload = buildNotificationPayload({
+        ...event,
+        status: 'failure',
+        summary: null,
+        error: 'Terraform apply failed',
+      });
+
+      expect(payload.text).toContain('❌ terraform apply failed for *production*');
+      expect(payload.text).toContain('Error: Terraform apply failed');
+    });
+
+    it('should build a Slack payload for drift', () => {
+      const payload = buildNotificationPayload({
+        ...event,
+        command: 'drift',
+        status: 'drifted',
+        prUrl: undefined,
+      });
+
+      expect(payload).toEqual({
+        text: [
+          '⚠️ terraform drift detected for *production* in owner/repo',
+          'Changes: 1 to add, 2 to change, 0 to destroy',
+        ].join('\n'),
+      });
+    });
+
+    it('should build a generic JSON payload', () => {
+      const payload = buildNotificationPayload(event, 'json');
+
+      expect(payload).toEqual({
+        repository: 'owner/repo',
+        project: 'production',
+        command: 'apply',
+        status: 'success',
+        pr_url: 'https://github.com/owner/repo/pull/123',
+        summary: { add: 1, change: 2, destroy: 0 },
+        error: null,
+      });
+    });
+  });
+
+  describe('resolveWebhookUrl', () => {
+    afterEach(() => {
+      delete process.env.TEST_WEBHOOK_URL;
+    });
+
+    it('should prefer the URL from the environment variable', () => {
+      process.env.TEST_WEBHOOK_URL = 'https://hooks.example.com/env';
+
+      expect(
+        resolveWebhookUrl({
+          webhook_url: 'https://hooks.example.com/literal',
+          webhook_url_env: 'TEST_WEBHOOK_URL',
+        })
+      ).toBe('https://hooks.example.com/env');
+    });
+
+    it('should return undefined when the environment variable is unset', () => {
+      expect(resolveWebhookUrl({ webhook_url_env: 'TEST_WEBHOOK_URL' })).toBeUndefined();
+    });
+
+    it('should fall back to the literal URL', () => {
+      expect(resolveWebhookUrl({ webhook_url: 'https://hooks.example.com/literal' })).toBe(
+        'https://hooks.example.com/literal'
+      );
+    });
+  });
+
+  describe('sendNotification', () => {
+    const config = { webhook_url: 'https://hooks.example.com/x', format: 'json' as const };
+
+    it('should POST the payload as JSON', async () => {
+      mockFetch.mockResolvedValue({ ok: true, status: 200 });
+
+      await sendNotification(config, event);
+
+      expect(mockFetch).toHaveBeenCalledWith('https://hooks.example.com/x', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(buildNotificationPayload(event, 'json')),
+      });
+    });
+
+    it('should only warn when the webhook returns an error status', async () => {
+      mockFetch.mockResolvedValue({ ok: false, status: 500 });
+
+      await expect(sendNotification(config, event)).resolves.toBeUndefined();
+
+      expect(mockCore.warning).toHaveBeenCalledWith('Notification webhook responded with HTTP 500');
+    });
+
+    it('should only warn when delivery throws', async () => {
+      mockFetch.mockRejectedValue(new Error('ECONNREFUSED'));
+
+      await expect(sendNotification(config, event)).resolves.toBeUndefined();
+
+      expect(mockCore.warning).toHaveBeenCalledWith('Failed to send notification: ECONNREFUSED');
+    });
+
+    it('should skip when no webhook URL is available', async () => {
+      await sendNotification({ webhook_url_env: 'UNSET_WEBHOOK_VAR' }, event);
+
+      expect(mockFetch).not.toHaveBeenCalled();
+    });
+  });
+});
@@ -0,0 +1,155 @@
+/**
+ * Webhook notifications for apply and drift check results
+ */
+
+import * as core from '@actions/core';
+import { formatChangeSummary } from './plan-summary';
+import { redact } from './redaction';
+import type { ChangeSummary, NotificationConfig, NotificationFormat } from './types';
+
+/**
+ * Result of a terraform command to notify about
+ */
+export interface NotificationEvent {
+  /** Repository in owner/repo form */
+  repository: string;
+  /** Project name */
+  project: string;
+  /** Terraform command that was executed */
+  command: string;
+  /** Whether the command succeeded, or for a drift check, that drift was found */
+  status: 'success' | 'failure' | 'drifted';
+  /** Link to the pull request */
+  prUrl?: string;
+  /** Resource change counts, when terraform reported them */
+  summary?: ChangeSummary | null;
+  /** Error message for failures */
+  error?: string;
+}
+
+/**
+ * Icon and verb of the first line of a Slack message, keyed by status
+ */
+const SLACK_HEADLINES: Record<NotificationEvent['status'], { icon: string; verb: string }> = {
+  success: { icon: '✅', verb: 'succeeded' },
+  failure: { icon: '❌', verb: 'failed' },
+  drifted: { icon: '⚠️', verb: 'detected' },
+};
+
+/**
+ * Builds a Slack incoming-webhook compatible payload
+ */
+function buildSlackPayload(event: NotificationEvent): Record<string, unknown> {
+  const headline = SLACK_HEADLINES[event.status];
+  const lines = [
+    `${headline.icon} terraform ${event.command} ${headline.verb} for *${event.project}* in ${event.repository}`,
+  ];
+
+  if (event.prUrl) {
+    lines.push(`Pull request: <${event.prUrl}>`);
+  }
+  if (event.summary) {
+    lines.push(`Changes: ${formatChangeSummary(event.summary)}`);
+  }
+  if (event.error) {
+    lines.push(`Error: ${event.error}`);
+  }
+
+  return { text: lines.join('\n') };
+}
+
+/**
+ * Builds a generic JSON payload for arbitrary webhook consumers
+ */
+function buildJsonPayload(event: NotificationEvent): Record<string, unknown> {
+  return {
+    repository: event.repository,
+    project: event.project,
+    command: event.command,
+    status: event.status,
+    pr_url: event.prUrl ?? null,
+    summary: event.summary ?? null,
+    error: event.error ?? null,
+  };
+}
+
+/**
+ * Payload builders keyed by notification format
+ */
+const PAYLOAD_BUILDERS: Record<
+  NotificationFormat,
+  (event: NotificationEvent) => Record<string, unknown>
+> = {
+  slack: buildSlackPayload,
+  json: buildJsonPayload,
+};
+
+/**
+ * Builds the webhook payload for a notification event
+ *
+ * @param event - Notification event
+ * @param format - Payload format (default: slack)
+ * @returns JSON-serializable payload
+ */
+export function buildNotificationPayload(
+  event: NotificationEvent,
+  format: NotificationFormat = 'slack'
+): Record<string, unknown> {
+  return PAYLOAD_BUILDERS[format](event);
+}
+
+/**
+ * Resolves the webhook URL from configuration
+ *
+ * @returns Webhook URL, or undefined if none is configured
+ */
+export function resolveWebhookUrl(config: NotificationConfig): string | undefined {
+  if (config.webhook_url_env) {
+    return process.env[config.webhook_url_env] || undefined;
+  }
+  return config.webhook_url || undefined;
+}
+
+/**
+ * Sends a notification to the configured webhook
+ *
+ * @param config - Notification configuration
+ * @param event - Notification event
+ *
+ * @remarks
+ * Delivery failures are logged as warnings and never fail the run.
+ */
+export async function sendNotification(
+  config: NotificationConfig,
+  event: NotificationEvent
+): Promise<void> {
+  const url = resolveWebhookUrl(config);
+  if (!url) {
+    core.warning('Notifications are configured but no webhook URL is available, skipping');
+    return;
+  }
+
+  // Error messages can carry terraform output
+  const payload = buildNotificationPayload(
+    { ...event, error: event.error && redact(event.error) },
+    config.format
+  );
+  try {
+    const response = await fetch(url, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(payload),
+    });
+
+    if (!response.ok) {
+      core.warning(`Notification webhook responded with HTTP ${response.status}`);
+      return;
+    }
+
+    core.info(`Sent ${event.status} notification for project ${event.project}`);
+  } catch (error) {
+    core.warning(
+      `Failed to send notification: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
@@ -0,0 +1,196 @@
+/**
+ * Unit tests for terraform change summary parsing
+ */
+
+import {
+  countPlannedChanges,
+  diffPlannedChanges,
+  formatActions,
+  formatChangeSummary,
+  formatDestroyPreview,
+  isEmptyPlanDiff,
+  isNoOp,
+  parseChangeSummary,
+  parsePlannedChanges,
+  parsePlannedDestroys,
+  parsePlanOutputChanges,
+} from './plan-summary';
+
+describe('plan-summary', () => {
+  describe('parseChangeSummary', () => {
+    it('should parse plan output', () => {
+      const output = 'Terraform will perform the following actions:\n\nPlan: 1 to add, 2 to change, 3 to destroy.\n';
+
+      expect(parseChangeSummary(output)).toEqual({ add: 1, change: 2, destroy: 3 });
+    });
+
+    it('should parse apply output', () => {
+      const output = 'Apply complete! Resources: 4 added, 0 changed, 1 destroyed.\n';
+
+      expect(parseChangeSummary(output)).toEqual({ add: 4, change: 0, destroy: 1 });
+    });
+
+    it('should treat "No changes." as zero counts', () => {
+      const output =
+        'No changes. Your infrastructure matches the configuration.\n\nTerraform has compared your real infrastructure';
+
+      expect(parseChangeSummary(output)).toEqual({ add: 0, change: 0, destroy: 0 });
+    });
+
+    it('should return null when no summary is present', () => {
+      expect(parseChangeSummary('Error: Invalid provider configuration')).toBeNull();
+    });
+  });
+
+  describe('formatChangeSummary', () => {
+    it('should format counts', () => {
+      expect(formatChangeSummary({ add: 1, change: 0, destroy: 2 })).toBe(
+        '1 to add, 0 to change, 2 to destroy'
+      );
+    });
+  });
+
+  describe('formatDestroyPreview', () => {
+    it('should lead with the destroy count', () => {
+      expect(formatDestroyPreview({ add: 0, change: 0, destroy: 12 })).toBe('12 to destroy');
+      expect(formatDestroyPreview({ add: 1, change: 0, destroy: 3 })).toBe(
+        '3 to destroy (1 to add, 0 to change)'
+      );
+    });
+  });
+
+  describe('parsePlannedDestroys', () => {
+    it('should list deleted and replaced resources', () => {
+      const plan = JSON.stringify({
+        resource_changes: [
+          { address: 'aws_instance.old', change: { actions: ['delete'] } },
+          { address: 'aws_instance.web', change: { actions: ['create', 'delete'] } },
+          { address: 'aws_s3_bucket.logs', change: { actions: ['update'] } },
+          { address: 'aws_iam_role.ci', change: { actions: ['no-op'] } },
+        ],
+      });
+
+      expect(parsePlannedDestroys(plan)).toEqual(['aws_instance.old', 'aws_instance.web']);
+    });
+
+    it('should find nothing in a plan without resource changes', () => {
+      expect(parsePlannedDestroys('{"format_version":"1.2"}')).toEqual([]);
+    });
+
+    it('should throw when the output is not JSON', () => {
+      expect(() => parsePlannedDestroys('Error: no plan')).toThrow('Could not parse plan JSON');
+    });
+  });
+
+  describe('parsePlanOutputChanges', () => {
+    it('should list the resources of every resource heading in plan order', () => {
+      const output = [
+        'Note: Objects have changed outside of Terraform',
+        '',
+        '  # aws_instance.web has changed',
+        '',
+        'Terraform will perform the following actions:',
+        '',
+        '  # aws_instance.web will be updated in-place',
+        '  # aws_s3_bucket.logs must be replaced',
+        '  # module.app.aws_iam_role.this["a b"] will be created',
+        '  # aws_eip.old will be destroyed',
+        '  # aws_instance.api will be replaced, as requested',
+        '',
+        'Plan: 3 to add, 1 to change, 3 to destroy.',
+      ].join('\n');
+
+      expect(parsePlanOutputChanges(output)).toEqual([
+        { address: 'aws_instance.web', actions: ['update'] },
+        { address: 'aws_s3_bucket.logs', actions: ['delete', 'create'] },
+        { address: 'module.app.aws_iam_role.this["a b"]', actions: ['create'] },
+        { address: 'aws_eip.old', actions: ['delete'] },
+        { address: 'aws_instance.api', actions: ['delete', 'create'] },
+      ]);
+    });
+
+    it('should return nothing for output without changes', () => {
+      expect(
+        parsePlanOutputChanges('No changes. Your infrastructure matches the configuration.')
+      ).toEqual([]);
+    });
+  });
+
+  describe('parsePlannedChanges', () => {
+    it('should list changed resources without no-ops and reads', () => {
+      const plan = JSON.stringify({
+        resource_changes: [
+          { address: 'aws_instance.web', change: { actions: ['update'] } },
+          { address: 'aws_iam_role.ci', change: { actions: ['no-op'] } },
+          { address: 'data.aws_ami.ubuntu', change: { actions: ['read'] } },
+          { address: 'aws_s3_bucket.logs', change: { actions: ['delete', 'create'] } },
+        ],
+      });
+
+      expect(parsePlannedChanges(plan)).toEqual([
+        { address: 'aws_instance.web', actions: ['update'] },
+        { address: 'aws_s3_bucket.logs', actions: ['delete', 'create'] },
+      ]);
+    });
+
+    it('should throw when the output is not a JSON object', () => {
+      expect(() => parsePlannedChanges('null')).toThrow('expected a JSON object');
+    });
+  });
+
+  describe('diffPlannedChanges', () => {
+    const web = { address: 'aws_instance.web', actions: ['update'] };
+    const logs = { address: 'aws_s3_bucket.logs', actions: ['create'] };
+
+    it('should find resources added to and removed from the plan', () => {
+      const diff = diffPlannedChanges([web], [logs]);
+
+      expect(diff).toEqual({ added: [logs], removed: [web], changed: [] });
+      expect(isEmptyPlanDiff(diff)).toBe(false);
+    });
+
+    it('should find resources planned differently', () => {
+      const replaced = { address: 'aws_instance.web', actions: ['create', 'delete'] };
+
+      expect(diffPlannedChanges([web], [replaced]).changed).toEqual([
+        { ...replaced, previousActions: ['update'] },
+      ]);
+    });
+
+    it('should treat both orders of a replacement as the same plan', () => {
+      const diff = diffPlannedChanges(
+        [{ address: 'aws_instance.web', actions: ['delete', 'create'] }],
+        [{ address: 'aws_instance.web', actions: ['create', 'delete'] }]
+      );
+
+      expect(isEmptyPlanDiff(diff)).toBe(true);
+    });
+  });
+
+  describe('countPlannedChanges', () => {
+    it('should count a replacement as an add and a destroy', () => {
+      expect(
+        countPlannedChanges([
+          { address: 'aws_instance.web', actions: ['delete', 'create'] },
+          { address: 'aws_s3_bucket.logs', actions: ['update'] },
+          { address: 'aws_iam_role.ci', actions: ['create'] },
+        ])
+      ).toEqual({ add: 2, change: 1, destroy: 1 });
+    });
+  });
+
+  describe('formatActions', () => {
+    it('should name replacements', () => {
+      expect(formatActions(['delete', 'create'])).toBe('replace');
+      expect(formatActions(['update'])).toBe('update');
+    });
+  });
+
+  describe('isNoOp', () => {
+    it('should only treat all-zero counts as no-op', () => {
+      expect(isNoOp({ add: 0, change: 0, destroy: 0 })).toBe(true);
+      expect(isNoOp({ add: 0, change: 1, destroy: 0 })).toBe(false);
+      expect(isNoOp(null)).toBe(false);
+    });
+  });
+});
@@ -0,0 +1,253 @@
+/**
+ * Parsing of resource changes from terraform output and plan JSON
+ */
+
+import type { ChangeSummary, PlannedChange, PlannedChangesDiff } from './types';
+
+/**
+ * Matches: Plan: 1 to add, 2 to change, 3 to destroy.
+ */
+const PLAN_SUMMARY_REGEX = /Plan: (\d+) to add, (\d+) to change, (\d+) to destroy/;
+
+/**
+ * Matches: Apply complete! Resources: 1 added, 2 changed, 3 destroyed.
+ */
+const APPLY_SUMMARY_REGEX = /Resources: (\d+) added, (\d+) changed, (\d+) destroyed/;
+
+/**
+ * Matches the message terraform prints when nothing would change
+ */
+const NO_CHANGES_REGEX = /No changes\. /;
+
+/**
+ * Extracts resource change counts from plan or apply output
+ *
+ * @param output - Terraform stdout
+ * @returns Change counts, or null if the output has no recognizable summary
+ *
+ * @example
+ * parseChangeSummary('Plan: 1 to add, 0 to change, 2 to destroy.')
+ * // => { add: 1, change: 0, destroy: 2 }
+ */
+export function parseChangeSummary(output: string): ChangeSummary | null {
+  const match = output.match(PLAN_SUMMARY_REGEX) ?? output.match(APPLY_SUMMARY_REGEX);
+
+  if (match) {
+    return {
+      add: Number(match[1]),
+      change: Number(match[2]),
+      destroy: Number(match[3]),
+    };
+  }
+
+  if (NO_CHANGES_REGEX.test(output)) {
+    return { add: 0, change: 0, destroy: 0 };
+  }
+
+  return null;
+}
+
+/**
+ * Finds the resources a plan would destroy
+ *
+ * @param planJson - Output of `terraform show -json` for a saved plan
+ * @returns Addresses of destroyed resources, including replacements
+ * @throws Error if the output is not a JSON plan
+ *
+ * @example
+ * parsePlannedDestroys('{"resource_changes":[{"address":"aws_instance.web","change":{"actions":["delete","create"]}}]}')
+ * // => ['aws_instance.web']
+ */
+export function parsePlannedDestroys(planJson: string): string[] {
+  return parsePlannedChanges(planJson)
+    .filter((change) => change.actions.includes('delete'))
+    .map((change) => change.address);
+}
+
+/**
+ * Finds the resources a plan would change
+ *
+ * @param planJson - Output of `terraform show -json` for a saved plan
+ * @returns Changed resources in plan order; no-op and read actions are left out
+ * @throws Error if the output is not a JSON plan
+ *
+ * @example
+ * parsePlannedChanges('{"resource_changes":[{"address":"aws_instance.web","change":{"actions":["update"]}}]}')
+ * // => [{ address: 'aws_instance.web', actions: ['update'] }]
+ */
+export function parsePlannedChanges(planJson: string): PlannedChange[] {
+  let plan: { resource_changes?: unknown };
+  try {
+    plan = JSON.parse(planJson);
+  } catch (error) {
+    throw new Error(
+      `Could not parse plan JSON: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+  if (!plan || typeof plan !== 'object') {
+    throw new Error('Could not parse plan JSON: expected a JSON object');
+  }
+
+  // A plan without changes has no resource_changes at all
+  const changes = Array.isArray(plan.resource_changes) ? plan.resource_changes : [];
+  return changes
+    .filter((rc) => Array.isArray(rc?.change?.actions))
+    .map((rc) => ({ address: String(rc.address), actions: rc.change.actions.map(String) }))
+    .filter((change) => !change.actions.every((a: string) => a === 'no-op' || a === 'read'));
+}
+
+/**
+ * Matches a resource heading of the plain text plan output, e.g.
+ * `  # aws_instance.web will be updated in-place`
+ */
+const PLAN_RESOURCE_REGEX =
+  /^\s*# (.+?) (will be created|will be destroyed|will be updated in-place|must be replaced|will be replaced)/gm;
+
+/**
+ * Actions of each resource heading of the plain text plan output
+ */
+const PLAN_RESOURCE_ACTIONS: Record<string, string[]> = {
+  'will be created': ['create'],
+  'will be destroyed': ['delete'],
+  'will be updated in-place': ['update'],
+  'must be replaced': ['delete', 'create'],
+  'will be replaced': ['delete', 'create'],
+};
+
+/**
+ * Finds the resources a plan would change from its plain text output
+ *
+ * @param output - Output of `terraform plan -no-color`
+ * @returns Changed resources in plan order, in the form parsePlannedChanges returns
+ *
+ * @remarks
+ * Used where no saved plan is available for `terraform show -json`, such as drift checks.
+ * Resources that only changed outside of terraform, without a planned action, are left out.
+ *
+ * @example
+ * parsePlanOutputChanges('  # aws_instance.web will be updated in-place')
+ * // => [{ address: 'aws_instance.web', actions: ['update'] }]
+ */
+export function parsePlanOutputChanges(output: string): PlannedChange[] {
+  return Array.from(output.matchAll(PLAN_RESOURCE_REGEX), ([, address, heading]) => ({
+    address,
+    actions: PLAN_RESOURCE_ACTIONS[heading],
+  }));
+}
+
+/**
+ * Counts planned resource changes the way terraform summarizes a plan
+ *
+ * @param changes - Planned changes from parsePlannedChanges
+ * @returns Change counts; a replacement counts as one add and one destroy
+ *
+ * @example
+ * countPlannedChanges([{ address: 'aws_instance.web', actions: ['delete', 'create'] }])
+ * // => { add: 1, change: 0, destroy: 1 }
+ */
+export function countPlannedChanges(changes: PlannedChange[]): ChangeSummary {
+  const summary: ChangeSummary = { add: 0, change: 0, destroy: 0 };
+  for (const { actions } of changes) {
+    if (actions.includes('create')) {
+      summary.add++;
+    }
+    if (actions.includes('update')) {
+      summary.change++;
+    }
+    if (actions.includes('delete')) {
+      summary.destroy++;
+    }
+  }
+  return summary;
+}
+
+/**
+ * Compares the resource changes of two plans of the same project
+ *
+ * @param previous - Changes of the earlier plan
+ * @param current - Changes of the new plan
+ * @returns Resources only in the new plan, only in the earlier one, and planned differently
+ *
+ * @example
+ * diffPlannedChanges(
+ *   [{ address: 'aws_s3_bucket.logs', actions: ['create'] }],
+ *   [{ address: 'aws_instance.web', actions: ['update'] }]
+ * )
+ * // => { added: [web], removed: [logs], changed: [] }
+ */
+export function diffPlannedChanges(
+  previous: PlannedChange[],
+  current: PlannedChange[]
+): PlannedChangesDiff {
+  const before = new Map(previous.map((change) => [change.address, change]));
+  const after = new Set(current.map((change) => change.address));
+
+  const diff: PlannedChangesDiff = { added: [], removed: [], changed: [] };
+  for (const change of current) {
+    const earlier = before.get(change.address);
+    if (!earlier) {
+      diff.added.push(change);
+    } else if (formatActions(earlier.actions) !== formatActions(change.actions)) {
+      diff.changed.push({ ...change, previousActions: earlier.actions });
+    }
+  }
+  diff.removed = previous.filter((change) => !after.has(change.address));
+  return diff;
+}
+
+/**
+ * Whether two plans would change exactly the same resources in the same way
+ */
+export function isEmptyPlanDiff(diff: PlannedChangesDiff): boolean {
+  return diff.added.length === 0 && diff.removed.length === 0 && diff.changed.length === 0;
+}
+
+/**
+ * Formats the actions of a resource change as one word
+ *
+ * @example
+ * formatActions(['delete', 'create'])
+ * // => 'replace'
+ */
+export function formatActions(actions: string[]): string {
+  // terraform plans a replacement as a delete and a create, in either order
+  if (actions.length === 2 && actions.includes('delete') && actions.includes('create')) {
+    return 'replace';
+  }
+  return actions.join(', ');
+}
+
+/**
+ * Formats change counts as a short human readable line
+ *
+ * @example
+ * formatChangeSummary({ add: 1, change: 0, destroy: 2 })
+ * // => '1 to add, 0 to change, 2 to destroy'
+ */
+export function formatChangeSummary(summary: ChangeSummary): string {
+  return `${summary.add} to add, ${summary.change} to change, ${summary.destroy} to destroy`;
+}
+
+/**
+ * Formats the change counts of a destroy plan, leading with the destroy count
+ *
+ * @example
+ * formatDestroyPreview({ add: 0, change: 0, destroy: 12 })
+ * // => '12 to destroy'
+ */
+export function formatDestroyPreview(summary: ChangeSummary): string {
+  // A destroy plan normally only destroys; anything else is worth calling out
+  if (summary.add === 0 && summary.change === 0) {
+    return `${summary.destroy} to destroy`;
+  }
+  return `${summary.destroy} to destroy (${summary.add} to add, ${summary.change} to change)`;
+}
+
+/**
+ * Whether change counts describe a run that changes nothing
+ *
+ * @param summary - Parsed change counts, or null if the output had none
+ */
+export function isNoOp(summary: ChangeSummary | null): boolean {
+  return summary !== null && summary.add === 0 && summary.change === 0 && summary.destroy === 0;
+}
@@ -0,0 +1,103 @@
+/**
+ * Unit tests for policy checks
+ */
+
+import * as path from 'node:path';
+import { checkPlanPolicies, getProjectPolicySets, isPolicyOwner } from './policy-check';
+import { executeConftest } from './terraform';
+
+// Mock the @actions modules and conftest
+jest.mock('@actions/core');
+jest.mock('./terraform', () => ({
+  ...jest.requireActual('./terraform'),
+  executeConftest: jest.fn(),
+}));
+
+describe('policy-check', () => {
+  const mockExecuteConftest = executeConftest as jest.MockedFunction<typeof executeConftest>;
+  const policies = {
+    owners: ['alice', 'Bob'],
+    policy_sets: [
+      { name: 'security', path: 'policies/security' },
+      { name: 'cost', path: 'policies/cost' },
+    ],
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+  });
+
+  describe('getProjectPolicySets', () => {
+    it('should return the named policy sets in project order', () => {
+      const project = { name: 'app', dir: 'app', policy_sets: ['cost', 'security'] };
+
+      expect(getProjectPolicySets(project, policies)).toEqual([
+        { name: 'cost', path: 'policies/cost' },
+        { name: 'security', path: 'policies/security' },
+      ]);
+    });
+
+    it('should return nothing for a project without policy_sets', () => {
+      expect(getProjectPolicySets({ name: 'app', dir: 'app' }, policies)).toEqual([]);
+    });
+  });
+
+  describe('isPolicyOwner', () => {
+    it('should match owners regardless of case', () => {
+      expect(isPolicyOwner('Alice', policies)).toBe(true);
+      expect(isPolicyOwner('bob', policies)).toBe(true);
+      expect(isPolicyOwner('mallory', policies)).toBe(false);
+      expect(isPolicyOwner('alice', undefined)).toBe(false);
+    });
+  });
+
+  describe('checkPlanPolicies', () => {
+    it('should run conftest with every policy set', async () => {
+      mockExecuteConftest.mockResolvedValue({
+        exitCode: 0,
+        stdout: '4 tests, 4 passed\n',
+        stderr: '',
+      });
+
+      const result = await checkPlanPolicies(
+        'app',
+        policies.policy_sets,
+        '/repo/app',
+        '/repo/app/tfplan-app.json'
+      );
+
+      expect(mockExecuteConftest).toHaveBeenCalledWith(
+        '/repo/app/tfplan-app.json',
+        [path.resolve('policies/security'), path.resolve('policies/cost')],
+        '/repo/app'
+      );
+      expect(result).toEqual({
+        passed: true,
+        policySets: ['security', 'cost'],
+        output: '4 tests, 4 passed',
+      });
+    });
+
+    it('should fail the check when conftest reports violations', async () => {
+      mockExecuteConftest.mockResolvedValue({
+        exitCode: 1,
+        stdout: 'FAIL - tfplan-app.json - main - public buckets are not allowed\n',
+        stderr: 'Error: running test: 1 failure\n',
+      });
+
+      const result = await checkPlanPolicies(
+        'app',
+        [policies.policy_sets[0]],
+        '/repo/app',
+        '/repo/app/tfplan-app.json'
+      );
+
+      expect(result).toEqual({
+        passed: false,
+        policySets: ['security'],
+        output:
+          'FAIL - tfplan-app.json - main - public buckets are not allowed\nError: running test: 1 failure',
+      });
+    });
+  });
+});
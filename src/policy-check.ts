@@ -0,0 +1,76 @@
+/**
+ * Policy checks of saved plans with conftest (OPA/Rego)
+ */
+
+import * as path from 'node:path';
+import * as core from '@actions/core';
+import { executeConftest } from './terraform';
+import type { PoliciesConfig, PolicyCheckResult, PolicySetConfig, ProjectConfig } from './types';
+
+/**
+ * Finds the policy sets a project's plans are checked against
+ *
+ * @param project - Project configuration
+ * @param policies - Configured policies, if any
+ * @returns Policy sets in the order the project names them (empty without policy_sets)
+ */
+export function getProjectPolicySets(
+  project: ProjectConfig,
+  policies: PoliciesConfig | undefined
+): PolicySetConfig[] {
+  return (project.policy_sets ?? []).flatMap((name) => {
+    const set = policies?.policy_sets.find((s) => s.name === name);
+    return set ? [set] : [];
+  });
+}
+
+/**
+ * Whether a GitHub login may approve failed policy checks
+ *
+ * @param login - Login of the commenter
+ * @param policies - Configured policies, if any
+ */
+export function isPolicyOwner(login: string, policies: PoliciesConfig | undefined): boolean {
+  // GitHub logins are case-insensitive
+  return (policies?.owners ?? []).some((owner) => owner.toLowerCase() === login.toLowerCase());
+}
+
+/**
+ * Checks a saved plan against policy sets
+ *
+ * @param projectName - Name of the project
+ * @param policySets - Policy sets to check against
+ * @param workingDir - Resolved project directory
+ * @param planJsonPath - Path to the output of `terraform show -json` for the plan
+ * @returns Whether every policy passed, with the conftest output
+ * @throws Error if conftest is not installed
+ *
+ * @remarks
+ * Policy set paths are resolved against the repository root (the working directory
+ * of the action). Errors in the policies themselves fail the check, like violations.
+ */
+export async function checkPlanPolicies(
+  projectName: string,
+  policySets: PolicySetConfig[],
+  workingDir: string,
+  planJsonPath: string
+): Promise<PolicyCheckResult> {
+  core.startGroup(`Checking policies for project: ${projectName}`);
+  try {
+    const { exitCode, stdout, stderr } = await executeConftest(
+      planJsonPath,
+      policySets.map((set) => path.resolve(set.path)),
+      workingDir
+    );
+    const passed = exitCode === 0;
+    core.info(passed ? 'Policy check passed' : `Policy check failed with exit code ${exitCode}`);
+
+    return {
+      passed,
+      policySets: policySets.map((set) => set.name),
+      output: [stdout.trim(), stderr.trim()].filter((text) => text !== '').join('\n'),
+    };
+  } finally {
+    core.endGroup();
+  }
+}
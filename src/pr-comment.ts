@@ -0,0 +1,1152 @@
+/**
+ * Pull Request comment posting and formatting
+ */
+
+import * as core from '@actions/core';
+import { formatCost } from './cost-estimate';
+import { getClient } from './github-client';
+import {
+  countPlannedChanges,
+  formatActions,
+  formatDestroyPreview,
+  isEmptyPlanDiff,
+} from './plan-summary';
+import { redact } from './redaction';
+import type {
+  ChangeSummary,
+  CostEstimate,
+  MergeMethod,
+  PlannedChange,
+  PlannedChangesDiff,
+  PolicyCheckResult,
+  ReactionContent,
+  SecurityScanResult,
+  SecuritySeverity,
+  TerraformOutput,
+} from './types';
+
+/**
+ * Maximum number of output lines included in a failure comment
+ */
+export const MAX_ERROR_LINES = 50;
+
+/**
+ * Maximum comment body length (GitHub rejects bodies over 65536 characters)
+ */
+export const MAX_COMMENT_LENGTH = 60000;
+
+/**
+ * Maximum number of resources listed in a plan summary comment
+ */
+export const MAX_SUMMARY_RESOURCES = 500;
+
+/**
+ * Maximum length of an output value shown in the outputs table
+ */
+export const MAX_OUTPUT_VALUE_LENGTH = 200;
+
+/**
+ * Maximum number of findings listed in a security scan comment
+ */
+export const MAX_SECURITY_FINDINGS = 200;
+
+/**
+ * Adds a reaction to a pull request comment
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param commentId - ID of the comment
+ * @param content - Reaction (e.g., eyes)
+ *
+ * @remarks
+ * Adding a reaction the token's user already left is a no-op for GitHub.
+ */
+export async function addReaction(
+  token: string,
+  owner: string,
+  repo: string,
+  commentId: number,
+  content: ReactionContent
+): Promise<void> {
+  const octokit = getClient(token);
+
+  await octokit.rest.reactions.createForIssueComment({
+    owner,
+    repo,
+    comment_id: commentId,
+    content,
+  });
+}
+
+/**
+ * Posts a comment on a pull request
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param prNumber - Pull request number
+ * @param body - Markdown comment body (secrets are masked before posting)
+ * @returns ID of the created comment
+ */
+export async function postComment(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number,
+  body: string
+): Promise<number> {
+  const octokit = getClient(token);
+
+  const { data: comment } = await octokit.rest.issues.createComment({
+    owner,
+    repo,
+    issue_number: prNumber,
+    body: redact(body),
+  });
+
+  core.info(`Posted comment ${comment.id} on PR #${prNumber}`);
+
+  return comment.id;
+}
+
+/**
+ * Updates the PR comment containing a marker, or posts a new one
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param prNumber - Pull request number
+ * @param marker - Hidden text identifying the comment (e.g., an HTML comment)
+ * @param body - Markdown comment body (must contain the marker; secrets are masked)
+ * @returns ID of the updated or created comment
+ *
+ * @remarks
+ * If several comments contain the marker, the most recent one is updated.
+ */
+export async function upsertComment(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number,
+  marker: string,
+  body: string
+): Promise<number> {
+  const existing = await findCommentByMarker(token, owner, repo, prNumber, marker);
+  if (existing) {
+    const octokit = getClient(token);
+    await octokit.rest.issues.updateComment({
+      owner,
+      repo,
+      comment_id: existing.id,
+      body: redact(body),
+    });
+    core.info(`Updated comment ${existing.id} on PR #${prNumber}`);
+    return existing.id;
+  }
+
+  return postComment(token, owner, repo, prNumber, body);
+}
+
+/**
+ * Finds the most recent PR comment containing a marker
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param prNumber - Pull request number
+ * @param marker - Hidden text identifying the comment (e.g., an HTML comment)
+ * @returns ID and body of the comment, or undefined if no comment contains the marker
+ */
+export async function findCommentByMarker(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number,
+  marker: string
+): Promise<{ id: number; body: string } | undefined> {
+  const comments = await listCommentsWithMarker(token, owner, repo, prNumber, marker);
+  const existing = comments[comments.length - 1];
+  return existing ? { id: existing.id, body: existing.body } : undefined;
+}
+
+/**
+ * Minimizes every PR comment containing a marker as outdated
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param prNumber - Pull request number
+ * @param marker - Hidden text identifying the comments (e.g., an HTML comment)
+ * @returns Number of comments minimized
+ *
+ * @remarks
+ * Uses the GraphQL minimizeComment mutation, as REST cannot hide comments.
+ * Minimizing a comment that is already hidden is a no-op for GitHub.
+ */
+export async function minimizeComments(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number,
+  marker: string
+): Promise<number> {
+  const octokit = getClient(token);
+  const comments = await listCommentsWithMarker(token, owner, repo, prNumber, marker);
+
+  for (const comment of comments) {
+    await octokit.graphql(
+      `mutation($id: ID!) {
+        minimizeComment(input: { subjectId: $id, classifier: OUTDATED }) {
+          minimizedComment { isMinimized }
+        }
+      }`,
+      { id: comment.nodeId }
+    );
+  }
+  if (comments.length > 0) {
+    core.info(`Minimized ${comments.length} outdated comment(s) on PR #${prNumber}`);
+  }
+  return comments.length;
+}
+
+/**
+ * Marks every plan comment of a pull request as outdated with a banner
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param prNumber - Pull request number
+ * @param sha - Head commit the pull request was pushed to
+ * @returns Number of comments marked
+ *
+ * @remarks
+ * Only plan comments carrying a project marker are found, and comments that already
+ * have the banner are left as they are.
+ */
+export async function markPlanCommentsOutdated(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number,
+  sha: string
+): Promise<number> {
+  const octokit = getClient(token);
+  const comments = await listCommentsWithMarker(
+    token,
+    owner,
+    repo,
+    prNumber,
+    PLAN_COMMENT_MARKER_PREFIX
+  );
+
+  let marked = 0;
+  for (const comment of comments) {
+    const body = buildOutdatedPlanComment(comment.body, sha);
+    if (body !== comment.body) {
+      await octokit.rest.issues.updateComment({
+        owner,
+        repo,
+        comment_id: comment.id,
+        body: redact(body),
+      });
+      marked++;
+    }
+  }
+  if (marked > 0) {
+    core.info(`Marked ${marked} plan comment(s) on PR #${prNumber} as outdated`);
+  }
+  return marked;
+}
+
+/**
+ * Lists the PR comments containing a marker, oldest first
+ */
+async function listCommentsWithMarker(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number,
+  marker: string
+): Promise<{ id: number; nodeId: string; body: string }[]> {
+  const octokit = getClient(token);
+
+  const comments = await octokit.paginate(octokit.rest.issues.listComments, {
+    owner,
+    repo,
+    issue_number: prNumber,
+    per_page: 100,
+  });
+
+  return comments
+    .filter((c) => c.body?.includes(marker))
+    .map((c) => ({ id: c.id, nodeId: c.node_id, body: c.body ?? '' }));
+}
+
+/**
+ * Posts a review comment anchored to a line of a file in the pull request
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param prNumber - Pull request number
+ * @param commitId - Head commit SHA the line refers to
+ * @param filePath - File path relative to the repository root
+ * @param line - Line number in the new version of the file
+ * @param body - Markdown comment body (secrets are masked before posting)
+ * @returns ID of the created review comment
+ *
+ * @remarks
+ * GitHub rejects lines that are not part of the diff, so callers should
+ * fall back to a regular comment when this throws.
+ */
+export async function postReviewComment(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number,
+  commitId: string,
+  filePath: string,
+  line: number,
+  body: string
+): Promise<number> {
+  const octokit = getClient(token);
+
+  const { data: comment } = await octokit.rest.pulls.createReviewComment({
+    owner,
+    repo,
+    pull_number: prNumber,
+    commit_id: commitId,
+    path: filePath,
+    line,
+    side: 'RIGHT',
+    body: redact(body),
+  });
+
+  core.info(`Posted review comment ${comment.id} on ${filePath}:${line}`);
+
+  return comment.id;
+}
+
+/**
+ * Keeps only the last lines of command output
+ *
+ * @param output - Full command output
+ * @param maxLines - Maximum number of lines to keep
+ * @returns Trailing lines and whether anything was dropped
+ */
+function tailLines(output: string, maxLines: number): { text: string; truncated: boolean } {
+  const lines = output.trimEnd().split('\n');
+  if (lines.length <= maxLines) {
+    return { text: lines.join('\n'), truncated: false };
+  }
+  return { text: lines.slice(-maxLines).join('\n'), truncated: true };
+}
+
+/**
+ * Builds a PR comment describing a failed terraform command
+ *
+ * @param projectName - Name of the project that failed
+ * @param command - Terraform command that failed (e.g., init, plan, apply)
+ * @param output - Captured error output
+ * @param secrets - Values that must never appear in the comment (e.g., the GitHub token)
+ * @param commandLine - Full command echoed above the output (e.g., for state commands)
+ * @returns Markdown comment body
+ *
+ * @remarks
+ * Only the last MAX_ERROR_LINES lines are included, inside a collapsible block,
+ * and the body is capped at MAX_COMMENT_LENGTH characters.
+ */
+export function buildFailureComment(
+  projectName: string,
+  command: string,
+  output: string,
+  secrets: string[] = [],
+  commandLine?: string
+): string {
+  return buildOutputComment(
+    `## ❌ terraform ${command} failed for project \`${projectName}\`` +
+      formatCommandLine(commandLine, secrets),
+    'Error output',
+    output,
+    secrets
+  );
+}
+
+/**
+ * Builds the PR comment for a project whose command was stopped because the run was cancelled
+ *
+ * @param projectName - Name of the project
+ * @param command - Command that was running (e.g., apply)
+ * @param runUrl - URL of the cancelled workflow run
+ * @returns Markdown comment body
+ */
+export function buildCancelledComment(
+  projectName: string,
+  command: string,
+  runUrl: string
+): string {
+  const lines = [
+    `## 🛑 terraform ${command} cancelled for project \`${projectName}\``,
+    '',
+    `The [workflow run](${runUrl}) was cancelled, so terraform was stopped. Stopping lets it release the state lock; if a later run still finds the state locked, release it with \`terraform force-unlock\`.`,
+  ];
+  if (command === 'apply' || command === 'destroy') {
+    lines.push(
+      '',
+      `${command === 'apply' ? 'An apply' : 'A destroy'} stopped part way may already have changed some resources. Run \`terraform plan\` to see what is left.`
+    );
+  }
+  return lines.join('\n');
+}
+
+/**
+ * Builds a PR comment describing a successful command that tfcmt does not report
+ *
+ * @param projectName - Name of the project
+ * @param command - Command that succeeded (e.g., init)
+ * @param output - Captured command output
+ * @param secrets - Values that must never appear in the comment
+ * @param commandLine - Full command echoed above the output (e.g., for state commands)
+ * @returns Markdown comment body
+ */
+export function buildSuccessComment(
+  projectName: string,
+  command: string,
+  output: string,
+  secrets: string[] = [],
+  commandLine?: string
+): string {
+  return buildOutputComment(
+    `## ✅ terraform ${command} succeeded for project \`${projectName}\`` +
+      formatCommandLine(commandLine, secrets),
+    'Output',
+    output,
+    secrets
+  );
+}
+
+/**
+ * Builds the PR comment for a plan saved for the head commit and shown instead of planning again
+ *
+ * @param projectName - Name of the project
+ * @param sha - Head commit the plan was saved for
+ * @param output - Output of terraform show for the saved plan
+ * @param secrets - Values to redact from the output
+ * @returns Markdown comment body
+ */
+export function buildReusedPlanComment(
+  projectName: string,
+  sha: string,
+  output: string,
+  secrets: string[] = []
+): string {
+  return buildOutputComment(
+    `## ♻️ Reused the plan of project \`${projectName}\` for ${sha.slice(0, 7)}\n\n` +
+      'Nothing was pushed since this commit was planned, so its saved plan is shown. ' +
+      `Comment \`terraform plan -project=${projectName} --force\` to plan again.`,
+    'Saved plan',
+    output,
+    secrets
+  );
+}
+
+/**
+ * Builds the one-line PR comment for a plan or apply without resource changes
+ *
+ * @param projectName - Name of the project
+ * @param command - Command that reported no changes (plan or apply)
+ * @returns Markdown comment body
+ */
+export function buildNoChangesComment(projectName: string, command: string): string {
+  return `✅ No changes for project \`${projectName}\` (terraform ${command})`;
+}
+
+/**
+ * Builds the PR comment for a successful destroy preview (`terraform plan -destroy`)
+ *
+ * @param projectName - Name of the project
+ * @param summary - Change counts of the destroy plan, if recognizable
+ * @returns Markdown comment body
+ */
+export function buildDestroyPreviewComment(
+  projectName: string,
+  summary: ChangeSummary | null
+): string {
+  const counts = summary
+    ? `**${formatDestroyPreview(summary)}**`
+    : 'See the plan for the resources that would be destroyed.';
+  return [
+    `## 🔥 Destroy preview for project \`${projectName}\``,
+    '',
+    counts,
+    '',
+    'This is a preview only: the plan is not saved, so `terraform apply` will not destroy anything.',
+  ].join('\n');
+}
+
+/**
+ * Prefix of the hidden snapshot of planned changes embedded in the plan changes comment
+ */
+const PLAN_SNAPSHOT_PREFIX = '<!-- terraform-action:plan-snapshot ';
+
+/**
+ * Start of the markers identifying the plan comments of every project
+ */
+const PLAN_COMMENT_MARKER_PREFIX = '<!-- terraform-action:plan:';
+
+/**
+ * Marker of plan comments made outdated by a push
+ */
+const OUTDATED_PLAN_MARKER = '<!-- terraform-action:outdated -->';
+
+/**
+ * Builds the marker identifying the plan comments of a project
+ *
+ * @param projectName - Name of the project
+ */
+export function buildPlanCommentMarker(projectName: string): string {
+  return `${PLAN_COMMENT_MARKER_PREFIX}${projectName} -->`;
+}
+
+/**
+ * Adds the outdated banner to the top of a plan comment
+ *
+ * @param body - Body of the plan comment
+ * @param sha - Head commit the pull request was pushed to
+ * @returns Body with the banner, or the body unchanged if it already has one
+ */
+export function buildOutdatedPlanComment(body: string, sha: string): string {
+  if (body.includes(OUTDATED_PLAN_MARKER)) {
+    return body;
+  }
+  const banner =
+    `> ⚠️ **Outdated — new commits pushed** (\`${sha.slice(0, 7)}\`). This plan no longer ` +
+    'matches the pull request and cannot be applied; plan again to review the latest code.';
+  return `${OUTDATED_PLAN_MARKER}\n${banner}\n\n${body}`;
+}
+
+/**
+ * Builds the comment showing the plan of a resource after it was imported
+ *
+ * @param projectName - Name of the project
+ * @param address - Address of the imported resource
+ * @param hasChanges - Whether apply would change the imported resource
+ * @param output - Output of the targeted plan
+ * @param secrets - Values that must never appear in the comment
+ * @returns Markdown comment body
+ */
+export function buildImportPlanComment(
+  projectName: string,
+  address: string,
+  hasChanges: boolean,
+  output: string,
+  secrets: string[] = []
+): string {
+  const verdict = hasChanges
+    ? '⚠️ The next apply would change the imported resource: update the configuration until this plan shows no changes.'
+    : '✅ The configuration matches the imported resource.';
+  return buildOutputComment(
+    `## 🔎 Plan of \`${address}\` after import for project \`${projectName}\`\n\n${verdict}`,
+    'Plan output',
+    output,
+    secrets
+  );
+}
+
+/**
+ * Builds the marker identifying the plan changes comment of a project
+ *
+ * @param projectName - Name of the project
+ */
+export function buildPlanChangesMarker(projectName: string): string {
+  return `<!-- terraform-action:plan-changes:${projectName} -->`;
+}
+
+/**
+ * Reads the planned changes embedded in a plan changes comment
+ *
+ * @param body - Body of a comment built by buildPlanChangesComment
+ * @returns Planned changes of that plan, or undefined if the body has no readable snapshot
+ */
+export function parsePlanSnapshot(body: string): PlannedChange[] | undefined {
+  const start = body.indexOf(PLAN_SNAPSHOT_PREFIX);
+  if (start === -1) {
+    return undefined;
+  }
+  const end = body.indexOf(' -->', start);
+  if (end === -1) {
+    return undefined;
+  }
+  try {
+    const snapshot = JSON.parse(body.slice(start + PLAN_SNAPSHOT_PREFIX.length, end));
+    return Array.isArray(snapshot) ? (snapshot as PlannedChange[]) : undefined;
+  } catch (_error) {
+    return undefined;
+  }
+}
+
+/**
+ * Builds the PR comment listing the resource changes added or dropped since the previous plan
+ *
+ * @param projectName - Name of the project
+ * @param current - Resource changes of the new plan
+ * @param diff - Difference to the previous plan, or undefined if there was none
+ * @returns Markdown comment body with the marker and a snapshot of the new plan
+ *
+ * @remarks
+ * The snapshot is what the next plan is compared against. It is left out when the plan is too
+ * large to embed, so the next plan starts over without a comparison.
+ */
+export function buildPlanChangesComment(
+  projectName: string,
+  current: PlannedChange[],
+  diff: PlannedChangesDiff | undefined
+): string {
+  const sections: string[] = [];
+  if (!diff) {
+    sections.push(
+      'No previous plan to compare with. The next plan will be compared with this one.'
+    );
+  } else if (isEmptyPlanDiff(diff)) {
+    sections.push('The plan changes the same resources as the previous plan.');
+  } else {
+    const list = (title: string, items: string[]) => {
+      if (items.length > 0) {
+        sections.push([`**${title}**`, '', ...items].join('\n'));
+      }
+    };
+    list(
+      'Newly planned',
+      diff.added.map((c) => `- \`${c.address}\` (${formatActions(c.actions)})`)
+    );
+    list(
+      'No longer planned',
+      diff.removed.map((c) => `- \`${c.address}\` (${formatActions(c.actions)})`)
+    );
+    list(
+      'Planned differently',
+      diff.changed.map(
+        (c) =>
+          `- \`${c.address}\` (${formatActions(c.previousActions)} → ${formatActions(c.actions)})`
+      )
+    );
+  }
+
+  const body = [
+    buildPlanChangesMarker(projectName),
+    `## 🆚 Changes since last plan for project \`${projectName}\``,
+    '',
+    sections.join('\n\n'),
+  ].join('\n');
+  // Escaping > keeps addresses containing --> from closing the HTML comment early
+  const snapshot = `${PLAN_SNAPSHOT_PREFIX}${JSON.stringify(current).replace(/>/g, '\\u003e')} -->`;
+  if (body.length + snapshot.length + 1 > MAX_COMMENT_LENGTH) {
+    return `${body}\n\n_This plan is too large to compare with the next one._`;
+  }
+  return `${body}\n${snapshot}`;
+}
+
+/**
+ * Builds the marker identifying the plan summary comment of a project
+ *
+ * @param projectName - Name of the project
+ */
+export function buildPlanSummaryMarker(projectName: string): string {
+  return `<!-- terraform-action:plan-summary:${projectName} -->`;
+}
+
+/**
+ * Builds the PR comment summarizing a plan from its JSON (plan_summary)
+ *
+ * @param projectName - Name of the project
+ * @param changes - Resource changes of the plan
+ * @param output - Plain text plan output, shown in a collapsible block
+ * @param secrets - Values that must never appear in the comment
+ * @returns Markdown comment body with the marker
+ *
+ * @remarks
+ * At most MAX_SUMMARY_RESOURCES resources are listed, and the plan output is cut
+ * at the end so that the body stays under MAX_COMMENT_LENGTH characters.
+ */
+export function buildPlanSummaryComment(
+  projectName: string,
+  changes: PlannedChange[],
+  output: string,
+  secrets: string[] = []
+): string {
+  const counts = countPlannedChanges(changes);
+  const sections = [
+    buildPlanSummaryMarker(projectName),
+    `## 📋 Plan summary for project \`${projectName}\``,
+    '',
+    '| ➕ Add | 🔄 Change | 🗑️ Destroy |',
+    '|-------:|----------:|-----------:|',
+    `| ${counts.add} | ${counts.change} | ${counts.destroy} |`,
+    '',
+  ];
+  if (changes.length === 0) {
+    sections.push('No resource changes.');
+  } else {
+    sections.push(
+      '| Resource | Action |',
+      '|----------|--------|',
+      ...changes
+        .slice(0, MAX_SUMMARY_RESOURCES)
+        .map((c) => `| \`${c.address}\` | ${formatActions(c.actions)} |`)
+    );
+    if (changes.length > MAX_SUMMARY_RESOURCES) {
+      sections.push('', `_…and ${changes.length - MAX_SUMMARY_RESOURCES} more resources._`);
+    }
+  }
+  const header = sections.join('\n');
+
+  const text = redact(output, secrets).trim();
+  const open = '\n\n<details><summary>Plan output</summary>\n\n```\n';
+  const close = '\n```\n\n</details>';
+  const note = '\n\n_Plan output truncated._';
+  const budget = MAX_COMMENT_LENGTH - header.length - open.length - close.length - note.length;
+  if (text === '' || budget <= 0) {
+    return header;
+  }
+  if (text.length > budget) {
+    return `${header}${open}${text.slice(0, budget)}${close}${note}`;
+  }
+  return `${header}${open}${text}${close}`;
+}
+
+/**
+ * Builds the marker identifying the policy check comment of a project
+ *
+ * @param projectName - Name of the project
+ */
+export function buildPolicyCheckMarker(projectName: string): string {
+  return `<!-- terraform-action:policy-check:${projectName} -->`;
+}
+
+/**
+ * Builds the PR comment reporting the policy check of a plan
+ *
+ * @param projectName - Name of the project
+ * @param result - Policy check result
+ * @param owners - Logins allowed to approve failed checks (mentioned when the check failed)
+ * @param approveCommand - Comment approving the check, e.g. terraform approve_policies -project=app
+ * @param secrets - Values that must never appear in the comment
+ * @returns Markdown comment body with the marker
+ */
+export function buildPolicyCheckComment(
+  projectName: string,
+  result: PolicyCheckResult,
+  owners: string[],
+  approveCommand: string,
+  secrets: string[] = []
+): string {
+  const sets = result.policySets.map((name) => `\`${name}\``).join(', ');
+  const lines = [buildPolicyCheckMarker(projectName)];
+  if (result.passed) {
+    lines.push(
+      `## ✅ Policy check passed for project \`${projectName}\``,
+      '',
+      `Policy sets: ${sets}`
+    );
+  } else {
+    const mentions = owners.map((owner) => `@${owner}`).join(', ');
+    lines.push(
+      `## ❌ Policy check failed for project \`${projectName}\``,
+      '',
+      `Policy sets: ${sets}`,
+      '',
+      `Apply is blocked until a policy owner (${mentions}) comments \`${approveCommand}\`. A new commit needs a new plan and policy check.`
+    );
+  }
+  return buildOutputComment(lines.join('\n'), 'conftest output', result.output, secrets);
+}
+
+/**
+ * Builds the PR comment for an approve_policies command
+ *
+ * @param login - Policy owner who approved
+ * @param approved - Projects whose failed policy checks were approved
+ * @returns Markdown comment body
+ */
+export function buildPolicyApprovalComment(login: string, approved: string[]): string {
+  if (approved.length === 0) {
+    return 'ℹ️ No failed policy checks to approve for the head commit of this pull request.';
+  }
+  const list = approved.map((name) => `\`${name}\``).join(', ');
+  return `✅ @${login} approved the failed policy checks of ${list}. They can now be applied.`;
+}
+
+/**
+ * Builds the marker identifying the cost estimate comment of a project
+ *
+ * @param projectName - Name of the project
+ */
+export function buildCostEstimateMarker(projectName: string): string {
+  return `<!-- terraform-action:cost-estimate:${projectName} -->`;
+}
+
+/**
+ * Builds the PR comment with the monthly cost change of a plan (infracost)
+ *
+ * @param projectName - Name of the project
+ * @param estimate - Cost estimate of the plan
+ * @param limit - Largest allowed monthly increase (infracost.max_monthly_increase), if any
+ * @returns Markdown comment body with the marker
+ */
+export function buildCostEstimateComment(
+  projectName: string,
+  estimate: CostEstimate,
+  limit?: number
+): string {
+  const { currency } = estimate;
+  const lines = [
+    buildCostEstimateMarker(projectName),
+    `## 💰 Cost estimate for project \`${projectName}\``,
+    '',
+    '| Monthly cost | Previous | New | Change |',
+    '| --- | --: | --: | --: |',
+    `| Total | ${formatCost(estimate.pastMonthlyCost, currency)} | ${formatCost(estimate.monthlyCost, currency)} | ${formatCost(estimate.diffMonthlyCost, currency, true)} |`,
+  ];
+  if (limit !== undefined) {
+    lines.push(
+      '',
+      estimate.diffMonthlyCost > limit
+        ? `❌ The increase is above the limit of ${formatCost(limit, currency)}, so the plan failed.`
+        : `Limit for the increase: ${formatCost(limit, currency)}`
+    );
+  }
+  lines.push('', '_Estimated by Infracost from the plan; usage-based costs are not included._');
+  return lines.join('\n');
+}
+
+/**
+ * Builds the marker identifying the security scan comment of a project
+ *
+ * @param projectName - Name of the project
+ */
+export function buildSecurityScanMarker(projectName: string): string {
+  return `<!-- terraform-action:security-scan:${projectName} -->`;
+}
+
+/**
+ * Builds the PR comment listing the findings of a security scan, grouped by severity
+ *
+ * @param projectName - Name of the project
+ * @param result - Security scan result (findings highest severity first)
+ * @returns Markdown comment body with the marker
+ *
+ * @remarks
+ * At most MAX_SECURITY_FINDINGS findings are listed; the counts cover all of them.
+ */
+export function buildSecurityScanComment(projectName: string, result: SecurityScanResult): string {
+  const { tool, findings, blockOn, blocking } = result;
+  const lines = [
+    buildSecurityScanMarker(projectName),
+    `## 🛡️ Security scan of project \`${projectName}\` (${tool})`,
+    '',
+  ];
+  if (findings.length === 0) {
+    lines.push('✅ No findings.');
+    return lines.join('\n');
+  }
+
+  const severities = [...new Set(findings.map((f) => f.severity))];
+  const count = (severity: SecuritySeverity) =>
+    findings.filter((f) => f.severity === severity).length;
+  lines.push(severities.map((severity) => `**${severity}**: ${count(severity)}`).join(' · '));
+  if (blockOn) {
+    lines.push(
+      '',
+      blocking > 0
+        ? `❌ ${blocking} finding(s) at or above ${blockOn}, so apply is blocked until they are fixed and the project is planned again.`
+        : `Findings at or above ${blockOn} block apply; there are none.`
+    );
+  }
+
+  const cell = (text: string) => text.replace(/\|/g, '\\|').replace(/\s*\n\s*/g, ' ');
+  const listed = findings.slice(0, MAX_SECURITY_FINDINGS);
+  for (const severity of severities) {
+    const rows = listed
+      .filter((f) => f.severity === severity)
+      .map((f) => {
+        const location = f.location ? `\`${cell(f.location)}\`` : '';
+        return `| \`${cell(f.id)}\` | ${cell(f.title)} | ${location} |`;
+      });
+    if (rows.length === 0) {
+      continue;
+    }
+    lines.push(
+      '',
+      `<details${severity === 'CRITICAL' || severity === 'HIGH' ? ' open' : ''}>`,
+      `<summary>${severity} (${count(severity)})</summary>`,
+      '',
+      '| Rule | Finding | Location |',
+      '| --- | --- | --- |',
+      ...rows,
+      '',
+      '</details>'
+    );
+  }
+  if (findings.length > MAX_SECURITY_FINDINGS) {
+    lines.push('', `_…and ${findings.length - MAX_SECURITY_FINDINGS} more findings._`);
+  }
+  return lines.join('\n');
+}
+
+/**
+ * Builds the PR comment for a pull request merged after apply (merge_after_apply)
+ *
+ * @param method - Merge method that was used
+ * @param mergeSha - SHA of the merge commit
+ * @param branchNote - What happened to the head branch, if it was to be deleted
+ * @returns Markdown comment body
+ */
+export function buildMergeComment(
+  method: MergeMethod,
+  mergeSha: string,
+  branchNote?: string
+): string {
+  const lines = [
+    '## 🔀 Merged after apply',
+    '',
+    `Every project was applied, so the pull request was merged (${method}) as ${mergeSha.slice(0, 7)}.`,
+  ];
+  if (branchNote) {
+    lines.push('', branchNote);
+  }
+  return lines.join('\n');
+}
+
+/**
+ * Builds the PR comment for a pull request that was applied but not merged (merge_after_apply)
+ *
+ * @param reason - Why the pull request was not merged
+ * @returns Markdown comment body
+ */
+export function buildMergeFailureComment(reason: string): string {
+  return [
+    '## ⚠️ Not merged after apply',
+    '',
+    'The apply succeeded, but the pull request was not merged:',
+    '',
+    '```',
+    reason,
+    '```',
+    '',
+    'Merge it manually once the problem is resolved.',
+  ].join('\n');
+}
+
+/**
+ * Builds the PR comment for a command that matched more projects than allowed
+ *
+ * @param command - Command that was requested (e.g., plan)
+ * @param projectNames - Projects the command matched
+ * @param limit - Configured max_projects_per_run
+ * @returns Markdown comment body
+ */
+export function buildProjectLimitComment(
+  command: string,
+  projectNames: string[],
+  limit: number
+): string {
+  return [
+    `## ⏸️ terraform ${command} matched too many projects`,
+    '',
+    `This command matched ${projectNames.length} projects, more than \`max_projects_per_run\` (${limit}) allows, so nothing was run.`,
+    `Name the projects to run, e.g. \`terraform ${command} -project=${projectNames.slice(0, 2).join(',')}\`, or use \`--all\` to run every project.`,
+    '',
+    '<details><summary>Matched projects</summary>',
+    '',
+    ...projectNames.map((name) => `- \`${name}\``),
+    '',
+    '</details>',
+  ].join('\n');
+}
+
+/**
+ * Builds the PR comment for a comment line with a missing or unknown command
+ *
+ * @param prefix - Prefix the line started with (e.g., terraform)
+ * @param projectFlag - Flag that selects projects (e.g., -project)
+ * @param commands - Commands that are accepted
+ * @param subcommand - Word given as the command, or undefined when it is missing
+ * @param suggestion - Known command the word most likely meant
+ * @returns Markdown comment body
+ */
+export function buildUnknownCommandComment(
+  prefix: string,
+  projectFlag: string,
+  commands: string[],
+  subcommand?: string,
+  suggestion?: string
+): string {
+  const heading =
+    subcommand === undefined
+      ? `## ❓ \`${prefix}\` needs a command`
+      : `## ❓ Unknown command \`${prefix} ${subcommand}\``;
+  const lines = [heading, ''];
+  if (suggestion) {
+    lines.push(`Did you mean \`${prefix} ${suggestion}\`?`, '');
+  }
+  lines.push(
+    `Usage: \`${prefix} <command> [${projectFlag}=<name>] [flags]\``,
+    '',
+    `Commands: ${commands.map((command) => `\`${command}\``).join(', ')}`
+  );
+  return lines.join('\n');
+}
+
+/**
+ * Marker identifying the comment listing the problems of the configuration
+ */
+export const CONFIG_ERRORS_MARKER = '<!-- terraform-action:config-errors -->';
+
+/**
+ * Builds the PR comment listing the problems found in the configuration
+ *
+ * @param configPath - Path to the configuration file
+ * @param errors - Every problem found
+ * @returns Markdown comment body with the marker
+ */
+export function buildConfigErrorComment(configPath: string, errors: string[]): string {
+  return [
+    CONFIG_ERRORS_MARKER,
+    `## ⚠️ Invalid configuration in \`${configPath}\``,
+    '',
+    'No command was run. Fix the following and comment again:',
+    '',
+    ...errors.map((error) => `- ${error}`),
+  ].join('\n');
+}
+
+/**
+ * Builds the PR comment for a state-changing command refused on a pull request from a fork
+ *
+ * @param command - Command that was requested (e.g., apply, state rm)
+ * @returns Markdown comment body
+ */
+export function buildForkRejectionComment(command: string): string {
+  return [
+    `## 🔒 terraform ${command} is not allowed on pull requests from forks`,
+    '',
+    "Commands that change state run with this repository's credentials, but the code comes from a fork, so nothing was run. `terraform plan` still works.",
+    'To change state, push the branch to this repository, or set `allow_fork_apply: true` in the configuration if fork contributors are trusted.',
+  ].join('\n');
+}
+
+/**
+ * Builds a Markdown table of terraform outputs
+ *
+ * @param outputs - Outputs by name
+ * @param secrets - Values that must never appear in the table
+ * @returns Markdown table, or an empty string when there are no outputs
+ *
+ * @remarks
+ * Sensitive values are never shown. Other values are shown as inline code,
+ * non-string values as JSON, cut to MAX_OUTPUT_VALUE_LENGTH characters.
+ *
+ * @example
+ * buildOutputsTable({ lb_dns: { sensitive: false, value: 'lb.example.com' } })
+ * // => '| Output | Value |\n| --- | --- |\n| `lb_dns` | `lb.example.com` |'
+ */
+export function buildOutputsTable(
+  outputs: Record<string, TerraformOutput>,
+  secrets: string[] = []
+): string {
+  const names = Object.keys(outputs).sort();
+  if (names.length === 0) {
+    return '';
+  }
+
+  const rows = names.map((name) => {
+    const output = outputs[name];
+    const value = output.sensitive
+      ? '_(sensitive)_'
+      : formatOutputValue(redact(stringifyOutputValue(output.value), secrets));
+    return `| \`${name}\` | ${value} |`;
+  });
+  return ['| Output | Value |', '| --- | --- |', ...rows].join('\n');
+}
+
+/**
+ * Builds the PR comment listing a project's outputs after apply
+ *
+ * @param projectName - Name of the project
+ * @param outputs - Outputs by name
+ * @param secrets - Values that must never appear in the comment
+ * @returns Markdown comment body, or undefined when there are no outputs
+ */
+export function buildOutputsComment(
+  projectName: string,
+  outputs: Record<string, TerraformOutput>,
+  secrets: string[] = []
+): string | undefined {
+  const table = buildOutputsTable(outputs, secrets);
+  return table ? `## 📤 Outputs for project \`${projectName}\`\n\n${table}` : undefined;
+}
+
+/**
+ * Converts an output value to text (strings as-is, anything else as JSON)
+ */
+function stringifyOutputValue(value: unknown): string {
+  return typeof value === 'string' ? value : (JSON.stringify(value) ?? 'null');
+}
+
+/**
+ * Formats an output value as a table cell
+ */
+function formatOutputValue(text: string): string {
+  const singleLine = text.replace(/\r?\n/g, ' ');
+  const capped =
+    singleLine.length > MAX_OUTPUT_VALUE_LENGTH
+      ? `${singleLine.slice(0, MAX_OUTPUT_VALUE_LENGTH)}…`
+      : singleLine;
+  // Pipes end the cell even inside inline code, so they are always escaped
+  const escaped = capped.replace(/\|/g, '\\|');
+  if (escaped === '') {
+    return '_(empty)_';
+  }
+  // A value containing a backtick needs a double-backtick code span
+  return escaped.includes('`') ? `\`\` ${escaped} \`\`` : `\`${escaped}\``;
+}
+
+/**
+ * Formats a command line as a code block placed below a comment header
+ *
+ * @param commandLine - Command line, or undefined for none
+ * @param secrets - Values that must never appear in the comment
+ * @returns Markdown to append to the header (empty without a command line)
+ */
+function formatCommandLine(commandLine: string | undefined, secrets: string[]): string {
+  return commandLine ? `\n\n\`\`\`\n${redact(commandLine, secrets)}\n\`\`\`` : '';
+}
+
+/**
+ * Builds a comment with a header and the tail of command output in a collapsible block
+ *
+ * @param header - Markdown placed above the output
+ * @param summary - Label of the collapsible block
+ * @param output - Captured command output
+ * @param secrets - Values that must never appear in the comment
+ * @returns Markdown body capped at MAX_COMMENT_LENGTH characters
+ */
+export function buildOutputComment(
+  header: string,
+  summary: string,
+  output: string,
+  secrets: string[]
+): string {
+  const { text, truncated } = tailLines(redact(output, secrets), MAX_ERROR_LINES);
+
+  const note = truncated ? `_Showing the last ${MAX_ERROR_LINES} lines of output._\n\n` : '';
+  const open = `<details><summary>${summary}</summary>\n\n\`\`\`\n`;
+  const close = '\n```\n\n</details>';
+
+  // Leave room for the surrounding markup when capping the output
+  const budget = MAX_COMMENT_LENGTH - header.length - note.length - open.length - close.length - 2;
+  const body = text.length > budget ? text.slice(text.length - budget) : text;
+
+  return `${header}\n\n${note}${open}${body}${close}`;
+}
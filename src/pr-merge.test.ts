@@ -0,0 +1,70 @@
+/**
+ * Unit tests for merging pull requests after apply
+ */
+
+import * as github from '@actions/github';
+import { deleteBranch, mergePullRequest } from './pr-merge';
+
+// Mock the @actions modules
+jest.mock('@actions/core');
+jest.mock('@actions/github');
+
+describe('pr-merge', () => {
+  const mockGithub = github as jest.Mocked<typeof github>;
+  const mockOctokit = {
+    rest: {
+      pulls: {
+        merge: jest.fn(),
+      },
+      git: {
+        deleteRef: jest.fn(),
+      },
+    },
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+  });
+
+  describe('mergePullRequest', () => {
+    it('should merge with the given method only while the head is unchanged', async () => {
+      mockOctokit.rest.pulls.merge.mockResolvedValueOnce({ data: { sha: 'def456' } } as any);
+
+      const sha = await mergePullRequest('token', 'owner', 'repo', 42, 'squash', 'abc123');
+
+      expect(mockOctokit.rest.pulls.merge).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        pull_number: 42,
+        merge_method: 'squash',
+        sha: 'abc123',
+      });
+      expect(sha).toBe('def456');
+    });
+
+    it('should throw when GitHub refuses the merge', async () => {
+      mockOctokit.rest.pulls.merge.mockRejectedValueOnce(
+        new Error('Head branch was modified. Review and try the merge again.')
+      );
+
+      await expect(
+        mergePullRequest('token', 'owner', 'repo', 42, 'merge', 'abc123')
+      ).rejects.toThrow('Head branch was modified');
+    });
+  });
+
+  describe('deleteBranch', () => {
+    it('should delete the branch ref', async () => {
+      mockOctokit.rest.git.deleteRef.mockResolvedValueOnce({} as any);
+
+      await deleteBranch('token', 'owner', 'repo', 'feature/network');
+
+      expect(mockOctokit.rest.git.deleteRef).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        ref: 'heads/feature/network',
+      });
+    });
+  });
+});
@@ -0,0 +1,67 @@
+/**
+ * Merging pull requests after apply (merge_after_apply)
+ */
+
+import * as core from '@actions/core';
+import { getClient } from './github-client';
+import type { MergeMethod } from './types';
+
+/**
+ * Merges a pull request
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param prNumber - Pull request number
+ * @param method - Merge method (merge, squash or rebase)
+ * @param sha - Head SHA the pull request must still have (the one that was applied)
+ * @returns SHA of the merge commit
+ * @throws Error if GitHub refuses the merge (e.g., not mergeable, or the head moved on)
+ */
+export async function mergePullRequest(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number,
+  method: MergeMethod,
+  sha: string
+): Promise<string> {
+  const octokit = getClient(token);
+
+  const { data } = await octokit.rest.pulls.merge({
+    owner,
+    repo,
+    pull_number: prNumber,
+    merge_method: method,
+    sha,
+  });
+
+  core.info(`Merged PR #${prNumber} with ${method}: ${data.sha}`);
+
+  return data.sha;
+}
+
+/**
+ * Deletes a branch of the repository
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param branch - Branch name (without refs/heads/)
+ */
+export async function deleteBranch(
+  token: string,
+  owner: string,
+  repo: string,
+  branch: string
+): Promise<void> {
+  const octokit = getClient(token);
+
+  await octokit.rest.git.deleteRef({
+    owner,
+    repo,
+    ref: `heads/${branch}`,
+  });
+
+  core.info(`Deleted branch ${branch}`);
+}
@@ -4,10 +4,18 @@
 
 import * as core from '@actions/core';
 import * as github from '@actions/github';
+import { clearApiCache } from './api-cache';
 import {
+  getChangedFiles,
+  getMergedPullRequest,
   getPullRequestInfo,
+  isMergeEvent,
+  isCheckRunRerequest,
+  isPullRequestPush,
   validateRequirements,
   validateEventType,
+  validateLabelRequirements,
+  isDriftEvent,
   getPRNumberFromContext,
   getCommentBodyFromContext,
 } from './pr-validation';
@@ -23,6 +31,7 @@ describe('pr-validation', () => {
 
   beforeEach(() => {
     jest.clearAllMocks();
+    clearApiCache();
   });
 
   describe('getPullRequestInfo', () => {
@@ -45,9 +54,11 @@ describe('pr-validation', () => {
           number: 123,
           head: {
             sha: 'abc123',
+            ref: 'feature',
             repo: { id: 1, fork: false },
           },
           base: {
+            ref: 'main',
             repo: { id: 1 },
           },
           mergeable: true,
@@ -71,11 +82,67 @@ describe('pr-validation', () => {
         repo: 'repo',
         isFork: false,
         mergeable: true,
+        mergeability: 'mergeable',
         approved: true,
         sha: 'abc123',
+        diverged: false,
+        labels: [],
+        headBranch: 'feature',
+        baseBranch: 'main',
+        approvers: ['reviewer1'],
       });
     });
 
+    it('should collect PR label names', async () => {
+      mockOctokit.rest.pulls.get.mockResolvedValue({
+        data: {
+          number: 123,
+          head: {
+            sha: 'abc123',
+            repo: { id: 1, fork: false },
+          },
+          base: {
+            repo: { id: 1 },
+          },
+          mergeable: true,
+          labels: [{ name: 'terraform-approved' }, { name: 'infra' }],
+        },
+      } as any);
+
+      mockOctokit.rest.pulls.listReviews.mockResolvedValue({
+        data: [],
+      } as any);
+
+      const result = await getPullRequestInfo('token', 'owner', 'repo', 123);
+
+      expect(result.labels).toEqual(['terraform-approved', 'infra']);
+    });
+
+    it('should detect PRs that are behind the base branch', async () => {
+      mockOctokit.rest.pulls.get.mockResolvedValue({
+        data: {
+          number: 123,
+          head: {
+            sha: 'abc123',
+            repo: { id: 1, fork: false },
+          },
+          base: {
+            repo: { id: 1 },
+          },
+          mergeable: true,
+          mergeable_state: 'behind',
+        },
+      } as any);
+
+      mockOctokit.rest.pulls.listReviews.mockResolvedValue({
+        data: [],
+      } as any);
+
+      const result = await getPullRequestInfo('token', 'owner', 'repo', 123);
+
+      expect(result.diverged).toBe(true);
+    });
+
     it('should detect fork PRs', async () => {
       mockOctokit.rest.pulls.get.mockResolvedValue({
         data: {
@@ -124,6 +191,54 @@ describe('pr-validation', () => {
       expect(result.isFork).toBe(true);
     });
 
+    it('should not treat a same-repository PR in a forked repository as a fork PR', async () => {
+      mockOctokit.rest.pulls.get.mockResolvedValue({
+        data: {
+          number: 123,
+          head: {
+            sha: 'abc123',
+            repo: { id: 1, fork: true },
+          },
+          base: {
+            repo: { id: 1 },
+          },
+          mergeable: true,
+        },
+      } as any);
+
+      mockOctokit.rest.pulls.listReviews.mockResolvedValue({
+        data: [],
+      } as any);
+
+      const result = await getPullRequestInfo('token', 'owner', 'repo', 123);
+
+      expect(result.isFork).toBe(false);
+    });
+
+    it('should treat a PR whose fork was deleted as a fork PR', async () => {
+      mockOctokit.rest.pulls.get.mockResolvedValue({
+        data: {
+          number: 123,
+          head: {
+            sha: 'abc123',
+            repo: null,
+          },
+          base: {
+            repo: { id: 1 },
+          },
+          mergeable: true,
+        },
+      } as any);
+
+      mockOctokit.rest.pulls.listReviews.mockResolvedValue({
+        data: [],
+      } as any);
+
+      const result = await getPullRequestInfo('token', 'owner', 'repo', 123);
+
+      expect(result.isFork).toBe(true);
+    });
+
     it('should handle null mergeable status', async () => {
       mockOctokit.rest.pulls.get.mockResolvedValue({
         data: {
@@ -143,9 +258,36 @@ describe('pr-validation', () => {
         data: [],
       } as any);
 
-      const result = await getPullRequestInfo('token', 'owner', 'repo', 123);
+      const result = await getPullRequestInfo('token', 'owner', 'repo', 123, [0, 0]);
 
       expect(result.mergeable).toBe(false);
+      expect(result.mergeability).toBe('unknown');
+      expect(mockOctokit.rest.pulls.get).toHaveBeenCalledTimes(3);
+    });
+
+    it('should re-fetch until mergeability is computed', async () => {
+      const pr = {
+        number: 123,
+        head: {
+          sha: 'abc123',
+          repo: { id: 1, fork: false },
+        },
+        base: {
+          repo: { id: 1 },
+        },
+      };
+      mockOctokit.rest.pulls.get
+        .mockResolvedValueOnce({ data: { ...pr, mergeable: null } } as any)
+        .mockResolvedValueOnce({ data: { ...pr, mergeable: false } } as any);
+
+      mockOctokit.rest.pulls.listReviews.mockResolvedValue({
+        data: [],
+      } as any);
+
+      const result = await getPullRequestInfo('token', 'owner', 'repo', 123, [0, 0]);
+
+      expect(result.mergeability).toBe('not_mergeable');
+      expect(mockOctokit.rest.pulls.get).toHaveBeenCalledTimes(2);
     });
 
     it('should detect approved PRs with single approval', async () => {
@@ -294,6 +436,222 @@ describe('pr-validation', () => {
         'PR #123 status: isFork=false, mergeable=true, approved=false'
       );
     });
+
+    it('should reuse the cached result for repeated lookups of the same PR', async () => {
+      mockOctokit.rest.pulls.get.mockResolvedValue({
+        data: {
+          head: { sha: 'abc123', repo: { id: 1, fork: false } },
+          base: { repo: { id: 1 } },
+          mergeable: true,
+        },
+      } as any);
+      mockOctokit.rest.pulls.listReviews.mockResolvedValue({ data: [] } as any);
+
+      const [first, second] = await Promise.all([
+        getPullRequestInfo('token', 'owner', 'repo', 123),
+        getPullRequestInfo('token', 'owner', 'repo', 123),
+      ]);
+      const sha = await getPullRequestInfo('token', 'owner', 'repo', 123, []);
+      await getPullRequestInfo('token', 'owner', 'repo', 124);
+
+      expect(second).toBe(first);
+      expect(sha).toBe(first);
+      expect(mockOctokit.rest.pulls.get).toHaveBeenCalledTimes(2);
+      expect(mockOctokit.rest.pulls.listReviews).toHaveBeenCalledTimes(2);
+    });
+
+    it('should wait for mergeability even if a lookup without retries is cached', async () => {
+      mockOctokit.rest.pulls.get
+        .mockResolvedValueOnce({
+          data: {
+            head: { sha: 'abc123', repo: { id: 1, fork: false } },
+            base: { repo: { id: 1 } },
+            mergeable: null,
+          },
+        } as any)
+        .mockResolvedValue({
+          data: {
+            head: { sha: 'abc123', repo: { id: 1, fork: false } },
+            base: { repo: { id: 1 } },
+            mergeable: true,
+          },
+        } as any);
+      mockOctokit.rest.pulls.listReviews.mockResolvedValue({ data: [] } as any);
+
+      const quick = await getPullRequestInfo('token', 'owner', 'repo', 123, []);
+      const settled = await getPullRequestInfo('token', 'owner', 'repo', 123, [0]);
+
+      expect(quick.mergeability).toBe('unknown');
+      expect(settled.mergeability).toBe('mergeable');
+    });
+  });
+
+  describe('getChangedFiles', () => {
+    const mockOctokit = {
+      paginate: jest.fn(),
+      rest: {
+        pulls: {
+          listFiles: jest.fn(),
+        },
+      },
+    };
+
+    beforeEach(() => {
+      mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+    });
+
+    it('should list changed paths including the old path of renamed files', async () => {
+      mockOctokit.paginate.mockResolvedValue([
+        { filename: 'terraform/prod/main.tf' },
+        { filename: 'terraform/prod/vars.tf', previous_filename: 'terraform/prod/variables.tf' },
+      ]);
+
+      const files = await getChangedFiles('token', 'owner', 'repo', 123);
+      await getChangedFiles('token', 'owner', 'repo', 123);
+
+      expect(files).toEqual([
+        'terraform/prod/main.tf',
+        'terraform/prod/vars.tf',
+        'terraform/prod/variables.tf',
+      ]);
+      expect(mockOctokit.paginate).toHaveBeenCalledTimes(1);
+      expect(mockOctokit.paginate).toHaveBeenCalledWith(mockOctokit.rest.pulls.listFiles, {
+        owner: 'owner',
+        repo: 'repo',
+        pull_number: 123,
+        per_page: 100,
+      });
+    });
+  });
+
+  describe('isMergeEvent', () => {
+    const context = (eventName: string, payload: object) =>
+      ({ eventName, payload }) as unknown as typeof github.context;
+
+    const push = (ref: string) =>
+      ({
+        eventName: 'push',
+        ref,
+        payload: { repository: { default_branch: 'main' } },
+      }) as unknown as typeof github.context;
+
+    it('should be true for pushes to the default branch and merged pull requests', () => {
+      expect(isMergeEvent(push('refs/heads/main'))).toBe(true);
+      expect(
+        isMergeEvent(context('pull_request', { action: 'closed', pull_request: { merged: true } }))
+      ).toBe(true);
+    });
+
+    it('should be false for pushes to other branches', () => {
+      expect(isMergeEvent(push('refs/heads/feature'))).toBe(false);
+      expect(isMergeEvent(push('refs/tags/main'))).toBe(false);
+    });
+
+    it('should be false for pull requests that are open or closed without merging', () => {
+      expect(
+        isMergeEvent(context('pull_request', { action: 'synchronize', pull_request: {} }))
+      ).toBe(false);
+      expect(
+        isMergeEvent(context('pull_request', { action: 'closed', pull_request: { merged: false } }))
+      ).toBe(false);
+    });
+  });
+
+  describe('isPullRequestPush', () => {
+    const context = (eventName: string, payload: object) =>
+      ({ eventName, payload }) as unknown as typeof github.context;
+
+    it('should be true only for pull requests pushed to', () => {
+      expect(isPullRequestPush(context('pull_request', { action: 'synchronize' }))).toBe(true);
+      expect(isPullRequestPush(context('pull_request', { action: 'opened' }))).toBe(false);
+      expect(isPullRequestPush(context('push', {}))).toBe(false);
+    });
+  });
+
+  describe('isCheckRunRerequest', () => {
+    const context = (eventName: string, payload: object) =>
+      ({ eventName, payload }) as unknown as typeof github.context;
+
+    it('should be true only for re-requested check runs', () => {
+      expect(isCheckRunRerequest(context('check_run', { action: 'rerequested' }))).toBe(true);
+      expect(isCheckRunRerequest(context('check_run', { action: 'completed' }))).toBe(false);
+      expect(isCheckRunRerequest(context('pull_request', { action: 'rerequested' }))).toBe(false);
+    });
+  });
+
+  describe('getMergedPullRequest', () => {
+    const mockOctokit = {
+      rest: {
+        repos: {
+          listPullRequestsAssociatedWithCommit: jest.fn(),
+        },
+      },
+    };
+
+    beforeEach(() => {
+      mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+    });
+
+    it('should read a merged pull request from the event payload', async () => {
+      const context = {
+        eventName: 'pull_request',
+        payload: {
+          action: 'closed',
+          pull_request: { number: 42, merged: true, head: { sha: 'abc' }, base: { ref: 'main' } },
+        },
+      } as unknown as typeof github.context;
+
+      await expect(getMergedPullRequest('token', context)).resolves.toEqual({
+        number: 42,
+        headSha: 'abc',
+        baseRef: 'main',
+      });
+      expect(mockOctokit.rest.repos.listPullRequestsAssociatedWithCommit).not.toHaveBeenCalled();
+    });
+
+    it('should find the pull request a push merged', async () => {
+      mockOctokit.rest.repos.listPullRequestsAssociatedWithCommit.mockResolvedValue({
+        data: [
+          { number: 41, merged_at: null, merge_commit_sha: 'other', head: { sha: 'def' } },
+          {
+            number: 42,
+            merged_at: '2024-01-01T00:00:00Z',
+            merge_commit_sha: 'm42',
+            head: { sha: 'abc' },
+            base: { ref: 'release' },
+          },
+        ],
+      });
+      const context = {
+        eventName: 'push',
+        payload: {},
+        sha: 'm42',
+        repo: { owner: 'owner', repo: 'repo' },
+      } as unknown as typeof github.context;
+
+      await expect(getMergedPullRequest('token', context)).resolves.toEqual({
+        number: 42,
+        headSha: 'abc',
+        baseRef: 'release',
+      });
+      expect(mockOctokit.rest.repos.listPullRequestsAssociatedWithCommit).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        commit_sha: 'm42',
+      });
+    });
+
+    it('should return null for a push that merged no pull request', async () => {
+      mockOctokit.rest.repos.listPullRequestsAssociatedWithCommit.mockResolvedValue({ data: [] });
+      const context = {
+        eventName: 'push',
+        payload: {},
+        sha: 'direct',
+        repo: { owner: 'owner', repo: 'repo' },
+      } as unknown as typeof github.context;
+
+      await expect(getMergedPullRequest('token', context)).resolves.toBeNull();
+    });
   });
 
   describe('validateRequirements', () => {
@@ -303,8 +661,14 @@ describe('pr-validation', () => {
       repo: 'repo',
       isFork: false,
       mergeable: true,
+      mergeability: 'mergeable',
       approved: true,
       sha: 'abc123',
+      diverged: false,
+      labels: [],
+      headBranch: 'feature',
+      baseBranch: 'main',
+      approvers: [],
       ...overrides,
     });
 
@@ -369,6 +733,111 @@ describe('pr-validation', () => {
     });
   });
 
+  describe('validateRequirements with expressions', () => {
+    const createMockPR = (overrides?: Partial<PullRequestInfo>): PullRequestInfo => ({
+      number: 123,
+      owner: 'owner',
+      repo: 'repo',
+      isFork: false,
+      mergeable: true,
+      mergeability: 'mergeable',
+      approved: false,
+      sha: 'abc123',
+      diverged: false,
+      labels: [],
+      headBranch: 'feature',
+      baseBranch: 'main',
+      approvers: [],
+      ...overrides,
+    });
+
+    it('should pass an OR requirement when one alternative holds', () => {
+      const pr = createMockPR({ labels: ['fast-track'] });
+
+      expect(() => {
+        validateRequirements(pr, ['mergeable', 'approved|label:fast-track']);
+      }).not.toThrow();
+    });
+
+    it('should explain which alternatives failed', () => {
+      const pr = createMockPR();
+
+      expect(() => {
+        validateRequirements(pr, ['approved|label:fast-track']);
+      }).toThrow(
+        "approved|label:fast-track: none of the alternatives hold (PR is not approved; PR does not have label 'fast-track')"
+      );
+    });
+
+    it('should reject a negated requirement that holds', () => {
+      const pr = createMockPR({ diverged: true });
+
+      expect(() => {
+        validateRequirements(pr, ['!diverged']);
+      }).toThrow('!diverged: PR is behind its base branch (update the branch)');
+    });
+  });
+
+  describe('validateRequirements with unknown mergeability', () => {
+    it('should explain that mergeability is still being computed', () => {
+      const pr: PullRequestInfo = {
+        number: 123,
+        owner: 'owner',
+        repo: 'repo',
+        isFork: false,
+        mergeable: false,
+        mergeability: 'unknown',
+        approved: true,
+        sha: 'abc123',
+        diverged: false,
+        labels: [],
+        headBranch: 'feature',
+        baseBranch: 'main',
+        approvers: [],
+      };
+
+      expect(() => {
+        validateRequirements(pr, ['mergeable']);
+      }).toThrow('PR mergeability is still being computed by GitHub; retry the command shortly');
+    });
+  });
+
+  describe('validateLabelRequirements', () => {
+    const createMockPR = (labels: string[]): PullRequestInfo => ({
+      number: 123,
+      owner: 'owner',
+      repo: 'repo',
+      isFork: false,
+      mergeable: true,
+      mergeability: 'mergeable',
+      approved: true,
+      sha: 'abc123',
+      diverged: false,
+      labels,
+      headBranch: 'feature',
+      baseBranch: 'main',
+      approvers: [],
+    });
+
+    it('should pass when required labels are present and forbidden ones are absent', () => {
+      expect(() => {
+        validateLabelRequirements(createMockPR(['terraform-approved']), ['terraform-approved'], [
+          'do-not-merge',
+        ]);
+      }).not.toThrow();
+    });
+
+    it('should report missing and forbidden labels together', () => {
+      const pr = createMockPR(['do-not-merge']);
+
+      expect(() => {
+        validateLabelRequirements(pr, ['terraform-approved'], ['do-not-merge']);
+      }).toThrow(
+        "PR label requirements not met:\n  - PR is missing required label 'terraform-approved'\n  - PR has forbidden label 'do-not-merge'"
+      );
+    });
+  });
+
   describe('validateEventType', () => {
     it('should pass for issue_comment event', () => {
       expect(() => {
@@ -382,19 +851,39 @@ describe('pr-validation', () => {
       }).not.toThrow();
     });
 
+    it('should pass for check_run event', () => {
+      expect(() => {
+        validateEventType('check_run');
+      }).not.toThrow();
+    });
+
     it('should throw for other event types', () => {
       expect(() => {
-        validateEventType('push');
-      }).toThrow('This action is designed for issue_comment or pull_request events');
+        validateEventType('release');
+      }).toThrow(
+        'This action is designed for issue_comment, pull_request, push, check_run, schedule or workflow_dispatch events'
+      );
       expect(() => {
-        validateEventType('push');
-      }).toThrow('but was triggered by: push');
+        validateEventType('release');
+      }).toThrow('but was triggered by: release');
     });
 
-    it('should throw for workflow_dispatch event', () => {
+    it.each(['push', 'schedule', 'workflow_dispatch'])('should pass for %s event', (eventName) => {
       expect(() => {
-        validateEventType('workflow_dispatch');
-      }).toThrow('This action is designed for issue_comment or pull_request events');
+        validateEventType(eventName);
+      }).not.toThrow();
+    });
+  });
+
+  describe('isDriftEvent', () => {
+    it('should be true for scheduled and dispatched runs', () => {
+      expect(isDriftEvent('schedule')).toBe(true);
+      expect(isDriftEvent('workflow_dispatch')).toBe(true);
+    });
+
+    it('should be false for PR events', () => {
+      expect(isDriftEvent('issue_comment')).toBe(false);
+      expect(isDriftEvent('pull_request')).toBe(false);
     });
   });
 
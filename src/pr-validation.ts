@@ -4,7 +4,15 @@
 
 import * as core from '@actions/core';
 import * as github from '@actions/github';
-import type { PullRequestInfo, Requirement } from './types';
+import { memoize, peek } from './api-cache';
+import { getClient } from './github-client';
+import { findUnmetRequirements } from './requirements';
+import type { Mergeability, MergedPullRequest, PullRequestInfo, Requirement } from './types';
+
+/**
+ * Delays between re-fetches while GitHub is still computing mergeability
+ */
+export const MERGEABLE_RETRY_DELAYS_MS = [1000, 2000, 4000];
 
 /**
  * Fetches pull request information from GitHub API
@@ -13,31 +21,89 @@ import type { PullRequestInfo, Requirement } from './types';
  * @param owner - Repository owner
  * @param repo - Repository name
  * @param prNumber - Pull request number
+ * @param retryDelaysMs - Delays between re-fetches while mergeability is unknown
  * @returns Pull request information
+ *
+ * @remarks
+ * GitHub returns `mergeable: null` until it has computed mergeability in the
+ * background, so the PR is re-fetched with backoff. If it is still unknown
+ * afterwards, `mergeability` is 'unknown' rather than 'not_mergeable'.
+ *
+ * Results are cached for the rest of the run, so repeated lookups of the same
+ * PR (head SHA, labels, reviews) only hit the API once. A lookup that waited
+ * for mergeability also serves callers that pass no retry delays.
  */
 export async function getPullRequestInfo(
   token: string,
   owner: string,
   repo: string,
-  prNumber: number
+  prNumber: number,
+  retryDelaysMs: number[] = MERGEABLE_RETRY_DELAYS_MS
 ): Promise<PullRequestInfo> {
-  const octokit = github.getOctokit(token);
+  const key = `pulls/${owner}/${repo}/${prNumber}`;
+  const waited = `${key}:waited`;
+
+  if (retryDelaysMs.length === 0) {
+    const cached = peek<PullRequestInfo>(waited);
+    if (cached) {
+      return cached;
+    }
+  }
+
+  return memoize(retryDelaysMs.length > 0 ? waited : key, () =>
+    fetchPullRequestInfo(token, owner, repo, prNumber, retryDelaysMs)
+  );
+}
+
+/**
+ * Fetches pull request details and reviews, bypassing the cache
+ */
+async function fetchPullRequestInfo(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number,
+  retryDelaysMs: number[]
+): Promise<PullRequestInfo> {
+  const octokit = getClient(token);
 
   core.info(`Fetching PR #${prNumber} information...`);
 
   // Fetch PR details
-  const { data: pr } = await octokit.rest.pulls.get({
+  let { data: pr } = await octokit.rest.pulls.get({
     owner,
     repo,
     pull_number: prNumber,
   });
 
-  // Check if PR is from a fork
-  const isFork = pr.head.repo?.fork || pr.head.repo?.id !== pr.base.repo.id;
+  for (const delay of retryDelaysMs) {
+    if (pr.mergeable !== null) {
+      break;
+    }
+    core.info(`Mergeability of PR #${prNumber} is still being computed, retrying in ${delay}ms`);
+    await sleep(delay);
+    ({ data: pr } = await octokit.rest.pulls.get({
+      owner,
+      repo,
+      pull_number: prNumber,
+    }));
+  }
+
+  // Check if PR is from a fork: the head repository differs from the base one
+  // (it is null once the fork was deleted). head.repo.fork alone is not enough,
+  // as it is also set for PRs within a repository that is itself a fork
+  const isFork = !pr.head.repo || pr.head.repo.id !== pr.base.repo.id;
 
   // Get mergeable status
+  const mergeability: Mergeability =
+    pr.mergeable === null ? 'unknown' : pr.mergeable ? 'mergeable' : 'not_mergeable';
   const mergeable = pr.mergeable ?? false;
 
+  // GitHub reports 'behind' when the base branch has commits the PR branch lacks
+  const diverged = pr.mergeable_state === 'behind';
+
+  const labels = (pr.labels ?? []).map((label) => label.name);
+
   // Fetch reviews to check approval status
   const { data: reviews } = await octokit.rest.pulls.listReviews({
     owner,
@@ -62,6 +128,9 @@ export async function getPullRequestInfo(
   );
 
   const approved = hasApproval && !hasChangesRequested;
+  const approvers = Array.from(latestReviewsByUser.entries())
+    .filter(([, state]) => state === 'APPROVED')
+    .map(([login]) => login);
 
   core.info(
     `PR #${prNumber} status: isFork=${isFork}, mergeable=${mergeable}, approved=${approved}`
@@ -73,56 +142,217 @@ export async function getPullRequestInfo(
     repo,
     isFork,
     mergeable,
+    mergeability,
     approved,
     sha: pr.head.sha,
+    diverged,
+    labels,
+    headBranch: pr.head.ref,
+    baseBranch: pr.base.ref,
+    approvers,
   };
 }
 
+/**
+ * Lists the files changed by a pull request
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param prNumber - Pull request number
+ * @returns Changed file paths, including the previous path of renamed files
+ *
+ * @remarks
+ * Results are cached for the rest of the run.
+ */
+export function getChangedFiles(
+  token: string,
+  owner: string,
+  repo: string,
+  prNumber: number
+): Promise<string[]> {
+  return memoize(`files/${owner}/${repo}/${prNumber}`, async () => {
+    const octokit = getClient(token);
+    const files = await octokit.paginate(octokit.rest.pulls.listFiles, {
+      owner,
+      repo,
+      pull_number: prNumber,
+      per_page: 100,
+    });
+
+    const paths: string[] = [];
+    for (const file of files) {
+      paths.push(file.filename);
+      if (file.previous_filename) {
+        paths.push(file.previous_filename);
+      }
+    }
+    return paths;
+  });
+}
+
+/**
+ * Whether the event may have merged a pull request into the default branch: a push to
+ * it, or a pull request closed by merging it
+ *
+ * @param context - GitHub context
+ */
+export function isMergeEvent(context: typeof github.context): boolean {
+  const defaultBranch = context.payload.repository?.default_branch;
+  if (context.eventName === 'push') {
+    return defaultBranch !== undefined && context.ref === `refs/heads/${defaultBranch}`;
+  }
+  return (
+    context.eventName === 'pull_request' &&
+    context.payload.action === 'closed' &&
+    context.payload.pull_request?.merged === true
+  );
+}
+
+/**
+ * Whether the event pushed new commits to a pull request (the synchronize action)
+ *
+ * @param context - GitHub context
+ */
+export function isPullRequestPush(context: typeof github.context): boolean {
+  return context.eventName === 'pull_request' && context.payload.action === 'synchronize';
+}
+
+/**
+ * Whether the event re-requested a check run (the Re-run button of a check)
+ *
+ * @param context - GitHub context
+ */
+export function isCheckRunRerequest(context: typeof github.context): boolean {
+  return context.eventName === 'check_run' && context.payload.action === 'rerequested';
+}
+
+/**
+ * Finds the pull request a merge event merged
+ *
+ * @param token - GitHub token for API access
+ * @param context - GitHub context of a merge event (see isMergeEvent)
+ * @returns The merged pull request, or null if the push did not merge one
+ *
+ * @remarks
+ * A push is matched to the pull request whose merge commit it pushed, so pushes made
+ * directly to the branch find nothing. The caller checks that the pull request was merged
+ * into the default branch, as pull requests merged into other branches are not applied.
+ */
+export async function getMergedPullRequest(
+  token: string,
+  context: typeof github.context
+): Promise<MergedPullRequest | null> {
+  const payloadPr = context.payload.pull_request;
+  if (context.eventName === 'pull_request') {
+    return payloadPr?.merged === true
+      ? { number: payloadPr.number, headSha: payloadPr.head.sha, baseRef: payloadPr.base.ref }
+      : null;
+  }
+
+  const octokit = getClient(token);
+  const { data } = await octokit.rest.repos.listPullRequestsAssociatedWithCommit({
+    owner: context.repo.owner,
+    repo: context.repo.repo,
+    commit_sha: context.sha,
+  });
+  const merged = data.find((pr) => pr.merged_at && pr.merge_commit_sha === context.sha);
+  return merged
+    ? { number: merged.number, headSha: merged.head.sha, baseRef: merged.base.ref }
+    : null;
+}
+
+/**
+ * Waits for the given number of milliseconds
+ */
+function sleep(ms: number): Promise<void> {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
+
 /**
  * Validates PR against requirements
  *
  * @param pr - Pull request information
- * @param requirements - Array of requirements to validate
- * @throws Error if any requirement is not met
+ * @param requirements - Requirement expressions to validate (combined with AND)
+ * @throws Error if any requirement is not met, explaining which sub-condition failed
  */
 export function validateRequirements(pr: PullRequestInfo, requirements: Requirement[]): void {
+  const failures = findUnmetRequirements(requirements, pr);
+
+  if (failures.length > 0) {
+    throw new Error(`PR requirements not met:\n${failures.map((f) => `  - ${f}`).join('\n')}`);
+  }
+}
+
+/**
+ * Validates PR labels against required and forbidden labels
+ *
+ * @param pr - Pull request information
+ * @param requiredLabels - Labels that must be present
+ * @param forbiddenLabels - Labels that must not be present
+ * @throws Error listing every missing or forbidden label
+ */
+export function validateLabelRequirements(
+  pr: PullRequestInfo,
+  requiredLabels: string[],
+  forbiddenLabels: string[]
+): void {
+  const present = new Set(pr.labels);
   const failures: string[] = [];
 
-  for (const requirement of requirements) {
-    switch (requirement) {
-      case 'mergeable':
-        if (!pr.mergeable) {
-          failures.push('PR is not mergeable (conflicts or failing checks)');
-        }
-        break;
-
-      case 'approved':
-        if (!pr.approved) {
-          failures.push('PR is not approved');
-        }
-        break;
+  for (const label of requiredLabels) {
+    if (!present.has(label)) {
+      failures.push(`PR is missing required label '${label}'`);
+    }
+  }
+  for (const label of forbiddenLabels) {
+    if (present.has(label)) {
+      failures.push(`PR has forbidden label '${label}'`);
     }
   }
 
   if (failures.length > 0) {
-    throw new Error(`PR requirements not met:\n${failures.map((f) => `  - ${f}`).join('\n')}`);
+    throw new Error(
+      `PR label requirements not met:\n${failures.map((f) => `  - ${f}`).join('\n')}`
+    );
   }
 }
 
 /**
- * Validates that the event is an issue_comment event
+ * Events that run drift detection instead of a PR-driven command
+ */
+const DRIFT_EVENTS = ['schedule', 'workflow_dispatch'];
+
+/**
+ * Validates that the event is one the action supports
  *
  * @param eventName - GitHub event name
- * @throws Error if event is not issue_comment
+ * @throws Error if event is not issue_comment, pull_request, push, check_run, schedule or
+ *   workflow_dispatch
  */
 export function validateEventType(eventName: string): void {
-  if (eventName !== 'issue_comment' && eventName !== 'pull_request') {
+  if (
+    eventName !== 'issue_comment' &&
+    eventName !== 'pull_request' &&
+    eventName !== 'push' &&
+    eventName !== 'check_run' &&
+    !isDriftEvent(eventName)
+  ) {
     throw new Error(
-      `This action is designed for issue_comment or pull_request events, but was triggered by: ${eventName}`
+      `This action is designed for issue_comment, pull_request, push, check_run, schedule or workflow_dispatch events, but was triggered by: ${eventName}`
     );
   }
 }
 
+/**
+ * Whether the event runs drift detection (scheduled or manually dispatched, without a PR)
+ *
+ * @param eventName - GitHub event name
+ */
+export function isDriftEvent(eventName: string): boolean {
+  return DRIFT_EVENTS.includes(eventName);
+}
+
 /**
  * Extracts PR number from the GitHub context
  *
@@ -0,0 +1,268 @@
+/**
+ * Unit tests for project locks
+ */
+
+import * as core from '@actions/core';
+import * as github from '@actions/github';
+import {
+  acquireProjectLock,
+  buildLockCommitMessage,
+  buildLockRef,
+  type LockHolder,
+  parseLockCommitMessage,
+  releaseProjectLock,
+} from './project-lock';
+
+jest.mock('@actions/core');
+jest.mock('@actions/github', () => ({
+  context: {
+    sha: 'fedcba9876543210fedc',
+    serverUrl: 'https://github.com',
+    repo: { owner: 'acme', repo: 'infra' },
+  },
+  getOctokit: jest.fn(),
+}));
+
+describe('project-lock', () => {
+  const mockCore = core as jest.Mocked<typeof core>;
+  const mockGithub = github as jest.Mocked<typeof github>;
+  const mockOctokit = {
+    rest: {
+      actions: {
+        getWorkflowRun: jest.fn(),
+      },
+      git: {
+        createCommit: jest.fn(),
+        createRef: jest.fn(),
+        deleteRef: jest.fn(),
+        getCommit: jest.fn(),
+        getRef: jest.fn(),
+        updateRef: jest.fn(),
+      },
+    },
+  };
+
+  const holder: LockHolder = {
+    runId: 100,
+    runAttempt: 1,
+    project: 'staging',
+    command: 'apply',
+    prNumber: 42,
+    lockedAt: '2026-10-16T00:00:00.000Z',
+  };
+  const other: LockHolder = { ...holder, runId: 7, prNumber: 12 };
+
+  /**
+   * Error GitHub raises for a ref that already exists or cannot be fast-forwarded
+   */
+  const unprocessable = Object.assign(new Error('Reference already exists'), { status: 422 });
+
+  /**
+   * Makes the lock ref point to a commit recording the given holder
+   */
+  function holdLock(by: LockHolder | undefined): void {
+    mockOctokit.rest.git.getRef.mockResolvedValue({ data: { object: { sha: 'held' } } });
+    mockOctokit.rest.git.getCommit.mockImplementation(async ({ commit_sha }) => ({
+      data:
+        commit_sha === 'held'
+          ? { message: by ? buildLockCommitMessage(by) : 'Merge branch main' }
+          : { tree: { sha: 'tree1' } },
+    }));
+  }
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+    holdLock(other);
+    mockOctokit.rest.git.createCommit.mockImplementation(async ({ parents }) => ({
+      data: { sha: parents.length === 0 ? 'lock1' : 'takeover1' },
+    }));
+    mockOctokit.rest.actions.getWorkflowRun.mockResolvedValue({ data: { status: 'in_progress' } });
+  });
+
+  describe('buildLockRef', () => {
+    it('should make a ref of any group name', () => {
+      expect(buildLockRef('staging')).toBe('terraform-action/locks/staging');
+      expect(buildLockRef('envs/prod.eu')).toBe('terraform-action/locks/envs_prod_eu');
+    });
+  });
+
+  describe('lock commit message', () => {
+    it('should record the holder', () => {
+      expect(parseLockCommitMessage(buildLockCommitMessage(holder))).toEqual(holder);
+    });
+
+    it.each([
+      'Merge branch main',
+      'terraform-action lock\n\nnot JSON',
+      'terraform-action lock\n\n{"runId":"7"}',
+    ])('should not read a holder from %j', (message) => {
+      expect(parseLockCommitMessage(message)).toBeUndefined();
+    });
+  });
+
+  describe('acquireProjectLock', () => {
+    it('should take a free lock', async () => {
+      mockOctokit.rest.git.createRef.mockResolvedValueOnce({});
+
+      const lock = await acquireProjectLock('token', 'acme', 'infra', 'staging', holder, 60_000);
+
+      expect(lock).toEqual({
+        group: 'staging',
+        ref: 'terraform-action/locks/staging',
+        sha: 'lock1',
+      });
+      expect(mockOctokit.rest.git.getCommit).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        commit_sha: 'fedcba9876543210fedc',
+      });
+      expect(mockOctokit.rest.git.createCommit).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        message: buildLockCommitMessage(holder),
+        tree: 'tree1',
+        parents: [],
+      });
+      expect(mockOctokit.rest.git.createRef).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        ref: 'refs/terraform-action/locks/staging',
+        sha: 'lock1',
+      });
+    });
+
+    it('should wait while another running workflow run holds the lock', async () => {
+      mockOctokit.rest.git.createRef
+        .mockRejectedValueOnce(unprocessable)
+        .mockRejectedValueOnce(unprocessable)
+        .mockResolvedValueOnce({});
+
+      const lock = await acquireProjectLock('token', 'acme', 'infra', 'staging', holder, 60_000, 0);
+
+      expect(lock.sha).toBe('lock1');
+      expect(mockOctokit.rest.git.createRef).toHaveBeenCalledTimes(3);
+      expect(mockOctokit.rest.actions.getWorkflowRun).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        run_id: 7,
+      });
+      expect(mockCore.info).toHaveBeenCalledTimes(2);
+      expect(mockCore.info).toHaveBeenCalledWith(
+        'staging is locked by run https://github.com/acme/infra/actions/runs/7 (terraform apply of staging on #12), waiting for it to finish'
+      );
+      expect(mockOctokit.rest.git.updateRef).not.toHaveBeenCalled();
+    });
+
+    it('should wait for another project of the same run attempt', async () => {
+      holdLock({ ...holder, project: 'shared' });
+      mockOctokit.rest.git.createRef.mockRejectedValueOnce(unprocessable).mockResolvedValueOnce({});
+
+      await acquireProjectLock('token', 'acme', 'infra', 'staging', holder, 60_000, 0);
+
+      expect(mockOctokit.rest.actions.getWorkflowRun).not.toHaveBeenCalled();
+      expect(mockOctokit.rest.git.updateRef).not.toHaveBeenCalled();
+    });
+
+    it.each([
+      ['a completed run', other, { data: { status: 'completed' } }],
+      ['an earlier attempt of the run', { ...holder, runAttempt: 0 }, undefined],
+      ['no recorded run', undefined, undefined],
+    ])('should take over a lock held by %s', async (_, by, workflowRun) => {
+      holdLock(by);
+      if (workflowRun) {
+        mockOctokit.rest.actions.getWorkflowRun.mockResolvedValueOnce(workflowRun);
+      }
+      mockOctokit.rest.git.createRef.mockRejectedValueOnce(unprocessable);
+      mockOctokit.rest.git.updateRef.mockResolvedValueOnce({});
+
+      const lock = await acquireProjectLock('token', 'acme', 'infra', 'staging', holder, 60_000);
+
+      expect(lock.sha).toBe('takeover1');
+      expect(mockOctokit.rest.git.createCommit).toHaveBeenLastCalledWith(
+        expect.objectContaining({ parents: ['held'] })
+      );
+      expect(mockOctokit.rest.git.updateRef).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        ref: 'terraform-action/locks/staging',
+        sha: 'takeover1',
+        force: false,
+      });
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        expect.stringMatching(/^Took over the lock of staging from .*, which ended without/)
+      );
+    });
+
+    it('should try again when another run took over the stale lock first', async () => {
+      mockOctokit.rest.actions.getWorkflowRun.mockResolvedValueOnce({
+        data: { status: 'completed' },
+      });
+      mockOctokit.rest.git.createRef
+        .mockRejectedValueOnce(unprocessable)
+        .mockRejectedValueOnce(unprocessable);
+      mockOctokit.rest.git.updateRef.mockRejectedValueOnce(unprocessable);
+
+      await expect(
+        acquireProjectLock('token', 'acme', 'infra', 'staging', holder, 0)
+      ).rejects.toThrow(
+        'Timed out waiting for the lock of staging, held by run https://github.com/acme/infra/actions/runs/7 (terraform apply of staging on #12)'
+      );
+      expect(mockOctokit.rest.git.createRef).toHaveBeenCalledTimes(2);
+    });
+
+    it('should take the lock when it was released while checking its holder', async () => {
+      mockOctokit.rest.git.getRef.mockRejectedValueOnce(
+        Object.assign(new Error('Not Found'), { status: 404 })
+      );
+      mockOctokit.rest.git.createRef.mockRejectedValueOnce(unprocessable).mockResolvedValueOnce({});
+
+      const lock = await acquireProjectLock('token', 'acme', 'infra', 'staging', holder, 0);
+
+      expect(lock.sha).toBe('lock1');
+    });
+
+    it('should throw other API errors', async () => {
+      mockOctokit.rest.git.createRef.mockRejectedValueOnce(
+        Object.assign(new Error('Resource not accessible by integration'), { status: 403 })
+      );
+
+      await expect(
+        acquireProjectLock('token', 'acme', 'infra', 'staging', holder, 60_000)
+      ).rejects.toThrow('Resource not accessible by integration');
+    });
+  });
+
+  describe('releaseProjectLock', () => {
+    const lock = { group: 'staging', ref: 'terraform-action/locks/staging', sha: 'held' };
+
+    it('should delete the lock ref while it is held by this run', async () => {
+      await releaseProjectLock('token', 'acme', 'infra', lock);
+
+      expect(mockOctokit.rest.git.deleteRef).toHaveBeenCalledWith({
+        owner: 'acme',
+        repo: 'infra',
+        ref: 'terraform-action/locks/staging',
+      });
+    });
+
+    it('should leave a lock taken over by another run', async () => {
+      await releaseProjectLock('token', 'acme', 'infra', { ...lock, sha: 'lock1' });
+
+      expect(mockOctokit.rest.git.deleteRef).not.toHaveBeenCalled();
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'The lock of staging was taken over by another run'
+      );
+    });
+
+    it('should warn instead of throwing when the API call fails', async () => {
+      mockOctokit.rest.git.deleteRef.mockRejectedValueOnce(new Error('Server Error'));
+
+      await expect(releaseProjectLock('token', 'acme', 'infra', lock)).resolves.toBeUndefined();
+
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'Failed to release the lock of staging: Server Error'
+      );
+    });
+  });
+});
@@ -0,0 +1,334 @@
+/**
+ * Locks serializing the commands of a project across workflow runs (concurrency)
+ */
+
+import * as core from '@actions/core';
+import * as github from '@actions/github';
+import { throwIfCancelled } from './cancellation';
+import { getClient } from './github-client';
+import type { LockedCommand } from './types';
+
+/**
+ * Commands that wait for the lock of their project by default
+ *
+ * @remarks
+ * Of the state commands, only those that change the state (rm, mv) wait for the lock.
+ */
+export const DEFAULT_LOCKED_COMMANDS: LockedCommand[] = ['apply', 'destroy', 'import', 'state'];
+
+/**
+ * Commands that may wait for the lock of their project
+ */
+export const LOCKABLE_COMMANDS: LockedCommand[] = ['plan', 'apply', 'destroy', 'import', 'state'];
+
+/**
+ * How long a command waits for the lock of its project by default
+ */
+export const DEFAULT_LOCK_TIMEOUT = '30m';
+
+/**
+ * How often a waiting command checks whether the lock was released
+ */
+export const LOCK_POLL_INTERVAL_MS = 15_000;
+
+/**
+ * Namespace of the git refs holding the locks (under refs/)
+ */
+const LOCK_REF_PREFIX = 'terraform-action/locks/';
+
+/**
+ * First line of the message of the commits the lock refs point to
+ */
+const LOCK_COMMIT_TITLE = 'terraform-action lock';
+
+/**
+ * Workflow run holding a lock, recorded in the commit its ref points to
+ */
+export interface LockHolder {
+  /** ID of the workflow run */
+  runId: number;
+  /** Attempt of the workflow run (reruns of a run keep its ID) */
+  runAttempt: number;
+  /** Project the command runs for */
+  project: string;
+  /** Command that holds the lock (e.g., apply) */
+  command: string;
+  /** Pull request the command was run on, if any */
+  prNumber?: number;
+  /** When the lock was taken (ISO 8601) */
+  lockedAt: string;
+}
+
+/**
+ * Lock held by this run
+ */
+export interface ProjectLock {
+  /** Concurrency group the lock serializes */
+  group: string;
+  /** Git ref holding the lock, without refs/ */
+  ref: string;
+  /** Commit the ref points to while this run holds it */
+  sha: string;
+}
+
+/**
+ * Builds the git ref (without refs/) holding the lock of a concurrency group
+ *
+ * @remarks
+ * Characters other than letters, digits, - and _ are replaced, so that any project
+ * name makes a valid ref that no other lock is nested in. Groups that end up with the
+ * same ref only share a lock.
+ *
+ * @example
+ * buildLockRef('envs/production')
+ * // => 'terraform-action/locks/envs_production'
+ */
+export function buildLockRef(group: string): string {
+  return `${LOCK_REF_PREFIX}${group.replace(/[^A-Za-z0-9_-]/g, '_')}`;
+}
+
+/**
+ * Builds the message of the commit a lock ref points to
+ */
+export function buildLockCommitMessage(holder: LockHolder): string {
+  return `${LOCK_COMMIT_TITLE}\n\n${JSON.stringify(holder)}`;
+}
+
+/**
+ * Reads the holder of a lock from the message of the commit its ref points to
+ *
+ * @returns The holder, or undefined if the message does not record one
+ */
+export function parseLockCommitMessage(message: string): LockHolder | undefined {
+  const [title, ...rest] = message.split('\n');
+  if (title !== LOCK_COMMIT_TITLE) {
+    return undefined;
+  }
+  try {
+    const holder = JSON.parse(rest.join('\n'));
+    return typeof holder?.runId === 'number' && typeof holder?.runAttempt === 'number'
+      ? (holder as LockHolder)
+      : undefined;
+  } catch {
+    return undefined;
+  }
+}
+
+/**
+ * Describes the holder of a lock for logs and errors
+ *
+ * @example
+ * describeLockHolder({ runId: 7, command: 'apply', project: 'production', prNumber: 12, ... })
+ * // => 'run https://github.com/acme/infra/actions/runs/7 (terraform apply of production on #12)'
+ */
+export function describeLockHolder(holder: LockHolder): string {
+  const { owner, repo } = github.context.repo;
+  const url = `${github.context.serverUrl}/${owner}/${repo}/actions/runs/${holder.runId}`;
+  const pr = holder.prNumber ? ` on #${holder.prNumber}` : '';
+  return `run ${url} (terraform ${holder.command} of ${holder.project}${pr})`;
+}
+
+/**
+ * Takes the lock of a concurrency group, waiting while another workflow run holds it
+ *
+ * @param token - GitHub token for API access (needs contents: write and actions: read)
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param group - Concurrency group of the project
+ * @param holder - This run, recorded as the holder of the lock
+ * @param timeoutMs - How long to wait for the lock
+ * @param pollIntervalMs - How often to check whether the lock was released
+ * @returns The lock, to release once the command is done
+ * @throws Error if the lock is still held after the timeout
+ * @throws RunCancelledError if the run is cancelled while waiting
+ *
+ * @remarks
+ * The lock is a git ref, which GitHub creates for only one of the runs racing for it.
+ * It points to a commit recording the holder, so that the lock of a run that ended
+ * without releasing it (e.g., a killed runner) is taken over instead of waited for.
+ * A takeover builds on the commit it replaces and fails if another run moved the ref first.
+ */
+export async function acquireProjectLock(
+  token: string,
+  owner: string,
+  repo: string,
+  group: string,
+  holder: LockHolder,
+  timeoutMs: number,
+  pollIntervalMs = LOCK_POLL_INTERVAL_MS
+): Promise<ProjectLock> {
+  const octokit = getClient(token);
+  const ref = buildLockRef(group);
+  const deadline = Date.now() + timeoutMs;
+
+  // Lock commits reuse the tree of the run's commit, as the tree does not matter
+  const { data: runCommit } = await octokit.rest.git.getCommit({
+    owner,
+    repo,
+    commit_sha: github.context.sha,
+  });
+  const createLockCommit = async (parents: string[]): Promise<string> => {
+    const { data } = await octokit.rest.git.createCommit({
+      owner,
+      repo,
+      message: buildLockCommitMessage(holder),
+      tree: runCommit.tree.sha,
+      parents,
+    });
+    return data.sha;
+  };
+  const sha = await createLockCommit([]);
+
+  let waiting = false;
+  for (;;) {
+    throwIfCancelled(`waiting for the lock of ${group}`);
+    try {
+      await octokit.rest.git.createRef({ owner, repo, ref: `refs/${ref}`, sha });
+      core.info(`Took the lock of ${group}`);
+      return { group, ref, sha };
+    } catch (error) {
+      // GitHub refuses to create a ref that already exists
+      if ((error as { status?: number }).status !== 422) {
+        throw error;
+      }
+    }
+
+    const current = await readLockHolder(token, owner, repo, ref);
+    if (!current) {
+      // Released in the meantime
+      continue;
+    }
+    if (await isStaleLock(token, owner, repo, current.holder, holder)) {
+      const takeover = await createLockCommit([current.sha]);
+      try {
+        await octokit.rest.git.updateRef({ owner, repo, ref, sha: takeover, force: false });
+        core.warning(
+          `Took over the lock of ${group} from ${current.holder ? describeLockHolder(current.holder) : 'an unknown run'}, which ended without releasing it`
+        );
+        return { group, ref, sha: takeover };
+      } catch (error) {
+        // Another run moved the ref first
+        if ((error as { status?: number }).status !== 422) {
+          throw error;
+        }
+        continue;
+      }
+    }
+
+    const by = current.holder ? describeLockHolder(current.holder) : 'another run';
+    if (Date.now() >= deadline) {
+      throw new Error(`Timed out waiting for the lock of ${group}, held by ${by}`);
+    }
+    if (!waiting) {
+      core.info(`${group} is locked by ${by}, waiting for it to finish`);
+      waiting = true;
+    }
+    await sleep(Math.min(pollIntervalMs, Math.max(deadline - Date.now(), 0)));
+  }
+}
+
+/**
+ * Releases a lock this run holds
+ *
+ * @remarks
+ * The ref is only deleted while it still points to this run's commit, so a lock taken
+ * over by another run is left alone. Errors are logged as warnings: a lock left behind
+ * is taken over by the next run once this one has ended.
+ */
+export async function releaseProjectLock(
+  token: string,
+  owner: string,
+  repo: string,
+  lock: ProjectLock
+): Promise<void> {
+  const octokit = getClient(token);
+
+  try {
+    const current = await readLockHolder(token, owner, repo, lock.ref);
+    if (current?.sha !== lock.sha) {
+      core.warning(`The lock of ${lock.group} was taken over by another run`);
+      return;
+    }
+    await octokit.rest.git.deleteRef({ owner, repo, ref: lock.ref });
+    core.info(`Released the lock of ${lock.group}`);
+  } catch (error) {
+    core.warning(
+      `Failed to release the lock of ${lock.group}: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Reads the commit a lock ref points to and the holder it records
+ *
+ * @returns The commit and its holder, or undefined if the lock is not held
+ */
+async function readLockHolder(
+  token: string,
+  owner: string,
+  repo: string,
+  ref: string
+): Promise<{ sha: string; holder: LockHolder | undefined } | undefined> {
+  const octokit = getClient(token);
+
+  let sha: string;
+  try {
+    const { data } = await octokit.rest.git.getRef({ owner, repo, ref });
+    sha = data.object.sha;
+  } catch (error) {
+    if ((error as { status?: number }).status === 404) {
+      return undefined;
+    }
+    throw error;
+  }
+  const { data: commit } = await octokit.rest.git.getCommit({ owner, repo, commit_sha: sha });
+  return { sha, holder: parseLockCommitMessage(commit.message) };
+}
+
+/**
+ * Whether a lock is held by a workflow run that has ended
+ *
+ * @param holder - Holder of the lock (undefined if the ref records none)
+ * @param requester - Run waiting for the lock
+ *
+ * @remarks
+ * A lock of an earlier attempt of this run is stale, as attempts run one at a time,
+ * while one of this attempt is held by another of its projects.
+ */
+async function isStaleLock(
+  token: string,
+  owner: string,
+  repo: string,
+  holder: LockHolder | undefined,
+  requester: LockHolder
+): Promise<boolean> {
+  if (!holder) {
+    return true;
+  }
+  if (holder.runId === requester.runId) {
+    return holder.runAttempt < requester.runAttempt;
+  }
+
+  const octokit = getClient(token);
+  try {
+    const { data } = await octokit.rest.actions.getWorkflowRun({
+      owner,
+      repo,
+      run_id: holder.runId,
+    });
+    return data.status === 'completed';
+  } catch (error) {
+    // The run was deleted
+    if ((error as { status?: number }).status === 404) {
+      return true;
+    }
+    throw error;
+  }
+}
+
+/**
+ * Waits for the given time
+ */
+function sleep(ms: number): Promise<void> {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
@@ -0,0 +1,354 @@
+/**
+ * Unit tests for result reporting
+ */
+
+import * as core from '@actions/core';
+import * as github from '@actions/github';
+import {
+  buildCheckRunExternalId,
+  buildStatusContext,
+  buildStatusDescription,
+  createCommitStatus,
+  findUnknownPlaceholders,
+  getCommitStatus,
+  MAX_CHECK_SUMMARY_LENGTH,
+  MAX_STATUS_DESCRIPTION_LENGTH,
+  parseCheckRunExternalId,
+  reportCheckRun,
+  reportCommitStatus,
+  shouldPostComments,
+  STATUS_CONTEXT_PLACEHOLDERS,
+  shouldSetStatuses,
+  truncateCheckSummary,
+  truncateDescription,
+} from './reporter';
+
+// Mock the @actions modules
+jest.mock('@actions/core');
+jest.mock('@actions/github');
+
+describe('reporter', () => {
+  const mockCore = core as jest.Mocked<typeof core>;
+  const mockGithub = github as jest.Mocked<typeof github>;
+  const mockOctokit = {
+    paginate: jest.fn(),
+    rest: {
+      checks: {
+        create: jest.fn(),
+        update: jest.fn(),
+      },
+      repos: {
+        createCommitStatus: jest.fn(),
+        listCommitStatusesForRef: jest.fn(),
+      },
+    },
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    mockGithub.getOctokit.mockReturnValue(mockOctokit as any);
+  });
+
+  describe('output mode', () => {
+    it.each([
+      ['comment', true, false],
+      ['status', false, true],
+      ['both', true, true],
+    ] as const)('should resolve %s mode', (mode, comments, statuses) => {
+      expect(shouldPostComments(mode)).toBe(comments);
+      expect(shouldSetStatuses(mode)).toBe(statuses);
+    });
+
+    it('should default to both', () => {
+      expect(shouldPostComments()).toBe(true);
+      expect(shouldSetStatuses()).toBe(true);
+    });
+  });
+
+  describe('buildStatusContext', () => {
+    it('should include the command and project name', () => {
+      expect(buildStatusContext('plan', 'production')).toBe('terraform-action/plan: production');
+    });
+
+    it('should use the configured prefix and template', () => {
+      expect(buildStatusContext('plan', 'production', { status_context_prefix: 'tf' })).toBe(
+        'tf/plan: production'
+      );
+      expect(
+        buildStatusContext('apply', 'production', { status_context: 'tf/{command} ({project})' })
+      ).toBe('tf/apply (production)');
+    });
+  });
+
+  describe('buildStatusDescription', () => {
+    it('should pass the description through by default', () => {
+      expect(buildStatusDescription('plan', 'staging', 'pending', 'running')).toBe('running');
+    });
+
+    it('should render the configured template', () => {
+      expect(
+        buildStatusDescription('plan', 'staging', 'success', 'terraform plan succeeded', {
+          status_description: '[{state}] {project}: {description}',
+        })
+      ).toBe('[success] staging: terraform plan succeeded');
+    });
+  });
+
+  describe('findUnknownPlaceholders', () => {
+    it('should list placeholders that are not allowed', () => {
+      const template = '{prefix}/{cmd} {project}';
+
+      expect(findUnknownPlaceholders(template, STATUS_CONTEXT_PLACEHOLDERS)).toEqual(['cmd']);
+    });
+  });
+
+  describe('truncateDescription', () => {
+    it('should keep only the first line', () => {
+      expect(truncateDescription('first\nsecond')).toBe('first');
+    });
+
+    it('should truncate long descriptions', () => {
+      const result = truncateDescription('x'.repeat(200));
+
+      expect(result).toHaveLength(MAX_STATUS_DESCRIPTION_LENGTH);
+      expect(result.endsWith('…')).toBe(true);
+    });
+  });
+
+  describe('createCommitStatus', () => {
+    it('should create a commit status on the given sha', async () => {
+      mockOctokit.rest.repos.createCommitStatus.mockResolvedValue({} as any);
+
+      await createCommitStatus(
+        'token',
+        'owner',
+        'repo',
+        'abc123',
+        'success',
+        'terraform-action/plan: production',
+        'Plan: 1 to add, 0 to change, 0 to destroy'
+      );
+
+      expect(mockOctokit.rest.repos.createCommitStatus).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        sha: 'abc123',
+        state: 'success',
+        context: 'terraform-action/plan: production',
+        description: 'Plan: 1 to add, 0 to change, 0 to destroy',
+      });
+    });
+  });
+
+  describe('getCommitStatus', () => {
+    it('should return the latest status of the context', async () => {
+      mockOctokit.paginate.mockResolvedValue([
+        { context: 'terraform-action/plan: production', state: 'success', description: null },
+        {
+          context: 'terraform-action/policy_check: production',
+          state: 'success',
+          description: 'Approved',
+        },
+        {
+          context: 'terraform-action/policy_check: production',
+          state: 'failure',
+          description: 'Failed',
+        },
+      ]);
+
+      await expect(
+        getCommitStatus(
+          'token',
+          'owner',
+          'repo',
+          'abc123',
+          'terraform-action/policy_check: production'
+        )
+      ).resolves.toEqual({ state: 'success', description: 'Approved' });
+      expect(mockOctokit.paginate).toHaveBeenCalledWith(
+        mockOctokit.rest.repos.listCommitStatusesForRef,
+        { owner: 'owner', repo: 'repo', ref: 'abc123', per_page: 100 }
+      );
+    });
+
+    it('should return undefined for a context without statuses', async () => {
+      mockOctokit.paginate.mockResolvedValue([]);
+
+      await expect(
+        getCommitStatus('token', 'owner', 'repo', 'abc123', 'terraform-action/plan: production')
+      ).resolves.toBeUndefined();
+    });
+  });
+
+  describe('reportCommitStatus', () => {
+    it('should warn instead of throwing when the API call fails', async () => {
+      mockOctokit.rest.repos.createCommitStatus.mockRejectedValueOnce(
+        new Error('Resource not accessible by integration')
+      );
+
+      await expect(
+        reportCommitStatus('token', 'owner', 'repo', 'abc123', 'apply', 'staging', 'failure', 'x')
+      ).resolves.toBeUndefined();
+
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'Failed to set commit status for staging: Resource not accessible by integration'
+      );
+    });
+
+    it('should set the status with the configured context and description', async () => {
+      mockOctokit.rest.repos.createCommitStatus.mockResolvedValueOnce({} as any);
+
+      await reportCommitStatus(
+        'token',
+        'owner',
+        'repo',
+        'abc123',
+        'plan',
+        'staging',
+        'pending',
+        'terraform plan is running',
+        {
+          status_context: 'tf/{command} ({project})',
+          status_description: '{project}: {description}',
+        }
+      );
+
+      expect(mockOctokit.rest.repos.createCommitStatus).toHaveBeenCalledWith(
+        expect.objectContaining({
+          context: 'tf/plan (staging)',
+          description: 'staging: terraform plan is running',
+        })
+      );
+    });
+  });
+
+  describe('check run external ID', () => {
+    it('should round-trip the command of a check run', () => {
+      const plan = { command: 'plan' as const, project: 'production', args: [] };
+      const destroy = { ...plan, args: ['-target=aws_instance.web'], destroy: true };
+
+      expect(buildCheckRunExternalId(plan)).toBe(
+        'terraform-action:{"command":"plan","project":"production","args":[]}'
+      );
+      expect(parseCheckRunExternalId(buildCheckRunExternalId(destroy))).toEqual(destroy);
+    });
+
+    it.each([
+      ['missing', undefined],
+      ['from another app', 'ci:build'],
+      ['not JSON', 'terraform-action:{plan'],
+      ['not an object', 'terraform-action:"plan"'],
+      [
+        'for a command that cannot run again',
+        'terraform-action:{"command":"import","project":"a","args":[]}',
+      ],
+      ['without a project', 'terraform-action:{"command":"plan","args":[]}'],
+      ['with invalid args', 'terraform-action:{"command":"apply","project":"a","args":[1]}'],
+    ])('should ignore an external ID %s', (_, externalId) => {
+      expect(parseCheckRunExternalId(externalId)).toBeUndefined();
+    });
+  });
+
+  describe('truncateCheckSummary', () => {
+    it('should keep summaries within the limit', () => {
+      expect(truncateCheckSummary('## Plan')).toBe('## Plan');
+
+      const truncated = truncateCheckSummary('x'.repeat(MAX_CHECK_SUMMARY_LENGTH + 10));
+      expect(truncated).toHaveLength(MAX_CHECK_SUMMARY_LENGTH);
+      expect(truncated.endsWith('…')).toBe(true);
+    });
+  });
+
+  describe('reportCheckRun', () => {
+    it('should start an in-progress check run that can run again', async () => {
+      mockOctokit.rest.checks.create.mockResolvedValueOnce({ data: { id: 7 } } as any);
+
+      const checkRunId = await reportCheckRun(
+        'token',
+        'owner',
+        'repo',
+        'abc123',
+        'plan',
+        'staging',
+        'pending',
+        'terraform plan is running',
+        { rerun: { command: 'plan', project: 'staging', args: [] } }
+      );
+
+      expect(checkRunId).toBe(7);
+      expect(mockOctokit.rest.checks.create).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        head_sha: 'abc123',
+        name: 'terraform-action/plan: staging',
+        status: 'in_progress',
+        output: { title: 'terraform plan is running', summary: 'terraform plan is running' },
+        external_id: 'terraform-action:{"command":"plan","project":"staging","args":[]}',
+      });
+      expect(mockOctokit.rest.checks.update).not.toHaveBeenCalled();
+    });
+
+    it('should complete the started check run with the summary', async () => {
+      mockOctokit.rest.checks.update.mockResolvedValueOnce({} as any);
+
+      await reportCheckRun(
+        'token',
+        'owner',
+        'repo',
+        'abc123',
+        'plan',
+        'staging',
+        'success',
+        'terraform plan succeeded: 1 to add',
+        { summary: '## 📋 Plan summary', checkRunId: 7 }
+      );
+
+      expect(mockOctokit.rest.checks.create).not.toHaveBeenCalled();
+      expect(mockOctokit.rest.checks.update).toHaveBeenCalledWith({
+        owner: 'owner',
+        repo: 'repo',
+        check_run_id: 7,
+        status: 'completed',
+        conclusion: 'success',
+        output: { title: 'terraform plan succeeded: 1 to add', summary: '## 📋 Plan summary' },
+      });
+    });
+
+    it.each([
+      ['failure', 'failure'],
+      ['error', 'cancelled'],
+    ] as const)('should complete a new check run for %s as %s', async (state, conclusion) => {
+      mockOctokit.rest.checks.create.mockResolvedValueOnce({ data: { id: 8 } } as any);
+      mockOctokit.rest.checks.update.mockResolvedValueOnce({} as any);
+
+      await reportCheckRun('token', 'owner', 'repo', 'abc123', 'apply', 'staging', state, 'x', {}, {
+        status_context: 'tf/{command} ({project})',
+      });
+
+      expect(mockOctokit.rest.checks.create).toHaveBeenCalledWith(
+        expect.objectContaining({ name: 'tf/apply (staging)' })
+      );
+      expect(mockOctokit.rest.checks.update).toHaveBeenCalledWith(
+        expect.objectContaining({
+          check_run_id: 8,
+          conclusion,
+          output: { title: 'x', summary: 'x' },
+        })
+      );
+    });
+
+    it('should warn instead of throwing when the API call fails', async () => {
+      mockOctokit.rest.checks.create.mockRejectedValueOnce(
+        new Error('Resource not accessible by integration')
+      );
+
+      await expect(
+        reportCheckRun('token', 'owner', 'repo', 'abc123', 'plan', 'staging', 'pending', 'x')
+      ).resolves.toBeUndefined();
+
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'Failed to report check run for staging: Resource not accessible by integration'
+      );
+    });
+  });
+});
@@ -0,0 +1,532 @@
+/**
+ * Result reporting: decides between PR comments and commit statuses or check runs
+ */
+
+import * as core from '@actions/core';
+import { getClient } from './github-client';
+import { redact } from './redaction';
+import type { Config, OutputMode } from './types';
+
+/**
+ * Commit status state
+ */
+export type CommitStatusState = 'pending' | 'success' | 'failure' | 'error';
+
+/**
+ * Maximum length GitHub accepts for a commit status description
+ */
+export const MAX_STATUS_DESCRIPTION_LENGTH = 140;
+
+/**
+ * Maximum length GitHub accepts for a commit status context
+ */
+export const MAX_STATUS_CONTEXT_LENGTH = 255;
+
+/**
+ * Default prefix of commit status contexts
+ */
+export const DEFAULT_STATUS_CONTEXT_PREFIX = 'terraform-action';
+
+/**
+ * Command part of the commit status context recording a project's policy check
+ */
+export const POLICY_CHECK_STATUS_COMMAND = 'policy_check';
+
+/**
+ * Command part of the commit status context recording a project's security scan
+ */
+export const SECURITY_SCAN_STATUS_COMMAND = 'security_scan';
+
+/**
+ * Default commit status context
+ */
+export const DEFAULT_STATUS_CONTEXT = '{prefix}/{command}: {project}';
+
+/**
+ * Default commit status description (the description as is)
+ */
+export const DEFAULT_STATUS_DESCRIPTION = '{description}';
+
+/**
+ * Placeholders a status_context may use
+ */
+export const STATUS_CONTEXT_PLACEHOLDERS = ['prefix', 'command', 'project'];
+
+/**
+ * Placeholders a status_description may use
+ */
+export const STATUS_DESCRIPTION_PLACEHOLDERS = ['description', 'command', 'project', 'state'];
+
+/**
+ * Conclusion of a completed check run
+ */
+export type CheckRunConclusion = 'success' | 'failure' | 'cancelled';
+
+/**
+ * Conclusion a check run completes with for each final status state
+ *
+ * @remarks
+ * Projects only end in error when the run was cancelled.
+ */
+export const CHECK_RUN_CONCLUSIONS: Record<
+  Exclude<CommitStatusState, 'pending'>,
+  CheckRunConclusion
+> = {
+  success: 'success',
+  failure: 'failure',
+  error: 'cancelled',
+};
+
+/**
+ * Maximum length GitHub accepts for the summary of a check run
+ */
+export const MAX_CHECK_SUMMARY_LENGTH = 65535;
+
+/**
+ * Prefix of the external ID of the check runs this action creates
+ */
+const CHECK_RUN_EXTERNAL_ID_PREFIX = 'terraform-action:';
+
+/**
+ * Commands a re-requested check run runs again
+ *
+ * @remarks
+ * Other commands change the state once (e.g., import or state mv), so they are
+ * commented again instead.
+ */
+export const RERUNNABLE_COMMANDS = ['plan', 'apply'];
+
+/**
+ * Command a check run runs again when it is re-requested, saved as its external ID
+ */
+export interface CheckRunCommand {
+  /** Command that was run */
+  command: 'plan' | 'apply';
+  /** Project it ran for */
+  project: string;
+  /** Additional terraform arguments */
+  args: string[];
+  /** Whether the plan previewed a destroy */
+  destroy?: boolean;
+}
+
+/**
+ * Details of a check run report besides its state
+ */
+export interface CheckRunReport {
+  /** Markdown shown in the check details (default: the description) */
+  summary?: string;
+  /** Command re-run when the check is re-requested (default: none) */
+  rerun?: CheckRunCommand;
+  /** Check run to complete, as returned for the pending report */
+  checkRunId?: number;
+}
+
+/**
+ * Configuration settings that shape commit statuses
+ */
+export type StatusConfig = Pick<
+  Config,
+  'status_context_prefix' | 'status_context' | 'status_description'
+>;
+
+/**
+ * Whether results should be posted as PR comments
+ *
+ * @param mode - Configured output mode (default: both)
+ */
+export function shouldPostComments(mode: OutputMode = 'both'): boolean {
+  return mode !== 'status';
+}
+
+/**
+ * Whether results should be reported as commit statuses
+ *
+ * @param mode - Configured output mode (default: both)
+ */
+export function shouldSetStatuses(mode: OutputMode = 'both'): boolean {
+  return mode !== 'comment';
+}
+
+/**
+ * Builds the commit status context for a project command
+ *
+ * @param command - Command that was requested
+ * @param projectName - Name of the project
+ * @param config - Status settings from the configuration
+ *
+ * @remarks
+ * The context only depends on the settings, the command and the project, so
+ * every run reports to the same required check.
+ *
+ * @example
+ * buildStatusContext('plan', 'production')
+ * // => 'terraform-action/plan: production'
+ * buildStatusContext('plan', 'production', { status_context: 'tf/{command} ({project})' })
+ * // => 'tf/plan (production)'
+ */
+export function buildStatusContext(
+  command: string,
+  projectName: string,
+  config: StatusConfig = {}
+): string {
+  return renderStatusTemplate(config.status_context ?? DEFAULT_STATUS_CONTEXT, {
+    prefix: config.status_context_prefix ?? DEFAULT_STATUS_CONTEXT_PREFIX,
+    command,
+    project: projectName,
+  });
+}
+
+/**
+ * Builds the commit status description for a project command
+ *
+ * @param command - Command that was requested
+ * @param projectName - Name of the project
+ * @param state - Status state
+ * @param description - Description of the outcome (e.g., terraform plan succeeded)
+ * @param config - Status settings from the configuration
+ */
+export function buildStatusDescription(
+  command: string,
+  projectName: string,
+  state: CommitStatusState,
+  description: string,
+  config: StatusConfig = {}
+): string {
+  return renderStatusTemplate(config.status_description ?? DEFAULT_STATUS_DESCRIPTION, {
+    description,
+    command,
+    project: projectName,
+    state,
+  });
+}
+
+/**
+ * Replaces {name} placeholders in a status template
+ *
+ * @param template - Template text
+ * @param values - Value of each placeholder
+ * @returns Rendered text; unknown placeholders are kept as written
+ */
+export function renderStatusTemplate(template: string, values: Record<string, string>): string {
+  return template.replace(/\{(\w+)\}/g, (placeholder, name: string) =>
+    Object.prototype.hasOwnProperty.call(values, name) ? values[name] : placeholder
+  );
+}
+
+/**
+ * Finds the placeholders of a status template that are not allowed
+ *
+ * @example
+ * findUnknownPlaceholders('{prefix}/{cmd}', STATUS_CONTEXT_PLACEHOLDERS)
+ * // => ['cmd']
+ */
+export function findUnknownPlaceholders(template: string, allowed: string[]): string[] {
+  return [...template.matchAll(/\{(\w+)\}/g)]
+    .map((match) => match[1])
+    .filter((name) => !allowed.includes(name));
+}
+
+/**
+ * Truncates a description to the commit status length limit
+ */
+export function truncateDescription(description: string): string {
+  const firstLine = description.split('\n')[0];
+  if (firstLine.length <= MAX_STATUS_DESCRIPTION_LENGTH) {
+    return firstLine;
+  }
+  return `${firstLine.slice(0, MAX_STATUS_DESCRIPTION_LENGTH - 1)}…`;
+}
+
+/**
+ * Creates a commit status
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param sha - Commit SHA
+ * @param state - Status state
+ * @param context - Status context (identifies the check)
+ * @param description - Short description
+ */
+export async function createCommitStatus(
+  token: string,
+  owner: string,
+  repo: string,
+  sha: string,
+  state: CommitStatusState,
+  context: string,
+  description: string
+): Promise<void> {
+  const octokit = getClient(token);
+
+  await octokit.rest.repos.createCommitStatus({
+    owner,
+    repo,
+    sha,
+    state,
+    context,
+    description: truncateDescription(description),
+  });
+
+  core.info(`Set commit status ${context} to ${state}`);
+}
+
+/**
+ * Finds the latest commit status of a context
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param sha - Commit SHA
+ * @param context - Status context
+ * @returns State and description of the latest status, or undefined if the context has none
+ */
+export async function getCommitStatus(
+  token: string,
+  owner: string,
+  repo: string,
+  sha: string,
+  context: string
+): Promise<{ state: string; description: string } | undefined> {
+  const octokit = getClient(token);
+
+  const statuses = await octokit.paginate(octokit.rest.repos.listCommitStatusesForRef, {
+    owner,
+    repo,
+    ref: sha,
+    per_page: 100,
+  });
+
+  // Statuses are listed newest first
+  const latest = statuses.find((status) => status.context === context);
+  return latest ? { state: latest.state, description: latest.description ?? '' } : undefined;
+}
+
+/**
+ * Reports a project command result as a commit status
+ *
+ * @remarks
+ * The context and description follow the status settings of the configuration.
+ * Errors (e.g., a token without `statuses: write`) are logged as warnings
+ * and never fail the run.
+ */
+export async function reportCommitStatus(
+  token: string,
+  owner: string,
+  repo: string,
+  sha: string,
+  command: string,
+  projectName: string,
+  state: CommitStatusState,
+  description: string,
+  config: StatusConfig = {}
+): Promise<void> {
+  try {
+    await createCommitStatus(
+      token,
+      owner,
+      repo,
+      sha,
+      state,
+      buildStatusContext(command, projectName, config),
+      buildStatusDescription(command, projectName, state, description, config)
+    );
+  } catch (error) {
+    core.warning(
+      `Failed to set commit status for ${projectName}: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+}
+
+/**
+ * Encodes the command of a check run as its external ID
+ *
+ * @example
+ * buildCheckRunExternalId({ command: 'plan', project: 'production', args: [] })
+ * // => 'terraform-action:{"command":"plan","project":"production","args":[]}'
+ */
+export function buildCheckRunExternalId(command: CheckRunCommand): string {
+  return `${CHECK_RUN_EXTERNAL_ID_PREFIX}${JSON.stringify(command)}`;
+}
+
+/**
+ * Decodes the command of a check run from its external ID
+ *
+ * @param externalId - External ID of the check run
+ * @returns The command, or undefined if the check run was not created by this action
+ *   for a command that can run again
+ */
+export function parseCheckRunExternalId(
+  externalId: string | null | undefined
+): CheckRunCommand | undefined {
+  if (!externalId?.startsWith(CHECK_RUN_EXTERNAL_ID_PREFIX)) {
+    return undefined;
+  }
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(externalId.slice(CHECK_RUN_EXTERNAL_ID_PREFIX.length));
+  } catch {
+    return undefined;
+  }
+  if (typeof parsed !== 'object' || parsed === null) {
+    return undefined;
+  }
+  const { command, project, args, destroy } = parsed as Record<string, unknown>;
+  if (
+    typeof command !== 'string' ||
+    !RERUNNABLE_COMMANDS.includes(command) ||
+    typeof project !== 'string' ||
+    !Array.isArray(args) ||
+    !args.every((arg) => typeof arg === 'string')
+  ) {
+    return undefined;
+  }
+  return {
+    command: command as CheckRunCommand['command'],
+    project,
+    args,
+    ...(destroy === true ? { destroy } : {}),
+  };
+}
+
+/**
+ * Truncates a check run summary to the length limit
+ */
+export function truncateCheckSummary(summary: string): string {
+  if (summary.length <= MAX_CHECK_SUMMARY_LENGTH) {
+    return summary;
+  }
+  return `${summary.slice(0, MAX_CHECK_SUMMARY_LENGTH - 1)}…`;
+}
+
+/**
+ * Creates a check run that is in progress
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param sha - Commit SHA
+ * @param name - Check name (identifies the check)
+ * @param title - Title of the check output
+ * @param externalId - External ID (see buildCheckRunExternalId)
+ * @returns ID of the check run
+ */
+export async function createCheckRun(
+  token: string,
+  owner: string,
+  repo: string,
+  sha: string,
+  name: string,
+  title: string,
+  externalId?: string
+): Promise<number> {
+  const octokit = getClient(token);
+
+  const { data } = await octokit.rest.checks.create({
+    owner,
+    repo,
+    head_sha: sha,
+    name,
+    status: 'in_progress',
+    output: { title, summary: title },
+    ...(externalId ? { external_id: externalId } : {}),
+  });
+
+  core.info(`Started check run ${name}`);
+  return data.id;
+}
+
+/**
+ * Completes a check run
+ *
+ * @param token - GitHub token for API access
+ * @param owner - Repository owner
+ * @param repo - Repository name
+ * @param checkRunId - ID of the check run
+ * @param conclusion - Conclusion of the check
+ * @param title - Title of the check output
+ * @param summary - Markdown summary shown in the check details
+ */
+export async function completeCheckRun(
+  token: string,
+  owner: string,
+  repo: string,
+  checkRunId: number,
+  conclusion: CheckRunConclusion,
+  title: string,
+  summary: string
+): Promise<void> {
+  const octokit = getClient(token);
+
+  await octokit.rest.checks.update({
+    owner,
+    repo,
+    check_run_id: checkRunId,
+    status: 'completed',
+    conclusion,
+    // The summary holds command output, so secrets are masked like in comments
+    output: { title: redact(title), summary: truncateCheckSummary(redact(summary)) },
+  });
+
+  core.info(`Completed check run ${checkRunId} as ${conclusion}`);
+}
+
+/**
+ * Reports a project command result as a check run (status_api: checks)
+ *
+ * @returns ID of the check run, to complete it with the final state, or undefined on errors
+ *
+ * @remarks
+ * The pending state starts the check run; the final state completes the one it
+ * started, or a new one if it could not be started. The check is named and titled
+ * like the commit status would be. Errors (e.g., a token without `checks: write`)
+ * are logged as warnings and never fail the run.
+ */
+export async function reportCheckRun(
+  token: string,
+  owner: string,
+  repo: string,
+  sha: string,
+  command: string,
+  projectName: string,
+  state: CommitStatusState,
+  description: string,
+  report: CheckRunReport = {},
+  config: StatusConfig = {}
+): Promise<number | undefined> {
+  const name = buildStatusContext(command, projectName, config);
+  const title = truncateDescription(
+    buildStatusDescription(command, projectName, state, description, config)
+  );
+  try {
+    const checkRunId =
+      report.checkRunId ??
+      (await createCheckRun(
+        token,
+        owner,
+        repo,
+        sha,
+        name,
+        title,
+        report.rerun && buildCheckRunExternalId(report.rerun)
+      ));
+    if (state !== 'pending') {
+      await completeCheckRun(
+        token,
+        owner,
+        repo,
+        checkRunId,
+        CHECK_RUN_CONCLUSIONS[state],
+        title,
+        report.summary ?? title
+      );
+    }
+    return checkRunId;
+  } catch (error) {
+    core.warning(
+      `Failed to report check run for ${projectName}: ${error instanceof Error ? error.message : String(error)}`
+    );
+    return undefined;
+  }
+}
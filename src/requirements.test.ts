@@ -0,0 +1,173 @@
+/**
+ * Unit tests for requirement expressions
+ */
+
+import {
+  evaluateRequirement,
+  explainFailure,
+  findUnmetRequirements,
+  formatRequirement,
+  parseRequirement,
+  usesKeyword,
+} from './requirements';
+import type { PullRequestInfo } from './types';
+
+describe('requirements', () => {
+  const createMockPR = (overrides?: Partial<PullRequestInfo>): PullRequestInfo => ({
+    number: 123,
+    owner: 'owner',
+    repo: 'repo',
+    isFork: false,
+    mergeable: true,
+    mergeability: 'mergeable',
+    approved: true,
+    sha: 'abc123',
+    diverged: false,
+    labels: [],
+    headBranch: 'feature',
+    baseBranch: 'main',
+    approvers: [],
+    ...overrides,
+  });
+
+  describe('parseRequirement', () => {
+    it('should parse a bare keyword', () => {
+      expect(parseRequirement('approved')).toEqual({ type: 'atom', name: 'approved' });
+    });
+
+    it('should parse negation, AND and OR with & binding tighter than |', () => {
+      expect(parseRequirement('approved & !diverged | label:fast-track')).toEqual({
+        type: 'or',
+        operands: [
+          {
+            type: 'and',
+            operands: [
+              { type: 'atom', name: 'approved' },
+              { type: 'not', operand: { type: 'atom', name: 'diverged' } },
+            ],
+          },
+          { type: 'atom', name: 'label', label: 'fast-track' },
+        ],
+      });
+    });
+
+    it('should reject unknown atoms', () => {
+      expect(() => parseRequirement('approved|reviewed')).toThrow(
+        "Unknown requirement 'reviewed'. Must be one of: mergeable, approved, codeowner_approved, no_destroys, planned, diverged, label:<name>"
+      );
+    });
+
+    it('should reject empty terms and label names', () => {
+      expect(() => parseRequirement('approved|')).toThrow(
+        "Empty term in requirement 'approved|'"
+      );
+      expect(() => parseRequirement('label:')).toThrow(
+        "Missing label name in requirement 'label:'"
+      );
+    });
+  });
+
+  describe('evaluateRequirement', () => {
+    it.each([
+      ['mergeable', {}, true],
+      ['approved', { approved: false }, false],
+      ['!diverged', { diverged: true }, false],
+      ['approved|label:fast-track', { approved: false, labels: ['fast-track'] }, true],
+      ['approved&mergeable', { mergeable: false }, false],
+      ['codeowner_approved', {}, false],
+      ['codeowner_approved', { pathsWithoutCodeownerApproval: [] }, true],
+      ['codeowner_approved', { pathsWithoutCodeownerApproval: ['main.tf'] }, false],
+      ['no_destroys', {}, false],
+      ['no_destroys', { plannedDestroys: [] }, true],
+      ['no_destroys|approved', { plannedDestroys: ['aws_instance.web'] }, true],
+    ] as const)('should evaluate %s', (expression, overrides, expected) => {
+      const pr = createMockPR(overrides as Partial<PullRequestInfo>);
+
+      expect(evaluateRequirement(parseRequirement(expression), pr)).toBe(expected);
+    });
+  });
+
+  describe('explainFailure', () => {
+    it('should only mention the failed operands of an AND', () => {
+      const pr = createMockPR({ approved: false, labels: ['do-not-merge'] });
+
+      expect(explainFailure(parseRequirement('mergeable&approved&!label:do-not-merge'), pr)).toBe(
+        "PR is not approved, and PR has label 'do-not-merge'"
+      );
+    });
+  });
+
+  describe('formatRequirement', () => {
+    it('should round-trip expressions', () => {
+      expect(formatRequirement(parseRequirement('approved & !diverged | label:x'))).toBe(
+        'approved&!diverged|label:x'
+      );
+    });
+  });
+
+  describe('findUnmetRequirements', () => {
+    it('should keep plain messages for bare keywords', () => {
+      const pr = createMockPR({ mergeable: false, approved: false });
+
+      expect(findUnmetRequirements(['mergeable', 'approved'], pr)).toEqual([
+        'PR is not mergeable (conflicts or failing checks)',
+        'PR is not approved',
+      ]);
+    });
+
+    it('should prefix compound failures with the requirement', () => {
+      const pr = createMockPR({ diverged: true });
+
+      expect(findUnmetRequirements(['!diverged'], pr)).toEqual([
+        '!diverged: PR is behind its base branch (update the branch)',
+      ]);
+    });
+  });
+
+  describe('codeowner_approved', () => {
+    it('should list the paths missing code owner approval', () => {
+      const pr = createMockPR({ pathsWithoutCodeownerApproval: ['a.tf', 'b.tf'] });
+
+      expect(findUnmetRequirements(['codeowner_approved'], pr)).toEqual([
+        'No approval from a code owner for: a.tf, b.tf',
+      ]);
+    });
+  });
+
+  describe('no_destroys', () => {
+    it('should list the resources the plan would destroy', () => {
+      const pr = createMockPR({ plannedDestroys: ['aws_instance.web', 'aws_s3_bucket.logs'] });
+
+      expect(findUnmetRequirements(['no_destroys'], pr)).toEqual([
+        'Plan destroys: aws_instance.web, aws_s3_bucket.logs',
+      ]);
+    });
+
+    it('should not be met when the plan could not be read', () => {
+      expect(findUnmetRequirements(['no_destroys'], createMockPR())).toEqual([
+        'Planned destroys could not be checked (no readable saved plan)',
+      ]);
+    });
+  });
+
+  describe('planned', () => {
+    it('should hold only when the apply found a saved plan of the head commit', () => {
+      expect(findUnmetRequirements(['planned'], createMockPR({ savedPlan: true }))).toEqual([]);
+      expect(findUnmetRequirements(['planned'], createMockPR({ savedPlan: false }))).toEqual([
+        'No saved plan of the head commit (run terraform plan first)',
+      ]);
+      expect(findUnmetRequirements(['planned'], createMockPR())).toHaveLength(1);
+    });
+  });
+
+  describe('usesKeyword', () => {
+    it('should find keywords inside expressions', () => {
+      expect(usesKeyword(['mergeable', 'approved|codeowner_approved'], 'codeowner_approved')).toBe(
+        true
+      );
+      expect(usesKeyword(['mergeable', 'label:codeowner_approved'], 'codeowner_approved')).toBe(
+        false
+      );
+    });
+  });
+});
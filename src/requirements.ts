@@ -0,0 +1,264 @@
+/**
+ * Requirement expressions: parsing and evaluation against a pull request
+ */
+
+import type { PullRequestInfo, Requirement } from './types';
+
+/**
+ * Parsed requirement expression
+ */
+export type RequirementNode =
+  | { type: 'atom'; name: string; label?: string }
+  | { type: 'not'; operand: RequirementNode }
+  | { type: 'and'; operands: RequirementNode[] }
+  | { type: 'or'; operands: RequirementNode[] };
+
+/**
+ * A requirement condition that can be checked against a pull request
+ */
+interface AtomDefinition {
+  /** Whether the condition holds */
+  holds: (pr: PullRequestInfo, label?: string) => boolean;
+  /** Explanation when the condition was required but does not hold */
+  unmet: (pr: PullRequestInfo, label?: string) => string;
+  /** Explanation when the condition was negated but holds */
+  met: (label?: string) => string;
+}
+
+const ATOMS: Record<string, AtomDefinition> = {
+  mergeable: {
+    holds: (pr) => pr.mergeable,
+    unmet: (pr) =>
+      pr.mergeability === 'unknown'
+        ? 'PR mergeability is still being computed by GitHub; retry the command shortly'
+        : 'PR is not mergeable (conflicts or failing checks)',
+    met: () => 'PR is mergeable',
+  },
+  approved: {
+    holds: (pr) => pr.approved,
+    unmet: () => 'PR is not approved',
+    met: () => 'PR is approved',
+  },
+  codeowner_approved: {
+    holds: (pr) => pr.pathsWithoutCodeownerApproval?.length === 0,
+    unmet: (pr) =>
+      pr.pathsWithoutCodeownerApproval === undefined
+        ? 'Code owner approval has not been checked'
+        : `No approval from a code owner for: ${pr.pathsWithoutCodeownerApproval.join(', ')}`,
+    met: () => 'PR is approved by code owners of every changed path',
+  },
+  no_destroys: {
+    holds: (pr) => pr.plannedDestroys?.length === 0,
+    unmet: (pr) =>
+      pr.plannedDestroys === undefined
+        ? 'Planned destroys could not be checked (no readable saved plan)'
+        : `Plan destroys: ${pr.plannedDestroys.join(', ')}`,
+    met: () => 'Plan destroys no resources',
+  },
+  planned: {
+    holds: (pr) => pr.savedPlan === true,
+    unmet: () => 'No saved plan of the head commit (run terraform plan first)',
+    met: () => 'A saved plan of the head commit exists',
+  },
+  diverged: {
+    holds: (pr) => pr.diverged,
+    unmet: () => 'PR is not behind its base branch',
+    met: () => 'PR is behind its base branch (update the branch)',
+  },
+  label: {
+    holds: (pr, label) => pr.labels.includes(label ?? ''),
+    unmet: (_pr, label) => `PR does not have label '${label}'`,
+    met: (label) => `PR has label '${label}'`,
+  },
+};
+
+/**
+ * Atoms that are written as a bare keyword
+ */
+const KEYWORDS = [
+  'mergeable',
+  'approved',
+  'codeowner_approved',
+  'no_destroys',
+  'planned',
+  'diverged',
+];
+
+/**
+ * Human readable list of the supported atoms
+ */
+const ATOM_NAMES =
+  'mergeable, approved, codeowner_approved, no_destroys, planned, diverged, label:<name>';
+
+/**
+ * Parses a requirement expression
+ *
+ * @param expression - Requirement such as `approved`, `!diverged` or `approved|label:fast-track`
+ * @returns Parsed expression
+ * @throws Error if the expression is empty or uses an unknown atom
+ *
+ * @remarks
+ * `!` negates a term, `&` joins terms with AND and `|` with OR (`&` binds tighter than `|`).
+ * Separate entries of a requirements list are combined with AND.
+ *
+ * @example
+ * parseRequirement('approved|label:fast-track')
+ * // => { type: 'or', operands: [{ type: 'atom', name: 'approved' }, { type: 'atom', name: 'label', label: 'fast-track' }] }
+ */
+export function parseRequirement(expression: string): RequirementNode {
+  const alternatives = expression.split('|').map((alternative) => {
+    const terms = alternative.split('&').map((term) => parseTerm(term, expression));
+    return combine('and', terms);
+  });
+
+  return combine('or', alternatives);
+}
+
+/**
+ * Wraps several operands, or returns a single operand unchanged
+ */
+function combine(type: 'and' | 'or', operands: RequirementNode[]): RequirementNode {
+  return operands.length === 1 ? operands[0] : { type, operands };
+}
+
+/**
+ * Parses a single, optionally negated, term
+ */
+function parseTerm(term: string, expression: string): RequirementNode {
+  const trimmed = term.trim();
+
+  if (trimmed.startsWith('!')) {
+    return { type: 'not', operand: parseTerm(trimmed.substring(1), expression) };
+  }
+  if (trimmed === '') {
+    throw new Error(`Empty term in requirement '${expression}'`);
+  }
+
+  if (trimmed.startsWith('label:')) {
+    const label = trimmed.substring('label:'.length).trim();
+    if (label === '') {
+      throw new Error(`Missing label name in requirement '${expression}'`);
+    }
+    return { type: 'atom', name: 'label', label };
+  }
+
+  if (!KEYWORDS.includes(trimmed)) {
+    throw new Error(`Unknown requirement '${trimmed}'. Must be one of: ${ATOM_NAMES}`);
+  }
+
+  return { type: 'atom', name: trimmed };
+}
+
+/**
+ * Whether a requirement expression holds for a pull request
+ *
+ * @param node - Parsed requirement
+ * @param pr - Pull request information
+ */
+export function evaluateRequirement(node: RequirementNode, pr: PullRequestInfo): boolean {
+  switch (node.type) {
+    case 'atom':
+      return ATOMS[node.name].holds(pr, node.label);
+    case 'not':
+      return !evaluateRequirement(node.operand, pr);
+    case 'and':
+      return node.operands.every((operand) => evaluateRequirement(operand, pr));
+    case 'or':
+      return node.operands.some((operand) => evaluateRequirement(operand, pr));
+  }
+}
+
+/**
+ * Explains why a requirement expression does not hold
+ *
+ * @param node - Parsed requirement that evaluated to false
+ * @param pr - Pull request information
+ * @returns Description of the failed sub-conditions
+ */
+export function explainFailure(node: RequirementNode, pr: PullRequestInfo): string {
+  switch (node.type) {
+    case 'atom':
+      return ATOMS[node.name].unmet(pr, node.label);
+    case 'not':
+      if (node.operand.type === 'atom') {
+        return ATOMS[node.operand.name].met(node.operand.label);
+      }
+      return `${formatRequirement(node.operand)} must not hold`;
+    case 'and':
+      return node.operands
+        .filter((operand) => !evaluateRequirement(operand, pr))
+        .map((operand) => explainFailure(operand, pr))
+        .join(', and ');
+    case 'or':
+      return `none of the alternatives hold (${node.operands
+        .map((operand) => explainFailure(operand, pr))
+        .join('; ')})`;
+  }
+}
+
+/**
+ * Formats a parsed requirement back into expression syntax
+ */
+export function formatRequirement(node: RequirementNode): string {
+  switch (node.type) {
+    case 'atom':
+      return node.name === 'label' ? `label:${node.label}` : node.name;
+    case 'not':
+      return `!${formatRequirement(node.operand)}`;
+    case 'and':
+      return node.operands.map(formatRequirement).join('&');
+    case 'or':
+      return node.operands.map(formatRequirement).join('|');
+  }
+}
+
+/**
+ * Whether any of the requirements refers to the given keyword
+ *
+ * @param requirements - Requirement expressions
+ * @param keyword - Keyword such as `codeowner_approved`
+ * @throws Error if a requirement cannot be parsed
+ *
+ * @remarks
+ * Used to skip API lookups that only a rarely used keyword needs.
+ */
+export function usesKeyword(requirements: Requirement[], keyword: string): boolean {
+  const visit = (node: RequirementNode): boolean => {
+    switch (node.type) {
+      case 'atom':
+        return node.name === keyword;
+      case 'not':
+        return visit(node.operand);
+      case 'and':
+      case 'or':
+        return node.operands.some(visit);
+    }
+  };
+
+  return requirements.some((requirement) => visit(parseRequirement(requirement)));
+}
+
+/**
+ * Evaluates a list of requirements (combined with AND)
+ *
+ * @param requirements - Requirement expressions
+ * @param pr - Pull request information
+ * @returns One explanation per requirement that is not met
+ * @throws Error if a requirement cannot be parsed
+ */
+export function findUnmetRequirements(requirements: Requirement[], pr: PullRequestInfo): string[] {
+  const failures: string[] = [];
+
+  for (const requirement of requirements) {
+    const node = parseRequirement(requirement);
+    if (evaluateRequirement(node, pr)) {
+      continue;
+    }
+
+    const explanation = explainFailure(node, pr);
+    // Bare keywords keep their plain message; expressions say which entry failed
+    failures.push(node.type === 'atom' ? explanation : `${requirement}: ${explanation}`);
+  }
+
+  return failures;
+}
@@ -0,0 +1,195 @@
+/**
+ * Unit tests for run result aggregation
+ */
+
+import { MAX_COMMENT_LENGTH } from './pr-comment';
+import {
+  buildConsolidatedComment,
+  buildConsolidatedMarker,
+  buildJobSummary,
+  buildRunOutputs,
+  buildRunSummary,
+  findFailedProjects,
+  formatDuration,
+  type ProjectResult,
+} from './run-summary';
+
+describe('run-summary', () => {
+  const results: ProjectResult[] = [
+    {
+      project: 'production',
+      command: 'plan',
+      status: 'success',
+      summary: { add: 1, change: 0, destroy: 0 },
+    },
+    { project: 'staging', command: 'plan', status: 'success', summary: null },
+    {
+      project: 'dev',
+      command: 'plan',
+      status: 'failure',
+      summary: null,
+      error: 'PR requirements not met:\n  - PR is not approved',
+    },
+  ];
+
+  describe('buildRunSummary', () => {
+    it('should list every project with its status', () => {
+      const summary = buildRunSummary(results);
+
+      expect(summary).toContain('2 of 3 project(s) succeeded.');
+      expect(summary).toContain(
+        '| `production` | plan | ✅ Succeeded | 1 to add, 0 to change, 0 to destroy |'
+      );
+      expect(summary).toContain('| `staging` | plan | ✅ Succeeded | - |');
+      expect(summary).toContain('| `dev` | plan | ❌ Failed | PR requirements not met: |');
+    });
+
+    it('should emphasize the destroy count of a destroy preview', () => {
+      const summary = buildRunSummary([
+        {
+          project: 'dev',
+          command: 'plan -destroy',
+          status: 'success',
+          summary: { add: 0, change: 0, destroy: 7 },
+        },
+      ]);
+
+      expect(summary).toContain('| `dev` | plan -destroy | ✅ Succeeded | 🔥 7 to destroy |');
+    });
+
+    it('should escape pipes in error messages', () => {
+      const summary = buildRunSummary([
+        { project: 'dev', command: 'apply', status: 'failure', summary: null, error: 'a|b' },
+      ]);
+
+      expect(summary).toContain('| `dev` | apply | ❌ Failed | a\\|b |');
+    });
+
+    it('should mention the retries a successful project took', () => {
+      const summary = buildRunSummary([{ ...results[1], retries: 2 }]);
+
+      expect(summary).toContain('| `staging` | plan | ✅ Succeeded (after 2 retries) | - |');
+      expect(buildJobSummary([{ ...results[1], retries: 1 }])).toContain(
+        '| `staging` | plan | ✅ Succeeded (after 1 retry) | - | - |'
+      );
+    });
+
+    it('should list skipped projects without counting them as succeeded', () => {
+      const summary = buildRunSummary([
+        { project: 'network', command: 'apply', status: 'failure', summary: null, error: 'boom' },
+        {
+          project: 'app',
+          command: 'apply',
+          status: 'skipped',
+          summary: null,
+          error: 'An earlier group failed',
+        },
+      ]);
+
+      expect(summary).toContain('0 of 2 project(s) succeeded.');
+      expect(summary).toContain(
+        '| `app` | apply | ⏭️ Skipped | Skipped because a project of an earlier execution order group failed |'
+      );
+    });
+  });
+
+  describe('buildJobSummary', () => {
+    it('should list the changes and duration of every project', () => {
+      const summary = buildJobSummary([
+        { ...results[0], durationMs: 4200 },
+        { ...results[2], durationMs: 185000 },
+        {
+          project: 'sandbox',
+          command: 'plan',
+          status: 'skipped',
+          summary: null,
+          error: 'An earlier group failed',
+        },
+      ]);
+
+      expect(summary).toContain('1 of 3 project(s) succeeded.');
+      expect(summary).toContain('| Project | Command | Result | Changes | Duration |');
+      expect(summary).toContain(
+        '| `production` | plan | ✅ Succeeded | 1 to add, 0 to change, 0 to destroy | 4.2s |'
+      );
+      expect(summary).toContain(
+        '| `dev` | plan | ❌ Failed: PR requirements not met: | - | 3m 05s |'
+      );
+      expect(summary).toContain('| `sandbox` | plan | ⏭️ Skipped: An earlier group failed | - | - |');
+    });
+  });
+
+  describe('formatDuration', () => {
+    it('should show seconds below a minute and minutes above', () => {
+      expect(formatDuration(400)).toBe('0.4s');
+      expect(formatDuration(59_940)).toBe('59.9s');
+      expect(formatDuration(60_000)).toBe('1m 00s');
+    });
+  });
+
+  describe('buildConsolidatedComment', () => {
+    it('should start with the marker and add a section per project with details', () => {
+      const body = buildConsolidatedComment('plan', [
+        { ...results[0], details: '## Plan result\n\n1 to add' },
+        results[1],
+        { ...results[2], details: '## ❌ terraform plan failed' },
+      ]);
+
+      expect(body.startsWith(buildConsolidatedMarker('plan'))).toBe(true);
+      expect(body).toContain('2 of 3 project(s) succeeded.');
+      expect(body).toContain(
+        '<details><summary><code>production</code> ✅ Succeeded</summary>\n\n## Plan result\n\n1 to add\n\n</details>'
+      );
+      expect(body).toContain('<details><summary><code>dev</code> ❌ Failed</summary>');
+      expect(body).not.toContain('<code>staging</code>');
+    });
+
+    it('should shorten details to stay under the comment size limit', () => {
+      const body = buildConsolidatedComment(
+        'plan',
+        results.map((r) => ({ ...r, details: 'x'.repeat(MAX_COMMENT_LENGTH) }))
+      );
+
+      expect(body.length).toBeLessThanOrEqual(MAX_COMMENT_LENGTH);
+      expect(body).toContain('_Output truncated._');
+    });
+  });
+
+  describe('findFailedProjects', () => {
+    it('should return the failed project names', () => {
+      expect(findFailedProjects(results)).toEqual(['dev']);
+    });
+  });
+
+  describe('buildRunOutputs', () => {
+    it('should list projects by outcome and report changes', () => {
+      expect(buildRunOutputs(results)).toEqual({
+        'planned-projects': 'production,staging',
+        'applied-projects': '',
+        'failed-projects': 'dev',
+        'has-changes': 'true',
+      });
+    });
+
+    it('should list each project once across commands', () => {
+      const outputs = buildRunOutputs([
+        {
+          project: 'staging',
+          command: 'plan',
+          status: 'success',
+          summary: { add: 0, change: 0, destroy: 0 },
+        },
+        { project: 'staging', command: 'apply', status: 'success', summary: null },
+        { project: 'staging', command: 'plan', status: 'success', summary: null },
+        { project: 'staging', command: 'state list', status: 'success', summary: null },
+      ]);
+
+      expect(outputs).toEqual({
+        'planned-projects': 'staging',
+        'applied-projects': 'staging',
+        'failed-projects': '',
+        'has-changes': 'false',
+      });
+    });
+  });
+});
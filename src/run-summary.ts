@@ -0,0 +1,247 @@
+/**
+ * Aggregation of per-project results for a single run
+ */
+
+import { formatChangeSummary, formatDestroyPreview, isNoOp } from './plan-summary';
+import { MAX_COMMENT_LENGTH } from './pr-comment';
+import type { ChangeSummary } from './types';
+
+/**
+ * Characters reserved for the markup around each project section of a consolidated comment
+ */
+const SECTION_OVERHEAD = 200;
+
+/**
+ * Outcome of a command for one project
+ */
+export interface ProjectResult {
+  /** Project name */
+  project: string;
+  /** Command label (e.g., plan, apply, state list) */
+  command: string;
+  /** Whether the command succeeded, or was not run because an earlier group failed */
+  status: 'success' | 'failure' | 'skipped';
+  /** Change counts from the output, if recognizable */
+  summary: ChangeSummary | null;
+  /** Error message if the command failed, or why it was skipped */
+  error?: string;
+  /** Markdown shown in the project's section of a consolidated comment */
+  details?: string;
+  /** How long the command ran for the project, in milliseconds (not set when skipped) */
+  durationMs?: number;
+  /** Transient failures retried before the command succeeded */
+  retries?: number;
+}
+
+/**
+ * Builds a markdown table summarizing the results of every project in a run
+ *
+ * @param results - Project results, in execution order
+ * @returns Markdown summary
+ *
+ * @remarks
+ * Only the first line of an error is shown, since table cells cannot span lines. Failures
+ * already say how many retries they took, so only successes mention their retries.
+ */
+export function buildRunSummary(results: ProjectResult[]): string {
+  const succeeded = results.filter((r) => r.status === 'success').length;
+  const rows = results.map((r) => {
+    if (r.status === 'failure') {
+      return `| \`${r.project}\` | ${r.command} | ❌ Failed | ${escapeCell(firstLine(r.error))} |`;
+    }
+    if (r.status === 'skipped') {
+      return `| \`${r.project}\` | ${r.command} | ⏭️ Skipped | ${escapeCell(firstLine(r.error))} |`;
+    }
+    return `| \`${r.project}\` | ${r.command} | ✅ Succeeded${formatRetries(r)} | ${formatChanges(r)} |`;
+  });
+
+  return [
+    '## Terraform run summary',
+    '',
+    `${succeeded} of ${results.length} project(s) succeeded.`,
+    '',
+    '| Project | Command | Status | Details |',
+    '|---------|---------|--------|---------|',
+    ...rows,
+  ].join('\n');
+}
+
+/**
+ * Builds the markdown written to the job summary of the workflow run
+ *
+ * @param results - Project results of every command in the run, in execution order
+ * @returns Markdown summary with the change counts and duration of each project
+ *
+ * @remarks
+ * Unlike the summary comment, failures and skips show their reason in the result
+ * column, so the table has room for the duration.
+ */
+export function buildJobSummary(results: ProjectResult[]): string {
+  const succeeded = results.filter((r) => r.status === 'success').length;
+  const rows = results.map((r) => {
+    const duration = r.durationMs === undefined ? '-' : formatDuration(r.durationMs);
+    let result = `✅ Succeeded${formatRetries(r)}`;
+    if (r.status === 'failure') {
+      result = `❌ Failed: ${escapeCell(firstLine(r.error))}`;
+    } else if (r.status === 'skipped') {
+      result = `⏭️ Skipped: ${escapeCell(firstLine(r.error))}`;
+    }
+    return `| \`${r.project}\` | ${r.command} | ${result} | ${formatChanges(r)} | ${duration} |`;
+  });
+
+  return [
+    '## Terraform run summary',
+    '',
+    `${succeeded} of ${results.length} project(s) succeeded.`,
+    '',
+    '| Project | Command | Result | Changes | Duration |',
+    '|---------|---------|--------|---------|----------|',
+    ...rows,
+  ].join('\n');
+}
+
+/**
+ * Formats a duration for the job summary, e.g. 4.2s or 3m 05s
+ *
+ * @example
+ * formatDuration(185000)
+ * // => '3m 05s'
+ */
+export function formatDuration(ms: number): string {
+  if (ms < 60_000) {
+    return `${(ms / 1000).toFixed(1)}s`;
+  }
+  const seconds = Math.round(ms / 1000);
+  return `${Math.floor(seconds / 60)}m ${String(seconds % 60).padStart(2, '0')}s`;
+}
+
+/**
+ * Formats the retries a successful result took, e.g. ' (after 1 retry)' ('' when there were none)
+ */
+function formatRetries(r: ProjectResult): string {
+  if (!r.retries) {
+    return '';
+  }
+  return ` (after ${r.retries} ${r.retries === 1 ? 'retry' : 'retries'})`;
+}
+
+/**
+ * Formats the change counts of a successful result ('-' when there are none)
+ */
+function formatChanges(r: ProjectResult): string {
+  if (r.status !== 'success' || !r.summary) {
+    return '-';
+  }
+  return r.command === 'plan -destroy'
+    ? `🔥 ${formatDestroyPreview(r.summary)}`
+    : formatChangeSummary(r.summary);
+}
+
+/**
+ * Builds the hidden marker that identifies the consolidated comment for a command
+ *
+ * @example
+ * buildConsolidatedMarker('plan')
+ * // => '<!-- terraform-action:consolidated:plan -->'
+ */
+export function buildConsolidatedMarker(command: string): string {
+  return `<!-- terraform-action:consolidated:${command} -->`;
+}
+
+/**
+ * Builds a single comment with the run summary and a collapsible section per project
+ *
+ * @param command - Command label, used for the marker
+ * @param results - Project results, in execution order
+ * @returns Markdown comment body starting with the marker
+ *
+ * @remarks
+ * Projects without details (e.g., skipped no-op comments) only appear in the
+ * summary table. Details are shortened evenly so that the body stays under
+ * MAX_COMMENT_LENGTH characters.
+ */
+export function buildConsolidatedComment(command: string, results: ProjectResult[]): string {
+  const header = `${buildConsolidatedMarker(command)}\n${buildRunSummary(results)}`;
+  const withDetails = results.filter((r) => r.details);
+  if (withDetails.length === 0) {
+    return header;
+  }
+
+  // Leave room for each section's surrounding markup
+  const budget =
+    Math.floor((MAX_COMMENT_LENGTH - header.length) / withDetails.length) - SECTION_OVERHEAD;
+  const sections = withDetails.map((r) => {
+    const status = r.status === 'failure' ? '❌ Failed' : `✅ Succeeded${formatRetries(r)}`;
+    const summary = `<details><summary><code>${r.project}</code> ${status}</summary>`;
+    return `${summary}\n\n${truncate(r.details ?? '', budget)}\n\n</details>`;
+  });
+
+  return [header, ...sections].join('\n\n');
+}
+
+/**
+ * Names of the projects whose command failed
+ *
+ * @param results - Project results
+ */
+export function findFailedProjects(results: ProjectResult[]): string[] {
+  return results.filter((r) => r.status === 'failure').map((r) => r.project);
+}
+
+/**
+ * Builds the action outputs describing a run
+ *
+ * @param results - Project results of every command in the run
+ * @returns Output values by name (project lists are comma-separated)
+ *
+ * @example
+ * buildRunOutputs([{ project: 'prod', command: 'plan', status: 'success', summary: { add: 1, change: 0, destroy: 0 } }])
+ * // => { 'planned-projects': 'prod', 'applied-projects': '', 'failed-projects': '', 'has-changes': 'true' }
+ */
+export function buildRunOutputs(results: ProjectResult[]): Record<string, string> {
+  const succeeded = (command: string): string =>
+    uniqueProjects(results.filter((r) => r.status === 'success' && r.command === command));
+  const hasChanges = results.some(
+    (r) =>
+      r.status === 'success' &&
+      (r.command === 'plan' || r.command === 'apply') &&
+      r.summary !== null &&
+      !isNoOp(r.summary)
+  );
+
+  return {
+    'planned-projects': succeeded('plan'),
+    'applied-projects': succeeded('apply'),
+    'failed-projects': uniqueProjects(results.filter((r) => r.status === 'failure')),
+    'has-changes': String(hasChanges),
+  };
+}
+
+/**
+ * Comma-separated project names, each listed once in order of first appearance
+ */
+function uniqueProjects(results: ProjectResult[]): string {
+  return [...new Set(results.map((r) => r.project))].join(',');
+}
+
+/**
+ * Shortens text to a maximum length, noting that it was cut
+ */
+function truncate(text: string, maxLength: number): string {
+  const note = '\n\n_Output truncated._';
+  return text.length > maxLength ? `${text.slice(0, maxLength - note.length)}${note}` : text;
+}
+
+/**
+ * Returns the first non-empty line of a message
+ */
+function firstLine(message = ''): string {
+  return message.split('\n').find((line) => line.trim() !== '') ?? '-';
+}
+
+/**
+ * Escapes characters that would break a markdown table cell
+ */
+function escapeCell(text: string): string {
+  return text.replace(/\|/g, '\\|');
+}
@@ -0,0 +1,196 @@
+/**
+ * Unit tests for security scans
+ */
+
+import { isBlockingFinding, parseSecurityFindings, scanProject } from './security-scan';
+import { executeSecurityScanner } from './terraform';
+
+// Mock the @actions modules and the scanners
+jest.mock('@actions/core');
+jest.mock('./terraform', () => ({
+  ...jest.requireActual('./terraform'),
+  executeSecurityScanner: jest.fn(),
+}));
+
+describe('security-scan', () => {
+  const mockExecuteSecurityScanner = executeSecurityScanner as jest.MockedFunction<
+    typeof executeSecurityScanner
+  >;
+  const workingDir = '/repo/app';
+
+  const tfsecOutput = JSON.stringify({
+    results: [
+      {
+        long_id: 'aws-s3-enable-bucket-logging',
+        description: 'Bucket does not have logging enabled',
+        severity: 'MEDIUM',
+        location: { filename: '/repo/app/s3.tf', start_line: 3 },
+      },
+      {
+        long_id: 'aws-s3-block-public-acls',
+        description: 'No public access block so not blocking public acls',
+        severity: 'HIGH',
+        location: { filename: '/repo/app/s3.tf', start_line: 1 },
+      },
+    ],
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+  });
+
+  describe('parseSecurityFindings', () => {
+    it('should read tfsec results, highest severity first', () => {
+      expect(parseSecurityFindings('tfsec', tfsecOutput, workingDir)).toEqual([
+        {
+          id: 'aws-s3-block-public-acls',
+          severity: 'HIGH',
+          title: 'No public access block so not blocking public acls',
+          location: 's3.tf:1',
+        },
+        {
+          id: 'aws-s3-enable-bucket-logging',
+          severity: 'MEDIUM',
+          title: 'Bucket does not have logging enabled',
+          location: 's3.tf:3',
+        },
+      ]);
+    });
+
+    it('should read failed trivy misconfigurations and locate plan findings by resource', () => {
+      const output = JSON.stringify({
+        Results: [
+          {
+            Target: '/tmp/plan-app.json',
+            Misconfigurations: [
+              {
+                ID: 'AVD-AWS-0086',
+                Title: 'S3 Access block should block public ACL',
+                Severity: 'CRITICAL',
+                Status: 'FAIL',
+                CauseMetadata: { Resource: 'aws_s3_bucket.logs' },
+              },
+              { ID: 'AVD-AWS-0087', Title: 'Passed check', Severity: 'HIGH', Status: 'PASS' },
+            ],
+          },
+          { Target: 'main.tf' },
+        ],
+      });
+
+      expect(parseSecurityFindings('trivy', output, workingDir)).toEqual([
+        {
+          id: 'AVD-AWS-0086',
+          severity: 'CRITICAL',
+          title: 'S3 Access block should block public ACL',
+          location: 'aws_s3_bucket.logs',
+        },
+      ]);
+    });
+
+    it('should read checkov failed checks from every framework report', () => {
+      const output = JSON.stringify([
+        {
+          check_type: 'terraform',
+          results: {
+            failed_checks: [
+              {
+                check_id: 'CKV_AWS_18',
+                check_name: 'Ensure the S3 bucket has access logging enabled',
+                severity: null,
+                file_path: '/s3.tf',
+                file_abs_path: '/repo/app/s3.tf',
+                file_line_range: [1, 8],
+                resource: 'aws_s3_bucket.logs',
+              },
+            ],
+          },
+        },
+        { check_type: 'secrets', results: { failed_checks: [] } },
+      ]);
+
+      expect(parseSecurityFindings('checkov', output, workingDir)).toEqual([
+        {
+          id: 'CKV_AWS_18',
+          severity: 'UNKNOWN',
+          title: 'Ensure the S3 bucket has access logging enabled',
+          location: 's3.tf:1',
+        },
+      ]);
+    });
+
+    it('should read a single checkov report', () => {
+      const output = JSON.stringify({
+        results: { failed_checks: [{ check_id: 'CKV_AWS_20', severity: 'high' }] },
+      });
+
+      expect(parseSecurityFindings('checkov', output, workingDir)).toEqual([
+        { id: 'CKV_AWS_20', severity: 'HIGH', title: '', location: undefined },
+      ]);
+    });
+
+    it('should throw when the output is not JSON', () => {
+      expect(() => parseSecurityFindings('tfsec', 'panic: oops', workingDir)).toThrow(
+        'tfsec did not return JSON output'
+      );
+    });
+  });
+
+  describe('isBlockingFinding', () => {
+    const finding = { id: 'x', severity: 'HIGH' as const, title: '' };
+
+    it('should block findings at or above the threshold', () => {
+      expect(isBlockingFinding(finding, 'HIGH')).toBe(true);
+      expect(isBlockingFinding(finding, 'MEDIUM')).toBe(true);
+      expect(isBlockingFinding(finding, 'CRITICAL')).toBe(false);
+    });
+
+    it('should never block findings of unknown severity', () => {
+      expect(isBlockingFinding({ ...finding, severity: 'UNKNOWN' }, 'LOW')).toBe(false);
+    });
+  });
+
+  describe('scanProject', () => {
+    it('should scan the project directory and count blocking findings', async () => {
+      mockExecuteSecurityScanner.mockResolvedValueOnce(tfsecOutput);
+
+      const result = await scanProject('app', { tool: 'tfsec', block_on: 'HIGH' }, workingDir);
+
+      expect(mockExecuteSecurityScanner).toHaveBeenCalledWith(
+        'tfsec',
+        'dir',
+        workingDir,
+        workingDir
+      );
+      expect(result).toEqual(
+        expect.objectContaining({ tool: 'tfsec', blockOn: 'HIGH', blocking: 1 })
+      );
+      expect(result.findings).toHaveLength(2);
+    });
+
+    it('should scan the plan JSON', async () => {
+      mockExecuteSecurityScanner.mockResolvedValueOnce('{"Results":[]}');
+
+      const result = await scanProject(
+        'app',
+        { tool: 'trivy', target: 'plan' },
+        workingDir,
+        '/tmp/plan-app.json'
+      );
+
+      expect(mockExecuteSecurityScanner).toHaveBeenCalledWith(
+        'trivy',
+        'plan',
+        '/tmp/plan-app.json',
+        workingDir
+      );
+      expect(result).toEqual({ tool: 'trivy', findings: [], blockOn: undefined, blocking: 0 });
+    });
+
+    it('should throw when the plan to scan was not saved', async () => {
+      await expect(
+        scanProject('app', { tool: 'checkov', target: 'plan' }, workingDir)
+      ).rejects.toThrow('checkov needs the plan of project app, which was not saved');
+      expect(mockExecuteSecurityScanner).not.toHaveBeenCalled();
+    });
+  });
+});
@@ -0,0 +1,220 @@
+/**
+ * Security scans of project code or plans with trivy, tfsec or checkov
+ */
+
+import * as path from 'node:path';
+import * as core from '@actions/core';
+import { executeSecurityScanner } from './terraform';
+import type {
+  SecurityFinding,
+  SecurityScanConfig,
+  SecurityScanner,
+  SecurityScanResult,
+  SecuritySeverity,
+} from './types';
+
+/**
+ * Scanners a project can be checked with
+ */
+export const SECURITY_SCANNERS: SecurityScanner[] = ['trivy', 'tfsec', 'checkov'];
+
+/**
+ * Severities from lowest to highest
+ */
+export const SECURITY_SEVERITIES: SecuritySeverity[] = [
+  'UNKNOWN',
+  'LOW',
+  'MEDIUM',
+  'HIGH',
+  'CRITICAL',
+];
+
+/**
+ * Reads a severity as reported by a scanner
+ *
+ * @example
+ * toSeverity('high') // => 'HIGH'
+ * toSeverity(null) // => 'UNKNOWN'
+ */
+function toSeverity(value: unknown): SecuritySeverity {
+  const severity = typeof value === 'string' ? value.toUpperCase() : '';
+  return SECURITY_SEVERITIES.includes(severity as SecuritySeverity)
+    ? (severity as SecuritySeverity)
+    : 'UNKNOWN';
+}
+
+/**
+ * Whether a finding blocks apply
+ *
+ * @param finding - Security finding
+ * @param blockOn - Lowest severity that blocks apply
+ */
+export function isBlockingFinding(finding: SecurityFinding, blockOn: SecuritySeverity): boolean {
+  return SECURITY_SEVERITIES.indexOf(finding.severity) >= SECURITY_SEVERITIES.indexOf(blockOn);
+}
+
+/**
+ * Formats where a finding is: a .tf file relative to the project directory, or else the
+ * resource address (findings in a plan point at the plan JSON, which says little)
+ */
+function formatLocation(
+  file: unknown,
+  line: unknown,
+  resource: unknown,
+  workingDir: string
+): string | undefined {
+  if (typeof file === 'string' && file.endsWith('.tf')) {
+    const relative = path.isAbsolute(file) ? path.relative(workingDir, file) : file;
+    return typeof line === 'number' && line > 0 ? `${relative}:${line}` : relative;
+  }
+  if (typeof resource === 'string' && resource !== '') {
+    return resource;
+  }
+  return typeof file === 'string' && file !== '' ? path.basename(file) : undefined;
+}
+
+/**
+ * Returns a value as a list of records, dropping anything else
+ */
+function records(value: unknown): Record<string, unknown>[] {
+  return Array.isArray(value)
+    ? value.filter((item) => typeof item === 'object' && item !== null && !Array.isArray(item))
+    : [];
+}
+
+/**
+ * Reads the findings from `tfsec --format json` output
+ */
+function parseTfsecFindings(report: unknown, workingDir: string): SecurityFinding[] {
+  return records((report as Record<string, unknown>).results).map((r) => {
+    const location = (r.location ?? {}) as Record<string, unknown>;
+    return {
+      id: String(r.long_id || r.rule_id || 'unknown'),
+      severity: toSeverity(r.severity),
+      title: String(r.description || r.rule_description || ''),
+      location: formatLocation(location.filename, location.start_line, r.resource, workingDir),
+    };
+  });
+}
+
+/**
+ * Reads the failed misconfigurations from `trivy config --format json` output
+ */
+function parseTrivyFindings(report: unknown, workingDir: string): SecurityFinding[] {
+  return records((report as Record<string, unknown>).Results).flatMap((target) =>
+    records(target.Misconfigurations)
+      .filter((m) => m.Status === undefined || m.Status === 'FAIL')
+      .map((m) => {
+        const cause = (m.CauseMetadata ?? {}) as Record<string, unknown>;
+        return {
+          id: String(m.ID || m.AVDID || 'unknown'),
+          severity: toSeverity(m.Severity),
+          title: String(m.Title || m.Message || ''),
+          location: formatLocation(target.Target, cause.StartLine, cause.Resource, workingDir),
+        };
+      })
+  );
+}
+
+/**
+ * Reads the failed checks from `checkov --output json` output
+ *
+ * @remarks
+ * checkov prints one report per framework, or a single report when only one ran. Its
+ * severities are only filled in with a Prisma Cloud API key; otherwise they are UNKNOWN.
+ */
+function parseCheckovFindings(report: unknown, workingDir: string): SecurityFinding[] {
+  const reports = Array.isArray(report) ? records(report) : records([report]);
+  return reports.flatMap((r) =>
+    records(((r.results ?? {}) as Record<string, unknown>).failed_checks).map((check) => {
+      const lines = Array.isArray(check.file_line_range) ? check.file_line_range : [];
+      // file_path is relative to the scanned directory, with a leading slash
+      const file =
+        check.file_abs_path ??
+        (typeof check.file_path === 'string' ? check.file_path.replace(/^\//, '') : undefined);
+      return {
+        id: String(check.check_id || 'unknown'),
+        severity: toSeverity(check.severity),
+        title: String(check.check_name || ''),
+        location: formatLocation(file, lines[0], check.resource, workingDir),
+      };
+    })
+  );
+}
+
+/**
+ * Reads the findings from the JSON output of a scanner
+ *
+ * @param tool - Scanner that produced the output
+ * @param output - JSON output of the scanner
+ * @param workingDir - Project directory, which file locations are made relative to
+ * @returns Findings, highest severity first
+ * @throws Error if the output is not JSON
+ */
+export function parseSecurityFindings(
+  tool: SecurityScanner,
+  output: string,
+  workingDir: string
+): SecurityFinding[] {
+  let report: unknown;
+  try {
+    report = JSON.parse(output);
+  } catch {
+    throw new Error(`${tool} did not return JSON output`);
+  }
+  if (typeof report !== 'object' || report === null) {
+    throw new Error(`${tool} did not return a report`);
+  }
+
+  const findings =
+    tool === 'tfsec'
+      ? parseTfsecFindings(report, workingDir)
+      : tool === 'trivy'
+        ? parseTrivyFindings(report, workingDir)
+        : parseCheckovFindings(report, workingDir);
+  // Array.prototype.sort is stable, so findings of a severity keep the scanner's order
+  return findings.sort(
+    (a, b) => SECURITY_SEVERITIES.indexOf(b.severity) - SECURITY_SEVERITIES.indexOf(a.severity)
+  );
+}
+
+/**
+ * Scans a project with its configured scanner
+ *
+ * @param projectName - Name of the project
+ * @param scan - Security scan settings of the project
+ * @param workingDir - Resolved project directory
+ * @param planJsonPath - Path to the output of `terraform show -json` (required for target: plan)
+ * @returns Findings and how many of them block apply
+ * @throws Error if the scanner is not installed, fails or returns unexpected output
+ */
+export async function scanProject(
+  projectName: string,
+  scan: SecurityScanConfig,
+  workingDir: string,
+  planJsonPath?: string
+): Promise<SecurityScanResult> {
+  core.startGroup(`Scanning project ${projectName} with ${scan.tool}`);
+  try {
+    const target = scan.target === 'plan' ? planJsonPath : workingDir;
+    if (!target) {
+      throw new Error(`${scan.tool} needs the plan of project ${projectName}, which was not saved`);
+    }
+    const output = await executeSecurityScanner(
+      scan.tool,
+      scan.target ?? 'dir',
+      target,
+      workingDir
+    );
+    const findings = parseSecurityFindings(scan.tool, output, workingDir);
+    const { block_on: blockOn } = scan;
+    const blocking = blockOn ? findings.filter((f) => isBlockingFinding(f, blockOn)).length : 0;
+    core.info(
+      `${scan.tool} reported ${findings.length} finding(s)` +
+        (blockOn ? `, ${blocking} at or above ${blockOn}` : '')
+    );
+    return { tool: scan.tool, findings, blockOn, blocking };
+  } finally {
+    core.endGroup();
+  }
+}
@@ -0,0 +1,28 @@
+/**
+ * Unit tests for "did you mean" suggestions
+ */
+
+import { suggestClosest } from './suggestions';
+
+describe('suggestions', () => {
+  describe('suggestClosest', () => {
+    const fields = ['plan_requirements', 'apply_requirements', 'enabled'];
+
+    it.each([
+      ['aply_requirements', 'apply_requirements'],
+      ['apply_requirments', 'apply_requirements'],
+      ['Enabeld', 'enabled'],
+    ])('should suggest %s -> %s', (word, expected) => {
+      expect(suggestClosest(word, fields)).toBe(expected);
+    });
+
+    it('should prefer the candidate with the fewest edits', () => {
+      expect(suggestClosest('plann', ['planning', 'plan'])).toBe('plan');
+    });
+
+    it('should not suggest words that are too different', () => {
+      expect(suggestClosest('color', fields)).toBeUndefined();
+      expect(suggestClosest('xy', ['ab'])).toBeUndefined();
+    });
+  });
+});
@@ -0,0 +1,59 @@
+/**
+ * "Did you mean" suggestions for mistyped words
+ */
+
+/**
+ * Finds the known word a mistyped word most likely meant
+ *
+ * @param word - Word as given
+ * @param candidates - Known words
+ * @returns Closest candidate within two edits (fewer for short words), or undefined if none
+ *   is that close
+ *
+ * @example
+ * suggestClosest('aplly', ['plan', 'apply'])
+ * // => 'apply'
+ */
+export function suggestClosest<T extends string>(
+  word: string,
+  candidates: readonly T[]
+): T | undefined {
+  const lower = word.toLowerCase();
+  const maxDistance = Math.min(2, lower.length - 2);
+  let best: { candidate: T; distance: number } | undefined;
+
+  for (const candidate of candidates) {
+    const distance = editDistance(lower, candidate.toLowerCase());
+    if (distance <= maxDistance && (!best || distance < best.distance)) {
+      best = { candidate, distance };
+    }
+  }
+
+  return best?.candidate;
+}
+
+/**
+ * Counts the single-character insertions, deletions, substitutions and adjacent swaps
+ * that turn one word into another
+ *
+ * @param a - First word
+ * @param b - Second word
+ * @returns Edit distance
+ */
+function editDistance(a: string, b: string): number {
+  const d: number[][] = Array.from({ length: a.length + 1 }, (_, i) =>
+    Array.from({ length: b.length + 1 }, (_, j) => (i === 0 ? j : j === 0 ? i : 0))
+  );
+
+  for (let i = 1; i <= a.length; i++) {
+    for (let j = 1; j <= b.length; j++) {
+      const cost = a[i - 1] === b[j - 1] ? 0 : 1;
+      d[i][j] = Math.min(d[i - 1][j] + 1, d[i][j - 1] + 1, d[i - 1][j - 1] + cost);
+      if (i > 1 && j > 1 && a[i - 1] === b[j - 2] && a[i - 2] === b[j - 1]) {
+        d[i][j] = Math.min(d[i][j], d[i - 2][j - 2] + 1);
+      }
+    }
+  }
+
+  return d[a.length][b.length];
+}
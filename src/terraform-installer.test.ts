@@ -0,0 +1,194 @@
+/**
+ * Unit tests for terraform download and setup
+ */
+
+import * as crypto from 'node:crypto';
+import * as os from 'node:os';
+import * as tc from '@actions/tool-cache';
+import {
+  findChecksum,
+  installTerraform,
+  installTerragrunt,
+  resolveLatestOpenTofuVersion,
+} from './terraform-installer';
+
+// Mock fs module
+jest.mock('node:fs', () => {
+  const actualFs = jest.requireActual('node:fs');
+  return {
+    ...actualFs,
+    readFileSync: jest.fn(),
+    chmodSync: jest.fn(),
+  };
+});
+
+// Mock the modules
+jest.mock('node:os');
+jest.mock('@actions/core');
+jest.mock('@actions/tool-cache');
+
+// Import the mocked fs module
+import * as fs from 'node:fs';
+
+describe('terraform-installer', () => {
+  const mockOs = os as jest.Mocked<typeof os>;
+  const mockTc = tc as jest.Mocked<typeof tc>;
+  const mockReadFileSync = fs.readFileSync as jest.MockedFunction<typeof fs.readFileSync>;
+  const mockChmodSync = fs.chmodSync as jest.MockedFunction<typeof fs.chmodSync>;
+
+  const archive = Buffer.from('terraform archive');
+  const checksum = crypto.createHash('sha256').update(archive).digest('hex');
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    mockOs.platform.mockReturnValue('linux');
+    mockOs.arch.mockReturnValue('x64');
+    mockChmodSync.mockImplementation(() => undefined);
+    mockTc.downloadTool.mockImplementation(async (url: string) =>
+      url.endsWith('SHA256SUMS') ? '/tmp/sums' : '/tmp/terraform.zip'
+    );
+    mockTc.extractZip.mockResolvedValue('/tmp/extracted');
+    mockTc.cacheDir.mockResolvedValue('/opt/hostedtoolcache/terraform/1.7.0/x64');
+  });
+
+  function useSums(sums: string): void {
+    mockReadFileSync.mockImplementation(((file: string) =>
+      file === '/tmp/sums' ? sums : archive) as any);
+  }
+
+  describe('findChecksum', () => {
+    it('should find the checksum of the file', () => {
+      const sums = 'aaa  terraform_1.7.0_darwin_arm64.zip\nBBB  terraform_1.7.0_linux_amd64.zip\n';
+
+      expect(findChecksum(sums, 'terraform_1.7.0_linux_amd64.zip')).toBe('bbb');
+      expect(findChecksum(sums, 'terraform_1.7.0_windows_amd64.zip')).toBeNull();
+    });
+  });
+
+  describe('installTerraform', () => {
+    it('should download, verify and cache the release', async () => {
+      useSums(`${checksum}  terraform_1.7.0_linux_amd64.zip\n`);
+
+      const result = await installTerraform('1.7.0');
+
+      expect(mockTc.downloadTool).toHaveBeenCalledWith(
+        'https://releases.hashicorp.com/terraform/1.7.0/terraform_1.7.0_linux_amd64.zip'
+      );
+      expect(mockTc.downloadTool).toHaveBeenCalledWith(
+        'https://releases.hashicorp.com/terraform/1.7.0/terraform_1.7.0_SHA256SUMS'
+      );
+      expect(mockChmodSync).toHaveBeenCalledWith('/tmp/extracted/terraform', 0o755);
+      expect(mockTc.cacheDir).toHaveBeenCalledWith('/tmp/extracted', 'terraform', '1.7.0');
+      expect(result).toBe('/opt/hostedtoolcache/terraform/1.7.0/x64/terraform');
+    });
+
+    it('should download OpenTofu from its GitHub releases', async () => {
+      useSums(`${checksum}  tofu_1.8.3_linux_amd64.zip\n`);
+      mockTc.cacheDir.mockResolvedValue('/opt/hostedtoolcache/tofu/1.8.3/x64');
+
+      const result = await installTerraform('1.8.3', 'tofu');
+
+      expect(mockTc.downloadTool).toHaveBeenCalledWith(
+        'https://github.com/opentofu/opentofu/releases/download/v1.8.3/tofu_1.8.3_linux_amd64.zip'
+      );
+      expect(mockTc.downloadTool).toHaveBeenCalledWith(
+        'https://github.com/opentofu/opentofu/releases/download/v1.8.3/tofu_1.8.3_SHA256SUMS'
+      );
+      expect(mockTc.cacheDir).toHaveBeenCalledWith('/tmp/extracted', 'tofu', '1.8.3');
+      expect(result).toBe('/opt/hostedtoolcache/tofu/1.8.3/x64/tofu');
+    });
+
+    it('should reject an archive that does not match its checksum', async () => {
+      useSums(`${'0'.repeat(64)}  terraform_1.7.0_linux_amd64.zip\n`);
+
+      await expect(installTerraform('1.7.0')).rejects.toThrow(
+        'Checksum mismatch for terraform_1.7.0_linux_amd64.zip'
+      );
+      expect(mockTc.extractZip).not.toHaveBeenCalled();
+      expect(mockTc.cacheDir).not.toHaveBeenCalled();
+    });
+
+    it('should reject a release without a checksum for the platform', async () => {
+      mockOs.arch.mockReturnValue('arm64');
+      useSums(`${checksum}  terraform_1.7.0_linux_amd64.zip\n`);
+
+      await expect(installTerraform('1.7.0')).rejects.toThrow(
+        'No checksum published for terraform_1.7.0_linux_arm64.zip'
+      );
+    });
+
+    it('should throw when the download fails', async () => {
+      mockTc.downloadTool.mockRejectedValue(new Error('Unexpected HTTP response: 404'));
+
+      await expect(installTerraform('9.9.9')).rejects.toThrow(
+        'Failed to download terraform 9.9.9: Unexpected HTTP response: 404'
+      );
+    });
+  });
+
+  describe('installTerragrunt', () => {
+    it('should download, verify and cache the binary', async () => {
+      mockTc.find.mockReturnValue('');
+      mockTc.cacheFile.mockResolvedValue('/opt/hostedtoolcache/terragrunt/0.55.1/x64');
+      useSums(`${checksum}  terragrunt_linux_amd64\n`);
+
+      const result = await installTerragrunt('0.55.1');
+
+      expect(mockTc.downloadTool).toHaveBeenCalledWith(
+        'https://github.com/gruntwork-io/terragrunt/releases/download/v0.55.1/terragrunt_linux_amd64'
+      );
+      expect(mockTc.downloadTool).toHaveBeenCalledWith(
+        'https://github.com/gruntwork-io/terragrunt/releases/download/v0.55.1/SHA256SUMS'
+      );
+      expect(mockChmodSync).toHaveBeenCalledWith('/tmp/terraform.zip', 0o755);
+      expect(mockTc.cacheFile).toHaveBeenCalledWith(
+        '/tmp/terraform.zip',
+        'terragrunt',
+        'terragrunt',
+        '0.55.1'
+      );
+      expect(result).toBe('/opt/hostedtoolcache/terragrunt/0.55.1/x64/terragrunt');
+    });
+
+    it('should use a cached version without downloading it', async () => {
+      mockTc.find.mockReturnValue('/opt/hostedtoolcache/terragrunt/0.55.1/x64');
+
+      const result = await installTerragrunt('0.55.1');
+
+      expect(result).toBe('/opt/hostedtoolcache/terragrunt/0.55.1/x64/terragrunt');
+      expect(mockTc.downloadTool).not.toHaveBeenCalled();
+    });
+
+    it('should reject a binary that does not match its checksum', async () => {
+      mockTc.find.mockReturnValue('');
+      useSums(`${'0'.repeat(64)}  terragrunt_linux_amd64\n`);
+
+      await expect(installTerragrunt('0.55.1')).rejects.toThrow(
+        'Checksum mismatch for terragrunt_linux_amd64'
+      );
+      expect(mockTc.cacheFile).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('resolveLatestOpenTofuVersion', () => {
+    it('should pick the newest stable version from the releases API', async () => {
+      mockTc.downloadTool.mockResolvedValue('/tmp/api.json');
+      mockReadFileSync.mockReturnValue(
+        JSON.stringify({
+          versions: [{ id: '1.9.0-beta1' }, { id: '1.8.10' }, { id: '1.8.9' }, { id: '1.7.3' }],
+        })
+      );
+
+      await expect(resolveLatestOpenTofuVersion()).resolves.toBe('1.8.10');
+      expect(mockTc.downloadTool).toHaveBeenCalledWith('https://get.opentofu.org/tofu/api.json');
+    });
+
+    it('should throw when the releases API cannot be read', async () => {
+      mockTc.downloadTool.mockRejectedValue(new Error('Unexpected HTTP response: 503'));
+
+      await expect(resolveLatestOpenTofuVersion()).rejects.toThrow(
+        'Failed to read OpenTofu releases: Unexpected HTTP response: 503'
+      );
+    });
+  });
+});
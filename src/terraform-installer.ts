@@ -0,0 +1,281 @@
+/**
+ * Terraform (and OpenTofu, Terragrunt) download and setup from official releases
+ */
+
+import * as crypto from 'node:crypto';
+import * as fs from 'node:fs';
+import * as os from 'node:os';
+import * as path from 'node:path';
+import * as core from '@actions/core';
+import * as tc from '@actions/tool-cache';
+import type { TerraformBinary } from './types';
+
+/**
+ * Base URL of the HashiCorp releases site
+ */
+const RELEASES_URL = 'https://releases.hashicorp.com/terraform';
+
+/**
+ * Base URL of OpenTofu release downloads (tags are prefixed with v)
+ */
+const OPENTOFU_RELEASES_URL = 'https://github.com/opentofu/opentofu/releases/download';
+
+/**
+ * Base URL of Terragrunt release downloads (tags are prefixed with v)
+ */
+const TERRAGRUNT_RELEASES_URL = 'https://github.com/gruntwork-io/terragrunt/releases/download';
+
+/**
+ * OpenTofu releases API listing every published version
+ */
+const OPENTOFU_API_URL = 'https://get.opentofu.org/tofu/api.json';
+
+/**
+ * Matches an exact terraform version, e.g. 1.7.0 or 1.8.0-rc1
+ */
+export const EXACT_VERSION_PATTERN = /^\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?$/;
+
+/**
+ * Maps Node.js platform to HashiCorp platform naming
+ */
+function getTerraformPlatform(): string {
+  const platform = os.platform();
+
+  switch (platform) {
+    case 'linux':
+      return 'linux';
+    case 'darwin':
+      return 'darwin';
+    case 'win32':
+      return 'windows';
+    default:
+      throw new Error(`Unsupported platform: ${platform}`);
+  }
+}
+
+/**
+ * Maps Node.js architecture to HashiCorp architecture naming
+ */
+function getTerraformArch(): string {
+  const arch = os.arch();
+
+  switch (arch) {
+    case 'x64':
+      return 'amd64';
+    case 'arm64':
+      return 'arm64';
+    case 'arm':
+      return 'arm';
+    default:
+      throw new Error(`Unsupported architecture: ${arch}`);
+  }
+}
+
+/**
+ * Finds the checksum of a file in a SHA256SUMS listing
+ *
+ * @param sums - Contents of the SHA256SUMS file
+ * @param fileName - File to look up
+ * @returns Lowercase hex SHA-256 checksum, or null if the file is not listed
+ *
+ * @example
+ * findChecksum('5f3e...  terraform_1.7.0_linux_amd64.zip\n', 'terraform_1.7.0_linux_amd64.zip')
+ * // => '5f3e...'
+ */
+export function findChecksum(sums: string, fileName: string): string | null {
+  for (const line of sums.split('\n')) {
+    const [checksum, name] = line.trim().split(/\s+/);
+    if (name === fileName && checksum) {
+      return checksum.toLowerCase();
+    }
+  }
+  return null;
+}
+
+/**
+ * Builds the download URLs of a release archive and its checksums
+ *
+ * @param binary - terraform or tofu
+ * @param version - Exact version
+ * @param platform - HashiCorp platform name (e.g., linux)
+ * @param arch - HashiCorp architecture name (e.g., amd64)
+ * @returns Archive file name and URLs of the archive and the SHA256SUMS file
+ */
+function getReleaseUrls(
+  binary: TerraformBinary,
+  version: string,
+  platform: string,
+  arch: string
+): { fileName: string; archiveUrl: string; sumsUrl: string } {
+  const fileName = `${binary}_${version}_${platform}_${arch}.zip`;
+  const baseUrl =
+    binary === 'tofu' ? `${OPENTOFU_RELEASES_URL}/v${version}` : `${RELEASES_URL}/${version}`;
+  return {
+    fileName,
+    archiveUrl: `${baseUrl}/${fileName}`,
+    sumsUrl: `${baseUrl}/${binary}_${version}_SHA256SUMS`,
+  };
+}
+
+/**
+ * Compares two exact versions numerically (prerelease suffixes are ignored)
+ */
+function compareVersions(a: string, b: string): number {
+  const pa = a.split('-')[0].split('.').map(Number);
+  const pb = b.split('-')[0].split('.').map(Number);
+  for (let i = 0; i < 3; i++) {
+    if (pa[i] !== pb[i]) {
+      return pa[i] - pb[i];
+    }
+  }
+  return 0;
+}
+
+/**
+ * Resolves the latest stable OpenTofu version from the OpenTofu releases API
+ *
+ * @returns Latest version without prereleases (e.g., 1.8.3)
+ * @throws Error if the API cannot be read or lists no stable version
+ */
+export async function resolveLatestOpenTofuVersion(): Promise<string> {
+  let versions: string[];
+  try {
+    const apiPath = await tc.downloadTool(OPENTOFU_API_URL);
+    const api = JSON.parse(fs.readFileSync(apiPath, 'utf8')) as { versions?: { id?: unknown }[] };
+    versions = (api.versions ?? []).map((v) => String(v.id ?? ''));
+  } catch (error) {
+    throw new Error(
+      `Failed to read OpenTofu releases: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+
+  const stable = versions.filter((v) => /^\d+\.\d+\.\d+$/.test(v)).sort(compareVersions);
+  const latest = stable[stable.length - 1];
+  if (!latest) {
+    throw new Error('The OpenTofu releases API lists no stable version');
+  }
+  core.info(`Latest OpenTofu version: ${latest}`);
+  return latest;
+}
+
+/**
+ * Downloads a terraform release, verifies its checksum and adds it to the tool cache
+ *
+ * @param version - Exact version to install (e.g., 1.7.0)
+ * @param binary - terraform (from HashiCorp releases) or tofu (from OpenTofu releases)
+ * @returns Path to the binary in the tool cache
+ * @throws Error if the download fails or the archive does not match the published checksum
+ *
+ * @remarks
+ * The archive is checked against the release's SHA256SUMS file, fetched over HTTPS
+ * from the same site. The cached binary is found with tc.find by later calls, so
+ * each version is downloaded once per runner.
+ */
+export async function installTerraform(
+  version: string,
+  binary: TerraformBinary = 'terraform'
+): Promise<string> {
+  const platform = getTerraformPlatform();
+  const arch = getTerraformArch();
+  const { fileName, archiveUrl, sumsUrl } = getReleaseUrls(binary, version, platform, arch);
+
+  core.info(`Downloading ${binary} ${version} from ${archiveUrl}`);
+
+  let archivePath: string;
+  let sums: string;
+  try {
+    archivePath = await tc.downloadTool(archiveUrl);
+    sums = fs.readFileSync(await tc.downloadTool(sumsUrl), 'utf8');
+  } catch (error) {
+    throw new Error(
+      `Failed to download ${binary} ${version}: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+
+  const expected = findChecksum(sums, fileName);
+  if (!expected) {
+    throw new Error(`No checksum published for ${fileName}`);
+  }
+  const actual = crypto.createHash('sha256').update(fs.readFileSync(archivePath)).digest('hex');
+  if (actual !== expected) {
+    throw new Error(`Checksum mismatch for ${fileName}: expected ${expected}, got ${actual}`);
+  }
+
+  let extractedPath: string;
+  try {
+    extractedPath = await tc.extractZip(archivePath);
+  } catch (error) {
+    throw new Error(
+      `Failed to extract ${binary} ${version}: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+
+  const binaryName = platform === 'windows' ? `${binary}.exe` : binary;
+  if (platform !== 'windows') {
+    fs.chmodSync(path.join(extractedPath, binaryName), 0o755);
+  }
+
+  const cachedDir = await tc.cacheDir(extractedPath, binary, version);
+  const binaryPath = path.join(cachedDir, binaryName);
+  core.info(`${binary} ${version} setup complete: ${binaryPath}`);
+
+  return binaryPath;
+}
+
+/**
+ * Downloads a terragrunt release, verifies its checksum and adds it to the tool cache
+ *
+ * @param version - Exact version to install (e.g., 0.55.1)
+ * @returns Path to the binary in the tool cache
+ * @throws Error if the download fails or the binary does not match the published checksum
+ *
+ * @remarks
+ * Terragrunt releases are single binaries rather than archives, checked against the
+ * release's SHA256SUMS file. A version already in the tool cache is not downloaded again.
+ */
+export async function installTerragrunt(version: string): Promise<string> {
+  const platform = getTerraformPlatform();
+  const extension = platform === 'windows' ? '.exe' : '';
+  const binaryName = `terragrunt${extension}`;
+
+  const cachedDir = tc.find('terragrunt', version);
+  if (cachedDir) {
+    const cachedPath = path.join(cachedDir, binaryName);
+    core.info(`Using cached terragrunt ${version}: ${cachedPath}`);
+    return cachedPath;
+  }
+
+  const fileName = `terragrunt_${platform}_${getTerraformArch()}${extension}`;
+  const baseUrl = `${TERRAGRUNT_RELEASES_URL}/v${version}`;
+  core.info(`Downloading terragrunt ${version} from ${baseUrl}/${fileName}`);
+
+  let downloadPath: string;
+  let sums: string;
+  try {
+    downloadPath = await tc.downloadTool(`${baseUrl}/${fileName}`);
+    sums = fs.readFileSync(await tc.downloadTool(`${baseUrl}/SHA256SUMS`), 'utf8');
+  } catch (error) {
+    throw new Error(
+      `Failed to download terragrunt ${version}: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+
+  const expected = findChecksum(sums, fileName);
+  if (!expected) {
+    throw new Error(`No checksum published for ${fileName}`);
+  }
+  const actual = crypto.createHash('sha256').update(fs.readFileSync(downloadPath)).digest('hex');
+  if (actual !== expected) {
+    throw new Error(`Checksum mismatch for ${fileName}: expected ${expected}, got ${actual}`);
+  }
+
+  if (platform !== 'windows') {
+    fs.chmodSync(downloadPath, 0o755);
+  }
+
+  const toolDir = await tc.cacheFile(downloadPath, binaryName, 'terragrunt', version);
+  const binaryPath = path.join(toolDir, binaryName);
+  core.info(`terragrunt ${version} setup complete: ${binaryPath}`);
+
+  return binaryPath;
+}
@@ -4,20 +4,73 @@
 
 import * as core from '@actions/core';
 import * as exec from '@actions/exec';
+import * as io from '@actions/io';
+import * as tc from '@actions/tool-cache';
+import * as fs from 'node:fs';
+import * as os from 'node:os';
 import * as path from 'node:path';
 import {
+  buildCommandLine,
+  buildInitArgs,
+  buildStateFlags,
+  buildTfcmtArgs,
+  buildVarFlags,
+  collectDiagnostics,
+  type CommandRunner,
+  executeDriftCheck,
+  executeImportPlan,
+  executeRunStep,
+  executeSecurityScanner,
   executeTerraform,
+  executeTerraformDestroy,
+  executeTerraformForceUnlock,
+  executeTerraformImport,
+  executeTerraformInit,
+  executeTerraformOutput,
+  executeTerraformShow,
+  executeTerraformShowJson,
+  executeTerraformState,
   executeTerraformWithTfcmt,
+  findRequestedTerraformVersion,
+  findTransientError,
+  formatCommandLine,
+  isDebugEnabled,
+  isLockHeldByThisRunner,
+  parseStateLock,
+  parseTerraformOutputs,
+  redactCommandLine,
+  resolveTerraformBinary,
+  setCommandRunner,
+  setDebugCommandLines,
+  setPluginCache,
+  TerraformCommandError,
+  TERRAGRUNT_CONFIG_FILE,
+  usesTerragrunt,
   validateTerraformInstalled,
+  validateTerragruntInstalled,
 } from './terraform';
+import { installTerraform, resolveLatestOpenTofuVersion } from './terraform-installer';
 
-// Mock the @actions/core and @actions/exec modules
+// Mock the @actions modules
 jest.mock('@actions/core');
 jest.mock('@actions/exec');
+jest.mock('@actions/io');
+jest.mock('@actions/tool-cache');
+jest.mock('./terraform-installer', () => ({
+  ...jest.requireActual('./terraform-installer'),
+  installTerraform: jest.fn(),
+  resolveLatestOpenTofuVersion: jest.fn(),
+}));
 
 describe('terraform', () => {
   const mockCore = core as jest.Mocked<typeof core>;
   const mockExec = exec as jest.Mocked<typeof exec>;
+  const mockIo = io as jest.Mocked<typeof io>;
+  const mockTc = tc as jest.Mocked<typeof tc>;
+  const mockInstallTerraform = installTerraform as jest.MockedFunction<typeof installTerraform>;
+  const mockResolveLatestOpenTofuVersion = resolveLatestOpenTofuVersion as jest.MockedFunction<
+    typeof resolveLatestOpenTofuVersion
+  >;
 
   beforeEach(() => {
     // Clear all mocks before each test
@@ -42,8 +95,8 @@ describe('terraform', () => {
 
       // Verify terraform init was called
       expect(mockExec.exec).toHaveBeenCalledWith(
-        'terraform init',
-        [],
+        'terraform',
+        ['init'],
         expect.objectContaining({
           cwd: workingDir,
           ignoreReturnCode: true,
@@ -192,6 +245,39 @@ describe('terraform', () => {
       ).rejects.toThrow('Terraform plan failed with exit code 1');
     });
 
+    it('should report tfcmt-wrapped failures as already posted', async () => {
+      mockExec.exec.mockResolvedValueOnce(0); // terraform init succeeds
+      mockExec.exec.mockResolvedValueOnce(1); // terraform plan fails
+
+      const error = await executeTerraform(tfcmtPath, 'plan', workingDir, projectName).catch(
+        (e) => e
+      );
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('plan');
+      expect(error.reportedByTfcmt).toBe(true);
+    });
+
+    it('should throw and skip tfcmt when terraform init fails', async () => {
+      mockExec.exec.mockImplementationOnce(
+        async (_commandLine: string, _args?: string[], options?: exec.ExecOptions) => {
+          options?.listeners?.stderr?.(Buffer.from('Error: Failed to get existing workspaces'));
+          return 1;
+        }
+      );
+
+      const error = await executeTerraform(tfcmtPath, 'plan', workingDir, projectName).catch(
+        (e) => e
+      );
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.message).toContain('Terraform init failed with exit code 1');
+      expect(error.subcommand).toBe('init');
+      expect(error.output).toContain('Failed to get existing workspaces');
+      expect(error.reportedByTfcmt).toBe(false);
+      expect(mockExec.exec).toHaveBeenCalledTimes(1);
+    });
+
     it('should capture stdout and stderr from terraform execution', async () => {
       const mockStdout = 'Plan: 1 to add, 0 to change, 0 to destroy.';
       const mockStderr = 'Warning: some warning message';
@@ -266,105 +352,2053 @@ describe('terraform', () => {
     });
   });
 
-  describe('executeTerraformWithTfcmt', () => {
+  describe('buildCommandLine', () => {
+    const workingDir = '/path/to/terraform';
+
+    it('should invoke terraform directly by default', () => {
+      expect(buildCommandLine('plan', workingDir, 'terraform')).toEqual(['terraform', 'plan']);
+    });
+
+    it('should invoke terragrunt with non-interactive flags', () => {
+      expect(buildCommandLine('apply', workingDir, 'terraform', { terragrunt: true })).toEqual([
+        'terragrunt',
+        'apply',
+        '--terragrunt-non-interactive',
+        '--terragrunt-working-dir',
+        workingDir,
+      ]);
+    });
+
+    it('should detect terragrunt from a terragrunt.hcl unless it is turned off', () => {
+      const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'terraform-action-'));
+      try {
+        expect(usesTerragrunt(dir)).toBe(false);
+        expect(usesTerragrunt(dir, { terragruntRunAll: true })).toBe(true);
+
+        fs.writeFileSync(path.join(dir, TERRAGRUNT_CONFIG_FILE), 'include "root" {}\n');
+
+        expect(usesTerragrunt(dir)).toBe(true);
+        expect(usesTerragrunt(dir, { terragrunt: false })).toBe(false);
+        expect(buildCommandLine('plan', dir, 'terraform')[0]).toBe('terragrunt');
+      } finally {
+        fs.rmSync(dir, { recursive: true, force: true });
+      }
+    });
+
+    it('should use run-all when configured', () => {
+      expect(
+        buildCommandLine('plan', workingDir, 'terraform', {
+          terragrunt: true,
+          terragruntRunAll: true,
+        })
+      ).toEqual([
+        'terragrunt',
+        'run-all',
+        'plan',
+        '--terragrunt-non-interactive',
+        '--terragrunt-working-dir',
+        workingDir,
+      ]);
+    });
+
+    it('should pass a pinned terraform binary to terragrunt', () => {
+      expect(
+        buildCommandLine('init', workingDir, '/opt/terraform/1.5.7/terraform', { terragrunt: true })
+      ).toEqual([
+        'terragrunt',
+        'init',
+        '--terragrunt-non-interactive',
+        '--terragrunt-working-dir',
+        workingDir,
+        '--terragrunt-tfpath',
+        '/opt/terraform/1.5.7/terraform',
+      ]);
+    });
+  });
+
+  describe('buildStateFlags', () => {
+    it('should render refresh and lock timeout flags', () => {
+      expect(buildStateFlags({ refresh: false, lockTimeout: '5m' }, false)).toEqual([
+        '-refresh=false',
+        '-lock-timeout=5m',
+      ]);
+    });
+
+    it('should omit flags that keep terraform defaults', () => {
+      expect(buildStateFlags({ refresh: true }, false)).toEqual([]);
+      expect(buildStateFlags({}, false)).toEqual([]);
+    });
+
+    it('should not pass -refresh when applying a saved plan', () => {
+      expect(buildStateFlags({ refresh: false, lockTimeout: '30s' }, true)).toEqual([
+        '-lock-timeout=30s',
+      ]);
+    });
+  });
+
+  describe('buildVarFlags', () => {
+    it('should pass var files as absolute paths before the variables', () => {
+      expect(
+        buildVarFlags(
+          { varFiles: ['prod.tfvars', '../common.tfvars'], vars: { region: 'us-east-1' } },
+          '/repo/prod',
+          false
+        )
+      ).toEqual([
+        '-var-file=/repo/prod/prod.tfvars',
+        '-var-file=/repo/common.tfvars',
+        '-var=region=us-east-1',
+      ]);
+    });
+
+    it('should not pass variables when applying a saved plan', () => {
+      expect(buildVarFlags({ vars: { region: 'us-east-1' } }, '/repo/prod', true)).toEqual([]);
+    });
+  });
+
+  describe('buildTfcmtArgs', () => {
+    it('should pass project variables before the comment arguments', () => {
+      const { args } = buildTfcmtArgs(
+        'plan',
+        '/repo/prod',
+        'prod',
+        'terraform',
+        ['-var=region=eu-west-1'],
+        undefined,
+        { vars: { region: 'us-east-1' } }
+      );
+
+      expect(args.slice(-4)).toEqual([
+        '-var=region=us-east-1',
+        '-var=region=eu-west-1',
+        '-no-color',
+        '-input=false',
+      ]);
+    });
+
+    it('should save the plan and pass additional args after the planning flags', () => {
+      expect(
+        buildTfcmtArgs(
+          'plan',
+          '/repo/prod',
+          'prod',
+          'terraform',
+          ['-target=aws_instance.web'],
+          undefined,
+          { lockTimeout: '5m' }
+        )
+      ).toEqual({
+        args: [
+          '-var',
+          'target:prod',
+          'plan',
+          '--',
+          'terraform',
+          'plan',
+          '-out=/repo/prod/tfplan-prod',
+          '-lock-timeout=5m',
+          '-target=aws_instance.web',
+          '-no-color',
+          '-input=false',
+        ],
+        planFilePath: '/repo/prod/tfplan-prod',
+        usingPlanFile: false,
+      });
+    });
+
+    it('should apply a saved plan and write the result to a file', () => {
+      expect(
+        buildTfcmtArgs(
+          'apply',
+          '/repo/prod',
+          'prod',
+          'terraform',
+          [],
+          '/tmp/tfplan-prod',
+          { refresh: false },
+          '/tmp/tfcmt-apply-prod.md'
+        )
+      ).toEqual({
+        args: [
+          '-output',
+          '/tmp/tfcmt-apply-prod.md',
+          '-var',
+          'target:prod',
+          'apply',
+          '--',
+          'terraform',
+          'apply',
+          '/tmp/tfplan-prod',
+          '-no-color',
+          '-input=false',
+        ],
+        planFilePath: undefined,
+        usingPlanFile: true,
+      });
+    });
+
+    it('should pass the tfcmt configuration with the comment templates', () => {
+      const { args } = buildTfcmtArgs('plan', '/repo/prod', 'prod', 'terraform', [], undefined, {
+        tfcmtConfigPath: '/tmp/tfcmt-config.yaml',
+      });
+
+      expect(args.slice(0, 4)).toEqual([
+        '-config',
+        '/tmp/tfcmt-config.yaml',
+        '-var',
+        'target:prod',
+      ]);
+    });
+
+    it('should auto-approve an apply without a saved plan', () => {
+      const { args, usingPlanFile } = buildTfcmtArgs('apply', '/repo/prod', 'prod', 'terraform');
+
+      expect(args).toContain('-auto-approve');
+      expect(usingPlanFile).toBe(false);
+    });
+  });
+
+  describe('redactCommandLine', () => {
+    it('should mask -var and -backend-config values but keep their names', () => {
+      expect(
+        redactCommandLine([
+          'terraform',
+          'plan',
+          '-var=db_password=hunter2',
+          '-var',
+          'region=us-east-1',
+          '-backend-config=access_key=AKIA123',
+          '-backend-config',
+          'secret_key=abc',
+        ])
+      ).toEqual([
+        'terraform',
+        'plan',
+        '-var=db_password=***',
+        '-var',
+        'region=***',
+        '-backend-config=access_key=***',
+        '-backend-config',
+        'secret_key=***',
+      ]);
+    });
+
+    it('should keep backend config files, var files and the tfcmt target', () => {
+      const commandLine = [
+        'tfcmt',
+        '-var',
+        'target:prod',
+        'plan',
+        '--',
+        'terraform',
+        'plan',
+        '-var-file=prod.tfvars',
+        '-backend-config=backend.hcl',
+      ];
+
+      expect(redactCommandLine(commandLine)).toEqual(commandLine);
+    });
+  });
+
+  describe('formatCommandLine', () => {
+    it('should quote arguments the shell would split or expand', () => {
+      expect(
+        formatCommandLine([
+          'terraform',
+          'plan',
+          '-var=name=hello world',
+          "-var=quote=it's",
+          '-out=/tmp/p',
+        ])
+      ).toBe("terraform plan '-var=name=hello world' '-var=quote=it'\\''s' -out=/tmp/p");
+    });
+  });
+
+  describe('debug command lines', () => {
+    const originalEnv = process.env.TERRAFORM_ACTION_DEBUG;
+
+    afterEach(() => {
+      setDebugCommandLines(false);
+      setCommandRunner();
+      delete process.env.ACTIONS_STEP_DEBUG;
+      if (originalEnv === undefined) {
+        delete process.env.TERRAFORM_ACTION_DEBUG;
+      } else {
+        process.env.TERRAFORM_ACTION_DEBUG = originalEnv;
+      }
+    });
+
+    it('should be enabled by ACTIONS_STEP_DEBUG', () => {
+      delete process.env.TERRAFORM_ACTION_DEBUG;
+      process.env.ACTIONS_STEP_DEBUG = 'true';
+
+      expect(isDebugEnabled()).toBe(true);
+    });
+
+    it('should be enabled by the config flag or TERRAFORM_ACTION_DEBUG', () => {
+      delete process.env.TERRAFORM_ACTION_DEBUG;
+      expect(isDebugEnabled()).toBe(false);
+
+      setDebugCommandLines(true);
+      expect(isDebugEnabled()).toBe(true);
+
+      setDebugCommandLines(false);
+      process.env.TERRAFORM_ACTION_DEBUG = '1';
+      expect(isDebugEnabled()).toBe(true);
+
+      process.env.TERRAFORM_ACTION_DEBUG = 'true';
+      expect(isDebugEnabled()).toBe(true);
+
+      process.env.TERRAFORM_ACTION_DEBUG = '0';
+      expect(isDebugEnabled()).toBe(false);
+    });
+
+    it('should log each redacted command line before running it', async () => {
+      process.env.TERRAFORM_ACTION_DEBUG = '1';
+      setCommandRunner(async () => 0);
+
+      await executeTerraformImport('/repo/prod', 'test-project', 'aws_db.main', 'db-1', [
+        '-var=db_password=hunter2',
+      ]);
+
+      expect(mockCore.info).toHaveBeenCalledWith('[debug] terraform init');
+      expect(mockCore.info).toHaveBeenCalledWith(
+        '[debug] terraform import -var=db_password=*** -no-color -input=false aws_db.main db-1'
+      );
+      expect(JSON.stringify(mockCore.info.mock.calls)).not.toContain('hunter2');
+    });
+
+    it('should not log command lines by default', async () => {
+      delete process.env.TERRAFORM_ACTION_DEBUG;
+      setCommandRunner(async () => 0);
+
+      await executeTerraformState('/repo/prod', 'test-project', 'list');
+
+      expect(mockCore.info).not.toHaveBeenCalledWith(expect.stringContaining('[debug]'));
+    });
+  });
+
+  describe('executeTerraform with state options', () => {
     const tfcmtPath = '/usr/local/bin/tfcmt';
     const workingDir = '/path/to/terraform';
     const projectName = 'test-project';
 
-    it('should wrap executeTerraform with logging group', async () => {
+    it('should pass refresh and lock timeout to plan', async () => {
       mockExec.exec.mockResolvedValue(0);
 
-      await executeTerraformWithTfcmt(
+      await executeTerraform(tfcmtPath, 'plan', workingDir, projectName, [], undefined, {
+        refresh: false,
+        lockTimeout: '5m',
+      });
+
+      const expectedPlanPath = path.join(workingDir, `tfplan-${projectName}`);
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        tfcmtPath,
+        [
+          '-var',
+          `target:${projectName}`,
+          'plan',
+          '--',
+          'terraform',
+          'plan',
+          `-out=${expectedPlanPath}`,
+          '-refresh=false',
+          '-lock-timeout=5m',
+          '-no-color',
+          '-input=false',
+        ],
+        expect.any(Object)
+      );
+    });
+  });
+
+  describe('executeTerraform with suppressed comments', () => {
+    const tfcmtPath = '/usr/local/bin/tfcmt';
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+    const originalRunnerTemp = process.env.RUNNER_TEMP;
+
+    beforeEach(() => {
+      process.env.RUNNER_TEMP = '/tmp/runner';
+    });
+
+    afterEach(() => {
+      process.env.RUNNER_TEMP = originalRunnerTemp;
+    });
+
+    it('should write the tfcmt result to a file instead of commenting', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      const result = await executeTerraform(
         tfcmtPath,
         'plan',
+        workingDir,
         projectName,
-        workingDir
+        [],
+        undefined,
+        { suppressComment: true }
       );
 
-      expect(mockCore.startGroup).toHaveBeenCalledWith(
-        'Executing terraform plan for project: test-project'
-      );
-      expect(mockCore.endGroup).toHaveBeenCalled();
+      const tfcmtArgs = mockExec.exec.mock.calls[1][1] as string[];
+      expect(tfcmtArgs.slice(0, 4)).toEqual([
+        '-output',
+        path.join('/tmp/runner', `tfcmt-plan-${projectName}.md`),
+        '-var',
+        `target:${projectName}`,
+      ]);
+      expect(result.commentFilePath).toBe(path.join('/tmp/runner', `tfcmt-plan-${projectName}.md`));
     });
 
-    it('should call endGroup even if execution fails', async () => {
-      mockExec.exec.mockResolvedValueOnce(0); // terraform init
-      mockExec.exec.mockResolvedValueOnce(1); // terraform fails
+    it('should not report failures as posted when the comment was suppressed', async () => {
+      mockExec.exec.mockResolvedValueOnce(0); // terraform init succeeds
+      mockExec.exec.mockResolvedValueOnce(1); // terraform plan fails
 
-      await expect(
-        executeTerraformWithTfcmt(tfcmtPath, 'plan', projectName, workingDir)
-      ).rejects.toThrow();
+      const error = await executeTerraform(
+        tfcmtPath,
+        'plan',
+        workingDir,
+        projectName,
+        [],
+        undefined,
+        { suppressComment: true }
+      ).catch((e) => e);
 
-      expect(mockCore.startGroup).toHaveBeenCalled();
-      expect(mockCore.endGroup).toHaveBeenCalled();
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.reportedByTfcmt).toBe(false);
     });
+  });
 
-    it('should pass through additional arguments', async () => {
+  describe('executeTerraform with terragrunt', () => {
+    const tfcmtPath = '/usr/local/bin/tfcmt';
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should run init and plan through terragrunt', async () => {
       mockExec.exec.mockResolvedValue(0);
 
-      const additionalArgs = ['-var=foo=bar'];
-      await executeTerraformWithTfcmt(
+      const result = await executeTerraform(
         tfcmtPath,
         'plan',
-        projectName,
         workingDir,
-        additionalArgs
+        projectName,
+        [],
+        undefined,
+        { terragrunt: true }
       );
 
+      const expectedPlanPath = path.join(workingDir, `tfplan-${projectName}`);
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        'terragrunt',
+        ['init', '--terragrunt-non-interactive', '--terragrunt-working-dir', workingDir],
+        expect.any(Object)
+      );
       expect(mockExec.exec).toHaveBeenCalledWith(
         tfcmtPath,
-        expect.arrayContaining(['-var=foo=bar']),
+        [
+          '-var',
+          `target:${projectName}`,
+          'plan',
+          '--',
+          'terragrunt',
+          'plan',
+          '--terragrunt-non-interactive',
+          '--terragrunt-working-dir',
+          workingDir,
+          `-out=${expectedPlanPath}`,
+          '-no-color',
+          '-input=false',
+        ],
         expect.any(Object)
       );
+      expect(result.planFilePath).toBe(expectedPlanPath);
     });
 
-    it('should pass through plan file path for apply command', async () => {
+    it('should not save a plan file with run-all', async () => {
       mockExec.exec.mockResolvedValue(0);
 
-      const planFilePath = '/path/to/tfplan';
-      await executeTerraformWithTfcmt(
+      const result = await executeTerraform(
         tfcmtPath,
-        'apply',
+        'plan',
+        workingDir,
         projectName,
+        [],
+        undefined,
+        { terragrunt: true, terragruntRunAll: true }
+      );
+
+      expect(result.planFilePath).toBeUndefined();
+    });
+
+    it('should auto-approve run-all apply even with a plan file', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraform(
+        tfcmtPath,
+        'apply',
         workingDir,
+        projectName,
         [],
-        planFilePath
+        '/path/to/tfplan',
+        { terragrunt: true, terragruntRunAll: true }
       );
 
       expect(mockExec.exec).toHaveBeenCalledWith(
         tfcmtPath,
-        expect.arrayContaining([planFilePath]),
+        expect.arrayContaining(['run-all', 'apply', '-auto-approve']),
+        expect.any(Object)
+      );
+      expect(mockExec.exec).not.toHaveBeenCalledWith(
+        tfcmtPath,
+        expect.arrayContaining(['/path/to/tfplan']),
         expect.any(Object)
       );
     });
   });
 
-  describe('validateTerraformInstalled', () => {
-    it('should validate terraform is installed', async () => {
-      mockExec.exec.mockResolvedValue(0);
+  describe('buildInitArgs', () => {
+    it('should return no flags by default', () => {
+      expect(buildInitArgs({})).toEqual([]);
+    });
 
-      await expect(validateTerraformInstalled()).resolves.not.toThrow();
+    it('should combine the project upgrade setting with comment flags', () => {
+      expect(buildInitArgs({ initUpgrade: true, initArgs: ['-upgrade', '-reconfigure'] })).toEqual([
+        '-upgrade',
+        '-reconfigure',
+      ]);
+    });
 
-      expect(mockExec.exec).toHaveBeenCalledWith('terraform', ['version']);
-      expect(mockCore.info).toHaveBeenCalledWith(
-        'Validating Terraform installation...'
-      );
+    it('should skip the backend only when init_backend is false', () => {
+      expect(buildInitArgs({ initBackend: false })).toEqual(['-backend=false']);
+      expect(buildInitArgs({ initBackend: true })).toEqual([]);
     });
 
-    it('should throw error when terraform is not installed', async () => {
-      mockExec.exec.mockRejectedValue(new Error('Command not found'));
+    it('should pass backend config files before single settings', () => {
+      expect(
+        buildInitArgs(
+          { backendConfigFiles: ['prod.hcl'], backendConfig: { bucket: 'state-prod', key: 'app' } },
+          '/repo/app'
+        )
+      ).toEqual([
+        '-backend-config=/repo/app/prod.hcl',
+        '-backend-config=bucket=state-prod',
+        '-backend-config=key=app',
+        '-reconfigure',
+      ]);
+    });
 
-      await expect(validateTerraformInstalled()).rejects.toThrow(
-        'Terraform is not installed or not available in PATH'
-      );
+    it('should leave -reconfigure out when the comment migrates state', () => {
+      expect(
+        buildInitArgs({ backendConfig: { key: 'app' }, initArgs: ['-migrate-state'] })
+      ).toEqual(['-backend-config=key=app', '-migrate-state']);
     });
 
-    it('should throw error when terraform version check fails', async () => {
-      mockExec.exec.mockRejectedValue(new Error('Permission denied'));
+    it('should not pass backend config when the backend is skipped', () => {
+      expect(buildInitArgs({ initBackend: false, backendConfig: { bucket: 'b' } })).toEqual([
+        '-backend=false',
+      ]);
+    });
 
-      await expect(validateTerraformInstalled()).rejects.toThrow(
+    it('should pass the project init_extra_args after the comment flags', () => {
+      expect(
+        buildInitArgs({
+          initUpgrade: true,
+          initArgs: ['-reconfigure'],
+          initExtraArgs: ['-upgrade', '-lockfile=readonly'],
+        })
+      ).toEqual(['-upgrade', '-reconfigure', '-lockfile=readonly']);
+    });
+  });
+
+  describe('setPluginCache', () => {
+    let runnerTemp: string;
+
+    beforeEach(() => {
+      runnerTemp = fs.mkdtempSync(path.join(os.tmpdir(), 'plugin-cache-'));
+      process.env.RUNNER_TEMP = runnerTemp;
+      delete process.env.TF_PLUGIN_CACHE_DIR;
+    });
+
+    afterEach(() => {
+      setPluginCache(false);
+      delete process.env.RUNNER_TEMP;
+      delete process.env.TF_PLUGIN_CACHE_DIR;
+      fs.rmSync(runnerTemp, { recursive: true, force: true });
+    });
+
+    it('should create a cache under RUNNER_TEMP and pass it to every command', () => {
+      const dir = setPluginCache(true);
+
+      expect(dir).toBe(path.join(runnerTemp, 'terraform-plugin-cache'));
+      expect(fs.existsSync(dir as string)).toBe(true);
+      expect(process.env.TF_PLUGIN_CACHE_DIR).toBe(dir);
+    });
+
+    it('should keep a cache directory the workflow set', () => {
+      const workflowDir = path.join(runnerTemp, 'providers');
+      process.env.TF_PLUGIN_CACHE_DIR = workflowDir;
+
+      expect(setPluginCache(true)).toBe(workflowDir);
+      expect(fs.existsSync(workflowDir)).toBe(true);
+    });
+
+    it('should remove the cache it set when turned off', () => {
+      setPluginCache(true);
+
+      expect(setPluginCache(false)).toBeUndefined();
+      expect(process.env.TF_PLUGIN_CACHE_DIR).toBeUndefined();
+    });
+
+    it('should run inits one at a time while the cache is on', async () => {
+      setPluginCache(true);
+      const running: string[] = [];
+      let overlapped = false;
+      const init = async (_commandLine: string, _args?: string[], options?: exec.ExecOptions) => {
+        running.push(options?.cwd as string);
+        overlapped ||= running.length > 1;
+        await new Promise((resolve) => setTimeout(resolve, 5));
+        running.splice(running.indexOf(options?.cwd as string), 1);
+        return 0;
+      };
+      mockExec.exec.mockImplementationOnce(init).mockImplementationOnce(init);
+
+      await Promise.all([
+        executeTerraformInit('/repo/staging', 'staging'),
+        executeTerraformInit('/repo/production', 'production'),
+      ]);
+
+      expect(overlapped).toBe(false);
+      expect(mockExec.exec).toHaveBeenCalledTimes(2);
+    });
+
+    it('should keep running inits after one fails', async () => {
+      setPluginCache(true);
+      mockExec.exec.mockResolvedValueOnce(1).mockResolvedValueOnce(0);
+
+      const results = await Promise.allSettled([
+        executeTerraformInit('/repo/staging', 'staging'),
+        executeTerraformInit('/repo/production', 'production'),
+      ]);
+
+      expect(results.map((r) => r.status)).toEqual(['rejected', 'fulfilled']);
+    });
+  });
+
+  describe('executeTerraformInit', () => {
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should run init with the requested flags', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      const result = await executeTerraformInit(workingDir, projectName, {
+        initUpgrade: true,
+        initArgs: ['-migrate-state', '-force-copy'],
+      });
+
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        'terraform',
+        ['init', '-upgrade', '-migrate-state', '-force-copy', '-no-color', '-input=false'],
+        expect.objectContaining({ cwd: workingDir, ignoreReturnCode: true })
+      );
+      expect(result.exitCode).toBe(0);
+      expect(mockCore.startGroup).toHaveBeenCalledWith(
+        `Executing terraform init -upgrade -migrate-state -force-copy for project: ${projectName}`
+      );
+      expect(mockCore.endGroup).toHaveBeenCalled();
+    });
+
+    it('should throw a TerraformCommandError when init fails', async () => {
+      mockExec.exec.mockImplementationOnce(
+        async (_commandLine: string, _args?: string[], options?: exec.ExecOptions) => {
+          options?.listeners?.stderr?.(Buffer.from('Error: Backend configuration changed'));
+          return 1;
+        }
+      );
+
+      const error = await executeTerraformInit(workingDir, projectName).catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('init');
+      expect(error.output).toContain('Backend configuration changed');
+      expect(error.reportedByTfcmt).toBe(false);
+      expect(mockCore.endGroup).toHaveBeenCalled();
+    });
+
+    it('should pass -upgrade to the init that precedes plan', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      const tfcmtPath = '/usr/local/bin/tfcmt';
+      await executeTerraform(tfcmtPath, 'plan', workingDir, projectName, [], undefined, {
+        initUpgrade: true,
+      });
+
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        1,
+        'terraform',
+        ['init', '-upgrade'],
+        expect.any(Object)
+      );
+    });
+  });
+
+  describe('retrying transient errors', () => {
+    const tfcmtPath = '/usr/local/bin/tfcmt';
+    const workingDir = '/path/to/terraform';
+    const retry = { maxRetries: 2, backoffMs: 0, patterns: [/RequestError/, /i\/o timeout/] };
+
+    /**
+     * Makes the next command fail with the given error output
+     */
+    function failOnceWith(stderr: string): void {
+      mockExec.exec.mockImplementationOnce(
+        async (_commandLine: string, _args?: string[], options?: exec.ExecOptions) => {
+          options?.listeners?.stderr?.(Buffer.from(stderr));
+          return 1;
+        }
+      );
+    }
+
+    it('should retry a command that fails with a transient error', async () => {
+      failOnceWith('Error: RequestError: send request failed\ndial tcp: i/o timeout');
+      mockExec.exec.mockResolvedValueOnce(0);
+
+      const result = await executeTerraformInit(workingDir, 'test-project', { retry });
+
+      expect(result.exitCode).toBe(0);
+      expect(result.retries).toBe(1);
+      expect(mockExec.exec).toHaveBeenCalledTimes(2);
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'terraform init failed with a transient error, retry 1 of 2 in 0s: Error: RequestError: send request failed'
+      );
+    });
+
+    it('should not retry other failures', async () => {
+      failOnceWith('Error: Unsupported argument');
+
+      const error = await executeTerraformInit(workingDir, 'test-project', { retry }).catch(
+        (e) => e
+      );
+
+      expect(error.message).toContain('Terraform init failed with exit code 1:');
+      expect(mockExec.exec).toHaveBeenCalledTimes(1);
+      expect(mockCore.warning).not.toHaveBeenCalled();
+    });
+
+    it('should report the retries once they are used up', async () => {
+      failOnceWith('RequestError');
+      failOnceWith('RequestError');
+      failOnceWith('RequestError');
+
+      const error = await executeTerraformInit(workingDir, 'test-project', { retry }).catch(
+        (e) => e
+      );
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.message).toContain('Terraform init failed with exit code 1 after 2 retries:');
+      expect(mockExec.exec).toHaveBeenCalledTimes(3);
+    });
+
+    it('should retry a plan but never an apply', async () => {
+      mockExec.exec.mockResolvedValueOnce(0);
+      failOnceWith('RequestError');
+      mockExec.exec.mockResolvedValueOnce(0);
+      mockExec.exec.mockResolvedValueOnce(2);
+
+      const result = await executeTerraform(tfcmtPath, 'plan', workingDir, 'p', [], undefined, {
+        retry,
+      });
+
+      expect(result.hasChanges).toBe(true);
+      expect(mockExec.exec).toHaveBeenCalledTimes(4);
+
+      jest.clearAllMocks();
+      mockExec.exec.mockResolvedValueOnce(0);
+      failOnceWith('RequestError');
+
+      const error = await executeTerraform(tfcmtPath, 'apply', workingDir, 'p', [], undefined, {
+        retry,
+      }).catch((e) => e);
+
+      expect(error.subcommand).toBe('apply');
+      expect(mockExec.exec).toHaveBeenCalledTimes(2);
+    });
+
+    it('should find the first line matching a transient error pattern', () => {
+      const output = '╷\n│ Error: Failed to query providers\n│ 503 Service Unavailable\n╵';
+
+      expect(findTransientError(output, [/50[234] Service Unavailable/])).toBe(
+        '503 Service Unavailable'
+      );
+      expect(findTransientError(output, [/RequestError/])).toBeNull();
+    });
+  });
+
+  describe('executeDriftCheck', () => {
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should run plan with -detailed-exitcode and report drift on exit code 2', async () => {
+      mockExec.exec.mockResolvedValueOnce(0).mockResolvedValueOnce(2);
+
+      const result = await executeDriftCheck(workingDir, projectName, {
+        refresh: false,
+        lockTimeout: '5m',
+      });
+
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        2,
+        'terraform',
+        ['plan', '-detailed-exitcode', '-lock-timeout=5m', '-no-color', '-input=false'],
+        expect.objectContaining({ cwd: workingDir, ignoreReturnCode: true })
+      );
+      expect(result.hasChanges).toBe(true);
+      expect(mockCore.endGroup).toHaveBeenCalled();
+    });
+
+    it('should report no drift on exit code 0', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      const result = await executeDriftCheck(workingDir, projectName);
+
+      expect(result.hasChanges).toBe(false);
+    });
+
+    it('should throw when plan fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(0).mockResolvedValueOnce(1);
+
+      const error = await executeDriftCheck(workingDir, projectName).catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('plan');
+      expect(error.reportedByTfcmt).toBe(false);
+    });
+
+    it('should not plan when init fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(1);
+
+      const error = await executeDriftCheck(workingDir, projectName).catch((e) => e);
+
+      expect(error.subcommand).toBe('init');
+      expect(mockExec.exec).toHaveBeenCalledTimes(1);
+    });
+  });
+
+  describe('executeSecurityScanner', () => {
+    const workingDir = '/path/to/terraform';
+
+    it.each([
+      [
+        'tfsec',
+        'dir',
+        workingDir,
+        [workingDir, '--format', 'json', '--no-color', '--soft-fail'],
+      ],
+      [
+        'trivy',
+        'plan',
+        '/tmp/plan.json',
+        ['config', '--format', 'json', '--quiet', '--exit-code', '0', '/tmp/plan.json'],
+      ],
+      [
+        'checkov',
+        'plan',
+        '/tmp/plan.json',
+        [
+          '--file',
+          '/tmp/plan.json',
+          '--framework',
+          'terraform_plan',
+          '--output',
+          'json',
+          '--soft-fail',
+          '--compact',
+          '--quiet',
+        ],
+      ],
+    ] as const)('should run %s on the %s with JSON output', async (tool, target, targetPath, args) => {
+      mockExec.exec.mockImplementationOnce(
+        async (_commandLine: string, _args?: string[], options?: exec.ExecOptions) => {
+          options?.listeners?.stdout?.(Buffer.from('{"results":[]}'));
+          return 0;
+        }
+      );
+
+      const output = await executeSecurityScanner(tool, target, targetPath, workingDir);
+
+      expect(output).toBe('{"results":[]}');
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        tool,
+        [...args],
+        expect.objectContaining({ cwd: workingDir, silent: true, ignoreReturnCode: true })
+      );
+    });
+
+    it('should throw when the scanner fails', async () => {
+      mockExec.exec.mockImplementationOnce(
+        async (_commandLine: string, _args?: string[], options?: exec.ExecOptions) => {
+          options?.listeners?.stderr?.(Buffer.from('no such directory'));
+          return 1;
+        }
+      );
+
+      await expect(executeSecurityScanner('tfsec', 'dir', workingDir, workingDir)).rejects.toThrow(
+        'tfsec failed with exit code 1:\nno such directory'
+      );
+    });
+
+    it('should report a scanner that is not installed', async () => {
+      mockExec.exec.mockRejectedValueOnce(new Error('Unable to locate executable file: checkov'));
+
+      await expect(
+        executeSecurityScanner('checkov', 'dir', workingDir, workingDir)
+      ).rejects.toThrow('checkov is not installed or not available in PATH');
+    });
+  });
+
+  describe('selecting workspaces', () => {
+    const tfcmtPath = '/usr/local/bin/tfcmt';
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should select the workspace between init and plan', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraform(tfcmtPath, 'plan', workingDir, projectName, [], undefined, {
+        workspace: 'prod',
+      });
+
+      expect(mockExec.exec).toHaveBeenNthCalledWith(1, 'terraform', ['init'], expect.any(Object));
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        2,
+        'terraform',
+        ['workspace', 'select', 'prod'],
+        expect.objectContaining({ cwd: workingDir })
+      );
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        3,
+        tfcmtPath,
+        expect.arrayContaining(['plan']),
+        expect.any(Object)
+      );
+    });
+
+    it('should create the workspace when it does not exist', async () => {
+      mockExec.exec.mockResolvedValueOnce(0).mockResolvedValueOnce(1).mockResolvedValue(0);
+
+      const result = await executeDriftCheck(workingDir, projectName, { workspace: 'prod' });
+
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        3,
+        'terraform',
+        ['workspace', 'new', 'prod'],
+        expect.objectContaining({ cwd: workingDir })
+      );
+      expect(mockCore.info).toHaveBeenCalledWith('Created terraform workspace prod');
+      expect(result.hasChanges).toBe(false);
+    });
+
+    it('should not run tfcmt when the workspace can be neither selected nor created', async () => {
+      mockExec.exec.mockResolvedValueOnce(0).mockResolvedValueOnce(1).mockResolvedValueOnce(1);
+
+      const error = await executeTerraform(
+        tfcmtPath,
+        'apply',
+        workingDir,
+        projectName,
+        [],
+        undefined,
+        { workspace: 'prod' }
+      ).catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('workspace');
+      expect(error.reportedByTfcmt).toBe(false);
+      expect(mockExec.exec).toHaveBeenCalledTimes(3);
+    });
+  });
+
+  describe('executeRunStep', () => {
+    const workingDir = '/path/to/terraform';
+
+    it('should run the command with bash and the extra environment', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeRunStep('conftest test $PLANFILE', workingDir, { PLANFILE: '/tmp/tfplan' });
+
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        'bash',
+        ['-c', 'conftest test $PLANFILE'],
+        expect.objectContaining({
+          cwd: workingDir,
+          env: expect.objectContaining({ PLANFILE: '/tmp/tfplan' }),
+        })
+      );
+    });
+
+    it('should throw under the step name when the command fails', async () => {
+      mockExec.exec.mockResolvedValue(3);
+
+      const error = await executeRunStep('make lint', workingDir, {}, 'plan workflow step').catch(
+        (e) => e
+      );
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.message).toContain('Workflow step failed with exit code 3: make lint');
+      expect(error.subcommand).toBe('plan workflow step');
+      expect(error.reportedByTfcmt).toBe(false);
+    });
+  });
+
+  describe('executeTerraform with skipInit', () => {
+    const tfcmtPath = '/usr/local/bin/tfcmt';
+    const workingDir = '/path/to/terraform';
+
+    it('should run tfcmt without init', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraform(tfcmtPath, 'plan', workingDir, 'app', [], undefined, {
+        skipInit: true,
+        workspace: 'prod',
+      });
+
+      expect(mockExec.exec).toHaveBeenCalledTimes(1);
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        tfcmtPath,
+        expect.arrayContaining(['plan']),
+        expect.any(Object)
+      );
+    });
+  });
+
+  describe('executeTerraformState', () => {
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should init and forward the subcommand and arguments', async () => {
+      mockExec.exec.mockImplementation(
+        async (_commandLine: string, args?: string[], options?: exec.ExecOptions) => {
+          if (args?.[0] === 'state') {
+            options?.listeners?.stdout?.(Buffer.from('aws_instance.web\n'));
+          }
+          return 0;
+        }
+      );
+
+      const result = await executeTerraformState(workingDir, projectName, 'list', [
+        'aws_instance.web',
+      ]);
+
+      expect(mockExec.exec).toHaveBeenNthCalledWith(1, 'terraform', ['init'], expect.any(Object));
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        2,
+        'terraform',
+        ['state', 'list', 'aws_instance.web'],
+        expect.objectContaining({ cwd: workingDir })
+      );
+      expect(result.stdout).toBe('aws_instance.web\n');
+    });
+
+    it('should throw a TerraformCommandError when the state command fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(0).mockResolvedValueOnce(1);
+
+      const error = await executeTerraformState(workingDir, projectName, 'rm', ['x']).catch(
+        (e) => e
+      );
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('state rm');
+      expect(error.reportedByTfcmt).toBe(false);
+    });
+  });
+
+  describe('executeTerraformImport', () => {
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should place flags before the address and ID', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraformImport(
+        workingDir,
+        projectName,
+        'aws_s3_bucket.b',
+        'my-bucket',
+        ['-var-file=prod.tfvars'],
+        { lockTimeout: '5m', refresh: false }
+      );
+
+      expect(mockExec.exec).toHaveBeenNthCalledWith(1, 'terraform', ['init'], expect.any(Object));
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        2,
+        'terraform',
+        [
+          'import',
+          '-lock-timeout=5m',
+          '-var-file=prod.tfvars',
+          '-no-color',
+          '-input=false',
+          'aws_s3_bucket.b',
+          'my-bucket',
+        ],
+        expect.objectContaining({ cwd: workingDir })
+      );
+    });
+
+    it('should add the project env to the environment of init and import', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraformImport(workingDir, projectName, 'a.b', 'id', [], {
+        env: { AWS_PROFILE: 'prod' },
+      });
+
+      for (const call of mockExec.exec.mock.calls) {
+        expect(call[2]?.env).toEqual(expect.objectContaining({ AWS_PROFILE: 'prod' }));
+      }
+      expect(mockExec.exec).toHaveBeenCalledTimes(2);
+    });
+
+    it('should not use terragrunt run-all', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraformImport(workingDir, projectName, 'a.b', 'id', [], {
+        terragrunt: true,
+        terragruntRunAll: true,
+      });
+
+      const [binary, args] = mockExec.exec.mock.calls[1];
+      expect(binary).toBe('terragrunt');
+      expect(args).not.toContain('run-all');
+    });
+
+    it('should throw a TerraformCommandError when the import fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(0).mockResolvedValueOnce(1);
+
+      const error = await executeTerraformImport(workingDir, projectName, 'a.b', 'id').catch(
+        (e) => e
+      );
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('import');
+      expect(error.reportedByTfcmt).toBe(false);
+    });
+  });
+
+  describe('executeImportPlan', () => {
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should plan the imported resource without locking or saving a plan', async () => {
+      mockExec.exec.mockResolvedValue(2);
+
+      const result = await executeImportPlan(workingDir, projectName, 'aws_instance.web["a"]', {
+        vars: { region: 'eu-west-1' },
+      });
+
+      expect(mockExec.exec).toHaveBeenCalledTimes(1);
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        'terraform',
+        [
+          'plan',
+          '-detailed-exitcode',
+          '-lock=false',
+          '-target=aws_instance.web["a"]',
+          '-var=region=eu-west-1',
+          '-no-color',
+          '-input=false',
+        ],
+        expect.objectContaining({ cwd: workingDir })
+      );
+      expect(result.hasChanges).toBe(true);
+    });
+
+    it('should report no changes when the configuration matches the resource', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      const result = await executeImportPlan(workingDir, projectName, 'a.b');
+
+      expect(result.hasChanges).toBe(false);
+    });
+
+    it('should throw a TerraformCommandError when the plan fails', async () => {
+      mockExec.exec.mockResolvedValue(1);
+
+      const error = await executeImportPlan(workingDir, projectName, 'a.b').catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('plan');
+    });
+  });
+
+  describe('executeTerraformDestroy', () => {
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should initialize and destroy without prompting', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraformDestroy(workingDir, projectName, ['-target=aws_s3_bucket.b'], {
+        lockTimeout: '5m',
+        refresh: false,
+      });
+
+      expect(mockExec.exec).toHaveBeenNthCalledWith(1, 'terraform', ['init'], expect.any(Object));
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        2,
+        'terraform',
+        [
+          'destroy',
+          '-auto-approve',
+          '-refresh=false',
+          '-lock-timeout=5m',
+          '-target=aws_s3_bucket.b',
+          '-no-color',
+          '-input=false',
+        ],
+        expect.objectContaining({ cwd: workingDir })
+      );
+    });
+
+    it('should mask variable values in the log group title', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraformDestroy(workingDir, projectName, ['-var=db_password=hunter2']);
+
+      expect(mockCore.startGroup).toHaveBeenCalledWith(
+        'Executing terraform destroy -var=db_password=*** for project: test-project'
+      );
+    });
+
+    it('should throw a TerraformCommandError when the destroy fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(0).mockResolvedValueOnce(1);
+
+      const error = await executeTerraformDestroy(workingDir, projectName).catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('destroy');
+      expect(mockExec.exec).toHaveBeenCalledTimes(2);
+    });
+  });
+
+  describe('timeouts', () => {
+    const tfcmtPath = '/usr/local/bin/tfcmt';
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+    const timeout = { duration: '30m', ms: 20 };
+
+    /**
+     * Runner whose commands starting with the prefix hang until they are stopped
+     */
+    function hangingRunner(prefix: string, calls: string[] = []): CommandRunner {
+      return (commandLine, args = [], options) => {
+        const line = [commandLine, ...args].join(' ');
+        calls.push(line);
+        if (!line.startsWith(prefix)) {
+          return Promise.resolve(0);
+        }
+        const progress = 'aws_instance.web: Still creating... [10s elapsed]';
+        options?.listeners?.stdout?.(Buffer.from(progress));
+        return new Promise((resolve) => {
+          options?.signal?.addEventListener('abort', () => resolve(130));
+        });
+      };
+    }
+
+    afterEach(() => {
+      setCommandRunner();
+    });
+
+    it('should stop a plan that outlives plan_timeout and report it', async () => {
+      setCommandRunner(hangingRunner(tfcmtPath));
+
+      const error = await executeTerraform(
+        tfcmtPath,
+        'plan',
+        workingDir,
+        projectName,
+        [],
+        undefined,
+        { planTimeout: timeout }
+      ).catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.message).toBe('Terraform plan timed out after 30m');
+      expect(error.subcommand).toBe('plan');
+      expect(error.reportedByTfcmt).toBe(false);
+      expect(error.output).toContain('Still creating... [10s elapsed]');
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        'terraform plan is still running after 30m, stopping it'
+      );
+    });
+
+    it('should not retry a plan that timed out', async () => {
+      const calls: string[] = [];
+      setCommandRunner(hangingRunner(tfcmtPath, calls));
+
+      await expect(
+        executeTerraform(tfcmtPath, 'plan', workingDir, projectName, [], undefined, {
+          planTimeout: timeout,
+          retry: { maxRetries: 2, backoffMs: 0, patterns: [/Still creating/] },
+        })
+      ).rejects.toThrow('timed out');
+      expect(calls.filter((c) => c.startsWith(tfcmtPath))).toHaveLength(1);
+    });
+
+    it('should only hold apply to apply_timeout', async () => {
+      setCommandRunner(hangingRunner(tfcmtPath));
+
+      await expect(
+        executeTerraform(tfcmtPath, 'apply', workingDir, projectName, [], undefined, {
+          planTimeout: { duration: '1h', ms: 3_600_000 },
+          applyTimeout: timeout,
+        })
+      ).rejects.toThrow('Terraform apply timed out after 30m');
+    });
+
+    it('should let commands that finish in time succeed', async () => {
+      setCommandRunner(hangingRunner('never'));
+
+      const result = await executeDriftCheck(workingDir, projectName, { planTimeout: timeout });
+
+      expect(result.exitCode).toBe(0);
+      expect(mockCore.warning).not.toHaveBeenCalled();
+    });
+
+    it('should stop a drift check plan and a destroy', async () => {
+      setCommandRunner(hangingRunner('terraform plan'));
+      await expect(
+        executeDriftCheck(workingDir, projectName, { planTimeout: timeout })
+      ).rejects.toThrow('Terraform plan timed out after 30m');
+
+      setCommandRunner(hangingRunner('terraform destroy'));
+      await expect(
+        executeTerraformDestroy(workingDir, projectName, [], { applyTimeout: timeout })
+      ).rejects.toThrow('Terraform destroy timed out after 30m');
+    });
+  });
+
+  describe('executeTerraformShow', () => {
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should initialize and render the saved plan', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraformShow(workingDir, projectName, '/tmp/tfplan-test-project', ['-json']);
+
+      expect(mockExec.exec).toHaveBeenNthCalledWith(1, 'terraform', ['init'], expect.any(Object));
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        2,
+        'terraform',
+        ['show', '-json', '-no-color', '/tmp/tfplan-test-project'],
+        expect.objectContaining({ cwd: workingDir })
+      );
+      expect(mockCore.endGroup).toHaveBeenCalled();
+    });
+
+    it('should throw a TerraformCommandError when show fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(0).mockResolvedValueOnce(1);
+
+      const error = await executeTerraformShow(workingDir, projectName, '/tmp/tfplan').catch(
+        (e) => e
+      );
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('show');
+      expect(mockCore.endGroup).toHaveBeenCalled();
+    });
+  });
+
+  describe('executeTerraformShowJson', () => {
+    const workingDir = '/path/to/terraform';
+
+    it('should initialize and render the saved plan as JSON without logging it', async () => {
+      mockExec.exec
+        .mockResolvedValueOnce(0)
+        .mockImplementationOnce(
+          async (_commandLine: string, _args?: string[], options?: exec.ExecOptions) => {
+            options?.listeners?.stdout?.(Buffer.from('{"resource_changes":[]}'));
+            return 0;
+          }
+        );
+
+      const json = await executeTerraformShowJson(workingDir, '/tmp/tfplan-test-project');
+
+      expect(json).toBe('{"resource_changes":[]}');
+      expect(mockExec.exec).toHaveBeenNthCalledWith(1, 'terraform', ['init'], expect.any(Object));
+      expect(mockExec.exec).toHaveBeenNthCalledWith(
+        2,
+        'terraform',
+        ['show', '-json', '-no-color', '/tmp/tfplan-test-project'],
+        expect.objectContaining({ silent: true })
+      );
+    });
+
+    it('should throw a TerraformCommandError when show fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(0).mockResolvedValueOnce(1);
+
+      const error = await executeTerraformShowJson(workingDir, '/tmp/tfplan').catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('show');
+    });
+  });
+
+  describe('executeTerraformOutput', () => {
+    const workingDir = '/path/to/terraform';
+
+    it('should read the outputs as JSON without logging them', async () => {
+      mockExec.exec.mockImplementationOnce(
+        async (_commandLine: string, _args?: string[], options?: exec.ExecOptions) => {
+          options?.listeners?.stdout?.(
+            Buffer.from('{"lb_dns":{"sensitive":false,"type":"string","value":"lb.example.com"}}')
+          );
+          return 0;
+        }
+      );
+
+      const outputs = await executeTerraformOutput(workingDir);
+
+      expect(outputs).toEqual({ lb_dns: { sensitive: false, value: 'lb.example.com' } });
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        'terraform',
+        ['output', '-json', '-no-color'],
+        expect.objectContaining({ cwd: workingDir, silent: true })
+      );
+    });
+
+    it('should throw a TerraformCommandError when output fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(1);
+
+      const error = await executeTerraformOutput(workingDir).catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('output');
+    });
+  });
+
+  describe('parseTerraformOutputs', () => {
+    it('should parse values and drop sensitive ones', () => {
+      const outputs = parseTerraformOutputs(
+        JSON.stringify({
+          subnet_ids: { sensitive: false, type: ['list', 'string'], value: ['a', 'b'] },
+          db_password: { sensitive: true, type: 'string', value: 'hunter2' },
+        })
+      );
+
+      expect(outputs).toEqual({
+        subnet_ids: { sensitive: false, value: ['a', 'b'] },
+        db_password: { sensitive: true, value: undefined },
+      });
+    });
+
+    it('should treat outputs without a sensitive flag as sensitive', () => {
+      expect(parseTerraformOutputs('{"token":{"value":"abc"}}')).toEqual({
+        token: { sensitive: true, value: undefined },
+      });
+    });
+
+    it('should return no outputs for a project without any', () => {
+      expect(parseTerraformOutputs('{}')).toEqual({});
+    });
+
+    it('should throw when the output is not a JSON object', () => {
+      expect(() => parseTerraformOutputs('not json')).toThrow('Could not parse terraform output');
+      expect(() => parseTerraformOutputs('[]')).toThrow('expected a JSON object');
+    });
+  });
+
+  describe('parseStateLock', () => {
+    const acquireError = `
+Error: Error acquiring the state lock
+
+Error message: ConditionalCheckFailedException: The conditional request failed
+Lock Info:
+  ID:        4c5f1e2a-9b7d-3e8f-a1c2-d3e4f5a6b7c8
+  Path:      tfstate-bucket/envs/staging/terraform.tfstate
+  Operation: OperationTypeApply
+  Who:       runner@fv-az123-456
+  Version:   1.6.6
+  Created:   2024-03-01 12:00:00.000000000 +0000 UTC
+  Info:
+
+Terraform acquires a state lock to protect the state from being written
+by multiple users at the same time.
+`;
+
+    it('should parse the lock info of a lock acquisition failure', () => {
+      expect(parseStateLock(acquireError)).toEqual({
+        id: '4c5f1e2a-9b7d-3e8f-a1c2-d3e4f5a6b7c8',
+        who: 'runner@fv-az123-456',
+        operation: 'OperationTypeApply',
+        releaseFailed: false,
+      });
+    });
+
+    it('should parse lock info inside a diagnostic border', () => {
+      const output = [
+        '╷',
+        '│ Error: Error acquiring the state lock',
+        '│ Lock Info:',
+        '│   ID:        0f1e2d3c',
+        '│   Operation: OperationTypePlan',
+        '│   Who:       runner@fv-az999-1',
+        '╵',
+      ].join('\n');
+
+      expect(parseStateLock(output)).toEqual({
+        id: '0f1e2d3c',
+        who: 'runner@fv-az999-1',
+        operation: 'OperationTypePlan',
+        releaseFailed: false,
+      });
+    });
+
+    it('should parse a lock ID from a release failure', () => {
+      const output = `
+Error: Error releasing the state lock
+
+Error message: failed to retrieve lock info for lock ID "4c5f1e2a-9b7d": RequestError: send request failed
+
+Terraform acquired a lock on the state for you, but an error occurred while
+releasing it. You may have to force-unlock this state in order to use it again.
+`;
+
+      expect(parseStateLock(output)).toEqual({
+        id: '4c5f1e2a-9b7d',
+        who: undefined,
+        operation: undefined,
+        releaseFailed: true,
+      });
+    });
+
+    it('should return null for errors without a state lock', () => {
+      expect(parseStateLock('Error: Invalid provider configuration')).toBeNull();
+      expect(
+        parseStateLock('Error: Error acquiring the state lock\n\nconnection refused')
+      ).toBeNull();
+    });
+  });
+
+  describe('isLockHeldByThisRunner', () => {
+    const lock = { id: 'abc', who: 'runner@fv-az123-456', releaseFailed: false };
+
+    it('should only treat locks held by this runner as dangling', () => {
+      expect(isLockHeldByThisRunner(lock, 'runner@fv-az123-456')).toBe(true);
+      expect(isLockHeldByThisRunner(lock, 'runner@fv-az999-1')).toBe(false);
+    });
+
+    it('should treat a lock terraform failed to release as dangling', () => {
+      expect(isLockHeldByThisRunner({ id: 'abc', releaseFailed: true }, 'runner@fv-az999-1')).toBe(
+        true
+      );
+    });
+  });
+
+  describe('executeTerraformForceUnlock', () => {
+    const workingDir = '/path/to/terraform';
+
+    it('should force-unlock the lock without prompting', async () => {
+      mockExec.exec.mockResolvedValueOnce(0);
+
+      await executeTerraformForceUnlock(workingDir, '4c5f1e2a');
+
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        'terraform',
+        ['force-unlock', '-force', '-no-color', '4c5f1e2a'],
+        expect.objectContaining({ cwd: workingDir })
+      );
+    });
+
+    it('should throw a TerraformCommandError when force-unlock fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(1);
+
+      const error = await executeTerraformForceUnlock(workingDir, '4c5f1e2a').catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(error.subcommand).toBe('force-unlock');
+    });
+  });
+
+  describe('executeTerraformWithTfcmt', () => {
+    const tfcmtPath = '/usr/local/bin/tfcmt';
+    const workingDir = '/path/to/terraform';
+    const projectName = 'test-project';
+
+    it('should wrap executeTerraform with logging group', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraformWithTfcmt(
+        tfcmtPath,
+        'plan',
+        projectName,
+        workingDir
+      );
+
+      expect(mockCore.startGroup).toHaveBeenCalledWith(
+        'Executing terraform plan for project: test-project'
+      );
+      expect(mockCore.endGroup).toHaveBeenCalled();
+    });
+
+    it('should call endGroup even if execution fails', async () => {
+      mockExec.exec.mockResolvedValueOnce(0); // terraform init
+      mockExec.exec.mockResolvedValueOnce(1); // terraform fails
+
+      await expect(
+        executeTerraformWithTfcmt(tfcmtPath, 'plan', projectName, workingDir)
+      ).rejects.toThrow();
+
+      expect(mockCore.startGroup).toHaveBeenCalled();
+      expect(mockCore.endGroup).toHaveBeenCalled();
+    });
+
+    it('should open a labeled log group for each project and command', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await executeTerraformWithTfcmt(tfcmtPath, 'plan', 'network', workingDir);
+      await executeTerraformWithTfcmt(tfcmtPath, 'apply', 'app', workingDir, ['-target=module.db']);
+
+      expect(mockCore.startGroup.mock.calls).toEqual([
+        ['Executing terraform plan for project: network'],
+        ['Executing terraform apply -target=module.db for project: app'],
+      ]);
+      // Each group is closed before the next one opens
+      const [firstStart, secondStart] = mockCore.startGroup.mock.invocationCallOrder;
+      const [firstEnd, secondEnd] = mockCore.endGroup.mock.invocationCallOrder;
+      expect(firstStart).toBeLessThan(firstEnd);
+      expect(firstEnd).toBeLessThan(secondStart);
+      expect(secondStart).toBeLessThan(secondEnd);
+    });
+
+    it('should close the log group when the command throws', async () => {
+      mockExec.exec.mockRejectedValueOnce(new Error('Unable to locate executable file: terraform'));
+
+      await expect(
+        executeTerraformWithTfcmt(tfcmtPath, 'plan', projectName, workingDir)
+      ).rejects.toThrow('Unable to locate executable file: terraform');
+
+      expect(mockCore.startGroup).toHaveBeenCalledTimes(1);
+      expect(mockCore.endGroup).toHaveBeenCalledTimes(1);
+      expect(mockCore.endGroup.mock.invocationCallOrder[0]).toBeGreaterThan(
+        mockCore.startGroup.mock.invocationCallOrder[0]
+      );
+    });
+
+    it.each([
+      [
+        'state',
+        () => executeTerraformState(workingDir, projectName, 'rm', ['aws_instance.old']),
+        'Executing terraform state rm aws_instance.old for project: test-project',
+      ],
+      [
+        'destroy',
+        () => executeTerraformDestroy(workingDir, projectName),
+        'Executing terraform destroy for project: test-project',
+      ],
+    ])('should close the log group of %s when terraform throws', async (_, execute, label) => {
+      mockExec.exec.mockRejectedValueOnce(new Error('Unable to locate executable file: terraform'));
+
+      await expect(execute()).rejects.toThrow('Unable to locate executable file: terraform');
+
+      expect(mockCore.startGroup).toHaveBeenCalledWith(label);
+      expect(mockCore.endGroup).toHaveBeenCalledTimes(1);
+    });
+
+    it('should stream output to the log while capturing it', async () => {
+      const emitPlan: typeof mockExec.exec = async (_cmd, _args, options) => {
+        options?.listeners?.stdout?.(Buffer.from('Plan: 1 to add, 0 to change, 0 to destroy.'));
+        return 0;
+      };
+      mockExec.exec.mockImplementationOnce(emitPlan).mockImplementationOnce(emitPlan);
+
+      const result = await executeTerraformWithTfcmt(tfcmtPath, 'plan', projectName, workingDir);
+
+      expect(result.stdout).toContain('Plan: 1 to add');
+      for (const [, , options] of mockExec.exec.mock.calls) {
+        expect(options?.silent).not.toBe(true);
+      }
+    });
+
+    it('should pass through additional arguments', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      const additionalArgs = ['-var=foo=bar'];
+      await executeTerraformWithTfcmt(
+        tfcmtPath,
+        'plan',
+        projectName,
+        workingDir,
+        additionalArgs
+      );
+
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        tfcmtPath,
+        expect.arrayContaining(['-var=foo=bar']),
+        expect.any(Object)
+      );
+    });
+
+    it('should pass through plan file path for apply command', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      const planFilePath = '/path/to/tfplan';
+      await executeTerraformWithTfcmt(
+        tfcmtPath,
+        'apply',
+        projectName,
+        workingDir,
+        [],
+        planFilePath
+      );
+
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        tfcmtPath,
+        expect.arrayContaining([planFilePath]),
+        expect.any(Object)
+      );
+    });
+  });
+
+  describe('resolveTerraformBinary', () => {
+    let workingDir: string;
+
+    beforeEach(() => {
+      workingDir = fs.mkdtempSync(path.join(os.tmpdir(), 'terraform-action-'));
+    });
+
+    afterEach(() => {
+      fs.rmSync(workingDir, { recursive: true, force: true });
+    });
+
+    it('should use default terraform when no version file exists', async () => {
+      await expect(resolveTerraformBinary(workingDir)).resolves.toBe('terraform');
+
+      expect(mockTc.find).not.toHaveBeenCalled();
+      expect(mockIo.which).not.toHaveBeenCalled();
+    });
+
+    it('should use cached terraform matching .terraform-version', async () => {
+      fs.writeFileSync(path.join(workingDir, '.terraform-version'), '1.5.7\n');
+      mockTc.find.mockReturnValue('/opt/hostedtoolcache/terraform/1.5.7/x64');
+
+      const binary = await resolveTerraformBinary(workingDir);
+
+      expect(mockTc.find).toHaveBeenCalledWith('terraform', '1.5.7');
+      expect(binary).toBe(path.join('/opt/hostedtoolcache/terraform/1.5.7/x64', 'terraform'));
+    });
+
+    it('should download an exact version that is not cached', async () => {
+      fs.writeFileSync(path.join(workingDir, '.terraform-version'), '1.6.0');
+      mockTc.find.mockReturnValue('');
+      mockInstallTerraform.mockResolvedValue('/opt/hostedtoolcache/terraform/1.6.0/x64/terraform');
+
+      const binary = await resolveTerraformBinary(workingDir);
+
+      expect(mockInstallTerraform).toHaveBeenCalledWith('1.6.0', 'terraform');
+      expect(mockIo.which).not.toHaveBeenCalled();
+      expect(binary).toBe('/opt/hostedtoolcache/terraform/1.6.0/x64/terraform');
+    });
+
+    it('should prefer the configured terraform_version', async () => {
+      fs.writeFileSync(path.join(workingDir, '.terraform-version'), '1.6.0');
+      mockTc.find.mockReturnValue('/opt/hostedtoolcache/terraform/1.7.0/x64');
+
+      await resolveTerraformBinary(workingDir, { terraformVersion: '1.7.0' });
+
+      expect(mockTc.find).toHaveBeenCalledWith('terraform', '1.7.0');
+    });
+
+    it('should run tofu from PATH without a requested version', async () => {
+      fs.writeFileSync(path.join(workingDir, '.terraform-version'), '1.6.0');
+
+      await expect(resolveTerraformBinary(workingDir, { binary: 'tofu' })).resolves.toBe('tofu');
+      expect(mockTc.find).not.toHaveBeenCalled();
+    });
+
+    it('should resolve the latest OpenTofu from .opentofu-version and download it', async () => {
+      fs.writeFileSync(path.join(workingDir, '.opentofu-version'), 'latest');
+      mockResolveLatestOpenTofuVersion.mockResolvedValue('1.8.3');
+      mockTc.find.mockReturnValue('');
+      mockInstallTerraform.mockResolvedValue('/opt/hostedtoolcache/tofu/1.8.3/x64/tofu');
+
+      const binary = await resolveTerraformBinary(workingDir, { binary: 'tofu' });
+
+      expect(mockTc.find).toHaveBeenCalledWith('tofu', '1.8.3');
+      expect(mockInstallTerraform).toHaveBeenCalledWith('1.8.3', 'tofu');
+      expect(binary).toBe('/opt/hostedtoolcache/tofu/1.8.3/x64/tofu');
+    });
+
+    /**
+     * Makes tfenv select the given version and the terraform binary run the other one
+     */
+    function useTfenv(selected: string, running: string): void {
+      mockExec.exec.mockImplementation(async (_binary, args, options) => {
+        const stdout =
+          args?.[0] === 'version-name'
+            ? `${selected}\n`
+            : args?.[0] === 'version'
+              ? JSON.stringify({ terraform_version: running })
+              : '';
+        options?.listeners?.stdout?.(Buffer.from(stdout));
+        return 0;
+      });
+    }
+
+    it('should install other version specs with tfenv and run its shim', async () => {
+      fs.writeFileSync(path.join(workingDir, '.terraform-version'), 'latest:^1.6');
+      fs.mkdirSync(path.join(workingDir, 'bin'));
+      const shim = path.join(workingDir, 'bin', 'terraform');
+      fs.writeFileSync(shim, '');
+      mockTc.find.mockReturnValue('');
+      mockIo.which.mockResolvedValue(path.join(workingDir, 'bin', 'tfenv'));
+      useTfenv('1.6.6', '1.6.6');
+
+      const binary = await resolveTerraformBinary(workingDir);
+
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        path.join(workingDir, 'bin', 'tfenv'),
+        ['install', 'latest:^1.6'],
+        expect.objectContaining({ cwd: workingDir })
+      );
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        shim,
+        ['version', '-json'],
+        expect.objectContaining({ cwd: workingDir })
+      );
+      expect(mockInstallTerraform).not.toHaveBeenCalled();
+      expect(binary).toBe(shim);
+    });
+
+    it('should throw when terraform on PATH is not the version tfenv selected', async () => {
+      fs.writeFileSync(path.join(workingDir, '.terraform-version'), 'latest:^1.6');
+      mockTc.find.mockReturnValue('');
+      mockIo.which.mockResolvedValue(path.join(workingDir, 'bin', 'tfenv'));
+      useTfenv('1.6.6', '1.5.7');
+
+      await expect(resolveTerraformBinary(workingDir)).rejects.toThrow(
+        'terraform runs terraform 1.5.7, not 1.6.6 selected by tfenv (put the tfenv shims first on PATH)'
+      );
+    });
+
+    it('should throw when tfenv fails to install the requested version', async () => {
+      fs.writeFileSync(path.join(workingDir, '.terraform-version'), 'latest');
+      mockTc.find.mockReturnValue('');
+      mockIo.which.mockResolvedValue('/usr/local/bin/tfenv');
+      mockExec.exec.mockResolvedValue(1);
+
+      await expect(resolveTerraformBinary(workingDir)).rejects.toThrow(
+        'tfenv failed to install terraform latest'
+      );
+    });
+
+    it('should fall back to default terraform when version is unavailable', async () => {
+      fs.writeFileSync(path.join(workingDir, '.terraform-version'), 'latest');
+      mockTc.find.mockReturnValue('');
+      mockIo.which.mockResolvedValue('');
+
+      await expect(resolveTerraformBinary(workingDir)).resolves.toBe('terraform');
+      expect(mockCore.warning).toHaveBeenCalledWith(
+        expect.stringContaining('terraform latest requested by .terraform-version')
+      );
+    });
+  });
+
+  describe('findRequestedTerraformVersion', () => {
+    let workingDir: string;
+
+    beforeEach(() => {
+      workingDir = fs.mkdtempSync(path.join(os.tmpdir(), 'terraform-action-'));
+    });
+
+    afterEach(() => {
+      fs.rmSync(workingDir, { recursive: true, force: true });
+    });
+
+    it('should detect an exact required_version', () => {
+      fs.writeFileSync(
+        path.join(workingDir, 'versions.tf'),
+        'terraform {\n  required_version = "= 1.5.7"\n}\n'
+      );
+
+      expect(findRequestedTerraformVersion(workingDir)).toEqual({
+        version: '1.5.7',
+        source: 'required_version in versions.tf',
+      });
+    });
+
+    it('should ignore a required_version allowing several versions', () => {
+      fs.writeFileSync(
+        path.join(workingDir, 'versions.tf'),
+        'terraform {\n  required_version = ">= 1.5"\n}\n'
+      );
+
+      expect(findRequestedTerraformVersion(workingDir)).toBeNull();
+      expect(mockCore.info).toHaveBeenCalledWith(
+        'required_version ">= 1.5" in versions.tf is not an exact version, using terraform on PATH'
+      );
+    });
+  });
+
+  describe('collectDiagnostics', () => {
+    const workingDir = '/path/to/terraform';
+
+    it('should run terraform validate -json and parse diagnostics', async () => {
+      const output = JSON.stringify({
+        valid: false,
+        diagnostics: [
+          {
+            severity: 'error',
+            summary: 'Unsupported argument',
+            detail: '',
+            range: { filename: 'main.tf', start: { line: 7 } },
+          },
+        ],
+      });
+      mockExec.exec.mockImplementationOnce(
+        async (_commandLine: string, _args?: string[], options?: exec.ExecOptions) => {
+          options?.listeners?.stdout?.(Buffer.from(output));
+          return 1;
+        }
+      );
+
+      const diagnostics = await collectDiagnostics(workingDir);
+
+      expect(mockExec.exec).toHaveBeenCalledWith(
+        'terraform',
+        ['validate', '-json', '-no-color'],
+        expect.objectContaining({ cwd: workingDir, ignoreReturnCode: true })
+      );
+      expect(diagnostics).toEqual([
+        {
+          severity: 'error',
+          summary: 'Unsupported argument',
+          detail: '',
+          filename: 'main.tf',
+          line: 7,
+        },
+      ]);
+    });
+  });
+
+  describe('setCommandRunner', () => {
+    const workingDir = '/path/to/terraform';
+
+    /**
+     * Fake runner that records command lines and replies with canned output
+     */
+    function createFakeRunner(replies: Record<string, { exitCode: number; stdout?: string }>): {
+      runner: CommandRunner;
+      calls: string[];
+    } {
+      const calls: string[] = [];
+      const runner: CommandRunner = async (commandLine, args = [], options) => {
+        const line = [commandLine, ...args].join(' ');
+        calls.push(line);
+        const reply = Object.entries(replies).find(([prefix]) => line.startsWith(prefix))?.[1];
+        if (reply?.stdout) {
+          options?.listeners?.stdout?.(Buffer.from(reply.stdout));
+        }
+        return reply?.exitCode ?? 0;
+      };
+      return { runner, calls };
+    }
+
+    afterEach(() => {
+      setCommandRunner();
+    });
+
+    it('should run every command through the injected runner', async () => {
+      const fake = createFakeRunner({
+        'terraform output': { exitCode: 0, stdout: '{"id":{"sensitive":false,"value":"i-1"}}' },
+      });
+      setCommandRunner(fake.runner);
+
+      const outputs = await executeTerraformOutput(workingDir);
+      await executeTerraformState(workingDir, 'test-project', 'list');
+
+      expect(outputs).toEqual({ id: { sensitive: false, value: 'i-1' } });
+      expect(fake.calls).toEqual([
+        'terraform output -json -no-color',
+        'terraform init',
+        'terraform state list',
+      ]);
+      expect(mockExec.exec).not.toHaveBeenCalled();
+    });
+
+    it('should surface canned failures like real ones', async () => {
+      const fake = createFakeRunner({ 'terraform init': { exitCode: 1 } });
+      setCommandRunner(fake.runner);
+
+      const error = await executeTerraformInit(workingDir, 'test-project').catch((e) => e);
+
+      expect(error).toBeInstanceOf(TerraformCommandError);
+      expect(fake.calls).toEqual(['terraform init -no-color -input=false']);
+    });
+
+    it('should shell out again once the runner is reset', async () => {
+      setCommandRunner(createFakeRunner({}).runner);
+      setCommandRunner();
+      mockExec.exec.mockResolvedValue(0);
+
+      await validateTerraformInstalled();
+
+      expect(mockExec.exec).toHaveBeenCalledWith('terraform', ['version'], undefined);
+    });
+  });
+
+  describe('validateTerraformInstalled', () => {
+    it('should validate terraform is installed', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await expect(validateTerraformInstalled()).resolves.not.toThrow();
+
+      expect(mockExec.exec).toHaveBeenCalledWith('terraform', ['version']);
+      expect(mockCore.info).toHaveBeenCalledWith(
+        'Validating Terraform installation...'
+      );
+    });
+
+    it('should throw error when terraform is not installed', async () => {
+      mockExec.exec.mockRejectedValue(new Error('Command not found'));
+
+      await expect(validateTerraformInstalled()).rejects.toThrow(
+        'Terraform is not installed or not available in PATH'
+      );
+    });
+
+    it('should throw error when terraform version check fails', async () => {
+      mockExec.exec.mockRejectedValue(new Error('Permission denied'));
+
+      await expect(validateTerraformInstalled()).rejects.toThrow(
         'Terraform is not installed or not available in PATH'
       );
     });
+
+    it('should validate OpenTofu for tofu', async () => {
+      mockExec.exec.mockRejectedValue(new Error('Command not found'));
+
+      await expect(validateTerraformInstalled('tofu')).rejects.toThrow(
+        'OpenTofu is not installed or not available in PATH'
+      );
+      expect(mockExec.exec).toHaveBeenCalledWith('tofu', ['version']);
+    });
+  });
+
+  describe('validateTerragruntInstalled', () => {
+    it('should check the terragrunt version', async () => {
+      mockExec.exec.mockResolvedValue(0);
+
+      await validateTerragruntInstalled();
+
+      expect(mockExec.exec).toHaveBeenCalledWith('terragrunt', ['--version']);
+    });
+
+    it('should say how to install terragrunt when it is missing', async () => {
+      mockExec.exec.mockRejectedValue(new Error('Command not found'));
+
+      await expect(validateTerragruntInstalled()).rejects.toThrow(
+        'Terragrunt is not installed or not available in PATH. Set terragrunt_version'
+      );
+    });
   });
 });
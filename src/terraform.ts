@@ -2,86 +2,2094 @@
  * Terraform execution logic
  */
 
+import { type ChildProcess, spawn } from 'node:child_process';
+import * as fs from 'node:fs';
+import * as os from 'node:os';
 import * as path from 'node:path';
 import * as core from '@actions/core';
 import * as exec from '@actions/exec';
-import type { TerraformCommand, TerraformResult } from './types';
+import * as io from '@actions/io';
+import * as tc from '@actions/tool-cache';
+import { getCancellationSignal, throwIfCancelled } from './cancellation';
+import { parseDiagnostics } from './diagnostics';
+import {
+  EXACT_VERSION_PATTERN,
+  installTerraform,
+  resolveLatestOpenTofuVersion,
+} from './terraform-installer';
+import type {
+  CommandTimeout,
+  RetryPolicy,
+  SecurityScanner,
+  StateSubcommand,
+  TerraformBinary,
+  TerraformCommand,
+  TerraformDiagnostic,
+  TerraformExecutionOptions,
+  TerraformOutput,
+  TerraformResult,
+} from './types';
+
+/**
+ * Options of a command: those of exec.exec, and a signal that stops the command
+ */
+export interface CommandOptions extends exec.ExecOptions {
+  /** Stops the command, and every process it started, when aborted */
+  signal?: AbortSignal;
+}
+
+/**
+ * Runs a command and resolves to its exit code (the contract of exec.exec)
+ */
+export type CommandRunner = (
+  commandLine: string,
+  args?: string[],
+  options?: CommandOptions
+) => Promise<number>;
+
+/**
+ * Runner that shells out through @actions/exec (or spawns commands that can be stopped)
+ */
+const execRunner: CommandRunner = (commandLine, args, options) =>
+  options?.signal
+    ? spawnStoppable(commandLine, args ?? [], options, options.signal)
+    : exec.exec(commandLine, args, options);
+
+/**
+ * Time a stopped command is given to exit after SIGINT before it is killed
+ *
+ * @remarks
+ * On SIGINT terraform finishes the operations in progress, saves state and
+ * releases the state lock, which a kill would leave behind.
+ */
+const STOP_GRACE_PERIOD_MS = 60_000;
+
+/**
+ * Runs a command like exec.exec, stopping it when the signal is aborted
+ *
+ * @remarks
+ * @actions/exec does not expose the child process, so the command is spawned
+ * directly. It leads its own process group, so that stopping tfcmt also stops
+ * the terraform it runs, and any provider plugins.
+ */
+function spawnStoppable(
+  commandLine: string,
+  args: string[],
+  options: exec.ExecOptions,
+  signal: AbortSignal
+): Promise<number> {
+  const groups = process.platform !== 'win32';
+  const child = spawn(commandLine, args, {
+    cwd: options.cwd,
+    env: options.env,
+    detached: groups,
+    stdio: ['ignore', 'pipe', 'pipe'],
+  });
+  if (!options.silent) {
+    process.stdout.write(`[command]${[commandLine, ...args].join(' ')}${os.EOL}`);
+  }
+  child.stdout?.on('data', (data: Buffer) => {
+    options.listeners?.stdout?.(data);
+    if (!options.silent) {
+      process.stdout.write(data);
+    }
+  });
+  child.stderr?.on('data', (data: Buffer) => {
+    options.listeners?.stderr?.(data);
+    if (!options.silent) {
+      process.stderr.write(data);
+    }
+  });
+
+  let killTimer: ReturnType<typeof setTimeout> | undefined;
+  const stop = () => {
+    signalProcess(child, 'SIGINT', groups);
+    killTimer = setTimeout(() => signalProcess(child, 'SIGKILL', groups), STOP_GRACE_PERIOD_MS);
+  };
+  if (signal.aborted) {
+    stop();
+  } else {
+    signal.addEventListener('abort', stop, { once: true });
+  }
+
+  return new Promise((resolve, reject) => {
+    const settle = () => {
+      clearTimeout(killTimer);
+      signal.removeEventListener('abort', stop);
+    };
+    child.on('error', (error) => {
+      settle();
+      reject(error);
+    });
+    child.on('close', (code) => {
+      settle();
+      // A command killed by a signal has no exit code
+      const exitCode = code ?? 1;
+      if (exitCode !== 0 && !options.ignoreReturnCode) {
+        reject(new Error(`The process '${commandLine}' failed with exit code ${exitCode}`));
+      } else {
+        resolve(exitCode);
+      }
+    });
+  });
+}
+
+/**
+ * Sends a signal to a command, and to its process group where there are process groups
+ */
+function signalProcess(child: ChildProcess, signal: NodeJS.Signals, group: boolean): void {
+  try {
+    if (group && child.pid !== undefined) {
+      process.kill(-child.pid, signal);
+    } else {
+      child.kill(signal);
+    }
+  } catch {
+    // The command has already exited
+  }
+}
+
+/**
+ * Runner used for every terraform, terragrunt, tfcmt and tfenv command
+ */
+let runner: CommandRunner = execRunner;
+
+/**
+ * Replaces the command runner (for tests)
+ *
+ * @param next - Runner to use, or undefined to restore the one that shells out
+ *
+ * @remarks
+ * A fake runner can record the command lines and feed canned output to
+ * `options.listeners`, so orchestration can be tested without terraform.
+ */
+export function setCommandRunner(next?: CommandRunner): void {
+  runner = next ?? execRunner;
+}
+
+/**
+ * Whether command lines are logged before they run (the debug config flag)
+ */
+let debugCommandLines = false;
+
+/**
+ * Turns logging of command lines on or off
+ *
+ * @param enabled - Log every command line before it runs
+ *
+ * @remarks
+ * Logging is also on when TERRAFORM_ACTION_DEBUG is 1 or true, or when the
+ * workflow runs with step debug logging.
+ */
+export function setDebugCommandLines(enabled: boolean): void {
+  debugCommandLines = enabled;
+}
+
+/**
+ * Provider plugin cache shared by every init of the run, when enabled
+ */
+let pluginCacheDir: string | undefined;
+
+/**
+ * Settles once the init holding the plugin cache finishes
+ */
+let pluginCacheLock: Promise<unknown> = Promise.resolve();
+
+/**
+ * Turns the shared provider plugin cache on or off
+ *
+ * @param enabled - Share downloaded providers between the inits of the run
+ * @returns The cache directory, or undefined when the cache is off
+ *
+ * @remarks
+ * The cache is passed to every command through TF_PLUGIN_CACHE_DIR. A directory the
+ * workflow already set there is used as is; otherwise one is created under RUNNER_TEMP.
+ * Terraform does not lock the cache, so inits run one at a time while it is on.
+ */
+export function setPluginCache(enabled: boolean): string | undefined {
+  if (!enabled) {
+    if (pluginCacheDir !== undefined && process.env.TF_PLUGIN_CACHE_DIR === pluginCacheDir) {
+      delete process.env.TF_PLUGIN_CACHE_DIR;
+    }
+    pluginCacheDir = undefined;
+    return undefined;
+  }
+
+  pluginCacheDir =
+    process.env.TF_PLUGIN_CACHE_DIR ||
+    path.join(process.env.RUNNER_TEMP || os.tmpdir(), 'terraform-plugin-cache');
+  fs.mkdirSync(pluginCacheDir, { recursive: true });
+  process.env.TF_PLUGIN_CACHE_DIR = pluginCacheDir;
+  return pluginCacheDir;
+}
+
+/**
+ * Runs an init once no other init is using the plugin cache
+ *
+ * @param init - Runs the init
+ * @returns Result of the init
+ */
+function withPluginCacheLock<T>(init: () => Promise<T>): Promise<T> {
+  if (pluginCacheDir === undefined) {
+    return init();
+  }
+  const result = pluginCacheLock.then(init);
+  pluginCacheLock = result.catch(() => undefined);
+  return result;
+}
+
+/**
+ * Whether an environment variable is set to 1 or true
+ */
+function isEnvFlagSet(name: string): boolean {
+  const value = (process.env[name] || '').trim().toLowerCase();
+  return value === '1' || value === 'true';
+}
+
+/**
+ * Checks whether command lines should be logged
+ *
+ * @returns True when the debug flag, TERRAFORM_ACTION_DEBUG or step debug logging is on
+ *
+ * @remarks
+ * The runner sets RUNNER_DEBUG when step debug logging is on; ACTIONS_STEP_DEBUG
+ * is accepted too, for workflows that pass it to the step.
+ */
+export function isDebugEnabled(): boolean {
+  return (
+    core.isDebug() ||
+    debugCommandLines ||
+    isEnvFlagSet('TERRAFORM_ACTION_DEBUG') ||
+    isEnvFlagSet('ACTIONS_STEP_DEBUG')
+  );
+}
+
+/**
+ * Flags whose `name=value` argument can carry a secret
+ */
+const SECRET_VALUE_FLAGS = ['-var', '-backend-config'];
+
+/**
+ * Masks values that may be secrets in a command line
+ *
+ * @param commandLine - Command line as [binary, ...args]
+ * @returns Command line with -var and -backend-config values replaced by ***
+ *
+ * @remarks
+ * Variable names and backend config keys are kept so the line stays useful;
+ * a -backend-config file path (no `=`) is left as is.
+ *
+ * @example
+ * redactCommandLine(['terraform', 'plan', '-var=db_password=hunter2', '-var', 'region=us-east-1'])
+ * // => ['terraform', 'plan', '-var=db_password=***', '-var', 'region=***']
+ */
+export function redactCommandLine(commandLine: string[]): string[] {
+  const redactAssignment = (value: string): string => {
+    const eq = value.indexOf('=');
+    return eq === -1 ? value : `${value.slice(0, eq)}=***`;
+  };
+
+  return commandLine.map((arg, i) => {
+    const flag = SECRET_VALUE_FLAGS.find((f) => arg.startsWith(`${f}=`));
+    if (flag) {
+      return `${flag}=${redactAssignment(arg.slice(flag.length + 1))}`;
+    }
+    if (i > 0 && SECRET_VALUE_FLAGS.includes(commandLine[i - 1])) {
+      return redactAssignment(arg);
+    }
+    return arg;
+  });
+}
+
+/**
+ * Formats command arguments for a log line, with secrets masked
+ *
+ * @returns The arguments with a leading space, or an empty string without any
+ */
+function describeArgs(args: string[]): string {
+  return args.length > 0 ? ` ${redactCommandLine(args).join(' ')}` : '';
+}
+
+/**
+ * Formats a command line for the log, quoting arguments the shell would split
+ *
+ * @param commandLine - Command line as [binary, ...args]
+ * @returns Single line that can be copied into a shell
+ *
+ * @example
+ * formatCommandLine(['terraform', 'plan', '-var=name=hello world'])
+ * // => "terraform plan '-var=name=hello world'"
+ */
+export function formatCommandLine(commandLine: string[]): string {
+  return commandLine
+    .map((arg) => (/^[\w@%+=:,./-]+$/.test(arg) ? arg : `'${arg.replace(/'/g, "'\\''")}'`))
+    .join(' ');
+}
+
+/**
+ * Runs a command through the runner, logging it first in debug mode
+ *
+ * @param binary - Command to run
+ * @param args - Command arguments
+ * @param options - exec options
+ * @param label - Command named when it is cancelled (default: the binary)
+ * @returns Exit code
+ * @throws RunCancelledError if the run is cancelled before or while the command runs
+ *
+ * @remarks
+ * Once cancellation is trapped, every command is stopped when the run is cancelled.
+ */
+async function runCommand(
+  binary: string,
+  args: string[],
+  options?: CommandOptions,
+  label = path.basename(binary)
+): Promise<number> {
+  throwIfCancelled(label);
+  if (isDebugEnabled()) {
+    core.info(`[debug] ${formatCommandLine(redactCommandLine([binary, ...args]))}`);
+  }
+  const signal = options?.signal ?? getCancellationSignal();
+  const exitCode = await runner(binary, args, signal ? { ...options, signal } : options);
+  // The exit code of a stopped command says nothing about the command itself
+  throwIfCancelled(label);
+  return exitCode;
+}
+
+/**
+ * Runs a command through the runner, stopping it once it outlives its timeout
+ *
+ * @param subcommand - Terraform subcommand being run (e.g., plan)
+ * @param timeout - Deadline of the command; without one it may run for as long as it takes
+ * @param binary - Command to run
+ * @param args - Command arguments
+ * @param options - exec options
+ * @returns Exit code
+ * @throws TerraformCommandError once a command that timed out has exited
+ */
+async function runCommandWithTimeout(
+  subcommand: string,
+  timeout: CommandTimeout | undefined,
+  binary: string,
+  args: string[],
+  options: exec.ExecOptions
+): Promise<number> {
+  const label = `terraform ${subcommand}`;
+  if (!timeout) {
+    return runCommand(binary, args, options, label);
+  }
+
+  const controller = new AbortController();
+  const timer = setTimeout(() => {
+    core.warning(`${label} is still running after ${timeout.duration}, stopping it`);
+    controller.abort();
+  }, timeout.ms);
+  // The command has its own signal, so it must also follow the cancellation of the run
+  const cancellation = getCancellationSignal();
+  const cancel = () => controller.abort();
+  cancellation?.addEventListener('abort', cancel, { once: true });
+  // The output so far is shown with the timeout, as it tells where the command hung
+  let output = '';
+  const capture = (data: Buffer) => {
+    output += data.toString();
+  };
+  const listeners = {
+    stdout: (data: Buffer) => {
+      capture(data);
+      options.listeners?.stdout?.(data);
+    },
+    stderr: (data: Buffer) => {
+      capture(data);
+      options.listeners?.stderr?.(data);
+    },
+  };
+  let exitCode: number;
+  try {
+    exitCode = await runCommand(
+      binary,
+      args,
+      { ...options, signal: controller.signal, listeners },
+      label
+    );
+  } finally {
+    clearTimeout(timer);
+    cancellation?.removeEventListener('abort', cancel);
+  }
+
+  if (controller.signal.aborted) {
+    const message = `Terraform ${subcommand} timed out after ${timeout.duration}`;
+    throw new TerraformCommandError(
+      message,
+      subcommand,
+      output ? `${message}. Output before it was stopped:\n${output}` : message,
+      false
+    );
+  }
+  return exitCode;
+}
+
+/**
+ * Error raised when a terraform command exits with a failure
+ */
+export class TerraformCommandError extends Error {
+  /**
+   * @param message - Error message
+   * @param subcommand - Terraform subcommand that failed (e.g., init, plan, apply)
+   * @param output - Captured error output
+   * @param reportedByTfcmt - Whether tfcmt already posted the failure to the PR
+   */
+  constructor(
+    message: string,
+    readonly subcommand: string,
+    readonly output: string,
+    readonly reportedByTfcmt: boolean
+  ) {
+    super(message);
+    this.name = 'TerraformCommandError';
+  }
+}
+
+/**
+ * State lock details printed by terraform when a lock cannot be acquired or released
+ */
+export interface StateLockInfo {
+  /** Lock ID, as passed to force-unlock */
+  id: string;
+  /** Holder of the lock as user@host, if printed */
+  who?: string;
+  /** Operation that took the lock (e.g., OperationTypeApply), if printed */
+  operation?: string;
+  /** Whether terraform failed to release a lock it had acquired itself */
+  releaseFailed: boolean;
+}
+
+/**
+ * Name of the tfenv version pin file
+ */
+const TERRAFORM_VERSION_FILE = '.terraform-version';
+
+/**
+ * Name of the tofuenv version pin file
+ */
+const OPENTOFU_VERSION_FILE = '.opentofu-version';
+
+/**
+ * Terragrunt configuration file of a directory (projects with one run terragrunt by default)
+ */
+export const TERRAGRUNT_CONFIG_FILE = 'terragrunt.hcl';
+
+/**
+ * Matches a required_version constraint in a terraform file
+ */
+const REQUIRED_VERSION_REGEX = /required_version\s*=\s*"([^"]*)"/;
+
+/**
+ * Matches a required_version constraint that allows a single version, e.g. "1.7.0" or "= 1.7.0"
+ */
+const EXACT_CONSTRAINT_REGEX = /^\s*=?\s*v?(\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?)\s*$/;
+
+/**
+ * Finds the terraform version a project asks for
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param configuredVersion - terraform_version from the project configuration
+ * @param binary - CLI the project runs with; OpenTofu reads .opentofu-version instead
+ * @returns Requested version and where it was found, or null if nothing is requested
+ *
+ * @remarks
+ * terraform_version wins over a .terraform-version file, which wins over a required_version
+ * constraint in the directory's .tf files. A constraint allowing several versions
+ * (e.g., >= 1.5) is not resolved, so the terraform on PATH is used for it.
+ */
+export function findRequestedTerraformVersion(
+  workingDir: string,
+  configuredVersion?: string,
+  binary: TerraformBinary = 'terraform'
+): { version: string; source: string } | null {
+  if (configuredVersion) {
+    return { version: configuredVersion, source: 'terraform_version' };
+  }
+
+  const versionFileName = binary === 'tofu' ? OPENTOFU_VERSION_FILE : TERRAFORM_VERSION_FILE;
+  const versionFile = path.join(workingDir, versionFileName);
+  if (fs.existsSync(versionFile)) {
+    const version = fs.readFileSync(versionFile, 'utf8').split('\n')[0].trim();
+    if (version) {
+      return { version, source: versionFileName };
+    }
+    core.warning(`${versionFile} is empty, using default terraform binary`);
+    return null;
+  }
+
+  const tfFiles = fs.existsSync(workingDir)
+    ? fs.readdirSync(workingDir).filter((name) => name.endsWith('.tf'))
+    : [];
+  for (const name of tfFiles.sort()) {
+    const content = fs.readFileSync(path.join(workingDir, name), 'utf8');
+    const match = content.match(REQUIRED_VERSION_REGEX);
+    if (!match) {
+      continue;
+    }
+    const exact = match[1].match(EXACT_CONSTRAINT_REGEX);
+    if (exact) {
+      return { version: exact[1], source: `required_version in ${name}` };
+    }
+    core.info(
+      `required_version "${match[1]}" in ${name} is not an exact version, using terraform on PATH`
+    );
+    return null;
+  }
+
+  return null;
+}
+
+/**
+ * Resolves the terraform binary to use for a project directory
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param executionOptions - Per-project execution options (binary and terraformVersion)
+ * @returns Path or name of the terraform (or tofu) binary
+ * @throws Error if the requested version cannot be downloaded or fails checksum verification
+ *
+ * @remarks
+ * - Without a requested version (see findRequestedTerraformVersion), the binary on PATH is used
+ * - A matching version in the runner tool cache is preferred when available
+ * - An exact version is otherwise downloaded from HashiCorp (or OpenTofu) releases and cached
+ * - OpenTofu's latest is resolved to a version through the OpenTofu releases API
+ * - Other specs (e.g., latest:^1.5) are installed with `tfenv install` (or tofuenv) if it is
+ *   on PATH, and run through its shim, which picks them up from the project directory
+ * - Falls back to the default binary with a warning when neither is possible
+ */
+export async function resolveTerraformBinary(
+  workingDir: string,
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<string> {
+  const binary = executionOptions.binary ?? 'terraform';
+  const requested = findRequestedTerraformVersion(
+    workingDir,
+    executionOptions.terraformVersion,
+    binary
+  );
+  if (!requested) {
+    return binary;
+  }
+
+  const { source } = requested;
+  core.info(`Found ${source} requesting ${binary} ${requested.version}`);
+
+  // OpenTofu publishes its releases in an API, so latest needs no version manager
+  const version =
+    binary === 'tofu' && requested.version === 'latest'
+      ? await resolveLatestOpenTofuVersion()
+      : requested.version;
+
+  const cachedDir = tc.find(binary, version);
+  if (cachedDir) {
+    const binaryName = process.platform === 'win32' ? `${binary}.exe` : binary;
+    const cachedPath = path.join(cachedDir, binaryName);
+    core.info(`Using cached ${binary} ${version}: ${cachedPath}`);
+    return cachedPath;
+  }
+
+  if (EXACT_VERSION_PATTERN.test(version)) {
+    return installTerraform(version, binary);
+  }
+
+  const versionManager = binary === 'tofu' ? 'tofuenv' : 'tfenv';
+  const managerPath = await io.which(versionManager, false);
+  if (managerPath) {
+    core.info(`Installing ${binary} ${version} with ${versionManager}`);
+    const exitCode = await runCommand(managerPath, ['install', version], {
+      cwd: workingDir,
+      ignoreReturnCode: true,
+    });
+    if (exitCode !== 0) {
+      throw new Error(
+        `${versionManager} failed to install ${binary} ${version} (exit code ${exitCode})`
+      );
+    }
+    return resolveVersionManagerBinary(binary, versionManager, managerPath, workingDir);
+  }
+
+  core.warning(
+    `${binary} ${version} requested by ${source} is not available and ${versionManager} is not installed, using default ${binary} binary`
+  );
+  return binary;
+}
+
+/**
+ * Finds the binary that runs the version a version manager selected for a project directory
+ *
+ * @param binary - CLI the version manager installs (terraform or tofu)
+ * @param versionManager - tfenv or tofuenv
+ * @param managerPath - Path of the version manager
+ * @param workingDir - Project directory the version is selected for
+ * @returns The shim installed next to the version manager, or the binary on PATH without one
+ * @throws Error if the binary runs another version than the one selected
+ *
+ * @remarks
+ * A binary on PATH only goes through the shim when the shim comes first, so another install
+ * earlier on PATH (e.g., from setup-terraform) would otherwise run instead of the pinned version.
+ */
+async function resolveVersionManagerBinary(
+  binary: TerraformBinary,
+  versionManager: string,
+  managerPath: string,
+  workingDir: string
+): Promise<string> {
+  const shimName = process.platform === 'win32' ? `${binary}.exe` : binary;
+  const shim = path.join(path.dirname(managerPath), shimName);
+  const resolved = fs.existsSync(shim) ? shim : binary;
+
+  const selected = (await readCommandOutput(managerPath, ['version-name'], workingDir)).trim();
+  const output = await readCommandOutput(resolved, ['version', '-json'], workingDir);
+  let running: string | undefined;
+  try {
+    const version = (JSON.parse(output) as { terraform_version?: unknown }).terraform_version;
+    running = typeof version === 'string' ? version : undefined;
+  } catch {
+    running = undefined;
+  }
+  if (running !== selected) {
+    throw new Error(
+      `${resolved} runs ${running ? `${binary} ${running}` : `an unknown ${binary} version`}, not ${selected} selected by ${versionManager} (put the ${versionManager} shims first on PATH)`
+    );
+  }
+  core.info(`Using ${binary} ${selected} selected by ${versionManager}: ${resolved}`);
+  return resolved;
+}
+
+/**
+ * Runs a command and returns its stdout
+ *
+ * @throws Error if the command exits with a non-zero code
+ */
+async function readCommandOutput(
+  binary: string,
+  args: string[],
+  workingDir: string
+): Promise<string> {
+  let stdout = '';
+  const exitCode = await runCommand(binary, args, {
+    cwd: workingDir,
+    silent: true,
+    ignoreReturnCode: true,
+    listeners: {
+      stdout: (data: Buffer) => {
+        stdout += data.toString();
+      },
+    },
+  });
+  if (exitCode !== 0) {
+    throw new Error(`${path.basename(binary)} ${args.join(' ')} failed (exit code ${exitCode})`);
+  }
+  return stdout;
+}
+
+/**
+ * Whether a project runs with terragrunt
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param executionOptions - Per-project execution options
+ * @returns The terragrunt option when set, otherwise whether the project uses run-all or the
+ * directory has a terragrunt.hcl (a run-all root often has none of its own)
+ */
+export function usesTerragrunt(
+  workingDir: string,
+  executionOptions: TerraformExecutionOptions = {}
+): boolean {
+  return (
+    executionOptions.terragrunt ??
+    (executionOptions.terragruntRunAll === true ||
+      fs.existsSync(path.join(workingDir, TERRAGRUNT_CONFIG_FILE)))
+  );
+}
+
+/**
+ * Builds the binary and leading arguments for a terraform subcommand
+ *
+ * @param subcommand - Terraform subcommand (e.g., init, plan, apply)
+ * @param workingDir - Directory containing Terraform files
+ * @param terraformBinary - Resolved terraform binary
+ * @param executionOptions - Per-project execution options
+ * @returns Command line as [binary, ...args]
+ *
+ * @example
+ * buildCommandLine('plan', '/repo/prod', 'terraform', {})
+ * // => ['terraform', 'plan']
+ *
+ * @example
+ * buildCommandLine('plan', '/repo/prod', 'terraform', { terragrunt: true, terragruntRunAll: true })
+ * // => ['terragrunt', 'run-all', 'plan', '--terragrunt-non-interactive', '--terragrunt-working-dir', '/repo/prod']
+ */
+export function buildCommandLine(
+  subcommand: string,
+  workingDir: string,
+  terraformBinary: string,
+  executionOptions: TerraformExecutionOptions = {}
+): string[] {
+  if (!usesTerragrunt(workingDir, executionOptions)) {
+    return [terraformBinary, subcommand];
+  }
+
+  const commandLine = ['terragrunt'];
+  if (executionOptions.terragruntRunAll) {
+    commandLine.push('run-all');
+  }
+  commandLine.push(subcommand);
+  commandLine.push('--terragrunt-non-interactive');
+  commandLine.push('--terragrunt-working-dir', workingDir);
+
+  // Let terragrunt use a pinned terraform binary instead of the one on PATH
+  if (terraformBinary !== 'terraform') {
+    commandLine.push('--terragrunt-tfpath', terraformBinary);
+  }
+
+  return commandLine;
+}
+
+/**
+ * Builds flags for terraform init
+ *
+ * @param executionOptions - Per-project execution options
+ * @param workingDir - Directory backend config files are resolved against (default: as given)
+ * @returns Terraform init flags
+ *
+ * @example
+ * buildInitArgs({ initUpgrade: true, initArgs: ['-upgrade', '-reconfigure'] })
+ * // => ['-upgrade', '-reconfigure']
+ *
+ * @example
+ * buildInitArgs({ initArgs: ['-upgrade'], initExtraArgs: ['-lockfile=readonly'] })
+ * // => ['-upgrade', '-lockfile=readonly']
+ *
+ * @example
+ * buildInitArgs({ backendConfigFiles: ['prod.hcl'], backendConfig: { key: 'prod' } }, '/repo/app')
+ * // => ['-backend-config=/repo/app/prod.hcl', '-backend-config=key=prod', '-reconfigure']
+ */
+export function buildInitArgs(
+  executionOptions: TerraformExecutionOptions,
+  workingDir?: string
+): string[] {
+  const flags: string[] = [];
+  if (executionOptions.initUpgrade) {
+    flags.push('-upgrade');
+  }
+  if (executionOptions.initBackend === false) {
+    flags.push('-backend=false');
+  } else {
+    // Files first, so that single settings override the values they contain
+    for (const file of executionOptions.backendConfigFiles ?? []) {
+      flags.push(`-backend-config=${workingDir ? path.resolve(workingDir, file) : file}`);
+    }
+    for (const [key, value] of Object.entries(executionOptions.backendConfig ?? {})) {
+      flags.push(`-backend-config=${key}=${value}`);
+    }
+    // Projects sharing a directory leave each other's backend in .terraform
+    const configured = flags.some((flag) => flag.startsWith('-backend-config='));
+    if (configured && !executionOptions.initArgs?.includes('-migrate-state')) {
+      flags.push('-reconfigure');
+    }
+  }
+  const { initArgs = [], initExtraArgs = [] } = executionOptions;
+  for (const arg of [...initArgs, ...initExtraArgs]) {
+    if (!flags.includes(arg)) {
+      flags.push(arg);
+    }
+  }
+  return flags;
+}
+
+/**
+ * Builds refresh and state lock flags for plan/apply
+ *
+ * @param executionOptions - Per-project execution options
+ * @param usingPlanFile - Whether apply uses a saved plan (planning flags are not allowed then)
+ * @returns Terraform flags
+ *
+ * @example
+ * buildStateFlags({ refresh: false, lockTimeout: '5m' }, false)
+ * // => ['-refresh=false', '-lock-timeout=5m']
+ */
+export function buildStateFlags(
+  executionOptions: TerraformExecutionOptions,
+  usingPlanFile: boolean
+): string[] {
+  const flags: string[] = [];
+
+  // Refresh is decided at plan time, so terraform rejects it with a saved plan
+  if (executionOptions.refresh === false && !usingPlanFile) {
+    flags.push('-refresh=false');
+  }
+  if (executionOptions.lockTimeout) {
+    flags.push(`-lock-timeout=${executionOptions.lockTimeout}`);
+  }
+
+  return flags;
+}
+
+/**
+ * Builds the -var-file and -var flags of a project
+ *
+ * @param executionOptions - Per-project execution options
+ * @param workingDir - Directory containing Terraform files (var files are relative to it)
+ * @param usingPlanFile - Whether apply uses a saved plan (variables are not allowed then)
+ * @returns Terraform flags, var files first so that -var values take precedence
+ *
+ * @example
+ * buildVarFlags({ varFiles: ['prod.tfvars'], vars: { region: 'us-east-1' } }, '/repo/prod', false)
+ * // => ['-var-file=/repo/prod/prod.tfvars', '-var=region=us-east-1']
+ */
+export function buildVarFlags(
+  executionOptions: TerraformExecutionOptions,
+  workingDir: string,
+  usingPlanFile: boolean
+): string[] {
+  // Variables are stored in a saved plan, and terraform rejects them on apply
+  if (usingPlanFile) {
+    return [];
+  }
+
+  // Absolute paths also work when terragrunt runs terraform from its cache directory
+  const flags = (executionOptions.varFiles ?? []).map(
+    (file) => `-var-file=${path.resolve(workingDir, file)}`
+  );
+  for (const [name, value] of Object.entries(executionOptions.vars ?? {})) {
+    flags.push(`-var=${name}=${value}`);
+  }
+  return flags;
+}
+
+/**
+ * Builds the tfcmt arguments that wrap a terraform plan or apply
+ *
+ * @param command - Terraform command ('plan' or 'apply')
+ * @param workingDir - Directory containing Terraform files
+ * @param projectName - Name of the project (used for plan file naming and tfcmt target)
+ * @param terraformBinary - Resolved terraform binary
+ * @param additionalArgs - Additional terraform arguments (e.g., -target, -var-file)
+ * @param planFilePath - Path to existing plan file (for apply command)
+ * @param executionOptions - Per-project execution options
+ * @param commentFilePath - File tfcmt writes its result to instead of commenting
+ * @returns tfcmt arguments, the plan file a plan saves, and whether apply uses a saved plan
+ *
+ * @example
+ * buildTfcmtArgs('plan', '/repo/prod', 'prod', 'terraform', ['-target=aws_instance.web'])
+ * // => {
+ * //   args: ['-var', 'target:prod', 'plan', '--', 'terraform', 'plan',
+ * //     '-out=/repo/prod/tfplan-prod', '-target=aws_instance.web', '-no-color', '-input=false'],
+ * //   planFilePath: '/repo/prod/tfplan-prod',
+ * //   usingPlanFile: false
+ * // }
+ */
+export function buildTfcmtArgs(
+  command: TerraformCommand,
+  workingDir: string,
+  projectName: string,
+  terraformBinary: string,
+  additionalArgs: string[] = [],
+  planFilePath?: string,
+  executionOptions: TerraformExecutionOptions = {},
+  commentFilePath?: string
+): { args: string[]; planFilePath?: string; usingPlanFile: boolean } {
+  // tfcmt [flags] -var "target:<project>" plan|apply -- terraform [command] [args]
+  const args: string[] = [];
+
+  if (executionOptions.tfcmtConfigPath) {
+    args.push('-config', executionOptions.tfcmtConfigPath);
+  }
+  if (commentFilePath) {
+    args.push('-output', commentFilePath);
+  }
+
+  // Add target variable for monorepo support
+  // This will prefix PR labels and comment titles with the project name
+  args.push('-var');
+  args.push(`target:${projectName}`);
+
+  // Add command
+  args.push(command);
+
+  // Add separator and terraform command
+  args.push('--');
+  args.push(...buildCommandLine(command, workingDir, terraformBinary, executionOptions));
+
+  // Generate plan file path for plan command, or use provided path for apply
+  let resultPlanFilePath: string | undefined;
+  const runAll =
+    executionOptions.terragruntRunAll === true && usesTerragrunt(workingDir, executionOptions);
+
+  if (runAll) {
+    // run-all produces one plan per module, so a single plan file cannot be reused
+    if (command === 'apply') {
+      args.push('-auto-approve');
+    }
+  } else if (command === 'plan') {
+    // Save plan to a file: tfplan-<projectName>
+    resultPlanFilePath = path.join(workingDir, `tfplan-${projectName}`);
+    args.push(`-out=${resultPlanFilePath}`);
+  } else if (command === 'apply' && planFilePath) {
+    // Use existing plan file
+    args.push(planFilePath);
+  } else if (command === 'apply') {
+    // Apply without plan file (legacy behavior)
+    args.push('-auto-approve');
+  }
+
+  const usingPlanFile = command === 'apply' && !runAll && Boolean(planFilePath);
+  args.push(...buildStateFlags(executionOptions, usingPlanFile));
+  args.push(...buildVarFlags(executionOptions, workingDir, usingPlanFile));
+  args.push(...additionalArgs);
+  args.push('-no-color');
+  args.push('-input=false');
+
+  return { args, planFilePath: resultPlanFilePath, usingPlanFile };
+}
 
 /**
  * Executes Terraform command wrapped with tfcmt
  *
- * @param tfcmtPath - Path to tfcmt binary
- * @param command - Terraform command to execute ('plan' or 'apply')
+ * @param tfcmtPath - Path to tfcmt binary
+ * @param command - Terraform command to execute ('plan' or 'apply')
+ * @param workingDir - Directory containing Terraform files
+ * @param projectName - Name of the project (used for plan file naming and tfcmt target)
+ * @param additionalArgs - Additional terraform arguments (e.g., -target, -var-file)
+ * @param planFilePath - Path to existing plan file (for apply command)
+ * @param executionOptions - Per-project execution options (e.g., terragrunt)
+ * @returns Terraform execution result
+ *
+ * @remarks
+ * Executes: tfcmt -var "target:<projectName>" plan -- terraform plan [args]
+ * - Uses tfcmt's target variable for monorepo support to prefix PR labels and comment titles
+ * - Terraform plan returns exit code 0 for no changes, 2 for changes detected, 1 for errors
+ * - Terraform apply returns exit code 0 for success, 1 for errors
+ * - tfcmt automatically posts output as PR comment
+ * - For plan commands, saves plan file to <workingDir>/tfplan-<projectName>
+ * - For apply commands, uses provided planFilePath if available
+ * - With suppressComment, tfcmt writes its result to a file instead of commenting
+ * - With terragrunt run-all, plan files are not saved and apply uses -auto-approve,
+ *   since each module in the tree produces its own plan
+ */
+export async function executeTerraform(
+  tfcmtPath: string,
+  command: TerraformCommand,
+  workingDir: string,
+  projectName: string,
+  additionalArgs: string[] = [],
+  planFilePath?: string,
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<TerraformResult> {
+  const argsStr = describeArgs(additionalArgs);
+  core.info(`Executing terraform ${command}${argsStr} in ${workingDir}`);
+
+  const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+
+  // Write the result to a file instead of posting a PR comment
+  const commentFilePath = executionOptions.suppressComment
+    ? path.join(process.env.RUNNER_TEMP || os.tmpdir(), `tfcmt-${command}-${projectName}.md`)
+    : undefined;
+
+  const {
+    args: tfcmtArgs,
+    planFilePath: resultPlanFilePath,
+    usingPlanFile,
+  } = buildTfcmtArgs(
+    command,
+    workingDir,
+    projectName,
+    terraformBinary,
+    additionalArgs,
+    planFilePath,
+    executionOptions,
+    commentFilePath
+  );
+  if (resultPlanFilePath) {
+    core.info(`Plan will be saved to: ${resultPlanFilePath}`);
+  } else if (usingPlanFile) {
+    core.info(`Applying existing plan from: ${planFilePath}`);
+  }
+
+  // Capture stdout and stderr
+  let stdout = '';
+  let stderr = '';
+
+  const options: exec.ExecOptions = {
+    cwd: workingDir,
+    ignoreReturnCode: true,
+    env: withProcessEnv(executionOptions.env),
+    listeners: {
+      stdout: (data: Buffer) => {
+        stdout += data.toString();
+      },
+      stderr: (data: Buffer) => {
+        stderr += data.toString();
+      },
+    },
+  };
+
+  const [initBinary, ...initArgs] = buildCommandLine(
+    'init',
+    workingDir,
+    terraformBinary,
+    executionOptions
+  );
+  initArgs.push(...buildInitArgs(executionOptions, workingDir));
+
+  const timeout = command === 'plan' ? executionOptions.planTimeout : executionOptions.applyTimeout;
+  const attempt = async () => {
+    stdout = '';
+    stderr = '';
+    // A custom workflow has already run its own init step (and selected the workspace)
+    const initCode = executionOptions.skipInit
+      ? 0
+      : await withPluginCacheLock(() => runCommand(initBinary, initArgs, options));
+    if (initCode === 0 && !executionOptions.skipInit) {
+      await selectWorkspace(workingDir, terraformBinary, executionOptions);
+    }
+    return {
+      initExitCode: initCode,
+      exitCode:
+        initCode === 0
+          ? await runCommandWithTimeout(command, timeout, tfcmtPath, tfcmtArgs, options)
+          : 0,
+    };
+  };
+
+  let attempts: { result: { initExitCode: number; exitCode: number }; retries: number };
+  try {
+    // A failed apply may already have changed resources, so only its init is retried
+    attempts = await retryTransientErrors(
+      `terraform ${command}`,
+      executionOptions.retry,
+      attempt,
+      (r) =>
+        r.initExitCode !== 0 || (command === 'plan' && r.exitCode === 1) ? stderr || stdout : null
+    );
+  } catch (error) {
+    if (error instanceof TerraformCommandError) {
+      throw error;
+    }
+    throw new Error(
+      `Failed to execute tfcmt/terraform: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+  const { initExitCode, exitCode } = attempts.result;
+  const { retries } = attempts;
+
+  // init is not wrapped by tfcmt, so its failure has not been reported anywhere yet
+  if (initExitCode !== 0) {
+    throw new TerraformCommandError(
+      `Terraform init failed with ${describeFailure(initExitCode, retries)}:\n${stderr}`,
+      'init',
+      stderr || stdout,
+      false
+    );
+  }
+
+  // For plan command, exit code 2 means changes detected
+  const hasChanges = command === 'plan' && exitCode === 2;
+
+  // Exit codes: 0 = success/no changes, 1 = error, 2 = changes (plan only)
+  if (exitCode === 1) {
+    throw new TerraformCommandError(
+      `Terraform ${command} failed with ${describeFailure(exitCode, retries)}:\n${stderr}`,
+      command,
+      stderr || stdout,
+      !executionOptions.suppressComment
+    );
+  }
+
+  core.info(`Terraform ${command} completed with exit code ${exitCode}`);
+
+  return withRetries(
+    {
+      exitCode,
+      hasChanges,
+      stdout,
+      stderr,
+      planFilePath: resultPlanFilePath,
+      commentFilePath,
+    },
+    retries
+  );
+}
+
+/**
+ * Executes Terraform command with tfcmt integration
+ *
+ * @param tfcmtPath - Path to tfcmt binary
+ * @param command - Terraform command to execute
+ * @param projectName - Name of the project being executed
+ * @param workingDir - Directory containing Terraform files
+ * @param additionalArgs - Additional terraform arguments
+ * @param planFilePath - Path to existing plan file (for apply command)
+ * @param executionOptions - Per-project execution options
+ * @returns Terraform execution result
+ *
+ * @remarks
+ * Executes terraform wrapped with tfcmt for automatic PR comment posting
+ */
+export async function executeTerraformWithTfcmt(
+  tfcmtPath: string,
+  command: TerraformCommand,
+  projectName: string,
+  workingDir: string,
+  additionalArgs: string[] = [],
+  planFilePath?: string,
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<TerraformResult> {
+  const argsStr = describeArgs(additionalArgs);
+  core.startGroup(`Executing terraform ${command}${argsStr} for project: ${projectName}`);
+
+  try {
+    return await executeTerraform(
+      tfcmtPath,
+      command,
+      workingDir,
+      projectName,
+      additionalArgs,
+      planFilePath,
+      executionOptions
+    );
+  } finally {
+    core.endGroup();
+  }
+}
+
+/**
+ * Executes terraform init on its own (the `terraform init` comment command)
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param projectName - Name of the project being initialized
+ * @param executionOptions - Per-project execution options, including init flags
+ * @returns Terraform execution result
+ * @throws TerraformCommandError if init fails
+ *
+ * @remarks
+ * tfcmt only supports plan and apply, so the result is not posted by tfcmt;
+ * callers are responsible for reporting it.
+ */
+export async function executeTerraformInit(
+  workingDir: string,
+  projectName: string,
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<TerraformResult> {
+  const initFlags = buildInitArgs(executionOptions, workingDir);
+  const flagsStr = describeArgs(initFlags);
+  core.startGroup(`Executing terraform init${flagsStr} for project: ${projectName}`);
+
+  try {
+    const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+    const [binary, ...args] = buildCommandLine(
+      'init',
+      workingDir,
+      terraformBinary,
+      executionOptions
+    );
+    args.push(...initFlags, '-no-color', '-input=false');
+
+    const { exitCode, stdout, stderr, retries } = await withPluginCacheLock(() =>
+      execRetrying(
+        'terraform init',
+        executionOptions.retry,
+        binary,
+        args,
+        workingDir,
+        false,
+        executionOptions.env
+      )
+    );
+
+    if (exitCode !== 0) {
+      throw new TerraformCommandError(
+        `Terraform init failed with ${describeFailure(exitCode, retries)}:\n${stderr}`,
+        'init',
+        stderr || stdout,
+        false
+      );
+    }
+
+    await selectWorkspace(workingDir, terraformBinary, executionOptions);
+    core.info('Terraform init completed successfully');
+
+    return withRetries({ exitCode, hasChanges: false, stdout, stderr }, retries);
+  } finally {
+    core.endGroup();
+  }
+}
+
+/**
+ * Runs a shell command step of a custom workflow
+ *
+ * @param command - Command run with bash
+ * @param workingDir - Directory containing Terraform files, where the command runs
+ * @param env - Variables added to the environment of the runner
+ * @param stepName - Name the failure is reported under (e.g., plan workflow step)
+ * @returns Execution result of the command
+ * @throws TerraformCommandError if the command exits with a failure
+ */
+export async function executeRunStep(
+  command: string,
+  workingDir: string,
+  env: Record<string, string> = {},
+  stepName = 'workflow step'
+): Promise<TerraformResult> {
+  core.info(`Running workflow step: ${command}`);
+
+  const { exitCode, stdout, stderr } = await execCaptured(
+    'bash',
+    ['-c', command],
+    workingDir,
+    false,
+    env
+  );
+  if (exitCode !== 0) {
+    throw new TerraformCommandError(
+      `Workflow step failed with exit code ${exitCode}: ${command}\n${stderr}`,
+      stepName,
+      stderr || stdout,
+      false
+    );
+  }
+
+  return { exitCode, hasChanges: false, stdout, stderr };
+}
+
+/**
+ * Checks a plan JSON against OPA/Rego policies with `conftest test`
+ *
+ * @param planJsonPath - Path to the output of `terraform show -json`
+ * @param policyDirs - Directories of .rego files
+ * @param workingDir - Directory conftest runs in
+ * @returns Exit code (0 when every policy passed) and captured output
+ * @throws Error if conftest is not installed
+ *
+ * @remarks
+ * Policies in every package are evaluated, not only those in package main.
+ */
+export async function executeConftest(
+  planJsonPath: string,
+  policyDirs: string[],
+  workingDir: string
+): Promise<{ exitCode: number; stdout: string; stderr: string }> {
+  const args = [
+    'test',
+    '--no-color',
+    '--all-namespaces',
+    ...policyDirs.flatMap((dir) => ['--policy', dir]),
+    planJsonPath,
+  ];
+
+  try {
+    return await execCaptured('conftest', args, workingDir);
+  } catch (_error) {
+    throw new Error(
+      'conftest is not installed or not available in PATH. ' +
+        'Please ensure conftest is installed before running this action with policy checks.'
+    );
+  }
+}
+
+/**
+ * Writes the output of `terraform show -json` for tools that read it (conftest, infracost)
+ *
+ * @param projectName - Name of the project
+ * @param planJson - Plan JSON
+ * @returns Path to the file, in the runner's temporary directory
+ *
+ * @remarks
+ * The plan JSON holds sensitive values in clear text, so it is kept out of the checkout.
+ */
+export function writePlanJson(projectName: string, planJson: string): string {
+  const planJsonPath = path.join(
+    process.env.RUNNER_TEMP || os.tmpdir(),
+    `tfplan-${projectName}.json`
+  );
+  fs.writeFileSync(planJsonPath, planJson, { mode: 0o600 });
+  return planJsonPath;
+}
+
+/**
+ * Estimates the monthly cost of a plan JSON with `infracost breakdown`
+ *
+ * @param planJsonPath - Path to the output of `terraform show -json`
+ * @param workingDir - Directory infracost runs in
+ * @returns Infracost JSON output
+ * @throws Error if infracost is not installed or fails (e.g., without INFRACOST_API_KEY)
+ */
+export async function executeInfracost(planJsonPath: string, workingDir: string): Promise<string> {
+  const args = ['breakdown', '--path', planJsonPath, '--format', 'json', '--no-color'];
+
+  let result: { exitCode: number; stdout: string; stderr: string };
+  try {
+    result = await execCaptured('infracost', args, workingDir, true);
+  } catch (_error) {
+    throw new Error(
+      'infracost is not installed or not available in PATH. ' +
+        'Please ensure infracost is installed before running this action with cost estimation.'
+    );
+  }
+
+  if (result.exitCode !== 0) {
+    throw new Error(`infracost failed with exit code ${result.exitCode}:\n${result.stderr}`);
+  }
+  return result.stdout;
+}
+
+/**
+ * Runs a security scanner and returns its JSON report
+ *
+ * @param tool - Scanner to run
+ * @param target - Whether a directory or a plan JSON file is scanned
+ * @param targetPath - Directory or plan JSON file to scan
+ * @param workingDir - Working directory
+ * @returns JSON output of the scanner
+ * @throws Error if the scanner is not installed or fails
+ *
+ * @remarks
+ * Findings never make the scanner fail (soft fail), so a non-zero exit code is an error.
+ */
+export async function executeSecurityScanner(
+  tool: SecurityScanner,
+  target: 'dir' | 'plan',
+  targetPath: string,
+  workingDir: string
+): Promise<string> {
+  const args =
+    tool === 'tfsec'
+      ? [targetPath, '--format', 'json', '--no-color', '--soft-fail']
+      : tool === 'trivy'
+        ? ['config', '--format', 'json', '--quiet', '--exit-code', '0', targetPath]
+        : [
+            target === 'plan' ? '--file' : '--directory',
+            targetPath,
+            '--framework',
+            target === 'plan' ? 'terraform_plan' : 'terraform',
+            '--output',
+            'json',
+            '--soft-fail',
+            '--compact',
+            '--quiet',
+          ];
+
+  let result: { exitCode: number; stdout: string; stderr: string };
+  try {
+    result = await execCaptured(tool, args, workingDir, true);
+  } catch (_error) {
+    throw new Error(
+      `${tool} is not installed or not available in PATH. ` +
+        'Please ensure it is installed before running this action with security_scan.'
+    );
+  }
+
+  if (result.exitCode !== 0) {
+    throw new Error(`${tool} failed with exit code ${result.exitCode}:\n${result.stderr}`);
+  }
+  return result.stdout;
+}
+
+/**
+ * Checks a project for drift with `terraform plan -detailed-exitcode`
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param projectName - Name of the project being checked
+ * @param executionOptions - Per-project execution options
+ * @returns Terraform execution result (hasChanges is true when the project has drifted)
+ * @throws TerraformCommandError if init or plan fails
+ *
+ * @remarks
+ * - Runs without tfcmt and without saving a plan file, since there is no PR to comment on
+ * - Always refreshes state, as skipping refresh would hide drift
+ */
+export async function executeDriftCheck(
+  workingDir: string,
+  projectName: string,
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<TerraformResult> {
+  core.startGroup(`Checking drift for project: ${projectName}`);
+
+  try {
+    const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+    await runInit(workingDir, terraformBinary, executionOptions);
+
+    const [planBinary, ...planArgs] = buildCommandLine(
+      'plan',
+      workingDir,
+      terraformBinary,
+      executionOptions
+    );
+    planArgs.push('-detailed-exitcode');
+    planArgs.push(...buildStateFlags({ lockTimeout: executionOptions.lockTimeout }, false));
+    planArgs.push(...buildVarFlags(executionOptions, workingDir, false));
+    planArgs.push('-no-color');
+    planArgs.push('-input=false');
+
+    const { result, retries } = await retryTransientErrors(
+      'terraform plan',
+      executionOptions.retry,
+      () =>
+        execCaptured(
+          planBinary,
+          planArgs,
+          workingDir,
+          false,
+          executionOptions.env,
+          'plan',
+          executionOptions.planTimeout
+        ),
+      (r) => (r.exitCode !== 0 && r.exitCode !== 2 ? r.stderr || r.stdout : null)
+    );
+    const { exitCode, stdout, stderr } = result;
+
+    // Exit codes: 0 = no drift, 1 = error, 2 = drift detected
+    if (exitCode !== 0 && exitCode !== 2) {
+      throw new TerraformCommandError(
+        `Terraform plan failed with ${describeFailure(exitCode, retries)}:\n${stderr}`,
+        'plan',
+        stderr || stdout,
+        false
+      );
+    }
+
+    const hasChanges = exitCode === 2;
+    core.info(hasChanges ? 'Drift detected' : 'No drift detected');
+
+    return withRetries({ exitCode, hasChanges, stdout, stderr }, retries);
+  } finally {
+    core.endGroup();
+  }
+}
+
+/**
+ * Executes `terraform state <subcommand>` for a project
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param projectName - Name of the project
+ * @param subcommand - State subcommand (list, show, rm or mv)
+ * @param args - Arguments for the subcommand (e.g., resource addresses)
+ * @param executionOptions - Per-project execution options
+ * @returns Terraform execution result
+ * @throws TerraformCommandError if init or the state command fails
+ */
+export async function executeTerraformState(
+  workingDir: string,
+  projectName: string,
+  subcommand: StateSubcommand,
+  args: string[],
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<TerraformResult> {
+  const argsStr = describeArgs(args);
+  core.startGroup(`Executing terraform state ${subcommand}${argsStr} for project: ${projectName}`);
+
+  try {
+    const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+    await runInit(workingDir, terraformBinary, executionOptions);
+
+    const [binary, ...stateArgs] = buildCommandLine(
+      'state',
+      workingDir,
+      terraformBinary,
+      executionOptions
+    );
+    stateArgs.push(subcommand, ...args);
+
+    // rm and mv may have written state before failing, so only list and show are retried
+    const { exitCode, stdout, stderr, retries } = await execRetrying(
+      `terraform state ${subcommand}`,
+      subcommand === 'rm' || subcommand === 'mv' ? undefined : executionOptions.retry,
+      binary,
+      stateArgs,
+      workingDir,
+      false,
+      executionOptions.env
+    );
+
+    if (exitCode !== 0) {
+      throw new TerraformCommandError(
+        `Terraform state ${subcommand} failed with ${describeFailure(exitCode, retries)}:\n${stderr}`,
+        `state ${subcommand}`,
+        stderr || stdout,
+        false
+      );
+    }
+
+    return withRetries({ exitCode, hasChanges: false, stdout, stderr }, retries);
+  } finally {
+    core.endGroup();
+  }
+}
+
+/**
+ * Executes `terraform import ADDRESS ID` for a project
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param projectName - Name of the project
+ * @param address - Resource address to import into (e.g., aws_s3_bucket.b)
+ * @param id - Provider-specific ID of the existing resource
+ * @param args - Additional flags (e.g., -var-file), placed before the address and ID
+ * @param executionOptions - Per-project execution options
+ * @returns Terraform execution result
+ * @throws TerraformCommandError if init or the import fails
+ *
+ * @remarks
+ * An import targets a single module, so terragrunt run-all is not used.
+ */
+export async function executeTerraformImport(
+  workingDir: string,
+  projectName: string,
+  address: string,
+  id: string,
+  args: string[] = [],
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<TerraformResult> {
+  core.startGroup(`Executing terraform import ${address} ${id} for project: ${projectName}`);
+
+  try {
+    const options = { ...executionOptions, terragruntRunAll: false };
+    const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+    await runInit(workingDir, terraformBinary, options);
+
+    const [binary, ...importArgs] = buildCommandLine(
+      'import',
+      workingDir,
+      terraformBinary,
+      options
+    );
+    if (options.lockTimeout) {
+      importArgs.push(`-lock-timeout=${options.lockTimeout}`);
+    }
+    importArgs.push(...buildVarFlags(options, workingDir, false));
+    importArgs.push(...args, '-no-color', '-input=false', address, id);
+
+    const { exitCode, stdout, stderr } = await execCaptured(
+      binary,
+      importArgs,
+      workingDir,
+      false,
+      options.env
+    );
+
+    if (exitCode !== 0) {
+      throw new TerraformCommandError(
+        `Terraform import failed with exit code ${exitCode}:\n${stderr}`,
+        'import',
+        stderr || stdout,
+        false
+      );
+    }
+
+    return { exitCode, hasChanges: false, stdout, stderr };
+  } finally {
+    core.endGroup();
+  }
+}
+
+/**
+ * Plans the resource an import brought under management, with `terraform plan -target`
+ *
+ * @param workingDir - Directory containing Terraform files (initialized by the import)
+ * @param projectName - Name of the project
+ * @param address - Address of the imported resource
+ * @param executionOptions - Per-project execution options
+ * @returns Terraform execution result (hasChanges is true when apply would change the resource)
+ * @throws TerraformCommandError if the plan fails
+ *
+ * @remarks
+ * The plan is a dry run: it saves no plan file and does not lock the state. Any change it
+ * shows is a difference between the configuration and the imported resource.
+ */
+export async function executeImportPlan(
+  workingDir: string,
+  projectName: string,
+  address: string,
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<TerraformResult> {
+  core.startGroup(`Planning imported resource ${address} for project: ${projectName}`);
+
+  try {
+    const options = { ...executionOptions, terragruntRunAll: false };
+    const terraformBinary = await resolveTerraformBinary(workingDir, options);
+    const [binary, ...planArgs] = buildCommandLine('plan', workingDir, terraformBinary, options);
+    planArgs.push('-detailed-exitcode', '-lock=false', `-target=${address}`);
+    planArgs.push(...buildVarFlags(options, workingDir, false));
+    planArgs.push('-no-color', '-input=false');
+
+    const { exitCode, stdout, stderr } = await execCaptured(
+      binary,
+      planArgs,
+      workingDir,
+      false,
+      options.env,
+      'plan',
+      options.planTimeout
+    );
+
+    // Exit codes: 0 = matches the configuration, 1 = error, 2 = apply would change it
+    if (exitCode !== 0 && exitCode !== 2) {
+      throw new TerraformCommandError(
+        `Terraform plan failed with exit code ${exitCode}:\n${stderr}`,
+        'plan',
+        stderr || stdout,
+        false
+      );
+    }
+
+    return { exitCode, hasChanges: exitCode === 2, stdout, stderr };
+  } finally {
+    core.endGroup();
+  }
+}
+
+/**
+ * Executes `terraform destroy -auto-approve` for a project
+ *
  * @param workingDir - Directory containing Terraform files
- * @param projectName - Name of the project (used for plan file naming and tfcmt target)
- * @param additionalArgs - Additional terraform arguments (e.g., -target, -var-file)
- * @param planFilePath - Path to existing plan file (for apply command)
+ * @param projectName - Name of the project
+ * @param args - Additional flags (e.g., -target, -var-file)
+ * @param executionOptions - Per-project execution options
  * @returns Terraform execution result
+ * @throws TerraformCommandError if init or the destroy fails
  *
  * @remarks
- * Executes: tfcmt -var "target:<projectName>" plan -- terraform plan [args]
- * - Uses tfcmt's target variable for monorepo support to prefix PR labels and comment titles
- * - Terraform plan returns exit code 0 for no changes, 2 for changes detected, 1 for errors
- * - Terraform apply returns exit code 0 for success, 1 for errors
- * - tfcmt automatically posts output as PR comment
- * - For plan commands, saves plan file to <workingDir>/tfplan-<projectName>
- * - For apply commands, uses provided planFilePath if available
+ * There is no saved plan to review, so the destroy is planned and applied in one
+ * step. It is never retried, as a failed destroy may already have removed resources.
  */
-export async function executeTerraform(
-  tfcmtPath: string,
-  command: TerraformCommand,
+export async function executeTerraformDestroy(
   workingDir: string,
   projectName: string,
-  additionalArgs: string[] = [],
-  planFilePath?: string
+  args: string[] = [],
+  executionOptions: TerraformExecutionOptions = {}
 ): Promise<TerraformResult> {
-  const argsStr = additionalArgs.length > 0 ? ` ${additionalArgs.join(' ')}` : '';
-  core.info(`Executing terraform ${command}${argsStr} in ${workingDir}`);
+  const argsStr = describeArgs(args);
+  core.startGroup(`Executing terraform destroy${argsStr} for project: ${projectName}`);
 
-  // Build tfcmt arguments: tfcmt [flags] -var "target:<project>" plan|apply -- terraform [command] [args]
-  const tfcmtArgs: string[] = [];
+  try {
+    const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+    await runInit(workingDir, terraformBinary, executionOptions);
 
-  // Add target variable for monorepo support
-  // This will prefix PR labels and comment titles with the project name
-  tfcmtArgs.push('-var');
-  tfcmtArgs.push(`target:${projectName}`);
+    const [binary, ...destroyArgs] = buildCommandLine(
+      'destroy',
+      workingDir,
+      terraformBinary,
+      executionOptions
+    );
+    destroyArgs.push(
+      '-auto-approve',
+      ...buildStateFlags(executionOptions, false),
+      ...buildVarFlags(executionOptions, workingDir, false),
+      ...args,
+      '-no-color',
+      '-input=false'
+    );
 
-  // Add command
-  tfcmtArgs.push(command);
+    const { exitCode, stdout, stderr } = await execCaptured(
+      binary,
+      destroyArgs,
+      workingDir,
+      false,
+      executionOptions.env,
+      'destroy',
+      executionOptions.applyTimeout
+    );
 
-  // Add separator and terraform command
-  tfcmtArgs.push('--');
-  tfcmtArgs.push('terraform');
-  tfcmtArgs.push(command);
+    if (exitCode !== 0) {
+      throw new TerraformCommandError(
+        `Terraform destroy failed with exit code ${exitCode}:\n${stderr}`,
+        'destroy',
+        stderr || stdout,
+        false
+      );
+    }
 
-  // Generate plan file path for plan command, or use provided path for apply
-  let resultPlanFilePath: string | undefined;
+    return { exitCode, hasChanges: false, stdout, stderr };
+  } finally {
+    core.endGroup();
+  }
+}
 
-  if (command === 'plan') {
-    // Save plan to a file: tfplan-<projectName>
-    resultPlanFilePath = path.join(workingDir, `tfplan-${projectName}`);
-    tfcmtArgs.push(`-out=${resultPlanFilePath}`);
-    core.info(`Plan will be saved to: ${resultPlanFilePath}`);
-  } else if (command === 'apply' && planFilePath) {
-    // Use existing plan file
-    tfcmtArgs.push(planFilePath);
-    core.info(`Applying existing plan from: ${planFilePath}`);
-  } else if (command === 'apply') {
-    // Apply without plan file (legacy behavior)
-    tfcmtArgs.push('-auto-approve');
+/**
+ * Renders a saved plan with `terraform show` for a project
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param projectName - Name of the project
+ * @param planFilePath - Path to the saved plan file
+ * @param args - Additional flags (only -json is accepted from comments)
+ * @param executionOptions - Per-project execution options
+ * @returns Terraform execution result with the rendered plan as stdout
+ * @throws TerraformCommandError if init or show fails
+ *
+ * @remarks
+ * Rendering a plan needs the providers it was made with, so the project is
+ * initialized first. Nothing is refreshed or planned again.
+ */
+export async function executeTerraformShow(
+  workingDir: string,
+  projectName: string,
+  planFilePath: string,
+  args: string[] = [],
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<TerraformResult> {
+  const argsStr = describeArgs(args);
+  core.startGroup(`Executing terraform show${argsStr} for project: ${projectName}`);
+
+  try {
+    const options = { ...executionOptions, terragruntRunAll: false };
+    const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+    await runInit(workingDir, terraformBinary, options);
+
+    const [binary, ...showArgs] = buildCommandLine('show', workingDir, terraformBinary, options);
+    showArgs.push(...args, '-no-color', planFilePath);
+
+    const { exitCode, stdout, stderr, retries } = await execRetrying(
+      'terraform show',
+      options.retry,
+      binary,
+      showArgs,
+      workingDir,
+      false,
+      options.env
+    );
+
+    if (exitCode !== 0) {
+      throw new TerraformCommandError(
+        `Terraform show failed with ${describeFailure(exitCode, retries)}:\n${stderr}`,
+        'show',
+        stderr || stdout,
+        false
+      );
+    }
+
+    return withRetries({ exitCode, hasChanges: false, stdout, stderr }, retries);
+  } finally {
+    core.endGroup();
+  }
+}
+
+/**
+ * Renders a saved plan as JSON with `terraform show -json`, without logging it
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param planFilePath - Path to the saved plan
+ * @param executionOptions - Per-project execution options
+ * @returns Plan JSON
+ * @throws TerraformCommandError if init or show fails
+ *
+ * @remarks
+ * Reading a saved plan needs the providers, so the directory is initialized first.
+ */
+export async function executeTerraformShowJson(
+  workingDir: string,
+  planFilePath: string,
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<string> {
+  const options = { ...executionOptions, terragruntRunAll: false };
+  const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+  await runInit(workingDir, terraformBinary, options);
+
+  const [binary, ...args] = buildCommandLine('show', workingDir, terraformBinary, options);
+  args.push('-json', '-no-color', planFilePath);
+
+  const { exitCode, stdout, stderr, retries } = await execRetrying(
+    'terraform show',
+    options.retry,
+    binary,
+    args,
+    workingDir,
+    true,
+    options.env
+  );
+  if (exitCode !== 0) {
+    throw new TerraformCommandError(
+      `Terraform show failed with ${describeFailure(exitCode, retries)}:\n${stderr}`,
+      'show',
+      stderr || stdout,
+      false
+    );
   }
 
-  tfcmtArgs.push(...additionalArgs);
-  tfcmtArgs.push('-no-color');
-  tfcmtArgs.push('-input=false');
+  return stdout;
+}
 
-  // Capture stdout and stderr
+/**
+ * Extracts the state lock from the error output of a failed command
+ *
+ * @param output - Captured error output
+ * @returns Lock details, or null if the output does not mention a state lock with an ID
+ *
+ * @example
+ * parseStateLock('Error: Error acquiring the state lock\n\nLock Info:\n  ID:        9db590f1\n  Who:       runner@fv-az1')
+ * // => { id: '9db590f1', who: 'runner@fv-az1', operation: undefined, releaseFailed: false }
+ */
+export function parseStateLock(output: string): StateLockInfo | null {
+  if (!/state lock/i.test(output)) {
+    return null;
+  }
+
+  // Lock Info fields, possibly inside the │ border of a diagnostic
+  const field = (name: string) =>
+    output.match(new RegExp(`^[\\s│]*${name}:[ \\t]+(.+?)\\s*$`, 'm'))?.[1];
+
+  // Backends that fail to release a lock only mention its ID in the error message
+  const id = field('ID') ?? output.match(/lock ID "([^"]+)"/)?.[1];
+  if (!id) {
+    return null;
+  }
+
+  return {
+    id,
+    who: field('Who'),
+    operation: field('Operation'),
+    releaseFailed: /Error releasing the state lock/i.test(output),
+  };
+}
+
+/**
+ * Whether a state lock was left behind by terraform running on this runner
+ *
+ * @param lock - Parsed lock details
+ * @param runner - This runner as user@host, the way terraform records lock holders
+ *
+ * @remarks
+ * A lock that could not be acquired normally belongs to another run and must
+ * not be released. It is only treated as dangling when terraform reports
+ * failing to release its own lock, or when the lock holder is this runner
+ * (jobs do not share runners, so an earlier process of this job was killed).
+ */
+export function isLockHeldByThisRunner(
+  lock: StateLockInfo,
+  runner = `${os.userInfo().username}@${os.hostname()}`
+): boolean {
+  return lock.releaseFailed || lock.who === runner;
+}
+
+/**
+ * Releases a state lock with `terraform force-unlock -force`
+ *
+ * @param workingDir - Directory containing Terraform files (already initialized)
+ * @param lockId - ID of the lock to release
+ * @param executionOptions - Per-project execution options
+ * @throws TerraformCommandError if force-unlock fails
+ */
+export async function executeTerraformForceUnlock(
+  workingDir: string,
+  lockId: string,
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<void> {
+  const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+  const [binary, ...args] = buildCommandLine('force-unlock', workingDir, terraformBinary, {
+    ...executionOptions,
+    terragruntRunAll: false,
+  });
+  args.push('-force', '-no-color', lockId);
+
+  const { exitCode, stdout, stderr } = await execCaptured(
+    binary,
+    args,
+    workingDir,
+    false,
+    executionOptions.env
+  );
+  if (exitCode !== 0) {
+    throw new TerraformCommandError(
+      `Terraform force-unlock failed with exit code ${exitCode}:\n${stderr}`,
+      'force-unlock',
+      stderr || stdout,
+      false
+    );
+  }
+}
+
+/**
+ * Reads the root module outputs of a project with `terraform output -json`
+ *
+ * @param workingDir - Directory containing Terraform files (already initialized)
+ * @param executionOptions - Per-project execution options
+ * @returns Outputs by name
+ * @throws TerraformCommandError if the command fails, or Error if its output is not JSON
+ */
+export async function executeTerraformOutput(
+  workingDir: string,
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<Record<string, TerraformOutput>> {
+  const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+  const [binary, ...args] = buildCommandLine('output', workingDir, terraformBinary, {
+    ...executionOptions,
+    terragruntRunAll: false,
+  });
+  args.push('-json', '-no-color');
+
+  const { exitCode, stdout, stderr, retries } = await execRetrying(
+    'terraform output',
+    executionOptions.retry,
+    binary,
+    args,
+    workingDir,
+    true,
+    executionOptions.env
+  );
+  if (exitCode !== 0) {
+    throw new TerraformCommandError(
+      `Terraform output failed with ${describeFailure(exitCode, retries)}:\n${stderr}`,
+      'output',
+      stderr || stdout,
+      false
+    );
+  }
+
+  return parseTerraformOutputs(stdout);
+}
+
+/**
+ * Parses `terraform output -json`
+ *
+ * @param json - Command output
+ * @returns Outputs by name
+ * @throws Error if the output is not a JSON object
+ *
+ * @example
+ * parseTerraformOutputs('{"lb_dns":{"sensitive":false,"type":"string","value":"lb.example.com"}}')
+ * // => { lb_dns: { sensitive: false, value: 'lb.example.com' } }
+ */
+export function parseTerraformOutputs(json: string): Record<string, TerraformOutput> {
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(json);
+  } catch (error) {
+    throw new Error(
+      `Could not parse terraform output: ${error instanceof Error ? error.message : String(error)}`
+    );
+  }
+  if (!parsed || typeof parsed !== 'object' || Array.isArray(parsed)) {
+    throw new Error('Could not parse terraform output: expected a JSON object');
+  }
+
+  const outputs: Record<string, TerraformOutput> = {};
+  for (const [name, output] of Object.entries(parsed as Record<string, unknown>)) {
+    const o = (output ?? {}) as Record<string, unknown>;
+    // Anything not explicitly marked non-sensitive is treated as sensitive
+    const sensitive = o.sensitive !== false;
+    outputs[name] = { sensitive, value: sensitive ? undefined : o.value };
+  }
+  return outputs;
+}
+
+/**
+ * Runs terraform init before a command that is not wrapped by tfcmt
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param terraformBinary - Resolved terraform binary
+ * @param executionOptions - Per-project execution options
+ * @throws TerraformCommandError if init fails
+ */
+async function runInit(
+  workingDir: string,
+  terraformBinary: string,
+  executionOptions: TerraformExecutionOptions
+): Promise<void> {
+  const [binary, ...args] = buildCommandLine('init', workingDir, terraformBinary, executionOptions);
+  args.push(...buildInitArgs(executionOptions, workingDir));
+
+  const { exitCode, stdout, stderr, retries } = await withPluginCacheLock(() =>
+    execRetrying(
+      'terraform init',
+      executionOptions.retry,
+      binary,
+      args,
+      workingDir,
+      false,
+      executionOptions.env
+    )
+  );
+  if (exitCode !== 0) {
+    throw new TerraformCommandError(
+      `Terraform init failed with ${describeFailure(exitCode, retries)}:\n${stderr}`,
+      'init',
+      stderr || stdout,
+      false
+    );
+  }
+
+  await selectWorkspace(workingDir, terraformBinary, executionOptions);
+}
+
+/**
+ * Selects the project's terraform workspace, creating it if it does not exist yet
+ *
+ * @param workingDir - Directory containing Terraform files
+ * @param terraformBinary - Resolved terraform binary
+ * @param executionOptions - Per-project execution options (nothing is run without a workspace)
+ * @throws TerraformCommandError if the workspace can be neither selected nor created
+ */
+async function selectWorkspace(
+  workingDir: string,
+  terraformBinary: string,
+  executionOptions: TerraformExecutionOptions
+): Promise<void> {
+  const { workspace } = executionOptions;
+  if (!workspace) {
+    return;
+  }
+
+  const [binary, ...args] = buildCommandLine(
+    'workspace',
+    workingDir,
+    terraformBinary,
+    executionOptions
+  );
+  const { env } = executionOptions;
+  const selected = await execCaptured(
+    binary,
+    [...args, 'select', workspace],
+    workingDir,
+    false,
+    env
+  );
+  if (selected.exitCode === 0) {
+    return;
+  }
+
+  const created = await execCaptured(binary, [...args, 'new', workspace], workingDir, false, env);
+  if (created.exitCode !== 0) {
+    throw new TerraformCommandError(
+      `Terraform workspace ${workspace} could not be selected or created:\n${created.stderr}`,
+      'workspace',
+      created.stderr || created.stdout,
+      false
+    );
+  }
+  core.info(`Created terraform workspace ${workspace}`);
+}
+
+/**
+ * Runs a command in a directory and captures its output
+ *
+ * @param binary - Command to run
+ * @param args - Command arguments
+ * @param workingDir - Working directory
+ * @param silent - Keep the output out of the job log
+ * @param env - Variables added to the environment of the runner
+ * @param subcommand - Terraform subcommand being run, named when it times out
+ * @param timeout - Deadline of the command
+ * @returns Exit code and captured stdout/stderr (non-zero exit codes do not throw)
+ * @throws TerraformCommandError if the command times out
+ */
+async function execCaptured(
+  binary: string,
+  args: string[],
+  workingDir: string,
+  silent = false,
+  env?: Record<string, string>,
+  subcommand = binary,
+  timeout?: CommandTimeout
+): Promise<{ exitCode: number; stdout: string; stderr: string }> {
   let stdout = '';
   let stderr = '';
 
-  const options: exec.ExecOptions = {
+  const exitCode = await runCommandWithTimeout(subcommand, timeout, binary, args, {
     cwd: workingDir,
     ignoreReturnCode: true,
+    silent,
+    env: withProcessEnv(env),
     listeners: {
       stdout: (data: Buffer) => {
         stdout += data.toString();
@@ -90,90 +2098,207 @@ export async function executeTerraform(
         stderr += data.toString();
       },
     },
-  };
+  });
 
-  let exitCode = 0;
-  try {
-    exitCode = await exec.exec('terraform init', [], options);
-    exitCode = await exec.exec(tfcmtPath, tfcmtArgs, options);
-  } catch (error) {
-    throw new Error(
-      `Failed to execute tfcmt/terraform: ${error instanceof Error ? error.message : String(error)}`
+  return { exitCode, stdout, stderr };
+}
+
+/**
+ * Adds variables to the environment of the runner
+ *
+ * @returns The combined environment, or undefined to inherit it unchanged
+ */
+function withProcessEnv(env?: Record<string, string>): Record<string, string> | undefined {
+  return env && { ...(process.env as Record<string, string>), ...env };
+}
+
+/**
+ * Runs a command like execCaptured, retrying transient failures
+ *
+ * @param label - Command shown in the log (e.g., terraform init)
+ * @param retry - Retry policy; without one the command runs once
+ * @param binary - Command to run
+ * @param args - Command arguments
+ * @param workingDir - Working directory
+ * @param silent - Keep the output out of the job log
+ * @param env - Variables added to the environment of the runner
+ * @returns Exit code and captured output of the last attempt, and the number of retries
+ */
+async function execRetrying(
+  label: string,
+  retry: RetryPolicy | undefined,
+  binary: string,
+  args: string[],
+  workingDir: string,
+  silent = false,
+  env?: Record<string, string>
+): Promise<{ exitCode: number; stdout: string; stderr: string; retries: number }> {
+  const { result, retries } = await retryTransientErrors(
+    label,
+    retry,
+    () => execCaptured(binary, args, workingDir, silent, env),
+    (r) => (r.exitCode !== 0 ? r.stderr || r.stdout : null)
+  );
+  return { ...result, retries };
+}
+
+/**
+ * Reruns a command while it fails with an error matching the retry policy
+ *
+ * @param label - Command shown in the log (e.g., terraform plan)
+ * @param retry - Retry policy; without one the command runs once
+ * @param attempt - Runs the command once
+ * @param failureOutput - Error output of a failed attempt, or null if the attempt succeeded
+ * @returns Result of the last attempt and the number of retries
+ *
+ * @remarks
+ * Only failures whose output matches one of the policy's patterns are retried,
+ * so a real error such as an invalid configuration fails on the first attempt.
+ * The delay doubles with every retry.
+ */
+export async function retryTransientErrors<T>(
+  label: string,
+  retry: RetryPolicy | undefined,
+  attempt: () => Promise<T>,
+  failureOutput: (result: T) => string | null
+): Promise<{ result: T; retries: number }> {
+  for (let retries = 0; ; retries++) {
+    const result = await attempt();
+    const output = failureOutput(result);
+    if (output === null || !retry || retries >= retry.maxRetries) {
+      return { result, retries };
+    }
+
+    const transientError = findTransientError(output, retry.patterns);
+    if (!transientError) {
+      return { result, retries };
+    }
+
+    const delayMs = retry.backoffMs * 2 ** retries;
+    core.warning(
+      `${label} failed with a transient error, retry ${retries + 1} of ${retry.maxRetries} in ${delayMs / 1000}s: ${transientError}`
     );
+    await sleep(delayMs);
   }
+}
 
-  // For plan command, exit code 2 means changes detected
-  const hasChanges = command === 'plan' && exitCode === 2;
-
-  // Exit codes: 0 = success/no changes, 1 = error, 2 = changes (plan only)
-  if (exitCode === 1) {
-    throw new Error(`Terraform ${command} failed with exit code 1:\n${stderr}`);
+/**
+ * Finds the first line of error output that matches a transient error pattern
+ *
+ * @param output - Captured error output
+ * @param patterns - Transient error patterns
+ * @returns The matching line, trimmed, or null if the error is not transient
+ *
+ * @example
+ * findTransientError('Error: RequestError: send request failed', [/RequestError/])
+ * // => 'Error: RequestError: send request failed'
+ */
+export function findTransientError(output: string, patterns: RegExp[]): string | null {
+  const lines = output.split('\n');
+  for (const pattern of patterns) {
+    const line = lines.find((l) => pattern.test(l));
+    if (line !== undefined) {
+      return line.replace(/^[\s│]+/, '').trim();
+    }
   }
+  return null;
+}
 
-  core.info(`Terraform ${command} completed with exit code ${exitCode}`);
+/**
+ * Records the retries a successful command took (left out when it took none)
+ */
+function withRetries(result: TerraformResult, retries: number): TerraformResult {
+  return retries > 0 ? { ...result, retries } : result;
+}
 
-  return {
-    exitCode,
-    hasChanges,
-    stdout,
-    stderr,
-    planFilePath: resultPlanFilePath,
-  };
+/**
+ * Describes how a command failed, e.g. "exit code 1 after 2 retries"
+ */
+function describeFailure(exitCode: number, retries: number): string {
+  if (retries === 0) {
+    return `exit code ${exitCode}`;
+  }
+  return `exit code ${exitCode} after ${retries} ${retries === 1 ? 'retry' : 'retries'}`;
 }
 
 /**
- * Executes Terraform command with tfcmt integration
- *
- * @param tfcmtPath - Path to tfcmt binary
- * @param command - Terraform command to execute
- * @param projectName - Name of the project being executed
- * @param workingDir - Directory containing Terraform files
- * @param additionalArgs - Additional terraform arguments
- * @param planFilePath - Path to existing plan file (for apply command)
- * @returns Terraform execution result
+ * Waits for the given number of milliseconds
+ */
+function sleep(ms: number): Promise<void> {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
+
+/**
+ * Collects source-located diagnostics for a project with `terraform validate -json`
  *
- * @remarks
- * Executes terraform wrapped with tfcmt for automatic PR comment posting
+ * @param workingDir - Directory containing Terraform files (already initialized)
+ * @param executionOptions - Per-project execution options
+ * @returns Diagnostics reported by terraform (empty if validation passes or output is unusable)
  */
-export async function executeTerraformWithTfcmt(
-  tfcmtPath: string,
-  command: TerraformCommand,
-  projectName: string,
+export async function collectDiagnostics(
   workingDir: string,
-  additionalArgs: string[] = [],
-  planFilePath?: string
-): Promise<TerraformResult> {
-  const argsStr = additionalArgs.length > 0 ? ` ${additionalArgs.join(' ')}` : '';
-  core.startGroup(`Executing terraform ${command}${argsStr} for project: ${projectName}`);
+  executionOptions: TerraformExecutionOptions = {}
+): Promise<TerraformDiagnostic[]> {
+  const terraformBinary = await resolveTerraformBinary(workingDir, executionOptions);
+  const [binary, ...args] = buildCommandLine(
+    'validate',
+    workingDir,
+    terraformBinary,
+    executionOptions
+  );
+
+  let stdout = '';
+  await runCommand(binary, [...args, '-json', '-no-color'], {
+    cwd: workingDir,
+    ignoreReturnCode: true,
+    silent: true,
+    env: withProcessEnv(executionOptions.env),
+    listeners: {
+      stdout: (data: Buffer) => {
+        stdout += data.toString();
+      },
+    },
+  });
+
+  return parseDiagnostics(stdout);
+}
+
+/**
+ * Validates that Terraform (or OpenTofu) is installed and available
+ *
+ * @param binary - CLI to check (default: terraform)
+ * @throws Error if the CLI is not found or version check fails
+ */
+export async function validateTerraformInstalled(
+  binary: TerraformBinary = 'terraform'
+): Promise<void> {
+  const name = binary === 'tofu' ? 'OpenTofu' : 'Terraform';
+  core.info(`Validating ${name} installation...`);
 
   try {
-    return await executeTerraform(
-      tfcmtPath,
-      command,
-      workingDir,
-      projectName,
-      additionalArgs,
-      planFilePath
+    await runCommand(binary, ['version']);
+  } catch (_error) {
+    throw new Error(
+      `${name} is not installed or not available in PATH. ` +
+        `Please ensure ${name} is installed before running this action.`
     );
-  } finally {
-    core.endGroup();
   }
 }
 
 /**
- * Validates that Terraform is installed and available
+ * Validates that Terragrunt is installed and available in PATH
  *
- * @throws Error if Terraform is not found or version check fails
+ * @throws Error if terragrunt is not found or version check fails
  */
-export async function validateTerraformInstalled(): Promise<void> {
-  core.info('Validating Terraform installation...');
+export async function validateTerragruntInstalled(): Promise<void> {
+  core.info('Validating Terragrunt installation...');
 
   try {
-    await exec.exec('terraform', ['version']);
+    await runCommand('terragrunt', ['--version']);
   } catch (_error) {
     throw new Error(
-      'Terraform is not installed or not available in PATH. ' +
-        'Please ensure Terraform is installed before running this action.'
+      'Terragrunt is not installed or not available in PATH. ' +
+        'Set terragrunt_version or install Terragrunt before running this action.'
     );
   }
 }
@@ -3,9 +3,17 @@
  */
 
 import * as os from 'node:os';
+import * as path from 'node:path';
 import * as core from '@actions/core';
 import * as tc from '@actions/tool-cache';
-import { setupTfcmt } from './tfcmt';
+import * as yaml from 'js-yaml';
+import {
+  buildTfcmtConfig,
+  DEFAULT_APPLY_TEMPLATE,
+  getEnterpriseSettings,
+  setupTfcmt,
+  writeTfcmtConfig,
+} from './tfcmt';
 
 // Mock fs module
 jest.mock('node:fs', () => {
@@ -216,4 +224,86 @@ describe('tfcmt', () => {
       expect(mockTc.extractZip).not.toHaveBeenCalled();
     });
   });
+
+  describe('buildTfcmtConfig', () => {
+    it('should wrap the plan and apply bodies in the header and footer', () => {
+      const templates = {
+        header: '## Acme Infra: {{.Vars.target}}',
+        footer: '[Run]({{.Link}})',
+        plan: '{{len .CreatedResources}} to add',
+      };
+
+      const config = yaml.load(buildTfcmtConfig(templates, null) ?? '');
+
+      expect(config).toEqual({
+        terraform: {
+          plan: {
+            template: '## Acme Infra: {{.Vars.target}}\n\n{{len .CreatedResources}} to add\n\n[Run]({{.Link}})',
+          },
+          apply: {
+            template: `## Acme Infra: {{.Vars.target}}\n\n${DEFAULT_APPLY_TEMPLATE}\n\n[Run]({{.Link}})`,
+          },
+        },
+      });
+    });
+
+    it('should only write the server settings without templates', () => {
+      const enterprise = getEnterpriseSettings({ GITHUB_SERVER_URL: 'https://ghe.example.com' });
+
+      expect(yaml.load(buildTfcmtConfig(undefined, enterprise) ?? '')).toEqual(enterprise);
+      expect(buildTfcmtConfig(undefined, null)).toBeNull();
+    });
+  });
+
+  describe('getEnterpriseSettings', () => {
+    it('should point tfcmt at a GitHub Enterprise Server', () => {
+      expect(getEnterpriseSettings({ GITHUB_SERVER_URL: 'https://ghe.example.com/' })).toEqual({
+        ghe_base_url: 'https://ghe.example.com/api/v3',
+        ghe_graphql_endpoint: 'https://ghe.example.com/api/graphql',
+      });
+      expect(
+        getEnterpriseSettings({
+          GITHUB_SERVER_URL: 'https://acme.ghe.com',
+          GITHUB_API_URL: 'https://api.acme.ghe.com',
+          GITHUB_GRAPHQL_URL: 'https://api.acme.ghe.com/graphql',
+        })
+      ).toEqual({
+        ghe_base_url: 'https://api.acme.ghe.com',
+        ghe_graphql_endpoint: 'https://api.acme.ghe.com/graphql',
+      });
+    });
+
+    it('should leave tfcmt alone on github.com', () => {
+      expect(getEnterpriseSettings({ GITHUB_SERVER_URL: 'https://github.com' })).toBeNull();
+      expect(getEnterpriseSettings({})).toBeNull();
+    });
+  });
+
+  describe('writeTfcmtConfig', () => {
+    it('should write the configuration to the runner temporary directory', () => {
+      const tmpDir = fs.mkdtempSync(path.join(jest.requireActual('node:os').tmpdir(), 'tfcmt-'));
+      process.env.RUNNER_TEMP = tmpDir;
+      try {
+        const configPath = writeTfcmtConfig({ footer: 'Owned by #infra' });
+
+        expect(configPath).toBe(path.join(tmpDir, 'tfcmt-config.yaml'));
+        expect(fs.readFileSync(configPath ?? '', 'utf8')).toContain('Owned by #infra');
+      } finally {
+        delete process.env.RUNNER_TEMP;
+        fs.rmSync(tmpDir, { recursive: true, force: true });
+      }
+    });
+
+    it('should write nothing when tfcmt needs no configuration', () => {
+      const serverUrl = process.env.GITHUB_SERVER_URL;
+      delete process.env.GITHUB_SERVER_URL;
+      try {
+        expect(writeTfcmtConfig(undefined)).toBeUndefined();
+      } finally {
+        if (serverUrl !== undefined) {
+          process.env.GITHUB_SERVER_URL = serverUrl;
+        }
+      }
+    });
+  });
 });
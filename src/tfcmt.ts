@@ -1,5 +1,5 @@
 /**
- * tfcmt CLI download and setup logic
+ * tfcmt CLI download and setup logic, and its comment templates
  */
 
 import * as fs from 'node:fs';
@@ -7,6 +7,42 @@ import * as os from 'node:os';
 import * as path from 'node:path';
 import * as core from '@actions/core';
 import * as tc from '@actions/tool-cache';
+import * as yaml from 'js-yaml';
+import type { CommentTemplatesConfig } from './types';
+
+/**
+ * Plan comment body used when only a header or footer is configured (tfcmt's own layout)
+ */
+export const DEFAULT_PLAN_TEMPLATE = `{{template "plan_title" .}}
+
+{{if .Link}}[CI link]({{.Link}}){{end}}
+
+{{template "deletion_warning" .}}
+{{template "result" .}}
+{{template "updated_resources" .}}
+<details><summary>Change Result (Click me)</summary>
+
+{{wrapCode .CombinedOutput}}
+
+</details>
+{{template "error_messages" .}}`;
+
+/**
+ * Apply comment body used when only a header or footer is configured (tfcmt's own layout)
+ */
+export const DEFAULT_APPLY_TEMPLATE = `{{template "apply_title" .}}
+
+{{if .Link}}[CI link]({{.Link}}){{end}}
+
+{{if ne .ExitCode 0}}{{template "guide_apply_failure" .}}{{end}}
+
+{{template "result" .}}
+
+<details><summary>Details (Click me)</summary>
+
+{{wrapCode .CombinedOutput}}
+
+</details>`;
 
 /**
  * Maps Node.js platform to tfcmt platform naming
@@ -120,3 +156,79 @@ export async function setupTfcmt(version = 'latest'): Promise<string> {
 
   return tfcmtPath;
 }
+
+/**
+ * GitHub Enterprise Server settings of tfcmt, from the variables Actions sets on the runner
+ *
+ * @param env - Environment of the action (default: process.env)
+ * @returns tfcmt's ghe_base_url and ghe_graphql_endpoint, or null on github.com
+ *
+ * @example
+ * getEnterpriseSettings({ GITHUB_SERVER_URL: 'https://ghe.example.com' })
+ * // => {
+ * //   ghe_base_url: 'https://ghe.example.com/api/v3',
+ * //   ghe_graphql_endpoint: 'https://ghe.example.com/api/graphql'
+ * // }
+ */
+export function getEnterpriseSettings(
+  env: NodeJS.ProcessEnv = process.env
+): Record<string, string> | null {
+  const serverUrl = env.GITHUB_SERVER_URL?.replace(/\/+$/, '');
+  if (!serverUrl || serverUrl === 'https://github.com') {
+    return null;
+  }
+  return {
+    ghe_base_url: env.GITHUB_API_URL || `${serverUrl}/api/v3`,
+    ghe_graphql_endpoint: env.GITHUB_GRAPHQL_URL || `${serverUrl}/api/graphql`,
+  };
+}
+
+/**
+ * Builds a tfcmt configuration file
+ *
+ * @param templates - Comment templates from the configuration
+ * @param enterprise - GitHub Enterprise Server settings (default: from the environment)
+ * @returns YAML for tfcmt's -config flag, or null when tfcmt's defaults apply
+ *
+ * @remarks
+ * The header and footer wrap the configured body of each command, or the default
+ * layout when the body is not configured.
+ */
+export function buildTfcmtConfig(
+  templates: CommentTemplatesConfig | undefined,
+  enterprise: Record<string, string> | null = getEnterpriseSettings()
+): string | null {
+  if (!templates && !enterprise) {
+    return null;
+  }
+
+  const config: Record<string, unknown> = { ...enterprise };
+  if (templates) {
+    const wrap = (body: string): string =>
+      [templates.header, body, templates.footer].filter((part) => part !== undefined).join('\n\n');
+    config.terraform = {
+      plan: { template: wrap(templates.plan ?? DEFAULT_PLAN_TEMPLATE) },
+      apply: { template: wrap(templates.apply ?? DEFAULT_APPLY_TEMPLATE) },
+    };
+  }
+  return yaml.dump(config, { lineWidth: -1 });
+}
+
+/**
+ * Writes the tfcmt configuration file
+ *
+ * @param templates - Comment templates from the configuration
+ * @returns Path of the file in the runner's temporary directory, or undefined when tfcmt's
+ *   defaults apply
+ */
+export function writeTfcmtConfig(
+  templates: CommentTemplatesConfig | undefined
+): string | undefined {
+  const content = buildTfcmtConfig(templates);
+  if (content === null) {
+    return undefined;
+  }
+  const configPath = path.join(process.env.RUNNER_TEMP || os.tmpdir(), 'tfcmt-config.yaml');
+  fs.writeFileSync(configPath, content);
+  return configPath;
+}
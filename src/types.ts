@@ -8,9 +8,41 @@
 export type TerraformCommand = 'plan' | 'apply';
 
 /**
- * PR requirement types
+ * CLI that runs the commands: HashiCorp Terraform or OpenTofu
  */
-export type Requirement = 'mergeable' | 'approved';
+export type TerraformBinary = 'terraform' | 'tofu';
+
+/**
+ * Command that can be requested in a PR comment
+ */
+export type CommentCommand =
+  | TerraformCommand
+  | 'destroy'
+  | 'init'
+  | 'drift'
+  | 'state'
+  | 'import'
+  | 'show'
+  | 'approve_policies';
+
+/**
+ * Command that can be restricted under authorization (apply_all is `terraform apply --all`)
+ */
+export type AuthorizedCommand = CommentCommand | 'apply_all';
+
+/**
+ * Subcommand of `terraform state` that can be requested in a PR comment
+ */
+export type StateSubcommand = 'list' | 'show' | 'rm' | 'mv';
+
+/**
+ * PR requirement expression
+ *
+ * @remarks
+ * A keyword (`mergeable`, `approved`, `codeowner_approved`, `diverged`, `label:<name>`), optionally
+ * negated with `!` and combined with `&` (AND) or `|` (OR), e.g. `approved|label:fast-track`
+ */
+export type Requirement = string;
 
 /**
  * Autoplan configuration for a project
@@ -30,34 +62,552 @@ export interface ProjectConfig {
   name: string;
   /** Directory containing Terraform files */
   dir: string;
+  /** Whether the project runs at all (default: true); false parks it while keeping its config */
+  enabled?: boolean;
+  /** Tags for selecting a group of projects in a comment with -tag=<name> */
+  tags?: string[];
   /** Autoplan configuration */
   autoplan?: AutoplanConfig;
+  /** Variable files passed with -var-file, relative to dir */
+  terraform_var_files?: string[];
+  /** Input variables passed with -var (after the variable files) */
+  terraform_vars?: Record<string, string>;
+  /** Environment variables of terraform, which may reference runner variables as ${{ NAME }} */
+  env?: Record<string, string>;
   /** Requirements for plan execution */
   plan_requirements?: Requirement[];
   /** Requirements for apply execution */
   apply_requirements?: Requirement[];
+  /** Apply the plan saved for a pull request once it is merged (default: false) */
+  apply_on_merge?: boolean;
+  /** Refuse apply without a saved plan of the head commit (default: top-level require_plan) */
+  require_plan?: boolean;
+  /** Projects sharing a lock with the concurrency setting, e.g. for one state (default: own) */
+  concurrency_group?: string;
+  /** Requirements for state rm and state mv (default: apply_requirements) */
+  state_requirements?: Requirement[];
+  /** Requirements for import (default: apply_requirements) */
+  import_requirements?: Requirement[];
+  /** Requirements for the destroy command, which is refused unless they are set */
+  destroy_requirements?: Requirement[];
+  /** Run the project with terragrunt instead of terraform (default: if dir has a terragrunt.hcl) */
+  terragrunt?: boolean;
+  /** Use `terragrunt run-all` to execute the whole dependency tree under dir */
+  terragrunt_run_all?: boolean;
+  /** Allow apply of a run-all project, which applies without a reviewed plan (default: false) */
+  terragrunt_run_all_apply?: boolean;
+  /** Exact terraform version to download and run, e.g. 1.7.0 (default: autodetected) */
+  terraform_version?: string;
+  /** CLI to run, terraform or tofu (default: the top-level binary) */
+  binary?: TerraformBinary;
+  /** Refresh state before plan/apply (default: true) */
+  refresh?: boolean;
+  /** Duration to wait for a state lock, e.g. 5m (terraform -lock-timeout) */
+  lock_timeout?: string;
+  /** Longest a plan may run before it is stopped, e.g. 30m (default: top-level plan_timeout) */
+  plan_timeout?: string;
+  /** Longest an apply may run before it is stopped, e.g. 2h (default: top-level apply_timeout) */
+  apply_timeout?: string;
+  /** Force-unlock a state lock this runner left behind when plan or apply fails (default: false) */
+  auto_unlock_on_failure?: boolean;
+  /** Always pass -upgrade to terraform init */
+  init_upgrade?: boolean;
+  /** Initialize the backend on the init command (default: true); false passes -backend=false */
+  init_backend?: boolean;
+  /** Backend settings passed to terraform init as -backend-config=KEY=VALUE */
+  backend_config?: Record<string, string>;
+  /** Backend config files passed to terraform init as -backend-config, relative to dir */
+  backend_config_files?: string[];
+  /** Flags added to every terraform init of the project, e.g. -lockfile=readonly */
+  init_extra_args?: string[];
+  /** Terraform workspace selected (and created if missing) before each command */
+  workspace?: string;
+  /** Name of a custom workflow (under `workflows`) that runs plan and apply */
+  workflow?: string;
+  /** Group the project runs in; lower groups run first (default: 0) */
+  execution_order_group?: number;
+  /** Projects that must finish before this one when they run in the same command */
+  depends_on?: string[];
+  /** Plan alongside other projects of the group (default: the top-level parallel_plan) */
+  parallel_plan?: boolean;
+  /** Apply alongside other projects of the group (default: the top-level parallel_apply) */
+  parallel_apply?: boolean;
+  /** Skip dependents and later groups when this project fails (default: the top-level setting) */
+  abort_on_execution_order_fail?: boolean;
+  /** Names of the policy sets (under `policies`) every plan is checked against */
+  policy_sets?: string[];
+  /** Security scan run after every plan */
+  security_scan?: SecurityScanConfig;
+  /** Labels the PR must have before apply */
+  required_labels?: string[];
+  /** Labels that block apply while present on the PR */
+  forbidden_labels?: string[];
+  /** Regular expression the PR head branch must fully match for the project to run */
+  branch?: string;
+  /** Regular expression the PR base branch must fully match for the project to run */
+  base_branch?: string;
+}
+
+/**
+ * Shell command step of a custom workflow
+ */
+export interface RunStep {
+  /** Command run with bash in the project directory */
+  run: string;
+  /** Additional environment variables for the command */
+  env?: Record<string, string>;
+}
+
+/**
+ * Step of a custom workflow: `init`, the terraform command itself, or a shell command
+ */
+export type WorkflowStep = 'init' | TerraformCommand | RunStep;
+
+/**
+ * Ordered steps a custom workflow runs for one command
+ */
+export interface WorkflowStage {
+  /** Steps, run in order until one fails */
+  steps: WorkflowStep[];
+}
+
+/**
+ * Custom workflow replacing the built-in init and plan/apply sequence
+ *
+ * @remarks
+ * A command without a stage keeps the built-in sequence
+ */
+export interface WorkflowConfig {
+  /** Steps run for plan */
+  plan?: WorkflowStage;
+  /** Steps run for apply */
+  apply?: WorkflowStage;
+}
+
+/**
+ * Directory of OPA/Rego policies that plans are checked against with conftest
+ */
+export interface PolicySetConfig {
+  /** Name projects reference the set by */
+  name: string;
+  /** Directory of .rego files, relative to the repository root */
+  path: string;
+}
+
+/**
+ * Policy checks of plans
+ */
+export interface PoliciesConfig {
+  /** GitHub logins allowed to approve failed policy checks with `terraform approve_policies` */
+  owners: string[];
+  /** Policy sets projects can reference by name */
+  policy_sets: PolicySetConfig[];
+}
+
+/**
+ * Outcome of checking a plan against its project's policy sets
+ */
+export interface PolicyCheckResult {
+  /** Whether every policy passed */
+  passed: boolean;
+  /** Names of the policy sets the plan was checked against */
+  policySets: string[];
+  /** conftest output */
+  output: string;
+}
+
+/**
+ * Repository permission of a GitHub user, from lowest to highest
+ */
+export type RepositoryPermission = 'read' | 'triage' | 'write' | 'maintain' | 'admin';
+
+/**
+ * Who may run a command from a PR comment
+ */
+export interface CommandAuthorization {
+  /** GitHub logins allowed to run the command */
+  users?: string[];
+  /** Teams allowed to run the command, written as org/team-slug */
+  teams?: string[];
+  /** Lowest repository permission the commenter needs (default: write) */
+  permission?: RepositoryPermission;
+}
+
+/**
+ * Cost estimation of plans with Infracost
+ */
+export interface InfracostConfig {
+  /** Monthly cost increase above which a project's plan fails, in the Infracost currency */
+  max_monthly_increase?: number;
+}
+
+/**
+ * Monthly cost of a plan estimated by Infracost
+ */
+export interface CostEstimate {
+  /** Currency of the amounts (e.g., USD) */
+  currency: string;
+  /** Monthly cost of the current state */
+  pastMonthlyCost: number;
+  /** Monthly cost once the plan is applied */
+  monthlyCost: number;
+  /** Change of the monthly cost (negative for savings) */
+  diffMonthlyCost: number;
+}
+
+/**
+ * Security scanner a project is checked with
+ */
+export type SecurityScanner = 'trivy' | 'tfsec' | 'checkov';
+
+/**
+ * Severity of a security finding, from lowest to highest (UNKNOWN when the scanner gives none)
+ */
+export type SecuritySeverity = 'UNKNOWN' | 'LOW' | 'MEDIUM' | 'HIGH' | 'CRITICAL';
+
+/**
+ * Security scan of a project's code or plan
+ */
+export interface SecurityScanConfig {
+  /** Scanner to run */
+  tool: SecurityScanner;
+  /** What is scanned: the project directory or the JSON of its plan (default: dir) */
+  target?: 'dir' | 'plan';
+  /** Lowest severity that blocks apply (default: findings never block apply) */
+  block_on?: SecuritySeverity;
 }
 
+/**
+ * Problem reported by a security scanner
+ */
+export interface SecurityFinding {
+  /** Rule that failed (e.g., AVD-AWS-0086 or CKV_AWS_18) */
+  id: string;
+  /** Severity of the rule */
+  severity: SecuritySeverity;
+  /** What the rule checks */
+  title: string;
+  /** Where the problem is, e.g. main.tf:12 or a resource address */
+  location?: string;
+}
+
+/**
+ * Outcome of a security scan
+ */
+export interface SecurityScanResult {
+  /** Scanner that ran */
+  tool: SecurityScanner;
+  /** Findings, highest severity first */
+  findings: SecurityFinding[];
+  /** Lowest severity that blocks apply, if any */
+  blockOn?: SecuritySeverity;
+  /** Number of findings that block apply */
+  blocking: number;
+}
+
+/**
+ * Webhook payload format for notifications
+ */
+export type NotificationFormat = 'slack' | 'json';
+
+/**
+ * Out-of-band notification configuration
+ */
+export interface NotificationConfig {
+  /** Webhook URL to POST results to */
+  webhook_url?: string;
+  /** Name of an environment variable holding the webhook URL (for secrets) */
+  webhook_url_env?: string;
+  /** Payload format (default: slack) */
+  format?: NotificationFormat;
+}
+
+/**
+ * How results are reported
+ * - comment: PR comments only
+ * - status: commit statuses only
+ * - both: PR comments and commit statuses
+ */
+export type OutputMode = 'comment' | 'status' | 'both';
+
+/**
+ * API project results are reported to the head commit with
+ * - statuses: commit statuses
+ * - checks: check runs, with the plan in their details and a Re-run button
+ */
+export type StatusApi = 'statuses' | 'checks';
+
+/**
+ * How a plan or apply without resource changes is commented on the PR
+ * - full: the regular tfcmt comment
+ * - concise: a one-line "No changes" comment
+ * - skip: no comment
+ */
+export type NoChangesComment = 'full' | 'concise' | 'skip';
+
+/**
+ * How plan and apply results of several projects are commented on the PR
+ * - per_project: one comment per project
+ * - consolidated: a single comment, updated in place on reruns
+ */
+export type CommentMode = 'per_project' | 'consolidated';
+
+/**
+ * What happens to a project's earlier plan comments when it is planned again
+ * - keep: they stay as they are
+ * - update: the latest one is replaced with the new plan
+ * - hide: they are minimized as outdated and the new plan is posted below
+ */
+export type PreviousPlanComments = 'keep' | 'update' | 'hide';
+
 /**
  * Root configuration file structure
  */
 export interface Config {
   /** List of Terraform projects */
   projects: ProjectConfig[];
+  /** Custom workflows projects can reference by name */
+  workflows?: Record<string, WorkflowConfig>;
+  /** Policy sets plans are checked against, and who may approve failures */
+  policies?: PoliciesConfig;
+  /** Who may run each command from a PR comment (default: anyone who can comment) */
+  authorization?: Partial<Record<AuthorizedCommand, CommandAuthorization>>;
+  /** CLI projects run unless they set their own, terraform or tofu (default: terraform) */
+  binary?: TerraformBinary;
+  /** Exact terragrunt version to download for terragrunt projects (default: the one on PATH) */
+  terragrunt_version?: string;
+  /** Longest a plan may run in projects without their own plan_timeout (default: no limit) */
+  plan_timeout?: string;
+  /** Longest an apply may run in projects without their own apply_timeout (default: no limit) */
+  apply_timeout?: string;
+  /** Refuse apply without a saved plan of the head commit in projects without their own */
+  require_plan?: boolean;
+  /** Environment variables of every project, overridden by the project's own */
+  env?: Record<string, string>;
+  /** Notifications sent after apply */
+  notifications?: NotificationConfig;
+  /** How results are reported (default: both) */
+  output_mode?: OutputMode;
+  /** API statuses are reported with (default: statuses) */
+  status_api?: StatusApi;
+  /** Comment for plans and applies without changes (default: full) */
+  comment_on_no_changes?: NoChangesComment;
+  /** Whether projects share one comment (default: per_project) */
+  comment_mode?: CommentMode;
+  /** Earlier plan comments of a project replanned (default: keep) */
+  previous_plan_comments?: PreviousPlanComments;
+  /** Mark plan comments outdated and delete saved plans on pushes to the PR (default: false) */
+  invalidate_outdated_plans?: boolean;
+  /** tfcmt templates of plan and apply comments (default: tfcmt's own) */
+  comment_templates?: CommentTemplatesConfig;
+  /** Directory every project dir is relative to (default: the workspace root) */
+  base_dir?: string;
+  /** Most projects a command may run without naming them (default: unlimited) */
+  max_projects_per_run?: number;
+  /** Plan the projects of an execution order group concurrently (default: false) */
+  parallel_plan?: boolean;
+  /** Apply the projects of an execution order group concurrently (default: false) */
+  parallel_apply?: boolean;
+  /** Most projects run at the same time with parallel_plan or parallel_apply (default: 4) */
+  parallel_pool_size?: number;
+  /** Skip later execution order groups once a project of a group fails (default: false) */
+  abort_on_execution_order_fail?: boolean;
+  /** Words that start a command in a comment (default: terraform) */
+  command_prefixes?: string[];
+  /** Flags that select projects in a comment, without the =value (default: -project) */
+  project_flags?: string[];
+  /** Allow apply, import and state rm/mv on pull requests from forks (default: false) */
+  allow_fork_apply?: boolean;
+  /** Retry of terraform commands that fail with transient errors (default: no retries) */
+  retry?: RetryConfig;
+  /** Make commands of a project wait for the ones of other workflow runs (default: never) */
+  concurrency?: ConcurrencyConfig;
+  /** Comment the resource changes added or dropped since the previous plan (default: false) */
+  compare_plans?: boolean;
+  /** Show the plan saved for the head commit instead of planning again (default: true) */
+  plan_cache?: boolean;
+  /** Comment a table of the resource changes of every plan (default: false) */
+  plan_summary?: boolean;
+  /** Comment the monthly cost change of every plan, estimated by Infracost (default: never) */
+  infracost?: InfracostConfig;
+  /** Prefix of commit status contexts (default: terraform-action) */
+  status_context_prefix?: string;
+  /** Commit status context template using {prefix}, {command} and {project} */
+  status_context?: string;
+  /** Commit status description template using {description}, {command}, {project} and {state} */
+  status_description?: string;
+  /** Merge the pull request after every project was applied (default: never) */
+  merge_after_apply?: MergeAfterApplyConfig;
+  /** Secrets masked in comments, issues, notifications and logs besides well-known credentials */
+  redaction?: RedactionConfig;
+  /** Log every command line (with -var and -backend-config values masked) before it runs */
+  debug?: boolean;
+  /** Share downloaded providers between the inits of the run (default: true) */
+  plugin_cache?: boolean;
+  /** React to the triggering comment when a command starts, succeeds and fails (default: true) */
+  reactions?: boolean;
+  /** Central repository whose configuration this one overrides, e.g. acme/infra-config@main */
+  config_repo?: string;
+  /** Top-level fields of the central configuration that overrides may not set */
+  enforce?: string[];
+}
+
+/**
+ * Configuration file in a central repository, from config_repo
+ */
+export interface ConfigRepoRef {
+  /** Repository owner */
+  owner: string;
+  /** Repository name */
+  repo: string;
+  /** Path of the configuration file in the repository (default: .terraform-action.yaml) */
+  path: string;
+  /** Branch, tag or commit to read it from (default: the default branch) */
+  ref?: string;
+}
+
+/**
+ * Reaction GitHub can add to a comment
+ */
+export type ReactionContent =
+  | '+1'
+  | '-1'
+  | 'laugh'
+  | 'confused'
+  | 'heart'
+  | 'hooray'
+  | 'rocket'
+  | 'eyes';
+
+/**
+ * How GitHub merges a pull request
+ */
+export type MergeMethod = 'merge' | 'squash' | 'rebase';
+
+/**
+ * Merging of pull requests after a successful apply
+ */
+export interface MergeAfterApplyConfig {
+  /** Merge method (default: merge) */
+  method?: MergeMethod;
+  /** Delete the head branch after merging (default: false) */
+  delete_branch?: boolean;
+}
+
+/**
+ * Go templates rendered by tfcmt for plan and apply comments
+ */
+export interface CommentTemplatesConfig {
+  /** Placed above the body of every plan and apply comment */
+  header?: string;
+  /** Placed below the body of every plan and apply comment */
+  footer?: string;
+  /** Body of plan comments (default: the action's built-in plan template) */
+  plan?: string;
+  /** Body of apply comments (default: the action's built-in apply template) */
+  apply?: string;
+}
+
+/**
+ * Masking of secrets in everything posted to GitHub
+ */
+export interface RedactionConfig {
+  /** Regular expressions whose matches are masked, in addition to well-known credentials */
+  patterns?: string[];
+  /** Read every plan as JSON and mask the values terraform marks sensitive (default: false) */
+  sensitive_values?: boolean;
+}
+
+/**
+ * Retry configuration for transient terraform errors (e.g., provider throttling)
+ */
+export interface RetryConfig {
+  /** Retries after the first failed attempt (default: 2) */
+  max_retries?: number;
+  /** Delay before the first retry, doubled for every further retry (default: 10s) */
+  backoff?: string;
+  /** Regular expressions matched per line of error output (default: common network errors) */
+  patterns?: string[];
+}
+
+/**
+ * Commands that can wait for the lock of their project
+ */
+export type LockedCommand = 'plan' | 'apply' | 'destroy' | 'import' | 'state';
+
+/**
+ * Serialization of the commands of a project across workflow runs
+ */
+export interface ConcurrencyConfig {
+  /** Commands that wait for the lock of their project (default: apply, destroy, import, state) */
+  commands?: LockedCommand[];
+  /** How long a command waits for the lock before it fails (default: 30m) */
+  timeout?: string;
+}
+
+/**
+ * Resolved retry configuration used by the executor
+ */
+export interface RetryPolicy {
+  /** Retries after the first failed attempt */
+  maxRetries: number;
+  /** Delay before the first retry in milliseconds */
+  backoffMs: number;
+  /** Patterns marking a failure as transient */
+  patterns: RegExp[];
 }
 
 /**
  * Parsed PR comment
  */
 export interface ParsedComment {
-  /** Terraform command (plan or apply) */
-  command: TerraformCommand;
+  /** Requested command (plan, apply, destroy, init, drift, state, import or show) */
+  command: CommentCommand;
   /** Target projects (empty array means all projects) */
   projects: string[];
   /** Additional terraform arguments (e.g., -target, -var-file) */
   args: string[];
+  /** Whether every configured project was explicitly selected with --all */
+  all?: boolean;
+  /** Directories from -dir=; every project in or below one of them is targeted */
+  dirs?: string[];
+  /** Tags from -tag=; every project carrying one of them is targeted */
+  tags?: string[];
+  /** Workspaces from -w=; only target projects using one of them run */
+  workspaces?: string[];
+  /** -refresh=<bool> from the comment (overrides project config) */
+  refresh?: boolean;
+  /** -lock-timeout=<duration> from the comment (overrides project config) */
+  lockTimeout?: string;
+  /** Subcommand for the state command */
+  stateSubcommand?: StateSubcommand;
+  /** Resource address for the import command */
+  importAddress?: string;
+  /** Provider-specific resource ID for the import command */
+  importId?: string;
+  /** Whether the plan previews a destroy (`terraform plan -destroy`) */
+  destroy?: boolean;
+  /** Whether the plan runs again even if one was saved for the head commit (--force) */
+  force?: boolean;
+}
+
+/**
+ * Pull request merged by the event that triggered the run
+ */
+export interface MergedPullRequest {
+  /** PR number */
+  number: number;
+  /** Head commit SHA, which the plans of the PR were saved for */
+  headSha: string;
+  /** Branch the PR was merged into */
+  baseRef: string;
 }
 
+/**
+ * Whether GitHub considers a PR mergeable ('unknown' while it is still being computed)
+ */
+export type Mergeability = 'mergeable' | 'not_mergeable' | 'unknown';
+
 /**
  * GitHub Pull Request information
  */
@@ -70,12 +620,39 @@ export interface PullRequestInfo {
   repo: string;
   /** Whether PR is from a fork */
   isFork: boolean;
-  /** Whether PR is mergeable */
+  /** Whether PR is mergeable (false while mergeability is unknown) */
   mergeable: boolean;
+  /** Mergeability including the unknown state */
+  mergeability: Mergeability;
   /** Whether PR is approved */
   approved: boolean;
   /** PR head SHA */
   sha: string;
+  /** Whether the PR branch is behind its base branch */
+  diverged: boolean;
+  /** Names of the labels on the PR */
+  labels: string[];
+  /** Name of the PR head branch */
+  headBranch: string;
+  /** Name of the branch the PR targets */
+  baseBranch: string;
+  /** Logins of reviewers whose latest review is an approval */
+  approvers: string[];
+  /**
+   * Changed paths that have code owners but no approval from one
+   * (undefined until checked for the codeowner_approved requirement)
+   */
+  pathsWithoutCodeownerApproval?: string[];
+  /**
+   * Resources the saved plan of the project being applied would destroy
+   * (undefined until checked for the no_destroys requirement)
+   */
+  plannedDestroys?: string[];
+  /**
+   * Whether the project being applied has a saved plan of the head commit
+   * (undefined until checked for the planned requirement)
+   */
+  savedPlan?: boolean;
 }
 
 /**
@@ -92,6 +669,146 @@ export interface TerraformResult {
   stderr: string;
   /** Path to plan file (for plan command) */
   planFilePath?: string;
+  /** Path to the tfcmt result written instead of a PR comment (with suppressComment) */
+  commentFilePath?: string;
+  /** Root module outputs after a successful apply */
+  outputs?: Record<string, TerraformOutput>;
+  /** Plan of the resource an import brought under management (import only) */
+  importPlan?: TerraformResult;
+  /** Resource changes of a successful plan (only read with compare_plans or plan_summary) */
+  plannedChanges?: PlannedChange[];
+  /** Policy check of a successful plan (only for projects with policy_sets) */
+  policyCheck?: PolicyCheckResult;
+  /** Cost estimate of a successful plan (only with infracost) */
+  costEstimate?: CostEstimate;
+  /** Security scan of a successful plan (only for projects with security_scan) */
+  securityScan?: SecurityScanResult;
+  /** Transient failures retried before the command succeeded (not set when there were none) */
+  retries?: number;
+  /** Whether a plan saved for the same commit was shown instead of planning again */
+  reusedPlan?: boolean;
+}
+
+/**
+ * Resource change in a saved plan, as reported by `terraform show -json`
+ */
+export interface PlannedChange {
+  /** Resource address */
+  address: string;
+  /** Planned actions (e.g., ['create'] or ['delete', 'create'] for a replacement) */
+  actions: string[];
+}
+
+/**
+ * Difference between the resource changes of two plans of the same project
+ */
+export interface PlannedChangesDiff {
+  /** Changes only in the new plan */
+  added: PlannedChange[];
+  /** Changes only in the earlier plan */
+  removed: PlannedChange[];
+  /** Resources in both plans with different actions */
+  changed: (PlannedChange & { previousActions: string[] })[];
+}
+
+/**
+ * Root module output value, as reported by `terraform output -json`
+ */
+export interface TerraformOutput {
+  /** Whether the output is marked sensitive (its value must not be shown) */
+  sensitive: boolean;
+  /** Output value */
+  value: unknown;
+}
+
+/**
+ * Resource change counts reported by terraform
+ */
+export interface ChangeSummary {
+  /** Resources to add (or added) */
+  add: number;
+  /** Resources to change (or changed) */
+  change: number;
+  /** Resources to destroy (or destroyed) */
+  destroy: number;
+}
+
+/**
+ * Diagnostic reported by terraform in JSON output
+ */
+export interface TerraformDiagnostic {
+  /** Diagnostic severity */
+  severity: 'error' | 'warning';
+  /** Short summary */
+  summary: string;
+  /** Detailed explanation (may be empty) */
+  detail: string;
+  /** Emitting module from the JSON UI stream (e.g., terraform.ui) */
+  module?: string;
+  /** Source file relative to the project directory */
+  filename?: string;
+  /** Line in the source file */
+  line?: number;
+}
+
+/**
+ * Per-project options controlling how terraform is invoked
+ */
+export interface TerraformExecutionOptions {
+  /** Invoke terragrunt instead of terraform (default: when the directory has a terragrunt.hcl) */
+  terragrunt?: boolean;
+  /** Use `terragrunt run-all` (requires terragrunt) */
+  terragruntRunAll?: boolean;
+  /** CLI to run (default: terraform) */
+  binary?: TerraformBinary;
+  /** Version to run instead of the one the project directory requests */
+  terraformVersion?: string;
+  /** Refresh state before plan/apply (terraform default: true) */
+  refresh?: boolean;
+  /** Duration to wait for a state lock */
+  lockTimeout?: string;
+  /** Deadline of plan (and of the drift check plan) */
+  planTimeout?: CommandTimeout;
+  /** Deadline of apply and destroy */
+  applyTimeout?: CommandTimeout;
+  /** Variable files passed with -var-file, relative to the working directory */
+  varFiles?: string[];
+  /** Input variables passed with -var */
+  vars?: Record<string, string>;
+  /** Variables added to the environment of every command */
+  env?: Record<string, string>;
+  /** Write the tfcmt result to a file instead of posting a PR comment */
+  suppressComment?: boolean;
+  /** Pass -upgrade to terraform init */
+  initUpgrade?: boolean;
+  /** Pass -backend=false to terraform init when false */
+  initBackend?: boolean;
+  /** Backend settings passed to terraform init as -backend-config=KEY=VALUE */
+  backendConfig?: Record<string, string>;
+  /** Backend config files, relative to the working directory */
+  backendConfigFiles?: string[];
+  /** Terraform workspace to select (or create) after init */
+  workspace?: string;
+  /** Run plan/apply without the init before it (a custom workflow runs its own init step) */
+  skipInit?: boolean;
+  /** Additional terraform init flags (e.g., -reconfigure) */
+  initArgs?: string[];
+  /** terraform init flags from the project configuration, passed after initArgs */
+  initExtraArgs?: string[];
+  /** Retry policy for transient errors (read-only commands, init and plan only) */
+  retry?: RetryPolicy;
+  /** tfcmt configuration file with the comment templates, passed as -config */
+  tfcmtConfigPath?: string;
+}
+
+/**
+ * Deadline of a command, after which it is stopped
+ */
+export interface CommandTimeout {
+  /** Duration as configured, shown when the command is stopped (e.g., 30m) */
+  duration: string;
+  /** Duration in milliseconds */
+  ms: number;
 }
 
 /**
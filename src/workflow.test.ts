@@ -0,0 +1,153 @@
+/**
+ * Unit tests for custom workflows
+ */
+
+import { executeRunStep, executeTerraformInit, TerraformCommandError } from './terraform';
+import { buildWorkflowEnv, getWorkflowSteps, runWorkflow } from './workflow';
+
+// Mock the @actions modules and the executor
+jest.mock('@actions/core');
+jest.mock('./terraform', () => ({
+  ...jest.requireActual('./terraform'),
+  executeRunStep: jest.fn(),
+  executeTerraformInit: jest.fn(),
+}));
+
+describe('workflow', () => {
+  const mockExecuteRunStep = executeRunStep as jest.MockedFunction<typeof executeRunStep>;
+  const mockExecuteTerraformInit = executeTerraformInit as jest.MockedFunction<
+    typeof executeTerraformInit
+  >;
+  const project = { name: 'production', dir: 'envs/production', workflow: 'checked' };
+  const workflows = { checked: { plan: { steps: ['init' as const, 'plan' as const] } } };
+  const succeeded = { exitCode: 0, hasChanges: false, stdout: '', stderr: '' };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    mockExecuteRunStep.mockResolvedValue(succeeded);
+  });
+
+  describe('getWorkflowSteps', () => {
+    it('should return the steps of the project workflow for the command', () => {
+      expect(getWorkflowSteps(project, workflows, 'plan')).toEqual(['init', 'plan']);
+    });
+
+    it('should leave commands without a stage and projects without a workflow built in', () => {
+      expect(getWorkflowSteps(project, workflows, 'apply')).toBeUndefined();
+      expect(getWorkflowSteps({ name: 'app', dir: 'app' }, workflows, 'plan')).toBeUndefined();
+    });
+  });
+
+  describe('buildWorkflowEnv', () => {
+    it('should describe the project and the saved plan', () => {
+      expect(
+        buildWorkflowEnv(
+          { ...project, workspace: 'prod' },
+          '/repo/envs/production',
+          'apply',
+          '/tmp/tfplan'
+        )
+      ).toEqual({
+        PROJECT_NAME: 'production',
+        DIR: '/repo/envs/production',
+        WORKSPACE: 'prod',
+        COMMAND: 'apply',
+        PLANFILE: '/tmp/tfplan',
+      });
+    });
+  });
+
+  describe('runWorkflow', () => {
+    const planResult = {
+      exitCode: 2,
+      hasChanges: true,
+      stdout: '',
+      stderr: '',
+      planFilePath: '/repo/envs/production/tfplan-production',
+    };
+
+    it('should run the steps in order and return the result of the command step', async () => {
+      const order: string[] = [];
+      mockExecuteTerraformInit.mockImplementation(async () => {
+        order.push('init');
+        return succeeded;
+      });
+      mockExecuteRunStep.mockImplementation(async (command) => {
+        order.push(command);
+        return succeeded;
+      });
+      const runCommandStep = jest.fn(async () => {
+        order.push('plan');
+        return planResult;
+      });
+
+      const result = await runWorkflow(
+        ['init', { run: 'make lint' }, 'plan', { run: 'conftest test', env: { STRICT: '1' } }],
+        'plan',
+        '/repo/envs/production',
+        'production',
+        { PROJECT_NAME: 'production' },
+        { workspace: 'prod' },
+        runCommandStep
+      );
+
+      expect(result).toBe(planResult);
+      expect(order).toEqual(['init', 'make lint', 'plan', 'conftest test']);
+      expect(runCommandStep).toHaveBeenCalledWith({ workspace: 'prod', skipInit: true });
+      expect(mockExecuteRunStep).toHaveBeenNthCalledWith(
+        1,
+        'make lint',
+        '/repo/envs/production',
+        { PROJECT_NAME: 'production' },
+        'plan workflow step'
+      );
+      // Steps after the plan see the saved plan
+      expect(mockExecuteRunStep).toHaveBeenNthCalledWith(
+        2,
+        'conftest test',
+        '/repo/envs/production',
+        { PROJECT_NAME: 'production', PLANFILE: planResult.planFilePath, STRICT: '1' },
+        'plan workflow step'
+      );
+    });
+
+    it('should give run steps the project env, overridden by workflow variables', async () => {
+      await runWorkflow(
+        ['plan', { run: 'make lint' }],
+        'plan',
+        '/repo/envs/production',
+        'production',
+        { PROJECT_NAME: 'production' },
+        { env: { AWS_PROFILE: 'prod', PROJECT_NAME: 'other' } },
+        jest.fn(async () => ({ ...planResult, planFilePath: undefined }))
+      );
+
+      expect(mockExecuteRunStep).toHaveBeenCalledWith(
+        'make lint',
+        '/repo/envs/production',
+        { AWS_PROFILE: 'prod', PROJECT_NAME: 'production' },
+        'plan workflow step'
+      );
+    });
+
+    it('should stop at the first failing step', async () => {
+      mockExecuteRunStep.mockRejectedValueOnce(
+        new TerraformCommandError('Workflow step failed', 'plan workflow step', 'boom', false)
+      );
+      const runCommandStep = jest.fn(async () => planResult);
+
+      await expect(
+        runWorkflow(
+          [{ run: 'make lint' }, 'plan'],
+          'plan',
+          '/repo/envs/production',
+          'production',
+          {},
+          {},
+          runCommandStep
+        )
+      ).rejects.toThrow('Workflow step failed');
+      expect(runCommandStep).not.toHaveBeenCalled();
+    });
+  });
+});
@@ -0,0 +1,124 @@
+/**
+ * Custom workflows replacing the built-in init and plan/apply sequence
+ */
+
+import * as core from '@actions/core';
+import { executeRunStep, executeTerraformInit } from './terraform';
+import type {
+  ProjectConfig,
+  TerraformCommand,
+  TerraformExecutionOptions,
+  TerraformResult,
+  WorkflowConfig,
+  WorkflowStep,
+} from './types';
+
+/**
+ * Finds the steps a project's custom workflow runs for a command
+ *
+ * @param project - Project configuration
+ * @param workflows - Configured workflows by name
+ * @param command - Command being run
+ * @returns Steps of the workflow, or undefined if the built-in sequence runs
+ */
+export function getWorkflowSteps(
+  project: ProjectConfig,
+  workflows: Record<string, WorkflowConfig>,
+  command: TerraformCommand
+): WorkflowStep[] | undefined {
+  if (project.workflow === undefined) {
+    return undefined;
+  }
+  return workflows[project.workflow]?.[command]?.steps;
+}
+
+/**
+ * Builds the environment variables shared by the run steps of a project
+ *
+ * @param project - Project configuration
+ * @param workingDir - Resolved project directory
+ * @param command - Command being run
+ * @param planFilePath - Saved plan an apply uses, if any
+ * @returns Variables added to the environment of every run step
+ *
+ * @example
+ * buildWorkflowEnv({ name: 'prod', dir: 'envs/prod' }, '/repo/envs/prod', 'plan')
+ * // => { PROJECT_NAME: 'prod', DIR: '/repo/envs/prod', WORKSPACE: 'default', COMMAND: 'plan' }
+ */
+export function buildWorkflowEnv(
+  project: ProjectConfig,
+  workingDir: string,
+  command: TerraformCommand,
+  planFilePath?: string
+): Record<string, string> {
+  const env: Record<string, string> = {
+    PROJECT_NAME: project.name,
+    DIR: workingDir,
+    WORKSPACE: project.workspace ?? 'default',
+    COMMAND: command,
+  };
+  if (planFilePath) {
+    env.PLANFILE = planFilePath;
+  }
+  return env;
+}
+
+/**
+ * Runs the steps of a custom workflow in order
+ *
+ * @param steps - Workflow steps (validated to contain the command step exactly once)
+ * @param command - Command the workflow runs for
+ * @param workingDir - Directory containing Terraform files
+ * @param projectName - Name of the project
+ * @param env - Variables added to the environment of every run step
+ * @param executionOptions - Per-project execution options
+ * @param runCommandStep - Runs the terraform command itself (plan or apply through tfcmt)
+ * @returns Result of the command step
+ * @throws TerraformCommandError if a step fails; later steps do not run
+ *
+ * @remarks
+ * The command step runs without its usual init, so a workflow without an `init`
+ * step must initialize the project itself. Run steps after a plan see the saved
+ * plan as PLANFILE.
+ */
+export async function runWorkflow(
+  steps: WorkflowStep[],
+  command: TerraformCommand,
+  workingDir: string,
+  projectName: string,
+  env: Record<string, string>,
+  executionOptions: TerraformExecutionOptions,
+  runCommandStep: (options: TerraformExecutionOptions) => Promise<TerraformResult>
+): Promise<TerraformResult> {
+  // Workflow variables win over the project's env, and each step's own over both
+  const stepEnv = { ...executionOptions.env, ...env };
+  let result: TerraformResult | undefined;
+
+  for (const step of steps) {
+    if (step === 'init') {
+      await executeTerraformInit(workingDir, projectName, executionOptions);
+    } else if (step === command) {
+      result = await runCommandStep({ ...executionOptions, skipInit: true });
+      if (result.planFilePath) {
+        stepEnv.PLANFILE = result.planFilePath;
+      }
+    } else if (typeof step === 'object') {
+      core.startGroup(`Running workflow step for project: ${projectName}`);
+      try {
+        await executeRunStep(
+          step.run,
+          workingDir,
+          { ...stepEnv, ...step.env },
+          `${command} workflow step`
+        );
+      } finally {
+        core.endGroup();
+      }
+    }
+  }
+
+  if (!result) {
+    throw new Error(`The workflow of project ${projectName} has no ${command} step`);
+  }
+  return result;
+}